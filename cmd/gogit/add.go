@@ -0,0 +1,347 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/format/gitignore"
+	"github.com/go-git/go-git/v6/plumbing/format/index"
+	"github.com/spf13/cobra"
+)
+
+var (
+	addDryRun  bool
+	addVerbose bool
+	addForce   bool
+	addUpdate  bool
+	addAll     bool
+)
+
+func init() {
+	addCmd.Flags().BoolVarP(&addDryRun, "dry-run", "n", false, "Only show what would be added")
+	addCmd.Flags().BoolVarP(&addVerbose, "verbose", "v", false, "Show the files added and removed")
+	addCmd.Flags().BoolVarP(&addForce, "force", "f", false, "Allow adding ignored files")
+	addCmd.Flags().BoolVarP(&addUpdate, "update", "u", false, "Only update the files already in the index")
+	addCmd.Flags().BoolVarP(&addAll, "all", "A", false, "Also add the untracked files and remove the deleted ones")
+	rootCmd.AddCommand(addCmd)
+}
+
+var addCmd = &cobra.Command{
+	Use:   "add [-n] [-v] [-f] [-u | -A] [--] [<pathspec>...]",
+	Short: "Add file contents to the index",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if addUpdate && addAll {
+			return errors.New("-A and -u are mutually incompatible")
+		}
+
+		if len(args) == 0 && !addUpdate && !addAll {
+			fmt.Fprintln(cmd.ErrOrStderr(), "Nothing specified, nothing added.")
+			fmt.Fprintln(cmd.ErrOrStderr(), "hint: Maybe you wanted to say 'git add .'?")
+
+			return nil
+		}
+
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		w, err := r.Worktree()
+		if err != nil {
+			return err
+		}
+
+		idx, err := r.Storer.Index()
+		if err != nil {
+			return fmt.Errorf("failed to read index: %w", err)
+		}
+
+		var ignore gitignore.Matcher
+		if !addForce {
+			ignore, err = standardIgnoreRules(r, w)
+			if err != nil {
+				return err
+			}
+		}
+
+		paths, ignored, err := addPaths(w, idx, ignore, args)
+		if err != nil {
+			return err
+		}
+
+		conv, err := newConverter(r, attrCheckin, cmd.ErrOrStderr())
+		if err != nil {
+			return err
+		}
+		defer conv.Close()
+
+		s := &stager{r: r, fs: w.Filesystem, idx: idx, conv: conv, dryRun: addDryRun}
+		if addVerbose || addDryRun {
+			s.out = cmd.OutOrStdout()
+		}
+
+		for _, p := range paths {
+			err := s.stage(p)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = s.write()
+		if err != nil {
+			return err
+		}
+
+		if len(ignored) == 0 {
+			return nil
+		}
+
+		errOut := cmd.ErrOrStderr()
+
+		fmt.Fprintln(errOut, "The following paths are ignored by one of your .gitignore files:")
+
+		for _, p := range ignored {
+			fmt.Fprintln(errOut, p)
+		}
+
+		fmt.Fprintln(errOut, "hint: Use -f if you really want to add them.")
+
+		cmd.SilenceErrors = true
+		cmd.SilenceUsage = true
+
+		return exitStatus(1)
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// addPaths returns the sorted paths add looks at: the tracked ones the
+// pathspecs match and, unless -u is given, the untracked files they match
+// that are not ignored. It also returns the pathspecs naming only ignored
+// files, and fails on those matching nothing.
+func addPaths(w *git.Worktree, idx *index.Index, ignore gitignore.Matcher, specs []string) ([]string, []string, error) {
+	spec := newPathspec(specs)
+	seen := make(map[string]bool)
+
+	var paths []string
+
+	for _, e := range idx.Entries {
+		if !seen[e.Name] && spec.matches(e.Name) {
+			seen[e.Name] = true
+			paths = append(paths, e.Name)
+		}
+	}
+
+	if !addUpdate {
+		untracked, err := untrackedFiles(w, idx, ignore)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, p := range untracked {
+			// Nested repositories are not added as submodules.
+			if !strings.HasSuffix(p, "/") && spec.matches(p) {
+				paths = append(paths, p)
+			}
+		}
+	}
+
+	var ignored []string
+
+	for _, s := range specs {
+		one := newPathspec([]string{s})
+		if one.prefixes[0] == "." || containsMatch(paths, one) {
+			continue
+		}
+
+		fi, err := w.Filesystem.Lstat(one.prefixes[0])
+		if err == nil && ignore != nil && ignore.Match(strings.Split(one.prefixes[0], "/"), fi.IsDir()) {
+			ignored = append(ignored, one.prefixes[0])
+
+			continue
+		}
+
+		return nil, nil, fmt.Errorf("pathspec '%s' did not match any files", s)
+	}
+
+	sort.Strings(paths)
+
+	return paths, ignored, nil
+}
+
+func containsMatch(paths []string, spec *pathspec) bool {
+	for _, p := range paths {
+		if spec.matches(p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// stager updates the entries of an index from the worktree. The files go
+// through their clean filter, so that for instance the builtin Git LFS
+// filter stores their contents and stages their pointer.
+type stager struct {
+	r    *git.Repository
+	fs   billy.Filesystem
+	idx  *index.Index
+	conv *converter
+
+	dryRun bool
+
+	// out, if not nil, is where the paths added and removed are listed.
+	out io.Writer
+}
+
+// stage updates the index entry of the path from the worktree, removing it
+// if the file is gone. Entries whose stat information matches the file are
+// taken as up to date, as git does.
+func (s *stager) stage(p string) error {
+	var current *index.Entry
+
+	for _, e := range s.idx.Entries {
+		if e.Name == p && e.Stage == 0 {
+			current = e
+		}
+	}
+
+	fi, err := s.fs.Lstat(p)
+	if errors.Is(err, os.ErrNotExist) {
+		s.report("remove", p)
+		s.replace(p, nil)
+
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", p, err)
+	}
+
+	if fi.IsDir() {
+		return nil
+	}
+
+	mode, err := filemode.NewFromOSFileMode(fi.Mode())
+	if err != nil {
+		return fmt.Errorf("unable to add %s: %w", p, err)
+	}
+
+	if current != nil && current.Mode == mode && int64(current.Size) == fi.Size() && current.ModifiedAt.Equal(fi.ModTime()) {
+		return nil
+	}
+
+	var data []byte
+
+	if mode == filemode.Symlink {
+		target, err := s.fs.Readlink(p)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", p, err)
+		}
+
+		data = []byte(target)
+	} else {
+		data, err = util.ReadFile(s.fs, p)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", p, err)
+		}
+
+		data, err = s.conv.toGit(p, data)
+		if err != nil {
+			return err
+		}
+	}
+
+	obj, err := newObject(s.r.Storer, plumbing.BlobObject, data)
+	if err != nil {
+		return err
+	}
+
+	if current == nil || current.Hash != obj.Hash() || current.Mode != mode {
+		s.report("add", p)
+	}
+
+	if s.dryRun {
+		return nil
+	}
+
+	h, err := s.r.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return fmt.Errorf("unable to add %s: %w", p, err)
+	}
+
+	s.replace(p, &index.Entry{
+		Name:       p,
+		Hash:       h,
+		Mode:       mode,
+		Size:       uint32(fi.Size()),
+		ModifiedAt: fi.ModTime(),
+	})
+
+	return nil
+}
+
+// replace replaces the entries of the path, conflicted ones included, by
+// e, or removes them when e is nil.
+func (s *stager) replace(p string, e *index.Entry) {
+	if s.dryRun {
+		return
+	}
+
+	entries := s.idx.Entries[:0]
+
+	for _, old := range s.idx.Entries {
+		if old.Name != p {
+			entries = append(entries, old)
+		}
+	}
+
+	if e != nil {
+		entries = append(entries, e)
+	}
+
+	s.idx.Entries = entries
+}
+
+// write writes the index, sorted.
+func (s *stager) write() error {
+	if s.dryRun {
+		return nil
+	}
+
+	sortIndexEntries(s.idx)
+
+	err := s.r.Storer.SetIndex(s.idx)
+	if err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+
+	return nil
+}
+
+// sortIndexEntries sorts the entries of idx by name and stage, as they
+// are written.
+func sortIndexEntries(idx *index.Index) {
+	sort.Slice(idx.Entries, func(i, j int) bool {
+		ei, ej := idx.Entries[i], idx.Entries[j]
+		if ei.Name != ej.Name {
+			return ei.Name < ej.Name
+		}
+
+		return ei.Stage < ej.Stage
+	})
+}
+
+func (s *stager) report(action, p string) {
+	if s.out != nil {
+		fmt.Fprintf(s.out, "%s '%s'\n", action, p)
+	}
+}
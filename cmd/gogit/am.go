@@ -0,0 +1,780 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/spf13/cobra"
+)
+
+const (
+	amStateDir = "rebase-apply"
+
+	// amFailed is the exit code of a stopped am session, as with git.
+	amFailed = 128
+)
+
+var (
+	amThreeWay bool
+	amContinue bool
+	amSkip     bool
+	amAbort    bool
+)
+
+func init() {
+	amCmd.Flags().BoolVarP(&amThreeWay, "3way", "3", false, "Fall back to a three-way merge when a patch does not apply")
+	amCmd.Flags().BoolVarP(&amContinue, "continue", "", false, "Commit the resolved patch and go on with the next ones")
+	amCmd.Flags().BoolVarP(&amSkip, "skip", "", false, "Skip the failed patch and go on with the next ones")
+	amCmd.Flags().BoolVarP(&amAbort, "abort", "", false, "Stop applying patches and restore the original branch")
+	rootCmd.AddCommand(amCmd)
+}
+
+var amCmd = &cobra.Command{
+	Use:   "am [--3way] [--continue | --skip | --abort] [<mbox>...]",
+	Short: "Apply a series of patches from a mailbox",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s, err := openAm(cmd.ErrOrStderr())
+		if err != nil {
+			return err
+		}
+
+		resuming := amContinue || amSkip || amAbort
+
+		switch {
+		case amContinue && amSkip, amContinue && amAbort, amSkip && amAbort:
+			return errors.New("--continue, --skip and --abort cannot be used together")
+		case resuming && !s.started():
+			fmt.Fprintln(cmd.ErrOrStderr(), "fatal: Resolve operation not in progress, we are not resuming.")
+
+			return amStop(cmd)
+		case resuming && len(args) > 0:
+			return errors.New("--continue, --skip and --abort take no mailbox")
+		case !resuming && s.started():
+			fmt.Fprintf(cmd.ErrOrStderr(), "fatal: previous rebase directory .git/%s still exists but mbox given.\n", amStateDir)
+
+			return amStop(cmd)
+		}
+
+		out := cmd.OutOrStdout()
+
+		switch {
+		case amAbort:
+			return s.abort()
+		case amSkip:
+			err = s.skip()
+		case amContinue:
+			var ok bool
+
+			ok, err = s.resolved(out)
+			if err == nil && !ok {
+				s.stopped(out)
+
+				return amStop(cmd)
+			}
+		default:
+			err = s.start(cmd.InOrStdin(), args)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		ok, err := s.run(out, cmd.ErrOrStderr())
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			return amStop(cmd)
+		}
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+func amStop(cmd *cobra.Command) error {
+	cmd.SilenceErrors = true
+	cmd.SilenceUsage = true
+
+	return exitStatus(amFailed)
+}
+
+// amSession holds the state of an am session, which is kept in the
+// rebase-apply directory of the git directory the way git does: the mails
+// are numbered from 0001, with next and last recording the mail being
+// applied and the final one. ORIG_HEAD is where abort returns to.
+type amSession struct {
+	r     *git.Repository
+	fs    billy.Filesystem
+	hooks *hooks
+
+	next, last int
+	threeWay   bool
+}
+
+func openAm(errOut io.Writer) (*amSession, error) {
+	r, err := git.PlainOpen(".")
+	if err != nil {
+		return nil, err
+	}
+
+	store, ok := r.Storer.(*filesystem.Storage)
+	if !ok {
+		return nil, errors.New("storer does not implement filesystem.Storage")
+	}
+
+	s := &amSession{r: r, fs: store.Filesystem(), hooks: newHooks(r, errOut)}
+	if !s.started() {
+		return s, nil
+	}
+
+	for name, n := range map[string]*int{"next": &s.next, "last": &s.last} {
+		data, err := util.ReadFile(s.fs, path.Join(amStateDir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read am state: %w", err)
+		}
+
+		*n, err = strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("corrupt am state %s: %w", name, err)
+		}
+	}
+
+	data, err := util.ReadFile(s.fs, path.Join(amStateDir, "threeway"))
+	s.threeWay = err == nil && strings.TrimSpace(string(data)) == "t"
+
+	return s, nil
+}
+
+func (s *amSession) started() bool {
+	_, err := s.fs.Stat(amStateDir)
+
+	return err == nil
+}
+
+// start splits the mailboxes, or stdin when none are given, into the
+// numbered mails of a new session.
+func (s *amSession) start(stdin io.Reader, mboxes []string) error {
+	wt, err := s.r.Worktree()
+	if err != nil {
+		return err
+	}
+
+	status, err := wt.Status()
+	if err != nil {
+		return fmt.Errorf("failed to get status: %w", err)
+	}
+
+	var dirty []string
+
+	for name, fs := range status {
+		if fs.Staging != git.Unmodified && fs.Staging != git.Untracked {
+			dirty = append(dirty, name)
+		}
+	}
+
+	if len(dirty) > 0 {
+		sort.Strings(dirty)
+
+		return fmt.Errorf("dirty index: cannot apply patches (dirty: %s)", strings.Join(dirty, " "))
+	}
+
+	if len(mboxes) == 0 {
+		mboxes = []string{"-"}
+	}
+
+	var mails [][]byte
+
+	for _, name := range mboxes {
+		var data []byte
+
+		if name == "-" {
+			data, err = io.ReadAll(stdin)
+		} else {
+			data, err = os.ReadFile(name)
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to read mailbox: %w", err)
+		}
+
+		mails = append(mails, splitMbox(data)...)
+	}
+
+	if len(mails) == 0 {
+		return errors.New("patch format detection failed")
+	}
+
+	err = s.fs.MkdirAll(amStateDir, 0o755)
+	if err != nil {
+		return fmt.Errorf("failed to create am state: %w", err)
+	}
+
+	for i, m := range mails {
+		err = util.WriteFile(s.fs, s.mailFile(i+1), m, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to write am state: %w", err)
+		}
+	}
+
+	threeWay := "f"
+	if amThreeWay {
+		threeWay = "t"
+	}
+
+	err = util.WriteFile(s.fs, path.Join(amStateDir, "threeway"), []byte(threeWay+"\n"), 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to write am state: %w", err)
+	}
+
+	s.next, s.last, s.threeWay = 1, len(mails), amThreeWay
+
+	err = s.save()
+	if err != nil {
+		return err
+	}
+
+	head, err := s.r.Head()
+	if err == nil {
+		err = s.r.Storer.SetReference(plumbing.NewHashReference(plumbing.ReferenceName("ORIG_HEAD"), head.Hash()))
+		if err != nil {
+			return fmt.Errorf("failed to update ORIG_HEAD: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (s *amSession) mailFile(n int) string {
+	return path.Join(amStateDir, fmt.Sprintf("%04d", n))
+}
+
+func (s *amSession) save() error {
+	for name, n := range map[string]int{"next": s.next, "last": s.last} {
+		err := util.WriteFile(s.fs, path.Join(amStateDir, name), []byte(strconv.Itoa(n)+"\n"), 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to write am state: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// run applies and commits the remaining mails, stopping at the first one
+// that fails. The session ends once all of them are committed.
+func (s *amSession) run(out, errOut io.Writer) (bool, error) {
+	for s.next <= s.last {
+		m, err := s.mail()
+		if err != nil {
+			return false, err
+		}
+
+		fmt.Fprintf(out, "Applying: %s\n", m.subject)
+
+		files, err := parsePatch(m.patch)
+		if err != nil || len(files) == 0 {
+			fmt.Fprintln(out, "Patch is empty.")
+			s.stopped(out)
+
+			return false, nil
+		}
+
+		ok, err := s.apply(files, out, errOut)
+		if err != nil {
+			return false, err
+		}
+
+		if !ok {
+			fmt.Fprintf(out, "Patch failed at %04d %s\n", s.next, m.subject)
+			s.stopped(out)
+
+			return false, nil
+		}
+
+		err = s.commit(m)
+		if err != nil {
+			return false, err
+		}
+
+		s.next++
+
+		err = s.save()
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return true, s.finish()
+}
+
+// apply applies files to the index and the working tree, falling back to
+// a three-way merge with --3way.
+func (s *amSession) apply(files []*patchFile, out, errOut io.Writer) (bool, error) {
+	// Like git, only report why a patch failed when nothing else is tried.
+	applyOut := errOut
+	if s.threeWay {
+		applyOut = io.Discard
+	}
+
+	a, err := newPatchApplier(s.r, true, applyOut)
+	if err != nil {
+		return false, err
+	}
+	defer a.Close()
+
+	ok, err := a.apply(files)
+	if err != nil || (!ok && !s.threeWay) {
+		return false, err
+	}
+
+	if ok {
+		return true, a.write()
+	}
+
+	fmt.Fprintln(out, "Using index info to reconstruct a base tree...")
+
+	for _, f := range files {
+		if f.oldPath == "" || len(f.hunks) == 0 {
+			continue
+		}
+
+		if _, ok := a.resolveBlob(f.oldID); !ok {
+			fmt.Fprintln(errOut, "error: repository lacks necessary blobs to fall back on 3-way merge.")
+
+			return false, nil
+		}
+
+		fmt.Fprintf(out, "M\t%s\n", f.oldPath)
+	}
+
+	fmt.Fprintln(out, "Falling back to patching base and 3-way merge...")
+
+	a, err = newPatchApplier(s.r, true, io.Discard)
+	if err != nil {
+		return false, err
+	}
+	defer a.Close()
+
+	a.threeWay = true
+
+	ok, err = a.apply(files)
+	if err != nil || !ok {
+		fmt.Fprintln(errOut, "error: Failed to merge in the changes.")
+
+		return false, err
+	}
+
+	for _, name := range a.order {
+		f := a.files[name]
+		if !f.merged {
+			continue
+		}
+
+		fmt.Fprintf(out, "Auto-merging %s\n", name)
+
+		if f.stages != nil {
+			fmt.Fprintf(out, "CONFLICT (content): Merge conflict in %s\n", name)
+		}
+	}
+
+	err = a.write()
+	if err != nil {
+		return false, err
+	}
+
+	if a.conflicts {
+		fmt.Fprintln(errOut, "error: Failed to merge in the changes.")
+
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// commit commits the index with the author and message of m, moving the
+// current branch to it.
+func (s *amSession) commit(m *amMail) error {
+	idx, err := s.r.Storer.Index()
+	if err != nil {
+		return fmt.Errorf("failed to read index: %w", err)
+	}
+
+	tree, err := writeIndexTree(s.r, idx.Entries, "", false)
+	if err != nil {
+		return err
+	}
+
+	c := &object.Commit{
+		Author:    m.author,
+		Committer: signature(s.r, committerRole),
+		Message:   m.message,
+		TreeHash:  tree,
+	}
+
+	head, err := s.r.Reference(plumbing.HEAD, true)
+	if err == nil {
+		c.ParentHashes = []plumbing.Hash{head.Hash()}
+	}
+
+	obj := s.r.Storer.NewEncodedObject()
+
+	err = c.Encode(obj)
+	if err != nil {
+		return fmt.Errorf("failed to encode commit: %w", err)
+	}
+
+	h, err := s.r.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return fmt.Errorf("failed to write commit: %w", err)
+	}
+
+	return s.moveHead(h, "am: "+m.subject)
+}
+
+// moveHead points the current branch, or HEAD when it is detached, at h.
+func (s *amSession) moveHead(h plumbing.Hash, msg string) error {
+	name := plumbing.HEAD
+
+	head, err := s.r.Reference(plumbing.HEAD, false)
+	if err != nil {
+		return fmt.Errorf("failed to get HEAD: %w", err)
+	}
+
+	if head.Type() == plumbing.SymbolicReference {
+		name = head.Target()
+	}
+
+	return inRefTransaction(s.hooks, staticReflogMessage(msg), func() error {
+		err := s.r.Storer.SetReference(plumbing.NewHashReference(name, h))
+		if err != nil {
+			return fmt.Errorf("failed to update %s: %w", name, err)
+		}
+
+		return nil
+	})
+}
+
+// resolved commits the index in place of the mail that failed to apply,
+// once its conflicts are resolved.
+func (s *amSession) resolved(out io.Writer) (bool, error) {
+	m, err := s.mail()
+	if err != nil {
+		return false, err
+	}
+
+	fmt.Fprintf(out, "Applying: %s\n", m.subject)
+
+	idx, err := s.r.Storer.Index()
+	if err != nil {
+		return false, fmt.Errorf("failed to read index: %w", err)
+	}
+
+	for _, e := range idx.Entries {
+		if e.Stage != 0 {
+			fmt.Fprintln(out, "You still have unmerged paths in your index.")
+			fmt.Fprintln(out, "You should stage each file with resolved conflicts to mark them as such.")
+
+			return false, nil
+		}
+	}
+
+	tree, err := writeIndexTree(s.r, idx.Entries, "", false)
+	if err != nil {
+		return false, err
+	}
+
+	if head, err := s.r.Head(); err == nil {
+		c, err := s.r.CommitObject(head.Hash())
+		if err != nil {
+			return false, err
+		}
+
+		if c.TreeHash == tree {
+			fmt.Fprintln(out, "No changes - did you forget to use 'gogit add'?")
+			fmt.Fprintln(out, "If there is nothing left to stage, chances are that something else")
+			fmt.Fprintln(out, "already introduced the same changes; you might want to skip this patch.")
+
+			return false, nil
+		}
+	}
+
+	err = s.commit(m)
+	if err != nil {
+		return false, err
+	}
+
+	s.next++
+
+	return true, s.save()
+}
+
+// skip drops the changes of the mail that failed to apply and moves on to
+// the next one.
+func (s *amSession) skip() error {
+	err := s.resetTo(plumbing.ZeroHash)
+	if err != nil {
+		return err
+	}
+
+	s.next++
+
+	return s.save()
+}
+
+// abort ends the session, returning the branch to where it started.
+func (s *amSession) abort() error {
+	orig, err := s.r.Reference(plumbing.ReferenceName("ORIG_HEAD"), true)
+	if err != nil {
+		return fmt.Errorf("failed to read ORIG_HEAD: %w", err)
+	}
+
+	err = s.resetTo(orig.Hash())
+	if err != nil {
+		return err
+	}
+
+	return s.finish()
+}
+
+// resetTo discards the changes of the index and the working tree, after
+// moving the current branch to h unless it is zero.
+func (s *amSession) resetTo(h plumbing.Hash) error {
+	wt, err := s.r.Worktree()
+	if err != nil {
+		return err
+	}
+
+	head, err := s.r.Head()
+	if err != nil {
+		return fmt.Errorf("failed to get HEAD: %w", err)
+	}
+
+	if !h.IsZero() && h != head.Hash() {
+		err = s.moveHead(h, "am --abort")
+		if err != nil {
+			return err
+		}
+	}
+
+	// The index may hold conflicts, which the reset does not expect.
+	idx, err := s.r.Storer.Index()
+	if err != nil {
+		return fmt.Errorf("failed to read index: %w", err)
+	}
+
+	entries := idx.Entries[:0]
+
+	for _, e := range idx.Entries {
+		if e.Stage == 0 {
+			entries = append(entries, e)
+		}
+	}
+
+	idx.Entries = entries
+
+	err = s.r.Storer.SetIndex(idx)
+	if err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+
+	return resetWorktree(s.r, wt, head.Hash())
+}
+
+func (s *amSession) finish() error {
+	err := util.RemoveAll(s.fs, amStateDir)
+	if err != nil {
+		return fmt.Errorf("failed to remove am state: %w", err)
+	}
+
+	return nil
+}
+
+func (s *amSession) stopped(out io.Writer) {
+	fmt.Fprintln(out, `When you have resolved this problem, run "gogit am --continue".`)
+	fmt.Fprintln(out, `If you prefer to skip this patch, run "gogit am --skip" instead.`)
+	fmt.Fprintln(out, `To restore the original branch and stop patching, run "gogit am --abort".`)
+}
+
+func (s *amSession) mail() (*amMail, error) {
+	data, err := util.ReadFile(s.fs, s.mailFile(s.next))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read am state: %w", err)
+	}
+
+	return parseMail(data)
+}
+
+// splitMbox splits an mbox into its mails, dropping their "From " lines.
+// Input not in mbox format is taken to be a single mail.
+func splitMbox(data []byte) [][]byte {
+	if !bytes.HasPrefix(data, []byte("From ")) {
+		if len(bytes.TrimSpace(data)) == 0 {
+			return nil
+		}
+
+		return [][]byte{data}
+	}
+
+	var (
+		mails [][]byte
+		cur   []byte
+	)
+
+	blank := true
+
+	for _, line := range splitLines(string(data)) {
+		if blank && strings.HasPrefix(line, "From ") {
+			if cur != nil {
+				mails = append(mails, cur)
+			}
+
+			cur = []byte{}
+
+			continue
+		}
+
+		blank = line == "\n"
+		cur = append(cur, line...)
+	}
+
+	return append(mails, cur)
+}
+
+// amMail is a patch mail parsed the way git mailinfo does.
+type amMail struct {
+	author  object.Signature
+	subject string
+	message string
+	patch   []byte
+}
+
+var subjectPrefix = regexp.MustCompile(`^\s*(?:(?i:re:)\s*|\[[^\]]*\]\s*)*`)
+
+// parseMail parses a patch mail. Its message ends where its patch starts,
+// at a "---" line or the first diff, and the headers at the start of its
+// body take precedence over those of the mail.
+func parseMail(data []byte) (*amMail, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse mail: %w", err)
+	}
+
+	body, err := io.ReadAll(msg.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse mail: %w", err)
+	}
+
+	switch strings.ToLower(msg.Header.Get("Content-Transfer-Encoding")) {
+	case "quoted-printable":
+		body, err = io.ReadAll(quotedprintable.NewReader(bytes.NewReader(body)))
+	case "base64":
+		body, err = io.ReadAll(base64.NewDecoder(base64.StdEncoding, newlineStripper{bytes.NewReader(body)}))
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode mail body: %w", err)
+	}
+
+	headers := map[string]string{}
+	for _, h := range []string{"From", "Date", "Subject"} {
+		headers[h] = msg.Header.Get(h)
+	}
+
+	lines := splitLines(string(body))
+
+	// Take any in-body headers, which format-patch writes when the author
+	// is not the sender.
+	for len(lines) > 0 {
+		name, value, ok := strings.Cut(strings.TrimSuffix(lines[0], "\n"), ": ")
+		if _, known := headers[name]; !ok || !known {
+			break
+		}
+
+		headers[name] = value
+		lines = lines[1:]
+	}
+
+	m := &amMail{}
+
+	var dec mime.WordDecoder
+
+	subject, err := dec.DecodeHeader(headers["Subject"])
+	if err != nil {
+		subject = headers["Subject"]
+	}
+
+	m.subject = strings.TrimSpace(subjectPrefix.ReplaceAllString(subject, ""))
+
+	addr, err := mail.ParseAddress(headers["From"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid author in mail: %q", headers["From"])
+	}
+
+	m.author = object.Signature{Name: addr.Name, Email: addr.Address}
+	if m.author.Name == "" {
+		m.author.Name = addr.Address
+	}
+
+	m.author.When, err = mail.ParseDate(headers["Date"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid date in mail: %q", headers["Date"])
+	}
+
+	start := len(lines)
+
+	for i, line := range lines {
+		if strings.TrimRight(line, " \t\n") == "---" || strings.HasPrefix(line, "diff -") || strings.HasPrefix(line, "Index: ") {
+			start = i
+
+			break
+		}
+	}
+
+	m.message = m.subject + "\n"
+	if text := strings.TrimRight(strings.TrimLeft(strings.Join(lines[:start], ""), "\n"), " \t\n"); text != "" {
+		m.message += "\n" + text + "\n"
+	}
+
+	m.patch = []byte(strings.Join(lines[start:], ""))
+
+	return m, nil
+}
+
+// newlineStripper drops the line breaks of base64 text.
+type newlineStripper struct {
+	r io.Reader
+}
+
+func (n newlineStripper) Read(p []byte) (int, error) {
+	c, err := n.r.Read(p)
+
+	k := 0
+
+	for _, b := range p[:c] {
+		if b != '\r' && b != '\n' {
+			p[k] = b
+			k++
+		}
+	}
+
+	return k, err
+}
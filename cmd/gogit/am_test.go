@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// amStep is a step of an am session: a file to resolve and stage, or a
+// command to run.
+type amStep struct {
+	resolve, content string
+	args             []string
+}
+
+// sameAm runs steps in a repository made by patchRepo, on a branch from
+// base, with git and with gogit. The series of topic is in the file mbox,
+// as git format-patch writes it. It checks that they report and leave the
+// history, index and working tree alike.
+func sameAm(t *testing.T, setup func(dir string), steps ...amStep) {
+	t.Helper()
+
+	var states []string
+
+	for _, tool := range []string{"git", "gogit"} {
+		dir := patchRepo(t)
+		writeFile(t, dir, "../mbox", gitCmd(t, dir, "format-patch", "--stdout", "main..topic"))
+		gitCmd(t, dir, "checkout", "-q", "-b", "applied", "main")
+
+		if setup != nil {
+			setup(dir)
+		}
+
+		var state strings.Builder
+
+		for _, step := range steps {
+			if step.resolve != "" {
+				writeFile(t, dir, step.resolve, step.content)
+				gitCmd(t, dir, "add", step.resolve)
+
+				continue
+			}
+
+			var res result
+			if tool == "git" {
+				res = run(t, dir, "", "git", step.args...)
+			} else {
+				res = gogit(t, dir, step.args...)
+			}
+
+			out := strings.NewReplacer(`"gogit `, `"git `, "'gogit ", "'git ").Replace(res.stdout)
+			fmt.Fprintf(&state, "%v exit %d\n%s", step.args, res.code, out)
+		}
+
+		state.WriteString(gitCmd(t, dir, "log", "--format=%H %an %ae %ad %cd%n%B", "HEAD"))
+		state.WriteString(gitCmd(t, dir, "rev-parse", "--symbolic-full-name", "HEAD"))
+		state.WriteString(worktreeState(t, dir))
+		fmt.Fprintf(&state, "session %v\n", exists(t, dir, filepath.Join(".git", "rebase-apply")))
+
+		states = append(states, state.String())
+	}
+
+	if states[1] != states[0] {
+		t.Errorf("gogit am gave:\n%s\nwant, as git:\n%s", states[1], states[0])
+	}
+}
+
+func TestAm(t *testing.T) {
+	sameAm(t, nil, amStep{args: []string{"am", "../mbox"}})
+	sameAm(t, nil, amStep{args: []string{"am", "-3", "../mbox"}})
+}
+
+// conflictingA commits a change to the line of a that the first patch of
+// the series changes too.
+func conflictingA(t *testing.T) func(dir string) {
+	return func(dir string) {
+		writeFile(t, dir, "a", "one\ntwo\nthree!\nfour\nfive\nsix\nseven\neight\nnine\nten\n")
+		gitCmd(t, dir, "commit", "-q", "-a", "-m", "conflict")
+	}
+}
+
+func TestAmConflict(t *testing.T) {
+	am := amStep{args: []string{"am", "../mbox"}}
+
+	t.Run("skip", func(t *testing.T) {
+		sameAm(t, conflictingA(t), am, amStep{args: []string{"am", "--skip"}})
+	})
+
+	t.Run("abort", func(t *testing.T) {
+		sameAm(t, conflictingA(t), am, amStep{args: []string{"am", "--abort"}})
+	})
+
+	t.Run("continue", func(t *testing.T) {
+		sameAm(t, conflictingA(t), am,
+			amStep{args: []string{"am", "--continue"}},
+			amStep{resolve: "a", content: "one\ntwo\nTHREE!\nfour\nfive\nsix\nseven\neight\nNINE\nten\n"},
+			amStep{args: []string{"am", "--continue"}},
+		)
+	})
+
+	t.Run("3way", func(t *testing.T) {
+		sameAm(t, conflictingA(t),
+			amStep{args: []string{"am", "--3way", "../mbox"}},
+			amStep{resolve: "a", content: "one\ntwo\nTHREE!\nfour\nfive\nsix\nseven\neight\nNINE\nten\n"},
+			amStep{args: []string{"am", "--continue"}},
+		)
+	})
+
+	t.Run("3way clean", func(t *testing.T) {
+		sameAm(t, func(dir string) {
+			writeFile(t, dir, "a", "zero\n"+readFile(t, filepath.Join(dir, "a")))
+			gitCmd(t, dir, "commit", "-q", "-a", "-m", "moved")
+		}, amStep{args: []string{"am", "--3way", "../mbox"}})
+	})
+
+	// Without a session, there is nothing to resume.
+	sameAm(t, nil, amStep{args: []string{"am", "--continue"}}, amStep{args: []string{"am", "--abort"}})
+}
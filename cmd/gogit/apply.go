@@ -0,0 +1,1456 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/format/index"
+	"github.com/go-git/go-git/v6/plumbing/format/packfile"
+	"github.com/go-git/go-git/v6/storage/memory"
+	"github.com/spf13/cobra"
+)
+
+var (
+	applyCheck    bool
+	applyIndex    bool
+	applyThreeWay bool
+	applyReverse  bool
+)
+
+func init() {
+	applyCmd.Flags().BoolVarP(&applyCheck, "check", "", false, "Only check that the patch applies, without applying it")
+	applyCmd.Flags().BoolVarP(&applyIndex, "index", "", false, "Apply the patch to the index as well as the working tree")
+	applyCmd.Flags().BoolVarP(&applyThreeWay, "3way", "3", false, "Merge the patch into the files when it does not apply, leaving conflicts in the index")
+	applyCmd.Flags().BoolVarP(&applyReverse, "reverse", "R", false, "Apply the patch in reverse")
+	rootCmd.AddCommand(applyCmd)
+}
+
+var applyCmd = &cobra.Command{
+	Use:   "apply [--check] [--index] [--3way] [-R] [<patch>...]",
+	Short: "Apply a patch to the working tree and the index",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		var files []*patchFile
+
+		if len(args) == 0 {
+			args = []string{"-"}
+		}
+
+		for _, name := range args {
+			var data []byte
+			if name == "-" {
+				data, err = io.ReadAll(cmd.InOrStdin())
+			} else {
+				data, err = os.ReadFile(name)
+			}
+
+			if err != nil {
+				return fmt.Errorf("can't open patch '%s': %w", name, err)
+			}
+
+			p, err := parsePatch(data)
+			if err != nil {
+				return err
+			}
+
+			files = append(files, p...)
+		}
+
+		if len(files) == 0 {
+			return errors.New("no valid patches in input")
+		}
+
+		if applyReverse {
+			for _, f := range files {
+				f.reverse()
+			}
+		}
+
+		a, err := newPatchApplier(r, applyIndex || applyThreeWay, cmd.ErrOrStderr())
+		if err != nil {
+			return err
+		}
+		defer a.Close()
+
+		a.threeWay = applyThreeWay
+
+		ok, err := a.apply(files)
+		if err != nil {
+			return err
+		}
+
+		if ok && !applyCheck {
+			err = a.write()
+			if err != nil {
+				return err
+			}
+		}
+
+		if !ok || a.conflicts {
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+
+			return exitStatus(1)
+		}
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// patchFile is the change a patch makes to one file. The old path is empty
+// for a created file, and the new one for a deleted file.
+type patchFile struct {
+	oldPath, newPath string
+	oldMode, newMode filemode.FileMode
+
+	// oldID and newID are the possibly abbreviated blob ids of the index
+	// line of a git patch.
+	oldID, newID string
+
+	hunks []patchHunk
+
+	// binary holds the forward and reverse hunks of a binary patch, and
+	// isBinary is set for binary patches with or without them.
+	binary   []binaryHunk
+	isBinary bool
+}
+
+// patchHunk is a hunk of a unified diff.
+type patchHunk struct {
+	oldStart, oldLines int
+	newStart, newLines int
+	lines              []diffLine
+}
+
+// binaryHunk is the new contents of a file, or a delta to them.
+type binaryHunk struct {
+	delta bool
+	data  []byte
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// patchParser reads the files of a patch, skipping any text around them.
+type patchParser struct {
+	lines []string
+	pos   int
+}
+
+// parsePatch returns the file patches of a git or unified diff.
+func parsePatch(data []byte) ([]*patchFile, error) {
+	p := &patchParser{lines: splitLines(string(data))}
+
+	var files []*patchFile
+
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+
+		var (
+			f   *patchFile
+			err error
+		)
+
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			f, err = p.gitFile()
+		case strings.HasPrefix(line, "--- ") && p.pos+2 < len(p.lines) &&
+			strings.HasPrefix(p.lines[p.pos+1], "+++ ") && strings.HasPrefix(p.lines[p.pos+2], "@@ -"):
+			f, err = p.traditionalFile()
+		default:
+			p.pos++
+
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, f)
+	}
+
+	return files, nil
+}
+
+// gitFile parses the header and hunks of a file of a git diff.
+func (p *patchParser) gitFile() (*patchFile, error) {
+	f := &patchFile{}
+	name := gitHeaderName(strings.TrimSuffix(strings.TrimPrefix(p.lines[p.pos], "diff --git "), "\n"))
+	f.oldPath, f.newPath = name, name
+	isNew, isDelete := false, false
+	p.pos++
+
+	for ; p.pos < len(p.lines); p.pos++ {
+		line := strings.TrimSuffix(p.lines[p.pos], "\n")
+
+		var err error
+
+		switch {
+		case strings.HasPrefix(line, "old mode "):
+			f.oldMode, err = parsePatchMode(line[len("old mode "):])
+		case strings.HasPrefix(line, "new mode "):
+			f.newMode, err = parsePatchMode(line[len("new mode "):])
+		case strings.HasPrefix(line, "deleted file mode "):
+			f.oldMode, err = parsePatchMode(line[len("deleted file mode "):])
+			isDelete = true
+		case strings.HasPrefix(line, "new file mode "):
+			f.newMode, err = parsePatchMode(line[len("new file mode "):])
+			isNew = true
+		case strings.HasPrefix(line, "rename from "), strings.HasPrefix(line, "copy from "):
+			_, rest, _ := strings.Cut(line, " from ")
+			f.oldPath, err = unquotePatchPath(rest)
+		case strings.HasPrefix(line, "rename to "), strings.HasPrefix(line, "copy to "):
+			_, rest, _ := strings.Cut(line, " to ")
+			f.newPath, err = unquotePatchPath(rest)
+		case strings.HasPrefix(line, "similarity index "), strings.HasPrefix(line, "dissimilarity index "):
+		case strings.HasPrefix(line, "index "):
+			ids, mode, _ := strings.Cut(line[len("index "):], " ")
+			f.oldID, f.newID, _ = strings.Cut(ids, "..")
+
+			if mode != "" {
+				f.oldMode, err = parsePatchMode(mode)
+				f.newMode = f.oldMode
+			}
+		case strings.HasPrefix(line, "--- "):
+			var old string
+
+			old, err = patchLineName(line[len("--- "):])
+			if old != "" {
+				f.oldPath = old
+			} else {
+				isNew = true
+			}
+		case strings.HasPrefix(line, "+++ "):
+			var name string
+
+			name, err = patchLineName(line[len("+++ "):])
+			if name != "" {
+				f.newPath = name
+			} else {
+				isDelete = true
+			}
+		case line == "GIT binary patch":
+			p.pos++
+			f.isBinary = true
+
+			return f.finish(isNew, isDelete, p.binaryHunks(f))
+		case strings.HasPrefix(line, "Binary files "):
+			p.pos++
+			f.isBinary = true
+
+			return f.finish(isNew, isDelete, nil)
+		default:
+			return f.finish(isNew, isDelete, p.hunks(f))
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("corrupt patch at line %d: %w", p.pos+1, err)
+		}
+	}
+
+	return f.finish(isNew, isDelete, nil)
+}
+
+// traditionalFile parses a file of a unified diff without git's header.
+func (p *patchParser) traditionalFile() (*patchFile, error) {
+	f := &patchFile{oldMode: filemode.Regular, newMode: filemode.Regular}
+
+	old, err := patchLineName(strings.TrimSuffix(p.lines[p.pos][len("--- "):], "\n"))
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := patchLineName(strings.TrimSuffix(p.lines[p.pos+1][len("+++ "):], "\n"))
+	if err != nil {
+		return nil, err
+	}
+
+	f.oldPath, f.newPath = old, name
+	p.pos += 2
+
+	return f.finish(old == "", name == "", p.hunks(f))
+}
+
+// finish settles the paths and modes of a created or deleted file.
+func (f *patchFile) finish(isNew, isDelete bool, err error) (*patchFile, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	if f.oldPath == "" && f.newPath == "" {
+		return nil, errors.New("patch lacks filename information")
+	}
+
+	if isNew {
+		f.oldPath, f.oldMode = "", 0
+	}
+
+	if isDelete {
+		f.newPath, f.newMode = "", 0
+	}
+
+	if f.oldPath != "" && f.newPath != "" {
+		if f.oldMode == 0 {
+			f.oldMode = f.newMode
+		}
+
+		if f.newMode == 0 {
+			f.newMode = f.oldMode
+		}
+	}
+
+	return f, nil
+}
+
+// hunks parses the hunks following the header of f.
+func (p *patchParser) hunks(f *patchFile) error {
+	for p.pos < len(p.lines) {
+		m := hunkHeader.FindStringSubmatch(p.lines[p.pos])
+		if m == nil {
+			return nil
+		}
+
+		h := patchHunk{oldLines: 1, newLines: 1}
+		h.oldStart, _ = strconv.Atoi(m[1])
+		h.newStart, _ = strconv.Atoi(m[3])
+
+		if m[2] != "" {
+			h.oldLines, _ = strconv.Atoi(m[2])
+		}
+
+		if m[4] != "" {
+			h.newLines, _ = strconv.Atoi(m[4])
+		}
+
+		p.pos++
+
+		oldLeft, newLeft := h.oldLines, h.newLines
+
+		for oldLeft > 0 || newLeft > 0 {
+			if p.pos == len(p.lines) {
+				return fmt.Errorf("corrupt patch at line %d", p.pos+1)
+			}
+
+			line := p.lines[p.pos]
+			p.pos++
+
+			// Mailers may strip the space of empty context lines.
+			if line == "\n" {
+				line = " \n"
+			}
+
+			switch line[0] {
+			case ' ':
+				oldLeft--
+				newLeft--
+			case '-':
+				oldLeft--
+			case '+':
+				newLeft--
+			case '\\':
+				p.noNewline(&h)
+
+				continue
+			default:
+				return fmt.Errorf("corrupt patch at line %d", p.pos)
+			}
+
+			if oldLeft < 0 || newLeft < 0 {
+				return fmt.Errorf("corrupt patch at line %d", p.pos)
+			}
+
+			h.lines = append(h.lines, diffLine{line[0], line[1:]})
+		}
+
+		if p.pos < len(p.lines) && strings.HasPrefix(p.lines[p.pos], "\\") {
+			p.noNewline(&h)
+			p.pos++
+		}
+
+		f.hunks = append(f.hunks, h)
+	}
+
+	return nil
+}
+
+// noNewline marks the last line of h as lacking a newline.
+func (p *patchParser) noNewline(h *patchHunk) {
+	if n := len(h.lines); n > 0 {
+		h.lines[n-1].text = strings.TrimSuffix(h.lines[n-1].text, "\n")
+	}
+}
+
+// binaryHunks parses the literal or delta hunks of a binary patch.
+func (p *patchParser) binaryHunks(f *patchFile) error {
+	for p.pos < len(p.lines) {
+		kind, size, ok := strings.Cut(strings.TrimSuffix(p.lines[p.pos], "\n"), " ")
+		if !ok || (kind != "literal" && kind != "delta") {
+			break
+		}
+
+		n, err := strconv.Atoi(size)
+		if err != nil {
+			return fmt.Errorf("corrupt binary patch at line %d", p.pos+1)
+		}
+
+		p.pos++
+
+		var z []byte
+
+		for ; p.pos < len(p.lines) && p.lines[p.pos] != "\n"; p.pos++ {
+			chunk, err := decodeBinaryLine(strings.TrimSuffix(p.lines[p.pos], "\n"))
+			if err != nil {
+				return fmt.Errorf("corrupt binary patch at line %d: %w", p.pos+1, err)
+			}
+
+			z = append(z, chunk...)
+		}
+
+		p.pos++
+
+		zr, err := zlib.NewReader(bytes.NewReader(z))
+		if err != nil {
+			return fmt.Errorf("corrupt binary patch: %w", err)
+		}
+
+		data, err := io.ReadAll(zr)
+		if err != nil || len(data) != n {
+			return fmt.Errorf("corrupt binary patch: inflated %d bytes instead of %d", len(data), n)
+		}
+
+		f.binary = append(f.binary, binaryHunk{delta: kind == "delta", data: data})
+	}
+
+	return nil
+}
+
+// decodeBinaryLine decodes a line of a binary patch: its length, then its
+// bytes in base85.
+func decodeBinaryLine(line string) ([]byte, error) {
+	if len(line) < 6 || (len(line)-1)%5 != 0 {
+		return nil, errors.New("bad line length")
+	}
+
+	var n int
+
+	switch c := line[0]; {
+	case 'A' <= c && c <= 'Z':
+		n = int(c-'A') + 1
+	case 'a' <= c && c <= 'z':
+		n = int(c-'a') + 27
+	default:
+		return nil, errors.New("bad line length")
+	}
+
+	var data []byte
+
+	for s := line[1:]; len(s) > 0; s = s[5:] {
+		var acc uint64
+
+		for i := range 5 {
+			d := strings.IndexByte(base85Alphabet, s[i])
+			if d < 0 {
+				return nil, fmt.Errorf("invalid base85 alphabet %c", s[i])
+			}
+
+			acc = acc*85 + uint64(d)
+		}
+
+		if acc > 0xffffffff {
+			return nil, errors.New("invalid base85 sequence")
+		}
+
+		data = append(data, byte(acc>>24), byte(acc>>16), byte(acc>>8), byte(acc))
+	}
+
+	if n > len(data) {
+		return nil, errors.New("bad line length")
+	}
+
+	return data[:n], nil
+}
+
+// gitHeaderName returns the name of a file from the "diff --git" line of
+// its patch when both of its names are the same, which they are unless it
+// is renamed or copied.
+func gitHeaderName(s string) string {
+	if strings.HasPrefix(s, `"`) {
+		a, rest, err := parseImportPath(s, false)
+		if err != nil {
+			return ""
+		}
+
+		b, err := unquotePatchPath(rest)
+		if err != nil || stripPatchPrefix(a) != stripPatchPrefix(b) {
+			return ""
+		}
+
+		return stripPatchPrefix(b)
+	}
+
+	for i := strings.IndexByte(s, ' '); i >= 0; {
+		a, b := stripPatchPrefix(s[:i]), stripPatchPrefix(s[i+1:])
+		if a != "" && a == b {
+			return a
+		}
+
+		j := strings.IndexByte(s[i+1:], ' ')
+		if j < 0 {
+			break
+		}
+
+		i += j + 1
+	}
+
+	return ""
+}
+
+// patchLineName returns the name of a ---/+++ line, without its a/ or b/
+// prefix and any timestamp, or "" for /dev/null.
+func patchLineName(s string) (string, error) {
+	// Quoted names have their tabs escaped.
+	s, _, _ = strings.Cut(s, "\t")
+
+	s, err := unquotePatchPath(s)
+	if err != nil || s == "/dev/null" {
+		return "", err
+	}
+
+	return stripPatchPrefix(s), nil
+}
+
+func unquotePatchPath(s string) (string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		return s, nil
+	}
+
+	p, _, err := parseImportPath(s, true)
+
+	return p, err
+}
+
+// stripPatchPrefix removes the leading directory of p, as git apply -p1
+// does.
+func stripPatchPrefix(p string) string {
+	_, rest, _ := strings.Cut(p, "/")
+
+	return rest
+}
+
+func parsePatchMode(s string) (filemode.FileMode, error) {
+	m, err := strconv.ParseUint(strings.TrimSpace(s), 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid mode %s", s)
+	}
+
+	return filemode.FileMode(m), nil
+}
+
+// reverse turns f into the patch undoing it.
+func (f *patchFile) reverse() {
+	f.oldPath, f.newPath = f.newPath, f.oldPath
+	f.oldMode, f.newMode = f.newMode, f.oldMode
+	f.oldID, f.newID = f.newID, f.oldID
+
+	for i := range f.hunks {
+		h := &f.hunks[i]
+		h.oldStart, h.newStart = h.newStart, h.oldStart
+		h.oldLines, h.newLines = h.newLines, h.oldLines
+
+		for j := range h.lines {
+			switch h.lines[j].op {
+			case '+':
+				h.lines[j].op = '-'
+			case '-':
+				h.lines[j].op = '+'
+			}
+		}
+
+		// Keep the removed lines of each change before the added ones.
+		for j := 0; j < len(h.lines); {
+			k := j
+			for k < len(h.lines) && h.lines[k].op != ' ' {
+				k++
+			}
+
+			run := h.lines[j:k]
+			sort.SliceStable(run, func(a, b int) bool { return run[a].op == '-' && run[b].op == '+' })
+			j = k + 1
+		}
+	}
+
+	if len(f.binary) > 1 {
+		f.binary[0], f.binary[1] = f.binary[1], f.binary[0]
+	} else {
+		f.binary = nil
+	}
+}
+
+// patchApplier applies file patches to the working tree, and to the index
+// as well with useIndex. Every patch is applied in memory before anything
+// is written, so that either all of them apply or none do.
+type patchApplier struct {
+	r        *git.Repository
+	fs       billy.Filesystem
+	idx      *index.Index
+	conv     *converter
+	useIndex bool
+	threeWay bool
+	errOut   io.Writer
+
+	// labels name our side and theirs in conflict markers.
+	labels [2]string
+
+	files     map[string]*appliedFile
+	order     []string
+	conflicts bool
+}
+
+// appliedFile is what the patches applied so far leave of a file.
+type appliedFile struct {
+	data    []byte
+	mode    filemode.FileMode
+	deleted bool
+
+	// merged is set for a file merged with --3way.
+	merged bool
+
+	// stages holds the base, our and their entries of a file merged with
+	// conflicts.
+	stages []*index.Entry
+}
+
+func newPatchApplier(r *git.Repository, useIndex bool, errOut io.Writer) (*patchApplier, error) {
+	wt, err := r.Worktree()
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index: %w", err)
+	}
+
+	conv, err := newConverter(r, attrCheckin, errOut)
+	if err != nil {
+		return nil, err
+	}
+
+	return &patchApplier{
+		r:        r,
+		fs:       wt.Filesystem,
+		idx:      idx,
+		conv:     conv,
+		useIndex: useIndex,
+		errOut:   errOut,
+		labels:   [2]string{"ours", "theirs"},
+		files:    map[string]*appliedFile{},
+	}, nil
+}
+
+// Close stops the filter processes started to convert the files.
+func (a *patchApplier) Close() error {
+	return a.conv.Close()
+}
+
+// apply applies files in memory, reporting whether all of them applied.
+// Those that did not are reported to errOut.
+func (a *patchApplier) apply(files []*patchFile) (bool, error) {
+	ok := true
+
+	for _, f := range files {
+		applied, err := a.applyFile(f)
+		if err != nil {
+			return false, err
+		}
+
+		ok = ok && applied
+	}
+
+	return ok, nil
+}
+
+func (a *patchApplier) applyFile(f *patchFile) (bool, error) {
+	name := f.oldPath
+	if name == "" {
+		name = f.newPath
+	}
+
+	var (
+		old     []byte
+		oldMode filemode.FileMode
+	)
+
+	if f.oldPath != "" {
+		data, mode, exists, err := a.current(f.oldPath)
+		if err != nil {
+			return false, err
+		}
+
+		if !exists {
+			if a.useIndex {
+				fmt.Fprintf(a.errOut, "error: %s: does not exist in index\n", f.oldPath)
+			} else {
+				fmt.Fprintf(a.errOut, "error: %s: No such file or directory\n", f.oldPath)
+			}
+
+			return false, nil
+		}
+
+		if a.useIndex && a.files[f.oldPath] == nil {
+			_, changed, err := worktreeChanges(a.fs, a.entry(f.oldPath), a.conv)
+			if err != nil {
+				return false, err
+			}
+
+			if changed {
+				fmt.Fprintf(a.errOut, "error: %s: does not match index\n", f.oldPath)
+
+				return false, nil
+			}
+		}
+
+		if f.oldMode != 0 && fileType(mode) != fileType(f.oldMode) {
+			fmt.Fprintf(a.errOut, "error: %s: wrong type\n", f.oldPath)
+
+			return false, nil
+		}
+
+		if f.oldMode != 0 && mode != f.oldMode {
+			fmt.Fprintf(a.errOut, "warning: %s has type %o, expected %o\n", f.oldPath, uint32(mode), uint32(f.oldMode))
+		}
+
+		old, oldMode = data, mode
+	}
+
+	if f.newPath != "" && f.newPath != f.oldPath {
+		exists, err := a.exists(f.newPath)
+		if err != nil || exists {
+			return false, err
+		}
+	}
+
+	mode := f.newMode
+	if mode == 0 {
+		mode = oldMode
+	}
+
+	if mode == 0 {
+		mode = filemode.Regular
+	}
+
+	result := &appliedFile{mode: mode}
+
+	merged := false
+
+	if a.threeWay {
+		var err error
+
+		merged, err = a.merge(f, old, result)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if !merged {
+		data, ok := a.applyDirect(f, name, old)
+		if !ok {
+			return false, nil
+		}
+
+		result.data = data
+	}
+
+	if f.oldPath != "" && f.oldPath != f.newPath {
+		a.record(f.oldPath, &appliedFile{deleted: true})
+	}
+
+	if f.newPath != "" {
+		a.record(f.newPath, result)
+	}
+
+	return true, nil
+}
+
+// applyDirect applies the hunks of f to old, reporting the error if they
+// do not apply.
+func (a *patchApplier) applyDirect(f *patchFile, name string, old []byte) ([]byte, bool) {
+	if f.isBinary {
+		return a.applyBinary(f, name, old)
+	}
+
+	data, line, ok := applyHunks(old, f.hunks)
+	if !ok {
+		fmt.Fprintf(a.errOut, "error: patch failed: %s:%d\n", name, line)
+		fmt.Fprintf(a.errOut, "error: %s: patch does not apply\n", name)
+
+		return nil, false
+	}
+
+	if f.newPath == "" && len(data) > 0 {
+		fmt.Fprintf(a.errOut, "error: removal patch leaves file contents\n")
+		fmt.Fprintf(a.errOut, "error: %s: patch does not apply\n", name)
+
+		return nil, false
+	}
+
+	return data, true
+}
+
+// applyBinary applies a binary patch to old, checking the ids of its index
+// line when they are complete.
+func (a *patchApplier) applyBinary(f *patchFile, name string, old []byte) ([]byte, bool) {
+	if len(f.binary) == 0 {
+		fmt.Fprintf(a.errOut, "error: cannot apply binary patch to '%s' without full index line\n", name)
+		fmt.Fprintf(a.errOut, "error: %s: patch does not apply\n", name)
+
+		return nil, false
+	}
+
+	if f.oldPath != "" && len(f.oldID) == plumbing.ZeroHash.HexSize() {
+		if h := blobHash(old); h.String() != f.oldID {
+			fmt.Fprintf(a.errOut, "error: the patch applies to '%s' (%s), which does not match the current contents.\n", name, h)
+			fmt.Fprintf(a.errOut, "error: %s: patch does not apply\n", name)
+
+			return nil, false
+		}
+	}
+
+	data := f.binary[0].data
+
+	if f.binary[0].delta {
+		var err error
+
+		data, err = packfile.PatchDelta(old, data)
+		if err != nil {
+			fmt.Fprintf(a.errOut, "error: binary patch does not apply to '%s'\n", name)
+			fmt.Fprintf(a.errOut, "error: %s: patch does not apply\n", name)
+
+			return nil, false
+		}
+	}
+
+	if f.newPath != "" && len(f.newID) == plumbing.ZeroHash.HexSize() {
+		if h := blobHash(data); h.String() != f.newID {
+			fmt.Fprintf(a.errOut, "error: binary patch to '%s' creates incorrect result (expecting %s, got %s)\n", name, f.newID, h)
+			fmt.Fprintf(a.errOut, "error: %s: patch does not apply\n", name)
+
+			return nil, false
+		}
+	}
+
+	return data, true
+}
+
+// merge applies f to the blob it was made against, then merges the result
+// into old. It reports whether it could; like git, when it cannot it falls
+// back to applying f to old directly.
+func (a *patchApplier) merge(f *patchFile, old []byte, result *appliedFile) (bool, error) {
+	// Like git, created, deleted and purely renamed files are not merged.
+	if f.oldPath == "" || f.newPath == "" || (f.oldPath != f.newPath && len(f.hunks) == 0 && !f.isBinary) {
+		fmt.Fprintln(a.errOut, "Falling back to direct application...")
+
+		return false, nil
+	}
+
+	baseID, ok := a.resolveBlob(f.oldID)
+	if !ok {
+		fmt.Fprintln(a.errOut, "error: repository lacks the necessary blob to perform 3-way merge.")
+		fmt.Fprintln(a.errOut, "Falling back to direct application...")
+
+		return false, nil
+	}
+
+	base, err := readBlob(a.r, baseID)
+	if err != nil {
+		return false, err
+	}
+
+	var (
+		theirs   []byte
+		conflict bool
+	)
+
+	if f.isBinary {
+		theirs, ok = a.applyBinary(f, f.oldPath, base)
+	} else {
+		var line int
+
+		theirs, line, ok = applyHunks(base, f.hunks)
+		if !ok {
+			fmt.Fprintf(a.errOut, "error: patch failed: %s:%d\n", f.oldPath, line)
+		}
+	}
+
+	if !ok {
+		fmt.Fprintln(a.errOut, "Falling back to direct application...")
+
+		return false, nil
+	}
+
+	result.merged = true
+
+	switch {
+	case !f.isBinary:
+		result.data, conflict = merge3(base, old, theirs, a.labels)
+	case bytes.Equal(base, old):
+		result.data = theirs
+	case bytes.Equal(theirs, old):
+		result.data = old
+	default:
+		fmt.Fprintf(a.errOut, "warning: Cannot merge binary files: %s (%s vs. %s)\n", f.newPath, a.labels[0], a.labels[1])
+
+		result.data, conflict = old, true
+	}
+
+	if !conflict {
+		fmt.Fprintf(a.errOut, "Applied patch to '%s' cleanly.\n", f.newPath)
+
+		return true, nil
+	}
+
+	fmt.Fprintf(a.errOut, "Applied patch to '%s' with conflicts.\n", f.newPath)
+
+	for i, data := range [][]byte{base, old, theirs} {
+		h, err := a.storeBlob(data)
+		if err != nil {
+			return false, err
+		}
+
+		result.stages = append(result.stages, &index.Entry{
+			Name:  f.newPath,
+			Hash:  h,
+			Mode:  result.mode,
+			Stage: index.Stage(i + 1),
+		})
+	}
+
+	a.conflicts = true
+
+	return true, nil
+}
+
+// resolveBlob returns the blob named by the possibly abbreviated id of an
+// index line, if the repository has it.
+func (a *patchApplier) resolveBlob(id string) (plumbing.Hash, bool) {
+	if id == "" {
+		return plumbing.ZeroHash, false
+	}
+
+	if len(id) == plumbing.ZeroHash.HexSize() {
+		h := plumbing.NewHash(id)
+		if a.r.Storer.HasEncodedObject(h) != nil {
+			return plumbing.ZeroHash, false
+		}
+
+		return h, true
+	}
+
+	var found []plumbing.Hash
+
+	for _, h := range objectsWithPrefix(a.r, id) {
+		if _, err := a.r.BlobObject(h); err == nil {
+			found = append(found, h)
+		}
+	}
+
+	if len(found) != 1 {
+		return plumbing.ZeroHash, false
+	}
+
+	return found[0], true
+}
+
+// current returns the contents and mode of a file as the patches applied so
+// far left it, reading it from the index with useIndex.
+func (a *patchApplier) current(name string) ([]byte, filemode.FileMode, bool, error) {
+	if f, ok := a.files[name]; ok {
+		return f.data, f.mode, !f.deleted, nil
+	}
+
+	if a.useIndex {
+		e := a.entry(name)
+		if e == nil {
+			return nil, 0, false, nil
+		}
+
+		data, err := readBlob(a.r, e.Hash)
+
+		return data, e.Mode, true, err
+	}
+
+	fi, err := a.fs.Lstat(name)
+	if err != nil {
+		return nil, 0, false, nil
+	}
+
+	mode, err := filemode.NewFromOSFileMode(fi.Mode())
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	var data []byte
+
+	if mode == filemode.Symlink {
+		var target string
+
+		target, err = a.fs.Readlink(name)
+		data = []byte(target)
+	} else {
+		data, err = util.ReadFile(a.fs, name)
+	}
+
+	if err != nil {
+		return nil, 0, false, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	if mode != filemode.Symlink {
+		data, err = a.conv.toGit(name, data)
+		if err != nil {
+			return nil, 0, false, err
+		}
+	}
+
+	return data, mode, true, nil
+}
+
+// exists reports a file a patch would create that is in the way.
+func (a *patchApplier) exists(name string) (bool, error) {
+	if f, ok := a.files[name]; ok {
+		if f.deleted {
+			return false, nil
+		}
+	} else if a.useIndex && a.entry(name) != nil {
+		fmt.Fprintf(a.errOut, "error: %s: already exists in index\n", name)
+
+		return true, nil
+	} else if _, err := a.fs.Lstat(name); err != nil {
+		return false, nil
+	}
+
+	fmt.Fprintf(a.errOut, "error: %s: already exists in working directory\n", name)
+
+	return true, nil
+}
+
+// entry returns the stage 0 index entry of name, if any.
+func (a *patchApplier) entry(name string) *index.Entry {
+	for _, e := range a.idx.Entries {
+		if e.Name == name && e.Stage == 0 {
+			return e
+		}
+	}
+
+	return nil
+}
+
+func (a *patchApplier) record(name string, f *appliedFile) {
+	if _, ok := a.files[name]; !ok {
+		a.order = append(a.order, name)
+	}
+
+	a.files[name] = f
+}
+
+func (a *patchApplier) storeBlob(data []byte) (plumbing.Hash, error) {
+	obj, err := newObject(a.r.Storer, plumbing.BlobObject, data)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return a.r.Storer.SetEncodedObject(obj)
+}
+
+// write writes the applied files to the working tree, and to the index with
+// useIndex, listing the files left with conflicts.
+func (a *patchApplier) write() error {
+	var conflicted []string
+
+	for _, name := range a.order {
+		f := a.files[name]
+
+		if a.useIndex {
+			entries := a.idx.Entries[:0]
+
+			for _, e := range a.idx.Entries {
+				if e.Name != name {
+					entries = append(entries, e)
+				}
+			}
+
+			a.idx.Entries = entries
+		}
+
+		if f.deleted {
+			err := removeTrackedFile(a.fs, name)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		data := f.data
+		if f.mode != filemode.Symlink {
+			var err error
+
+			data, err = a.conv.toWorktree(name, data, plumbing.ZeroHash)
+			if err != nil {
+				return err
+			}
+		}
+
+		err := writeWorktreeFile(a.fs, name, data, f.mode)
+		if err != nil {
+			return err
+		}
+
+		if !a.useIndex {
+			continue
+		}
+
+		if f.stages != nil {
+			a.idx.Entries = append(a.idx.Entries, f.stages...)
+			conflicted = append(conflicted, name)
+
+			continue
+		}
+
+		h, err := a.storeBlob(f.data)
+		if err != nil {
+			return err
+		}
+
+		fi, err := a.fs.Lstat(name)
+		if err != nil {
+			return err
+		}
+
+		a.idx.Entries = append(a.idx.Entries, &index.Entry{
+			Name:       name,
+			Hash:       h,
+			Mode:       f.mode,
+			Size:       uint32(fi.Size()),
+			ModifiedAt: fi.ModTime(),
+		})
+	}
+
+	if !a.useIndex {
+		return nil
+	}
+
+	sort.Slice(a.idx.Entries, func(i, j int) bool {
+		ei, ej := a.idx.Entries[i], a.idx.Entries[j]
+		if ei.Name != ej.Name {
+			return ei.Name < ej.Name
+		}
+
+		return ei.Stage < ej.Stage
+	})
+
+	err := a.r.Storer.SetIndex(a.idx)
+	if err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+
+	for _, name := range conflicted {
+		fmt.Fprintf(a.errOut, "U %s\n", name)
+	}
+
+	return nil
+}
+
+// writeWorktreeFile replaces the working tree file name with data.
+func writeWorktreeFile(fs billy.Filesystem, name string, data []byte, mode filemode.FileMode) error {
+	err := fs.MkdirAll(path.Dir(name), 0o755)
+	if err != nil {
+		return err
+	}
+
+	err = fs.Remove(name)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %w", name, err)
+	}
+
+	if mode == filemode.Symlink {
+		return fs.Symlink(string(data), name)
+	}
+
+	perm, err := mode.ToOSFileMode()
+	if err != nil {
+		return err
+	}
+
+	err = util.WriteFile(fs, name, data, perm.Perm())
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+
+	return nil
+}
+
+func blobHash(data []byte) plumbing.Hash {
+	obj, err := newObject(memory.NewStorage(), plumbing.BlobObject, data)
+	if err != nil {
+		return plumbing.ZeroHash
+	}
+
+	return obj.Hash()
+}
+
+// applyHunks applies hunks to data. When one does not apply, it returns
+// the line of the original file the hunk was made against.
+func applyHunks(data []byte, hunks []patchHunk) ([]byte, int, bool) {
+	lines := splitLines(string(data))
+
+	for _, h := range hunks {
+		var pre, post []string
+
+		for _, l := range h.lines {
+			if l.op != '+' {
+				pre = append(pre, l.text)
+			}
+
+			if l.op != '-' {
+				post = append(post, l.text)
+			}
+		}
+
+		trailing := 0
+		for i := len(h.lines) - 1; i >= 0 && h.lines[i].op == ' '; i-- {
+			trailing++
+		}
+
+		// Earlier hunks have already shifted the lines, so the hunk is
+		// looked for where the new file has it.
+		pos := 0
+		if h.newStart > 0 {
+			pos = h.newStart - 1
+		}
+
+		at := findHunk(lines, pre, pos, h.oldStart <= 1, trailing == 0)
+		if at < 0 {
+			return nil, h.oldStart, false
+		}
+
+		lines = append(lines[:at:at], append(post, lines[at+len(pre):]...)...)
+	}
+
+	return []byte(strings.Join(lines, "")), 0, true
+}
+
+// findHunk returns where pre is found in lines, looking alternately after
+// and before pos as git does. A hunk starting at the first line must match
+// there, and one without trailing context must match at the end.
+func findHunk(lines, pre []string, pos int, atStart, atEnd bool) int {
+	fits := func(at int) bool {
+		if at+len(pre) > len(lines) || (atStart && at != 0) || (atEnd && at+len(pre) != len(lines)) {
+			return false
+		}
+
+		for i, l := range pre {
+			if lines[at+i] != l {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	pos = min(pos, len(lines))
+	back, fwd := pos, pos
+
+	for i, at := 0, pos; ; i++ {
+		if fits(at) {
+			return at
+		}
+
+		for {
+			if back == 0 && fwd == len(lines) {
+				return -1
+			}
+
+			if i%2 == 1 && back > 0 {
+				back--
+				at = back
+
+				break
+			}
+
+			if i%2 == 0 && fwd < len(lines) {
+				fwd++
+				at = fwd
+
+				break
+			}
+
+			i++
+		}
+	}
+}
+
+// mergeChunk replaces the lines [start, end) of the base of a merge.
+type mergeChunk struct {
+	start, end int
+	lines      []string
+}
+
+// mergeChunks returns the changes from base to other.
+func mergeChunks(base, other []string) []mergeChunk {
+	var chunks []mergeChunk
+
+	ops := diffLines(base, other)
+	pos := 0
+
+	for i := 0; i < len(ops); {
+		if ops[i].op == ' ' {
+			pos++
+			i++
+
+			continue
+		}
+
+		c := mergeChunk{start: pos, end: pos}
+
+		for ; i < len(ops) && ops[i].op != ' '; i++ {
+			if ops[i].op == '-' {
+				c.end++
+			} else {
+				c.lines = append(c.lines, ops[i].text)
+			}
+		}
+
+		pos = c.end
+		chunks = append(chunks, c)
+	}
+
+	return chunks
+}
+
+// merge3 merges the changes ours and theirs make to base, reporting whether
+// they conflict. Like git, changes touching or adjacent to each other
+// conflict unless they are the same, and conflicts are marked with labels.
+func merge3(base, ours, theirs []byte, labels [2]string) ([]byte, bool) {
+	baseLines := splitLines(string(base))
+	a := mergeChunks(baseLines, splitLines(string(ours)))
+	b := mergeChunks(baseLines, splitLines(string(theirs)))
+
+	var out []string
+
+	conflict := false
+	pos := 0
+
+	for len(a) > 0 || len(b) > 0 {
+		var start int
+
+		switch {
+		case len(b) == 0 || (len(a) > 0 && a[0].start <= b[0].start):
+			start = a[0].start
+		default:
+			start = b[0].start
+		}
+
+		end := start
+
+		var ca, cb []mergeChunk
+
+		for {
+			if len(a) > 0 && a[0].start <= end {
+				end = max(end, a[0].end)
+				ca, a = append(ca, a[0]), a[1:]
+			} else if len(b) > 0 && b[0].start <= end {
+				end = max(end, b[0].end)
+				cb, b = append(cb, b[0]), b[1:]
+			} else {
+				break
+			}
+		}
+
+		out = append(out, baseLines[pos:start]...)
+		pos = end
+
+		sideA := applyChunks(baseLines, start, end, ca)
+		sideB := applyChunks(baseLines, start, end, cb)
+
+		switch {
+		case len(ca) == 0 || slices.Equal(sideA, sideB):
+			out = append(out, sideB...)
+
+			continue
+		case len(cb) == 0:
+			out = append(out, sideA...)
+
+			continue
+		}
+
+		conflict = true
+
+		// Leave the lines both sides agree on out of the conflict.
+		pre := 0
+		for pre < len(sideA) && pre < len(sideB) && sideA[pre] == sideB[pre] {
+			pre++
+		}
+
+		suf := 0
+		for suf < len(sideA)-pre && suf < len(sideB)-pre && sideA[len(sideA)-1-suf] == sideB[len(sideB)-1-suf] {
+			suf++
+		}
+
+		out = append(out, sideA[:pre]...)
+		out = append(out, "<<<<<<< "+labels[0]+"\n")
+		out = appendTerminated(out, sideA[pre:len(sideA)-suf])
+		out = append(out, "=======\n")
+		out = appendTerminated(out, sideB[pre:len(sideB)-suf])
+		out = append(out, ">>>>>>> "+labels[1]+"\n")
+		out = append(out, sideA[len(sideA)-suf:]...)
+	}
+
+	out = append(out, baseLines[pos:]...)
+
+	return []byte(strings.Join(out, "")), conflict
+}
+
+// applyChunks returns the lines [start, end) of base with chunks applied.
+func applyChunks(base []string, start, end int, chunks []mergeChunk) []string {
+	var out []string
+
+	pos := start
+	for _, c := range chunks {
+		out = append(out, base[pos:c.start]...)
+		out = append(out, c.lines...)
+		pos = c.end
+	}
+
+	return append(out, base[pos:end]...)
+}
+
+// appendTerminated appends lines to out, ending the last one with a newline
+// so that a conflict marker can follow.
+func appendTerminated(out, lines []string) []string {
+	out = append(out, lines...)
+	if n := len(out); len(lines) > 0 && !strings.HasSuffix(out[n-1], "\n") {
+		out[n-1] += "\n"
+	}
+
+	return out
+}
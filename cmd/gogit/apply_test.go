@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// worktreeState returns what git reports of the index and working tree of
+// dir: the index entries, the status and the files with their modes.
+func worktreeState(t *testing.T, dir string) string {
+	t.Helper()
+
+	var state strings.Builder
+
+	state.WriteString(gitCmd(t, dir, "ls-files", "-s"))
+	state.WriteString(gitCmd(t, dir, "status", "--porcelain", "-uall"))
+
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+
+		var content string
+		if info.Mode()&os.ModeSymlink != 0 {
+			content, err = os.Readlink(path)
+		} else {
+			var data []byte
+			data, err = os.ReadFile(path)
+			content = string(data)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		rel, _ := filepath.Rel(dir, path)
+		fmt.Fprintf(&state, "%s %v %q\n", filepath.ToSlash(rel), info.Mode(), content)
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return state.String()
+}
+
+// sameApply runs setup and then args in a repository made by patchRepo,
+// with git and with gogit, and checks that they exit, report and leave the
+// index and working tree alike.
+func sameApply(t *testing.T, setup func(dir string), stdin string, args ...string) {
+	t.Helper()
+
+	var states []string
+
+	for _, tool := range []string{"git", "gogit"} {
+		dir := patchRepo(t)
+		setup(dir)
+
+		var res result
+		if tool == "git" {
+			res = run(t, dir, stdin, "git", args...)
+		} else {
+			res = gogitStdin(t, dir, stdin, args...)
+		}
+
+		states = append(states, fmt.Sprintf("exit %d\n%s%s", res.code, res.stderr, worktreeState(t, dir)))
+	}
+
+	if states[1] != states[0] {
+		t.Errorf("gogit %v gave:\n%s\nwant, as git:\n%s", args, states[1], states[0])
+	}
+}
+
+// topicPatch writes the diff of main to topic in dir as the file patch.
+func topicPatch(t *testing.T, dir string) {
+	t.Helper()
+
+	writeFile(t, dir, "../patch", gitCmd(t, dir, "diff", "--binary", "main", "topic"))
+	gitCmd(t, dir, "checkout", "-q", "main")
+}
+
+func TestApply(t *testing.T) {
+	for _, args := range []string{
+		"apply ../patch",
+		"apply --index ../patch",
+		"apply --check ../patch",
+		"apply --check --index ../patch",
+		"apply --3way ../patch",
+	} {
+		t.Run(args, func(t *testing.T) {
+			sameApply(t, func(dir string) { topicPatch(t, dir) }, "", strings.Fields(args)...)
+		})
+	}
+
+	// The patch is read from standard input without a file.
+	t.Run("stdin", func(t *testing.T) {
+		dir := patchRepo(t)
+		patch := gitCmd(t, dir, "diff", "--binary", "main", "topic")
+
+		sameApply(t, func(dir string) { gitCmd(t, dir, "checkout", "-q", "main") }, patch, "apply", "--index")
+	})
+}
+
+func TestApplyReverse(t *testing.T) {
+	setup := func(dir string) {
+		writeFile(t, dir, "../patch", gitCmd(t, dir, "diff", "--binary", "main", "topic"))
+	}
+
+	sameApply(t, setup, "", "apply", "-R", "../patch")
+	sameApply(t, setup, "", "apply", "-R", "--index", "../patch")
+
+	// A patch that was applied does not apply again.
+	sameApply(t, setup, "", "apply", "--check", "../patch")
+}
+
+// TestApplyOffset checks that hunks are found where the lines they change
+// have moved.
+func TestApplyOffset(t *testing.T) {
+	sameApply(t, func(dir string) {
+		topicPatch(t, dir)
+		writeFile(t, dir, "a", "zero\n"+readFile(t, filepath.Join(dir, "a")))
+	}, "", "apply", "../patch")
+}
+
+// TestApplyConflict checks that a patch that does not apply changes
+// nothing, and that --3way merges it, leaving the conflicts in the index.
+func TestApplyConflict(t *testing.T) {
+	conflict := func(dir string) {
+		topicPatch(t, dir)
+		writeFile(t, dir, "a", "one\ntwo\nthree!\nfour\nfive\nsix\nseven\neight\nnine\nten\n")
+		gitCmd(t, dir, "commit", "-q", "-a", "-m", "conflict")
+	}
+
+	sameApply(t, conflict, "", "apply", "../patch")
+	sameApply(t, conflict, "", "apply", "--index", "../patch")
+	sameApply(t, conflict, "", "apply", "--3way", "../patch")
+
+	// A change that the other side also made merges cleanly.
+	sameApply(t, func(dir string) {
+		topicPatch(t, dir)
+		writeFile(t, dir, "a", "one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\nNINE\nten\n")
+		gitCmd(t, dir, "commit", "-q", "-a", "-m", "half")
+	}, "", "apply", "--3way", "../patch")
+
+	// A dirty working tree keeps --index from applying.
+	sameApply(t, func(dir string) {
+		topicPatch(t, dir)
+		writeFile(t, dir, "b", "dirty\n")
+	}, "", "apply", "--index", "../patch")
+}
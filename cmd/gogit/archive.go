@@ -0,0 +1,761 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-billy/v6/osfs"
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/format/gitattributes"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/spf13/cobra"
+)
+
+var (
+	archiveFormat string
+	archivePrefix string
+	archiveOutput string
+	archiveList   bool
+)
+
+// archiveFormats are the supported archive formats, by name.
+var archiveFormats = []string{"tar", "tgz", "tar.gz", "zip"}
+
+func init() {
+	archiveCmd.Flags().StringVarP(&archiveFormat, "format", "", "", "Format of the archive: tar, tgz, tar.gz or zip")
+	archiveCmd.Flags().StringVarP(&archivePrefix, "prefix", "", "", "Prepend <prefix> to paths in the archive")
+	archiveCmd.Flags().StringVarP(&archiveOutput, "output", "o", "", "Write the archive to <file> instead of stdout")
+	archiveCmd.Flags().BoolVarP(&archiveList, "list", "l", false, "Show all available formats")
+	rootCmd.AddCommand(archiveCmd)
+}
+
+var archiveCmd = &cobra.Command{
+	Use:   "archive [--format=<fmt>] [--prefix=<prefix>] [-o <file>] <tree-ish> [<path>...]",
+	Short: "Create an archive of files from a named tree",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if archiveList {
+			for _, f := range archiveFormats {
+				fmt.Fprintln(cmd.OutOrStdout(), f)
+			}
+
+			return nil
+		}
+
+		if len(args) == 0 {
+			return errors.New("you must specify a tree-ish to archive")
+		}
+
+		format, err := archiveFormatName(archiveFormat, archiveOutput)
+		if err != nil {
+			return err
+		}
+
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		tree, commit, err := resolveTreeish(r, args[0])
+		if err != nil {
+			return err
+		}
+
+		a, err := newArchiver(r, tree, commit, args[1:])
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+
+		var f *os.File
+
+		if archiveOutput != "" {
+			f, err = os.Create(archiveOutput)
+			if err != nil {
+				return fmt.Errorf("failed to create archive: %w", err)
+			}
+
+			out = f
+		}
+
+		var w archiveWriter
+
+		switch format {
+		case "tar":
+			w = newTarArchive(out, a.mtime, commit)
+		case "tgz", "tar.gz":
+			gz := gzip.NewWriter(out)
+			w = &gzipArchive{archiveWriter: newTarArchive(gz, a.mtime, commit), gz: gz}
+		case "zip":
+			w = newZipArchive(out, a.mtime, commit)
+		}
+
+		a.w = w
+
+		err = a.write()
+		if err == nil {
+			err = w.Close()
+		}
+
+		// The output file is closed explicitly, as a failure to flush it
+		// means the archive is incomplete.
+		if f != nil {
+			if cerr := f.Close(); cerr != nil && err == nil {
+				err = fmt.Errorf("failed to write archive: %w", cerr)
+			}
+		}
+
+		return err
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// archiveFormatName returns the format of the archive, guessed from the
+// output file name if not given.
+func archiveFormatName(format, output string) (string, error) {
+	if format == "" {
+		format = "tar"
+
+		for _, f := range archiveFormats {
+			if strings.HasSuffix(output, "."+f) {
+				format = f
+			}
+		}
+	}
+
+	for _, f := range archiveFormats {
+		if f == format {
+			return format, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown archive format '%s'", format)
+}
+
+// resolveTreeish returns the tree named by rev, which may be a commit, a
+// tag, a tree or <rev>:<path>, and the commit it was reached from, if any.
+func resolveTreeish(r *git.Repository, rev string) (*object.Tree, *object.Commit, error) {
+	rev, subpath, hasPath := strings.Cut(rev, ":")
+
+	h, err := resolveObject(r, rev)
+	if err != nil {
+		return nil, nil, fmt.Errorf("not a valid object name: %s", rev)
+	}
+
+	obj, err := r.Object(plumbing.AnyObject, h)
+	if err != nil {
+		return nil, nil, fmt.Errorf("not a valid object name: %s", rev)
+	}
+
+	for {
+		tag, ok := obj.(*object.Tag)
+		if !ok {
+			break
+		}
+
+		obj, err = tag.Object()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var (
+		tree   *object.Tree
+		commit *object.Commit
+	)
+
+	switch o := obj.(type) {
+	case *object.Commit:
+		commit = o
+
+		tree, err = o.Tree()
+		if err != nil {
+			return nil, nil, err
+		}
+	case *object.Tree:
+		tree = o
+	default:
+		return nil, nil, fmt.Errorf("not a tree object: %s", rev)
+	}
+
+	if hasPath && subpath != "" {
+		tree, err = tree.Tree(strings.Trim(subpath, "/"))
+		if err != nil {
+			return nil, nil, fmt.Errorf("path '%s' does not exist in '%s'", subpath, rev)
+		}
+
+		// Like git, only a whole commit is stamped with its id.
+		commit = nil
+	}
+
+	return tree, commit, nil
+}
+
+// archiveWriter is implemented by the archive formats.
+type archiveWriter interface {
+	// writeEntry adds a file, symbolic link or directory to the archive.
+	// Directory names end with a slash.
+	writeEntry(h plumbing.Hash, name string, mode filemode.FileMode, data []byte) error
+	Close() error
+}
+
+// archiver walks a tree, writing the files selected by the pathspecs and
+// the export-ignore attribute to an archive.
+type archiver struct {
+	r         *git.Repository
+	w         archiveWriter
+	tree      *object.Tree
+	commit    *object.Commit
+	mtime     time.Time
+	attrs     gitattributes.Matcher
+	pathspecs []string
+	matched   map[string]bool
+}
+
+func newArchiver(r *git.Repository, tree *object.Tree, commit *object.Commit, pathspecs []string) (*archiver, error) {
+	a := &archiver{
+		r:       r,
+		tree:    tree,
+		commit:  commit,
+		mtime:   time.Now(),
+		matched: make(map[string]bool),
+	}
+
+	if commit != nil {
+		a.mtime = commit.Committer.When
+	}
+
+	for _, p := range pathspecs {
+		p = strings.Trim(path.Clean(p), "/")
+		if p == "." {
+			p = ""
+		}
+
+		a.pathspecs = append(a.pathspecs, p)
+	}
+
+	attrs, err := archiveAttributes(r, tree)
+	if err != nil {
+		return nil, err
+	}
+
+	a.attrs = gitattributes.NewMatcher(attrs)
+
+	return a, nil
+}
+
+// archiveAttributes returns the attributes of the archived tree: those of
+// the system and global attribute files, of the .gitattributes files in
+// the tree and of $GIT_DIR/info/attributes, by increasing priority.
+func archiveAttributes(r *git.Repository, tree *object.Tree) ([]gitattributes.MatchAttribute, error) {
+	var attrs []gitattributes.MatchAttribute
+
+	rootFS := osfs.New("/")
+	if as, err := gitattributes.LoadSystemPatterns(rootFS); err == nil {
+		attrs = append(attrs, as...)
+	}
+
+	if as, err := gitattributes.LoadGlobalPatterns(rootFS); err == nil {
+		attrs = append(attrs, as...)
+	}
+
+	var walk func(t *object.Tree, domain []string) error
+
+	walk = func(t *object.Tree, domain []string) error {
+		if e, err := t.FindEntry(".gitattributes"); err == nil && e.Mode.IsFile() {
+			blob, err := r.BlobObject(e.Hash)
+			if err != nil {
+				return err
+			}
+
+			rd, err := blob.Reader()
+			if err != nil {
+				return err
+			}
+
+			as, err := gitattributes.ReadAttributes(rd, domain, len(domain) == 0)
+			_ = rd.Close()
+
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", path.Join(append(domain, ".gitattributes")...), err)
+			}
+
+			attrs = append(attrs, as...)
+		}
+
+		for _, e := range t.Entries {
+			if e.Mode != filemode.Dir {
+				continue
+			}
+
+			sub, err := r.TreeObject(e.Hash)
+			if err != nil {
+				return err
+			}
+
+			err = walk(sub, append(domain[:len(domain):len(domain)], e.Name))
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	err := walk(tree, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if store, ok := r.Storer.(*filesystem.Storage); ok {
+		as, err := gitattributes.ReadAttributesFile(store.Filesystem(), nil, "info/attributes", true)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		attrs = append(attrs, as...)
+	}
+
+	return attrs, nil
+}
+
+// write adds the selected entries of the tree to the archive and checks
+// that every pathspec matched something.
+func (a *archiver) write() error {
+	if strings.HasSuffix(archivePrefix, "/") {
+		err := a.w.writeEntry(a.tree.Hash, archivePrefix, filemode.Dir, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := a.walk(a.tree, "")
+	if err != nil {
+		return err
+	}
+
+	for _, p := range a.pathspecs {
+		if !a.matched[p] {
+			return fmt.Errorf("pathspec '%s' did not match any files", p)
+		}
+	}
+
+	return nil
+}
+
+func (a *archiver) walk(t *object.Tree, dir string) error {
+	for _, e := range t.Entries {
+		p := path.Join(dir, e.Name)
+
+		if a.hasAttribute(p, "export-ignore") {
+			continue
+		}
+
+		selected, below := a.inScope(p)
+		if !selected && !below {
+			continue
+		}
+
+		switch e.Mode {
+		case filemode.Dir:
+			err := a.w.writeEntry(e.Hash, archivePrefix+p+"/", e.Mode, nil)
+			if err != nil {
+				return err
+			}
+
+			sub, err := a.r.TreeObject(e.Hash)
+			if err != nil {
+				return err
+			}
+
+			err = a.walk(sub, p)
+			if err != nil {
+				return err
+			}
+		case filemode.Submodule:
+			if !selected {
+				continue
+			}
+
+			err := a.w.writeEntry(e.Hash, archivePrefix+p+"/", e.Mode, nil)
+			if err != nil {
+				return err
+			}
+		default:
+			if !selected {
+				continue
+			}
+
+			data, err := a.content(p, e)
+			if err != nil {
+				return err
+			}
+
+			err = a.w.writeEntry(e.Hash, archivePrefix+p, e.Mode, data)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// content returns the data of a file, with the $Format:...$ placeholders
+// expanded when it has the export-subst attribute.
+func (a *archiver) content(p string, e object.TreeEntry) ([]byte, error) {
+	blob, err := a.r.BlobObject(e.Hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", p, err)
+	}
+
+	rd, err := blob.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer rd.Close()
+
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", p, err)
+	}
+
+	if a.commit == nil || e.Mode == filemode.Symlink || !a.hasAttribute(p, "export-subst") {
+		return data, nil
+	}
+
+	return exportSubst(a.r, a.commit, data), nil
+}
+
+// exportSubst expands the $Format:<format>$ placeholders of data.
+func exportSubst(r *git.Repository, c *object.Commit, data []byte) []byte {
+	const start = "$Format:"
+
+	var out bytes.Buffer
+
+	for {
+		i := bytes.Index(data, []byte(start))
+		if i < 0 {
+			break
+		}
+
+		end := bytes.IndexAny(data[i+len(start):], "$\n")
+		if end < 0 || data[i+len(start)+end] != '$' {
+			out.Write(data[:i+len(start)])
+			data = data[i+len(start):]
+
+			continue
+		}
+
+		out.Write(data[:i])
+		out.WriteString(formatCommit(r, c, string(data[i+len(start):i+len(start)+end])))
+		data = data[i+len(start)+end+1:]
+	}
+
+	out.Write(data)
+
+	return out.Bytes()
+}
+
+func (a *archiver) hasAttribute(p, attr string) bool {
+	results, _ := a.attrs.Match(strings.Split(p, "/"), []string{attr})
+	if v, ok := results[attr]; ok {
+		return v.IsSet()
+	}
+
+	return false
+}
+
+// inScope reports whether p is matched by the pathspecs, and whether any
+// pathspec points below p. Matching pathspecs are recorded.
+func (a *archiver) inScope(p string) (bool, bool) {
+	if len(a.pathspecs) == 0 {
+		return true, false
+	}
+
+	var selected, below bool
+
+	for _, spec := range a.pathspecs {
+		switch {
+		case spec == "" || p == spec || strings.HasPrefix(p, spec+"/"):
+			a.matched[spec] = true
+			selected = true
+		case strings.HasPrefix(spec, p+"/"):
+			below = true
+		default:
+			if ok, _ := path.Match(spec, p); ok {
+				a.matched[spec] = true
+				selected = true
+			}
+		}
+	}
+
+	return selected, below
+}
+
+const (
+	tarBlockSize  = 512
+	tarRecordSize = 20 * tarBlockSize
+
+	// tarUmask is applied to the permissions of archived files, like git's
+	// default tar.umask.
+	tarUmask = 0o002
+)
+
+// tarArchive writes tar archives laid out exactly like git archive does:
+// ustar headers owned by root with pax extended headers for long names,
+// padded to 10240-byte records.
+type tarArchive struct {
+	w       io.Writer
+	mtime   int64
+	written int64
+
+	// pending holds the global header until the first write.
+	pending []byte
+}
+
+// newTarArchive returns a tar archive whose entries are stamped with
+// mtime. A global header records the commit id, if any.
+func newTarArchive(w io.Writer, mtime time.Time, commit *object.Commit) *tarArchive {
+	a := &tarArchive{w: w, mtime: mtime.Unix()}
+
+	if commit != nil {
+		ext := paxRecord("comment", commit.Hash.String())
+		a.pending = a.header('g', "pax_global_header", 0o100666, int64(len(ext)), "")
+		a.pending = append(a.pending, padBlock([]byte(ext))...)
+	}
+
+	return a
+}
+
+func (a *tarArchive) writeEntry(h plumbing.Hash, name string, mode filemode.FileMode, data []byte) error {
+	var (
+		typeflag byte
+		perm     uint32
+		size     int64
+		linkname string
+	)
+
+	switch {
+	case mode == filemode.Dir || mode == filemode.Submodule:
+		typeflag, perm = '5', 0o40777&^tarUmask
+	case mode == filemode.Symlink:
+		typeflag, perm = '2', 0o120777
+		linkname = string(data)
+		data = nil
+	default:
+		typeflag, perm, size = '0', 0o100666&^tarUmask, int64(len(data))
+		if mode == filemode.Executable {
+			perm = 0o100777 &^ tarUmask
+		}
+	}
+
+	var ext string
+
+	var prefix string
+
+	short := name
+	if len(name) > 100 {
+		plen := tarPathPrefix(name, 155)
+		if plen > 0 && len(name)-plen-1 <= 100 {
+			prefix, short = name[:plen], name[plen+1:]
+		} else {
+			short = h.String() + ".data"
+			ext += paxRecord("path", name)
+		}
+	}
+
+	if len(linkname) > 100 {
+		ext += paxRecord("linkpath", linkname)
+		linkname = "see " + h.String() + ".paxheader"
+	}
+
+	if ext != "" {
+		err := a.write(append(a.header('x', h.String()+".paxheader", 0o100666, int64(len(ext)), ""), padBlock([]byte(ext))...))
+		if err != nil {
+			return err
+		}
+	}
+
+	header := a.header(typeflag, short, perm, size, linkname)
+	copy(header[345:500], prefix)
+	writeChecksum(header)
+
+	return a.write(append(header, padBlock(data)...))
+}
+
+// header returns a ustar header as git fills it.
+func (a *tarArchive) header(typeflag byte, name string, mode uint32, size int64, linkname string) []byte {
+	h := make([]byte, tarBlockSize)
+
+	copy(h[0:100], name)
+	copy(h[100:108], fmt.Sprintf("%07o", mode&0o7777))
+	copy(h[108:116], fmt.Sprintf("%07o", 0))
+	copy(h[116:124], fmt.Sprintf("%07o", 0))
+	copy(h[124:136], fmt.Sprintf("%011o", size))
+	copy(h[136:148], fmt.Sprintf("%011o", a.mtime))
+	h[156] = typeflag
+	copy(h[157:257], linkname)
+	copy(h[257:263], "ustar\x00")
+	copy(h[263:265], "00")
+	copy(h[265:297], "root")
+	copy(h[297:329], "root")
+	copy(h[329:337], fmt.Sprintf("%07o", 0))
+	copy(h[337:345], fmt.Sprintf("%07o", 0))
+	writeChecksum(h)
+
+	return h
+}
+
+func (a *tarArchive) write(b []byte) error {
+	if a.pending != nil {
+		b = append(a.pending, b...)
+		a.pending = nil
+	}
+
+	n, err := a.w.Write(b)
+	a.written += int64(n)
+
+	return err
+}
+
+// Close pads the archive with zeros to a whole record, leaving at least
+// the two empty blocks that end a tar archive.
+func (a *tarArchive) Close() error {
+	err := a.write(nil)
+	if err != nil {
+		return err
+	}
+
+	tail := tarRecordSize - a.written%tarRecordSize
+	if tail < 2*tarBlockSize {
+		tail += tarRecordSize
+	}
+
+	return a.write(make([]byte, tail))
+}
+
+// tarPathPrefix returns the length of the longest directory prefix of name
+// fitting in max bytes, as git computes it.
+func tarPathPrefix(name string, maxLen int) int {
+	i := len(name)
+	if i > 1 && name[i-1] == '/' {
+		i--
+	}
+
+	i = min(i, maxLen)
+
+	for {
+		i--
+		if i <= 0 || name[i] == '/' {
+			break
+		}
+	}
+
+	return max(i, 0)
+}
+
+func writeChecksum(h []byte) {
+	copy(h[148:156], "        ")
+
+	var sum uint32
+	for _, b := range h {
+		sum += uint32(b)
+	}
+
+	copy(h[148:156], fmt.Sprintf("%07o\x00", sum))
+}
+
+// paxRecord formats a pax extended header record, whose length includes
+// its own decimal representation.
+func paxRecord(key, value string) string {
+	n := len(key) + len(value) + 4
+	for tmp := 1; n/10 >= tmp; tmp *= 10 {
+		n++
+	}
+
+	return fmt.Sprintf("%d %s=%s\n", n, key, value)
+}
+
+func padBlock(data []byte) []byte {
+	if rem := len(data) % tarBlockSize; rem != 0 {
+		data = append(data, make([]byte, tarBlockSize-rem)...)
+	}
+
+	return data
+}
+
+// gzipArchive compresses the output of another archive writer.
+type gzipArchive struct {
+	archiveWriter
+	gz *gzip.Writer
+}
+
+func (a *gzipArchive) Close() error {
+	err := a.archiveWriter.Close()
+	if err != nil {
+		return err
+	}
+
+	return a.gz.Close()
+}
+
+// zipDirAttr is the MS-DOS attribute of directories in zip archives.
+const zipDirAttr = 0x10
+
+// zipArchive writes zip archives whose entries are stamped with the
+// commit time in UTC, so that they do not depend on the local time zone.
+type zipArchive struct {
+	zw    *zip.Writer
+	mtime time.Time
+}
+
+func newZipArchive(w io.Writer, mtime time.Time, commit *object.Commit) *zipArchive {
+	zw := zip.NewWriter(w)
+	if commit != nil {
+		_ = zw.SetComment(commit.Hash.String())
+	}
+
+	return &zipArchive{zw: zw, mtime: mtime.UTC().Truncate(time.Second)}
+}
+
+func (a *zipArchive) writeEntry(_ plumbing.Hash, name string, mode filemode.FileMode, data []byte) error {
+	fh := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: a.mtime}
+
+	// Like git, only executables and symbolic links carry a unix mode;
+	// directories and other files are left to the defaults of unzip.
+	switch mode {
+	case filemode.Dir, filemode.Submodule:
+		fh.Method = zip.Store
+		fh.ExternalAttrs = zipDirAttr
+	case filemode.Symlink:
+		fh.Method = zip.Store
+		fh.SetMode(os.ModeSymlink | 0o777)
+	case filemode.Executable:
+		fh.SetMode(0o755)
+	}
+
+	f, err := a.zw.CreateHeader(fh)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+
+	return err
+}
+
+func (a *zipArchive) Close() error {
+	return a.zw.Close()
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// archiveRepo returns a repository made by git with an executable, a
+// symbolic link, nested directories and files marked export-ignore and
+// export-subst.
+func archiveRepo(t *testing.T) string {
+	t.Helper()
+
+	dir := gitRepo(t, []string{
+		"README", "readme\n",
+		"run.sh", "#!/bin/sh\n",
+		"src/main.go", "package main\n",
+		"src/deep/util.go", "package deep\n",
+		"version.txt", "$Format:%H %cd %s$\n",
+		"secret", "ignored\n",
+		"tests/t.sh", "ignored too\n",
+		".gitattributes", "secret export-ignore\ntests export-ignore\nversion.txt export-subst\n",
+	})
+
+	err := os.Symlink("README", filepath.Join(dir, "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gitCmd(t, dir, "update-index", "--chmod=+x", "run.sh")
+	gitCmd(t, dir, "add", "link")
+	gitCmd(t, dir, "commit", "-q", "-m", "archive me")
+	gitCmd(t, dir, "tag", "-a", "-m", "v1", "v1")
+
+	return dir
+}
+
+// archiveBytes runs archive with args in dir, with git or gogit, and
+// returns what it wrote.
+func archiveBytes(t *testing.T, tool, dir string, args ...string) []byte {
+	t.Helper()
+
+	out := filepath.Join(t.TempDir(), "out")
+	args = append([]string{"archive", "-o", out}, args...)
+
+	if tool == "git" {
+		gitCmd(t, dir, args...)
+	} else {
+		mustGogit(t, dir, args...)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+// TestArchiveTar checks that tar archives are the same, byte for byte,
+// as those of git.
+func TestArchiveTar(t *testing.T) {
+	dir := archiveRepo(t)
+
+	for _, args := range []string{
+		"HEAD",
+		"--format=tar v1",
+		"--prefix=project-1.0/ HEAD",
+		"--prefix=p/ HEAD src",
+		"HEAD:src",
+		"HEAD README src/deep",
+	} {
+		t.Run(args, func(t *testing.T) {
+			want := archiveBytes(t, "git", dir, strings.Fields(args)...)
+
+			got := archiveBytes(t, "gogit", dir, strings.Fields(args)...)
+			if !bytes.Equal(got, want) {
+				t.Errorf("gogit archive wrote %d bytes that differ from the %d bytes of git", len(got), len(want))
+			}
+		})
+	}
+}
+
+// TestArchiveTarGz checks that compressed tar archives hold the same tar
+// as git's, and that they are reproducible.
+func TestArchiveTarGz(t *testing.T) {
+	dir := archiveRepo(t)
+
+	for _, format := range []string{"tar.gz", "tgz"} {
+		want := gunzip(t, archiveBytes(t, "git", dir, "--format="+format, "--prefix=p/", "HEAD"))
+
+		got := archiveBytes(t, "gogit", dir, "--format="+format, "--prefix=p/", "HEAD")
+		if !bytes.Equal(gunzip(t, got), want) {
+			t.Errorf("gogit archive --format=%s holds a tar that differs from git's", format)
+		}
+
+		if again := archiveBytes(t, "gogit", dir, "--format="+format, "--prefix=p/", "HEAD"); !bytes.Equal(again, got) {
+			t.Errorf("gogit archive --format=%s is not reproducible", format)
+		}
+	}
+
+	// The format is also taken from the name of the output file.
+	out := filepath.Join(t.TempDir(), "out.tar.gz")
+	mustGogit(t, dir, "archive", "-o", out, "HEAD")
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(gunzip(t, data), gunzip(t, archiveBytes(t, "git", dir, "--format=tgz", "HEAD"))) {
+		t.Error("gogit archive -o out.tar.gz did not write a tar.gz archive like git")
+	}
+}
+
+func gunzip(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return out
+}
+
+// zipEntries describes the entries of a zip archive: their names, modes,
+// times, comments and contents.
+func zipEntries(t *testing.T, data []byte) string {
+	t.Helper()
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "comment %q\n", zr.Comment)
+
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		content, err := io.ReadAll(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rc.Close()
+
+		fmt.Fprintf(&sb, "%s %v %s %q\n", f.Name, f.Mode(), f.Modified.UTC(), content)
+	}
+
+	return sb.String()
+}
+
+func TestArchiveZip(t *testing.T) {
+	dir := archiveRepo(t)
+
+	for _, args := range []string{
+		"--format=zip HEAD",
+		"--format=zip --prefix=p/ v1 src",
+	} {
+		want := zipEntries(t, archiveBytes(t, "git", dir, strings.Fields(args)...))
+
+		if got := zipEntries(t, archiveBytes(t, "gogit", dir, strings.Fields(args)...)); got != want {
+			t.Errorf("gogit archive %s gave the entries:\n%s\nwant, as git:\n%s", args, got, want)
+		}
+	}
+}
+
+func TestArchiveList(t *testing.T) {
+	dir := archiveRepo(t)
+
+	if res := gogit(t, dir, "archive", "-l"); !strings.Contains(res.stdout, "zip\n") || !strings.Contains(res.stdout, "tar.gz\n") {
+		t.Errorf("archive -l listed:\n%s", res.stdout)
+	}
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing/format/index"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+)
+
+// Attribute states other than a value. They start with a NUL byte so that
+// no value read from a gitattributes file can be taken for them; an
+// attribute without a state at all is left out of the maps.
+const (
+	attrSet         = "\x00set"
+	attrUnset       = "\x00unset"
+	attrUnspecified = "\x00unspecified"
+)
+
+const (
+	gitattributesFile = ".gitattributes"
+	builtinAttributes = "[attr]binary -diff -merge -text\n"
+)
+
+// attrSource tells where the gitattributes files of the worktree are read
+// from, as git's attribute directions do.
+type attrSource int
+
+const (
+	// attrCheckin reads the worktree files, or else the index ones.
+	attrCheckin attrSource = iota
+	// attrCheckout reads the index files, or else the worktree ones.
+	attrCheckout
+	// attrIndex reads the index files only.
+	attrIndex
+)
+
+type attrState struct {
+	name  string
+	value string
+}
+
+// attrRule is a line of a gitattributes file: the states given to the
+// paths matching a pattern, or the definition of a macro.
+type attrRule struct {
+	pattern *pathPattern
+	macro   string
+	states  []attrState
+}
+
+// attrChecker looks up the attributes of paths the way git does: rules
+// are taken from the builtin, system, global, top-level, per-directory
+// and $GIT_DIR/info/attributes files, by increasing priority. go-git's
+// matcher gets the priorities and macros wrong, so the files are matched
+// here.
+type attrChecker struct {
+	r      *git.Repository
+	fs     billy.Filesystem
+	idx    *index.Index
+	source attrSource
+	errOut io.Writer
+
+	// top holds the rules of the builtin, system, global and top-level
+	// files, info those of $GIT_DIR/info/attributes.
+	top  [][]*attrRule
+	info []*attrRule
+	dirs map[string][]*attrRule
+
+	// names holds the attribute names in the order they were first seen.
+	names []string
+	known map[string]bool
+}
+
+func newAttrChecker(r *git.Repository, source attrSource, errOut io.Writer) (*attrChecker, error) {
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index: %w", err)
+	}
+
+	c := &attrChecker{
+		r:      r,
+		idx:    idx,
+		source: source,
+		errOut: errOut,
+		dirs:   make(map[string][]*attrRule),
+		known:  make(map[string]bool),
+	}
+
+	if w, err := r.Worktree(); err == nil {
+		c.fs = w.Filesystem
+	}
+
+	c.top = append(c.top, c.parse([]byte(builtinAttributes), "[builtin]", "", true))
+
+	if ok, _ := strconv.ParseBool(os.Getenv("GIT_ATTR_NOSYSTEM")); !ok {
+		c.top = append(c.top, c.parseFile("/etc/gitattributes"))
+	}
+
+	if global := globalAttributesFile(r); global != "" {
+		c.top = append(c.top, c.parseFile(global))
+	}
+
+	c.top = append(c.top, c.parse(c.read(gitattributesFile), gitattributesFile, "", true))
+
+	if store, ok := r.Storer.(*filesystem.Storage); ok {
+		data, err := util.ReadFile(store.Filesystem(), "info/attributes")
+		if err == nil {
+			src := filepath.Join(store.Filesystem().Root(), "info", "attributes")
+			c.info = c.parse(data, src, "", true)
+		}
+	}
+
+	return c, nil
+}
+
+// globalAttributesFile returns the path of the user's gitattributes file.
+func globalAttributesFile(r *git.Repository) string {
+	if p := scopedConfigOption(r, "core", "", "attributesFile"); p != "" {
+		return expandHome(p)
+	}
+
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, "git", "attributes")
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(home, ".config", "git", "attributes")
+}
+
+// attributes returns the states of all the attributes given to the path,
+// keyed by name. A path with a trailing slash is taken for a directory.
+func (c *attrChecker) attributes(name string) map[string]string {
+	frames := c.frames(name)
+
+	// The macro definitions of the files with the highest priority win.
+	macros := make(map[string]*attrRule)
+
+	for i := len(frames) - 1; i >= 0; i-- {
+		for j := len(frames[i]) - 1; j >= 0; j-- {
+			rule := frames[i][j]
+			if rule.macro != "" && macros[rule.macro] == nil {
+				macros[rule.macro] = rule
+			}
+		}
+	}
+
+	values := make(map[string]string)
+
+	var fill func(states []attrState)
+
+	fill = func(states []attrState) {
+		for i := len(states) - 1; i >= 0; i-- {
+			s := states[i]
+			if _, ok := values[s.name]; ok {
+				continue
+			}
+
+			values[s.name] = s.value
+
+			if m := macros[s.name]; m != nil && s.value == attrSet {
+				fill(m.states)
+			}
+		}
+	}
+
+	isDir := strings.HasSuffix(name, "/")
+	name = strings.TrimSuffix(name, "/")
+
+	for i := len(frames) - 1; i >= 0; i-- {
+		for j := len(frames[i]) - 1; j >= 0; j-- {
+			rule := frames[i][j]
+			if rule.pattern != nil && rule.pattern.match(name, isDir) {
+				fill(rule.states)
+			}
+		}
+	}
+
+	return values
+}
+
+// frames returns the rules applying to the path, by increasing priority.
+func (c *attrChecker) frames(name string) [][]*attrRule {
+	frames := append([][]*attrRule(nil), c.top...)
+
+	dir := path.Dir(strings.TrimSuffix(name, "/"))
+	if dir != "." {
+		parts := strings.Split(dir, "/")
+		for i := range parts {
+			frames = append(frames, c.dir(strings.Join(parts[:i+1], "/")))
+		}
+	}
+
+	return append(frames, c.info)
+}
+
+// dir returns the rules of the gitattributes file of a directory below
+// the top of the worktree.
+func (c *attrChecker) dir(dir string) []*attrRule {
+	rules, ok := c.dirs[dir]
+	if !ok {
+		name := path.Join(dir, gitattributesFile)
+		rules = c.parse(c.read(name), name, dir, false)
+		c.dirs[dir] = rules
+	}
+
+	return rules
+}
+
+// read returns the contents of a gitattributes file of the worktree, from
+// the working tree or the index depending on the source.
+func (c *attrChecker) read(name string) []byte {
+	fromIndex := func() []byte {
+		for _, e := range c.idx.Entries {
+			// Stage 2 holds our side of a conflict.
+			if e.Name != name || (e.Stage != 0 && e.Stage != 2) {
+				continue
+			}
+
+			data, err := readBlob(c.r, e.Hash)
+			if err == nil {
+				return data
+			}
+		}
+
+		return nil
+	}
+
+	fromWorktree := func() []byte {
+		if c.fs == nil {
+			return nil
+		}
+
+		data, err := util.ReadFile(c.fs, name)
+		if err != nil {
+			return nil
+		}
+
+		return data
+	}
+
+	switch {
+	case c.source == attrIndex:
+		return fromIndex()
+	case c.fs == nil:
+		// Bare repositories only have attributes of their own.
+		return nil
+	case c.source == attrCheckout:
+		if data := fromIndex(); data != nil {
+			return data
+		}
+
+		return fromWorktree()
+	default:
+		if data := fromWorktree(); data != nil {
+			return data
+		}
+
+		return fromIndex()
+	}
+}
+
+func (c *attrChecker) parseFile(name string) []*attrRule {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil
+	}
+
+	return c.parse(data, name, "", true)
+}
+
+// parse reads the rules of a gitattributes file, the patterns of which
+// are relative to base. Macros may only be defined in the files that are
+// not in a subdirectory. Invalid lines are reported and skipped.
+func (c *attrChecker) parse(data []byte, src, base string, macros bool) []*attrRule {
+	var rules []*attrRule
+
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	for i, line := range strings.Split(string(data), "\n") {
+		rule, warning := parseAttrLine(line, base, macros, src, i+1)
+		if warning != "" {
+			fmt.Fprintln(c.errOut, warning)
+		}
+
+		if rule == nil {
+			continue
+		}
+
+		if rule.macro != "" {
+			c.register(rule.macro)
+		}
+
+		for _, s := range rule.states {
+			c.register(s.name)
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules
+}
+
+// register records an attribute name, for the attributes to be listed in
+// the order git lists them.
+func (c *attrChecker) register(name string) {
+	if !c.known[name] {
+		c.known[name] = true
+		c.names = append(c.names, name)
+	}
+}
+
+// parseAttrLine parses a line of a gitattributes file, returning either a
+// rule or nothing and the warning to print about the line.
+func parseAttrLine(line, base string, macros bool, src string, nr int) (*attrRule, string) {
+	const blank = " \t\r\n"
+
+	line = strings.TrimLeft(line, blank)
+	if line == "" || line[0] == '#' {
+		return nil, ""
+	}
+
+	name, states, ok := unquoteAttrPattern(line)
+	if !ok {
+		name, states = line, ""
+		if i := strings.IndexAny(line, blank); i >= 0 {
+			name, states = line[:i], line[i:]
+		}
+	}
+
+	rule := &attrRule{}
+
+	if macro, ok := strings.CutPrefix(name, "[attr]"); ok && macro != "" {
+		if !macros {
+			return nil, fmt.Sprintf("%s not allowed: %s:%d", line, src, nr)
+		}
+
+		if !validAttrName(macro) {
+			return nil, fmt.Sprintf("%s is not a valid attribute name: %s:%d", macro, src, nr)
+		}
+
+		rule.macro = macro
+	} else {
+		rule.pattern = parsePathPattern(name, base)
+		if rule.pattern.negative {
+			return nil, "warning: Negative patterns are ignored in git attributes\n" +
+				"Use '\\!' for literal leading exclamation."
+		}
+	}
+
+	for _, token := range strings.FieldsFunc(states, func(r rune) bool { return strings.ContainsRune(blank, r) }) {
+		attr, value, hasValue := strings.Cut(token, "=")
+
+		s := attrState{value: attrSet}
+
+		switch {
+		case token[0] == '-':
+			attr, s.value = attr[1:], attrUnset
+		case token[0] == '!':
+			attr, s.value = attr[1:], attrUnspecified
+		case hasValue:
+			s.value = value
+		}
+
+		if !validAttrName(attr) {
+			return nil, fmt.Sprintf("%s is not a valid attribute name: %s:%d", attr, src, nr)
+		}
+
+		s.name = attr
+		rule.states = append(rule.states, s)
+	}
+
+	return rule, ""
+}
+
+// unquoteAttrPattern splits a line starting with a C-style quoted pattern
+// into the pattern and the rest of the line.
+func unquoteAttrPattern(line string) (string, string, bool) {
+	if !strings.HasPrefix(line, `"`) {
+		return "", "", false
+	}
+
+	for end := 1; end < len(line); end++ {
+		switch line[end] {
+		case '\\':
+			end++
+		case '"':
+			p, err := strconv.Unquote(line[:end+1])
+
+			return p, line[end+1:], err == nil
+		}
+	}
+
+	return "", "", false
+}
+
+func validAttrName(name string) bool {
+	if name == "" || name[0] == '-' {
+		return false
+	}
+
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c != '-' && c != '.' && c != '_' &&
+			(c < '0' || c > '9') && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// attrString returns an attribute state as git prints it.
+func attrString(v string, ok bool) string {
+	switch {
+	case !ok || v == attrUnspecified:
+		return "unspecified"
+	case v == attrSet:
+		return "set"
+	case v == attrUnset:
+		return "unset"
+	default:
+		return v
+	}
+}
@@ -0,0 +1,996 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+	"os/exec"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/spf13/cobra"
+)
+
+const (
+	bisectStartFile       = "BISECT_START"
+	bisectLogFile         = "BISECT_LOG"
+	bisectTermsFile       = "BISECT_TERMS"
+	bisectNamesFile       = "BISECT_NAMES"
+	bisectExpectedRevFile = "BISECT_EXPECTED_REV"
+
+	bisectRefPrefix = "refs/bisect/"
+	bisectBadRef    = plumbing.ReferenceName(bisectRefPrefix + "bad")
+
+	// bisectRunSkip is the exit code a bisect run script uses to signal
+	// that the current commit cannot be tested.
+	bisectRunSkip = 125
+)
+
+var (
+	errBisectNotStarted = errors.New(`you need to start by "gogit bisect start"`)
+
+	// errBisectGoodNotAncestor is returned when a good commit reaches
+	// the bad one, so that no commit is left to test.
+	errBisectGoodNotAncestor = errors.New("some good revs are not ancestors of the bad rev: " +
+		"bisect cannot work properly in this case, maybe you mistook good and bad revs?")
+
+	// errBisectOnlySkipped is returned, exiting with 2 as git does, when
+	// only skipped commits are left to test.
+	errBisectOnlySkipped = exitStatus(2)
+)
+
+func init() {
+	// The command run by "bisect run" keeps its own flags.
+	bisectRunCmd.Flags().SetInterspersed(false)
+
+	bisectCmd.AddCommand(bisectStartCmd)
+	bisectCmd.AddCommand(bisectMarkCmd("bad", "new", "Mark a commit as bad"))
+	bisectCmd.AddCommand(bisectMarkCmd("good", "old", "Mark commits as good"))
+	bisectCmd.AddCommand(bisectMarkCmd("skip", "", "Mark commits as untestable"))
+	bisectCmd.AddCommand(bisectResetCmd)
+	bisectCmd.AddCommand(bisectLogCmd)
+	bisectCmd.AddCommand(bisectReplayCmd)
+	bisectCmd.AddCommand(bisectRunCmd)
+	rootCmd.AddCommand(bisectCmd)
+}
+
+var bisectCmd = &cobra.Command{
+	Use:   "bisect <command>",
+	Short: "Use binary search to find the commit that introduced a bug",
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		return cmd.Usage()
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var bisectStartCmd = &cobra.Command{
+	Use:   "start [<bad> [<good>...]]",
+	Short: "Start a bisect session",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		b, err := openBisect(cmd.ErrOrStderr())
+		if err != nil {
+			return err
+		}
+
+		err = b.start(args)
+		if err != nil {
+			return err
+		}
+
+		_, err = b.next(cmd.OutOrStdout(), true)
+
+		return err
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// bisectMarkCmd returns the command marking revisions with term, which
+// is one of "bad", "good" or "skip".
+func bisectMarkCmd(term, alias, short string) *cobra.Command {
+	c := &cobra.Command{
+		Use:   term + " [<rev>...]",
+		Short: short,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			b, err := openBisect(cmd.ErrOrStderr())
+			if err != nil {
+				return err
+			}
+
+			err = b.mark(term, args, true)
+			if err != nil {
+				return err
+			}
+
+			_, err = b.next(cmd.OutOrStdout(), true)
+
+			return err
+		},
+		DisableFlagsInUseLine: true,
+	}
+
+	if term == "bad" {
+		c.Args = cobra.MaximumNArgs(1)
+	}
+
+	if alias != "" {
+		c.Aliases = []string{alias}
+	}
+
+	return c
+}
+
+var bisectResetCmd = &cobra.Command{
+	Use:   "reset [<commit>]",
+	Short: "Finish the bisect session and return to the original HEAD",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		b, err := openBisect(cmd.ErrOrStderr())
+		if err != nil {
+			return err
+		}
+
+		if !b.started() {
+			fmt.Fprintln(cmd.OutOrStdout(), "We are not bisecting.")
+
+			return nil
+		}
+
+		var target string
+		if len(args) > 0 {
+			target = args[0]
+		}
+
+		return b.reset(target, true)
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var bisectLogCmd = &cobra.Command{
+	Use:   "log",
+	Short: "Show the log of the current bisect session",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		b, err := openBisect(cmd.ErrOrStderr())
+		if err != nil {
+			return err
+		}
+
+		data, err := util.ReadFile(b.fs, bisectLogFile)
+		if os.IsNotExist(err) {
+			return errors.New("we are not bisecting")
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to read bisect log: %w", err)
+		}
+
+		_, err = cmd.OutOrStdout().Write(data)
+
+		return err
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var bisectReplayCmd = &cobra.Command{
+	Use:   "replay <logfile>",
+	Short: "Replay a bisect session from a log file",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to read bisect log: %w", err)
+		}
+
+		b, err := openBisect(cmd.ErrOrStderr())
+		if err != nil {
+			return err
+		}
+
+		if b.started() {
+			err = b.reset("", true)
+			if err != nil {
+				return err
+			}
+		}
+
+		for line := range strings.Lines(string(data)) {
+			fields := strings.Fields(line)
+			if len(fields) < 3 || fields[0] != "git" || fields[1] != "bisect" {
+				continue
+			}
+
+			revs := make([]string, 0, len(fields)-3)
+			for _, f := range fields[3:] {
+				revs = append(revs, strings.Trim(f, "'"))
+			}
+
+			switch fields[2] {
+			case "start":
+				// Like git, a session started with revisions bisects
+				// right away.
+				err = b.start(revs)
+				if err == nil {
+					_, err = b.next(cmd.OutOrStdout(), true)
+				}
+			case "bad", "new":
+				err = b.mark("bad", revs, true)
+			case "good", "old":
+				err = b.mark("good", revs, true)
+			case "skip":
+				err = b.mark("skip", revs, true)
+			default:
+				err = fmt.Errorf("invalid bisect log line: %q", strings.TrimSpace(line))
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = b.next(cmd.OutOrStdout(), true)
+
+		return err
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var bisectRunCmd = &cobra.Command{
+	Use:   "run <cmd> [<arg>...]",
+	Short: "Bisect automatically by running a command on each commit",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		b, err := openBisect(cmd.ErrOrStderr())
+		if err != nil {
+			return err
+		}
+
+		if !b.started() {
+			return errBisectNotStarted
+		}
+
+		out := cmd.OutOrStdout()
+		script := sqQuoteArgs(args)
+
+		for {
+			fmt.Fprintf(out, "running %s\n", script)
+
+			c := shellCommand(args)
+			c.Stdin = os.Stdin
+			c.Stdout = out
+			c.Stderr = cmd.ErrOrStderr()
+
+			code := 0
+
+			err := c.Run()
+			if err != nil {
+				var exitErr *exec.ExitError
+				if !errors.As(err, &exitErr) {
+					return fmt.Errorf("failed to run '%s': %w", script, err)
+				}
+
+				code = exitErr.ExitCode()
+			}
+
+			// Exit codes follow git: 0 is good, 125 skips the commit,
+			// 1-127 is bad and anything else aborts the session.
+			var term string
+
+			switch {
+			case code == 0:
+				term = "good"
+			case code == bisectRunSkip:
+				term = "skip"
+			case code > 0 && code < 128:
+				term = "bad"
+			default:
+				return fmt.Errorf("bisect run failed: exit code %d from '%s' is < 0 or >= 128", code, script)
+			}
+
+			err = b.mark(term, nil, true)
+			if err != nil {
+				return err
+			}
+
+			done, err := b.next(out, true)
+			if errors.Is(err, errBisectOnlySkipped) {
+				fmt.Fprintln(cmd.ErrOrStderr(), "bisect run cannot continue any more")
+
+				return err
+			}
+
+			if err != nil {
+				return err
+			}
+
+			if done {
+				fmt.Fprintln(out, "bisect found first bad commit")
+
+				return nil
+			}
+		}
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// bisect holds the state of a bisect session, which is kept in the
+// BISECT_* files of the git directory and the refs/bisect/ references,
+// the same way git does.
+type bisect struct {
+	r     *git.Repository
+	fs    billy.Filesystem
+	hooks *hooks
+}
+
+func openBisect(errOut io.Writer) (*bisect, error) {
+	r, err := git.PlainOpen(".")
+	if err != nil {
+		return nil, err
+	}
+
+	store, ok := r.Storer.(*filesystem.Storage)
+	if !ok {
+		return nil, errors.New("storer does not implement filesystem.Storage")
+	}
+
+	return &bisect{r: r, fs: store.Filesystem(), hooks: newHooks(r, errOut)}, nil
+}
+
+func (b *bisect) started() bool {
+	_, err := b.fs.Stat(bisectStartFile)
+
+	return err == nil
+}
+
+// start begins a new session, recording the currently checked out branch
+// so that reset can return to it. The first revision is bad, and any
+// following ones are good.
+func (b *bisect) start(revs []string) error {
+	if b.started() {
+		err := b.reset("", false)
+		if err != nil {
+			return err
+		}
+	}
+
+	head, err := b.r.Reference(plumbing.HEAD, false)
+	if err != nil {
+		return fmt.Errorf("failed to get HEAD: %w", err)
+	}
+
+	orig := head.Target().Short()
+	if head.Type() == plumbing.HashReference {
+		orig = head.Hash().String()
+	}
+
+	files := map[string]string{
+		bisectStartFile: orig + "\n",
+		bisectTermsFile: "bad\ngood\n",
+		bisectNamesFile: "\n",
+	}
+
+	for name, content := range files {
+		err := util.WriteFile(b.fs, name, []byte(content), 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+
+	// Like git, the revisions given are only logged as comments, the
+	// start command replaying them.
+	if len(revs) > 0 {
+		err = b.mark("bad", revs[:1], false)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(revs) > 1 {
+		err = b.mark("good", revs[1:], false)
+		if err != nil {
+			return err
+		}
+	}
+
+	return b.appendLog("git bisect start" + sqQuoteArgs(revs))
+}
+
+// mark records revs, or HEAD when none are given, with term. The log
+// gets the command replaying the mark when command is set.
+func (b *bisect) mark(term string, revs []string, command bool) error {
+	if !b.started() {
+		return errBisectNotStarted
+	}
+
+	if len(revs) == 0 {
+		revs = []string{plumbing.HEAD.String()}
+	}
+
+	for _, rev := range revs {
+		c, err := resolveCommit(b.r, rev)
+		if err != nil {
+			return err
+		}
+
+		name := bisectBadRef
+		if term != "bad" {
+			name = plumbing.ReferenceName(bisectRefPrefix + term + "-" + c.Hash.String())
+		}
+
+		// Like git, the bisect references are updated without a reflog
+		// message.
+		err = inRefTransaction(b.hooks, staticReflogMessage(""), func() error {
+			return b.r.Storer.SetReference(plumbing.NewHashReference(name, c.Hash))
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update %s: %w", name, err)
+		}
+
+		line := fmt.Sprintf("# %s: [%s] %s", term, c.Hash, commitSubject(c))
+		if command {
+			line += fmt.Sprintf("\ngit bisect %s %s", term, c.Hash)
+		}
+
+		err = b.appendLog(line)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// next narrows down the remaining candidates and, when checkout is set,
+// checks out the commit halving them. It reports whether the first bad
+// commit was found.
+func (b *bisect) next(out io.Writer, checkout bool) (bool, error) {
+	bad, goods, skips, err := b.refs()
+	if err != nil {
+		return false, err
+	}
+
+	var status string
+
+	switch {
+	case bad.IsZero() && len(goods) == 0:
+		status = "status: waiting for both good and bad commits"
+	case bad.IsZero() && len(goods) == 1:
+		status = "status: waiting for bad commit, 1 good commit known"
+	case bad.IsZero():
+		status = fmt.Sprintf("status: waiting for bad commit, %d good commits known", len(goods))
+	case len(goods) == 0:
+		status = "status: waiting for good commit(s), bad commit known"
+	}
+
+	if status != "" {
+		fmt.Fprintln(out, status)
+
+		return false, b.appendLog("# " + status)
+	}
+
+	candidates, parents, err := bisectCandidates(b.r, bad, goods)
+	if err != nil {
+		return false, err
+	}
+
+	// The bad commit is only left out of the candidates when a good
+	// commit reaches it.
+	if len(candidates) == 0 {
+		return false, errBisectGoodNotAncestor
+	}
+
+	best, reaches, tried := bestBisection(candidates, parents, skips, bad)
+
+	if best == bad {
+		if len(tried) > 0 {
+			return false, b.onlySkipped(out, bad, tried)
+		}
+
+		c, err := b.r.CommitObject(bad)
+		if err != nil {
+			return false, err
+		}
+
+		fmt.Fprintf(out, "%s is the first bad commit\n%s", bad, c)
+
+		return true, b.appendLog(fmt.Sprintf("# first bad commit: [%s] %s", bad, commitSubject(c)))
+	}
+
+	c, err := b.r.CommitObject(best)
+	if err != nil {
+		return false, err
+	}
+
+	err = util.WriteFile(b.fs, bisectExpectedRevFile, []byte(best.String()+"\n"), 0o644)
+	if err != nil {
+		return false, fmt.Errorf("failed to write %s: %w", bisectExpectedRevFile, err)
+	}
+
+	if checkout {
+		err = b.checkout(plumbing.NewHashReference(plumbing.HEAD, best))
+		if err != nil {
+			return false, err
+		}
+	}
+
+	left := len(candidates) - reaches - 1
+	steps := estimateBisectSteps(len(candidates))
+	fmt.Fprintf(out, "Bisecting: %d %s left to test after this (roughly %d %s)\n",
+		left, plural(left, "revision", "revisions"), steps, plural(steps, "step", "steps"))
+	fmt.Fprintf(out, "[%s] %s\n", best, commitSubject(c))
+
+	return false, nil
+}
+
+// onlySkipped reports that the first bad commit is bad or one of the
+// skipped commits tried, which git logs as possible first bad commits.
+func (b *bisect) onlySkipped(out io.Writer, bad plumbing.Hash, tried []plumbing.Hash) error {
+	fmt.Fprintln(out, "There are only 'skip'ped commits left to test.")
+	fmt.Fprintln(out, "The first bad commit could be any of:")
+
+	for _, h := range tried {
+		fmt.Fprintln(out, h)
+	}
+
+	fmt.Fprintln(out, bad)
+	fmt.Fprintln(out, "We cannot bisect more!")
+
+	lines := []string{"# only skipped commits left to test"}
+
+	for _, h := range append([]plumbing.Hash{bad}, tried...) {
+		c, err := b.r.CommitObject(h)
+		if err != nil {
+			return err
+		}
+
+		lines = append(lines, fmt.Sprintf("# possible first bad commit: [%s] %s", h, commitSubject(c)))
+	}
+
+	err := b.appendLog(strings.Join(lines, "\n"))
+	if err != nil {
+		return err
+	}
+
+	return errBisectOnlySkipped
+}
+
+// reset ends the session, removing its state. When checkout is set, the
+// branch the session started from, or target if given, is checked out.
+func (b *bisect) reset(target string, checkout bool) error {
+	data, err := util.ReadFile(b.fs, bisectStartFile)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", bisectStartFile, err)
+	}
+
+	if target == "" {
+		target = strings.TrimSpace(string(data))
+	}
+
+	if checkout {
+		var ref *plumbing.Reference
+
+		branch := plumbing.NewBranchReferenceName(target)
+		if _, err := b.r.Reference(branch, false); err == nil {
+			ref = plumbing.NewSymbolicReference(plumbing.HEAD, branch)
+		} else {
+			c, err := resolveCommit(b.r, target)
+			if err != nil {
+				return err
+			}
+
+			ref = plumbing.NewHashReference(plumbing.HEAD, c.Hash)
+		}
+
+		err = b.checkout(ref)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = inRefTransaction(b.hooks, staticReflogMessage(""), func() error {
+		refs, err := b.r.References()
+		if err != nil {
+			return fmt.Errorf("failed to list references: %w", err)
+		}
+
+		return refs.ForEach(func(ref *plumbing.Reference) error {
+			if !strings.HasPrefix(ref.Name().String(), bisectRefPrefix) {
+				return nil
+			}
+
+			return b.r.Storer.RemoveReference(ref.Name())
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove bisect references: %w", err)
+	}
+
+	for _, name := range []string{bisectExpectedRevFile, bisectLogFile, bisectNamesFile, bisectTermsFile, bisectStartFile} {
+		err := b.fs.Remove(name)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// checkout moves HEAD to ref, which is either a detached commit or a
+// symbolic reference to a branch.
+func (b *bisect) checkout(ref *plumbing.Reference) error {
+	opts := git.CheckoutOptions{Hash: ref.Hash()}
+	if ref.Type() == plumbing.SymbolicReference {
+		opts = git.CheckoutOptions{Branch: ref.Target()}
+	}
+
+	return checkoutHead(b.hooks, &opts, checkoutName(ref), "")
+}
+
+// refs returns the bad commit and the sets of good and skipped commits.
+func (b *bisect) refs() (plumbing.Hash, []plumbing.Hash, map[plumbing.Hash]bool, error) {
+	var (
+		bad   plumbing.Hash
+		goods []plumbing.Hash
+	)
+
+	skips := make(map[plumbing.Hash]bool)
+
+	refs, err := b.r.References()
+	if err != nil {
+		return bad, nil, nil, fmt.Errorf("failed to list references: %w", err)
+	}
+
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		name := ref.Name().String()
+
+		switch {
+		case ref.Name() == bisectBadRef:
+			bad = ref.Hash()
+		case strings.HasPrefix(name, bisectRefPrefix+"good-"):
+			goods = append(goods, ref.Hash())
+		case strings.HasPrefix(name, bisectRefPrefix+"skip-"):
+			skips[ref.Hash()] = true
+		}
+
+		return nil
+	})
+
+	return bad, goods, skips, err
+}
+
+// resolveCommit returns the commit rev points at.
+func resolveCommit(r *git.Repository, rev string) (*object.Commit, error) {
+	h, err := resolveRevision(r, rev)
+	if err != nil {
+		return nil, fmt.Errorf("bad revision %q: %w", rev, err)
+	}
+
+	c, err := r.CommitObject(h)
+	if err != nil {
+		return nil, fmt.Errorf("bad revision %q: %w", rev, err)
+	}
+
+	return c, nil
+}
+
+func (b *bisect) appendLog(line string) error {
+	f, err := b.fs.OpenFile(bisectLogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open bisect log: %w", err)
+	}
+
+	_, err = fmt.Fprintln(f, line)
+	if err != nil {
+		_ = f.Close()
+
+		return fmt.Errorf("failed to write bisect log: %w", err)
+	}
+
+	return f.Close()
+}
+
+// sqQuoteArgs quotes args for the shell, each preceded by a space, as git
+// quotes the commands of its bisect log.
+func sqQuoteArgs(args []string) string {
+	var sb strings.Builder
+
+	for _, arg := range args {
+		sb.WriteString(" '")
+		sb.WriteString(strings.NewReplacer("'", `'\''`, "!", `'\!'`).Replace(arg))
+		sb.WriteString("'")
+	}
+
+	return sb.String()
+}
+
+// shellCommand returns the command running args as git does: through the
+// shell, with args as its positional parameters, when the name has shell
+// metacharacters, and directly otherwise.
+func shellCommand(args []string) *exec.Cmd {
+	if !strings.ContainsAny(args[0], "|&;<>()$`\\\"' \t\n*?[#~=%") {
+		return exec.Command(args[0], args[1:]...)
+	}
+
+	script := args[0]
+	if len(args) > 1 {
+		script += ` "$@"`
+	}
+
+	return exec.Command("sh", append([]string{"-c", script}, args...)...)
+}
+
+// commitSubject returns the first line of the commit message.
+func commitSubject(c *object.Commit) string {
+	subject, _, _ := strings.Cut(c.Message, "\n")
+
+	return subject
+}
+
+// bisectCandidates returns the commits reachable from bad but not from any
+// of goods, newest first, together with their parents within that set.
+func bisectCandidates(r *git.Repository, bad plumbing.Hash, goods []plumbing.Hash) ([]plumbing.Hash, map[plumbing.Hash][]plumbing.Hash, error) {
+	excluded := make(map[plumbing.Hash]bool)
+	queue := append([]plumbing.Hash(nil), goods...)
+
+	for len(queue) > 0 {
+		h := queue[0]
+		queue = queue[1:]
+
+		if excluded[h] {
+			continue
+		}
+
+		excluded[h] = true
+
+		c, err := r.CommitObject(h)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read commit %s: %w", h, err)
+		}
+
+		queue = append(queue, c.ParentHashes...)
+	}
+
+	var commits []*object.Commit
+
+	parents := make(map[plumbing.Hash][]plumbing.Hash)
+	seen := make(map[plumbing.Hash]bool)
+	queue = []plumbing.Hash{bad}
+
+	for len(queue) > 0 {
+		h := queue[0]
+		queue = queue[1:]
+
+		if seen[h] || excluded[h] {
+			continue
+		}
+
+		seen[h] = true
+
+		c, err := r.CommitObject(h)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read commit %s: %w", h, err)
+		}
+
+		commits = append(commits, c)
+
+		for _, p := range c.ParentHashes {
+			if !excluded[p] {
+				parents[h] = append(parents[h], p)
+				queue = append(queue, p)
+			}
+		}
+	}
+
+	sort.SliceStable(commits, func(i, j int) bool {
+		return commits[i].Committer.When.After(commits[j].Committer.When)
+	})
+
+	candidates := make([]plumbing.Hash, 0, len(commits))
+	for _, c := range commits {
+		candidates = append(candidates, c.Hash)
+	}
+
+	return candidates, parents, nil
+}
+
+// bestBisection picks the candidate to test next the way git does: the
+// first one, from the oldest, that reaches about half of the candidates,
+// or else the one closest to half. Once commits are skipped, the
+// candidates are ranked by how evenly they split the graph, and the best
+// ones skipped are stepped away from, returned as tried. It also returns
+// how many candidates the best one reaches, including itself.
+func bestBisection(candidates []plumbing.Hash, parents map[plumbing.Hash][]plumbing.Hash, skips map[plumbing.Hash]bool, bad plumbing.Hash) (plumbing.Hash, int, []plumbing.Hash) {
+	nr := len(candidates)
+
+	list := slices.Clone(candidates)
+	slices.Reverse(list)
+
+	// Like git, a commit with a single parent reaches one more commit
+	// than its parent, and only merges have their ancestry walked.
+	weights := make(map[plumbing.Hash]int, nr)
+	counted := 0
+
+	for _, h := range list {
+		switch len(parents[h]) {
+		case 0:
+			weights[h] = 1
+			counted++
+		case 1:
+			weights[h] = -1
+		default:
+			weights[h] = -2
+		}
+	}
+
+	all := len(skips) > 0
+
+	halfway := func(h plumbing.Hash) bool {
+		diff := 2*weights[h] - nr
+
+		return !all && (diff >= -1 && diff <= 1 || abs(diff) < nr/1024)
+	}
+
+	for _, h := range list {
+		if weights[h] != -2 {
+			continue
+		}
+
+		weights[h] = countReachable(h, parents)
+		if halfway(h) {
+			return h, weights[h], nil
+		}
+
+		counted++
+	}
+
+	for counted < nr {
+		for _, h := range list {
+			if weights[h] >= 0 {
+				continue
+			}
+
+			i := slices.IndexFunc(parents[h], func(p plumbing.Hash) bool { return weights[p] >= 0 })
+			if i < 0 {
+				continue
+			}
+
+			weights[h] = weights[parents[h][i]] + 1
+			counted++
+
+			if halfway(h) {
+				return h, weights[h], nil
+			}
+		}
+	}
+
+	distance := func(h plumbing.Hash) int {
+		return min(weights[h], nr-weights[h])
+	}
+
+	if !all {
+		best := list[0]
+
+		for _, h := range list {
+			if distance(h) > distance(best) {
+				best = h
+			}
+		}
+
+		return best, weights[best], nil
+	}
+
+	slices.SortStableFunc(list, func(a, b plumbing.Hash) int {
+		if d := distance(b) - distance(a); d != 0 {
+			return d
+		}
+
+		return a.Compare(b.Bytes())
+	})
+
+	if !skips[list[0]] {
+		return list[0], weights[list[0]], nil
+	}
+
+	var tried, rest []plumbing.Hash
+
+	for _, h := range list {
+		if skips[h] {
+			tried = append(tried, h)
+		} else {
+			rest = append(rest, h)
+		}
+	}
+
+	// Like git, the count is that of the best candidate, skipped or not.
+	return skipAway(rest, bad), weights[list[0]], tried
+}
+
+// skipAway picks the commit to test among the ranked candidates that are
+// not skipped, away from the best ones since those are often skipped for
+// the same reason. It uses git's pseudo random steps so that both test
+// the same commits.
+func skipAway(list []plumbing.Hash, bad plumbing.Hash) plumbing.Hash {
+	const modulo = 32768
+
+	count := len(list)
+	prn := int((uint32(count)*1103515245 + 12345) / 65536 % modulo)
+	index := (count * prn / modulo) * sqrti(prn) / sqrti(modulo)
+
+	switch {
+	case index >= count:
+		return list[0]
+	case list[index] != bad:
+		return list[index]
+	case index > 0:
+		return list[index-1]
+	default:
+		return list[0]
+	}
+}
+
+// sqrti returns the integer square root of val, computed in single
+// precision as git does.
+func sqrti(val int) int {
+	if val == 0 {
+		return 0
+	}
+
+	x := float32(val)
+
+	for {
+		y := (x + float32(val)/x) / 2
+		d := y - x
+
+		x = y
+
+		if d < 0.5 && d > -0.5 {
+			return int(x)
+		}
+	}
+}
+
+// countReachable returns the number of commits reachable from h through
+// parents, including itself.
+func countReachable(h plumbing.Hash, parents map[plumbing.Hash][]plumbing.Hash) int {
+	seen := map[plumbing.Hash]bool{h: true}
+	queue := []plumbing.Hash{h}
+
+	for len(queue) > 0 {
+		h := queue[0]
+		queue = queue[1:]
+
+		for _, p := range parents[h] {
+			if !seen[p] {
+				seen[p] = true
+				queue = append(queue, p)
+			}
+		}
+	}
+
+	return len(seen)
+}
+
+// estimateBisectSteps returns the number of steps left to find the first
+// bad commit among n candidates, using the same estimate as git.
+func estimateBisectSteps(n int) int {
+	if n < 3 {
+		return 0
+	}
+
+	steps := bits.Len(uint(n)) - 1
+	e := 1 << steps
+
+	if x := n - e; e < 3*x {
+		steps++
+	}
+
+	return steps - 1
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// bisectRepo returns a repository made by git whose file v counts its
+// commits, with a side branch merged half way.
+func bisectRepo(t *testing.T) string {
+	t.Helper()
+
+	var commits [][]string
+	for i := 1; i <= 10; i++ {
+		commits = append(commits, []string{"v", fmt.Sprint(i)})
+	}
+
+	dir := gitRepo(t, commits...)
+
+	gitCmd(t, dir, "checkout", "-q", "-b", "side", "HEAD~6")
+
+	for i := 1; i <= 4; i++ {
+		writeFile(t, dir, "s", fmt.Sprint(i))
+		gitCmd(t, dir, "add", "s")
+		gitCmd(t, dir, "commit", "-q", "-m", fmt.Sprintf("side %d", i))
+	}
+
+	gitCmd(t, dir, "checkout", "-q", "main")
+	gitCmd(t, dir, "merge", "-q", "--no-ff", "-m", "merge side", "side")
+
+	for i := 11; i <= 20; i++ {
+		writeFile(t, dir, "v", fmt.Sprint(i))
+		gitCmd(t, dir, "commit", "-q", "-a", "-m", fmt.Sprintf("commit %d", i))
+	}
+
+	return dir
+}
+
+// bisectTool runs git or gogit.
+func bisectTool(t *testing.T, tool, dir string, args ...string) result {
+	t.Helper()
+
+	if tool == "git" {
+		return run(t, dir, "", "git", args...)
+	}
+
+	return gogit(t, dir, args...)
+}
+
+// TestBisectRun checks that bisect run tests the same commits as git and
+// finds the same first bad commit, skipping those the script exits 125 on.
+func TestBisectRun(t *testing.T) {
+	for _, script := range []string{
+		`test "$(cat v)" -lt 13`,
+		`test "$(cat v)" -lt 4`,
+		`test -f s && exit 1; test "$(cat v)" -lt 17`,
+		`test "$(cat v)" = 13 && exit 125; test "$(cat v)" -lt 13`,
+		`test "$(cat v)" -lt 13 || exit 3`,
+	} {
+		t.Run(script, func(t *testing.T) {
+			var logs []string
+
+			for _, tool := range []string{"git", "gogit"} {
+				dir := bisectRepo(t)
+
+				res := bisectTool(t, tool, dir, "bisect", "start", "HEAD", "main~19")
+				if res.code != 0 {
+					t.Fatalf("%s bisect start failed: %s", tool, res.stderr)
+				}
+
+				res = bisectTool(t, tool, dir, "bisect", "run", "sh", "-c", script)
+
+				// Both logs are read by git, which checks that gogit's state
+				// is git's.
+				logs = append(logs, fmt.Sprintf("exit %d\n%s", res.code, gitCmd(t, dir, "bisect", "log")))
+			}
+
+			if logs[1] != logs[0] {
+				t.Errorf("gogit bisect run gave:\n%s\nwant, as git:\n%s", logs[1], logs[0])
+			}
+		})
+	}
+}
+
+// TestBisectSteps checks that the commands of a manual bisection check out
+// the same commits as git, and that reset goes back to the branch.
+func TestBisectSteps(t *testing.T) {
+	steps := [][]string{
+		{"bisect", "start"},
+		{"bisect", "bad"},
+		{"bisect", "good", "main~19"},
+		{"bisect", "good"},
+		{"bisect", "skip"},
+		{"bisect", "bad"},
+		{"bisect", "good"},
+	}
+
+	var states []string
+
+	for _, tool := range []string{"git", "gogit"} {
+		dir := bisectRepo(t)
+
+		var state strings.Builder
+
+		for _, args := range steps {
+			res := bisectTool(t, tool, dir, args...)
+			fmt.Fprintf(&state, "%v exit %d at %s%s", args, res.code, gitCmd(t, dir, "rev-parse", "HEAD"), res.stdout)
+		}
+
+		state.WriteString(gitCmd(t, dir, "bisect", "log"))
+
+		res := bisectTool(t, tool, dir, "bisect", "reset")
+		fmt.Fprintf(&state, "reset exit %d on %s", res.code, gitCmd(t, dir, "symbolic-ref", "HEAD"))
+
+		if exists(t, dir, ".git/BISECT_LOG") {
+			state.WriteString("BISECT_LOG left\n")
+		}
+
+		states = append(states, state.String())
+	}
+
+	if states[1] != states[0] {
+		t.Errorf("gogit bisect gave:\n%s\nwant, as git:\n%s", states[1], states[0])
+	}
+}
+
+// TestBisectReplay checks that gogit replays the logs written by git the
+// way git does.
+func TestBisectReplay(t *testing.T) {
+	for _, steps := range [][][]string{
+		{{"start", "HEAD", "main~19"}, {"good"}, {"bad"}},
+		{{"start"}, {"good", "main~19"}, {"bad"}, {"skip"}, {"good"}},
+	} {
+		dir := bisectRepo(t)
+
+		for _, args := range steps {
+			gitCmd(t, dir, append([]string{"bisect"}, args...)...)
+		}
+
+		writeFile(t, dir, "../bisect.log", gitCmd(t, dir, "bisect", "log"))
+
+		var states []string
+
+		for _, tool := range []string{"git", "gogit"} {
+			bisectTool(t, tool, dir, "bisect", "reset")
+
+			res := bisectTool(t, tool, dir, "bisect", "replay", "../bisect.log")
+			states = append(states, fmt.Sprintf("exit %d\n%s%s", res.code,
+				gitCmd(t, dir, "rev-parse", "HEAD"), gitCmd(t, dir, "bisect", "log")))
+		}
+
+		if states[1] != states[0] {
+			t.Errorf("gogit bisect replay gave:\n%s\nwant, as git:\n%s", states[1], states[0])
+		}
+	}
+}
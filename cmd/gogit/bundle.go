@@ -0,0 +1,832 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/packfile"
+	"github.com/go-git/go-git/v6/plumbing/revlist"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/spf13/cobra"
+)
+
+const (
+	bundleV2Signature = "# v2 git bundle"
+	bundleV3Signature = "# v3 git bundle"
+)
+
+var (
+	bundleVersion int
+	bundleQuiet   bool
+)
+
+func init() {
+	bundleCreateCmd.Flags().IntVarP(&bundleVersion, "version", "", 2, "Bundle format version, 2 or 3")
+	bundleCreateCmd.Flags().SetInterspersed(false)
+	bundleVerifyCmd.Flags().BoolVarP(&bundleQuiet, "quiet", "q", false, "Do not show the bundle details")
+
+	bundleCmd.AddCommand(bundleCreateCmd)
+	bundleCmd.AddCommand(bundleVerifyCmd)
+	bundleCmd.AddCommand(bundleListHeadsCmd)
+	bundleCmd.AddCommand(bundleUnbundleCmd)
+	rootCmd.AddCommand(bundleCmd)
+}
+
+var bundleCmd = &cobra.Command{
+	Use:   "bundle <command>",
+	Short: "Move objects and refs by archive",
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		return cmd.Usage()
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var bundleCreateCmd = &cobra.Command{
+	Use:   "create [--version=<version>] <file> <rev-list-args>...",
+	Short: "Create a bundle with the objects and refs named by <rev-list-args>",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if bundleVersion != 2 && bundleVersion != 3 {
+			return fmt.Errorf("unsupported bundle version %d", bundleVersion)
+		}
+
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		refs, wants, haves, err := parseBundleRevs(r, args[1:])
+		if err != nil {
+			return err
+		}
+
+		if len(refs) == 0 {
+			return errors.New("refusing to create empty bundle")
+		}
+
+		b := &bundle{version: bundleVersion, references: refs}
+
+		hashes, err := revlist.Objects(r.Storer, wants, haves)
+		if err != nil {
+			return fmt.Errorf("failed to list objects: %w", err)
+		}
+
+		b.prerequisites, err = bundlePrerequisites(r, hashes)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Create(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to create bundle: %w", err)
+		}
+
+		err = b.write(f, r, hashes)
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(args[0])
+
+			return err
+		}
+
+		return f.Close()
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var bundleVerifyCmd = &cobra.Command{
+	Use:   "verify [-q] <file>",
+	Short: "Check that a bundle is valid and applies to the repository",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		b, pack, err := openBundle(args[0])
+		if err != nil {
+			return err
+		}
+		defer pack.Close()
+
+		err = b.checkPrerequisites(r)
+		if err != nil {
+			return err
+		}
+
+		if !bundleQuiet {
+			b.describe(cmd.OutOrStdout())
+		}
+
+		fmt.Fprintf(cmd.ErrOrStderr(), "%s is okay\n", args[0])
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var bundleListHeadsCmd = &cobra.Command{
+	Use:   "list-heads <file> [<refname>...]",
+	Short: "List the references defined in a bundle",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		b, pack, err := openBundle(args[0])
+		if err != nil {
+			return err
+		}
+		defer pack.Close()
+
+		for _, ref := range b.references {
+			if len(args) > 1 && !matchesRefName(ref.Name(), args[1:]) {
+				continue
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "%s %s\n", ref.Hash(), ref.Name())
+		}
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var bundleUnbundleCmd = &cobra.Command{
+	Use:   "unbundle <file> [<refname>...]",
+	Short: "Store the objects of a bundle in the repository",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		b, pack, err := openBundle(args[0])
+		if err != nil {
+			return err
+		}
+		defer pack.Close()
+
+		err = b.unbundle(r, pack)
+		if err != nil {
+			return err
+		}
+
+		for _, ref := range b.references {
+			if len(args) > 1 && !matchesRefName(ref.Name(), args[1:]) {
+				continue
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "%s %s\n", ref.Hash(), ref.Name())
+		}
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// bundle is the header of a git bundle: the references it contains and
+// the commits the receiving repository must already have.
+type bundle struct {
+	version       int
+	capabilities  []string
+	prerequisites []bundlePrerequisite
+	references    []*plumbing.Reference
+}
+
+type bundlePrerequisite struct {
+	hash    plumbing.Hash
+	comment string
+}
+
+// bundlePack is the packfile following a bundle header.
+type bundlePack struct {
+	*bufio.Reader
+	io.Closer
+}
+
+// isBundle reports whether path is a bundle file.
+func isBundle(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil {
+		return false
+	}
+
+	line = strings.TrimSuffix(line, "\n")
+
+	return line == bundleV2Signature || line == bundleV3Signature
+}
+
+// openBundle reads the header of the bundle at path, returning the
+// packfile that follows it.
+func openBundle(path string) (*bundle, *bundlePack, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not open '%s': %w", path, err)
+	}
+
+	rd := bufio.NewReader(f)
+
+	b, err := readBundleHeader(rd)
+	if err != nil {
+		_ = f.Close()
+
+		return nil, nil, fmt.Errorf("'%s' does not look like a v2 or v3 bundle file: %w", path, err)
+	}
+
+	return b, &bundlePack{Reader: rd, Closer: f}, nil
+}
+
+func readBundleHeader(rd *bufio.Reader) (*bundle, error) {
+	b := &bundle{}
+
+	for first := true; ; first = false {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case first && line == bundleV2Signature:
+			b.version = 2
+		case first && line == bundleV3Signature:
+			b.version = 3
+		case first:
+			return nil, errors.New("unknown signature")
+		case line == "":
+			return b, nil
+		case b.version == 3 && strings.HasPrefix(line, "@"):
+			capability := line[1:]
+			if capability != "object-format=sha1" {
+				return nil, fmt.Errorf("unsupported capability '%s'", capability)
+			}
+
+			b.capabilities = append(b.capabilities, capability)
+		case strings.HasPrefix(line, "-"):
+			hex, comment, _ := strings.Cut(line[1:], " ")
+
+			h, ok := plumbing.FromHex(hex)
+			if !ok {
+				return nil, fmt.Errorf("invalid prerequisite '%s'", line)
+			}
+
+			b.prerequisites = append(b.prerequisites, bundlePrerequisite{hash: h, comment: comment})
+		default:
+			hex, name, found := strings.Cut(line, " ")
+
+			h, ok := plumbing.FromHex(hex)
+			if !ok || !found {
+				return nil, fmt.Errorf("invalid reference '%s'", line)
+			}
+
+			b.references = append(b.references, plumbing.NewHashReference(plumbing.ReferenceName(name), h))
+		}
+	}
+}
+
+// write writes the bundle header followed by a pack of hashes.
+func (b *bundle) write(w io.Writer, r *git.Repository, hashes []plumbing.Hash) error {
+	bw := bufio.NewWriter(w)
+
+	if b.version == 3 {
+		fmt.Fprintln(bw, bundleV3Signature)
+		fmt.Fprintln(bw, "@object-format=sha1")
+	} else {
+		fmt.Fprintln(bw, bundleV2Signature)
+	}
+
+	for _, p := range b.prerequisites {
+		fmt.Fprintf(bw, "-%s %s\n", p.hash, p.comment)
+	}
+
+	for _, ref := range b.references {
+		fmt.Fprintf(bw, "%s %s\n", ref.Hash(), ref.Name())
+	}
+
+	fmt.Fprintln(bw)
+
+	_, err := packfile.NewEncoder(bw, r.Storer, false).Encode(hashes, 10)
+	if err != nil {
+		return fmt.Errorf("failed to write pack: %w", err)
+	}
+
+	return bw.Flush()
+}
+
+// describe writes the details shown by bundle verify.
+func (b *bundle) describe(out io.Writer) {
+	if len(b.references) == 1 {
+		fmt.Fprintln(out, "The bundle contains this ref:")
+	} else {
+		fmt.Fprintf(out, "The bundle contains these %d refs:\n", len(b.references))
+	}
+
+	for _, ref := range b.references {
+		fmt.Fprintf(out, "%s %s\n", ref.Hash(), ref.Name())
+	}
+
+	switch len(b.prerequisites) {
+	case 0:
+		fmt.Fprintln(out, "The bundle records a complete history.")
+	case 1:
+		fmt.Fprintln(out, "The bundle requires this ref:")
+	default:
+		fmt.Fprintf(out, "The bundle requires these %d refs:\n", len(b.prerequisites))
+	}
+
+	for _, p := range b.prerequisites {
+		fmt.Fprintf(out, "%s \n", p.hash)
+	}
+
+	fmt.Fprintln(out, "The bundle uses this hash algorithm: sha1")
+}
+
+// checkPrerequisites fails if r lacks any of the prerequisite commits.
+func (b *bundle) checkPrerequisites(r *git.Repository) error {
+	var missing []string
+
+	for _, p := range b.prerequisites {
+		if _, err := r.CommitObject(p.hash); err != nil {
+			missing = append(missing, fmt.Sprintf("%s %s", p.hash, p.comment))
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("repository lacks these prerequisite commits:\n%s", strings.Join(missing, "\n"))
+	}
+
+	return nil
+}
+
+// unbundle stores the objects of pack in r. Bundles created by git contain
+// thin packs whose deltas may refer to the prerequisites, so those are
+// resolved against the repository objects.
+func (b *bundle) unbundle(r *git.Repository, pack io.Reader) error {
+	err := b.checkPrerequisites(r)
+	if err != nil {
+		return err
+	}
+
+	if len(b.prerequisites) == 0 {
+		err = packfile.UpdateObjectStorage(r.Storer, pack)
+	} else {
+		_, err = packfile.NewParser(pack, packfile.WithStorage(r.Storer)).Parse()
+	}
+
+	if err != nil && !errors.Is(err, packfile.ErrEmptyPackfile) {
+		return fmt.Errorf("failed to unpack bundle: %w", err)
+	}
+
+	return nil
+}
+
+// matchesRefName reports whether one of patterns matches the end of name
+// on a path component boundary.
+func matchesRefName(name plumbing.ReferenceName, patterns []string) bool {
+	for _, p := range patterns {
+		if name.String() == p || strings.HasSuffix(name.String(), "/"+p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseBundleRevs splits rev-list arguments into the references to record
+// in a bundle, and the commits to include and exclude.
+func parseBundleRevs(r *git.Repository, args []string) ([]*plumbing.Reference, []plumbing.Hash, []plumbing.Hash, error) {
+	var (
+		refs         []*plumbing.Reference
+		wants, haves []plumbing.Hash
+	)
+
+	addRef := func(ref *plumbing.Reference) {
+		for _, seen := range refs {
+			if seen.Name() == ref.Name() {
+				return
+			}
+		}
+
+		refs = append(refs, ref)
+		wants = append(wants, ref.Hash())
+	}
+
+	addPrefix := func(prefix string) error {
+		iter, err := r.References()
+		if err != nil {
+			return err
+		}
+
+		var matched []*plumbing.Reference
+
+		err = iter.ForEach(func(ref *plumbing.Reference) error {
+			if strings.HasPrefix(ref.Name().String(), prefix) && ref.Type() == plumbing.HashReference {
+				matched = append(matched, ref)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		sort.Slice(matched, func(i, j int) bool { return matched[i].Name() < matched[j].Name() })
+
+		for _, ref := range matched {
+			addRef(ref)
+		}
+
+		return nil
+	}
+
+	for _, arg := range args {
+		var err error
+
+		switch {
+		case arg == "--all":
+			err = addPrefix("refs/")
+			if err == nil {
+				var head *plumbing.Reference
+
+				head, err = r.Head()
+				if err == nil {
+					addRef(plumbing.NewHashReference(plumbing.HEAD, head.Hash()))
+				}
+			}
+		case arg == "--branches":
+			err = addPrefix("refs/heads/")
+		case arg == "--tags":
+			err = addPrefix("refs/tags/")
+		case arg == "--remotes":
+			err = addPrefix("refs/remotes/")
+		case strings.HasPrefix(arg, "-"):
+			err = fmt.Errorf("unsupported rev-list argument '%s'", arg)
+		case strings.HasPrefix(arg, "^"):
+			var h plumbing.Hash
+
+			h, err = resolveObject(r, arg[1:])
+			haves = append(haves, h)
+		case strings.Contains(arg, ".."):
+			from, to, _ := strings.Cut(arg, "..")
+
+			var h plumbing.Hash
+
+			h, err = resolveObject(r, from)
+			if err == nil {
+				haves = append(haves, h)
+				err = addBundleRev(r, to, addRef, &wants)
+			}
+		default:
+			err = addBundleRev(r, arg, addRef, &wants)
+		}
+
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	return refs, wants, haves, nil
+}
+
+// addBundleRev includes rev in a bundle, recording it as a reference when
+// it names one.
+func addBundleRev(r *git.Repository, rev string, addRef func(*plumbing.Reference), wants *[]plumbing.Hash) error {
+	if rev == "" {
+		rev = plumbing.HEAD.String()
+	}
+
+	for _, rule := range plumbing.RefRevParseRules {
+		name := plumbing.ReferenceName(fmt.Sprintf(rule, rev))
+
+		ref, err := r.Reference(name, true)
+		if err == nil {
+			addRef(plumbing.NewHashReference(name, ref.Hash()))
+
+			return nil
+		}
+	}
+
+	h, err := resolveObject(r, rev)
+	if err != nil {
+		return fmt.Errorf("bad revision '%s': %w", rev, err)
+	}
+
+	*wants = append(*wants, h)
+
+	return nil
+}
+
+// bundlePrerequisites returns the commits outside of hashes that commits
+// in hashes have as parents.
+func bundlePrerequisites(r *git.Repository, hashes []plumbing.Hash) ([]bundlePrerequisite, error) {
+	included := make(map[plumbing.Hash]bool, len(hashes))
+	for _, h := range hashes {
+		included[h] = true
+	}
+
+	var prerequisites []bundlePrerequisite
+
+	seen := make(map[plumbing.Hash]bool)
+
+	for _, h := range hashes {
+		c, err := r.CommitObject(h)
+		if errors.Is(err, plumbing.ErrObjectNotFound) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range c.ParentHashes {
+			if included[p] || seen[p] {
+				continue
+			}
+
+			seen[p] = true
+
+			parent, err := r.CommitObject(p)
+			if err != nil {
+				return nil, err
+			}
+
+			prerequisites = append(prerequisites, bundlePrerequisite{hash: p, comment: commitSubject(parent)})
+		}
+	}
+
+	return prerequisites, nil
+}
+
+// fetchBundle stores the objects of the bundle at path in r and updates
+// the references mapped by refspecs.
+func fetchBundle(r *git.Repository, path string, refspecs []config.RefSpec) (*bundle, error) {
+	b, pack, err := openBundle(path)
+	if err != nil {
+		return nil, err
+	}
+	defer pack.Close()
+
+	err = b.unbundle(r, pack)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ref := range b.references {
+		for _, rs := range b.expandRefSpecs(refspecs) {
+			if !rs.Match(ref.Name()) {
+				continue
+			}
+
+			dst := rs.Dst(ref.Name())
+
+			err := updateFetchedRef(r, dst, ref.Hash(), rs.IsForceUpdate() || dst.IsTag())
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return b, nil
+}
+
+// expandRefSpecs returns refspecs with the short names of their sources
+// expanded to the references of the bundle they name, the way git
+// resolves them.
+func (b *bundle) expandRefSpecs(refspecs []config.RefSpec) []config.RefSpec {
+	expanded := make([]config.RefSpec, 0, len(refspecs))
+
+	for _, rs := range refspecs {
+		src := rs.Src()
+		if rs.IsWildcard() || strings.HasPrefix(src, "refs/") {
+			expanded = append(expanded, rs)
+
+			continue
+		}
+
+		for _, rule := range plumbing.RefRevParseRules {
+			name := plumbing.ReferenceName(fmt.Sprintf(rule, src))
+			if !slices.ContainsFunc(b.references, func(ref *plumbing.Reference) bool { return ref.Name() == name }) {
+				continue
+			}
+
+			_, dst, _ := strings.Cut(string(rs), ":")
+
+			spec := name.String() + ":" + dst
+			if rs.IsForceUpdate() {
+				spec = "+" + spec
+			}
+
+			rs = config.RefSpec(spec)
+
+			break
+		}
+
+		expanded = append(expanded, rs)
+	}
+
+	return expanded
+}
+
+// writeFetchHead records the HEAD of the bundle at path in FETCH_HEAD,
+// as git does when fetching a bundle without refspecs.
+func writeFetchHead(r *git.Repository, path string, b *bundle) error {
+	store, ok := r.Storer.(*filesystem.Storage)
+	if !ok {
+		return errors.New("storer does not implement filesystem.Storage")
+	}
+
+	for _, ref := range b.references {
+		if ref.Name() != plumbing.HEAD {
+			continue
+		}
+
+		line := fmt.Sprintf("%s\t\t%s\n", ref.Hash(), path)
+
+		return util.WriteFile(store.Filesystem(), "FETCH_HEAD", []byte(line), 0o644)
+	}
+
+	return errors.New("couldn't find remote ref HEAD")
+}
+
+// updateFetchedRef points name at h, refusing non fast-forward updates
+// unless force is set.
+func updateFetchedRef(r *git.Repository, name plumbing.ReferenceName, h plumbing.Hash, force bool) error {
+	old, err := r.Reference(name, true)
+	if err == nil && old.Hash() != h && !force {
+		if c, err := r.CommitObject(h); err == nil {
+			if oc, err := r.CommitObject(old.Hash()); err == nil {
+				if ok, _ := oc.IsAncestor(c); !ok {
+					return fmt.Errorf("rejected %s (non-fast-forward)", name.Short())
+				}
+			}
+		}
+	}
+
+	return r.Storer.SetReference(plumbing.NewHashReference(name, h))
+}
+
+// cloneBundle clones the bundle at path into dir, checking out the branch
+// the bundle HEAD points at, and returns the hooks of the new repository.
+// The references are written once the reference-transaction hook accepted
+// them.
+func cloneBundle(path, dir string, bare bool, errOut io.Writer) (*hooks, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := git.PlainInit(dir, bare)
+	if err != nil {
+		return nil, err
+	}
+
+	hs := newHooks(r, errOut)
+
+	pending, err := holdRefUpdates(r)
+	if err != nil {
+		return nil, err
+	}
+
+	checkedOut, err := unbundleClone(r, abs, bare)
+	if err != nil {
+		pending.discard()
+
+		return nil, err
+	}
+
+	err = pending.commit(hs, refSnapshot{})
+	if err != nil {
+		return nil, err
+	}
+
+	if checkedOut {
+		err = smudgeWorktree(r, errOut, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return hs, nil
+}
+
+// unbundleClone fetches the bundle at path into the new repository r,
+// and checks out the branch the bundle HEAD points at unless r is bare.
+// It tells whether a branch was checked out.
+func unbundleClone(r *git.Repository, path string, bare bool) (bool, error) {
+	fetch := config.RefSpec(fmt.Sprintf(config.DefaultFetchRefSpec, git.DefaultRemoteName))
+	if bare {
+		fetch = "+refs/heads/*:refs/heads/*"
+	}
+
+	_, err := r.CreateRemote(&config.RemoteConfig{
+		Name:  git.DefaultRemoteName,
+		URLs:  []string{path},
+		Fetch: []config.RefSpec{fetch},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	b, err := fetchBundle(r, path, []config.RefSpec{fetch, "+refs/tags/*:refs/tags/*"})
+	if err != nil {
+		return false, err
+	}
+
+	branch := bundleHeadBranch(b)
+	if branch == "" {
+		return false, nil
+	}
+
+	var h plumbing.Hash
+
+	for _, ref := range b.references {
+		if ref.Name() == branch {
+			h = ref.Hash()
+		}
+	}
+
+	err = r.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, branch))
+	if err != nil {
+		return false, err
+	}
+
+	if bare {
+		return false, nil
+	}
+
+	err = r.Storer.SetReference(plumbing.NewHashReference(branch, h))
+	if err != nil {
+		return false, err
+	}
+
+	err = trackBranch(r, branch.Short(), git.DefaultRemoteName)
+	if err != nil {
+		return false, err
+	}
+
+	// Like git, the remote HEAD follows the branch checked out.
+	remoteHead := plumbing.NewRemoteHEADReferenceName(git.DefaultRemoteName)
+
+	err = r.Storer.SetReference(plumbing.NewSymbolicReference(remoteHead, plumbing.NewRemoteReferenceName(git.DefaultRemoteName, branch.Short())))
+	if err != nil {
+		return false, err
+	}
+
+	w, err := r.Worktree()
+	if err != nil {
+		return false, err
+	}
+
+	err = w.Reset(&git.ResetOptions{Commit: h, Mode: git.HardReset})
+	if err != nil {
+		return false, fmt.Errorf("failed to checkout: %w", err)
+	}
+
+	return true, nil
+}
+
+// bundleHeadBranch returns the branch of the bundle its HEAD points at:
+// the first branch with the same commit, preferring the default branch.
+func bundleHeadBranch(b *bundle) plumbing.ReferenceName {
+	var (
+		head    plumbing.Hash
+		hasHead bool
+		branch  plumbing.ReferenceName
+	)
+
+	for _, ref := range b.references {
+		if ref.Name() == plumbing.HEAD {
+			head, hasHead = ref.Hash(), true
+		}
+	}
+
+	for _, ref := range b.references {
+		if !ref.Name().IsBranch() || (hasHead && ref.Hash() != head) {
+			continue
+		}
+
+		if branch == "" || ref.Name() == plumbing.Main || ref.Name() == plumbing.Master {
+			branch = ref.Name()
+		}
+	}
+
+	return branch
+}
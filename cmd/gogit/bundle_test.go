@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// bundleRepo returns a repository made by git with two branches and an
+// annotated tag.
+func bundleRepo(t *testing.T) string {
+	t.Helper()
+
+	dir := gitRepo(t, []string{"a", "1"}, []string{"a", "2"}, []string{"a", "3", "b", "1"})
+	gitCmd(t, dir, "tag", "-a", "-m", "v1", "v1", "HEAD~1")
+	gitCmd(t, dir, "branch", "topic", "HEAD~2")
+
+	return dir
+}
+
+// bundleHeader returns the header of the bundle file, before its pack.
+func bundleHeader(t *testing.T, file string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header, _, ok := bytes.Cut(data, []byte("\n\n"))
+	if !ok {
+		t.Fatalf("%s has no bundle header", file)
+	}
+
+	return string(header)
+}
+
+// TestBundleCreate checks that gogit writes the bundles git writes, which
+// git then reads.
+func TestBundleCreate(t *testing.T) {
+	dir := bundleRepo(t)
+
+	for _, tc := range []struct{ opts, revs string }{
+		{"", "main"},
+		{"", "--all"},
+		{"", "main~1..main"},
+		{"--version=3", "main topic"},
+		{"", "v1 ^topic"},
+		{"", "--branches --tags"},
+	} {
+		t.Run(tc.opts+" "+tc.revs, func(t *testing.T) {
+			want := filepath.Join(t.TempDir(), "git.bundle")
+			args := append(strings.Fields("bundle create -q "+tc.opts), want)
+			gitCmd(t, dir, append(args, strings.Fields(tc.revs)...)...)
+
+			got := filepath.Join(t.TempDir(), "gogit.bundle")
+			args = append(strings.Fields("bundle create "+tc.opts), got)
+			mustGogit(t, dir, append(args, strings.Fields(tc.revs)...)...)
+
+			if g, w := bundleHeader(t, got), bundleHeader(t, want); g != w {
+				t.Errorf("gogit wrote the bundle header:\n%s\nwant, as git:\n%s", g, w)
+			}
+
+			gitCmd(t, dir, "bundle", "verify", "-q", got)
+
+			if g, w := gitCmd(t, dir, "bundle", "list-heads", got), gitCmd(t, dir, "bundle", "list-heads", want); g != w {
+				t.Errorf("git lists the heads of the gogit bundle:\n%s\nwant:\n%s", g, w)
+			}
+		})
+	}
+}
+
+// TestBundleRead checks that gogit reads the bundles written by git as git
+// does.
+func TestBundleRead(t *testing.T) {
+	dir := bundleRepo(t)
+
+	full := filepath.Join(t.TempDir(), "full.bundle")
+	gitCmd(t, dir, "bundle", "create", "-q", full, "--all")
+
+	v3 := filepath.Join(t.TempDir(), "v3.bundle")
+	gitCmd(t, dir, "bundle", "create", "-q", "--version=3", v3, "main")
+
+	incremental := filepath.Join(t.TempDir(), "incremental.bundle")
+	gitCmd(t, dir, "bundle", "create", "-q", incremental, "main~1..main")
+
+	for _, args := range [][]string{
+		{"bundle", "list-heads", full},
+		{"bundle", "list-heads", full, "refs/heads/main", "refs/tags/v1"},
+		{"bundle", "list-heads", v3},
+		{"bundle", "list-heads", incremental},
+		{"bundle", "verify", "-q", full},
+		{"bundle", "verify", "-q", v3},
+		{"bundle", "verify", "-q", incremental},
+		{"bundle", "unbundle", full},
+		{"bundle", "unbundle", incremental, "refs/heads/main"},
+	} {
+		sameOutput(t, dir, args...)
+	}
+
+	// A bundle whose prerequisites are missing does not verify.
+	empty := gitRepo(t)
+	if res := gogit(t, empty, "bundle", "verify", "-q", incremental); res.code == 0 {
+		t.Error("gogit bundle verify accepted a bundle with missing prerequisites")
+	}
+}
+
+// TestBundleTransfer checks that clone and fetch take a bundle as their
+// source.
+func TestBundleTransfer(t *testing.T) {
+	dir := bundleRepo(t)
+
+	full := filepath.Join(t.TempDir(), "full.bundle")
+	gitCmd(t, dir, "bundle", "create", "-q", full, "--all")
+
+	want := filepath.Join(t.TempDir(), "git")
+	gitCmd(t, "", "clone", "-q", full, want)
+
+	got := filepath.Join(t.TempDir(), "gogit")
+	mustGogit(t, "", "clone", full, got)
+
+	refs := func(dir string) string {
+		return gitCmd(t, dir, "for-each-ref", "--format=%(objectname) %(refname) %(upstream)") +
+			gitCmd(t, dir, "symbolic-ref", "HEAD") + gitCmd(t, dir, "config", "remote.origin.url")
+	}
+
+	if g, w := refs(got), refs(want); g != w {
+		t.Errorf("gogit clone from a bundle gave:\n%s\nwant, as git:\n%s", g, w)
+	}
+
+	gitCmd(t, got, "fsck")
+
+	// New commits come through an incremental bundle.
+	writeFile(t, dir, "a", "4")
+	gitCmd(t, dir, "commit", "-q", "-a", "-m", "commit 4")
+
+	incremental := filepath.Join(t.TempDir(), "incremental.bundle")
+	gitCmd(t, dir, "bundle", "create", "-q", incremental, "main~1..main")
+
+	gitCmd(t, want, "fetch", "-q", incremental, "main:refs/remotes/origin/main")
+	mustGogit(t, got, "fetch", incremental, "main:refs/remotes/origin/main")
+
+	if g, w := refs(got), refs(want); g != w {
+		t.Errorf("gogit fetch from a bundle gave:\n%s\nwant, as git:\n%s", g, w)
+	}
+
+	gitCmd(t, got, "fsck")
+}
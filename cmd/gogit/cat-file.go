@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/spf13/cobra"
+)
+
+const defaultBatchFormat = "%(objectname) %(objecttype) %(objectsize)"
+
+var (
+	catFileType       bool
+	catFileSize       bool
+	catFilePretty     bool
+	catFileExists     bool
+	catFileBatch      string
+	catFileBatchCheck string
+	catFileAllObjects bool
+	catFileBuffer     bool
+	catFileUnordered  bool
+)
+
+func init() {
+	catFileCmd.Flags().BoolVarP(&catFileType, "type", "t", false, "Show the object type")
+	catFileCmd.Flags().BoolVarP(&catFileSize, "size", "s", false, "Show the object size")
+	catFileCmd.Flags().BoolVarP(&catFilePretty, "pretty", "p", false, "Pretty-print the object content")
+	catFileCmd.Flags().BoolVarP(&catFileExists, "exists", "e", false, "Exit with zero status if the object exists")
+	catFileCmd.Flags().StringVarP(&catFileBatch, "batch", "", "", "Show the info and content of the objects read from stdin")
+	catFileCmd.Flags().StringVarP(&catFileBatchCheck, "batch-check", "", "", "Show the info of the objects read from stdin")
+	catFileCmd.Flags().BoolVarP(&catFileAllObjects, "batch-all-objects", "", false, "Show all objects in the repository instead of reading stdin")
+	catFileCmd.Flags().BoolVarP(&catFileBuffer, "buffer", "", false, "Buffer the batch output instead of flushing it after each object")
+	catFileCmd.Flags().BoolVarP(&catFileUnordered, "unordered", "", false, "Show all objects in storage order rather than sorted by id")
+	catFileCmd.Flags().Lookup("batch").NoOptDefVal = defaultBatchFormat
+	catFileCmd.Flags().Lookup("batch-check").NoOptDefVal = defaultBatchFormat
+	rootCmd.AddCommand(catFileCmd)
+}
+
+var catFileCmd = &cobra.Command{
+	Use:   "cat-file (-t | -s | -p | -e | <type>) <object> | (--batch[=<format>] | --batch-check[=<format>]) [--batch-all-objects] [--buffer] [--unordered]",
+	Short: "Provide content, type or size of repository objects",
+	Args:  cobra.MaximumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		if cmd.Flags().Changed("batch") || cmd.Flags().Changed("batch-check") {
+			if len(args) > 0 {
+				return errors.New("batch modes take no arguments")
+			}
+
+			b, err := newBatch(r, cmd.OutOrStdout())
+			if err != nil {
+				return err
+			}
+
+			if catFileAllObjects {
+				return b.all(catFileUnordered)
+			}
+
+			return b.run(cmd.InOrStdin())
+		}
+
+		if catFileType || catFileSize || catFilePretty || catFileExists {
+			if len(args) != 1 {
+				return errors.New("an object is required")
+			}
+
+			return catObject(cmd, r, args[0])
+		}
+
+		if len(args) != 2 {
+			return cmd.Usage()
+		}
+
+		return catTypedObject(r, cmd.OutOrStdout(), args[0], args[1])
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// exitStatus is returned by commands that report their result through the
+// exit status alone.
+type exitStatus int
+
+func (e exitStatus) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
+func catObject(cmd *cobra.Command, r *git.Repository, rev string) error {
+	h, err := resolveObject(r, rev)
+	if err != nil {
+		return fmt.Errorf("not a valid object name %s", rev)
+	}
+
+	obj, err := r.Storer.EncodedObject(plumbing.AnyObject, h)
+	if err != nil {
+		if catFileExists {
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+
+			return exitStatus(1)
+		}
+
+		return fmt.Errorf("not a valid object name %s", rev)
+	}
+
+	out := cmd.OutOrStdout()
+
+	switch {
+	case catFileExists:
+		return nil
+	case catFileType:
+		fmt.Fprintln(out, obj.Type())
+
+		return nil
+	case catFileSize:
+		fmt.Fprintln(out, obj.Size())
+
+		return nil
+	}
+
+	if obj.Type() == plumbing.TreeObject {
+		tree, err := r.TreeObject(h)
+		if err != nil {
+			return err
+		}
+
+		return printTree(out, tree)
+	}
+
+	return copyObject(out, obj)
+}
+
+// catTypedObject prints the raw content of rev, peeled to typ.
+func catTypedObject(r *git.Repository, out io.Writer, typ, rev string) error {
+	t, err := plumbing.ParseObjectType(typ)
+	if err != nil {
+		return fmt.Errorf("invalid object type \"%s\"", typ)
+	}
+
+	h, err := resolveObject(r, rev)
+	if err != nil {
+		return fmt.Errorf("not a valid object name %s", rev)
+	}
+
+	obj, err := r.Object(plumbing.AnyObject, h)
+	if err != nil {
+		return fmt.Errorf("not a valid object name %s", rev)
+	}
+
+	for obj.Type() != t {
+		switch o := obj.(type) {
+		case *object.Tag:
+			obj, err = o.Object()
+			if err != nil {
+				return err
+			}
+
+			continue
+		case *object.Commit:
+			if t == plumbing.TreeObject {
+				obj, err = o.Tree()
+				if err != nil {
+					return err
+				}
+
+				continue
+			}
+		}
+
+		return fmt.Errorf("git cat-file %s: bad file", rev)
+	}
+
+	encoded, err := r.Storer.EncodedObject(t, obj.ID())
+	if err != nil {
+		return err
+	}
+
+	return copyObject(out, encoded)
+}
+
+// printTree prints the entries of tree as git ls-tree does.
+func printTree(out io.Writer, tree *object.Tree) error {
+	for _, e := range tree.Entries {
+		_, err := fmt.Fprintf(out, "%06o %s %s\t%s\n", uint32(e.Mode), treeEntryType(e.Mode), e.Hash, e.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// treeEntryType returns the type of the objects tree entries with the given
+// mode point at.
+func treeEntryType(mode filemode.FileMode) plumbing.ObjectType {
+	switch mode {
+	case filemode.Dir:
+		return plumbing.TreeObject
+	case filemode.Submodule:
+		return plumbing.CommitObject
+	default:
+		return plumbing.BlobObject
+	}
+}
+
+func copyObject(out io.Writer, obj plumbing.EncodedObject) error {
+	rd, err := obj.Reader()
+	if err != nil {
+		return fmt.Errorf("failed to read object %s: %w", obj.Hash(), err)
+	}
+	defer rd.Close()
+
+	_, err = io.Copy(out, rd)
+
+	return err
+}
+
+var batchAtom = regexp.MustCompile(`%\(([^)]*)\)`)
+
+// batch answers the object queries of cat-file --batch and --batch-check.
+type batch struct {
+	r        *git.Repository
+	w        *bufio.Writer
+	format   string
+	contents bool
+	hasRest  bool
+}
+
+func newBatch(r *git.Repository, out io.Writer) (*batch, error) {
+	b := &batch{r: r, w: bufio.NewWriter(out), format: catFileBatchCheck}
+	if catFileBatch != "" {
+		b.format = catFileBatch
+		b.contents = true
+	}
+
+	for _, m := range batchAtom.FindAllStringSubmatch(b.format, -1) {
+		switch m[1] {
+		case "objectname", "objecttype", "objectsize":
+		case "rest":
+			b.hasRest = true
+		default:
+			return nil, fmt.Errorf("unknown format element: %s", m[1])
+		}
+	}
+
+	return b, nil
+}
+
+// run answers a query for each line of in.
+func (b *batch) run(in io.Reader) error {
+	s := bufio.NewScanner(in)
+	s.Buffer(nil, 1<<20)
+
+	for s.Scan() {
+		name, rest := s.Text(), ""
+		if b.hasRest {
+			if i := strings.IndexAny(name, " \t"); i >= 0 {
+				name, rest = name[:i], strings.TrimLeft(name[i:], " \t")
+			}
+		}
+
+		err := b.query(name, rest)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return err
+	}
+
+	return b.w.Flush()
+}
+
+// all answers a query for every object in the repository, sorted by id
+// unless unordered is set.
+func (b *batch) all(unordered bool) error {
+	iter, err := b.r.Storer.IterEncodedObjects(plumbing.AnyObject)
+	if err != nil {
+		return err
+	}
+
+	var hashes []plumbing.Hash
+
+	seen := make(map[plumbing.Hash]bool)
+
+	err = iter.ForEach(func(obj plumbing.EncodedObject) error {
+		if !seen[obj.Hash()] {
+			seen[obj.Hash()] = true
+			hashes = append(hashes, obj.Hash())
+		}
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, storer.ErrStop) {
+		return err
+	}
+
+	if !unordered {
+		sort.Slice(hashes, func(i, j int) bool {
+			return hashes[i].Compare(hashes[j].Bytes()) < 0
+		})
+	}
+
+	for _, h := range hashes {
+		err := b.query(h.String(), "")
+		if err != nil {
+			return err
+		}
+	}
+
+	return b.w.Flush()
+}
+
+func (b *batch) query(name, rest string) error {
+	var obj plumbing.EncodedObject
+
+	h, err := resolveObject(b.r, name)
+	if err == nil {
+		obj, err = b.r.Storer.EncodedObject(plumbing.AnyObject, h)
+	}
+
+	switch {
+	case errors.Is(err, errAmbiguousObject):
+		fmt.Fprintf(b.w, "%s ambiguous\n", name)
+	case err != nil:
+		fmt.Fprintf(b.w, "%s missing\n", name)
+	default:
+		err = b.write(obj, rest)
+		if err != nil {
+			return err
+		}
+	}
+
+	if catFileBuffer {
+		return nil
+	}
+
+	return b.w.Flush()
+}
+
+func (b *batch) write(obj plumbing.EncodedObject, rest string) error {
+	line := batchAtom.ReplaceAllStringFunc(b.format, func(atom string) string {
+		switch atom {
+		case "%(objectname)":
+			return obj.Hash().String()
+		case "%(objecttype)":
+			return obj.Type().String()
+		case "%(objectsize)":
+			return fmt.Sprint(obj.Size())
+		default:
+			return rest
+		}
+	})
+
+	fmt.Fprintln(b.w, line)
+
+	if !b.contents {
+		return nil
+	}
+
+	err := copyObject(b.w, obj)
+	if err != nil {
+		return err
+	}
+
+	return b.w.WriteByte('\n')
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// catFileRepo returns a repository made by git with packed and loose
+// objects, an annotated tag and a subdirectory.
+func catFileRepo(t *testing.T) string {
+	t.Helper()
+
+	dir := gitRepo(t, []string{"a", "1", "d/b", "2"}, []string{"a", "2"})
+	gitCmd(t, dir, "tag", "-a", "-m", "v1", "v1")
+	gitCmd(t, dir, "gc", "-q")
+
+	writeFile(t, dir, "d/c", "loose\n")
+	gitCmd(t, dir, "add", "d/c")
+	gitCmd(t, dir, "commit", "-q", "-m", "loose")
+
+	return dir
+}
+
+func TestCatFile(t *testing.T) {
+	dir := catFileRepo(t)
+
+	for _, args := range []string{
+		"-t HEAD",
+		"-t v1",
+		"-t HEAD:d",
+		"-s HEAD:a",
+		"-s v1",
+		"-p HEAD",
+		"-p v1",
+		"-p HEAD:d",
+		"-p HEAD~1:a",
+		"-e HEAD:d/c",
+		"blob HEAD:d/c",
+		"commit v1",
+		"tree HEAD",
+	} {
+		t.Run(args, func(t *testing.T) {
+			sameOutput(t, dir, append([]string{"cat-file"}, strings.Fields(args)...)...)
+		})
+	}
+}
+
+func TestCatFileExists(t *testing.T) {
+	dir := catFileRepo(t)
+
+	for _, name := range []string{"HEAD:d/c", "v1", "0123456789012345678901234567890123456789"} {
+		want := run(t, dir, "", "git", "cat-file", "-e", name)
+		if got := gogit(t, dir, "cat-file", "-e", name); got.code != want.code || got.stdout != "" {
+			t.Errorf("gogit cat-file -e %s exited with %d and wrote %q, want as git %d", name, got.code, got.stdout, want.code)
+		}
+	}
+}
+
+func TestCatFileBatch(t *testing.T) {
+	dir := catFileRepo(t)
+
+	input := strings.Join([]string{
+		"HEAD",
+		"v1",
+		"HEAD:d",
+		"HEAD~1:a",
+		"nope",
+		"HEAD:nope",
+		"HEAD:d/c",
+		gitCmd(t, dir, "rev-parse", "HEAD:a"),
+	}, "\n") + "\n"
+
+	for _, args := range [][]string{
+		{"--batch"},
+		{"--batch-check"},
+		{"--batch-check=%(objecttype) %(objectname) %(objectsize) %(rest)"},
+		{"--batch=%(objectname) %(objecttype)"},
+		{"--batch-check", "--buffer"},
+	} {
+		a := append([]string{"cat-file"}, args...)
+
+		want := run(t, dir, input, "git", a...)
+		if got := gogitStdin(t, dir, input, a...); got.stdout != want.stdout || got.code != want.code {
+			t.Errorf("gogit %v exited with %d:\n%s\nwant, as git, %d:\n%s", a, got.code, got.stdout, want.code, want.stdout)
+		}
+	}
+
+	// %(rest) keeps what follows the object name.
+	rest := "HEAD some text\nv1\tx\n"
+	args := []string{"cat-file", "--batch-check=%(objectname) [%(rest)]"}
+
+	if got, want := gogitStdin(t, dir, rest, args...), run(t, dir, rest, "git", args...); got.stdout != want.stdout {
+		t.Errorf("gogit %v gave:\n%s\nwant, as git:\n%s", args, got.stdout, want.stdout)
+	}
+}
+
+func TestCatFileBatchAllObjects(t *testing.T) {
+	dir := catFileRepo(t)
+
+	sameOutput(t, dir, "cat-file", "--batch-all-objects", "--batch-check")
+	sameOutput(t, dir, "cat-file", "--batch-all-objects", "--batch=%(objectname) %(objecttype)")
+
+	args := []string{"cat-file", "--batch-all-objects", "--batch-check", "--unordered"}
+
+	got, want := gogit(t, dir, args...), run(t, dir, "", "git", args...)
+	if g, w := strings.Join(sortedLines(got.stdout), "\n"), strings.Join(sortedLines(want.stdout), "\n"); g != w {
+		t.Errorf("gogit %v listed:\n%s\nwant, as git, in any order:\n%s", args, g, w)
+	}
+}
+
+// TestCatFileBatchStreaming checks that --batch answers each object name
+// as it is read, so that it can serve a long running client.
+func TestCatFileBatchStreaming(t *testing.T) {
+	dir := catFileRepo(t)
+
+	cmd := exec.Command(os.Args[0], "cat-file", "--batch-check")
+	cmd.Dir = dir
+	cmd.Env = testEnv()
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := bufio.NewReader(stdout)
+
+	for _, name := range []string{"HEAD", "v1", "nope"} {
+		_, err = io.WriteString(stdin, name+"\n")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		line, err := out.ReadString('\n')
+		if err != nil {
+			t.Fatalf("no answer for %s: %v", name, err)
+		}
+
+		want := run(t, dir, name+"\n", "git", "cat-file", "--batch-check").stdout
+		if line != want {
+			t.Errorf("gogit answered %q for %s, want as git %q", line, name, want)
+		}
+	}
+
+	stdin.Close()
+
+	err = cmd.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
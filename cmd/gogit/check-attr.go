@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/spf13/cobra"
+)
+
+var (
+	checkAttrAll    bool
+	checkAttrCached bool
+)
+
+func init() {
+	checkAttrCmd.Flags().BoolVarP(&checkAttrAll, "all", "a", false, "Report all the attributes set on the files")
+	checkAttrCmd.Flags().BoolVarP(&checkAttrCached, "cached", "", false, "Only consider the .gitattributes files of the index")
+	rootCmd.AddCommand(checkAttrCmd)
+}
+
+var checkAttrCmd = &cobra.Command{
+	Use:   "check-attr [--cached] (-a | <attr>...) [--] <pathname>...",
+	Short: "Display gitattributes information",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		attrs, paths, err := checkAttrArgs(args, cmd.ArgsLenAtDash())
+		if err != nil {
+			return err
+		}
+
+		r, err := git.PlainOpenWithOptions(".", &git.PlainOpenOptions{DetectDotGit: true})
+		if err != nil {
+			return err
+		}
+
+		source := attrCheckin
+		if checkAttrCached {
+			source = attrIndex
+		}
+
+		c, err := newAttrChecker(r, source, cmd.ErrOrStderr())
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+
+		for _, p := range paths {
+			values := c.attributes(worktreePath(r, p))
+
+			if checkAttrAll {
+				for _, name := range c.names {
+					v, ok := values[name]
+					if ok && v != attrUnspecified {
+						fmt.Fprintf(out, "%s: %s: %s\n", quotePath(p), name, attrString(v, ok))
+					}
+				}
+
+				continue
+			}
+
+			for _, name := range attrs {
+				v, ok := values[name]
+				fmt.Fprintf(out, "%s: %s: %s\n", quotePath(p), name, attrString(v, ok))
+			}
+		}
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// checkAttrArgs splits the arguments into attribute names and paths. They
+// are separated by "--", or else only the first argument is an attribute.
+func checkAttrArgs(args []string, dash int) ([]string, []string, error) {
+	var attrs, paths []string
+
+	switch {
+	case checkAttrAll && dash > 0:
+		return nil, nil, errors.New("cannot give attribute names with --all")
+	case checkAttrAll:
+		paths = args
+	case dash == 0 || len(args) == 0:
+		return nil, nil, errors.New("no attribute specified")
+	case dash < 0:
+		attrs, paths = args[:1], args[1:]
+	default:
+		attrs, paths = args[:dash], args[dash:]
+	}
+
+	for _, a := range attrs {
+		if !validAttrName(a) {
+			return nil, nil, fmt.Errorf("%s: not a valid attribute name", a)
+		}
+	}
+
+	if len(paths) == 0 {
+		return nil, nil, errors.New("no file specified")
+	}
+
+	return attrs, paths, nil
+}
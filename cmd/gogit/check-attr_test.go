@@ -0,0 +1,63 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// attrRepo returns a repository made by git with attributes set, unset,
+// given values and left unspecified by .gitattributes files at the top
+// and in a subdirectory, with a macro and info/attributes.
+func attrRepo(t *testing.T) string {
+	t.Helper()
+
+	dir := gitRepo(t, []string{
+		".gitattributes", "[attr]mine text -diff\n*.txt text eol=crlf\n*.bin binary\nnotes.txt -text !eol\nsub/** foo=bar\n*.m mine\n",
+		"sub/.gitattributes", "*.txt eol=lf whitespace\n",
+		"a.txt", "1",
+	})
+
+	writeFile(t, dir, ".git/info/attributes", "*.bin eol=crlf\n")
+
+	return dir
+}
+
+func TestCheckAttr(t *testing.T) {
+	dir := attrRepo(t)
+
+	for _, args := range []string{
+		"text a.txt",
+		"text eol -- a.txt notes.txt sub/b.txt x.bin",
+		"diff merge text -- x.bin y.m",
+		"foo -- sub/deep/x sub x",
+		"-a a.txt notes.txt sub/b.txt x.bin y.m other",
+		"--all -- sub/b.txt",
+		"binary x.bin",
+		"mine y.m",
+		"whitespace sub/x.txt",
+	} {
+		t.Run(args, func(t *testing.T) {
+			sameOutput(t, dir, append([]string{"check-attr"}, strings.Fields(args)...)...)
+		})
+	}
+
+	// Paths are relative to the current directory.
+	sameOutput(t, filepath.Join(dir, "sub"), "check-attr", "eol", "foo", "--", "b.txt", "../a.txt")
+}
+
+// TestCheckAttrCached checks that --cached reads the .gitattributes files
+// of the index, not those of the working tree.
+func TestCheckAttrCached(t *testing.T) {
+	dir := attrRepo(t)
+	writeFile(t, dir, ".gitattributes", "*.txt -text\n")
+	writeFile(t, dir, "sub/.gitattributes", "")
+
+	for _, args := range []string{
+		"text eol -- a.txt sub/b.txt",
+		"--cached text eol -- a.txt sub/b.txt",
+		"--cached -a sub/b.txt",
+	} {
+		sameOutput(t, dir, append([]string{"check-attr"}, strings.Fields(args)...)...)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/format/index"
+	"github.com/spf13/cobra"
+)
+
+var (
+	checkIgnoreVerbose bool
+	checkIgnoreNoIndex bool
+	checkIgnoreStdin   bool
+)
+
+func init() {
+	checkIgnoreCmd.Flags().BoolVarP(&checkIgnoreVerbose, "verbose", "v", false, "Show the exclude pattern matching each path")
+	checkIgnoreCmd.Flags().BoolVarP(&checkIgnoreNoIndex, "no-index", "", false, "Do not look in the index when checking")
+	checkIgnoreCmd.Flags().BoolVarP(&checkIgnoreStdin, "stdin", "", false, "Read the paths from the standard input, one per line")
+	rootCmd.AddCommand(checkIgnoreCmd)
+}
+
+var checkIgnoreCmd = &cobra.Command{
+	Use:   "check-ignore [-v] [--no-index] (--stdin | <pathname>...)",
+	Short: "Debug gitignore / exclude files",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		switch {
+		case checkIgnoreStdin && len(args) > 0:
+			return errors.New("cannot specify pathnames with --stdin")
+		case !checkIgnoreStdin && len(args) == 0:
+			return errors.New("no path specified")
+		}
+
+		r, err := git.PlainOpenWithOptions(".", &git.PlainOpenOptions{DetectDotGit: true})
+		if err != nil {
+			return err
+		}
+
+		c, err := newIgnoreChecker(r)
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		ignored := 0
+
+		if checkIgnoreStdin {
+			ignored, err = c.checkStdin(out, cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+		} else {
+			for _, p := range args {
+				if c.check(out, p) {
+					ignored++
+				}
+			}
+		}
+
+		if ignored == 0 {
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+
+			return exitStatus(1)
+		}
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// ignoreChecker finds the rule deciding whether a path is ignored, among
+// the standard ignore rules of the worktree.
+type ignoreChecker struct {
+	r     *git.Repository
+	fs    billy.Filesystem
+	idx   *index.Index
+	rules ignoreRules
+}
+
+func newIgnoreChecker(r *git.Repository) (*ignoreChecker, error) {
+	w, err := r.Worktree()
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index: %w", err)
+	}
+
+	rules, err := standardIgnoreRules(r, w)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ignoreChecker{r: r, fs: w.Filesystem, idx: idx, rules: rules}, nil
+}
+
+// check prints the path, relative to the current directory, if it is
+// ignored, or with -v if any pattern matches it, and reports whether it
+// was printed.
+func (c *ignoreChecker) check(out io.Writer, p string) bool {
+	name := worktreePath(c.r, p)
+
+	var rule *ignoreRule
+	if checkIgnoreNoIndex || !c.tracked(name) {
+		rule = c.lookup(name)
+	}
+
+	if rule == nil || (rule.negative() && !checkIgnoreVerbose) {
+		return false
+	}
+
+	if checkIgnoreVerbose {
+		fmt.Fprintf(out, "%s:%d:%s\t%s\n", quotePath(rule.src), rule.line, rule.text, quotePath(p))
+	} else {
+		fmt.Fprintln(out, quotePath(p))
+	}
+
+	return true
+}
+
+// checkStdin checks the paths read from in, one per line, the quoted ones
+// being unquoted, and returns the number of those printed.
+func (c *ignoreChecker) checkStdin(out io.Writer, in io.Reader) (int, error) {
+	ignored := 0
+
+	lines := bufio.NewScanner(in)
+	for lines.Scan() {
+		p := strings.TrimSuffix(lines.Text(), "\r")
+
+		if strings.HasPrefix(p, `"`) {
+			unquoted, err := strconv.Unquote(p)
+			if err != nil {
+				return ignored, fmt.Errorf("line is badly quoted: %s", p)
+			}
+
+			p = unquoted
+		}
+
+		if c.check(out, p) {
+			ignored++
+		}
+	}
+
+	return ignored, lines.Err()
+}
+
+// tracked reports whether the path, or a file below it, is in the index.
+func (c *ignoreChecker) tracked(p string) bool {
+	dir := strings.TrimSuffix(p, "/") + "/"
+
+	for _, e := range c.idx.Entries {
+		if !e.SkipWorktree && (e.Name == p || strings.HasPrefix(e.Name, dir)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lookup returns the rule deciding whether the path is ignored, if any. A
+// path is ignored when one of its leading directories is.
+func (c *ignoreChecker) lookup(p string) *ignoreRule {
+	parts := strings.Split(p, "/")
+
+	for i := 1; i < len(parts); i++ {
+		rule := c.rules.lookup(parts[:i], true)
+		if rule != nil && !rule.negative() {
+			return rule
+		}
+	}
+
+	return c.rules.lookup(parts, c.isDir(p))
+}
+
+// isDir reports whether the path is a directory, as the index or else the
+// worktree tells.
+func (c *ignoreChecker) isDir(p string) bool {
+	dir := p + "/"
+
+	for _, e := range c.idx.Entries {
+		switch {
+		case e.Name == p:
+			return e.Mode == filemode.Submodule
+		case strings.HasPrefix(e.Name, dir):
+			return true
+		}
+	}
+
+	fi, err := c.fs.Lstat(p)
+
+	return err == nil && fi.IsDir()
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ignoreRepo returns a repository made by git with ignore rules at the
+// top, in a subdirectory and in info/exclude: directory patterns,
+// negations, anchored and nested patterns, and an ignored file that is
+// tracked.
+func ignoreRepo(t *testing.T) string {
+	t.Helper()
+
+	dir := gitRepo(t, []string{
+		".gitignore", "*.log\n!keep.log\n/build/\ntmp*\n# a comment\n\\#hash\ndocs/**/*.pdf\n",
+		"sub/.gitignore", "*.o\n!important.o\nlocal\n",
+		"tracked.log", "1",
+	})
+
+	writeFile(t, dir, ".git/info/exclude", "*.swp\n")
+
+	return dir
+}
+
+func TestCheckIgnore(t *testing.T) {
+	dir := ignoreRepo(t)
+
+	for _, args := range []string{
+		"a.log",
+		"a.log keep.log build build/x sub/build tmpfile sub/tmpdir/x",
+		"#hash docs/a/b/c.pdf docs/c.pdf x.pdf",
+		"sub/a.o sub/important.o sub/local a.o local sub/deeper/local",
+		".x.swp sub/y.swp",
+		"-v a.log keep.log build/x sub/a.o sub/important.o x.swp #hash",
+		"tracked.log",
+		"--no-index tracked.log",
+		"-v --no-index tracked.log sub/local",
+		"nothing",
+	} {
+		t.Run(args, func(t *testing.T) {
+			a := append([]string{"check-ignore"}, strings.Fields(args)...)
+
+			want := run(t, dir, "", "git", a...)
+			if got := gogit(t, dir, a...); got.stdout != want.stdout || got.code != want.code {
+				t.Errorf("gogit %v exited with %d:\n%s\nwant, as git, %d:\n%s", a, got.code, got.stdout, want.code, want.stdout)
+			}
+		})
+	}
+}
+
+func TestCheckIgnoreStdin(t *testing.T) {
+	dir := ignoreRepo(t)
+
+	input := "a.log\nkeep.log\nsub/a.o\nnothing\nbuild/x\n"
+
+	for _, args := range [][]string{
+		{"check-ignore", "--stdin"},
+		{"check-ignore", "--stdin", "-v"},
+	} {
+		want := run(t, dir, input, "git", args...)
+		if got := gogitStdin(t, dir, input, args...); got.stdout != want.stdout || got.code != want.code {
+			t.Errorf("gogit %v exited with %d:\n%s\nwant, as git, %d:\n%s", args, got.code, got.stdout, want.code, want.stdout)
+		}
+	}
+}
+
+// TestCheckIgnoreSubdirectory checks that paths are taken relative to the
+// current directory, and shown as given.
+func TestCheckIgnoreSubdirectory(t *testing.T) {
+	dir := ignoreRepo(t)
+
+	for _, args := range [][]string{
+		{"check-ignore", "a.o", "local", "../a.log", "x.c"},
+		{"check-ignore", "-v", "a.o", "../keep.log", "../b.log"},
+	} {
+		want := run(t, filepath.Join(dir, "sub"), "", "git", args...)
+		if got := gogit(t, filepath.Join(dir, "sub"), args...); got.stdout != want.stdout || got.code != want.code {
+			t.Errorf("gogit %v exited with %d:\n%s\nwant, as git, %d:\n%s", args, got.code, got.stdout, want.code, want.stdout)
+		}
+	}
+}
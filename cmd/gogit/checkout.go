@@ -0,0 +1,570 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/index"
+	"github.com/go-git/go-git/v6/plumbing/format/reflog"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/spf13/cobra"
+)
+
+var (
+	checkoutNewBranch         string
+	checkoutForce             bool
+	checkoutDetach            bool
+	checkoutRecurseSubmodules bool
+)
+
+func init() {
+	checkoutCmd.Flags().StringVarP(&checkoutNewBranch, "branch", "b", "", "Create a new branch and switch to it")
+	checkoutCmd.Flags().BoolVarP(&checkoutForce, "force", "f", false, "Throw away local modifications")
+	checkoutCmd.Flags().BoolVarP(&checkoutDetach, "detach", "", false, "Detach HEAD at the named commit")
+	checkoutCmd.Flags().BoolVarP(&checkoutRecurseSubmodules, "recurse-submodules", "", false, "Update checked out submodules to the recorded commits")
+	rootCmd.AddCommand(checkoutCmd)
+}
+
+var checkoutCmd = &cobra.Command{
+	Use:   "checkout [-f] [--detach] [--recurse-submodules] [-b <new-branch>] [<branch> | <commit>]",
+	Short: "Switch branches or detach HEAD at a commit",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if checkoutNewBranch == "" && len(args) == 0 {
+			return errors.New("you must specify a branch or commit to checkout")
+		}
+
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		opts := git.CheckoutOptions{Force: checkoutForce}
+		startPoint := plumbing.HEAD.String()
+		target := ""
+		msg := ""
+		track := false
+
+		switch {
+		case checkoutNewBranch != "":
+			if len(args) > 0 {
+				startPoint = args[0]
+			}
+
+			h, err := resolveRevision(r, startPoint)
+			if err != nil {
+				return fmt.Errorf("invalid reference '%s': %w", startPoint, err)
+			}
+
+			opts.Branch = plumbing.NewBranchReferenceName(checkoutNewBranch)
+			opts.Hash = h
+			opts.Create = true
+			target = checkoutNewBranch
+			msg = fmt.Sprintf("Switched to a new branch '%s'", checkoutNewBranch)
+		case !checkoutDetach && hasReference(r, plumbing.NewBranchReferenceName(args[0])):
+			opts.Branch = plumbing.NewBranchReferenceName(args[0])
+			target = args[0]
+			msg = fmt.Sprintf("Switched to branch '%s'", args[0])
+		case !checkoutDetach && hasReference(r, plumbing.NewRemoteReferenceName(git.DefaultRemoteName, args[0])):
+			// Like git, a branch that only exists on origin is created
+			// locally and set up to track it.
+			remote := plumbing.NewRemoteReferenceName(git.DefaultRemoteName, args[0])
+
+			ref, err := r.Reference(remote, true)
+			if err != nil {
+				return err
+			}
+
+			opts.Branch = plumbing.NewBranchReferenceName(args[0])
+			opts.Hash = ref.Hash()
+			opts.Create = true
+			startPoint = remote.Short()
+			target = args[0]
+			track = true
+			msg = fmt.Sprintf("branch '%s' set up to track '%s'.\nSwitched to a new branch '%s'", args[0], remote.Short(), args[0])
+		default:
+			c, err := resolveCommit(r, args[0])
+			if err != nil {
+				return err
+			}
+
+			opts.Hash = c.Hash
+			target = args[0]
+			msg = fmt.Sprintf("HEAD is now at %s %s", c.Hash.String()[:7], commitSubject(c))
+		}
+
+		var from plumbing.Hash
+		if head, err := r.Head(); err == nil {
+			from = head.Hash()
+		}
+
+		hs := newHooks(r, cmd.ErrOrStderr())
+
+		err = checkoutHead(hs, &opts, target, startPoint)
+		if err != nil {
+			return err
+		}
+
+		// The branch is only set up to track once it exists, so that a
+		// refused checkout leaves no configuration behind.
+		if track {
+			err = trackBranch(r, target, git.DefaultRemoteName)
+			if err != nil {
+				return err
+			}
+		}
+
+		if checkoutRecurseSubmodules {
+			err = checkoutSubmodules(r)
+			if err != nil {
+				return err
+			}
+		}
+
+		fmt.Fprintln(cmd.ErrOrStderr(), msg)
+
+		head, err := r.Head()
+		if err != nil {
+			return err
+		}
+
+		err = hs.postCheckout(from, head.Hash(), "1")
+		if err != nil {
+			return hookFailed(cmd, err)
+		}
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// checkoutHead checks out opts and records the move of HEAD to target in
+// the reflog. A branch created by the checkout is recorded as created
+// from startPoint. The references are only updated once the worktree is,
+// and the reference-transaction hook has accepted them.
+func checkoutHead(hs *hooks, opts *git.CheckoutOptions, target, startPoint string) error {
+	r := hs.r
+
+	w, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+
+	from, err := r.Reference(plumbing.HEAD, false)
+	if err != nil {
+		return fmt.Errorf("failed to get HEAD: %w", err)
+	}
+
+	before, err := snapshotRefs(r)
+	if err != nil {
+		return err
+	}
+
+	sparse, err := loadSparseCheckout(r)
+	if err != nil {
+		return err
+	}
+
+	local, force, err := carryLocalChanges(r, w, opts, hs.errOut)
+	if err != nil {
+		return err
+	}
+
+	pending, err := holdRefUpdates(r)
+	if err != nil {
+		return err
+	}
+
+	move := *opts
+	if len(local) > 0 || force {
+		// go-git resets the index, or refuses a worktree with changes,
+		// where git carries them; they are put back once checked out.
+		move.Force = true
+	}
+
+	err = sparse.checkout(w, &move)
+	if err != nil {
+		// go-git creates the branch and moves HEAD before it checks the
+		// worktree, so the updates of a refused checkout are dropped.
+		pending.discard()
+
+		return fmt.Errorf("failed to checkout: %w", err)
+	}
+
+	if move.Force {
+		err = removeDroppedFiles(r, w, before[plumbing.HEAD])
+		if err != nil {
+			return err
+		}
+	}
+
+	err = restoreLocalChanges(r, w, local)
+	if err != nil {
+		return err
+	}
+
+	err = pending.commit(hs, before)
+	if err != nil {
+		return err
+	}
+
+	// Full patterns, and the paths cone mode prefixes match beyond the
+	// sparse checkout, are only applied once checked out.
+	if sparse.enabled {
+		err = sparse.apply(hs.errOut)
+		if err != nil {
+			return err
+		}
+	}
+
+	head, err := r.Head()
+	if err != nil {
+		return err
+	}
+
+	changed, err := checkedOutPaths(r, before[plumbing.HEAD], head.Hash())
+	if err != nil {
+		return err
+	}
+
+	err = smudgeWorktree(r, hs.errOut, changed)
+	if err != nil {
+		return err
+	}
+
+	moving := fmt.Sprintf("checkout: moving from %s to %s", checkoutName(from), target)
+
+	err = logRefUpdates(hs, before, func(name plumbing.ReferenceName, _, _ plumbing.Hash) string {
+		if name == plumbing.HEAD {
+			return moving
+		}
+
+		return "branch: Created from " + startPoint
+	})
+	if err != nil {
+		return err
+	}
+
+	// Switching between branches at the same commit leaves HEAD's hash
+	// unchanged, but git still records the move.
+	if head.Hash() != before[plumbing.HEAD] {
+		return nil
+	}
+
+	rs, ok := r.Storer.(storer.ReflogStorer)
+	if !ok {
+		return nil
+	}
+
+	return rs.AppendReflog(plumbing.HEAD, &reflog.Entry{
+		OldHash:   head.Hash(),
+		NewHash:   head.Hash(),
+		Committer: reflogSignature(r),
+		Message:   moving,
+	})
+}
+
+// localChange is a path changed in the index or the worktree, as it was
+// before a checkout.
+type localChange struct {
+	path  string
+	entry *index.Entry
+	data  []byte
+	mode  os.FileMode
+	found bool
+}
+
+// carryLocalChanges returns the local changes a checkout of opts keeps, as
+// git does. Unless forced, it refuses the checkout when a changed path, or
+// an untracked file, differs from the target. force reports whether go-git
+// must be forced for it not to refuse smudged files it takes for changes;
+// those the checkout leaves are carried too.
+func carryLocalChanges(r *git.Repository, w *git.Worktree, opts *git.CheckoutOptions, errOut io.Writer) ([]*localChange, bool, error) {
+	if opts.Force {
+		return nil, false, nil
+	}
+
+	status, err := w.Status()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get status: %w", err)
+	}
+
+	clean, err := cleanSmudged(r, status, errOut)
+	if err != nil {
+		return nil, false, err
+	}
+
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read index: %w", err)
+	}
+
+	var changed, untracked, smudged []string
+
+	for path, s := range status {
+		switch {
+		case isSkipWorktree(idx, path):
+			// Paths outside a sparse checkout are not local changes.
+		case s.Staging == git.Untracked:
+			untracked = append(untracked, path)
+		case clean[path] && s.Staging == git.Unmodified:
+			smudged = append(smudged, path)
+		case s.Staging != git.Unmodified || s.Worktree != git.Unmodified:
+			changed = append(changed, path)
+		}
+	}
+
+	if len(changed) == 0 && len(untracked) == 0 && len(smudged) == 0 {
+		return nil, false, nil
+	}
+
+	target := opts.Hash
+	if target.IsZero() {
+		ref, err := r.Reference(opts.Branch, true)
+		if err != nil {
+			return nil, false, err
+		}
+
+		target = ref.Hash()
+	}
+
+	head, err := checkoutTree(r, plumbing.HEAD)
+	if err != nil {
+		return nil, false, err
+	}
+
+	to, err := r.CommitObject(target)
+	if err != nil {
+		return nil, false, err
+	}
+
+	toTree, err := to.Tree()
+	if err != nil {
+		return nil, false, err
+	}
+
+	sort.Strings(changed)
+	sort.Strings(untracked)
+
+	var overwritten []string
+
+	for _, path := range changed {
+		if !sameTreeEntry(head, toTree, path) {
+			overwritten = append(overwritten, path)
+		}
+	}
+
+	if len(overwritten) > 0 {
+		return nil, false, fmt.Errorf("your local changes to the following files would be overwritten by checkout:\n\t%s\nPlease commit your changes or stash them before you switch branches", strings.Join(overwritten, "\n\t"))
+	}
+
+	for _, path := range untracked {
+		if _, err := toTree.FindEntry(path); err == nil {
+			overwritten = append(overwritten, path)
+		}
+	}
+
+	if len(overwritten) > 0 {
+		return nil, false, fmt.Errorf("the following untracked working tree files would be overwritten by checkout:\n\t%s\nPlease move or remove them before you switch branches", strings.Join(overwritten, "\n\t"))
+	}
+
+	for _, path := range smudged {
+		if sameTreeEntry(head, toTree, path) {
+			changed = append(changed, path)
+		}
+	}
+
+	fs := w.Filesystem
+
+	local := make([]*localChange, 0, len(changed))
+
+	for _, path := range changed {
+		c := &localChange{path: path}
+
+		if e, err := idx.Entry(path); err == nil {
+			saved := *e
+			c.entry = &saved
+		}
+
+		fi, err := fs.Lstat(path)
+		if err == nil {
+			c.found, c.mode = true, fi.Mode()
+
+			if fi.Mode()&os.ModeSymlink != 0 {
+				target, err := fs.Readlink(path)
+				if err != nil {
+					return nil, false, err
+				}
+
+				c.data = []byte(target)
+			} else {
+				c.data, err = util.ReadFile(fs, path)
+				if err != nil {
+					return nil, false, err
+				}
+			}
+		}
+
+		local = append(local, c)
+	}
+
+	return local, len(smudged) > 0, nil
+}
+
+func isSkipWorktree(idx *index.Index, path string) bool {
+	e, err := idx.Entry(path)
+
+	return err == nil && e.SkipWorktree
+}
+
+// removeDroppedFiles removes the files of the commit from that the index
+// no longer has. go-git moves HEAD before it resets the worktree to it, so
+// a forced checkout keeps them.
+func removeDroppedFiles(r *git.Repository, w *git.Worktree, from plumbing.Hash) error {
+	head, err := r.Head()
+	if err != nil {
+		return fmt.Errorf("failed to get HEAD: %w", err)
+	}
+
+	paths, err := checkedOutPaths(r, from, head.Hash())
+	if err != nil {
+		return err
+	}
+
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return fmt.Errorf("failed to read index: %w", err)
+	}
+
+	for path := range paths {
+		if _, err := idx.Entry(path); err == nil {
+			continue
+		}
+
+		fi, err := w.Filesystem.Lstat(path)
+		if err != nil || fi.IsDir() {
+			continue
+		}
+
+		err = removeTrackedFile(w.Filesystem, path)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// restoreLocalChanges puts the local changes back in the index and the
+// worktree after a checkout.
+func restoreLocalChanges(r *git.Repository, w *git.Worktree, local []*localChange) error {
+	if len(local) == 0 {
+		return nil
+	}
+
+	fs := w.Filesystem
+
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return fmt.Errorf("failed to read index: %w", err)
+	}
+
+	for _, c := range local {
+		_, _ = idx.Remove(c.path)
+		if c.entry != nil {
+			idx.Entries = append(idx.Entries, c.entry)
+		}
+
+		_ = fs.Remove(c.path)
+
+		switch {
+		case !c.found:
+		case c.mode&os.ModeSymlink != 0:
+			err = fs.Symlink(string(c.data), c.path)
+		default:
+			err = util.WriteFile(fs, c.path, c.data, c.mode.Perm())
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to restore %s: %w", c.path, err)
+		}
+	}
+
+	sort.Slice(idx.Entries, func(i, j int) bool { return idx.Entries[i].Name < idx.Entries[j].Name })
+
+	return r.Storer.SetIndex(idx)
+}
+
+// checkoutTree returns the tree of the commit ref points at, or an empty
+// tree when ref is unborn.
+func checkoutTree(r *git.Repository, ref plumbing.ReferenceName) (*object.Tree, error) {
+	head, err := r.Reference(ref, true)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return &object.Tree{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := r.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Tree()
+}
+
+// sameTreeEntry reports whether path is the same in the trees a and b.
+func sameTreeEntry(a, b *object.Tree, path string) bool {
+	ea, errA := a.FindEntry(path)
+	eb, errB := b.FindEntry(path)
+
+	if errA != nil || errB != nil {
+		return errA != nil && errB != nil
+	}
+
+	return ea.Hash == eb.Hash && ea.Mode == eb.Mode
+}
+
+// checkoutName returns how git names the target of HEAD in checkout
+// reflog messages.
+func checkoutName(ref *plumbing.Reference) string {
+	if ref.Type() == plumbing.SymbolicReference {
+		return ref.Target().Short()
+	}
+
+	return ref.Hash().String()
+}
+
+// trackBranch configures branch to follow the branch of the same name on
+// remote.
+func trackBranch(r *git.Repository, branch, remote string) error {
+	cfg, err := r.Config()
+	if err != nil {
+		return fmt.Errorf("failed to get repository config: %w", err)
+	}
+
+	cfg.Branches[branch] = &config.Branch{
+		Name:   branch,
+		Remote: remote,
+		Merge:  plumbing.NewBranchReferenceName(branch),
+	}
+
+	return r.SetConfig(cfg)
+}
+
+func hasReference(r *git.Repository, name plumbing.ReferenceName) bool {
+	_, err := r.Reference(name, false)
+
+	return err == nil
+}
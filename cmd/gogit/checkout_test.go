@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestCheckoutLocalChanges checks that checkout carries the changes of
+// the index and the worktree to the branch it switches to, and refuses
+// to overwrite them, as git does.
+func TestCheckoutLocalChanges(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		args  []string
+		setup func(t *testing.T, dir string)
+	}{
+		{"new branch", []string{"checkout", "-b", "topic"}, func(t *testing.T, dir string) {
+			writeFile(t, dir, "a", "3")
+			gitCmd(t, dir, "add", "a")
+			writeFile(t, dir, "b", "changed")
+		}},
+		{"carried", []string{"checkout", "other"}, func(t *testing.T, dir string) {
+			writeFile(t, dir, "a", "3")
+			writeFile(t, dir, "c", "added")
+			gitCmd(t, dir, "add", "c")
+		}},
+		{"overwritten", []string{"checkout", "other"}, func(t *testing.T, dir string) {
+			writeFile(t, dir, "b", "changed")
+		}},
+		{"untracked", []string{"checkout", "other"}, func(t *testing.T, dir string) {
+			writeFile(t, dir, "d", "untracked")
+		}},
+		{"forced", []string{"checkout", "-f", "other"}, func(t *testing.T, dir string) {
+			writeFile(t, dir, "a", "3")
+			writeFile(t, dir, "b", "changed")
+		}},
+		{"forced, dropping files", []string{"checkout", "-f", "main"}, func(t *testing.T, dir string) {
+			gitCmd(t, dir, "checkout", "-q", "other")
+			writeFile(t, dir, "a", "3")
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var states []string
+
+			for _, tool := range []string{"git", "gogit"} {
+				dir := gitRepo(t, []string{"a", "1", "b", "1"})
+				gitCmd(t, dir, "checkout", "-q", "-b", "other")
+				writeFile(t, dir, "b", "2")
+				writeFile(t, dir, "d", "2")
+				gitCmd(t, dir, "add", "b", "d")
+				gitCmd(t, dir, "commit", "-q", "-m", "other")
+				gitCmd(t, dir, "checkout", "-q", "main")
+
+				tc.setup(t, dir)
+
+				var res result
+				if tool == "git" {
+					res = run(t, dir, "", "git", tc.args...)
+				} else {
+					res = gogit(t, dir, tc.args...)
+				}
+
+				states = append(states, fmt.Sprintf("exit %v\n%s%s", res.code == 0,
+					gitCmd(t, dir, "branch", "--show-current"), gitCmd(t, dir, "status", "--short")))
+			}
+
+			if states[1] != states[0] {
+				t.Errorf("gogit %v left:\n%s\nwant, as git:\n%s", tc.args, states[1], states[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing/format/gitignore"
+	"github.com/spf13/cobra"
+)
+
+var (
+	cleanDryRun      bool
+	cleanForce       int
+	cleanDirs        bool
+	cleanIgnored     bool
+	cleanOnlyIgnored bool
+	cleanQuiet       bool
+	cleanInteractive bool
+	cleanExcludes    []string
+)
+
+func init() {
+	cleanCmd.Flags().BoolVarP(&cleanDryRun, "dry-run", "n", false, "Only show what would be removed")
+	cleanCmd.Flags().CountVarP(&cleanForce, "force", "f", "Remove files; given twice, also remove nested repositories")
+	cleanCmd.Flags().BoolVarP(&cleanDirs, "dirs", "d", false, "Recurse into untracked directories and remove them")
+	cleanCmd.Flags().BoolVarP(&cleanIgnored, "ignored", "x", false, "Do not use the standard ignore rules")
+	cleanCmd.Flags().BoolVarP(&cleanOnlyIgnored, "only-ignored", "X", false, "Remove only files ignored by git")
+	cleanCmd.Flags().BoolVarP(&cleanQuiet, "quiet", "q", false, "Only report errors")
+	cleanCmd.Flags().BoolVarP(&cleanInteractive, "interactive", "i", false, "Confirm each removal")
+	cleanCmd.Flags().StringArrayVarP(&cleanExcludes, "exclude", "e", nil, "Add <pattern> to the ignore rules")
+	rootCmd.AddCommand(cleanCmd)
+}
+
+var cleanCmd = &cobra.Command{
+	Use:   "clean [-d] [-f] [-i] [-n] [-q] [-e <pattern>] [-x | -X] [--] [<pathspec>...]",
+	Short: "Remove untracked files from the working tree",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if cleanIgnored && cleanOnlyIgnored {
+			return errors.New("-x and -X cannot be used together")
+		}
+
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		cfg, err := r.Config()
+		if err != nil {
+			return fmt.Errorf("failed to get repository config: %w", err)
+		}
+
+		requireForce := true
+		if v := configOption(cfg, "clean", "requireforce"); v != "" {
+			requireForce, err = strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("invalid clean.requireForce value %q: %w", v, err)
+			}
+		}
+
+		if requireForce && cleanForce == 0 && !cleanDryRun && !cleanInteractive {
+			return errors.New("clean.requireForce is true and -f not given: refusing to clean")
+		}
+
+		w, err := r.Worktree()
+		if err != nil {
+			return err
+		}
+
+		c, err := newCleaner(r, w, args)
+		if err != nil {
+			return err
+		}
+
+		items, _, err := c.collect("", true)
+		if err != nil {
+			return err
+		}
+
+		sort.Slice(items, func(i, j int) bool { return items[i].path < items[j].path })
+
+		return c.remove(cmd.InOrStdin(), cmd.OutOrStdout(), items)
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// cleanItem is a path selected for removal by clean.
+type cleanItem struct {
+	path string
+	dir  bool
+}
+
+func (i cleanItem) String() string {
+	if i.dir {
+		return i.path + "/"
+	}
+
+	return i.path
+}
+
+// cleaner selects the untracked paths of a worktree to be removed,
+// following the rules of git clean.
+type cleaner struct {
+	fs          billy.Filesystem
+	tracked     map[string]bool
+	trackedDirs map[string]bool
+	ignore      ignoreRules
+	excludes    []gitignore.Pattern
+	pathspecs   []string
+}
+
+func newCleaner(r *git.Repository, w *git.Worktree, pathspecs []string) (*cleaner, error) {
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index: %w", err)
+	}
+
+	c := &cleaner{
+		fs:          w.Filesystem,
+		tracked:     make(map[string]bool, len(idx.Entries)),
+		trackedDirs: make(map[string]bool),
+	}
+
+	for _, e := range idx.Entries {
+		c.tracked[e.Name] = true
+
+		for dir := path.Dir(e.Name); dir != "."; dir = path.Dir(dir) {
+			c.trackedDirs[dir] = true
+		}
+	}
+
+	c.ignore, err = standardIgnoreRules(r, w)
+	if err != nil {
+		return nil, err
+	}
+
+	c.excludes = make([]gitignore.Pattern, 0, len(cleanExcludes))
+	for _, e := range cleanExcludes {
+		c.excludes = append(c.excludes, gitignore.ParsePattern(e, nil))
+	}
+
+	for _, p := range pathspecs {
+		p = strings.TrimSuffix(path.Clean(p), "/")
+		if p == "." {
+			continue
+		}
+
+		c.pathspecs = append(c.pathspecs, p)
+	}
+
+	return c, nil
+}
+
+// collect returns the removable paths below dir. It also reports whether
+// everything below dir is removable, so that untracked directories can be
+// removed as a whole.
+func (c *cleaner) collect(dir string, tracked bool) ([]cleanItem, bool, error) {
+	entries, err := c.fs.ReadDir(dir)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read directory %q: %w", dir, err)
+	}
+
+	var items []cleanItem
+
+	whole := true
+
+	for _, e := range entries {
+		p := path.Join(dir, e.Name())
+		if e.Name() == git.GitDirName {
+			whole = false
+
+			continue
+		}
+
+		inScope, below := c.inScope(p)
+		if !inScope && !below {
+			whole = false
+
+			continue
+		}
+
+		parts := strings.Split(p, "/")
+
+		if !e.IsDir() {
+			if c.tracked[p] || !inScope || !c.selected(parts, false) {
+				whole = false
+
+				continue
+			}
+
+			items = append(items, cleanItem{path: p})
+
+			continue
+		}
+
+		if c.trackedDirs[p] {
+			sub, _, err := c.collect(p, true)
+			if err != nil {
+				return nil, false, err
+			}
+
+			items = append(items, sub...)
+			whole = false
+
+			continue
+		}
+
+		// Untracked directories are only removed with -d, though -X still
+		// looks into them for ignored files.
+		if !cleanDirs {
+			if cleanOnlyIgnored && !c.isRepository(p) && !c.isIgnored(parts, true) {
+				sub, subWhole, err := c.collect(p, false)
+				if err != nil {
+					return nil, false, err
+				}
+
+				// A directory holding only ignored files is itself
+				// ignored, and kept like the other directories.
+				if !subWhole {
+					items = append(items, sub...)
+				}
+			}
+
+			whole = false
+
+			continue
+		}
+
+		// Nested repositories are kept unless -f is given twice.
+		if c.isRepository(p) {
+			if cleanForce < 2 || !inScope {
+				whole = false
+
+				continue
+			}
+
+			items = append(items, cleanItem{path: p, dir: true})
+
+			continue
+		}
+
+		ignored := c.isIgnored(parts, true)
+
+		switch {
+		case cleanOnlyIgnored && ignored && inScope:
+			items = append(items, cleanItem{path: p, dir: true})
+
+			continue
+		case !cleanIgnored && !cleanOnlyIgnored && ignored:
+			whole = false
+
+			continue
+		}
+
+		sub, subWhole, err := c.collect(p, false)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if subWhole && inScope {
+			items = append(items, cleanItem{path: p, dir: true})
+
+			continue
+		}
+
+		items = append(items, sub...)
+		whole = false
+	}
+
+	return items, whole && !tracked, nil
+}
+
+// selected reports whether an untracked file is to be removed given the
+// ignore mode.
+func (c *cleaner) selected(parts []string, isDir bool) bool {
+	ignored := c.isIgnored(parts, isDir)
+
+	if cleanOnlyIgnored {
+		return ignored
+	}
+
+	return !ignored
+}
+
+// isIgnored matches path against the -e patterns and, unless -x is
+// given, the standard ignore rules.
+func (c *cleaner) isIgnored(parts []string, isDir bool) bool {
+	if gitignore.NewMatcher(c.excludes).Match(parts, isDir) {
+		return true
+	}
+
+	if cleanIgnored {
+		return false
+	}
+
+	return c.ignore.Match(parts, isDir)
+}
+
+// inScope reports whether p is matched by the pathspecs, and whether any
+// pathspec points below p.
+func (c *cleaner) inScope(p string) (bool, bool) {
+	if len(c.pathspecs) == 0 {
+		return true, false
+	}
+
+	var below bool
+
+	for _, spec := range c.pathspecs {
+		if p == spec || strings.HasPrefix(p, spec+"/") {
+			return true, false
+		}
+
+		if ok, _ := path.Match(spec, p); ok {
+			return true, false
+		}
+
+		if strings.HasPrefix(spec, p+"/") || strings.ContainsAny(spec, "*?[") {
+			below = true
+		}
+	}
+
+	return false, below
+}
+
+func (c *cleaner) isRepository(dir string) bool {
+	_, err := c.fs.Lstat(path.Join(dir, git.GitDirName))
+
+	return err == nil
+}
+
+// remove deletes items, printing what is removed in git's format, or only
+// lists them with --dry-run. With --interactive, every removal is confirmed
+// on in.
+func (c *cleaner) remove(in io.Reader, out io.Writer, items []cleanItem) error {
+	answers := bufio.NewScanner(in)
+
+	for _, item := range items {
+		if cleanDryRun {
+			fmt.Fprintf(out, "Would remove %s\n", item)
+
+			continue
+		}
+
+		if cleanInteractive {
+			fmt.Fprintf(out, "Remove %s [y/N]? ", item)
+
+			if !answers.Scan() {
+				return answers.Err()
+			}
+
+			answer := strings.ToLower(strings.TrimSpace(answers.Text()))
+			if answer != "y" && answer != "yes" {
+				continue
+			}
+		}
+
+		if !cleanQuiet {
+			fmt.Fprintf(out, "Removing %s\n", item)
+		}
+
+		var err error
+		if item.dir {
+			err = util.RemoveAll(c.fs, item.path)
+		} else {
+			err = c.fs.Remove(item.path)
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to remove %s: %w", item, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// untrackedRepo returns a repository made by git with untracked, ignored
+// and nested repository files next to the tracked ones.
+func untrackedRepo(t *testing.T) string {
+	t.Helper()
+
+	dir := gitRepo(t, []string{"a", "1", "d/b", "2", ".gitignore", "*.log\nbuild/\n"})
+
+	for _, name := range []string{
+		"u", "d/u", "new/x", "new/sub/y",
+		"x.log", "d/y.log", "build/out", "logs/z.log", "new/w.log", "new/logs/v.log",
+	} {
+		writeFile(t, dir, name, name)
+	}
+
+	gitCmd(t, "", "init", "-q", filepath.Join(dir, "nested"))
+	writeFile(t, dir, "nested/n", "n")
+
+	return dir
+}
+
+// worktreeFiles returns the files and directories of the worktree dir,
+// besides the .git directories.
+func worktreeFiles(t *testing.T, dir string) []string {
+	t.Helper()
+
+	var files []string
+
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err == nil && rel != "." {
+			files = append(files, filepath.ToSlash(rel))
+		}
+
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return files
+}
+
+func TestClean(t *testing.T) {
+	for _, args := range [][]string{
+		{"-n"},
+		{"-f"},
+		{"-n", "-d"},
+		{"-f", "-d"},
+		{"-f", "-f", "-d"},
+		{"-n", "-d", "-x"},
+		{"-f", "-d", "-x"},
+		{"-n", "-d", "-X"},
+		{"-f", "-d", "-X"},
+		{"-n", "-X"},
+		{"-f", "-X"},
+		{"-f", "-d", "-X", "--", "new", "logs"},
+		{"-f", "-f", "-d", "-x"},
+		{"-f", "-x"},
+		{"-f", "-d", "-e", "u"},
+		{"-f", "-d", "--", "d"},
+		{"-f", "-d", "-q"},
+	} {
+		t.Run(strings.Join(args, " "), func(t *testing.T) {
+			want := untrackedRepo(t)
+			wantOut := gitCmd(t, want, append([]string{"clean"}, args...)...)
+
+			got := untrackedRepo(t)
+			gotOut := mustGogit(t, got, append([]string{"clean"}, args...)...)
+
+			if gotOut != wantOut {
+				t.Errorf("clean printed:\n%s\nwant, as git:\n%s", gotOut, wantOut)
+			}
+
+			if g, w := worktreeFiles(t, got), worktreeFiles(t, want); !slices.Equal(g, w) {
+				t.Errorf("clean left %q, want as git %q", g, w)
+			}
+		})
+	}
+}
+
+func TestCleanRequireForce(t *testing.T) {
+	dir := untrackedRepo(t)
+
+	res := gogit(t, dir, "clean")
+	if res.code == 0 {
+		t.Error("clean without -f succeeded")
+	}
+
+	if !exists(t, dir, "u") {
+		t.Error("clean without -f removed an untracked file")
+	}
+}
+
+// TestCleanInteractive checks that -i offers the removals --dry-run lists,
+// and makes those confirmed.
+func TestCleanInteractive(t *testing.T) {
+	dir := untrackedRepo(t)
+
+	listed := strings.Split(strings.TrimSpace(mustGogit(t, dir, "clean", "-n", "-d", "-x")), "\n")
+
+	// Only the first removal is confirmed.
+	res := gogitStdin(t, dir, "y\n"+strings.Repeat("n\n", len(listed)-1), "clean", "-i", "-d", "-x")
+	if res.code != 0 {
+		t.Fatalf("clean -i exited with %d: %s", res.code, res.stderr)
+	}
+
+	if got := strings.Count(res.stdout, "[y/N]? "); got != len(listed) {
+		t.Errorf("clean -i asked %d times, want %d:\n%s", got, len(listed), res.stdout)
+	}
+
+	for i, line := range listed {
+		name := strings.TrimSuffix(strings.TrimPrefix(line, "Would remove "), "/")
+		if exists(t, dir, name) != (i > 0) {
+			t.Errorf("clean -i removed %s: %v, want %v", name, !exists(t, dir, name), i == 0)
+		}
+	}
+}
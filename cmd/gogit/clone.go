@@ -1,12 +1,22 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/url"
+	"os"
 	"path"
+	"path/filepath"
 	"strings"
 
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-billy/v6/osfs"
 	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/cache"
+	"github.com/go-git/go-git/v6/storage/filesystem"
 	"github.com/spf13/cobra"
 )
 
@@ -15,6 +25,8 @@ var (
 	cloneProgress bool
 	cloneDepth    int
 	cloneTags     bool
+	cloneRecurse  bool
+	cloneSparse   bool
 )
 
 func init() {
@@ -22,6 +34,8 @@ func init() {
 	cloneCmd.Flags().BoolVarP(&cloneProgress, "progress", "", true, "Show clone progress")
 	cloneCmd.Flags().IntVarP(&cloneDepth, "depth", "", 0, "Create a shallow clone of that depth")
 	cloneCmd.Flags().BoolVarP(&cloneTags, "tags", "", false, "Clone tags")
+	cloneCmd.Flags().BoolVarP(&cloneSparse, "sparse", "", false, "Initialize a sparse checkout with only the top-level files")
+	cloneCmd.Flags().BoolVarP(&cloneRecurse, "recurse-submodules", "", false, "Initialize and clone submodules")
 	rootCmd.AddCommand(cloneCmd)
 	rootCmd.CompletionOptions.HiddenDefaultCmd = true
 }
@@ -31,7 +45,7 @@ var cloneCmd = &cobra.Command{
 	Short: "Clone a repository into a new directory",
 	Args:  cobra.RangeArgs(1, 2),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		dir := path.Base(args[0])
+		dir := strings.TrimSuffix(path.Base(args[0]), ".bundle")
 		if len(args) > 1 {
 			dir = args[1]
 		} else {
@@ -41,13 +55,39 @@ var cloneCmd = &cobra.Command{
 			}
 		}
 
-		ep, err := url.Parse(args[0])
+		if isBundle(args[0]) {
+			fmt.Fprintf(cmd.ErrOrStderr(), "Cloning into '%s'...\n", dir)
+
+			hs, err := cloneBundle(args[0], dir, cloneBare, cmd.ErrOrStderr())
+			if err != nil {
+				return err
+			}
+
+			err = logRefUpdates(hs, refSnapshot{}, staticReflogMessage("clone: from "+args[0]))
+			if err != nil {
+				return err
+			}
+
+			return clonePostCheckout(cmd, hs)
+		}
+
+		// Local repositories are recorded by their absolute path, as git
+		// does, so that relative submodule URLs resolve against it.
+		repoURL := args[0]
+		if fi, err := os.Stat(repoURL); err == nil && fi.IsDir() {
+			repoURL, err = filepath.Abs(repoURL)
+			if err != nil {
+				return err
+			}
+		}
+
+		ep, err := url.Parse(repoURL)
 		if err != nil {
 			return err
 		}
 
 		opts := git.CloneOptions{
-			URL:           args[0],
+			URL:           repoURL,
 			Depth:         cloneDepth,
 			ClientOptions: defaultClientOptions(ep),
 			Bare:          cloneBare,
@@ -57,15 +97,128 @@ var cloneCmd = &cobra.Command{
 			opts.Tags = git.TagFollowing
 		}
 
+		if cloneSparse {
+			opts.NoCheckout = true
+		}
+
+		if cloneRecurse {
+			opts.RecurseSubmodules = git.DefaultSubmoduleRecursionDepth
+		}
+
 		if cloneProgress {
 			opts.Progress = cmd.OutOrStdout()
 		}
 
 		fmt.Fprintf(cmd.ErrOrStderr(), "Cloning into '%s'...\n", dir)
 
-		_, err = git.PlainClone(dir, &opts)
+		hs, err := plainClone(dir, &opts, cmd.ErrOrStderr())
+		if err != nil {
+			return err
+		}
 
-		return err
+		r := hs.r
+
+		if cloneSparse && !cloneBare {
+			err = sparseClone(r, cmd.ErrOrStderr())
+			if err != nil {
+				return err
+			}
+		}
+
+		if !cloneBare {
+			err = smudgeWorktree(r, cmd.ErrOrStderr(), nil)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = logRefUpdates(hs, refSnapshot{}, staticReflogMessage("clone: from "+repoURL))
+		if err != nil {
+			return err
+		}
+
+		return clonePostCheckout(cmd, hs)
 	},
 	DisableFlagsInUseLine: true,
 }
+
+// plainClone clones into dir the way git.PlainClone does, and returns the
+// hooks of the new repository. The references are only written once the
+// reference-transaction hook accepted them, the clone being removed
+// otherwise.
+func plainClone(dir string, opts *git.CloneOptions, errOut io.Writer) (*hooks, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	if len(entries) > 0 {
+		return nil, fmt.Errorf("%w %s", git.ErrTargetDirNotEmpty, dir)
+	}
+
+	existed := err == nil
+
+	var wt billy.Filesystem
+
+	dot := osfs.New(dir, osfs.WithBoundOS())
+	if !opts.Bare {
+		wt = dot
+
+		dot, err = wt.Chroot(git.GitDirName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	pending := newPendingRefs(filesystem.NewStorage(dot, cache.NewObjectLRUDefault()))
+
+	r, err := git.CloneContext(context.Background(), pending, wt, opts)
+	if err == nil {
+		pending.r = r
+		hs := newHooks(r, errOut)
+
+		err = pending.commit(hs, refSnapshot{})
+		if err == nil {
+			return hs, nil
+		}
+	}
+
+	// Like git, a failed clone leaves nothing behind.
+	if !existed {
+		_ = os.RemoveAll(dir)
+
+		return nil, err
+	}
+
+	entries, _ = os.ReadDir(dir)
+	for _, e := range entries {
+		_ = os.RemoveAll(filepath.Join(dir, e.Name()))
+	}
+
+	return nil, err
+}
+
+// clonePostCheckout runs the post-checkout hook of a new clone, unless it
+// is bare or empty and so has nothing checked out.
+func clonePostCheckout(cmd *cobra.Command, hs *hooks) error {
+	if cloneBare {
+		return nil
+	}
+
+	head, err := hs.r.Head()
+	if err != nil {
+		return nil //nolint:nilerr
+	}
+
+	err = hs.postCheckout(plumbing.ZeroHash, head.Hash(), "1")
+	if err != nil {
+		return hookExitStatus(cmd, err)
+	}
+
+	return nil
+}
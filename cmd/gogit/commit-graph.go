@@ -0,0 +1,649 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	formatgraph "github.com/go-git/go-git/v6/plumbing/format/commitgraph"
+	formatcfg "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/spf13/cobra"
+)
+
+const (
+	commitGraphFile  = "objects/info/commit-graph"
+	commitGraphsDir  = "objects/info/commit-graphs"
+	commitGraphChain = commitGraphsDir + "/commit-graph-chain"
+
+	// generationNumberMax is the largest topological generation number
+	// the commit-graph format can hold.
+	generationNumberMax = 0x3FFFFFFF
+)
+
+var (
+	commitGraphReachable    bool
+	commitGraphSplit        bool
+	commitGraphChangedPaths bool
+)
+
+func init() {
+	commitGraphWriteCmd.Flags().BoolVarP(&commitGraphReachable, "reachable", "", false, "Walk the commits reachable from the references instead of the packed commits")
+	commitGraphWriteCmd.Flags().BoolVarP(&commitGraphSplit, "split", "", false, "Write the commit-graph as a chain of files, keeping the commits of the existing one")
+	commitGraphWriteCmd.Flags().BoolVarP(&commitGraphChangedPaths, "changed-paths", "", false, "Compute the changed-path Bloom filters")
+
+	commitGraphCmd.AddCommand(commitGraphWriteCmd)
+	commitGraphCmd.AddCommand(commitGraphVerifyCmd)
+	rootCmd.AddCommand(commitGraphCmd)
+}
+
+var commitGraphCmd = &cobra.Command{
+	Use:                   "commit-graph <command>",
+	Short:                 "Write and verify the commit-graph files",
+	DisableFlagsInUseLine: true,
+}
+
+var commitGraphWriteCmd = &cobra.Command{
+	Use:   "write [--reachable] [--split] [--changed-paths]",
+	Short: "Write a commit-graph file",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		cfg, err := r.Config()
+		if err != nil {
+			return fmt.Errorf("failed to get repository config: %w", err)
+		}
+
+		if !configBool(cfg, "core", "commitgraph", true) {
+			fmt.Fprintln(cmd.ErrOrStderr(), "warning: attempting to write a commit-graph, but 'core.commitGraph' is disabled")
+
+			return nil
+		}
+
+		return writeCommitGraph(r, commitGraphReachable, commitGraphSplit, commitGraphChangedPaths)
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var commitGraphVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify the commit-graph files against the object database",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		store, ok := r.Storer.(*filesystem.Storage)
+		if !ok {
+			return errors.New("storer does not implement filesystem.Storage")
+		}
+
+		v := &commitGraphVerifier{r: r, fs: store.Filesystem(), out: cmd.ErrOrStderr()}
+
+		err = v.run()
+		if err != nil {
+			return err
+		}
+
+		if v.failed {
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+
+			return exitStatus(1)
+		}
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// writeCommitGraph writes the commit-graph of the commits in the packs or,
+// with reachable, of those reachable from the references. Without split,
+// a single file replaces the commit-graph. With split, the new commits are
+// written as a layer on top of the existing chain, merging into it the top
+// layers holding less than twice as many commits, like git does. The
+// changed-path Bloom filters are written with changedPaths, or when the
+// top layer of the existing commit-graph has them.
+func writeCommitGraph(r *git.Repository, reachable, split, changedPaths bool) error {
+	store, ok := r.Storer.(*filesystem.Storage)
+	if !ok {
+		return errors.New("storer does not implement filesystem.Storage")
+	}
+
+	of, err := packObjectFormat(r, "")
+	if err != nil {
+		return err
+	}
+
+	// Only SHA-1 commit-graphs are written.
+	if of == formatcfg.SHA256 {
+		return errors.New("commit-graph files are not supported in SHA-256 repositories")
+	}
+
+	fs := store.Filesystem()
+
+	// Like git, shallow repositories are left without a commit-graph, as
+	// the generation numbers of their truncated history would be wrong.
+	if _, err := fs.Stat("shallow"); err == nil {
+		return nil
+	}
+
+	tips, err := commitGraphTips(r, store, of, reachable)
+	if err != nil {
+		return err
+	}
+
+	layers, err := readCommitGraphLayers(fs)
+	if err != nil {
+		return err
+	}
+
+	if len(layers) > 0 && layers[len(layers)-1].bloom {
+		changedPaths = true
+	}
+
+	var bases []*commitGraphLayer
+
+	if split {
+		for _, l := range layers {
+			tips = append(tips, l.hashes...)
+		}
+
+		bases = layers
+	}
+
+	data, err := buildCommitGraph(r, tips)
+	if err != nil {
+		return err
+	}
+
+	layered := make(map[plumbing.Hash]bool)
+
+	for _, l := range bases {
+		for _, h := range l.hashes {
+			layered[h] = true
+		}
+	}
+
+	var hashes []plumbing.Hash
+
+	for h := range data {
+		if !layered[h] {
+			hashes = append(hashes, h)
+		}
+	}
+
+	for len(bases) > 0 && len(bases[len(bases)-1].hashes) <= 2*len(hashes) {
+		hashes = append(hashes, bases[len(bases)-1].hashes...)
+		bases = bases[:len(bases)-1]
+	}
+
+	if split && len(hashes) == 0 {
+		return nil
+	}
+
+	sort.Slice(hashes, func(i, j int) bool {
+		return hashes[i].Compare(hashes[j].Bytes()) < 0
+	})
+
+	var filters [][]byte
+
+	if changedPaths {
+		filters, err = changedPathFilters(r, hashes)
+		if err != nil {
+			return err
+		}
+	}
+
+	content := encodeCommitGraph(hashes, data, bases, filters)
+
+	if !split {
+		err = writeLockedFile(fs, commitGraphFile, string(content))
+		if err != nil {
+			return fmt.Errorf("failed to write commit-graph: %w", err)
+		}
+
+		return removeCommitGraphFiles(fs, nil)
+	}
+
+	return writeCommitGraphChain(fs, bases, content)
+}
+
+// writeCommitGraphChain writes the layer content on top of the layers
+// bases, and the chain listing them. Like git does, a single commit-graph
+// file kept as the base of the chain is moved into it.
+func writeCommitGraphChain(fs billy.Filesystem, bases []*commitGraphLayer, content []byte) error {
+	err := fs.MkdirAll(commitGraphsDir, 0o755)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", commitGraphsDir, err)
+	}
+
+	var chain strings.Builder
+
+	keep := make(map[string]bool)
+
+	for _, l := range bases {
+		name := commitGraphLayerPath(l.sum)
+		if l.name != name {
+			err = fs.Rename(l.name, name)
+			if err != nil {
+				return fmt.Errorf("failed to move %s: %w", l.name, err)
+			}
+		}
+
+		keep[name] = true
+
+		fmt.Fprintln(&chain, l.sum)
+	}
+
+	sum := hex.EncodeToString(content[len(content)-crypto.SHA1.Size():])
+	name := commitGraphLayerPath(sum)
+	keep[name] = true
+
+	fmt.Fprintln(&chain, sum)
+
+	err = writeLockedFile(fs, name, string(content))
+	if err == nil {
+		err = writeLockedFile(fs, commitGraphChain, chain.String())
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to write commit-graph: %w", err)
+	}
+
+	err = fs.Remove(commitGraphFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove commit-graph: %w", err)
+	}
+
+	return removeCommitGraphFiles(fs, keep)
+}
+
+// commitGraphTips returns the commits to start the commit-graph from: the
+// commits the references point to with reachable, else the packed commits.
+func commitGraphTips(r *git.Repository, store *filesystem.Storage, of formatcfg.ObjectFormat, reachable bool) ([]plumbing.Hash, error) {
+	var tips []plumbing.Hash
+
+	if reachable {
+		w := &revWalk{r: r}
+
+		err := w.addAll()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tip := range w.tips {
+			h, err := peelObject(r, tip.hash, tip.name, plumbing.CommitObject.String())
+			if err == nil {
+				tips = append(tips, h)
+			}
+		}
+
+		return tips, nil
+	}
+
+	indexes, err := readPackIndexes(store, of)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pack := range sortedPacks(indexes) {
+		hashes, err := indexHashes(indexes[pack])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, h := range hashes {
+			obj, err := store.EncodedObject(plumbing.AnyObject, h)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read object %s: %w", h, err)
+			}
+
+			if obj.Type() == plumbing.CommitObject {
+				tips = append(tips, h)
+			}
+		}
+	}
+
+	return tips, nil
+}
+
+// buildCommitGraph returns the commit-graph of the commits reachable from
+// tips, with their topological generation numbers and corrected commit
+// dates.
+func buildCommitGraph(r *git.Repository, tips []plumbing.Hash) (map[plumbing.Hash]*formatgraph.CommitData, error) {
+	data := make(map[plumbing.Hash]*formatgraph.CommitData)
+	commits := make(map[plumbing.Hash]*object.Commit)
+	pending := append([]plumbing.Hash(nil), tips...)
+
+	// The parents of a commit are added before it, as its generation
+	// numbers follow from theirs.
+	for len(pending) > 0 {
+		h := pending[len(pending)-1]
+		if _, ok := data[h]; ok {
+			pending = pending[:len(pending)-1]
+
+			continue
+		}
+
+		c, ok := commits[h]
+		if !ok {
+			var err error
+
+			c, err = r.CommitObject(h)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read commit %s: %w", h, err)
+			}
+
+			commits[h] = c
+		}
+
+		waiting := false
+
+		for _, p := range c.ParentHashes {
+			if _, ok := data[p]; !ok {
+				pending = append(pending, p)
+				waiting = true
+			}
+		}
+
+		if waiting {
+			continue
+		}
+
+		pending = pending[:len(pending)-1]
+		delete(commits, h)
+
+		d := &formatgraph.CommitData{
+			TreeHash:     c.TreeHash,
+			ParentHashes: c.ParentHashes,
+			When:         c.Committer.When,
+			GenerationV2: uint64(c.Committer.When.Unix()),
+		}
+
+		for _, p := range c.ParentHashes {
+			d.Generation = max(d.Generation, data[p].Generation)
+			d.GenerationV2 = max(d.GenerationV2, data[p].GenerationV2+1)
+		}
+
+		d.Generation = min(d.Generation+1, generationNumberMax)
+
+		data[h] = d
+	}
+
+	return data, nil
+}
+
+// removeCommitGraphFiles removes the files of the commit-graph chain but
+// for the layers keep, the whole chain when keep is empty.
+func removeCommitGraphFiles(fs billy.Filesystem, keep map[string]bool) error {
+	entries, err := fs.ReadDir(commitGraphsDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		name := path.Join(commitGraphsDir, e.Name())
+		if keep[name] || (len(keep) > 0 && name == commitGraphChain) {
+			continue
+		}
+
+		err = fs.Remove(name)
+		if err != nil {
+			return fmt.Errorf("failed to remove %s: %w", name, err)
+		}
+	}
+
+	if len(keep) > 0 {
+		return nil
+	}
+
+	return fs.Remove(commitGraphsDir)
+}
+
+// commitGraphFiles returns the files of the commit-graph of the repository,
+// the base of the chain first, or none when there is no commit-graph.
+func commitGraphFiles(fs billy.Filesystem) ([]string, error) {
+	if _, err := fs.Stat(commitGraphFile); err == nil {
+		return []string{commitGraphFile}, nil
+	}
+
+	f, err := fs.Open(commitGraphChain)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	chain, err := formatgraph.OpenChainFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read commit-graph chain: %w", err)
+	}
+
+	files := make([]string, 0, len(chain))
+	for _, h := range chain {
+		files = append(files, path.Join(commitGraphsDir, "graph-"+h+".graph"))
+	}
+
+	return files, nil
+}
+
+// openCommitGraph opens the commit-graph of the repository, returning nil
+// when there is none or core.commitGraph disables it.
+func openCommitGraph(r *git.Repository) (formatgraph.Index, error) {
+	store, ok := r.Storer.(*filesystem.Storage)
+	if !ok {
+		return nil, nil
+	}
+
+	cfg, err := r.Config()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get repository config: %w", err)
+	}
+
+	if !configBool(cfg, "core", "commitgraph", true) {
+		return nil, nil
+	}
+
+	files, err := commitGraphFiles(store.Filesystem())
+	if err != nil || len(files) == 0 {
+		return nil, err
+	}
+
+	idx, err := formatgraph.OpenChainOrFileIndex(store.Filesystem())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open commit-graph: %w", err)
+	}
+
+	return idx, nil
+}
+
+// commitGraphVerifier checks the commit-graph files against the commits
+// they describe, reporting the problems the way git does.
+type commitGraphVerifier struct {
+	r      *git.Repository
+	fs     billy.Filesystem
+	out    io.Writer
+	failed bool
+}
+
+func (v *commitGraphVerifier) report(format string, args ...any) {
+	v.failed = true
+
+	fmt.Fprintf(v.out, format+"\n", args...)
+}
+
+func (v *commitGraphVerifier) run() error {
+	files, err := commitGraphFiles(v.fs)
+	if err != nil || len(files) == 0 {
+		return err
+	}
+
+	for _, name := range files {
+		err = v.checkFile(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	graph, err := openCommitGraph(v.r)
+	if err != nil {
+		v.report("%v", err)
+
+		return nil
+	}
+
+	if graph == nil {
+		return nil
+	}
+
+	defer graph.Close()
+
+	for i := range graph.MaximumNumberOfHashes() {
+		h, err := graph.GetHashByIndex(i)
+		if err != nil {
+			return fmt.Errorf("failed to read commit-graph: %w", err)
+		}
+
+		d, err := graph.GetCommitDataByIndex(i)
+		if err != nil {
+			v.report("failed to parse commit %s from commit-graph", h)
+
+			continue
+		}
+
+		v.checkCommit(graph, h, d)
+	}
+
+	return nil
+}
+
+// checkFile checks the checksum of a commit-graph file and the order of
+// the commits it lists.
+func (v *commitGraphVerifier) checkFile(name string) error {
+	content, err := util.ReadFile(v.fs, name)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	size := crypto.SHA1.Size()
+	if len(content) < size {
+		v.report("commit-graph file is too small")
+
+		return nil
+	}
+
+	sum := crypto.SHA1.New()
+	sum.Write(content[:len(content)-size])
+
+	if !bytes.Equal(sum.Sum(nil), content[len(content)-size:]) {
+		v.report("the commit-graph file has incorrect checksum and is likely corrupt")
+	}
+
+	f, err := v.fs.Open(name)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", name, err)
+	}
+
+	idx, err := formatgraph.OpenFileIndex(f)
+	if err != nil {
+		_ = f.Close()
+
+		v.report("failed to open %s: %v", name, err)
+
+		return nil
+	}
+
+	defer idx.Close()
+
+	var prev plumbing.Hash
+
+	for i := range idx.MaximumNumberOfHashes() {
+		h, err := idx.GetHashByIndex(i)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+
+		if i > 0 && prev.Compare(h.Bytes()) >= 0 {
+			v.report("commit-graph has incorrect OID order: %s then %s", prev, h)
+		}
+
+		prev = h
+	}
+
+	return nil
+}
+
+// checkCommit compares the commit-graph data d of the commit h with the
+// commit itself.
+func (v *commitGraphVerifier) checkCommit(graph formatgraph.Index, h plumbing.Hash, d *formatgraph.CommitData) {
+	c, err := v.r.CommitObject(h)
+	if err != nil {
+		v.report("failed to parse commit %s from object database for commit-graph", h)
+
+		return
+	}
+
+	if d.TreeHash != c.TreeHash {
+		v.report("root tree OID for commit %s in commit-graph is %s != %s", h, d.TreeHash, c.TreeHash)
+	}
+
+	var generation uint64
+
+	for i, p := range d.ParentHashes {
+		if i >= len(c.ParentHashes) {
+			v.report("commit-graph parent list for commit %s is too long", h)
+
+			break
+		}
+
+		if p != c.ParentHashes[i] {
+			v.report("commit-graph parent for %s is %s != %s", h, p, c.ParentHashes[i])
+		}
+
+		if j, err := graph.GetIndexByHash(p); err == nil {
+			if pd, err := graph.GetCommitDataByIndex(j); err == nil {
+				generation = max(generation, pd.Generation)
+			}
+		}
+	}
+
+	if len(d.ParentHashes) < len(c.ParentHashes) {
+		v.report("commit-graph parent list for commit %s terminates early", h)
+	}
+
+	generation = min(generation+1, generationNumberMax)
+	if d.Generation < generation {
+		v.report("commit-graph generation for commit %s is %d < %d", h, d.Generation, generation)
+	}
+
+	if d.When.Unix() != c.Committer.When.Unix() {
+		v.report("commit date for commit %s in commit-graph is %d != %d", h, d.When.Unix(), c.Committer.When.Unix())
+	}
+}
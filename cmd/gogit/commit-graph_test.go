@@ -0,0 +1,170 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func historyRepo(t *testing.T) string {
+	t.Helper()
+
+	dir := gitRepo(t, []string{"a", "1"}, []string{"b", "2"})
+	gitCmd(t, dir, "checkout", "-q", "-b", "topic", "HEAD~1")
+	writeFile(t, dir, "c", "3")
+	gitCmd(t, dir, "add", "c")
+	gitCmd(t, dir, "commit", "-q", "-m", "topic")
+	gitCmd(t, dir, "checkout", "-q", "main")
+	gitCmd(t, dir, "merge", "-q", "--no-ff", "-m", "merge", "topic")
+
+	return dir
+}
+
+func TestHistoryWithoutCommitGraph(t *testing.T) {
+	dir := historyRepo(t)
+
+	if exists(t, dir, ".git/"+commitGraphFile) {
+		t.Fatal("git wrote a commit-graph")
+	}
+
+	sameOutput(t, dir, "log", "--oneline")
+	sameOutput(t, dir, "rev-list", "--all")
+	sameOutput(t, dir, "merge-base", "main", "topic")
+
+	res := gogit(t, dir, "merge-base", "--is-ancestor", "topic", "main")
+	if res.code != 0 {
+		t.Errorf("merge-base --is-ancestor topic main exited with %d: %s", res.code, res.stderr)
+	}
+
+	res = gogit(t, dir, "merge-base", "--is-ancestor", "main", "topic")
+	if res.code != 1 {
+		t.Errorf("merge-base --is-ancestor main topic exited with %d, want 1", res.code)
+	}
+}
+
+func TestCommitGraphWrite(t *testing.T) {
+	dir := historyRepo(t)
+	gitCmd(t, dir, "gc", "-q")
+
+	mustGogit(t, dir, "commit-graph", "write", "--reachable")
+	gitCmd(t, dir, "commit-graph", "verify")
+	mustGogit(t, dir, "commit-graph", "verify")
+
+	sameOutput(t, dir, "log", "--oneline")
+	sameOutput(t, dir, "rev-list", "main")
+}
+
+func TestCommitGraphVerifyGit(t *testing.T) {
+	dir := historyRepo(t)
+	gitCmd(t, dir, "commit-graph", "write", "--reachable")
+
+	res := gogit(t, dir, "commit-graph", "verify")
+	if res.code != 0 || strings.TrimSpace(res.stderr) != "" {
+		t.Errorf("verify exited with %d: %s", res.code, res.stderr)
+	}
+}
+
+// readCommitGraphFiles returns the contents of the commit-graph files of dir.
+func readCommitGraphFiles(t *testing.T, dir string) map[string]string {
+	t.Helper()
+
+	files := make(map[string]string)
+
+	for _, name := range []string{commitGraphFile, commitGraphChain} {
+		content, err := os.ReadFile(filepath.Join(dir, ".git", name))
+		if err == nil {
+			files[name] = string(content)
+		}
+	}
+
+	entries, _ := os.ReadDir(filepath.Join(dir, ".git", commitGraphsDir))
+	for _, e := range entries {
+		content, err := os.ReadFile(filepath.Join(dir, ".git", commitGraphsDir, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		files[e.Name()] = string(content)
+	}
+
+	return files
+}
+
+// sameCommitGraph runs the same commit-graph write with git and gogit on
+// copies of the repository made by setup, and fails the test unless they
+// write the same files.
+func sameCommitGraph(t *testing.T, setup func(t *testing.T, write func(args ...string)) string) {
+	t.Helper()
+
+	want := readCommitGraphFiles(t, setup(t, func(args ...string) {
+		gitCmd(t, "", append([]string{"commit-graph", "write", "--reachable"}, args...)...)
+	}))
+
+	got := readCommitGraphFiles(t, setup(t, func(args ...string) {
+		mustGogit(t, "", append([]string{"commit-graph", "write", "--reachable"}, args...)...)
+	}))
+
+	if !reflect.DeepEqual(got, want) {
+		names := func(files map[string]string) []string {
+			return slices.Sorted(maps.Keys(files))
+		}
+
+		t.Errorf("gogit wrote %v, want as git %v", names(got), names(want))
+	}
+}
+
+func TestCommitGraphWriteChangedPaths(t *testing.T) {
+	sameCommitGraph(t, func(t *testing.T, write func(args ...string)) string {
+		dir := gitRepo(t,
+			[]string{"a/b/c", "1", "top", "1"},
+			[]string{"a/b/d", "2", "ünï", "é"},
+			[]string{"top", "3"},
+		)
+
+		for i := range 600 {
+			writeFile(t, dir, "big/"+strconv.Itoa(i), "x")
+		}
+
+		gitCmd(t, dir, "add", "big")
+		gitCmd(t, dir, "commit", "-q", "-m", "big")
+		gitCmd(t, dir, "commit", "-q", "--allow-empty", "-m", "empty")
+
+		t.Chdir(dir)
+		write("--changed-paths")
+
+		return dir
+	})
+}
+
+func TestCommitGraphWriteSplit(t *testing.T) {
+	sameCommitGraph(t, func(t *testing.T, write func(args ...string)) string {
+		var commits [][]string
+		for i := range 20 {
+			commits = append(commits, []string{"f" + strconv.Itoa(i), "x"})
+		}
+
+		dir := historyRepo(t)
+		t.Chdir(dir)
+		write()
+
+		for i, files := range commits {
+			writeFile(t, dir, files[0], files[1])
+			gitCmd(t, dir, "add", "-A")
+			gitCmd(t, dir, "commit", "-q", "-m", "split "+strconv.Itoa(i))
+
+			switch i {
+			case 1:
+				write("--split", "--changed-paths")
+			case 2, 12, 13:
+				write("--split")
+			}
+		}
+
+		return dir
+	})
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/spf13/cobra"
+)
+
+var (
+	commitTreeParents  []string
+	commitTreeMessages []string
+	commitTreeFiles    []string
+)
+
+func init() {
+	commitTreeCmd.Flags().StringArrayVarP(&commitTreeParents, "parent", "p", nil, "Add a parent commit")
+	commitTreeCmd.Flags().StringArrayVarP(&commitTreeMessages, "message", "m", nil, "Use the given commit message paragraph")
+	commitTreeCmd.Flags().StringArrayVarP(&commitTreeFiles, "file", "F", nil, "Read a commit message paragraph from the given file, or - for stdin")
+	rootCmd.AddCommand(commitTreeCmd)
+}
+
+var commitTreeCmd = &cobra.Command{
+	Use:   "commit-tree <tree> [(-p <parent>)...] [(-m <message>)...] [(-F <file>)...]",
+	Short: "Create a commit object from a tree",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		tree, err := resolveTypedObject(r, args[0], plumbing.TreeObject)
+		if err != nil {
+			return err
+		}
+
+		c := &object.Commit{
+			Author:    signature(r, authorRole),
+			Committer: signature(r, committerRole),
+			TreeHash:  tree,
+		}
+
+		for _, p := range commitTreeParents {
+			h, err := resolvePeeled(r, p, plumbing.CommitObject.String())
+			if err != nil {
+				return fmt.Errorf("not a valid object name %s", p)
+			}
+
+			if containsHash(c.ParentHashes, h) {
+				fmt.Fprintf(cmd.ErrOrStderr(), "error: duplicate parent %s ignored\n", h)
+
+				continue
+			}
+
+			c.ParentHashes = append(c.ParentHashes, h)
+		}
+
+		c.Message, err = commitTreeMessage(cmd.InOrStdin())
+		if err != nil {
+			return err
+		}
+
+		obj := r.Storer.NewEncodedObject()
+
+		err = c.Encode(obj)
+		if err != nil {
+			return fmt.Errorf("failed to encode commit: %w", err)
+		}
+
+		h, err := r.Storer.SetEncodedObject(obj)
+		if err != nil {
+			return fmt.Errorf("failed to write commit: %w", err)
+		}
+
+		fmt.Fprintln(cmd.OutOrStdout(), h)
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// commitTreeMessage joins the -m and -F paragraphs the way git commit-tree
+// does, reading the whole message from stdin when none are given.
+func commitTreeMessage(stdin io.Reader) (string, error) {
+	if len(commitTreeMessages) == 0 && len(commitTreeFiles) == 0 {
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return "", fmt.Errorf("failed to read commit message: %w", err)
+		}
+
+		return string(data), nil
+	}
+
+	var sb strings.Builder
+
+	for _, m := range commitTreeMessages {
+		if sb.Len() > 0 {
+			sb.WriteByte('\n')
+		}
+
+		sb.WriteString(m)
+
+		if !strings.HasSuffix(m, "\n") {
+			sb.WriteByte('\n')
+		}
+	}
+
+	for _, f := range commitTreeFiles {
+		var (
+			data []byte
+			err  error
+		)
+
+		if f == "-" {
+			data, err = io.ReadAll(stdin)
+		} else {
+			data, err = os.ReadFile(f)
+		}
+
+		if err != nil {
+			return "", fmt.Errorf("failed to read commit message: %w", err)
+		}
+
+		if sb.Len() > 0 {
+			sb.WriteByte('\n')
+		}
+
+		sb.Write(data)
+	}
+
+	return sb.String(), nil
+}
+
+// resolveTypedObject resolves rev, failing unless it names an object of
+// type t.
+func resolveTypedObject(r *git.Repository, rev string, t plumbing.ObjectType) (plumbing.Hash, error) {
+	h, err := resolveObject(r, rev)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("not a valid object name %s", rev)
+	}
+
+	obj, err := r.Storer.EncodedObject(plumbing.AnyObject, h)
+	if err != nil || obj.Type() != t {
+		return plumbing.ZeroHash, fmt.Errorf("%s is not a valid '%s' object", h, t)
+	}
+
+	return h, nil
+}
+
+func containsHash(hashes []plumbing.Hash, h plumbing.Hash) bool {
+	for _, x := range hashes {
+		if x == h {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCommitTree(t *testing.T) {
+	dir := gitRepo(t, []string{"a", "1"}, []string{"a", "2"})
+	writeFile(t, dir, "msg", "from a file\n")
+
+	for _, args := range [][]string{
+		{"commit-tree", "HEAD^{tree}", "-m", "root"},
+		{"commit-tree", "HEAD^{tree}", "-p", "HEAD", "-m", "one", "-m", "two"},
+		{"commit-tree", "-p", "HEAD~1", "-p", "HEAD", "HEAD~1^{tree}", "-F", "msg"},
+		{"commit-tree", "HEAD^{tree}", "-m", "no newline\n\n\n"},
+	} {
+		sameOutput(t, dir, args...)
+	}
+
+	args := []string{"commit-tree", "HEAD^{tree}", "-p", "HEAD"}
+	if got, want := gogitStdin(t, dir, "from stdin\n", args...).stdout, gitCmdStdin(t, dir, "from stdin\n", args...); got != want {
+		t.Errorf("gogit %v gave %q, want as git %q", args, got, want)
+	}
+
+	gitCmd(t, dir, "fsck")
+}
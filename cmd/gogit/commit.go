@@ -0,0 +1,497 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/index"
+	"github.com/go-git/go-git/v6/plumbing/hash"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/spf13/cobra"
+)
+
+var (
+	commitMessages          []string
+	commitFile              string
+	commitAllowEmpty        bool
+	commitAllowEmptyMessage bool
+	commitNoVerify          bool
+	commitQuiet             bool
+	commitAll               bool
+)
+
+func init() {
+	commitCmd.Flags().StringArrayVarP(&commitMessages, "message", "m", nil, "Use the given message paragraph")
+	commitCmd.Flags().StringVarP(&commitFile, "file", "F", "", "Read the message from the given file, or - for stdin")
+	commitCmd.Flags().BoolVarP(&commitAllowEmpty, "allow-empty", "", false, "Record a commit with the same tree as its parent")
+	commitCmd.Flags().BoolVarP(&commitAllowEmptyMessage, "allow-empty-message", "", false, "Record a commit with an empty message")
+	commitCmd.Flags().BoolVarP(&commitNoVerify, "no-verify", "n", false, "Bypass the pre-commit and commit-msg hooks")
+	commitCmd.Flags().BoolVarP(&commitQuiet, "quiet", "q", false, "Suppress the commit summary")
+	commitCmd.Flags().BoolVarP(&commitAll, "all", "a", false, "Stage the modified and deleted files first")
+	rootCmd.AddCommand(commitCmd)
+}
+
+var commitCmd = &cobra.Command{
+	Use:   "commit [-a] [-n | --no-verify] [-q] [--allow-empty] [--allow-empty-message] (-m <msg> | -F <file>)",
+	Short: "Record the staged changes to the repository",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		if len(commitMessages) > 0 && commitFile != "" {
+			return errors.New("option -m cannot be combined with -F")
+		}
+
+		if len(commitMessages) == 0 && commitFile == "" {
+			return errors.New("no commit message given, use -m or -F")
+		}
+
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		store, ok := r.Storer.(*filesystem.Storage)
+		if !ok {
+			return errors.New("storer does not implement filesystem.Storage")
+		}
+
+		gitDir, err := filepath.Abs(store.Filesystem().Root())
+		if err != nil {
+			return err
+		}
+
+		// Like git, the hooks are told which index is committed, and that
+		// no editor is run.
+		indexFile := filepath.Join(gitDir, "index")
+		env := []string{"GIT_INDEX_FILE=" + hookPath(r, indexFile), "GIT_EDITOR=:"}
+		postEnv := env
+
+		hs := newHooks(r, cmd.ErrOrStderr())
+
+		// With -a, the files are staged in the lock of the index, which
+		// only replaces it once committed.
+		lock := ""
+		if commitAll {
+			lock = indexFile + ".lock"
+
+			err = stageTracked(r, lock, cmd.ErrOrStderr())
+			if err != nil {
+				return err
+			}
+			defer os.Remove(lock)
+
+			env = []string{"GIT_INDEX_FILE=" + lock, "GIT_EDITOR=:"}
+		}
+
+		if !commitNoVerify {
+			err = hs.run(hook{name: "pre-commit", env: env})
+			if err != nil {
+				return hookFailed(cmd, err)
+			}
+		}
+
+		// The index is read after pre-commit, which may have changed it.
+		idx, err := r.Storer.Index()
+		if lock != "" {
+			idx, err = readIndexFile(r, lock)
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to read index: %w", err)
+		}
+
+		for _, e := range idx.Entries {
+			if e.Stage != 0 {
+				fmt.Fprintln(cmd.ErrOrStderr(), "error: Committing is not possible because you have unmerged files.")
+				cmd.SilenceErrors = true
+				cmd.SilenceUsage = true
+
+				return exitStatus(128)
+			}
+		}
+
+		tree, err := writeIndexTree(r, idx.Entries, "", false)
+		if err != nil {
+			return err
+		}
+
+		head, err := r.Storer.Reference(plumbing.HEAD)
+		if err != nil {
+			return fmt.Errorf("failed to read HEAD: %w", err)
+		}
+
+		var parent *object.Commit
+
+		if resolved, err := r.Reference(plumbing.HEAD, true); err == nil {
+			parent, err = r.CommitObject(resolved.Hash())
+			if err != nil {
+				return fmt.Errorf("failed to read HEAD commit: %w", err)
+			}
+		} else if !errors.Is(err, plumbing.ErrReferenceNotFound) {
+			return fmt.Errorf("failed to resolve HEAD: %w", err)
+		}
+
+		msg, err := commitMessage(cmd.InOrStdin())
+		if err != nil {
+			return err
+		}
+
+		msgFile := filepath.Join(gitDir, "COMMIT_EDITMSG")
+
+		err = os.WriteFile(msgFile, []byte(msg), 0o666)
+		if err != nil {
+			return fmt.Errorf("failed to write commit message: %w", err)
+		}
+
+		if !commitAllowEmpty && ((parent == nil && len(idx.Entries) == 0) || (parent != nil && parent.TreeHash == tree)) {
+			return nothingToCommit(cmd, r, head)
+		}
+
+		hookFile := hookPath(r, msgFile)
+
+		err = hs.run(hook{name: "prepare-commit-msg", args: []string{hookFile, "message"}, env: env})
+		if err != nil {
+			return hookFailed(cmd, err)
+		}
+
+		if !commitNoVerify {
+			err = hs.run(hook{name: "commit-msg", args: []string{hookFile}, env: env})
+			if err != nil {
+				return hookFailed(cmd, err)
+			}
+		}
+
+		// The message is read back, as the hooks may have edited it.
+		data, err := os.ReadFile(msgFile)
+		if err != nil {
+			return fmt.Errorf("failed to read commit message: %w", err)
+		}
+
+		msg = stripSpace(string(data))
+		if msg == "" && !commitAllowEmptyMessage {
+			fmt.Fprintln(cmd.ErrOrStderr(), "Aborting commit due to empty commit message.")
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+
+			return exitStatus(1)
+		}
+
+		c := &object.Commit{
+			Author:    signature(r, authorRole),
+			Committer: signature(r, committerRole),
+			TreeHash:  tree,
+			Message:   msg,
+		}
+
+		if parent != nil {
+			c.ParentHashes = []plumbing.Hash{parent.Hash}
+		}
+
+		h, err := storeObject(r.Storer, c)
+		if err != nil {
+			return fmt.Errorf("failed to write commit: %w", err)
+		}
+
+		c, err = r.CommitObject(h)
+		if err != nil {
+			return err
+		}
+
+		err = updateCommitHead(hs, head, parent, c)
+		if err != nil {
+			return err
+		}
+
+		if lock != "" {
+			err = os.Rename(lock, indexFile)
+			if err != nil {
+				return fmt.Errorf("failed to write index: %w", err)
+			}
+		}
+
+		_ = hs.run(hook{name: "post-commit", env: postEnv})
+
+		if commitQuiet {
+			return nil
+		}
+
+		return writeCommitSummary(cmd.OutOrStdout(), r, head, parent, c)
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// hookPath returns the path of a file of the repository as hooks are
+// given it: relative to the directory they run from when under it.
+func hookPath(r *git.Repository, p string) string {
+	if rel, err := filepath.Rel(hookDir(r), p); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+
+	return p
+}
+
+// stageTracked writes to the file lock the index updated with the changes
+// of the tracked files of the worktree, as add -u does. The file must not
+// exist.
+func stageTracked(r *git.Repository, lock string, errOut io.Writer) error {
+	w, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return fmt.Errorf("failed to read index: %w", err)
+	}
+
+	conv, err := newConverter(r, attrCheckin, errOut)
+	if err != nil {
+		return err
+	}
+	defer conv.Close()
+
+	s := &stager{r: r, fs: w.Filesystem, idx: idx, conv: conv}
+
+	var names []string
+
+	for _, e := range idx.Entries {
+		if len(names) == 0 || names[len(names)-1] != e.Name {
+			names = append(names, e.Name)
+		}
+	}
+
+	for _, name := range names {
+		err := s.stage(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	sortIndexEntries(idx)
+
+	f, err := os.OpenFile(lock, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o666)
+	if err != nil {
+		return fmt.Errorf("unable to create '%s': %w", lock, err)
+	}
+
+	err = writeIndexFile(r, f, idx)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		_ = os.Remove(lock)
+
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+
+	return nil
+}
+
+// readIndexFile reads the index file at path, such as a lock of the index
+// of r.
+func readIndexFile(r *git.Repository, path string) (*index.Index, error) {
+	of, err := packObjectFormat(r, "")
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	idx := &index.Index{}
+
+	err = index.NewDecoder(f, hash.New(objectFormatHash(of))).Decode(idx)
+	if err != nil {
+		return nil, err
+	}
+
+	return idx, nil
+}
+
+// writeIndexFile writes idx, an index of r, to w.
+func writeIndexFile(r *git.Repository, w io.Writer, idx *index.Index) error {
+	of, err := packObjectFormat(r, "")
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+
+	err = index.NewEncoder(bw, hash.New(objectFormatHash(of))).Encode(idx)
+	if err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// commitMessage builds the message from the -m paragraphs or the -F file,
+// cleaning up whitespace like git.
+func commitMessage(stdin io.Reader) (string, error) {
+	if commitFile == "" {
+		return stripSpace(strings.Join(commitMessages, "\n\n")), nil
+	}
+
+	var (
+		data []byte
+		err  error
+	)
+
+	if commitFile == "-" {
+		data, err = io.ReadAll(stdin)
+	} else {
+		data, err = os.ReadFile(commitFile)
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("could not read log file '%s': %w", commitFile, err)
+	}
+
+	return stripSpace(string(data)), nil
+}
+
+// updateCommitHead moves HEAD, or the branch it points to, from parent to
+// the new commit c, recording the move in the reflog.
+func updateCommitHead(hs *hooks, head *plumbing.Reference, parent, c *object.Commit) error {
+	r := hs.r
+
+	name := plumbing.HEAD
+	if head.Type() == plumbing.SymbolicReference {
+		name = head.Target()
+	}
+
+	var old *plumbing.Reference
+	if parent != nil {
+		old = plumbing.NewHashReference(name, parent.Hash)
+	}
+
+	before, err := snapshotRefs(r)
+	if err != nil {
+		return err
+	}
+
+	from := plumbing.ZeroHash
+	if parent != nil {
+		from = parent.Hash
+	}
+
+	updates := []string{refTransactionLine(plumbing.HEAD, from, c.Hash)}
+	if name != plumbing.HEAD {
+		updates = append(updates, refTransactionLine(name, from, c.Hash))
+	}
+
+	err = hs.prepareRefUpdates(updates)
+	if err != nil {
+		return err
+	}
+
+	err = r.Storer.CheckAndSetReference(plumbing.NewHashReference(name, c.Hash), old)
+	if err != nil {
+		_ = hs.referenceTransaction("aborted", updates)
+
+		return fmt.Errorf("cannot update ref '%s': %w", name, err)
+	}
+
+	action := "commit"
+	if parent == nil {
+		action = "commit (initial)"
+	}
+
+	return logRefUpdates(hs, before, staticReflogMessage(action+": "+commitSubject(c)))
+}
+
+// writeCommitSummary writes the line git shows for a new commit, followed
+// by the stat summary of its changes.
+func writeCommitSummary(out io.Writer, r *git.Repository, head *plumbing.Reference, parent, c *object.Commit) error {
+	branch := "detached HEAD"
+	if head.Type() == plumbing.SymbolicReference {
+		branch = head.Target().Short()
+	}
+
+	var from plumbing.Hash
+
+	if parent == nil {
+		branch += " (root-commit)"
+	} else {
+		from = parent.TreeHash
+	}
+
+	fmt.Fprintf(out, "[%s %s] %s\n", branch, abbreviateHash(r, c.Hash, 7), onelineSubject(c.Message))
+
+	changes, err := diffTrees(r, from, c.TreeHash, "")
+	if err != nil {
+		return err
+	}
+
+	diffs, err := fileDiffs(r, changes)
+	if err != nil {
+		return err
+	}
+
+	if len(diffs) == 0 {
+		return nil
+	}
+
+	added, deleted := 0, 0
+
+	for _, d := range diffs {
+		if !d.binary {
+			added += d.added
+			deleted += d.deleted
+		}
+	}
+
+	fmt.Fprintln(out, statSummary(len(diffs), added, deleted))
+	writeModeSummary(out, diffs)
+
+	return nil
+}
+
+// nothingToCommit reports that the index matches HEAD, the way git does,
+// and fails.
+func nothingToCommit(cmd *cobra.Command, r *git.Repository, head *plumbing.Reference) error {
+	out := cmd.OutOrStdout()
+
+	if head.Type() == plumbing.SymbolicReference {
+		fmt.Fprintf(out, "On branch %s\n", head.Target().Short())
+	} else {
+		fmt.Fprintf(out, "HEAD detached at %s\n", abbreviateHash(r, head.Hash(), 7))
+	}
+
+	modified, untracked := false, false
+
+	if status, err := worktreeStatus(r, cmd.ErrOrStderr()); err == nil {
+		for _, s := range status {
+			if s.Worktree == git.Untracked {
+				untracked = true
+			} else if s.Worktree != git.Unmodified {
+				modified = true
+			}
+		}
+	}
+
+	switch {
+	case modified:
+		fmt.Fprintln(out, "no changes added to commit")
+	case untracked:
+		fmt.Fprintln(out, "nothing added to commit but untracked files present")
+	default:
+		fmt.Fprintln(out, "nothing to commit, working tree clean")
+	}
+
+	cmd.SilenceErrors = true
+	cmd.SilenceUsage = true
+
+	return exitStatus(1)
+}
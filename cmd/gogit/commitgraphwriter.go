@@ -0,0 +1,427 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/bits"
+	"path"
+
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	formatgraph "github.com/go-git/go-git/v6/plumbing/format/commitgraph"
+	"github.com/go-git/go-git/v6/plumbing/object"
+)
+
+const (
+	// graphParentNone and graphParentOctopus mark, in the second parent
+	// of a commit, that it has no such parent or that its parents after
+	// the first are listed in the EDGE chunk.
+	graphParentNone    = 0x70000000
+	graphParentOctopus = 0x80000000
+	graphLastEdge      = 0x80000000
+
+	// generationOffsetMax is the largest corrected commit date offset the
+	// GDA2 chunk holds, larger ones being stored in the GDO2 chunk and
+	// flagged with generationOffsetOverflow.
+	generationOffsetMax      = 0x7FFFFFFF
+	generationOffsetOverflow = 0x80000000
+
+	// The settings of the changed-path Bloom filters git writes: version 1
+	// of the hash, 7 hashes and 10 bits per path, a commit changing more
+	// than 512 paths getting a filter matching all of them.
+	bloomHashVersion     = 1
+	bloomNumHashes       = 7
+	bloomBitsPerEntry    = 10
+	bloomMaxChangedPaths = 512
+)
+
+// commitGraphLayer is a commit-graph file: the single one of the repository
+// or a layer of its chain.
+type commitGraphLayer struct {
+	name   string
+	sum    string
+	hashes []plumbing.Hash
+	bloom  bool
+}
+
+// readCommitGraphLayers returns the files of the commit-graph of the
+// repository, the base of the chain first.
+func readCommitGraphLayers(fs billy.Filesystem) ([]*commitGraphLayer, error) {
+	files, err := commitGraphFiles(fs)
+	if err != nil {
+		return nil, err
+	}
+
+	layers := make([]*commitGraphLayer, 0, len(files))
+
+	for _, name := range files {
+		content, err := util.ReadFile(fs, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+
+		chunks, err := commitGraphChunks(content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+
+		l := &commitGraphLayer{
+			name:  name,
+			sum:   hex.EncodeToString(content[len(content)-crypto.SHA1.Size():]),
+			bloom: chunks["BIDX"] != nil && chunks["BDAT"] != nil,
+		}
+
+		lookup := chunks["OIDL"]
+		for i := 0; i+crypto.SHA1.Size() <= len(lookup); i += crypto.SHA1.Size() {
+			h, _ := plumbing.FromBytes(lookup[i : i+crypto.SHA1.Size()])
+			l.hashes = append(l.hashes, h)
+		}
+
+		layers = append(layers, l)
+	}
+
+	return layers, nil
+}
+
+// commitGraphChunks returns the chunks of the commit-graph file content.
+func commitGraphChunks(content []byte) (map[string][]byte, error) {
+	size := crypto.SHA1.Size()
+
+	if len(content) < 8+size || !bytes.HasPrefix(content, []byte("CGPH")) {
+		return nil, errors.New("bad signature")
+	}
+
+	count := int(content[6])
+	end := uint64(len(content) - size)
+
+	if len(content) < 8+(count+1)*12 {
+		return nil, errors.New("chunk table out of bounds")
+	}
+
+	chunks := make(map[string][]byte, count)
+
+	for i := range count {
+		entry := content[8+i*12:]
+		start := binary.BigEndian.Uint64(entry[4:])
+		stop := binary.BigEndian.Uint64(entry[16:])
+
+		if start > stop || stop > end {
+			return nil, fmt.Errorf("chunk %s out of bounds", entry[:4])
+		}
+
+		chunks[string(entry[:4])] = content[start:stop]
+	}
+
+	return chunks, nil
+}
+
+// commitGraphLayerPath returns the path of the layer of the chain whose
+// checksum is sum.
+func commitGraphLayerPath(sum string) string {
+	return path.Join(commitGraphsDir, "graph-"+sum+".graph")
+}
+
+type graphChunk struct {
+	id   string
+	data []byte
+}
+
+// encodeCommitGraph returns the commit-graph file of the commits hashes,
+// sorted, in the format git writes: a header, the chunk table and the
+// OIDF, OIDL, CDAT, GDA2, GDO2, EDGE, BIDX, BDAT and BASE chunks, the last
+// ones only when needed. The parents of the commits are either among them
+// or in the base layers, which come first in the positions of the chain.
+// The changed-path Bloom filters are written when filters is not nil.
+func encodeCommitGraph(hashes []plumbing.Hash, data map[plumbing.Hash]*formatgraph.CommitData, bases []*commitGraphLayer, filters [][]byte) []byte {
+	positions := make(map[plumbing.Hash]uint32)
+
+	var position uint32
+
+	for _, l := range bases {
+		for _, h := range l.hashes {
+			positions[h] = position
+			position++
+		}
+	}
+
+	for _, h := range hashes {
+		positions[h] = position
+		position++
+	}
+
+	fanout := make([]byte, 256*4)
+	lookup := make([]byte, 0, len(hashes)*crypto.SHA1.Size())
+
+	var count [256]uint32
+
+	for _, h := range hashes {
+		count[h.Bytes()[0]]++
+		lookup = append(lookup, h.Bytes()...)
+	}
+
+	var total uint32
+
+	for i, n := range count {
+		total += n
+		binary.BigEndian.PutUint32(fanout[i*4:], total)
+	}
+
+	var commits, generations, overflows, edges []byte
+
+	for _, h := range hashes {
+		d := data[h]
+
+		commits = append(commits, d.TreeHash.Bytes()...)
+
+		parents := []uint32{graphParentNone, graphParentNone}
+		for i, p := range d.ParentHashes {
+			if i < 2 {
+				parents[i] = positions[p]
+			}
+		}
+
+		if len(d.ParentHashes) > 2 {
+			parents[1] = graphParentOctopus | uint32(len(edges)/4)
+
+			for i, p := range d.ParentHashes[1:] {
+				edge := positions[p]
+				if i == len(d.ParentHashes)-2 {
+					edge |= graphLastEdge
+				}
+
+				edges = binary.BigEndian.AppendUint32(edges, edge)
+			}
+		}
+
+		date := uint64(d.When.Unix())
+
+		commits = binary.BigEndian.AppendUint32(commits, parents[0])
+		commits = binary.BigEndian.AppendUint32(commits, parents[1])
+		commits = binary.BigEndian.AppendUint32(commits, uint32(d.Generation<<2|date>>32&3))
+		commits = binary.BigEndian.AppendUint32(commits, uint32(date))
+
+		offset := d.GenerationV2 - date
+		if offset > generationOffsetMax {
+			generations = binary.BigEndian.AppendUint32(generations, generationOffsetOverflow|uint32(len(overflows)/8))
+			overflows = binary.BigEndian.AppendUint64(overflows, offset)
+		} else {
+			generations = binary.BigEndian.AppendUint32(generations, uint32(offset))
+		}
+	}
+
+	chunks := []graphChunk{
+		{"OIDF", fanout},
+		{"OIDL", lookup},
+		{"CDAT", commits},
+		{"GDA2", generations},
+	}
+
+	if len(overflows) > 0 {
+		chunks = append(chunks, graphChunk{"GDO2", overflows})
+	}
+
+	if len(edges) > 0 {
+		chunks = append(chunks, graphChunk{"EDGE", edges})
+	}
+
+	if filters != nil {
+		var index []byte
+
+		bloom := binary.BigEndian.AppendUint32(nil, bloomHashVersion)
+		bloom = binary.BigEndian.AppendUint32(bloom, bloomNumHashes)
+		bloom = binary.BigEndian.AppendUint32(bloom, bloomBitsPerEntry)
+
+		for _, f := range filters {
+			bloom = append(bloom, f...)
+			index = binary.BigEndian.AppendUint32(index, uint32(len(bloom)-12))
+		}
+
+		chunks = append(chunks, graphChunk{"BIDX", index}, graphChunk{"BDAT", bloom})
+	}
+
+	if len(bases) > 0 {
+		var list []byte
+
+		for _, l := range bases {
+			sum, _ := hex.DecodeString(l.sum)
+			list = append(list, sum...)
+		}
+
+		chunks = append(chunks, graphChunk{"BASE", list})
+	}
+
+	b := []byte("CGPH")
+	b = append(b, 1, 1, byte(len(chunks)), byte(len(bases)))
+
+	offset := uint64(len(b) + (len(chunks)+1)*12)
+
+	for _, c := range chunks {
+		b = append(b, c.id...)
+		b = binary.BigEndian.AppendUint64(b, offset)
+		offset += uint64(len(c.data))
+	}
+
+	b = append(b, 0, 0, 0, 0)
+	b = binary.BigEndian.AppendUint64(b, offset)
+
+	for _, c := range chunks {
+		b = append(b, c.data...)
+	}
+
+	sum := crypto.SHA1.New()
+	sum.Write(b)
+
+	return sum.Sum(b)
+}
+
+// changedPathFilters returns the changed-path Bloom filters of the commits
+// hashes: the paths, and their leading directories, that differ between
+// each commit and its first parent.
+func changedPathFilters(r *git.Repository, hashes []plumbing.Hash) ([][]byte, error) {
+	filters := make([][]byte, 0, len(hashes))
+
+	for _, h := range hashes {
+		paths, err := changedPaths(r, h)
+		if err != nil {
+			return nil, err
+		}
+
+		filters = append(filters, bloomFilter(paths))
+	}
+
+	return filters, nil
+}
+
+// changedPaths returns the paths changed by the commit h, or nil when it
+// changes more paths than a filter holds.
+func changedPaths(r *git.Repository, h plumbing.Hash) (map[string]bool, error) {
+	c, err := r.CommitObject(h)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read commit %s: %w", h, err)
+	}
+
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tree of %s: %w", h, err)
+	}
+
+	var parent *object.Tree
+
+	if len(c.ParentHashes) > 0 {
+		p, err := r.CommitObject(c.ParentHashes[0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read commit %s: %w", c.ParentHashes[0], err)
+		}
+
+		parent, err = p.Tree()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tree of %s: %w", p.Hash, err)
+		}
+	}
+
+	changes, err := object.DiffTree(parent, tree)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff %s: %w", h, err)
+	}
+
+	if len(changes) > bloomMaxChangedPaths {
+		return nil, nil
+	}
+
+	paths := make(map[string]bool)
+
+	for _, change := range changes {
+		name := change.To.Name
+		if name == "" {
+			name = change.From.Name
+		}
+
+		for p := name; p != "."; p = path.Dir(p) {
+			paths[p] = true
+		}
+	}
+
+	return paths, nil
+}
+
+// bloomFilter returns the Bloom filter of paths, or the filter matching all
+// the paths when paths is nil.
+func bloomFilter(paths map[string]bool) []byte {
+	if paths == nil {
+		return []byte{0xff}
+	}
+
+	filter := make([]byte, max((len(paths)*bloomBitsPerEntry+7)/8, 1))
+	size := uint64(len(filter)) * 8
+
+	for p := range paths {
+		hash0 := bloomMurmur3(0x293ae76f, []byte(p))
+		hash1 := bloomMurmur3(0x7e646e2c, []byte(p))
+
+		for i := range uint32(bloomNumHashes) {
+			bit := uint64(hash0+i*hash1) % size
+			filter[bit/8] |= 1 << (bit % 8)
+		}
+	}
+
+	return filter
+}
+
+// bloomMurmur3 is the 32-bit murmur3 hash of version 1 of git's changed-path
+// filters, which reads the bytes of data as signed chars.
+func bloomMurmur3(seed uint32, data []byte) uint32 {
+	const (
+		c1 = 0xcc9e2d51
+		c2 = 0x1b873593
+	)
+
+	char := func(i int) uint32 {
+		return uint32(int32(int8(data[i])))
+	}
+
+	mix := func(k uint32) uint32 {
+		return bits.RotateLeft32(k*c1, 15) * c2
+	}
+
+	blocks := len(data) / 4
+
+	for i := range blocks {
+		k := char(4*i) | char(4*i+1)<<8 | char(4*i+2)<<16 | char(4*i+3)<<24
+
+		seed ^= mix(k)
+		seed = bits.RotateLeft32(seed, 13)*5 + 0xe6546b64
+	}
+
+	var k uint32
+
+	tail := 4 * blocks
+
+	switch len(data) & 3 {
+	case 3:
+		k ^= char(tail+2) << 16
+
+		fallthrough
+	case 2:
+		k ^= char(tail+1) << 8
+
+		fallthrough
+	case 1:
+		k ^= char(tail)
+		seed ^= mix(k)
+	}
+
+	seed ^= uint32(len(data))
+	seed ^= seed >> 16
+	seed *= 0x85ebca6b
+	seed ^= seed >> 13
+	seed *= 0xc2b2ae35
+	seed ^= seed >> 16
+
+	return seed
+}
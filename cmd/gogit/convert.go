@@ -0,0 +1,1142 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/format/index"
+	"github.com/go-git/go-git/v6/plumbing/format/pktline"
+	"github.com/go-git/go-git/v6/utils/convert"
+)
+
+// crlfAction is what is done to the line endings of a file, as in git's
+// convert.c.
+type crlfAction int
+
+const (
+	crlfUndefined crlfAction = iota
+	crlfBinary
+	crlfText
+	crlfTextInput
+	crlfTextCRLF
+	crlfAuto
+	crlfAutoInput
+	crlfAutoCRLF
+)
+
+// filterDriver is a filter.<driver> section of the configuration.
+type filterDriver struct {
+	name     string
+	clean    string
+	smudge   string
+	process  string
+	required bool
+
+	// lfs is set for the builtin Git LFS filter.
+	lfs bool
+}
+
+// convAttrs is the conversion the attributes of a path ask for.
+type convAttrs struct {
+	action crlfAction
+	ident  bool
+	driver *filterDriver
+}
+
+// converter converts the contents of files between the repository and the
+// worktree the way git does: the text, eol and crlf attributes with
+// core.autocrlf and core.eol convert line endings, ident expands $Id$ and
+// filter runs the clean and smudge commands or the long-running process
+// of a driver.
+type converter struct {
+	r      *git.Repository
+	root   string
+	attrs  *attrChecker
+	errOut io.Writer
+
+	autocrlf string
+	eol      string
+
+	drivers   map[string]*filterDriver
+	processes map[string]*filterProcess
+
+	// lfsStore and lfsEndpoint are opened on first use by the Git LFS
+	// filter.
+	lfsStore    *lfsStore
+	lfsEndpoint *lfsEndpoint
+}
+
+// newConverter returns a converter for the files of r, reading the
+// gitattributes files from source. It must be closed, for the filter
+// processes it starts to exit.
+func newConverter(r *git.Repository, source attrSource, errOut io.Writer) (*converter, error) {
+	attrs, err := newAttrChecker(r, source, errOut)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &converter{
+		r:         r,
+		attrs:     attrs,
+		errOut:    errOut,
+		autocrlf:  strings.ToLower(scopedConfigOption(r, "core", "", "autocrlf")),
+		eol:       strings.ToLower(scopedConfigOption(r, "core", "", "eol")),
+		drivers:   make(map[string]*filterDriver),
+		processes: make(map[string]*filterProcess),
+	}
+
+	// Filters run at the top of the worktree, if any.
+	if attrs.fs != nil {
+		c.root = attrs.fs.Root()
+	}
+
+	if c.autocrlf != "input" {
+		if ok, _ := strconv.ParseBool(c.autocrlf); ok {
+			c.autocrlf = "true"
+		} else {
+			c.autocrlf = "false"
+		}
+	}
+
+	return c, nil
+}
+
+// Close stops the filter processes.
+func (c *converter) Close() error {
+	var errs []error
+
+	for _, p := range c.processes {
+		errs = append(errs, p.stop())
+	}
+
+	clear(c.processes)
+
+	return errors.Join(errs...)
+}
+
+// toWorktree converts the contents of a blob into those of the file at
+// the path in the worktree.
+func (c *converter) toWorktree(name string, data []byte, blob plumbing.Hash) ([]byte, error) {
+	a := c.convAttrs(name)
+
+	if a.ident {
+		data = identToWorktree(data)
+	}
+
+	if c.outputEOL(a.action) == "crlf" {
+		data = crlfToWorktree(data, a.action)
+	}
+
+	if a.driver != nil {
+		out, ok := c.filter(a.driver, "smudge", name, data, blob)
+		switch {
+		case ok:
+			data = out
+		case a.driver.required:
+			return nil, fmt.Errorf("%s: smudge filter %s failed", name, a.driver.name)
+		}
+	}
+
+	return data, nil
+}
+
+// toGit converts the contents of the file at the path in the worktree
+// into those of its blob.
+func (c *converter) toGit(name string, data []byte) ([]byte, error) {
+	a := c.convAttrs(name)
+
+	if a.driver != nil {
+		out, ok := c.filter(a.driver, "clean", name, data, plumbing.ZeroHash)
+		switch {
+		case ok:
+			data = out
+		case a.driver.required:
+			return nil, fmt.Errorf("%s: clean filter '%s' failed", name, a.driver.name)
+		}
+	}
+
+	data = c.crlfToGit(name, data, a.action)
+
+	if a.ident {
+		data = identToGit(data)
+	}
+
+	return data, nil
+}
+
+// smudges reports whether the file at the path can differ from its blob.
+func (c *converter) smudges(name string) bool {
+	a := c.convAttrs(name)
+
+	return a.ident || a.driver != nil || c.outputEOL(a.action) == "crlf"
+}
+
+func (c *converter) convAttrs(name string) convAttrs {
+	values := c.attrs.attributes(name)
+
+	var a convAttrs
+
+	a.action = crlfAttr(values, "text")
+	if a.action == crlfUndefined {
+		a.action = crlfAttr(values, "crlf")
+	}
+
+	a.ident = values["ident"] == attrSet
+
+	if v, ok := values["filter"]; ok && !strings.HasPrefix(v, "\x00") {
+		a.driver = c.driver(v)
+	}
+
+	if a.action != crlfBinary {
+		eol := values["eol"]
+
+		switch {
+		case a.action == crlfAuto && eol == "lf":
+			a.action = crlfAutoInput
+		case a.action == crlfAuto && eol == "crlf":
+			a.action = crlfAutoCRLF
+		case eol == "lf":
+			a.action = crlfTextInput
+		case eol == "crlf":
+			a.action = crlfTextCRLF
+		}
+	}
+
+	switch {
+	case a.action == crlfText && c.textEOLIsCRLF():
+		a.action = crlfTextCRLF
+	case a.action == crlfText:
+		a.action = crlfTextInput
+	case a.action == crlfUndefined && c.autocrlf == "true":
+		a.action = crlfAutoCRLF
+	case a.action == crlfUndefined && c.autocrlf == "input":
+		a.action = crlfAutoInput
+	case a.action == crlfUndefined:
+		a.action = crlfBinary
+	}
+
+	return a
+}
+
+func crlfAttr(values map[string]string, name string) crlfAction {
+	switch values[name] {
+	case attrSet:
+		return crlfText
+	case attrUnset:
+		return crlfBinary
+	case "input":
+		return crlfTextInput
+	case "auto":
+		return crlfAuto
+	default:
+		return crlfUndefined
+	}
+}
+
+// driver returns the filter driver of the given name, or nil if it is not
+// configured.
+func (c *converter) driver(name string) *filterDriver {
+	d, ok := c.drivers[name]
+	if !ok {
+		d = &filterDriver{
+			name:    name,
+			clean:   scopedConfigOption(c.r, "filter", name, "clean"),
+			smudge:  scopedConfigOption(c.r, "filter", name, "smudge"),
+			process: scopedConfigOption(c.r, "filter", name, "process"),
+		}
+
+		d.required = scopedConfigBool(c.r, "filter", name, "required")
+
+		// Git LFS is builtin: its filter is used unless the driver runs
+		// another program than the git-lfs one git lfs install sets up.
+		if name == "lfs" && (d.clean == "" || isGitLFSCommand(d.clean)) &&
+			(d.smudge == "" || isGitLFSCommand(d.smudge)) &&
+			(d.process == "" || isGitLFSCommand(d.process)) {
+			d = &filterDriver{name: name, required: true, lfs: true}
+		}
+
+		if d.clean == "" && d.smudge == "" && d.process == "" && !d.required {
+			d = nil
+		}
+
+		c.drivers[name] = d
+	}
+
+	return d
+}
+
+func (c *converter) textEOLIsCRLF() bool {
+	switch {
+	case c.autocrlf == "true":
+		return true
+	case c.autocrlf == "input":
+		return false
+	case c.eol == "crlf":
+		return true
+	case c.eol == "lf":
+		return false
+	default:
+		return runtime.GOOS == "windows"
+	}
+}
+
+// outputEOL returns the line endings of the files of the worktree the
+// action asks for, "lf", "crlf" or none.
+func (c *converter) outputEOL(action crlfAction) string {
+	switch action {
+	case crlfBinary:
+		return ""
+	case crlfTextCRLF, crlfAutoCRLF, crlfUndefined:
+		return "crlf"
+	case crlfTextInput, crlfAutoInput:
+		return "lf"
+	default:
+		if c.textEOLIsCRLF() {
+			return "crlf"
+		}
+
+		return "lf"
+	}
+}
+
+// textStats counts what tells text from binary contents.
+type textStats struct {
+	nul, loneCR, loneLF, crlf int
+	printable, nonPrintable   int
+}
+
+func gatherTextStats(data []byte) textStats {
+	var s textStats
+
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+
+		switch {
+		case c == '\r':
+			if i+1 < len(data) && data[i+1] == '\n' {
+				s.crlf++
+				i++
+			} else {
+				s.loneCR++
+			}
+		case c == '\n':
+			s.loneLF++
+		case c == 0x7f:
+			s.nonPrintable++
+		case c == '\b' || c == '\t' || c == 0x1b || c == '\f':
+			s.printable++
+		case c == 0:
+			s.nul++
+			s.nonPrintable++
+		case c < 0x20:
+			s.nonPrintable++
+		default:
+			s.printable++
+		}
+	}
+
+	// A trailing ^Z is an end of file marker.
+	if len(data) > 0 && data[len(data)-1] == 0x1a {
+		s.nonPrintable--
+	}
+
+	return s
+}
+
+func (s textStats) binary() bool {
+	return s.loneCR > 0 || s.nul > 0 || s.printable>>7 < s.nonPrintable
+}
+
+func isAutoCRLF(action crlfAction) bool {
+	return action == crlfAuto || action == crlfAutoInput || action == crlfAutoCRLF
+}
+
+// crlfToWorktree turns the lone LFs of data into CRLFs. With auto, files
+// that already have CRs or look binary are left alone.
+func crlfToWorktree(data []byte, action crlfAction) []byte {
+	s := gatherTextStats(data)
+	if s.loneLF == 0 {
+		return data
+	}
+
+	if isAutoCRLF(action) && (s.loneCR > 0 || s.crlf > 0 || s.binary()) {
+		return data
+	}
+
+	out := make([]byte, 0, len(data)+s.loneLF)
+
+	for i, c := range data {
+		if c == '\n' && (i == 0 || data[i-1] != '\r') {
+			out = append(out, '\r')
+		}
+
+		out = append(out, c)
+	}
+
+	return out
+}
+
+// crlfToGit turns the CRLFs of data into LFs. With auto, files that look
+// binary or whose blob in the index already has CRLFs are left alone.
+func (c *converter) crlfToGit(name string, data []byte, action crlfAction) []byte {
+	if action == crlfBinary || len(data) == 0 {
+		return data
+	}
+
+	s := gatherTextStats(data)
+	if s.crlf == 0 {
+		return data
+	}
+
+	auto := isAutoCRLF(action)
+	if auto && (s.binary() || c.hasCRLFInIndex(name)) {
+		return data
+	}
+
+	out := make([]byte, 0, len(data))
+
+	for i, b := range data {
+		// Files with lone CRs are binary to auto, which drops all CRs.
+		if b == '\r' && (auto || (i+1 < len(data) && data[i+1] == '\n')) {
+			continue
+		}
+
+		out = append(out, b)
+	}
+
+	return out
+}
+
+func (c *converter) hasCRLFInIndex(name string) bool {
+	for _, e := range c.attrs.idx.Entries {
+		if e.Name != name || e.Stage != 0 {
+			continue
+		}
+
+		data, err := readBlob(c.r, e.Hash)
+		if err != nil || !bytes.Contains(data, []byte("\r")) {
+			return false
+		}
+
+		s := gatherTextStats(data)
+
+		return !s.binary() && s.crlf > 0
+	}
+
+	return false
+}
+
+// countIdents counts the $Id$ and $Id: ... $ keywords of data.
+func countIdents(data []byte) int {
+	n := 0
+
+	for i := 0; i < len(data); i++ {
+		if data[i] != '$' {
+			continue
+		}
+
+		rest := data[i+1:]
+		if len(rest) < 3 {
+			break
+		}
+
+		if !bytes.HasPrefix(rest, []byte("Id")) {
+			continue
+		}
+
+		i += 3
+
+		switch rest[2] {
+		case '$':
+			n++
+		case ':':
+			for i++; i < len(data); i++ {
+				if data[i] == '$' {
+					n++
+
+					break
+				}
+
+				if data[i] == '\n' {
+					break
+				}
+			}
+		}
+	}
+
+	return n
+}
+
+// identToWorktree expands the $Id$ keywords of data into $Id: <blob> $.
+// Keywords already expanded by other systems are left alone.
+func identToWorktree(data []byte) []byte {
+	if countIdents(data) == 0 {
+		return data
+	}
+
+	id := []byte("Id: " + blobHash(data).String() + " $")
+
+	var out []byte
+
+	for {
+		dollar := bytes.IndexByte(data, '$')
+		if dollar < 0 {
+			break
+		}
+
+		out = append(out, data[:dollar+1]...)
+		data = data[dollar+1:]
+
+		if len(data) < 3 || !bytes.HasPrefix(data, []byte("Id")) {
+			continue
+		}
+
+		switch data[2] {
+		case '$':
+			data = data[3:]
+		case ':':
+			end := bytes.IndexByte(data[3:], '$')
+			if end < 0 {
+				out = append(out, data...)
+
+				return out
+			}
+
+			end += 3
+
+			if bytes.IndexByte(data[3:end], '\n') >= 0 {
+				continue
+			}
+
+			// Spaces elsewhere than around the id are likely those of an
+			// id of another version control system.
+			if end >= 4 {
+				if spc := bytes.IndexByte(data[4:end], ' '); spc >= 0 && spc+4 < end-1 {
+					continue
+				}
+			}
+
+			data = data[end+1:]
+		default:
+			continue
+		}
+
+		out = append(out, id...)
+	}
+
+	return append(out, data...)
+}
+
+// identToGit collapses the expanded $Id: ... $ keywords of data into
+// $Id$.
+func identToGit(data []byte) []byte {
+	if countIdents(data) == 0 {
+		return data
+	}
+
+	var out []byte
+
+	for {
+		dollar := bytes.IndexByte(data, '$')
+		if dollar < 0 {
+			break
+		}
+
+		out = append(out, data[:dollar+1]...)
+		data = data[dollar+1:]
+
+		if len(data) <= 3 || !bytes.HasPrefix(data, []byte("Id:")) {
+			continue
+		}
+
+		end := bytes.IndexByte(data[3:], '$')
+		if end < 0 {
+			break
+		}
+
+		end += 3
+
+		if bytes.IndexByte(data[3:end], '\n') >= 0 {
+			continue
+		}
+
+		out = append(out, "Id$"...)
+		data = data[end+1:]
+	}
+
+	return append(out, data...)
+}
+
+// filter runs the clean or smudge command of a driver, or its process, on
+// data. It reports whether data was filtered.
+func (c *converter) filter(d *filterDriver, command, name string, data []byte, blob plumbing.Hash) ([]byte, bool) {
+	script := d.clean
+	if command == "smudge" {
+		script = d.smudge
+	}
+
+	switch {
+	case d.lfs:
+		return c.lfsFilter(command, name, data)
+	case d.process == "" && script != "":
+		return c.runFilter(script, name, data)
+	case d.process != "":
+		return c.processFilter(d.process, command, name, data, blob)
+	default:
+		return nil, false
+	}
+}
+
+// runFilter runs a clean or smudge command in the top directory of the
+// worktree, with %f replaced by the quoted path of the file.
+func (c *converter) runFilter(script, name string, data []byte) ([]byte, bool) {
+	var sb strings.Builder
+
+	for i := 0; i < len(script); i++ {
+		switch {
+		case script[i] != '%' || i+1 == len(script):
+			sb.WriteByte(script[i])
+		case script[i+1] == '%':
+			sb.WriteByte('%')
+			i++
+		case script[i+1] == 'f':
+			sb.WriteString("'" + strings.ReplaceAll(name, "'", `'\''`) + "'")
+			i++
+		default:
+			sb.WriteByte('%')
+		}
+	}
+
+	cmd := exec.Command("sh", "-c", sb.String())
+	cmd.Dir = c.root
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stderr = c.errOut
+
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			fmt.Fprintf(c.errOut, "error: external filter '%s' failed %d\n", script, exitErr.ExitCode())
+		}
+
+		fmt.Fprintf(c.errOut, "error: external filter '%s' failed\n", script)
+
+		return nil, false
+	}
+
+	return out, true
+}
+
+// processFilter filters data through the long-running process of a
+// driver, started on first use.
+func (c *converter) processFilter(command, capability, name string, data []byte, blob plumbing.Hash) ([]byte, bool) {
+	p, ok := c.processes[command]
+	if !ok {
+		var err error
+
+		p, err = startFilterProcess(command, c.root, c.errOut)
+		if err != nil {
+			fmt.Fprintf(c.errOut, "error: %v\n", err)
+			fmt.Fprintf(c.errOut, "error: initialization for subprocess '%s' failed\n", command)
+
+			return nil, false
+		}
+
+		c.processes[command] = p
+	}
+
+	if !p.capabilities[capability] {
+		return nil, false
+	}
+
+	out, status, err := p.filter(capability, name, data, blob)
+
+	switch {
+	case err == nil && status == "success":
+		return out, true
+	case err == nil && status == "error":
+		// The process failed to filter this file only.
+	case err == nil && status == "abort":
+		delete(p.capabilities, capability)
+	default:
+		fmt.Fprintf(c.errOut, "error: external filter '%s' failed\n", command)
+
+		_ = p.stop()
+
+		delete(c.processes, command)
+	}
+
+	return nil, false
+}
+
+// filterProcess is a filter driver process, talking the version 2 of the
+// long-running filter protocol over pkt-lines.
+type filterProcess struct {
+	cmd          *exec.Cmd
+	in           io.WriteCloser
+	out          *bufio.Reader
+	capabilities map[string]bool
+}
+
+func startFilterProcess(command, dir string, errOut io.Writer) (*filterProcess, error) {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Dir = dir
+	cmd.Stderr = errOut
+
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("cannot fork to run subprocess '%s': %w", command, err)
+	}
+
+	p := &filterProcess{cmd: cmd, in: in, out: bufio.NewReader(out), capabilities: make(map[string]bool)}
+
+	err = p.handshake()
+	if err != nil {
+		_ = p.stop()
+
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (p *filterProcess) handshake() error {
+	err := p.writeLines("git-filter-client", "version=2")
+	if err != nil {
+		return err
+	}
+
+	lines, err := p.readLines()
+	if err != nil {
+		return err
+	}
+
+	if len(lines) == 0 || lines[0] != "git-filter-server" {
+		return fmt.Errorf("unexpected line '%s', expected git-filter-server", strings.Join(lines[:min(len(lines), 1)], ""))
+	}
+
+	if !slices.Contains(lines[1:], "version=2") {
+		return errors.New("git-filter-server does not support version 2")
+	}
+
+	err = p.writeLines("capability=clean", "capability=smudge")
+	if err != nil {
+		return err
+	}
+
+	lines, err = p.readLines()
+	if err != nil {
+		return err
+	}
+
+	for _, line := range lines {
+		if c, ok := strings.CutPrefix(line, "capability="); ok {
+			p.capabilities[c] = true
+		}
+	}
+
+	return nil
+}
+
+// filter sends a file to the process and returns the filtered contents
+// with the status the process answered.
+func (p *filterProcess) filter(command, name string, data []byte, blob plumbing.Hash) ([]byte, string, error) {
+	lines := []string{"command=" + command, "pathname=" + name}
+	if !blob.IsZero() {
+		lines = append(lines, "blob="+blob.String())
+	}
+
+	err := p.writeLines(lines...)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for len(data) > 0 {
+		n := min(len(data), pktline.MaxPayloadSize)
+
+		_, err = pktline.Write(p.in, data[:n])
+		if err != nil {
+			return nil, "", err
+		}
+
+		data = data[n:]
+	}
+
+	err = pktline.WriteFlush(p.in)
+	if err != nil {
+		return nil, "", err
+	}
+
+	status, err := p.readStatus("")
+	if err != nil || status != "success" {
+		return nil, status, err
+	}
+
+	var out []byte
+
+	for {
+		l, chunk, err := pktline.ReadLine(p.out)
+
+		var errLine *pktline.ErrorLine
+		if err != nil && !errors.As(err, &errLine) {
+			return nil, "", err
+		}
+
+		if l == pktline.Flush {
+			break
+		}
+
+		out = append(out, chunk...)
+	}
+
+	// The process may change its mind once the contents are sent.
+	status, err = p.readStatus(status)
+
+	return out, status, err
+}
+
+// readStatus reads a list of key=value lines and returns the status it
+// gives, or else the previous one.
+func (p *filterProcess) readStatus(status string) (string, error) {
+	lines, err := p.readLines()
+	if err != nil {
+		return "", err
+	}
+
+	for _, line := range lines {
+		if s, ok := strings.CutPrefix(line, "status="); ok {
+			status = s
+		}
+	}
+
+	return status, nil
+}
+
+// writeLines writes each line in a packet, then a flush packet.
+func (p *filterProcess) writeLines(lines ...string) error {
+	for _, line := range lines {
+		_, err := pktline.Writeln(p.in, line)
+		if err != nil {
+			return err
+		}
+	}
+
+	return pktline.WriteFlush(p.in)
+}
+
+// readLines reads the packets up to a flush packet as lines.
+func (p *filterProcess) readLines() ([]string, error) {
+	var lines []string
+
+	for {
+		l, line, err := pktline.ReadLine(p.out)
+		if err != nil {
+			return nil, err
+		}
+
+		if l == pktline.Flush {
+			return lines, nil
+		}
+
+		lines = append(lines, strings.TrimSuffix(string(line), "\n"))
+	}
+}
+
+// stop closes the input of the process, which tells it to exit, and waits
+// for it.
+func (p *filterProcess) stop() error {
+	_ = p.in.Close()
+
+	err := p.cmd.Wait()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil
+		}
+	}
+
+	return err
+}
+
+// smudgeWorktree converts the files of the worktree of r that go-git
+// checked out as their raw blobs, and records their new size and time in
+// the index so that they are not taken for modified. Only the paths in
+// changed are looked at, or all of them when it is nil, as for a new
+// worktree.
+func smudgeWorktree(r *git.Repository, errOut io.Writer, changed map[string]bool) error {
+	w, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+
+	c, err := newConverter(r, attrCheckout, errOut)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	// data is the blob of e, and current what the checkout wrote of it.
+	type smudged struct {
+		e             *index.Entry
+		data, current []byte
+	}
+
+	var (
+		files   []smudged
+		objects []lfsPointer
+	)
+
+	idx := c.attrs.idx
+	written := false
+
+	for _, e := range idx.Entries {
+		if e.Stage != 0 || e.SkipWorktree || (e.Mode != filemode.Regular && e.Mode != filemode.Executable) {
+			continue
+		}
+
+		if changed != nil && !changed[e.Name] {
+			continue
+		}
+
+		current, err := util.ReadFile(w.Filesystem, e.Name)
+		if err != nil {
+			continue
+		}
+
+		data := current
+
+		// With core.autocrlf, go-git writes the text files with CRLFs
+		// whatever their attributes, which must be undone too.
+		if blobHash(current) != e.Hash {
+			if c.autocrlf != "true" {
+				continue
+			}
+
+			data, err = readBlob(r, e.Hash)
+			if err != nil {
+				return err
+			}
+
+			if !bytes.Equal(current, goGitAutoCRLF(data)) {
+				continue
+			}
+		} else if !c.smudges(e.Name) {
+			continue
+		}
+
+		files = append(files, smudged{e, data, current})
+
+		if p, ok := c.lfsMissing(e.Name, data); ok {
+			objects = append(objects, p)
+		}
+	}
+
+	// The Git LFS objects missing are downloaded at once rather than by
+	// the filter, one at a time.
+	if len(objects) > 0 {
+		err = c.lfsDownload(objects)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, f := range files {
+		e, data := f.e, f.data
+
+		out, err := c.toWorktree(e.Name, data, e.Hash)
+		if err != nil {
+			return err
+		}
+
+		if bytes.Equal(out, f.current) {
+			continue
+		}
+
+		err = writeWorktreeFile(w.Filesystem, e.Name, out, e.Mode)
+		if err != nil {
+			return err
+		}
+
+		fi, err := w.Filesystem.Lstat(e.Name)
+		if err != nil {
+			return err
+		}
+
+		e.Size = uint32(fi.Size())
+		e.ModifiedAt = fi.ModTime()
+		written = true
+	}
+
+	if !written {
+		return nil
+	}
+
+	return r.Storer.SetIndex(idx)
+}
+
+// worktreeStatus returns the status of the worktree of r, with the files
+// go-git takes for modified compared by their cleaned contents, as git
+// does.
+func worktreeStatus(r *git.Repository, errOut io.Writer) (git.Status, error) {
+	w, err := r.Worktree()
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := w.Status()
+	if err != nil {
+		return nil, err
+	}
+
+	clean, err := cleanSmudged(r, status, errOut)
+	if err != nil {
+		return nil, err
+	}
+
+	for name := range clean {
+		s := status.File(name)
+		s.Worktree = git.Unmodified
+
+		if s.Staging == git.Unmodified {
+			delete(status, name)
+		}
+	}
+
+	return status, nil
+}
+
+// cleanSmudged returns the files of status go-git takes for modified but
+// whose cleaned contents are those of their blob in the index. go-git
+// hashes a file as it is when it was written in the same tick of the clock
+// as the index, which a smudged file often is.
+func cleanSmudged(r *git.Repository, status git.Status, errOut io.Writer) (map[string]bool, error) {
+	var modified []string
+
+	for name, s := range status {
+		if s.Worktree == git.Modified {
+			modified = append(modified, name)
+		}
+	}
+
+	if len(modified) == 0 {
+		return nil, nil
+	}
+
+	w, err := r.Worktree()
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := newConverter(r, attrCheckin, errOut)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	clean := make(map[string]bool)
+
+	for _, name := range modified {
+		e, err := c.attrs.idx.Entry(name)
+		if err != nil || e.Stage != 0 || !c.smudges(name) {
+			continue
+		}
+
+		fi, err := w.Filesystem.Lstat(name)
+		if err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+
+		if mode, err := filemode.NewFromOSFileMode(fi.Mode()); err != nil || mode != e.Mode {
+			continue
+		}
+
+		data, err := util.ReadFile(w.Filesystem, name)
+		if err != nil {
+			continue
+		}
+
+		data, err = c.toGit(name, data)
+		if err != nil {
+			return nil, err
+		}
+
+		if blobHash(data) == e.Hash {
+			clean[name] = true
+		}
+	}
+
+	return clean, nil
+}
+
+// goGitAutoCRLF returns what go-git checks out of the blob data with
+// core.autocrlf set: its lone LFs turned into CRLFs, unless it looks
+// binary.
+func goGitAutoCRLF(data []byte) []byte {
+	stat, err := convert.GetStat(bytes.NewReader(data))
+	if err != nil || stat.IsBinary() {
+		return data
+	}
+
+	var buf bytes.Buffer
+
+	_, err = convert.NewCRLFWriter(&buf).Write(data)
+	if err != nil {
+		return data
+	}
+
+	return buf.Bytes()
+}
+
+// checkedOutPaths returns the files that differ between the commits from
+// and to, either of which may be zero, which is what a checkout from one
+// to the other writes.
+func checkedOutPaths(r *git.Repository, from, to plumbing.Hash) (map[string]bool, error) {
+	var trees [2]plumbing.Hash
+
+	for i, h := range []plumbing.Hash{from, to} {
+		if h.IsZero() {
+			continue
+		}
+
+		c, err := r.CommitObject(h)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read commit %s: %w", h, err)
+		}
+
+		trees[i] = c.TreeHash
+	}
+
+	changes, err := diffTrees(r, trees[0], trees[1], "")
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make(map[string]bool, len(changes))
+	for _, c := range changes {
+		paths[c.path] = true
+	}
+
+	return paths, nil
+}
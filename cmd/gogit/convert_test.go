@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v6/plumbing/format/pktline"
+)
+
+// testFilterEnv makes the test binary run a long-running filter process
+// instead of the tests. It upper-cases the files it smudges and lower-cases
+// those it cleans.
+const testFilterEnv = "GOGIT_TEST_FILTER"
+
+// filterProcessMain serves the long-running filter protocol of git on the
+// standard input and output.
+func filterProcessMain() error {
+	in, out := bufio.NewReader(os.Stdin), os.Stdout
+
+	readLines := func() ([]string, error) {
+		var lines []string
+
+		for {
+			l, line, err := pktline.ReadLine(in)
+			if err != nil {
+				return nil, err
+			}
+
+			if l == pktline.Flush {
+				return lines, nil
+			}
+
+			lines = append(lines, strings.TrimSuffix(string(line), "\n"))
+		}
+	}
+
+	writeLines := func(lines ...string) error {
+		for _, line := range lines {
+			_, err := pktline.Writeln(out, line)
+			if err != nil {
+				return err
+			}
+		}
+
+		return pktline.WriteFlush(out)
+	}
+
+	_, err := readLines()
+	if err != nil {
+		return err
+	}
+
+	err = writeLines("git-filter-server", "version=2")
+	if err != nil {
+		return err
+	}
+
+	_, err = readLines()
+	if err != nil {
+		return err
+	}
+
+	err = writeLines("capability=clean", "capability=smudge")
+	if err != nil {
+		return err
+	}
+
+	for {
+		header, err := readLines()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		var data []byte
+
+		for {
+			l, chunk, err := pktline.ReadLine(in)
+			if err != nil {
+				return err
+			}
+
+			if l == pktline.Flush {
+				break
+			}
+
+			data = append(data, chunk...)
+		}
+
+		if strings.Contains(header[0], "smudge") {
+			data = bytes.ToUpper(data)
+		} else {
+			data = bytes.ToLower(data)
+		}
+
+		err = writeLines("status=success")
+		if err != nil {
+			return err
+		}
+
+		if len(data) > 0 {
+			_, err = pktline.Write(out, data)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = pktline.WriteFlush(out)
+		if err != nil {
+			return err
+		}
+
+		err = writeLines()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// convertRepo returns a repository made by git whose files are committed
+// as they are, then given attributes converting their line endings,
+// expanding $Id$ and filtering them through commands and a long-running
+// process. Its files are not checked out until main is: the current
+// branch has none.
+func convertRepo(t *testing.T) string {
+	t.Helper()
+
+	dir := gitRepo(t, []string{
+		"crlf.txt", "one\ntwo\n",
+		"lf.lf", "one\r\ntwo\r\n",
+		"mixed.txt", "one\r\ntwo\n",
+		"auto.c", "int a;\nint b;\n",
+		"autocrlf.c", "int a;\r\nint b;\r\n",
+		"data.bin", "\x00one\ntwo\n",
+		"plain", "one\ntwo\n",
+		"id.c", "/* $Id$ */\n/* $Id: stale $ */\n",
+		"up.up", "lower case\n",
+		"proc.proc", "processed\n",
+	})
+
+	// Only .gitattributes is added: with it, the files written in the same
+	// second as the index would be taken for modified and cleaned.
+	writeFile(t, dir, ".gitattributes", "*.txt text eol=crlf\n*.lf text eol=lf\n*.c text=auto eol=crlf\n*.bin binary\n"+
+		"id.c ident\n*.up filter=up\n*.proc filter=proc\n")
+	gitCmd(t, dir, "add", ".gitattributes")
+	gitCmd(t, dir, "commit", "-q", "-m", "attributes")
+
+	gitCmd(t, dir, "config", "filter.up.smudge", "tr a-z A-Z")
+	gitCmd(t, dir, "config", "filter.up.clean", "tr A-Z a-z")
+	gitCmd(t, dir, "config", "filter.proc.process", testFilterEnv+"=1 '"+os.Args[0]+"'")
+	gitCmd(t, dir, "config", "filter.proc.required", "true")
+
+	gitCmd(t, dir, "checkout", "-q", "--orphan", "empty")
+	gitCmd(t, dir, "rm", "-q", "-r", "-f", ".")
+	gitCmd(t, dir, "commit", "-q", "--allow-empty", "-m", "empty")
+
+	return dir
+}
+
+// sameConvert runs the same steps in repositories made by convertRepo,
+// with git and with gogit, and checks that they leave the index and the
+// working tree alike.
+func sameConvert(t *testing.T, setup func(dir string), steps ...[]string) {
+	t.Helper()
+
+	var states []string
+
+	for _, tool := range []string{"git", "gogit"} {
+		dir := convertRepo(t)
+		if setup != nil {
+			setup(dir)
+		}
+
+		for _, args := range steps {
+			if tool == "git" {
+				gitCmd(t, dir, args...)
+			} else {
+				mustGogit(t, dir, args...)
+			}
+		}
+
+		states = append(states, worktreeState(t, dir))
+	}
+
+	if states[1] != states[0] {
+		t.Errorf("gogit %v gave:\n%s\nwant, as git:\n%s", steps, states[1], states[0])
+	}
+}
+
+func TestConvertCheckout(t *testing.T) {
+	sameConvert(t, nil, []string{"checkout", "main"})
+
+	dir := convertRepo(t)
+	mustGogit(t, dir, "checkout", "main")
+
+	for name, want := range map[string]string{"up.up": "LOWER CASE\n", "proc.proc": "PROCESSED\n"} {
+		if got := readFile(t, dir+"/"+name); got != want {
+			t.Errorf("gogit checked out %s as %q, want it filtered into %q", name, got, want)
+		}
+	}
+
+	// core.autocrlf and core.eol apply to the files without attributes.
+	for _, config := range [][]string{
+		{"core.autocrlf", "true"},
+		{"core.autocrlf", "input"},
+		{"core.eol", "crlf"},
+	} {
+		sameConvert(t, func(dir string) {
+			gitCmd(t, dir, "config", config[0], config[1])
+
+			var entries strings.Builder
+
+			for _, line := range strings.SplitAfter(gitCmd(t, dir, "ls-tree", "main"), "\n") {
+				if !strings.HasSuffix(line, "\t.gitattributes\n") {
+					entries.WriteString(line)
+				}
+			}
+
+			tree := strings.TrimSpace(gitCmdStdin(t, dir, entries.String(), "mktree"))
+			commit := strings.TrimSpace(gitCmd(t, dir, "commit-tree", "-p", "main", "-m", "no attributes", tree))
+			gitCmd(t, dir, "update-ref", "refs/heads/main", commit)
+		}, []string{"checkout", "main"})
+	}
+}
+
+func TestConvertClone(t *testing.T) {
+	src := convertRepo(t)
+	gitCmd(t, src, "checkout", "-q", "main")
+
+	var states []string
+
+	for _, tool := range []string{"git", "gogit"} {
+		dir := t.TempDir()
+
+		// The filters are configured globally for the clone to use them.
+		global := dir + "/gitconfig"
+		writeFile(t, dir, "gitconfig", readFile(t, src+"/.git/config"))
+
+		args := []string{"clone", src, dir + "/clone"}
+
+		var res result
+		if tool == "git" {
+			res = run(t, dir, "", "env", append([]string{"GIT_CONFIG_GLOBAL=" + global, "git"}, args...)...)
+		} else {
+			res = run(t, dir, "", "env", append([]string{"GIT_CONFIG_GLOBAL=" + global, os.Args[0]}, args...)...)
+		}
+
+		if res.code != 0 {
+			t.Fatalf("%s clone failed: %s", tool, res.stderr)
+		}
+
+		touchUnstable(t, dir+"/clone")
+		states = append(states, worktreeState(t, dir+"/clone"))
+	}
+
+	if states[1] != states[0] {
+		t.Errorf("gogit clone gave:\n%s\nwant, as git:\n%s", states[1], states[0])
+	}
+}
+
+// checkoutMain checks main out in a repository made by convertRepo, with
+// its unstable files made modified.
+func checkoutMain(t *testing.T, dir string) {
+	t.Helper()
+
+	gitCmd(t, dir, "checkout", "-q", "main")
+	writeFile(t, dir, "mixed.txt", "one\r\ntwo\r\n")
+	touchUnstable(t, dir)
+}
+
+// touchUnstable writes again the files of main whose contents do not
+// survive a checkout, lf.lf and id.c, and mixed.txt. Whether git takes them
+// for modified depends on when the index was written, in the same second as
+// them or not: they are written again to be modified either way.
+func touchUnstable(t *testing.T, dir string) {
+	t.Helper()
+
+	for _, name := range []string{"mixed.txt", "lf.lf", "id.c"} {
+		writeFile(t, dir, name, readFile(t, dir+"/"+name))
+	}
+}
+
+// TestConvertAdd checks that files are cleaned as git cleans them when
+// they are added, and that the files checked out are not modified.
+func TestConvertAdd(t *testing.T) {
+	edit := func(dir string) {
+		checkoutMain(t, dir)
+
+		for name, content := range map[string]string{
+			"crlf.txt":  "one\r\ntwo\r\nthree\r\n",
+			"lf.lf":     "one\r\ntwo\r\nthree\n",
+			"auto.c":    "int a;\r\nint c;\r\n",
+			"data.bin":  "\x00one\r\n",
+			"plain":     "one\r\n",
+			"id.c":      "/* $Id: 0123456789012345678901234567890123456789 $ */\n",
+			"up.up":     "UPPER CASE\n",
+			"proc.proc": "PROCESSED AGAIN\n",
+			"new.txt":   "new\r\n",
+		} {
+			writeFile(t, dir, name, content)
+		}
+	}
+
+	sameConvert(t, edit, []string{"add", "-A"})
+	sameConvert(t, edit, []string{"commit", "-q", "-a", "-m", "edited"})
+
+	sameConvert(t, func(dir string) { checkoutMain(t, dir) }, []string{"add", "-A"})
+}
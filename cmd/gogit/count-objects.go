@@ -0,0 +1,276 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/idxfile"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/spf13/cobra"
+)
+
+var (
+	countObjectsVerbose bool
+	countObjectsHuman   bool
+)
+
+func init() {
+	countObjectsCmd.Flags().BoolVarP(&countObjectsVerbose, "verbose", "v", false, "Report the packed objects and the garbage too")
+	countObjectsCmd.Flags().BoolVarP(&countObjectsHuman, "human-readable", "H", false, "Print the sizes in human-readable format")
+	rootCmd.AddCommand(countObjectsCmd)
+}
+
+var countObjectsCmd = &cobra.Command{
+	Use:   "count-objects [-v] [-H]",
+	Short: "Count the unpacked objects and their disk consumption",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		store, ok := r.Storer.(*filesystem.Storage)
+		if !ok {
+			return errors.New("storer does not implement filesystem.Storage")
+		}
+
+		of, err := packObjectFormat(r, "")
+		if err != nil {
+			return err
+		}
+
+		c := &objectCounter{store: store, hexSize: 2 * objectFormatHash(of).Size()}
+
+		var garbage io.Writer
+		if countObjectsVerbose {
+			garbage = cmd.ErrOrStderr()
+		}
+
+		err = c.countLoose(garbage)
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+
+		size := func(n int64) string {
+			if countObjectsHuman {
+				return humanSize(n)
+			}
+
+			return fmt.Sprint(n / 1024)
+		}
+
+		if !countObjectsVerbose {
+			if countObjectsHuman {
+				fmt.Fprintf(out, "%d objects, %s\n", len(c.loose), humanSize(c.looseSize))
+			} else {
+				fmt.Fprintf(out, "%d objects, %d kilobytes\n", len(c.loose), c.looseSize/1024)
+			}
+
+			return nil
+		}
+
+		indexes, err := readPackIndexes(store, of)
+		if err != nil {
+			return err
+		}
+
+		err = c.countPacked(indexes, garbage)
+		if err != nil {
+			return err
+		}
+
+		packable := 0
+
+		for _, h := range c.loose {
+			if packed(h, indexes, func(plumbing.Hash) bool { return true }) {
+				packable++
+			}
+		}
+
+		fmt.Fprintf(out, "count: %d\n", len(c.loose))
+		fmt.Fprintf(out, "size: %s\n", size(c.looseSize))
+		fmt.Fprintf(out, "in-pack: %d\n", c.inPack)
+		fmt.Fprintf(out, "packs: %d\n", c.packs)
+		fmt.Fprintf(out, "size-pack: %s\n", size(c.packSize))
+		fmt.Fprintf(out, "prune-packable: %d\n", packable)
+		fmt.Fprintf(out, "garbage: %d\n", c.garbage)
+		fmt.Fprintf(out, "size-garbage: %s\n", size(c.garbageSize))
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// objectCounter tallies the objects of a repository and the files in its
+// object directories that are not objects.
+type objectCounter struct {
+	store   *filesystem.Storage
+	hexSize int
+
+	loose     []plumbing.Hash
+	looseSize int64
+
+	packs    int
+	inPack   int64
+	packSize int64
+
+	garbage     int
+	garbageSize int64
+}
+
+// countLoose counts the loose objects and the disk space they use.
+func (c *objectCounter) countLoose(garbage io.Writer) error {
+	fs := c.store.Filesystem()
+
+	dirs, err := fs.ReadDir("objects")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	for _, d := range dirs {
+		if !d.IsDir() || len(d.Name()) != 2 || !isHexByte(d.Name()) {
+			continue
+		}
+
+		dir := path.Join("objects", d.Name())
+
+		entries, err := fs.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+
+		for _, e := range entries {
+			fi, err := e.Info()
+			if err != nil {
+				return err
+			}
+
+			if len(e.Name()) != c.hexSize-2 || !isHexByte(e.Name()) {
+				c.report(garbage, "garbage found", path.Join(dir, e.Name()), fi.Size())
+
+				continue
+			}
+
+			c.loose = append(c.loose, plumbing.NewHash(d.Name()+e.Name()))
+			c.looseSize += diskUsage(fi)
+		}
+	}
+
+	return nil
+}
+
+// countPacked counts the packs, their objects and the size of their packs
+// and indexes, and the files in the pack directory that belong to no pack.
+func (c *objectCounter) countPacked(indexes map[plumbing.Hash]*idxfile.MemoryIndex, garbage io.Writer) error {
+	fs := c.store.Filesystem()
+	dir := path.Join("objects", "pack")
+
+	entries, err := fs.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	files := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		files[e.Name()] = true
+	}
+
+	for _, e := range entries {
+		fi, err := e.Info()
+		if err != nil {
+			return err
+		}
+
+		name := e.Name()
+		if e.IsDir() || strings.HasPrefix(name, "multi-pack-index") {
+			continue
+		}
+
+		base, ext, _ := strings.Cut(name, ".")
+
+		switch ext {
+		case "pack", "idx":
+			missing := map[string]string{"pack": "idx", "idx": "pack"}[ext]
+			if !files[base+"."+missing] {
+				c.report(garbage, "no corresponding ."+missing, path.Join(dir, name), fi.Size())
+
+				continue
+			}
+
+			c.packSize += fi.Size()
+		case "keep", "rev", "bitmap", "promisor", "mtimes":
+			if !files[base+".pack"] {
+				c.report(garbage, "garbage found", path.Join(dir, name), fi.Size())
+			}
+		default:
+			c.report(garbage, "garbage found", path.Join(dir, name), fi.Size())
+		}
+	}
+
+	c.packs = len(indexes)
+
+	for pack, idx := range indexes {
+		n, err := idx.Count()
+		if err != nil {
+			return fmt.Errorf("failed to read index of pack %s: %w", pack, err)
+		}
+
+		c.inPack += n
+	}
+
+	return nil
+}
+
+// report counts the file name as garbage, and reports why to out when it
+// is not nil.
+func (c *objectCounter) report(out io.Writer, reason, name string, size int64) {
+	c.garbage++
+	c.garbageSize += size
+
+	if out == nil {
+		return
+	}
+
+	p := filepath.Join(c.store.Filesystem().Root(), name)
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, p); err == nil {
+			p = rel
+		}
+	}
+
+	fmt.Fprintf(out, "warning: %s: %s\n", reason, filepath.ToSlash(p))
+}
+
+// humanSize formats a size in bytes the way git does.
+func humanSize(n int64) string {
+	switch {
+	case n > 1<<30:
+		return fmt.Sprintf("%d.%02d GiB", n>>30, (n&(1<<30-1))/10737419)
+	case n > 1<<20:
+		x := n + 5243
+
+		return fmt.Sprintf("%d.%02d MiB", x>>20, (x&(1<<20-1))*100>>20)
+	case n > 1<<10:
+		x := n + 5
+
+		return fmt.Sprintf("%d.%02d KiB", x>>10, (x&(1<<10-1))*100>>10)
+	case n == 1:
+		return "1 byte"
+	default:
+		return fmt.Sprintf("%d bytes", n)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCountObjects(t *testing.T) {
+	dir := gcRepo(t)
+
+	// A loose object that is also packed, and files that are not objects.
+	gitCmd(t, dir, "repack", "-q", "-a")
+	writeFile(t, dir, "d3/f3", "new")
+	gitCmd(t, dir, "add", "d3/f3")
+	writeFile(t, dir, ".git/objects/pack/pack-garbage.tmp", "garbage")
+	writeFile(t, dir, ".git/objects/ab/not-an-object", "garbage")
+
+	for _, args := range []string{"", "-v", "-H", "-v -H"} {
+		t.Run(args, func(t *testing.T) {
+			sameOutput(t, dir, append([]string{"count-objects"}, strings.Fields(args)...)...)
+		})
+	}
+
+	// Like git, the garbage is named on the standard error.
+	res := gogit(t, dir, "count-objects", "-v")
+	for _, name := range []string{"pack-garbage.tmp", "not-an-object"} {
+		if !strings.Contains(res.stderr, name) {
+			t.Errorf("gogit count-objects -v did not report %s: %q", name, res.stderr)
+		}
+	}
+
+	err := os.RemoveAll(filepath.Join(dir, ".git", "objects"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.MkdirAll(filepath.Join(dir, ".git", "objects", "pack"), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sameOutput(t, dir, "count-objects", "-v")
+}
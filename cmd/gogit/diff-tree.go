@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/spf13/cobra"
+)
+
+var (
+	diffTreeRecursive  bool
+	diffTreeNameStatus bool
+	diffTreeRoot       bool
+	diffTreeStdin      bool
+)
+
+func init() {
+	diffTreeCmd.Flags().BoolVarP(&diffTreeRecursive, "recursive", "r", false, "Recurse into subtrees")
+	diffTreeCmd.Flags().BoolVarP(&diffTreeNameStatus, "name-status", "", false, "Show only the names and the status of changed files")
+	diffTreeCmd.Flags().BoolVarP(&diffTreeRoot, "root", "", false, "Show the initial commit as a big creation event")
+	diffTreeCmd.Flags().BoolVarP(&diffTreeStdin, "stdin", "", false, "Read commits, with optional parents, or pairs of trees from stdin")
+	rootCmd.AddCommand(diffTreeCmd)
+}
+
+var diffTreeCmd = &cobra.Command{
+	Use:   "diff-tree [-r] [--name-status] [--root] [--stdin] <tree-ish> [<tree-ish>]",
+	Short: "Compare the content and mode of blobs found via two tree objects",
+	Args:  cobra.MaximumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		d := &treeDiffer{r: r, out: cmd.OutOrStdout()}
+
+		switch {
+		case diffTreeStdin && len(args) > 0:
+			return errors.New("--stdin takes no tree-ish")
+		case diffTreeStdin:
+			return d.stdin(cmd.InOrStdin())
+		case len(args) == 0:
+			return errors.New("at least one tree-ish is needed")
+		case len(args) == 1:
+			c, err := resolveCommit(r, args[0])
+			if err != nil {
+				return err
+			}
+
+			return d.commit(c, c.ParentHashes)
+		}
+
+		from, err := resolvePeeled(r, args[0], plumbing.TreeObject.String())
+		if err != nil {
+			return fmt.Errorf("not a tree-ish: %s", args[0])
+		}
+
+		to, err := resolvePeeled(r, args[1], plumbing.TreeObject.String())
+		if err != nil {
+			return fmt.Errorf("not a tree-ish: %s", args[1])
+		}
+
+		return d.trees(from, to, "")
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// treeDiffer writes the changes between trees in git's raw diff format.
+type treeDiffer struct {
+	r   *git.Repository
+	out io.Writer
+}
+
+// commit writes the changes c makes to its only parent, under a line with
+// its id. Like git, merges are skipped, and root commits unless --root.
+func (d *treeDiffer) commit(c *object.Commit, parents []plumbing.Hash) error {
+	var from plumbing.Hash
+
+	switch {
+	case len(parents) > 1, len(parents) == 0 && !diffTreeRoot:
+		return nil
+	case len(parents) == 1:
+		p, err := d.r.CommitObject(parents[0])
+		if err != nil {
+			return fmt.Errorf("failed to read commit %s: %w", parents[0], err)
+		}
+
+		from = p.TreeHash
+	}
+
+	changes, err := d.changes(from, c.TreeHash)
+	if err != nil || len(changes) == 0 {
+		return err
+	}
+
+	fmt.Fprintln(d.out, c.Hash)
+	d.write(changes)
+
+	return nil
+}
+
+// trees writes the changes from one tree to another, under header if it
+// is not empty.
+func (d *treeDiffer) trees(from, to plumbing.Hash, header string) error {
+	changes, err := d.changes(from, to)
+	if err != nil {
+		return err
+	}
+
+	if header != "" {
+		fmt.Fprintln(d.out, header)
+	}
+
+	d.write(changes)
+
+	return nil
+}
+
+// stdin diffs each line of in: a commit against its parents or those the
+// line lists, or a tree against another. Like git, lines that do not start
+// with an object id are copied to the output.
+func (d *treeDiffer) stdin(in io.Reader) error {
+	sc := bufio.NewScanner(in)
+
+	for sc.Scan() {
+		line := sc.Text()
+		fields := strings.Fields(line)
+
+		var ids []plumbing.Hash
+
+		for _, f := range fields {
+			h, ok := plumbing.FromHex(f)
+			if !ok {
+				break
+			}
+
+			ids = append(ids, h)
+		}
+
+		if len(ids) == 0 || len(ids) != len(fields) {
+			fmt.Fprintln(d.out, line)
+
+			continue
+		}
+
+		obj, err := d.r.Object(plumbing.AnyObject, ids[0])
+		if err != nil {
+			return fmt.Errorf("failed to read object %s: %w", ids[0], err)
+		}
+
+		switch o := obj.(type) {
+		case *object.Commit:
+			parents := o.ParentHashes
+			if len(ids) > 1 {
+				parents = ids[1:]
+			}
+
+			err = d.commit(o, parents)
+		case *object.Tree:
+			if len(ids) != 2 {
+				return fmt.Errorf("need two trees, got %d", len(ids))
+			}
+
+			err = d.trees(o.Hash, ids[1], line)
+		default:
+			err = fmt.Errorf("object %s is a %s, not a commit or tree", ids[0], obj.Type())
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return sc.Err()
+}
+
+// changes returns the changes between two trees, with those below each
+// top-level directory folded into a change of the directory unless -r.
+func (d *treeDiffer) changes(from, to plumbing.Hash) ([]treeChange, error) {
+	changes, err := diffTrees(d.r, from, to, "")
+	if err != nil || diffTreeRecursive {
+		return changes, err
+	}
+
+	a, err := treeEntries(d.r, from)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := treeEntries(d.r, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var folded []treeChange
+
+	for _, ch := range changes {
+		dir, _, nested := strings.Cut(ch.path, "/")
+		if !nested {
+			folded = append(folded, ch)
+
+			continue
+		}
+
+		if n := len(folded); n > 0 && folded[n-1].path == dir {
+			continue
+		}
+
+		folded = append(folded, treeChange{path: dir, from: treeEntry(a, dir), to: treeEntry(b, dir)})
+	}
+
+	return folded, nil
+}
+
+func (d *treeDiffer) write(changes []treeChange) {
+	for _, ch := range changes {
+		status := 'M'
+
+		switch {
+		case ch.from.Hash.IsZero():
+			status = 'A'
+		case ch.to.Hash.IsZero():
+			status = 'D'
+		case fileType(ch.from.Mode) != fileType(ch.to.Mode):
+			status = 'T'
+		}
+
+		if diffTreeNameStatus {
+			fmt.Fprintf(d.out, "%c\t%s\n", status, quotePath(ch.path))
+
+			continue
+		}
+
+		fmt.Fprintf(d.out, ":%06o %06o %s %s %c\t%s\n",
+			uint32(ch.from.Mode), uint32(ch.to.Mode), ch.from.Hash, ch.to.Hash, status, quotePath(ch.path))
+	}
+}
+
+// treeEntry returns the directory entry name of entries, if any.
+func treeEntry(entries []object.TreeEntry, name string) object.TreeEntry {
+	for _, e := range entries {
+		if e.Name == name && e.Mode == filemode.Dir {
+			return e
+		}
+	}
+
+	return object.TreeEntry{}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// diffTreeRepo returns a repository made by git with changes at the top
+// and in nested directories, a rename, a type change and a merge.
+func diffTreeRepo(t *testing.T) string {
+	t.Helper()
+
+	dir := gitRepo(t,
+		[]string{"a", "1", "d/b", "1", "d/e/c", "1", "old", "moved\n"},
+		[]string{"a", "2", "d/e/c", "2", "d/new", "1"},
+	)
+
+	gitCmd(t, dir, "mv", "old", "d/renamed")
+	gitCmd(t, dir, "rm", "-q", "d/b")
+
+	err := os.Symlink("a", filepath.Join(dir, "a2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gitCmd(t, dir, "add", "-A")
+	gitCmd(t, dir, "commit", "-q", "-m", "move")
+
+	gitCmd(t, dir, "checkout", "-q", "-b", "side", "HEAD~1")
+	writeFile(t, dir, "side", "1")
+	gitCmd(t, dir, "add", "side")
+	gitCmd(t, dir, "commit", "-q", "-m", "side")
+	gitCmd(t, dir, "checkout", "-q", "main")
+	gitCmd(t, dir, "merge", "-q", "--no-edit", "side")
+
+	return dir
+}
+
+func TestDiffTree(t *testing.T) {
+	dir := diffTreeRepo(t)
+
+	for _, args := range []string{
+		"HEAD~2 HEAD~1",
+		"-r HEAD~2 HEAD~1",
+		"--name-status HEAD~2 HEAD~1",
+		"-r --name-status HEAD~2 HEAD~1",
+		"HEAD~1",
+		"-r HEAD~1",
+		"-r --name-status HEAD~1",
+		"HEAD~3",
+		"--root HEAD~3",
+		"-r --root HEAD~3",
+		"HEAD",
+		"-r HEAD^2 HEAD",
+		"HEAD~1^{tree} HEAD^{tree}",
+		"-r HEAD~1:d HEAD:d",
+	} {
+		t.Run(args, func(t *testing.T) {
+			sameOutput(t, dir, append([]string{"diff-tree"}, strings.Fields(args)...)...)
+		})
+	}
+}
+
+func TestDiffTreeStdin(t *testing.T) {
+	dir := diffTreeRepo(t)
+
+	rev := func(name string) string {
+		return strings.TrimSpace(gitCmd(t, dir, "rev-parse", name))
+	}
+
+	input := strings.Join([]string{
+		rev("HEAD~1"),
+		rev("HEAD~2") + " " + rev("HEAD~3"),
+		rev("HEAD~3"),
+		rev("HEAD~1^{tree}") + " " + rev("HEAD^{tree}"),
+		rev("HEAD"),
+		"",
+	}, "\n")
+
+	for _, args := range [][]string{
+		{"diff-tree", "--stdin"},
+		{"diff-tree", "--stdin", "-r", "--root"},
+		{"diff-tree", "--stdin", "-r", "--name-status"},
+	} {
+		want := run(t, dir, input, "git", args...)
+		if got := gogitStdin(t, dir, input, args...); got.stdout != want.stdout || got.code != want.code {
+			t.Errorf("gogit %v exited with %d:\n%s\nwant, as git, %d:\n%s", args, got.code, got.stdout, want.code, want.stdout)
+		}
+	}
+}
@@ -0,0 +1,798 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/spf13/cobra"
+)
+
+var (
+	fastExportAll         bool
+	fastExportSignedTags  string
+	fastExportAnonymize   bool
+	fastExportImportMarks string
+	fastExportExportMarks string
+)
+
+func init() {
+	fastExportCmd.Flags().BoolVarP(&fastExportAll, "all", "", false, "Export all references and HEAD")
+	fastExportCmd.Flags().StringVarP(&fastExportSignedTags, "signed-tags", "", "abort", "How to handle signed tags: verbatim, warn, warn-strip, strip or abort")
+	fastExportCmd.Flags().BoolVarP(&fastExportAnonymize, "anonymize", "", false, "Replace the contents, paths, names and messages with placeholders")
+	fastExportCmd.Flags().StringVarP(&fastExportImportMarks, "import-marks", "", "", "Read the marks of previously exported objects from the file")
+	fastExportCmd.Flags().StringVarP(&fastExportExportMarks, "export-marks", "", "", "Write the marks of the exported objects to the file")
+	rootCmd.AddCommand(fastExportCmd)
+}
+
+var fastExportCmd = &cobra.Command{
+	Use:   "fast-export [--all] [--signed-tags=<mode>] [--anonymize] [--import-marks=<file>] [--export-marks=<file>] [<revision-range>...]",
+	Short: "Export history as a fast-import stream",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		switch fastExportSignedTags {
+		case "verbatim", "warn", "warn-strip", "strip", "abort":
+		default:
+			return fmt.Errorf("unknown signed-tags mode: %s", fastExportSignedTags)
+		}
+
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		out := bufio.NewWriter(cmd.OutOrStdout())
+
+		e := &fastExporter{
+			r:      r,
+			out:    out,
+			errOut: cmd.ErrOrStderr(),
+			marks:  make(map[plumbing.Hash]int),
+		}
+
+		if fastExportAnonymize {
+			e.anon = newAnonymizer()
+		}
+
+		if fastExportImportMarks != "" {
+			err = e.importMarks(fastExportImportMarks)
+			if err != nil {
+				return err
+			}
+		}
+
+		w := &revWalk{r: r}
+
+		if fastExportAll {
+			err = w.addAll()
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, arg := range args {
+			err = w.addArg(arg)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = e.export(w)
+		if ferr := out.Flush(); err == nil {
+			err = ferr
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if fastExportExportMarks != "" {
+			return e.exportMarks(fastExportExportMarks)
+		}
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// fastExporter writes commits, the blobs they add and the references and
+// tags pointing at them as a fast-import stream. Every exported object gets
+// a mark, which later commands of the stream refer to it by.
+type fastExporter struct {
+	r      *git.Repository
+	out    *bufio.Writer
+	errOut io.Writer
+	anon   *anonymizer
+
+	marks    map[plumbing.Hash]int
+	lastMark int
+}
+
+// fastExportRef is a reference exported on its own, after the commits: a
+// branch pointing at a commit already exported under another name, or an
+// annotated tag.
+type fastExportRef struct {
+	name string
+	hash plumbing.Hash
+}
+
+func (e *fastExporter) export(w *revWalk) error {
+	// Commits marked by a previous export are not exported again.
+	for h := range e.marks {
+		if _, err := e.r.CommitObject(h); err == nil {
+			w.negatives = append(w.negatives, h)
+		}
+	}
+
+	var extras, tags []fastExportRef
+
+	sources := make(map[plumbing.Hash]string)
+	seen := make(map[string]bool)
+
+	for _, tip := range w.tips {
+		name := tip.name
+		if full, ok := resolveRefName(e.r, tip.name); ok {
+			name = full.String()
+		}
+
+		if seen[name] {
+			continue
+		}
+
+		seen[name] = true
+
+		h, tagged := peelTag(e.r, tip.hash)
+		if tagged {
+			tags = append(tags, fastExportRef{name: name, hash: tip.hash})
+		}
+
+		if _, err := e.r.CommitObject(h); err != nil {
+			continue
+		}
+
+		if !tagged && (sources[h] != "" || e.marks[h] != 0) {
+			extras = append(extras, fastExportRef{name: name, hash: h})
+		}
+
+		if sources[h] == "" {
+			sources[h] = name
+		}
+	}
+
+	commits, _, err := w.walk()
+	if err != nil {
+		return err
+	}
+
+	// Commits are exported under the name of a reference they are
+	// reachable from, found the way the walk reached them.
+	for _, c := range commits {
+		for _, p := range c.ParentHashes {
+			if sources[p] == "" {
+				sources[p] = sources[c.Hash]
+			}
+		}
+	}
+
+	for _, c := range fastExportOrder(commits) {
+		err = e.exportCommit(c, sources[c.Hash])
+		if err != nil {
+			return err
+		}
+	}
+
+	// Like git, the references are written in the reverse order of their
+	// names.
+	sort.SliceStable(extras, func(i, j int) bool { return extras[i].name < extras[j].name })
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].name < tags[j].name })
+
+	for i := len(extras) - 1; i >= 0; i-- {
+		e.exportReset(extras[i])
+	}
+
+	for i := len(tags) - 1; i >= 0; i-- {
+		err = e.exportTag(tags[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fastExportOrder sorts commits, newest first, so that every commit comes
+// after its parents, keeping the commits of a line of history together the
+// way git's graph order does.
+func fastExportOrder(commits []*object.Commit) []*object.Commit {
+	indegree := make(map[plumbing.Hash]int, len(commits))
+	byHash := make(map[plumbing.Hash]*object.Commit, len(commits))
+
+	for _, c := range commits {
+		indegree[c.Hash] = 1
+		byHash[c.Hash] = c
+	}
+
+	for _, c := range commits {
+		for _, p := range c.ParentHashes {
+			if indegree[p] > 0 {
+				indegree[p]++
+			}
+		}
+	}
+
+	var stack []*object.Commit
+
+	for i := len(commits) - 1; i >= 0; i-- {
+		if indegree[commits[i].Hash] == 1 {
+			stack = append(stack, commits[i])
+		}
+	}
+
+	sorted := make([]*object.Commit, len(commits))
+	n := len(commits)
+
+	for len(stack) > 0 {
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		for _, p := range c.ParentHashes {
+			if indegree[p] == 0 {
+				continue
+			}
+
+			indegree[p]--
+			if indegree[p] == 1 {
+				stack = append(stack, byHash[p])
+			}
+		}
+
+		n--
+		sorted[n] = c
+	}
+
+	return sorted[n:]
+}
+
+// exportCommit writes the blobs c adds and then c itself, with the changes
+// from its first parent, or all of its files when that parent was not
+// exported.
+func (e *fastExporter) exportCommit(c *object.Commit, ref string) error {
+	var base plumbing.Hash
+
+	if len(c.ParentHashes) > 0 && e.marks[c.ParentHashes[0]] != 0 {
+		parent, err := e.r.CommitObject(c.ParentHashes[0])
+		if err != nil {
+			return err
+		}
+
+		base = parent.TreeHash
+	}
+
+	changes, err := diffTrees(e.r, base, c.TreeHash, "")
+	if err != nil {
+		return err
+	}
+
+	for _, ch := range changes {
+		if ch.to.Hash.IsZero() || ch.to.Mode == filemode.Submodule {
+			continue
+		}
+
+		err = e.exportBlob(ch.to.Hash)
+		if err != nil {
+			return err
+		}
+	}
+
+	if e.anon != nil {
+		ref = e.anon.refName(ref)
+	}
+
+	if len(c.ParentHashes) == 0 {
+		fmt.Fprintf(e.out, "reset %s\n", ref)
+	}
+
+	fmt.Fprintf(e.out, "commit %s\nmark :%d\n", ref, e.mark(c.Hash))
+	// Like git, the committer is anonymized before the author.
+	committer := e.ident(c.Committer)
+	fmt.Fprintf(e.out, "author %s\ncommitter %s\n", e.ident(c.Author), committer)
+
+	if c.Encoding != "" && !strings.EqualFold(string(c.Encoding), "UTF-8") {
+		fmt.Fprintf(e.out, "encoding %s\n", c.Encoding)
+	}
+
+	msg := c.Message
+	if e.anon != nil {
+		msg = e.anon.commitMessage()
+	}
+
+	fmt.Fprintf(e.out, "data %d\n%s", len(msg), msg)
+
+	command := "from"
+
+	for _, p := range c.ParentHashes {
+		if mark := e.marks[p]; mark != 0 {
+			fmt.Fprintf(e.out, "%s :%d\n", command, mark)
+
+			command = "merge"
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return depthFirstLess(changes[i].path, changes[j].path)
+	})
+
+	for _, ch := range changes {
+		switch {
+		case ch.to.Hash.IsZero():
+			fmt.Fprintf(e.out, "D %s\n", e.path(ch.path))
+		case ch.to.Mode == filemode.Submodule:
+			fmt.Fprintf(e.out, "M %06o %s %s\n", uint32(ch.to.Mode), e.oid(ch.to.Hash), e.path(ch.path))
+		default:
+			fmt.Fprintf(e.out, "M %06o :%d %s\n", uint32(ch.to.Mode), e.marks[ch.to.Hash], e.path(ch.path))
+		}
+	}
+
+	fmt.Fprintln(e.out)
+
+	return nil
+}
+
+// depthFirstLess orders paths by name, but with the paths inside of a
+// directory before the directory itself, so that a file replaced by a
+// directory is deleted before the files of the directory are added.
+func depthFirstLess(a, b string) bool {
+	n := min(len(a), len(b))
+	if c := strings.Compare(a[:n], b[:n]); c != 0 {
+		return c < 0
+	}
+
+	return len(a) > len(b)
+}
+
+// exportBlob writes the blob h, unless it was already exported.
+func (e *fastExporter) exportBlob(h plumbing.Hash) error {
+	if e.marks[h] != 0 {
+		return nil
+	}
+
+	blob, err := e.r.BlobObject(h)
+	if err != nil {
+		return fmt.Errorf("could not read blob %s: %w", h, err)
+	}
+
+	fmt.Fprintf(e.out, "blob\nmark :%d\n", e.mark(h))
+
+	if e.anon != nil {
+		content := e.anon.blob()
+		fmt.Fprintf(e.out, "data %d\n%s\n", len(content), content)
+
+		return nil
+	}
+
+	rd, err := blob.Reader()
+	if err != nil {
+		return err
+	}
+
+	defer rd.Close()
+
+	fmt.Fprintf(e.out, "data %d\n", blob.Size)
+
+	_, err = io.Copy(e.out, rd)
+	if err != nil {
+		return fmt.Errorf("could not read blob %s: %w", h, err)
+	}
+
+	fmt.Fprintln(e.out)
+
+	return nil
+}
+
+// exportReset points ref at a commit exported under another name.
+func (e *fastExporter) exportReset(ref fastExportRef) {
+	name := ref.name
+	if e.anon != nil {
+		name = e.anon.refName(name)
+	}
+
+	if mark := e.marks[ref.hash]; mark != 0 {
+		fmt.Fprintf(e.out, "reset %s\nfrom :%d\n\n", name, mark)
+	} else {
+		fmt.Fprintf(e.out, "reset %s\nfrom %s\n\n", name, e.oid(ref.hash))
+	}
+}
+
+// exportTag writes the annotated tag ref, handling its signature according
+// to --signed-tags.
+func (e *fastExporter) exportTag(ref fastExportRef) error {
+	tag, err := e.r.TagObject(ref.hash)
+	if err != nil {
+		return err
+	}
+
+	target, _ := peelTag(e.r, ref.hash)
+
+	if _, err := e.r.BlobObject(target); err == nil {
+		err = e.exportBlob(target)
+		if err != nil {
+			return err
+		}
+	}
+
+	mark := e.marks[target]
+	if mark == 0 {
+		return fmt.Errorf("tag %s tags unexported object", tag.Hash)
+	}
+
+	msg := tag.Message + tag.Signature
+
+	switch {
+	case e.anon != nil:
+		msg = e.anon.tagMessage()
+	case tag.Signature == "":
+	case fastExportSignedTags == "abort":
+		return fmt.Errorf("encountered signed tag %s; use --signed-tags=<mode> to handle it", tag.Hash)
+	case fastExportSignedTags == "warn":
+		fmt.Fprintf(e.errOut, "warning: exporting signed tag %s\n", tag.Hash)
+	case fastExportSignedTags == "warn-strip":
+		fmt.Fprintf(e.errOut, "warning: stripping signature from tag %s\n", tag.Hash)
+
+		msg = tag.Message
+	case fastExportSignedTags == "strip":
+		msg = tag.Message
+	}
+
+	name := ref.name
+	if e.anon != nil {
+		name = e.anon.refName(name)
+	}
+
+	fmt.Fprintf(e.out, "tag %s\nfrom :%d\n", strings.TrimPrefix(name, "refs/tags/"), mark)
+
+	if tag.Tagger.Name != "" || tag.Tagger.Email != "" {
+		fmt.Fprintf(e.out, "tagger %s\n", e.ident(tag.Tagger))
+	}
+
+	fmt.Fprintf(e.out, "data %d\n%s\n", len(msg), msg)
+
+	return nil
+}
+
+// mark assigns the next mark to h.
+func (e *fastExporter) mark(h plumbing.Hash) int {
+	e.lastMark++
+	e.marks[h] = e.lastMark
+
+	return e.lastMark
+}
+
+// ident formats sig the way author, committer and tagger lines do.
+func (e *fastExporter) ident(sig object.Signature) string {
+	if e.anon != nil {
+		sig.Name, sig.Email = e.anon.ident(sig.Name, sig.Email)
+	}
+
+	var sb strings.Builder
+
+	_ = sig.Encode(&sb)
+
+	return sb.String()
+}
+
+// path formats p for a file change, quoting it when it has special
+// characters or spaces.
+func (e *fastExporter) path(p string) string {
+	if e.anon != nil {
+		p = e.anon.path(p)
+	}
+
+	if q := quotePath(p); q != p {
+		return q
+	}
+
+	if strings.Contains(p, " ") {
+		return `"` + p + `"`
+	}
+
+	return p
+}
+
+func (e *fastExporter) oid(h plumbing.Hash) string {
+	if e.anon != nil {
+		return e.anon.oid(h)
+	}
+
+	return h.String()
+}
+
+// importMarks reads the ":<mark> <id>" lines of a marks file written by a
+// previous export. Like git, only the marks of commits are used, though
+// new marks are numbered after all of them.
+func (e *fastExporter) importMarks(name string) error {
+	marks, err := readMarksFile(name)
+	if err != nil {
+		return err
+	}
+
+	for mark, h := range marks {
+		obj, err := e.r.Storer.EncodedObject(plumbing.AnyObject, h)
+		if err != nil {
+			return fmt.Errorf("could not read object %s of mark :%d: %w", h, mark, err)
+		}
+
+		e.lastMark = max(e.lastMark, mark)
+
+		if obj.Type() == plumbing.CommitObject {
+			e.marks[h] = mark
+		}
+	}
+
+	return nil
+}
+
+// exportMarks writes the marks of the exported commits. Like git, those of
+// blobs are left out, so that a later export sends them again.
+func (e *fastExporter) exportMarks(name string) error {
+	marks := make(map[int]plumbing.Hash, len(e.marks))
+
+	for h, mark := range e.marks {
+		if _, err := e.r.CommitObject(h); err == nil {
+			marks[mark] = h
+		}
+	}
+
+	return writeMarksFile(name, marks)
+}
+
+// readMarksFile reads a file of ":<mark> <id>" lines.
+func readMarksFile(name string) (map[int]plumbing.Hash, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read marks file '%s': %w", name, err)
+	}
+
+	defer f.Close()
+
+	marks := make(map[int]plumbing.Hash)
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		mark, id, ok := strings.Cut(line, " ")
+
+		n, err := strconv.Atoi(strings.TrimPrefix(mark, ":"))
+		if !ok || err != nil || n <= 0 || !strings.HasPrefix(mark, ":") {
+			return nil, fmt.Errorf("corrupt mark line: %s", line)
+		}
+
+		h, ok := plumbing.FromHex(id)
+		if !ok {
+			return nil, fmt.Errorf("corrupt mark line: %s", line)
+		}
+
+		marks[n] = h
+	}
+
+	return marks, scanner.Err()
+}
+
+// writeMarksFile writes marks as ":<mark> <id>" lines, in the order of the
+// marks.
+func writeMarksFile(name string, marks map[int]plumbing.Hash) error {
+	numbers := make([]int, 0, len(marks))
+	for mark := range marks {
+		numbers = append(numbers, mark)
+	}
+
+	sort.Ints(numbers)
+
+	var sb strings.Builder
+
+	for _, mark := range numbers {
+		fmt.Fprintf(&sb, ":%d %s\n", mark, marks[mark])
+	}
+
+	err := os.WriteFile(name, []byte(sb.String()), 0o644)
+	if err != nil {
+		return fmt.Errorf("unable to write marks file %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// treeChange is a path whose entry differs between two trees; a zero hash
+// on either side means the path was added or deleted.
+type treeChange struct {
+	path     string
+	from, to object.TreeEntry
+}
+
+// diffTrees returns the files that differ between the trees from and to,
+// either of which may be zero for the empty tree, in tree order.
+func diffTrees(r *git.Repository, from, to plumbing.Hash, prefix string) ([]treeChange, error) {
+	a, err := treeEntries(r, from)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := treeEntries(r, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []treeChange
+
+	add := func(ea, eb object.TreeEntry) error {
+		name := ea.Name
+		if name == "" {
+			name = eb.Name
+		}
+
+		if ea.Mode != filemode.Dir && eb.Mode != filemode.Dir {
+			changes = append(changes, treeChange{path: prefix + name, from: ea, to: eb})
+
+			return nil
+		}
+
+		sub, err := diffTrees(r, ea.Hash, eb.Hash, prefix+name+"/")
+		changes = append(changes, sub...)
+
+		return err
+	}
+
+	for len(a) > 0 || len(b) > 0 {
+		var (
+			ea, eb object.TreeEntry
+			cmp    int
+		)
+
+		switch {
+		case len(a) == 0:
+			cmp = 1
+		case len(b) == 0:
+			cmp = -1
+		default:
+			cmp = strings.Compare(treeSortName(a[0].Name, uint64(a[0].Mode)), treeSortName(b[0].Name, uint64(b[0].Mode)))
+		}
+
+		if cmp <= 0 {
+			ea, a = a[0], a[1:]
+		}
+
+		if cmp >= 0 {
+			eb, b = b[0], b[1:]
+		}
+
+		if cmp == 0 && ea.Hash == eb.Hash && ea.Mode == eb.Mode {
+			continue
+		}
+
+		err = add(ea, eb)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return changes, nil
+}
+
+func treeEntries(r *git.Repository, h plumbing.Hash) ([]object.TreeEntry, error) {
+	if h.IsZero() {
+		return nil, nil
+	}
+
+	tree, err := r.TreeObject(h)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tree %s: %w", h, err)
+	}
+
+	return tree.Entries, nil
+}
+
+// anonymizer replaces the contents, paths, names and messages of an export
+// with placeholders, consistently across the stream.
+type anonymizer struct {
+	paths    map[string]string
+	refs     map[string]string
+	idents   map[string]int
+	oids     map[plumbing.Hash]string
+	blobs    int
+	commits  int
+	tags     int
+	lastOIDs int
+}
+
+func newAnonymizer() *anonymizer {
+	return &anonymizer{
+		paths:  make(map[string]string),
+		refs:   make(map[string]string),
+		idents: make(map[string]int),
+		oids:   make(map[plumbing.Hash]string),
+	}
+}
+
+func (a *anonymizer) blob() string {
+	s := fmt.Sprintf("anonymous blob %d", a.blobs)
+	a.blobs++
+
+	return s
+}
+
+func (a *anonymizer) commitMessage() string {
+	s := fmt.Sprintf("subject %d\n\nbody\n", a.commits)
+	a.commits++
+
+	return s
+}
+
+func (a *anonymizer) tagMessage() string {
+	s := fmt.Sprintf("tag message %d", a.tags)
+	a.tags++
+
+	return s
+}
+
+func (a *anonymizer) ident(name, email string) (string, string) {
+	key := name + " <" + email + ">"
+
+	n, ok := a.idents[key]
+	if !ok {
+		n = len(a.idents)
+		a.idents[key] = n
+	}
+
+	return fmt.Sprintf("User %d", n), fmt.Sprintf("user%d@example.com", n)
+}
+
+// path replaces each component of p.
+func (a *anonymizer) path(p string) string {
+	return anonymizeComponents(p, "path", a.paths)
+}
+
+// refName replaces each component of a reference name, but for its
+// refs/heads/, refs/tags/ or refs/remotes/ prefix.
+func (a *anonymizer) refName(name string) string {
+	for _, prefix := range []string{"refs/heads/", "refs/tags/", "refs/remotes/"} {
+		if rest, ok := strings.CutPrefix(name, prefix); ok {
+			return prefix + anonymizeComponents(rest, "ref", a.refs)
+		}
+	}
+
+	return name
+}
+
+func (a *anonymizer) oid(h plumbing.Hash) string {
+	s, ok := a.oids[h]
+	if !ok {
+		s = fmt.Sprintf("%0*x", len(h.String()), a.lastOIDs)
+		a.oids[h] = s
+		a.lastOIDs++
+	}
+
+	return s
+}
+
+func anonymizeComponents(p, prefix string, seen map[string]string) string {
+	parts := strings.Split(p, "/")
+
+	for i, part := range parts {
+		s, ok := seen[part]
+		if !ok {
+			s = fmt.Sprintf("%s%d", prefix, len(seen))
+			seen[part] = s
+		}
+
+		parts[i] = s
+	}
+
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fastExportRepo returns a repository made by git with a merge, renamed,
+// removed and executable files, a symbolic link, and annotated and
+// lightweight tags.
+func fastExportRepo(t *testing.T) string {
+	t.Helper()
+
+	dir := gitRepo(t, []string{"a", "1", "d/b", "2", "d/e/c", "3"}, []string{"a", "2"})
+
+	err := os.Symlink("a", filepath.Join(dir, "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Chmod(filepath.Join(dir, "d", "b"), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gitCmd(t, dir, "add", "link", "d/b")
+	gitCmd(t, dir, "commit", "-q", "-m", "link and mode\n\nwith a body")
+	gitCmd(t, dir, "tag", "-a", "-m", "release 1", "v1")
+
+	gitCmd(t, dir, "checkout", "-q", "-b", "topic", "HEAD~1")
+	gitCmd(t, dir, "mv", "d/e/c", "moved")
+	gitCmd(t, dir, "rm", "-q", "a")
+	writeFile(t, dir, "ünïcode", "x")
+	gitCmd(t, dir, "add", "-A")
+	gitCmd(t, dir, "commit", "-q", "-m", "move and remove")
+	gitCmd(t, dir, "tag", "light")
+
+	gitCmd(t, dir, "checkout", "-q", "main")
+	gitCmd(t, dir, "merge", "-q", "--no-ff", "-m", "merge topic", "topic")
+
+	return dir
+}
+
+func TestFastExport(t *testing.T) {
+	dir := fastExportRepo(t)
+
+	for _, args := range []string{
+		"--all",
+		"main",
+		"topic",
+		"main~1..main",
+		"v1",
+		"--anonymize --all",
+	} {
+		t.Run(args, func(t *testing.T) {
+			sameOutput(t, dir, append([]string{"fast-export"}, strings.Fields(args)...)...)
+		})
+	}
+}
+
+// TestFastExportMarks checks that the marks written by one export keep the
+// next one from exporting the same objects again.
+func TestFastExportMarks(t *testing.T) {
+	dir := fastExportRepo(t)
+
+	var outputs []string
+
+	for _, tool := range []string{"git", "gogit"} {
+		marks := filepath.Join(t.TempDir(), "marks")
+
+		for _, args := range [][]string{
+			{"fast-export", "--export-marks=" + marks, "topic"},
+			{"fast-export", "--import-marks=" + marks, "--export-marks=" + marks, "main"},
+		} {
+			if tool == "git" {
+				outputs = append(outputs, gitCmd(t, dir, args...))
+			} else {
+				outputs = append(outputs, mustGogit(t, dir, args...))
+			}
+		}
+
+		outputs = append(outputs, strings.Join(sortedLines(readFile(t, marks)), "\n"))
+	}
+
+	for i, what := range []string{"first export", "second export", "marks"} {
+		if outputs[3+i] != outputs[i] {
+			t.Errorf("gogit wrote the %s:\n%s\nwant, as git:\n%s", what, outputs[3+i], outputs[i])
+		}
+	}
+}
+
+// TestFastExportSignedTags checks the --signed-tags modes on a tag whose
+// signature git does not verify when exporting.
+func TestFastExportSignedTags(t *testing.T) {
+	dir := fastExportRepo(t)
+
+	tag := fmt.Sprintf("object %s\ntype commit\ntag signed\ntagger T <t@x> 1700000000 +0000\n\nsigned release\n"+
+		"-----BEGIN PGP SIGNATURE-----\n\nnot a real signature\n-----END PGP SIGNATURE-----\n", gitCmd(t, dir, "rev-parse", "v1^{}")[:40])
+	h := strings.TrimSpace(gitCmdStdin(t, dir, tag, "mktag"))
+	gitCmd(t, dir, "update-ref", "refs/tags/signed", h)
+
+	for _, mode := range []string{"verbatim", "strip", "warn", "warn-strip"} {
+		t.Run(mode, func(t *testing.T) {
+			sameOutput(t, dir, "fast-export", "--signed-tags="+mode, "signed")
+		})
+	}
+
+	for _, args := range [][]string{{"fast-export", "signed"}, {"fast-export", "--signed-tags=abort", "signed"}} {
+		if res := gogit(t, dir, args...); res.code == 0 {
+			t.Errorf("gogit %v exported a signed tag", args)
+		}
+	}
+
+	if res := gogit(t, dir, "fast-export", "--signed-tags=warn-strip", "signed"); !strings.Contains(res.stderr, "stripping signature from tag "+h) {
+		t.Errorf("gogit fast-export --signed-tags=warn-strip warned %q", res.stderr)
+	}
+}
@@ -0,0 +1,1378 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/format/packfile"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/storage/memory"
+	"github.com/spf13/cobra"
+)
+
+var (
+	fastImportImportMarks string
+	fastImportExportMarks string
+	fastImportForce       bool
+)
+
+func init() {
+	fastImportCmd.Flags().StringVarP(&fastImportImportMarks, "import-marks", "", "", "Read the marks of previously imported objects from the file")
+	fastImportCmd.Flags().StringVarP(&fastImportExportMarks, "export-marks", "", "", "Write the marks of the imported objects to the file")
+	fastImportCmd.Flags().BoolVarP(&fastImportForce, "force", "", false, "Update branches even when it discards commits")
+	rootCmd.AddCommand(fastImportCmd)
+}
+
+var fastImportCmd = &cobra.Command{
+	Use:   "fast-import [--import-marks=<file>] [--export-marks=<file>] [--force]",
+	Short: "Import history from a fast-import stream",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		f := &fastImporter{
+			r:            r,
+			in:           bufio.NewReader(cmd.InOrStdin()),
+			out:          cmd.OutOrStdout(),
+			errOut:       cmd.ErrOrStderr(),
+			hooks:        newHooks(r, cmd.ErrOrStderr()),
+			objectBuffer: newObjectBuffer(r),
+			marks:        make(map[int]plumbing.Hash),
+			branches:     make(map[string]*importBranch),
+			tags:         make(map[string]plumbing.Hash),
+			force:        fastImportForce,
+			exportMarks:  fastImportExportMarks,
+		}
+
+		if fastImportImportMarks != "" {
+			err = f.importMarks(fastImportImportMarks, false)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = f.run()
+		if err == nil {
+			err = f.checkpoint()
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if f.failed {
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+
+			return exitStatus(1)
+		}
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// fastImporter reads a fast-import stream, storing the objects it creates
+// in memory until a checkpoint writes them to a pack and updates the
+// references.
+type fastImporter struct {
+	r      *git.Repository
+	in     *bufio.Reader
+	out    io.Writer
+	errOut io.Writer
+	hooks  *hooks
+
+	// The objects created since the last checkpoint are buffered.
+	*objectBuffer
+
+	marks    map[int]plumbing.Hash
+	branches map[string]*importBranch
+	order    []string
+	tags     map[string]plumbing.Hash
+	tagOrder []string
+
+	force       bool
+	requireDone bool
+	marksRead   bool
+	exportMarks string
+	failed      bool
+
+	// line is a line read ahead and given back.
+	line    string
+	hasLine bool
+}
+
+// importBranch is a reference being built by the stream, with the files of
+// its next commit.
+type importBranch struct {
+	tip    plumbing.Hash
+	files  map[string]importFile
+	delete bool
+}
+
+type importFile struct {
+	mode filemode.FileMode
+	hash plumbing.Hash
+}
+
+// objectBuffer keeps new objects in memory, in front of the objects of a
+// repository, until they are all written to a pack together.
+type objectBuffer struct {
+	objects *overlayStorage
+	pending []plumbing.Hash
+}
+
+func newObjectBuffer(r *git.Repository) *objectBuffer {
+	return &objectBuffer{objects: &overlayStorage{EncodedObjectStorer: memory.NewStorage(), base: r.Storer}}
+}
+
+// loadTree adds the files of the tree h to files, under prefix.
+func (b *objectBuffer) loadTree(files map[string]importFile, h plumbing.Hash, prefix string) error {
+	// Like git, the empty tree is known without being stored.
+	empty := b.objects.base.NewEncodedObject()
+	empty.SetType(plumbing.TreeObject)
+
+	if h == empty.Hash() {
+		return nil
+	}
+
+	tree, err := object.GetTree(b.objects, h)
+	if err != nil {
+		return fmt.Errorf("failed to read tree %s: %w", h, err)
+	}
+
+	for _, e := range tree.Entries {
+		p := path.Join(prefix, e.Name)
+
+		if e.Mode == filemode.Dir {
+			err = b.loadTree(files, e.Hash, p)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		files[p] = importFile{mode: e.Mode, hash: e.Hash}
+	}
+
+	return nil
+}
+
+// writeTree stores the trees holding files, returning the root one.
+func (b *objectBuffer) writeTree(files map[string]importFile) (plumbing.Hash, error) {
+	dirs := map[string][]object.TreeEntry{".": nil}
+
+	for p, file := range files {
+		dir := path.Dir(p)
+
+		for d := dir; d != "."; d = path.Dir(d) {
+			if _, ok := dirs[d]; ok {
+				break
+			}
+
+			dirs[d] = nil
+		}
+
+		dirs[dir] = append(dirs[dir], object.TreeEntry{Name: path.Base(p), Mode: file.mode, Hash: file.hash})
+	}
+
+	names := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		names = append(names, dir)
+	}
+
+	depth := func(dir string) int {
+		if dir == "." {
+			return -1
+		}
+
+		return strings.Count(dir, "/")
+	}
+
+	// Subdirectories are written before the directories holding them.
+	sort.Slice(names, func(i, j int) bool { return depth(names[i]) > depth(names[j]) })
+
+	var root plumbing.Hash
+
+	for _, dir := range names {
+		tree := &object.Tree{Entries: dirs[dir]}
+		sort.Sort(object.TreeEntrySorter(tree.Entries))
+
+		obj := b.objects.base.NewEncodedObject()
+
+		err := tree.Encode(obj)
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("failed to encode tree: %w", err)
+		}
+
+		h, err := b.store(obj)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		if dir == "." {
+			root = h
+
+			continue
+		}
+
+		parent := path.Dir(dir)
+		dirs[parent] = append(dirs[parent], object.TreeEntry{Name: path.Base(dir), Mode: filemode.Dir, Hash: h})
+	}
+
+	return root, nil
+}
+
+func (b *objectBuffer) storeObject(t plumbing.ObjectType, data []byte) (plumbing.Hash, error) {
+	obj := b.objects.base.NewEncodedObject()
+	obj.SetType(t)
+	obj.SetSize(int64(len(data)))
+
+	w, err := obj.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	_, err = w.Write(data)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return b.store(obj)
+}
+
+// store keeps obj until the buffer is written, unless the repository already
+// has it.
+func (b *objectBuffer) store(obj plumbing.EncodedObject) (plumbing.Hash, error) {
+	h := obj.Hash()
+
+	if b.objects.base.HasEncodedObject(h) == nil || b.objects.EncodedObjectStorer.HasEncodedObject(h) == nil {
+		return h, nil
+	}
+
+	_, err := b.objects.SetEncodedObject(obj)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to store object %s: %w", h, err)
+	}
+
+	b.pending = append(b.pending, h)
+
+	return h, nil
+}
+
+// writePack writes the pending objects to a pack of the repository.
+func (b *objectBuffer) writePack() error {
+	if len(b.pending) == 0 {
+		return nil
+	}
+
+	pw, ok := b.objects.base.(storer.PackfileWriter)
+	if !ok {
+		return errors.New("storer does not support writing packs")
+	}
+
+	w, err := pw.PackfileWriter()
+	if err != nil {
+		return fmt.Errorf("failed to create pack: %w", err)
+	}
+
+	_, err = packfile.NewEncoder(w, b.objects, false).Encode(b.pending, 10)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to write pack: %w", err)
+	}
+
+	b.pending = nil
+	b.objects = &overlayStorage{EncodedObjectStorer: memory.NewStorage(), base: b.objects.base}
+
+	return nil
+}
+
+func (f *fastImporter) run() error {
+	for {
+		line, err := f.readLine()
+		if errors.Is(err, io.EOF) {
+			if f.requireDone {
+				return errors.New("stream ends early")
+			}
+
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case line == "":
+		case line == "blob":
+			err = f.parseBlob()
+		case strings.HasPrefix(line, "commit "):
+			err = f.parseCommit(strings.TrimPrefix(line, "commit "))
+		case strings.HasPrefix(line, "tag "):
+			err = f.parseTag(strings.TrimPrefix(line, "tag "))
+		case strings.HasPrefix(line, "reset "):
+			err = f.parseReset(strings.TrimPrefix(line, "reset "))
+		case line == "alias":
+			err = f.parseAlias()
+		case line == "checkpoint":
+			err = f.checkpoint()
+		case strings.HasPrefix(line, "progress "):
+			fmt.Fprintln(f.out, line)
+		case line == "done":
+			return nil
+		case strings.HasPrefix(line, "feature "):
+			err = f.feature(strings.TrimPrefix(line, "feature "))
+		case strings.HasPrefix(line, "option "):
+			err = f.option(strings.TrimPrefix(line, "option "))
+		default:
+			return fmt.Errorf("unsupported command: %s", line)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readLine returns the next line of the stream that is not a comment.
+func (f *fastImporter) readLine() (string, error) {
+	if f.hasLine {
+		f.hasLine = false
+
+		return f.line, nil
+	}
+
+	for {
+		line, err := f.in.ReadString('\n')
+		if err != nil && (!errors.Is(err, io.EOF) || line == "") {
+			return "", err
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		if !strings.HasPrefix(line, "#") {
+			return line, nil
+		}
+	}
+}
+
+func (f *fastImporter) unreadLine(line string) {
+	f.line, f.hasLine = line, true
+}
+
+// optional returns the rest of the next line when it starts with prefix,
+// and leaves the line to be read again otherwise.
+func (f *fastImporter) optional(prefix string) (string, bool, error) {
+	line, err := f.readLine()
+	if errors.Is(err, io.EOF) {
+		return "", false, nil
+	}
+
+	if err != nil {
+		return "", false, err
+	}
+
+	if rest, ok := strings.CutPrefix(line, prefix); ok {
+		return rest, true, nil
+	}
+
+	f.unreadLine(line)
+
+	return "", false, nil
+}
+
+// readMark reads an optional "mark :<n>" line, returning 0 without one.
+func (f *fastImporter) readMark() (int, error) {
+	arg, ok, err := f.optional("mark ")
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	mark, err := strconv.Atoi(strings.TrimPrefix(arg, ":"))
+	if err != nil || mark <= 0 || !strings.HasPrefix(arg, ":") {
+		return 0, fmt.Errorf("invalid mark: %s", arg)
+	}
+
+	return mark, nil
+}
+
+// readData reads a "data <count>" or "data <<<delimiter>" command and the
+// data that follows it.
+func (f *fastImporter) readData() ([]byte, error) {
+	line, err := f.readLine()
+	if err != nil {
+		return nil, fmt.Errorf("expected data command: %w", err)
+	}
+
+	arg, ok := strings.CutPrefix(line, "data ")
+	if !ok {
+		return nil, fmt.Errorf("expected 'data n' command, found: %s", line)
+	}
+
+	if delim, ok := strings.CutPrefix(arg, "<<"); ok {
+		var data []byte
+
+		for {
+			line, err := f.in.ReadString('\n')
+			if err != nil {
+				return nil, fmt.Errorf("EOF in data (terminator '%s' not found)", delim)
+			}
+
+			if strings.TrimSuffix(line, "\n") == delim {
+				return data, nil
+			}
+
+			data = append(data, line...)
+		}
+	}
+
+	n, err := strconv.ParseUint(arg, 10, 63)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data length: %s", arg)
+	}
+
+	data := make([]byte, n)
+
+	_, err = io.ReadFull(f.in, data)
+	if err != nil {
+		return nil, fmt.Errorf("EOF in data (%d bytes remaining)", n)
+	}
+
+	// The data may be followed by an optional line feed.
+	if b, err := f.in.Peek(1); err == nil && b[0] == '\n' {
+		_, _ = f.in.ReadByte()
+	}
+
+	return data, nil
+}
+
+func (f *fastImporter) parseBlob() error {
+	mark, err := f.readMark()
+	if err != nil {
+		return err
+	}
+
+	_, _, err = f.optional("original-oid ")
+	if err != nil {
+		return err
+	}
+
+	data, err := f.readData()
+	if err != nil {
+		return err
+	}
+
+	h, err := f.storeObject(plumbing.BlobObject, data)
+	if err != nil {
+		return err
+	}
+
+	f.setMark(mark, h)
+
+	return nil
+}
+
+func (f *fastImporter) parseCommit(ref string) error {
+	b := f.branch(ref)
+
+	mark, err := f.readMark()
+	if err != nil {
+		return err
+	}
+
+	_, _, err = f.optional("original-oid ")
+	if err != nil {
+		return err
+	}
+
+	c := &object.Commit{}
+
+	author, hasAuthor, err := f.optional("author ")
+	if err != nil {
+		return err
+	}
+
+	committer, ok, err := f.optional("committer ")
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return errors.New("expected committer but didn't get one")
+	}
+
+	c.Committer, err = parseImportIdent(committer)
+	if err != nil {
+		return err
+	}
+
+	c.Author = c.Committer
+
+	if hasAuthor {
+		c.Author, err = parseImportIdent(author)
+		if err != nil {
+			return err
+		}
+	}
+
+	encoding, _, err := f.optional("encoding ")
+	if err != nil {
+		return err
+	}
+
+	c.Encoding = object.MessageEncoding(encoding)
+
+	msg, err := f.readData()
+	if err != nil {
+		return err
+	}
+
+	c.Message = string(msg)
+
+	from, ok, err := f.optional("from ")
+	if err != nil {
+		return err
+	}
+
+	if ok {
+		err = f.resetBranch(b, from)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !b.tip.IsZero() {
+		c.ParentHashes = append(c.ParentHashes, b.tip)
+	}
+
+	for {
+		merge, ok, err := f.optional("merge ")
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			break
+		}
+
+		h, err := f.resolve(merge)
+		if err != nil {
+			return err
+		}
+
+		c.ParentHashes = append(c.ParentHashes, h)
+	}
+
+	err = f.parseFileChanges(b)
+	if err != nil {
+		return err
+	}
+
+	c.TreeHash, err = f.writeTree(b.files)
+	if err != nil {
+		return err
+	}
+
+	obj := f.r.Storer.NewEncodedObject()
+
+	err = c.Encode(obj)
+	if err != nil {
+		return fmt.Errorf("failed to encode commit: %w", err)
+	}
+
+	h, err := f.store(obj)
+	if err != nil {
+		return err
+	}
+
+	b.tip, b.delete = h, false
+	f.setMark(mark, h)
+
+	return nil
+}
+
+// parseFileChanges applies the file changes of a commit to the files of b,
+// up to the end of the commit. Like git, the notes are then moved to the
+// fan-out directories their new number calls for.
+func (f *fastImporter) parseFileChanges(b *importBranch) error {
+	notes := countImportNotes(b.files)
+	fanout := noteFanout(notes)
+
+	for {
+		line, err := f.readLine()
+		if errors.Is(err, io.EOF) || (err == nil && line == "") {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if !isFileChange(line) {
+			f.unreadLine(line)
+
+			break
+		}
+
+		switch {
+		case strings.HasPrefix(line, "N "):
+			err = f.noteModify(b, strings.TrimPrefix(line, "N "), fanout, &notes)
+		case strings.HasPrefix(line, "M "):
+			err = f.fileModify(b, strings.TrimPrefix(line, "M "))
+		case strings.HasPrefix(line, "D "):
+			var p string
+
+			p, _, err = parseImportPath(strings.TrimPrefix(line, "D "), true)
+			if err == nil {
+				removeImportPath(b.files, p)
+			}
+		case strings.HasPrefix(line, "C "), strings.HasPrefix(line, "R "):
+			err = f.fileCopy(b, line[2:], line[0] == 'R')
+		case line == "deleteall":
+			clear(b.files)
+
+			notes = 0
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if noteFanout(notes) != fanout {
+		moveImportNotes(b.files, noteFanout(notes))
+	}
+
+	return nil
+}
+
+// isFileChange reports whether line is one of the file changes of a
+// commit.
+func isFileChange(line string) bool {
+	for _, prefix := range []string{"N ", "M ", "D ", "C ", "R "} {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+
+	return line == "deleteall"
+}
+
+// noteModify applies a "N <dataref> <commit-ish>" change, which adds,
+// replaces or, with the zero id, removes the note of a commit. The note is
+// looked for at the fan-out of the start of the commit, and added at the
+// one of the new number of notes.
+func (f *fastImporter) noteModify(b *importBranch, args string, fanout int, notes *int) error {
+	ref, target, ok := strings.Cut(args, " ")
+	if !ok {
+		return fmt.Errorf("missing space after SHA1: N %s", args)
+	}
+
+	commit, err := f.resolveObject(target)
+	if err != nil {
+		return err
+	}
+
+	var h plumbing.Hash
+
+	switch {
+	case ref == "inline":
+		data, err := f.readData()
+		if err != nil {
+			return err
+		}
+
+		h, err = f.storeObject(plumbing.BlobObject, data)
+		if err != nil {
+			return err
+		}
+	case strings.HasPrefix(ref, ":"):
+		h, err = f.markHash(ref)
+		if err != nil {
+			return err
+		}
+	default:
+		h, ok = plumbing.FromHex(ref)
+		if !ok {
+			return fmt.Errorf("invalid dataref: %s", ref)
+		}
+	}
+
+	name := commit.String()
+
+	if _, ok := b.files[notePath(name, fanout)]; ok {
+		delete(b.files, notePath(name, fanout))
+
+		*notes--
+	}
+
+	if h.IsZero() {
+		return nil
+	}
+
+	*notes++
+	b.files[notePath(name, noteFanout(*notes))] = importFile{mode: filemode.Regular, hash: h}
+
+	return nil
+}
+
+// noteFanout returns the number of fan-out directories git spreads n notes
+// over: one for each factor of 256.
+func noteFanout(n int) int {
+	fanout := 0
+
+	for n >>= 8; n > 0; n >>= 8 {
+		fanout++
+	}
+
+	return fanout
+}
+
+// notePath returns the path of the note of the object hex under fanout
+// directories.
+func notePath(hex string, fanout int) string {
+	var sb strings.Builder
+
+	for i := range fanout {
+		sb.WriteString(hex[2*i : 2*i+2])
+		sb.WriteByte('/')
+	}
+
+	sb.WriteString(hex[2*fanout:])
+
+	return sb.String()
+}
+
+// importNoteName returns the object id whose note is at p, if p is the path
+// of a note.
+func importNoteName(p string) (string, bool) {
+	name := strings.ReplaceAll(p, "/", "")
+	if _, err := hex.DecodeString(name); err != nil || (len(name) != 40 && len(name) != 64) {
+		return "", false
+	}
+
+	return name, true
+}
+
+func countImportNotes(files map[string]importFile) int {
+	n := 0
+
+	for p := range files {
+		if _, ok := importNoteName(p); ok {
+			n++
+		}
+	}
+
+	return n
+}
+
+// moveImportNotes moves the notes among files under fanout directories.
+func moveImportNotes(files map[string]importFile, fanout int) {
+	moved := make(map[string]importFile)
+
+	for p, file := range files {
+		if name, ok := importNoteName(p); ok {
+			delete(files, p)
+			moved[notePath(name, fanout)] = file
+		}
+	}
+
+	maps.Copy(files, moved)
+}
+
+// fileModify applies a "M <mode> <dataref> <path>" file change.
+func (f *fastImporter) fileModify(b *importBranch, args string) error {
+	fields := strings.SplitN(args, " ", 3)
+	if len(fields) != 3 {
+		return fmt.Errorf("missing space after SHA1: M %s", args)
+	}
+
+	mode, err := parseImportMode(fields[0])
+	if err != nil {
+		return err
+	}
+
+	p, _, err := parseImportPath(fields[2], true)
+	if err != nil {
+		return err
+	}
+
+	var h plumbing.Hash
+
+	switch ref := fields[1]; {
+	case ref == "inline":
+		data, err := f.readData()
+		if err != nil {
+			return err
+		}
+
+		h, err = f.storeObject(plumbing.BlobObject, data)
+		if err != nil {
+			return err
+		}
+	case strings.HasPrefix(ref, ":"):
+		h, err = f.markHash(ref)
+		if err != nil {
+			return err
+		}
+	default:
+		var ok bool
+
+		h, ok = plumbing.FromHex(ref)
+		if !ok {
+			return fmt.Errorf("invalid dataref: %s", ref)
+		}
+	}
+
+	removeImportPath(b.files, p)
+
+	if mode != filemode.Dir {
+		for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+			delete(b.files, dir)
+		}
+
+		b.files[p] = importFile{mode: mode, hash: h}
+
+		return nil
+	}
+
+	return f.loadTree(b.files, h, p)
+}
+
+// fileCopy applies a "C <source> <destination>" file change, or an "R" one
+// when rename is true.
+func (f *fastImporter) fileCopy(b *importBranch, args string, rename bool) error {
+	src, rest, err := parseImportPath(args, false)
+	if err != nil {
+		return err
+	}
+
+	dst, _, err := parseImportPath(rest, true)
+	if err != nil {
+		return err
+	}
+
+	copied := make(map[string]importFile)
+
+	for p, file := range b.files {
+		if p == src {
+			copied[dst] = file
+		} else if rel, ok := strings.CutPrefix(p, src+"/"); ok || src == "" {
+			if src == "" {
+				rel = p
+			}
+
+			copied[path.Join(dst, rel)] = file
+		}
+	}
+
+	if len(copied) == 0 {
+		return fmt.Errorf("path %s not in branch", src)
+	}
+
+	if rename {
+		removeImportPath(b.files, src)
+	}
+
+	removeImportPath(b.files, dst)
+
+	for p, file := range copied {
+		b.files[p] = file
+	}
+
+	return nil
+}
+
+func (f *fastImporter) parseTag(name string) error {
+	mark, err := f.readMark()
+	if err != nil {
+		return err
+	}
+
+	from, ok, err := f.optional("from ")
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return errors.New("expected from command")
+	}
+
+	target, err := f.resolveObject(from)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = f.optional("original-oid ")
+	if err != nil {
+		return err
+	}
+
+	tagger, hasTagger, err := f.optional("tagger ")
+	if err != nil {
+		return err
+	}
+
+	if hasTagger {
+		_, err = parseImportIdent(tagger)
+		if err != nil {
+			return err
+		}
+	}
+
+	msg, err := f.readData()
+	if err != nil {
+		return err
+	}
+
+	obj, err := f.objects.EncodedObject(plumbing.AnyObject, target)
+	if err != nil {
+		return fmt.Errorf("not a valid object: %s", from)
+	}
+
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "object %s\ntype %s\ntag %s\n", target, obj.Type(), name)
+
+	if hasTagger {
+		fmt.Fprintf(&sb, "tagger %s\n", tagger)
+	}
+
+	fmt.Fprintf(&sb, "\n%s", msg)
+
+	h, err := f.storeObject(plumbing.TagObject, []byte(sb.String()))
+	if err != nil {
+		return err
+	}
+
+	if _, ok := f.tags[name]; !ok {
+		f.tagOrder = append(f.tagOrder, name)
+	}
+
+	f.tags[name] = h
+	f.setMark(mark, h)
+
+	return nil
+}
+
+func (f *fastImporter) parseReset(ref string) error {
+	b := f.branch(ref)
+	b.tip = plumbing.ZeroHash
+	b.files = make(map[string]importFile)
+
+	from, ok, err := f.optional("from ")
+	if err != nil || !ok {
+		return err
+	}
+
+	return f.resetBranch(b, from)
+}
+
+func (f *fastImporter) parseAlias() error {
+	mark, err := f.readMark()
+	if err != nil {
+		return err
+	}
+
+	to, ok, err := f.optional("to ")
+	if err != nil {
+		return err
+	}
+
+	if mark == 0 || !ok {
+		return errors.New("expected mark and to commands for alias")
+	}
+
+	h, err := f.resolveObject(to)
+	if err != nil {
+		return err
+	}
+
+	f.setMark(mark, h)
+
+	return nil
+}
+
+func (f *fastImporter) feature(name string) error {
+	arg, value, _ := strings.Cut(name, "=")
+
+	switch arg {
+	case "date-format":
+		if value != "raw" {
+			return fmt.Errorf("date format %s is not supported", value)
+		}
+	case "import-marks", "import-marks-if-exists":
+		if f.marksRead {
+			return nil
+		}
+
+		return f.importMarks(value, arg == "import-marks-if-exists")
+	case "export-marks":
+		if f.exportMarks == "" {
+			f.exportMarks = value
+		}
+	case "force":
+		f.force = true
+	case "done":
+		f.requireDone = true
+	default:
+		return fmt.Errorf("this version of fast-import does not support feature %s", name)
+	}
+
+	return nil
+}
+
+// option handles the options given in the stream. Only those for git are
+// read, the others being meant for other importers.
+func (f *fastImporter) option(name string) error {
+	opt, ok := strings.CutPrefix(name, "git ")
+	if !ok {
+		return nil
+	}
+
+	switch opt {
+	case "--force":
+		f.force = true
+	case "--quiet", "--stats":
+	default:
+		return fmt.Errorf("unknown option %s", opt)
+	}
+
+	return nil
+}
+
+// branch returns the reference name, starting it empty when the stream did
+// not name it before.
+func (f *fastImporter) branch(name string) *importBranch {
+	b, ok := f.branches[name]
+	if !ok {
+		b = &importBranch{files: make(map[string]importFile)}
+		f.branches[name] = b
+		f.order = append(f.order, name)
+	}
+
+	return b
+}
+
+// resetBranch makes the commit from names the tip of b, with its files.
+func (f *fastImporter) resetBranch(b *importBranch, from string) error {
+	h, err := f.resolve(from)
+	if err != nil {
+		return err
+	}
+
+	b.tip = h
+	b.files = make(map[string]importFile)
+	b.delete = h.IsZero()
+
+	if h.IsZero() {
+		return nil
+	}
+
+	c, err := object.GetCommit(f.objects, h)
+	if err != nil {
+		return fmt.Errorf("not a commit: %s", from)
+	}
+
+	return f.loadTree(b.files, c.TreeHash, "")
+}
+
+// resolve returns the commit from or merge names: a mark, a branch of the
+// stream, an object id or a revision of the repository.
+func (f *fastImporter) resolve(spec string) (plumbing.Hash, error) {
+	h, err := f.resolveObject(spec)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	if h.IsZero() {
+		return h, nil
+	}
+
+	obj, err := f.objects.EncodedObject(plumbing.AnyObject, h)
+	if err != nil || obj.Type() != plumbing.CommitObject {
+		return plumbing.ZeroHash, fmt.Errorf("not a commit: %s", spec)
+	}
+
+	return h, nil
+}
+
+func (f *fastImporter) resolveObject(spec string) (plumbing.Hash, error) {
+	if strings.HasPrefix(spec, ":") {
+		return f.markHash(spec)
+	}
+
+	if b, ok := f.branches[spec]; ok && !b.tip.IsZero() {
+		return b.tip, nil
+	}
+
+	if h, ok := plumbing.FromHex(spec); ok {
+		return h, nil
+	}
+
+	h, err := resolveRevision(f.r, spec)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("invalid ref name or SHA1 expression: %s", spec)
+	}
+
+	return h, nil
+}
+
+func (f *fastImporter) markHash(ref string) (plumbing.Hash, error) {
+	mark, err := strconv.Atoi(strings.TrimPrefix(ref, ":"))
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("invalid mark: %s", ref)
+	}
+
+	h, ok := f.marks[mark]
+	if !ok {
+		return plumbing.ZeroHash, fmt.Errorf("mark :%d not declared", mark)
+	}
+
+	return h, nil
+}
+
+func (f *fastImporter) setMark(mark int, h plumbing.Hash) {
+	if mark != 0 {
+		f.marks[mark] = h
+	}
+}
+
+// checkpoint writes the objects created so far to a pack, then updates the
+// references and writes the marks.
+func (f *fastImporter) checkpoint() error {
+	err := f.writePack()
+	if err != nil {
+		return err
+	}
+
+	err = f.updateRefs()
+	if err != nil {
+		return err
+	}
+
+	if f.exportMarks != "" {
+		return writeMarksFile(f.exportMarks, f.marks)
+	}
+
+	return nil
+}
+
+// updateRefs points the branches and tags of the stream at their new
+// values. Without --force, a branch is not updated when that would lose
+// commits, which is reported as a failure once the import completes.
+func (f *fastImporter) updateRefs() error {
+	return inRefTransaction(f.hooks, staticReflogMessage("fast-import"), func() error {
+		for _, name := range f.order {
+			err := f.updateBranch(name)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, name := range f.tagOrder {
+			ref := plumbing.NewTagReferenceName(name)
+
+			err := f.r.Storer.SetReference(plumbing.NewHashReference(ref, f.tags[name]))
+			if err != nil {
+				return fmt.Errorf("cannot update ref '%s': %w", ref, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// updateBranch points the branch name at its new tip.
+func (f *fastImporter) updateBranch(name string) error {
+	b := f.branches[name]
+	ref := plumbing.ReferenceName(name)
+
+	current, err := f.r.Storer.Reference(ref)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		current, err = nil, nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fastForward := true
+	if current != nil && !b.tip.IsZero() && current.Hash() != b.tip {
+		fastForward, err = isAncestor(f.r, current.Hash(), b.tip)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case b.tip.IsZero() && b.delete && current != nil:
+		err = f.r.Storer.RemoveReference(ref)
+	case b.tip.IsZero():
+	case current != nil && current.Hash() == b.tip:
+	case current != nil && !f.force && !fastForward:
+		fmt.Fprintf(f.errOut, "warning: Not updating %s (new tip %s does not contain %s)\n", ref, b.tip, current.Hash())
+
+		f.failed = true
+	default:
+		err = f.r.Storer.SetReference(plumbing.NewHashReference(ref, b.tip))
+	}
+
+	if err != nil {
+		return fmt.Errorf("cannot update ref '%s': %w", ref, err)
+	}
+
+	return nil
+}
+
+// importMarks reads the marks of a previous import, which must all name
+// objects of the repository.
+func (f *fastImporter) importMarks(name string, ifExists bool) error {
+	f.marksRead = true
+
+	if _, err := os.Stat(name); ifExists && errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	marks, err := readMarksFile(name)
+	if err != nil {
+		return err
+	}
+
+	for mark, h := range marks {
+		if !h.IsZero() && f.r.Storer.HasEncodedObject(h) != nil {
+			return fmt.Errorf("object %s of mark :%d not found", h, mark)
+		}
+
+		f.marks[mark] = h
+	}
+
+	return nil
+}
+
+// parseImportPath parses a path of a file change, which may be quoted in
+// the C style. Unless it is the last argument, the path ends with a space
+// and the rest of the arguments are returned after it.
+func parseImportPath(s string, last bool) (string, string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		if last {
+			return s, "", nil
+		}
+
+		p, rest, ok := strings.Cut(s, " ")
+		if !ok {
+			return "", "", fmt.Errorf("missing space after source: %s", s)
+		}
+
+		return p, rest, nil
+	}
+
+	end := 1
+	for ; end < len(s) && s[end] != '"'; end++ {
+		if s[end] == '\\' {
+			end++
+		}
+	}
+
+	if end >= len(s) {
+		return "", "", fmt.Errorf("invalid path: %s", s)
+	}
+
+	p, err := strconv.Unquote(s[:end+1])
+	if err != nil {
+		return "", "", fmt.Errorf("invalid path: %s", s)
+	}
+
+	rest := s[end+1:]
+
+	switch {
+	case last && rest != "":
+		return "", "", fmt.Errorf("garbage after path in: %s", s)
+	case !last && !strings.HasPrefix(rest, " "):
+		return "", "", fmt.Errorf("missing space after source: %s", s)
+	case !last:
+		rest = rest[1:]
+	}
+
+	return p, rest, nil
+}
+
+func parseImportMode(s string) (filemode.FileMode, error) {
+	switch s {
+	case "100644", "644":
+		return filemode.Regular, nil
+	case "100755", "755":
+		return filemode.Executable, nil
+	case "120000":
+		return filemode.Symlink, nil
+	case "160000":
+		return filemode.Submodule, nil
+	case "040000", "40000":
+		return filemode.Dir, nil
+	default:
+		return filemode.Empty, fmt.Errorf("corrupt mode: %s", s)
+	}
+}
+
+// parseImportIdent parses the "<name> <<email>> <when> <tz>" of an author,
+// committer or tagger command, with the date in the raw format.
+func parseImportIdent(s string) (object.Signature, error) {
+	lt := strings.IndexByte(s, '<')
+	if lt < 0 {
+		return object.Signature{}, fmt.Errorf("missing < in ident string: %s", s)
+	}
+
+	gt := strings.IndexByte(s[lt:], '>')
+	if gt < 0 {
+		return object.Signature{}, fmt.Errorf("missing > in ident string: %s", s)
+	}
+
+	date := strings.Fields(s[lt+gt+1:])
+	if len(date) != 2 || len(date[1]) != 5 || (date[1][0] != '+' && date[1][0] != '-') {
+		return object.Signature{}, fmt.Errorf("invalid raw date in ident: %s", s)
+	}
+
+	if _, err := strconv.ParseInt(date[0], 10, 64); err != nil {
+		return object.Signature{}, fmt.Errorf("invalid raw date in ident: %s", s)
+	}
+
+	var sig object.Signature
+
+	sig.Decode([]byte(s))
+
+	return sig, nil
+}
+
+// removeImportPath removes the file p, or all the files under it when it is
+// a directory.
+func removeImportPath(files map[string]importFile, p string) {
+	for name := range files {
+		if name == p || p == "" || strings.HasPrefix(name, p+"/") {
+			delete(files, name)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// importState describes the references of dir and the marks file, with
+// the objects they name, as git reports them.
+func importState(t *testing.T, dir, marks string) string {
+	t.Helper()
+
+	gitCmd(t, dir, "fsck", "--strict", "--no-dangling")
+
+	state := gitCmd(t, dir, "for-each-ref", "--format=%(objectname) %(objecttype) %(refname)")
+	if marks != "" {
+		state += strings.Join(sortedLines(readFile(t, marks)), "\n")
+	}
+
+	return state
+}
+
+// importWith runs fast-import with git or gogit in a new repository, with
+// stream as its input, and returns the repository, its output and the
+// marks file written.
+func importWith(t *testing.T, tool, stream string, args ...string) (dir string, res result, marks string) {
+	t.Helper()
+
+	dir = gitRepo(t)
+	marks = filepath.Join(t.TempDir(), "marks")
+	args = append([]string{"fast-import", "--export-marks=" + marks}, args...)
+
+	if tool == "git" {
+		res = run(t, dir, stream, "git", append(args, "--quiet")...)
+	} else {
+		res = gogitStdin(t, dir, stream, args...)
+	}
+
+	return dir, res, marks
+}
+
+// TestFastImportExported checks that gogit imports the exports of git as
+// git does.
+func TestFastImportExported(t *testing.T) {
+	src := fastExportRepo(t)
+
+	for _, args := range []string{"--all", "main", "--all --anonymize"} {
+		t.Run(args, func(t *testing.T) {
+			stream := gitCmd(t, src, append([]string{"fast-export"}, strings.Fields(args)...)...)
+
+			var states []string
+
+			for _, tool := range []string{"git", "gogit"} {
+				dir, res, marks := importWith(t, tool, stream)
+				if res.code != 0 {
+					t.Fatalf("%s fast-import failed: %s", tool, res.stderr)
+				}
+
+				states = append(states, importState(t, dir, marks))
+			}
+
+			if states[1] != states[0] {
+				t.Errorf("gogit fast-import gave:\n%s\nwant, as git:\n%s", states[1], states[0])
+			}
+		})
+	}
+}
+
+// fastImportStream is a stream using the commands of the fast-import format
+// that fast-export does not write.
+const fastImportStream = `feature done
+option quiet
+blob
+mark :1
+data 6
+hello
+
+# a comment
+commit refs/heads/main
+mark :2
+author A <a@x> 1700000000 +0100
+committer C <c@x> 1700000001 -0200
+data <<EOT
+delimited
+message
+EOT
+M 100644 :1 a
+M 100755 inline d/run
+data 10
+#!/bin/sh
+
+M 120000 inline link
+data 1
+a
+
+progress first commit
+commit refs/heads/main
+mark :3
+committer C <c@x> 1700000002 +0000
+data 7
+copies
+C a b
+R d/run e/run
+C "a" "quoted name"
+D link
+
+checkpoint
+
+commit refs/heads/side
+mark :4
+committer C <c@x> 1700000003 +0000
+data 4
+side
+from :2
+deleteall
+M 644 :1 only
+
+commit refs/heads/main
+mark :5
+committer C <c@x> 1700000004 +0000
+data 5
+merge
+merge :4
+M 040000 %s tree
+
+reset refs/heads/reset
+from :3
+
+reset refs/heads/gone
+
+tag v1
+from :5
+tagger T <t@x> 1700000005 +0000
+data 8
+release
+
+commit refs/notes/commits
+committer C <c@x> 1700000006 +0000
+data 6
+notes
+N inline :2
+data 5
+note
+
+N :1 :3
+
+commit refs/notes/commits
+committer C <c@x> 1700000007 +0000
+data 6
+fewer
+N 0000000000000000000000000000000000000000 :2
+
+progress done
+done
+`
+
+func TestFastImportStream(t *testing.T) {
+	// A tree of the repository the stream is imported into.
+	stream := func(dir string) string {
+		gitCmdStdin(t, dir, "", "hash-object", "-w", "--stdin")
+		tree := strings.TrimSpace(gitCmdStdin(t, dir, "100644 blob e69de29bb2d1d6434b8b29ae775ad8c2e48c5391\tempty\n", "mktree"))
+
+		return fmt.Sprintf(fastImportStream, tree)
+	}
+
+	var states []string
+
+	for _, tool := range []string{"git", "gogit"} {
+		dir := gitRepo(t)
+		marks := filepath.Join(t.TempDir(), "marks")
+		args := []string{"fast-import", "--export-marks=" + marks}
+
+		var res result
+		if tool == "git" {
+			res = run(t, dir, stream(dir), "git", args...)
+		} else {
+			res = gogitStdin(t, dir, stream(dir), args...)
+		}
+
+		if res.code != 0 {
+			t.Fatalf("%s fast-import failed: %s", tool, res.stderr)
+		}
+
+		states = append(states, res.stdout+importState(t, dir, marks)+gitCmd(t, dir, "ls-tree", "-r", "main")+gitCmd(t, dir, "notes", "list"))
+	}
+
+	if states[1] != states[0] {
+		t.Errorf("gogit fast-import gave:\n%s\nwant, as git:\n%s", states[1], states[0])
+	}
+}
+
+// TestFastImportNotesFanout checks that notes are spread in fan-out
+// directories as git spreads them.
+func TestFastImportNotesFanout(t *testing.T) {
+	var stream strings.Builder
+
+	for i := 1; i <= 300; i++ {
+		fmt.Fprintf(&stream, "commit refs/heads/main\nmark :%d\ncommitter C <c@x> %d +0000\ndata 4\nc%03d\n", i, 1700000000+i, i)
+		fmt.Fprintf(&stream, "M 644 inline f\ndata 4\n%03d\n\n", i)
+	}
+
+	// The first notes commit crosses 256 notes, the second goes back under.
+	stream.WriteString("commit refs/notes/commits\ncommitter C <c@x> 1700000000 +0000\ndata 5\nnotes\n")
+
+	for i := 1; i <= 260; i++ {
+		fmt.Fprintf(&stream, "N inline :%d\ndata 4\nn%03d\n", i, i)
+	}
+
+	stream.WriteString("\ncommit refs/notes/commits\ncommitter C <c@x> 1700000000 +0000\ndata 5\nfewer\n")
+
+	for i := 1; i <= 10; i++ {
+		fmt.Fprintf(&stream, "N 0000000000000000000000000000000000000000 :%d\n", i)
+	}
+
+	var states []string
+
+	for _, tool := range []string{"git", "gogit"} {
+		dir, res, marks := importWith(t, tool, stream.String())
+		if res.code != 0 {
+			t.Fatalf("%s fast-import failed: %s", tool, res.stderr)
+		}
+
+		states = append(states, importState(t, dir, marks)+gitCmd(t, dir, "ls-tree", "refs/notes/commits~1")[:200])
+	}
+
+	if states[1] != states[0] {
+		t.Errorf("gogit fast-import gave:\n%s\nwant, as git:\n%s", states[1], states[0])
+	}
+}
+
+// TestFastImportMarks checks that an import continues from the marks of a
+// previous one, and that branches are only rewound with --force.
+func TestFastImportMarks(t *testing.T) {
+	first := "blob\nmark :1\ndata 2\nx\n\ncommit refs/heads/main\nmark :2\ncommitter C <c@x> 1700000000 +0000\ndata 2\nc\nM 644 :1 x\n\n"
+	next := "commit refs/heads/main\nmark :3\ncommitter C <c@x> 1700000001 +0000\ndata 2\nd\nfrom :2\nM 644 :1 y\n\n"
+	rewind := "reset refs/heads/main\nfrom :2\n\n"
+
+	var states []string
+
+	for _, tool := range []string{"git", "gogit"} {
+		dir, res, marks := importWith(t, tool, first)
+		if res.code != 0 {
+			t.Fatalf("%s fast-import failed: %s", tool, res.stderr)
+		}
+
+		state := ""
+
+		for _, step := range []struct{ stream, args string }{
+			{next, "--import-marks=" + marks},
+			{rewind, "--import-marks=" + marks},
+			{rewind, "--import-marks=" + marks + " --force"},
+		} {
+			args := append([]string{"fast-import", "--export-marks=" + marks}, strings.Fields(step.args)...)
+
+			if tool == "git" {
+				res = run(t, dir, step.stream, "git", append(args, "--quiet")...)
+			} else {
+				res = gogitStdin(t, dir, step.stream, args...)
+			}
+
+			state += fmt.Sprintf("exit %v\n%s", res.code == 0, importState(t, dir, marks))
+		}
+
+		states = append(states, state)
+	}
+
+	if states[1] != states[0] {
+		t.Errorf("gogit fast-import gave:\n%s\nwant, as git:\n%s", states[1], states[0])
+	}
+}
@@ -2,10 +2,14 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"math"
 	"net/url"
+	"strings"
 
 	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/spf13/cobra"
 )
 
@@ -13,12 +17,14 @@ var (
 	fetchProgress  bool
 	fetchDepth     int
 	fetchUnshallow bool
+	fetchRecurse   bool
 )
 
 func init() {
 	fetchCmd.Flags().BoolVarP(&fetchProgress, "progress", "", true, "Show fetch progress")
 	fetchCmd.Flags().IntVarP(&fetchDepth, "depth", "", 0, "Create a shallow fetch of that depth")
 	fetchCmd.Flags().BoolVarP(&fetchUnshallow, "unshallow", "", false, "Convert a shallow repository to a complete one")
+	fetchCmd.Flags().BoolVarP(&fetchRecurse, "recurse-submodules", "", false, "Also fetch checked out submodules")
 
 	rootCmd.AddCommand(fetchCmd)
 	rootCmd.CompletionOptions.HiddenDefaultCmd = true
@@ -27,17 +33,45 @@ func init() {
 var fetchCmd = &cobra.Command{
 	Use:   "fetch [<options>] [--] [<repository> [<refspec>...]]",
 	Short: "Download objects and refs from another repository",
-	RunE: func(cmd *cobra.Command, _ []string) error {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		r, err := git.PlainOpen(".")
 		if err != nil {
 			return err
 		}
 
-		remote, err := r.Remote("origin")
+		remoteName := git.DefaultRemoteName
+		if len(args) > 0 {
+			remoteName = args[0]
+		}
+
+		if isBundle(remoteName) {
+			return fetchFromBundle(newHooks(r, cmd.ErrOrStderr()), remoteName, args)
+		}
+
+		remote, err := r.Remote(remoteName)
 		if err != nil {
 			return err
 		}
 
+		var refspecs []config.RefSpec
+
+		for _, arg := range args[min(len(args), 1):] {
+			refspec, err := parseFetchRefSpec(remoteName, arg)
+			if err != nil {
+				return err
+			}
+
+			refspecs = append(refspecs, refspec)
+		}
+
+		if isBundle(remote.Config().URLs[0]) {
+			if len(refspecs) == 0 {
+				refspecs = remote.Config().Fetch
+			}
+
+			return fetchFromBundle(newHooks(r, cmd.ErrOrStderr()), remote.Config().URLs[0], args, refspecs...)
+		}
+
 		ep, err := url.Parse(remote.Config().URLs[0])
 		if err != nil {
 			return err
@@ -48,6 +82,8 @@ var fetchCmd = &cobra.Command{
 		}
 
 		opts := git.FetchOptions{
+			RemoteName:    remoteName,
+			RefSpecs:      refspecs,
 			Depth:         fetchDepth,
 			ClientOptions: defaultClientOptions(ep),
 		}
@@ -56,11 +92,128 @@ var fetchCmd = &cobra.Command{
 			opts.Progress = cmd.OutOrStdout()
 		}
 
-		err = remote.Fetch(&opts)
-		if errors.Is(err, git.NoErrAlreadyUpToDate) {
+		before, err := snapshotRefs(r)
+		if err != nil {
+			return err
+		}
+
+		hs := newHooks(r, cmd.ErrOrStderr())
+
+		pending, err := holdRefUpdates(r)
+		if err != nil {
+			return err
+		}
+
+		// The remote is looked up again to update the held references.
+		err = r.Fetch(&opts)
+		if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+			pending.discard()
+
+			return err
+		}
+
+		err = pending.commit(hs, before)
+		if err != nil {
+			return err
+		}
+
+		msg := strings.Join(append([]string{"fetch"}, args...), " ")
+
+		err = logRefUpdates(hs, before, updateReflogMessage(r, msg))
+		if err != nil {
+			return err
+		}
+
+		if !fetchRecurse {
 			return nil
 		}
 
-		return err
+		return fetchSubmodules(cmd.OutOrStdout(), r, "", fetchDepth)
 	},
 }
+
+// fetchFromBundle fetches the references of the bundle at path mapped by
+// refspecs, or by the full refspecs given on the command line. Without
+// refspecs, the bundle references are only recorded in FETCH_HEAD.
+func fetchFromBundle(hs *hooks, path string, args []string, refspecs ...config.RefSpec) error {
+	r := hs.r
+
+	if len(refspecs) == 0 {
+		for _, arg := range args[1:] {
+			refspec := config.RefSpec(arg)
+			if !strings.Contains(arg, ":") {
+				continue
+			}
+
+			err := refspec.Validate()
+			if err != nil {
+				return fmt.Errorf("invalid refspec '%s': %w", arg, err)
+			}
+
+			refspecs = append(refspecs, refspec)
+		}
+	}
+
+	before, err := snapshotRefs(r)
+	if err != nil {
+		return err
+	}
+
+	pending, err := holdRefUpdates(r)
+	if err != nil {
+		return err
+	}
+
+	b, err := fetchBundle(r, path, refspecs)
+	if err != nil {
+		pending.discard()
+
+		return err
+	}
+
+	err = pending.commit(hs, before)
+	if err != nil {
+		return err
+	}
+
+	if len(refspecs) == 0 {
+		err = writeFetchHead(r, path, b)
+		if err != nil {
+			return err
+		}
+	}
+
+	msg := strings.Join(append([]string{"fetch"}, args...), " ")
+
+	return logRefUpdates(hs, before, updateReflogMessage(r, msg))
+}
+
+// parseFetchRefSpec turns a command line refspec into a config.RefSpec.
+// Full refspecs are used as given, full reference names are fetched into
+// the same name, and branch names into their remote-tracking branch.
+func parseFetchRefSpec(remote, arg string) (config.RefSpec, error) {
+	spec := arg
+
+	if !strings.Contains(arg, ":") {
+		src := strings.TrimPrefix(arg, "+")
+
+		switch {
+		case strings.HasPrefix(src, "refs/"):
+			spec = arg + ":" + src
+		default:
+			spec = fmt.Sprintf("%s:refs/remotes/%s/%s", plumbing.NewBranchReferenceName(arg), remote, arg)
+			if strings.HasPrefix(arg, "+") {
+				spec = fmt.Sprintf("+%s:refs/remotes/%s/%s", plumbing.NewBranchReferenceName(src), remote, src)
+			}
+		}
+	}
+
+	refspec := config.RefSpec(spec)
+
+	err := refspec.Validate()
+	if err != nil {
+		return "", fmt.Errorf("invalid refspec '%s': %w", arg, err)
+	}
+
+	return refspec, nil
+}
@@ -0,0 +1,906 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/spf13/cobra"
+)
+
+var (
+	filterRepoPaths          []string
+	filterRepoInvertPaths    bool
+	filterRepoPathRenames    []string
+	filterRepoReplaceText    string
+	filterRepoStripBlobs     string
+	filterRepoKeepSignatures bool
+	filterRepoForce          bool
+)
+
+const (
+	filterRepoDir         = "filter-repo"
+	filterRepoReplacement = "***REMOVED***"
+)
+
+func init() {
+	filterRepoCmd.Flags().StringArrayVarP(&filterRepoPaths, "path", "", nil, "Keep only the files at or under the path")
+	filterRepoCmd.Flags().BoolVarP(&filterRepoInvertPaths, "invert-paths", "", false, "Remove the files selected by --path instead of keeping them")
+	filterRepoCmd.Flags().StringArrayVarP(&filterRepoPathRenames, "path-rename", "", nil, "Move the files under <old> to <new>, given as <old>:<new>")
+	filterRepoCmd.Flags().StringVarP(&filterRepoReplaceText, "replace-text", "", "", "Replace the text matching the expressions read from the file in all text files")
+	filterRepoCmd.Flags().StringVarP(&filterRepoStripBlobs, "strip-blobs-bigger-than", "", "", "Remove the files bigger than the size, which may end in k, m or g")
+	filterRepoCmd.Flags().BoolVarP(&filterRepoKeepSignatures, "keep-signatures", "", false, "Keep the now invalid signatures of rewritten commits and tags")
+	filterRepoCmd.Flags().BoolVarP(&filterRepoForce, "force", "f", false, "Rewrite the history even when the working tree has changes")
+	rootCmd.AddCommand(filterRepoCmd)
+}
+
+var filterRepoCmd = &cobra.Command{
+	Use:   "filter-repo [--path <path>]... [--invert-paths] [--path-rename <old>:<new>]... [--replace-text <file>] [--strip-blobs-bigger-than <size>] [--keep-signatures] [--force]",
+	Short: "Rewrite the history to remove or rename files and contents",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		store, ok := r.Storer.(*filesystem.Storage)
+		if !ok {
+			return errors.New("storer does not implement filesystem.Storage")
+		}
+
+		fr := &repoFilter{
+			r:        r,
+			hooks:    newHooks(r, cmd.ErrOrStderr()),
+			buf:      newObjectBuffer(r),
+			invert:   filterRepoInvertPaths,
+			keepSigs: filterRepoKeepSignatures,
+			trees:    make(map[filterTreeKey]plumbing.Hash),
+			renamed:  make(map[plumbing.Hash]plumbing.Hash),
+			blobs:    make(map[plumbing.Hash]plumbing.Hash),
+			commits:  make(map[plumbing.Hash]plumbing.Hash),
+			tags:     make(map[plumbing.Hash]plumbing.Hash),
+		}
+
+		for _, p := range filterRepoPaths {
+			fr.paths = append(fr.paths, strings.Trim(p, "/"))
+		}
+
+		for _, rename := range filterRepoPathRenames {
+			from, to, ok := strings.Cut(rename, ":")
+			if !ok {
+				return fmt.Errorf("invalid path rename %q, expected <old>:<new>", rename)
+			}
+
+			fr.renames = append(fr.renames, [2]string{strings.Trim(from, "/"), strings.Trim(to, "/")})
+		}
+
+		if filterRepoReplaceText != "" {
+			fr.replacements, err = readTextReplacements(filterRepoReplaceText)
+			if err != nil {
+				return err
+			}
+		}
+
+		if filterRepoStripBlobs != "" {
+			size, err := parseScaledInt(filterRepoStripBlobs)
+			if err != nil || size <= 0 {
+				return fmt.Errorf("invalid size: %s", filterRepoStripBlobs)
+			}
+
+			fr.maxSize = int64(size)
+		}
+
+		wt, err := r.Worktree()
+		if err != nil && !errors.Is(err, git.ErrIsBareRepository) {
+			return err
+		}
+
+		if wt != nil && !filterRepoForce {
+			clean, err := trackedFilesClean(wt)
+			if err != nil {
+				return err
+			}
+
+			if !clean {
+				return errors.New("the working tree has changes; commit them first, or use --force to discard them")
+			}
+		}
+
+		var oldHead plumbing.Hash
+		if head, err := r.Head(); err == nil {
+			oldHead = head.Hash()
+		}
+
+		err = fr.rewrite()
+		if err != nil {
+			return err
+		}
+
+		err = fr.buf.writePack()
+		if err != nil {
+			return err
+		}
+
+		updated, err := fr.updateRefs(store)
+		if err != nil {
+			return err
+		}
+
+		if wt != nil && updated[plumbing.HEAD] {
+			err = resetWorktree(r, wt, oldHead)
+			if err != nil {
+				return fmt.Errorf("failed to update the working tree: %w", err)
+			}
+		}
+
+		out := cmd.OutOrStdout()
+		fmt.Fprintf(out, "Rewrote %d of %d commits, pruning %d that became empty\n", fr.rewritten, len(fr.commits), fr.pruned)
+
+		if fr.stripped > 0 {
+			fmt.Fprintf(out, "Removed %d blobs bigger than %s\n", fr.stripped, filterRepoStripBlobs)
+		}
+
+		fmt.Fprintf(out, "Updated %d references\n", len(updated))
+
+		errOut := cmd.ErrOrStderr()
+		fmt.Fprintln(errOut, "hint: The old history is kept until the reflogs expire and it is pruned, with:")
+		fmt.Fprintln(errOut, "hint:   gogit reflog expire --expire=now --all && gogit gc --prune=now")
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// trackedFilesClean reports whether the tracked files of the working tree
+// and the index match HEAD.
+func trackedFilesClean(wt *git.Worktree) (bool, error) {
+	status, err := wt.Status()
+	if err != nil {
+		return false, fmt.Errorf("failed to get status: %w", err)
+	}
+
+	for _, fs := range status {
+		if fs.Worktree != git.Untracked && (fs.Staging != git.Unmodified || fs.Worktree != git.Unmodified) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// resetWorktree checks out the rewritten HEAD, removing the files of the
+// old HEAD commit it no longer has.
+func resetWorktree(r *git.Repository, wt *git.Worktree, oldHead plumbing.Hash) error {
+	head, err := r.Head()
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	from, err := r.CommitObject(oldHead)
+	if err != nil {
+		return err
+	}
+
+	to, err := r.CommitObject(head.Hash())
+	if err != nil {
+		return err
+	}
+
+	changes, err := diffTrees(r, from.TreeHash, to.TreeHash, "")
+	if err != nil {
+		return err
+	}
+
+	err = wt.Reset(&git.ResetOptions{Commit: head.Hash(), Mode: git.HardReset})
+	if err != nil {
+		return err
+	}
+
+	paths := make(map[string]bool, len(changes))
+	for _, ch := range changes {
+		paths[ch.path] = true
+	}
+
+	err = smudgeWorktree(r, os.Stderr, paths)
+	if err != nil {
+		return err
+	}
+
+	for _, ch := range changes {
+		if !ch.to.Hash.IsZero() {
+			continue
+		}
+
+		err = wt.Filesystem.Remove(ch.path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		// Like git, leave no empty directories behind.
+		for dir := path.Dir(ch.path); dir != "."; dir = path.Dir(dir) {
+			if wt.Filesystem.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// repoFilter rewrites every commit and annotated tag reachable from the
+// references, in the order that lets each one refer to its rewritten
+// parents. Commits whose changes were all filtered out are pruned, and
+// commits left unchanged keep their ids.
+type repoFilter struct {
+	r     *git.Repository
+	hooks *hooks
+	buf   *objectBuffer
+
+	paths        []string
+	invert       bool
+	renames      [][2]string
+	replacements []textReplacement
+	maxSize      int64
+	keepSigs     bool
+
+	// The rewritten objects by their original ids; a zero id stands for a
+	// removed blob or a pruned commit with no ancestor left.
+	trees   map[filterTreeKey]plumbing.Hash
+	renamed map[plumbing.Hash]plumbing.Hash
+	blobs   map[plumbing.Hash]plumbing.Hash
+	commits map[plumbing.Hash]plumbing.Hash
+	tags    map[plumbing.Hash]plumbing.Hash
+
+	empty     plumbing.Hash
+	rewritten int
+	pruned    int
+	stripped  int
+}
+
+// filterTreeKey identifies a tree by its id and, as the path filters depend
+// on it, where it is found.
+type filterTreeKey struct {
+	hash plumbing.Hash
+	dir  string
+}
+
+func (fr *repoFilter) rewrite() error {
+	w := &revWalk{r: fr.r}
+
+	err := w.addAll()
+	if err != nil {
+		return err
+	}
+
+	commits, _, err := w.walk()
+	if err != nil {
+		return err
+	}
+
+	for _, c := range fastExportOrder(commits) {
+		err = fr.rewriteCommit(c)
+		if err != nil {
+			return err
+		}
+	}
+
+	refs, err := hashReferences(fr.r)
+	if err != nil {
+		return err
+	}
+
+	// The tags are rewritten now, to be written along with the commits.
+	for _, ref := range refs {
+		_, err = fr.rewriteObject(ref.Hash())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hashReferences returns the references under refs/ that are not symbolic.
+func hashReferences(r *git.Repository) ([]*plumbing.Reference, error) {
+	iter, err := r.Storer.IterReferences()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list references: %w", err)
+	}
+
+	var refs []*plumbing.Reference
+
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference && strings.HasPrefix(ref.Name().String(), "refs/") {
+			refs = append(refs, ref)
+		}
+
+		return nil
+	})
+
+	return refs, err
+}
+
+func (fr *repoFilter) rewriteCommit(c *object.Commit) error {
+	var parents []plumbing.Hash
+
+	for _, p := range c.ParentHashes {
+		np, ok := fr.commits[p]
+		if !ok {
+			np = p
+		}
+
+		if !np.IsZero() && !containsHash(parents, np) {
+			parents = append(parents, np)
+		}
+	}
+
+	tree, err := fr.rewriteTree(c.TreeHash, "")
+	if err != nil {
+		return err
+	}
+
+	if len(fr.renames) > 0 {
+		tree, err = fr.renameTree(tree)
+		if err != nil {
+			return err
+		}
+	}
+
+	empty, err := fr.becameEmpty(c, tree, parents)
+	if err != nil {
+		return err
+	}
+
+	if empty {
+		fr.commits[c.Hash] = plumbing.ZeroHash
+		if len(parents) > 0 {
+			fr.commits[c.Hash] = parents[0]
+		}
+
+		fr.pruned++
+
+		return nil
+	}
+
+	if tree == c.TreeHash && slices.Equal(parents, c.ParentHashes) {
+		fr.commits[c.Hash] = c.Hash
+
+		return nil
+	}
+
+	nc := *c
+	nc.TreeHash = tree
+	nc.ParentHashes = parents
+
+	if !fr.keepSigs {
+		nc.Signature = ""
+	}
+
+	obj := fr.r.Storer.NewEncodedObject()
+
+	err = nc.Encode(obj)
+	if err != nil {
+		return fmt.Errorf("failed to encode commit: %w", err)
+	}
+
+	h, err := fr.buf.store(obj)
+	if err != nil {
+		return err
+	}
+
+	fr.commits[c.Hash] = h
+	fr.rewritten++
+
+	return nil
+}
+
+// becameEmpty reports whether the commit c, rewritten to tree and parents,
+// no longer changes anything although it did before. Merges are only
+// pruned once their parents have collapsed into one.
+func (fr *repoFilter) becameEmpty(c *object.Commit, tree plumbing.Hash, parents []plumbing.Hash) (bool, error) {
+	if len(parents) > 1 {
+		return false, nil
+	}
+
+	empty := fr.emptyTree()
+
+	base := empty
+	if len(parents) == 1 {
+		p, err := object.GetCommit(fr.buf.objects, parents[0])
+		if err != nil {
+			return false, err
+		}
+
+		base = p.TreeHash
+	}
+
+	if tree != base {
+		return false, nil
+	}
+
+	if len(c.ParentHashes) > 1 {
+		return true, nil
+	}
+
+	origBase := empty
+	if len(c.ParentHashes) == 1 {
+		p, err := fr.r.CommitObject(c.ParentHashes[0])
+		if err != nil {
+			return false, err
+		}
+
+		origBase = p.TreeHash
+	}
+
+	return c.TreeHash != origBase, nil
+}
+
+func (fr *repoFilter) emptyTree() plumbing.Hash {
+	if fr.empty.IsZero() {
+		obj := fr.r.Storer.NewEncodedObject()
+		obj.SetType(plumbing.TreeObject)
+
+		fr.empty = obj.Hash()
+	}
+
+	return fr.empty
+}
+
+// rewriteTree applies the path filters and the blob rewrites to the tree h
+// found at dir, leaving out the directories left empty.
+func (fr *repoFilter) rewriteTree(h plumbing.Hash, dir string) (plumbing.Hash, error) {
+	key := filterTreeKey{hash: h}
+	if len(fr.paths) > 0 {
+		key.dir = dir
+	}
+
+	if nh, ok := fr.trees[key]; ok {
+		return nh, nil
+	}
+
+	tree, err := object.GetTree(fr.buf.objects, h)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to read tree %s: %w", h, err)
+	}
+
+	entries := make([]object.TreeEntry, 0, len(tree.Entries))
+	changed := false
+
+	for _, e := range tree.Entries {
+		p := path.Join(dir, e.Name)
+
+		switch {
+		case e.Mode == filemode.Dir && !fr.wantDir(p), e.Mode != filemode.Dir && !fr.wantFile(p):
+			changed = true
+
+			continue
+		case e.Mode == filemode.Dir:
+			nh, err := fr.rewriteTree(e.Hash, p)
+			if err != nil {
+				return plumbing.ZeroHash, err
+			}
+
+			changed = changed || nh != e.Hash
+			if nh == fr.emptyTree() {
+				continue
+			}
+
+			e.Hash = nh
+		case e.Mode != filemode.Submodule:
+			nh, err := fr.rewriteBlob(e.Hash)
+			if err != nil {
+				return plumbing.ZeroHash, err
+			}
+
+			changed = changed || nh != e.Hash
+			if nh.IsZero() {
+				continue
+			}
+
+			e.Hash = nh
+		}
+
+		entries = append(entries, e)
+	}
+
+	nh := h
+
+	if changed {
+		obj := fr.r.Storer.NewEncodedObject()
+
+		err = (&object.Tree{Entries: entries}).Encode(obj)
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("failed to encode tree: %w", err)
+		}
+
+		nh, err = fr.buf.store(obj)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	fr.trees[key] = nh
+
+	return nh, nil
+}
+
+// wantFile reports whether the path filters keep the file p.
+func (fr *repoFilter) wantFile(p string) bool {
+	if len(fr.paths) == 0 {
+		return true
+	}
+
+	for _, spec := range fr.paths {
+		if p == spec || strings.HasPrefix(p, spec+"/") {
+			return !fr.invert
+		}
+	}
+
+	return fr.invert
+}
+
+// wantDir reports whether the path filters may keep files under the
+// directory p.
+func (fr *repoFilter) wantDir(p string) bool {
+	if fr.invert || len(fr.paths) == 0 {
+		return fr.wantFile(p)
+	}
+
+	for _, spec := range fr.paths {
+		if strings.HasPrefix(spec, p+"/") {
+			return true
+		}
+	}
+
+	return fr.wantFile(p)
+}
+
+// rewriteBlob returns the blob h with the text replacements applied, or a
+// zero id if it is too big to keep.
+func (fr *repoFilter) rewriteBlob(h plumbing.Hash) (plumbing.Hash, error) {
+	if nh, ok := fr.blobs[h]; ok {
+		return nh, nil
+	}
+
+	obj, err := fr.buf.objects.EncodedObject(plumbing.BlobObject, h)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to read blob %s: %w", h, err)
+	}
+
+	nh := h
+
+	switch {
+	case fr.maxSize > 0 && obj.Size() > fr.maxSize:
+		nh = plumbing.ZeroHash
+		fr.stripped++
+	case len(fr.replacements) > 0:
+		rd, err := obj.Reader()
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		data, err := io.ReadAll(rd)
+		_ = rd.Close()
+
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("failed to read blob %s: %w", h, err)
+		}
+
+		// Like git, binary files are left alone.
+		if isBinary(data) {
+			break
+		}
+
+		replaced := data
+		for _, rep := range fr.replacements {
+			replaced = rep.apply(replaced)
+		}
+
+		if !bytes.Equal(replaced, data) {
+			nh, err = fr.buf.storeObject(plumbing.BlobObject, replaced)
+			if err != nil {
+				return plumbing.ZeroHash, err
+			}
+		}
+	}
+
+	fr.blobs[h] = nh
+
+	return nh, nil
+}
+
+// renameTree moves the files of the tree h according to --path-rename.
+func (fr *repoFilter) renameTree(h plumbing.Hash) (plumbing.Hash, error) {
+	if nh, ok := fr.renamed[h]; ok {
+		return nh, nil
+	}
+
+	files := make(map[string]importFile)
+
+	err := fr.buf.loadTree(files, h, "")
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	moved := make(map[string]importFile, len(files))
+
+	for p, file := range files {
+		for _, rename := range fr.renames {
+			if rename[0] == "" {
+				p = path.Join(rename[1], p)
+
+				break
+			}
+
+			if rest, ok := strings.CutPrefix(p, rename[0]); ok && (rest == "" || rest[0] == '/') {
+				p = strings.TrimPrefix(rename[1]+rest, "/")
+
+				break
+			}
+		}
+
+		moved[p] = file
+	}
+
+	nh, err := fr.buf.writeTree(moved)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	fr.renamed[h] = nh
+
+	return nh, nil
+}
+
+// rewriteObject returns the rewritten id of the object a reference points
+// at.
+func (fr *repoFilter) rewriteObject(h plumbing.Hash) (plumbing.Hash, error) {
+	if nh, ok := fr.commits[h]; ok {
+		return nh, nil
+	}
+
+	if _, err := fr.r.TagObject(h); err == nil {
+		return fr.rewriteTag(h)
+	}
+
+	return h, nil
+}
+
+// rewriteTag points the annotated tag h at the rewritten object it tags,
+// or returns a zero id when that object is gone.
+func (fr *repoFilter) rewriteTag(h plumbing.Hash) (plumbing.Hash, error) {
+	if nh, ok := fr.tags[h]; ok {
+		return nh, nil
+	}
+
+	tag, err := fr.r.TagObject(h)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	target, err := fr.rewriteObject(tag.Target)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	nh := h
+
+	switch {
+	case target.IsZero():
+		nh = plumbing.ZeroHash
+	case target != tag.Target:
+		nt := *tag
+		nt.Target = target
+
+		if !fr.keepSigs {
+			nt.Signature = ""
+		}
+
+		obj := fr.r.Storer.NewEncodedObject()
+
+		err = nt.Encode(obj)
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("failed to encode tag: %w", err)
+		}
+
+		nh, err = fr.buf.store(obj)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	fr.tags[h] = nh
+
+	return nh, nil
+}
+
+// updateRefs points the references at the rewritten history, deleting
+// those left with nothing to point at, and writes the commit and reference
+// maps. It returns the references that changed, including HEAD when the
+// branch it is on did.
+func (fr *repoFilter) updateRefs(store *filesystem.Storage) (map[plumbing.ReferenceName]bool, error) {
+	refs, err := hashReferences(fr.r)
+	if err != nil {
+		return nil, err
+	}
+
+	head, _ := fr.r.Head()
+
+	updated := make(map[plumbing.ReferenceName]bool)
+	hexSize := fr.emptyTree().HexSize()
+
+	var refMap strings.Builder
+
+	fmt.Fprintf(&refMap, "%-*s %-*s %s\n", hexSize, "old", hexSize, "new", "ref")
+
+	err = inRefTransaction(fr.hooks, staticReflogMessage("filter-repo: rewrite"), func() error {
+		for _, ref := range refs {
+			nh, err := fr.rewriteObject(ref.Hash())
+			if err != nil {
+				return err
+			}
+
+			if nh == ref.Hash() {
+				continue
+			}
+
+			if nh.IsZero() {
+				err = fr.r.Storer.RemoveReference(ref.Name())
+			} else {
+				err = fr.r.Storer.SetReference(plumbing.NewHashReference(ref.Name(), nh))
+			}
+
+			if err != nil {
+				return fmt.Errorf("cannot update ref '%s': %w", ref.Name(), err)
+			}
+
+			fmt.Fprintf(&refMap, "%s %s %s\n", ref.Hash(), nh, ref.Name())
+
+			updated[ref.Name()] = true
+
+			if head != nil && head.Name() == ref.Name() {
+				updated[plumbing.HEAD] = true
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var commitMap strings.Builder
+
+	fmt.Fprintf(&commitMap, "%-*s %s\n", hexSize, "old", "new")
+
+	for _, c := range sortedHashes(fr.commits) {
+		fmt.Fprintf(&commitMap, "%s %s\n", c, fr.commits[c])
+	}
+
+	fs := store.Filesystem()
+
+	err = fs.MkdirAll(filterRepoDir, 0o755)
+	if err == nil {
+		err = util.WriteFile(fs, path.Join(filterRepoDir, "commit-map"), []byte(commitMap.String()), 0o644)
+	}
+
+	if err == nil {
+		err = util.WriteFile(fs, path.Join(filterRepoDir, "ref-map"), []byte(refMap.String()), 0o644)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to write the commit map: %w", err)
+	}
+
+	return updated, nil
+}
+
+func sortedHashes(m map[plumbing.Hash]plumbing.Hash) []plumbing.Hash {
+	hashes := make([]plumbing.Hash, 0, len(m))
+	for h := range m {
+		hashes = append(hashes, h)
+	}
+
+	slices.SortFunc(hashes, func(a, b plumbing.Hash) int { return a.Compare(b.Bytes()) })
+
+	return hashes
+}
+
+// textReplacement replaces the text matching an expression of a
+// --replace-text file.
+type textReplacement struct {
+	literal []byte
+	re      *regexp.Regexp
+	with    []byte
+}
+
+func (t textReplacement) apply(data []byte) []byte {
+	if t.re != nil {
+		return t.re.ReplaceAll(data, t.with)
+	}
+
+	return bytes.ReplaceAll(data, t.literal, t.with)
+}
+
+// readTextReplacements reads a --replace-text file. Each line holds a
+// literal text, or a "regex:" or "glob:" expression, optionally followed by
+// "==>" and its replacement, which is ***REMOVED*** otherwise.
+func readTextReplacements(name string) ([]textReplacement, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read replacements: %w", err)
+	}
+
+	defer f.Close()
+
+	var reps []textReplacement
+
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+
+		rep := textReplacement{with: []byte(filterRepoReplacement)}
+
+		if i := strings.LastIndex(line, "==>"); i >= 0 {
+			line, rep.with = line[:i], []byte(line[i+3:])
+		}
+
+		switch {
+		case strings.HasPrefix(line, "regex:"):
+			rep.re, err = regexp.Compile(strings.TrimPrefix(line, "regex:"))
+		case strings.HasPrefix(line, "glob:"):
+			rep.re, err = regexp.Compile(globToRegexp(strings.TrimPrefix(line, "glob:")))
+		default:
+			rep.literal = []byte(strings.TrimPrefix(line, "literal:"))
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid replacement %q: %w", line, err)
+		}
+
+		reps = append(reps, rep)
+	}
+
+	return reps, scanner.Err()
+}
+
+// globToRegexp translates a glob, where * matches any text and ? any
+// character, to a regular expression.
+func globToRegexp(glob string) string {
+	var sb strings.Builder
+
+	for _, c := range glob {
+		switch c {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// filterRepo returns a repository made by git with a secret, in a file and
+// in the text of another, a large file, a branch merged back, and
+// annotated and lightweight tags.
+func filterRepo(t *testing.T) string {
+	t.Helper()
+
+	dir := gitRepo(t,
+		[]string{"a", "hello\n", "d/x", "1\n"},
+		[]string{"a", "password=hunter2\n", "secret", "key\n"},
+		[]string{"d/x", "2\n", "d/y/z", "3\n"},
+	)
+
+	gitCmd(t, dir, "tag", "-a", "-m", "v1", "v1", "HEAD~1")
+	gitCmd(t, dir, "tag", "light", "HEAD~1")
+
+	gitCmd(t, dir, "checkout", "-q", "-b", "topic")
+	writeFile(t, dir, "big", strings.Repeat("large\n", 500))
+	writeFile(t, dir, "d/x", "topic\n")
+	gitCmd(t, dir, "add", "big", "d/x")
+	gitCmd(t, dir, "commit", "-q", "-m", "topic")
+
+	gitCmd(t, dir, "checkout", "-q", "main")
+	writeFile(t, dir, "a", "password=hunter2 again\n")
+	gitCmd(t, dir, "commit", "-q", "-a", "-m", "main")
+	gitCmd(t, dir, "merge", "-q", "--no-ff", "-m", "merge topic", "topic")
+
+	writeFile(t, dir, "secret", "rotated\n")
+	gitCmd(t, dir, "commit", "-q", "-a", "-m", "rotate the secret")
+
+	return dir
+}
+
+// filterBranch rewrites the history of dir as git filter-branch does, with
+// an index filter run by the shell.
+func filterBranch(t *testing.T, dir string, filter ...string) {
+	t.Helper()
+
+	args := append([]string{"FILTER_BRANCH_SQUELCH_WARNING=1", "git", "filter-branch", "-f", "--prune-empty", "--tag-name-filter", "cat"}, filter...)
+
+	res := run(t, dir, "", "env", append(args, "--", "--all")...)
+	if res.code != 0 {
+		t.Fatalf("git filter-branch %v failed: %s", filter, res.stderr)
+	}
+}
+
+// filteredRefs returns the branches and tags of dir with the objects they
+// name, and the files HEAD has.
+func filteredRefs(t *testing.T, dir string) string {
+	t.Helper()
+
+	return gitCmd(t, dir, "for-each-ref", "--format=%(objectname) %(refname)", "refs/heads", "refs/tags") +
+		gitCmd(t, dir, "ls-files", "-s") + gitCmd(t, dir, "status", "--porcelain")
+}
+
+// TestFilterRepo checks that the history gogit filter-repo writes is the
+// one git filter-branch writes with the same filters.
+func TestFilterRepo(t *testing.T) {
+	// An index filter keeping the files whose paths match, as rewritten by
+	// sed, in the index.
+	keep := func(pattern, sed string) []string {
+		return []string{"--index-filter", fmt.Sprintf(
+			`git ls-files -s | grep -E '%s' | sed -E '%s' | GIT_INDEX_FILE=$GIT_INDEX_FILE.new git update-index --index-info && mv "$GIT_INDEX_FILE.new" "$GIT_INDEX_FILE"`,
+			pattern, sed)}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		args   []string
+		filter []string
+	}{
+		{"remove a file", []string{"--path", "secret", "--invert-paths"}, []string{"--index-filter", "git rm -q --cached --ignore-unmatch secret"}},
+		{"remove a directory", []string{"--path", "d/y/", "--invert-paths"}, []string{"--index-filter", "git rm -q -r --cached --ignore-unmatch d/y"}},
+		{"keep a directory", []string{"--path", "d"}, keep("\td/", "s,x,x,")},
+		{"keep paths", []string{"--path", "d/x", "--path", "a"}, keep("\t(d/x|a)$", "s,x,x,")},
+		{"rename a directory", []string{"--path-rename", "d:e/f"}, keep(".", "s,\td/,\te/f/,")},
+		{"rename and keep", []string{"--path", "d", "--path-rename", "d/:"}, keep("\td/", "s,\td/,\t,")},
+		{"strip large blobs", []string{"--strip-blobs-bigger-than", "1K"}, []string{"--index-filter", "git rm -q --cached --ignore-unmatch big"}},
+		{"replace text", []string{"--replace-text", "REPLACE"}, []string{"--tree-filter", "sed -i -e 's/hunter2/***REMOVED***/g' -e 's/key/KeY/' a secret 2>/dev/null; true"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			want := filterRepo(t)
+			filterBranch(t, want, tc.filter...)
+			gitCmd(t, want, "reset", "-q", "--hard")
+
+			got := filterRepo(t)
+			writeFile(t, got, ".git/REPLACE", "hunter2\nregex:(?m)^k(e)y$==>K${1}Y\n")
+
+			args := append([]string{"filter-repo"}, tc.args...)
+			for i, arg := range args {
+				if arg == "REPLACE" {
+					args[i] = filepath.Join(got, ".git", "REPLACE")
+				}
+			}
+
+			mustGogit(t, got, args...)
+
+			if g, w := filteredRefs(t, got), filteredRefs(t, want); g != w {
+				t.Errorf("gogit filter-repo %v gave:\n%s\nwant, as git filter-branch:\n%s", tc.args, g, w)
+			}
+
+			gitCmd(t, got, "fsck", "--strict")
+		})
+	}
+}
+
+// TestFilterRepoCommitMap checks the map of the old commits to the new ones,
+// where pruned commits map to the commit that replaces them.
+func TestFilterRepoCommitMap(t *testing.T) {
+	dir := filterRepo(t)
+	old := strings.Fields(gitCmd(t, dir, "rev-list", "--all"))
+	oldMain := gitCmd(t, dir, "rev-parse", "main")[:40]
+
+	mustGogit(t, dir, "filter-repo", "--path", "d")
+
+	lines := strings.Split(strings.TrimSpace(readFile(t, filepath.Join(dir, ".git", "filter-repo", "commit-map"))), "\n")
+	if len(lines) != len(old)+1 || strings.Fields(lines[0])[0] != "old" {
+		t.Fatalf("commit-map has %d lines for %d commits:\n%s", len(lines), len(old), strings.Join(lines, "\n"))
+	}
+
+	commits := map[string]string{}
+
+	for _, line := range lines[1:] {
+		f := strings.Fields(line)
+		commits[f[0]] = f[1]
+	}
+
+	if got, want := commits[oldMain], gitCmd(t, dir, "rev-parse", "main")[:40]; got != want {
+		t.Errorf("commit-map maps main to %s, want %s", got, want)
+	}
+
+	kept := gitCmd(t, dir, "rev-list", "--all")
+	for old, h := range commits {
+		if !strings.Contains(kept, h) {
+			t.Errorf("commit-map maps %s to %s, which is not in the new history", old, h)
+		}
+	}
+
+	if got := gitCmd(t, dir, "rev-list", "--count", "--all"); got != "4\n" {
+		t.Errorf("filter-repo --path d left %s commits, want 4", got)
+	}
+}
+
+// TestFilterRepoSignatures checks that the signatures of rewritten commits
+// and tags are dropped, unless kept, and those of other commits are kept.
+func TestFilterRepoSignatures(t *testing.T) {
+	for _, keep := range []bool{false, true} {
+		dir := filterRepo(t)
+		writeFile(t, dir, "a", "signed\n")
+		writeFile(t, dir, "secret", "signed\n")
+		gitCmd(t, dir, "commit", "-q", "-a", "-m", "signed")
+
+		sig := "-----BEGIN PGP SIGNATURE-----\n\nnot a real signature\n-----END PGP SIGNATURE-----\n"
+		commit := strings.Replace(gitCmd(t, dir, "cat-file", "commit", "main"), "\n\n",
+			"\ngpgsig "+strings.ReplaceAll(strings.TrimSuffix(sig, "\n"), "\n", "\n ")+"\n\n", 1)
+		gitCmd(t, dir, "update-ref", "refs/heads/main", strings.TrimSpace(gitCmdStdin(t, dir, commit, "hash-object", "-t", "commit", "-w", "--stdin")))
+
+		tag := fmt.Sprintf("object %s\ntype commit\ntag signed\ntagger T <t@x> 1700000000 +0000\n\nsigned\n%s", gitCmd(t, dir, "rev-parse", "main")[:40], sig)
+		gitCmd(t, dir, "update-ref", "refs/tags/signed", strings.TrimSpace(gitCmdStdin(t, dir, tag, "mktag")))
+
+		root := gitCmd(t, dir, "rev-list", "--max-parents=0", "main")[:40]
+		untouched := strings.Replace(gitCmd(t, dir, "cat-file", "commit", root), "\n\n",
+			"\ngpgsig "+strings.ReplaceAll(strings.TrimSuffix(sig, "\n"), "\n", "\n ")+"\n\n", 1)
+		gitCmd(t, dir, "update-ref", "refs/heads/root", strings.TrimSpace(gitCmdStdin(t, dir, untouched, "hash-object", "-t", "commit", "-w", "--stdin")))
+
+		args := []string{"filter-repo", "--path", "secret", "--invert-paths"}
+		if keep {
+			args = append(args, "--keep-signatures")
+		}
+
+		mustGogit(t, dir, args...)
+
+		for _, rev := range []string{"main", "signed", "root"} {
+			signed := strings.Contains(gitCmd(t, dir, "cat-file", "-p", rev), "BEGIN PGP SIGNATURE")
+			if want := keep || rev == "root"; signed != want {
+				t.Errorf("filter-repo %v left %s signed %v, want %v", args[1:], rev, signed, want)
+			}
+		}
+	}
+}
+
+// TestFilterRepoWorkingTree checks that the history of a repository with
+// changes is only rewritten with --force, and that the working tree
+// follows HEAD.
+func TestFilterRepoWorkingTree(t *testing.T) {
+	dir := filterRepo(t)
+	writeFile(t, dir, "a", "changed\n")
+
+	if res := gogit(t, dir, "filter-repo", "--path", "secret", "--invert-paths"); res.code == 0 {
+		t.Error("gogit filter-repo rewrote the history of a repository with changes")
+	}
+
+	mustGogit(t, dir, "filter-repo", "--path", "secret", "--invert-paths", "--force")
+
+	if exists(t, dir, "secret") {
+		t.Error("gogit filter-repo left the removed file in the working tree")
+	}
+
+	if got := gitCmd(t, dir, "log", "--all", "--format=%h", "--", "secret"); got != "" {
+		t.Errorf("commits still have the removed file: %s", got)
+	}
+}
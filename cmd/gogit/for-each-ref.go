@@ -0,0 +1,729 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/spf13/cobra"
+)
+
+const defaultForEachRefFormat = "%(objectname) %(objecttype)\t%(refname)"
+
+var (
+	forEachRefFormat     string
+	forEachRefSort       []string
+	forEachRefCount      int
+	forEachRefPointsAt   string
+	forEachRefMerged     string
+	forEachRefNoMerged   string
+	forEachRefContains   string
+	forEachRefNoContains string
+)
+
+func init() {
+	forEachRefCmd.Flags().StringVarP(&forEachRefFormat, "format", "", defaultForEachRefFormat, "Format of the line shown for each reference")
+	forEachRefCmd.Flags().StringArrayVarP(&forEachRefSort, "sort", "", nil, "Sort on the given field, descending if prefixed with -")
+	forEachRefCmd.Flags().IntVarP(&forEachRefCount, "count", "", 0, "Stop after showing <count> references")
+	forEachRefCmd.Flags().StringVarP(&forEachRefPointsAt, "points-at", "", "", "Only list references pointing at the given object")
+	forEachRefCmd.Flags().StringVarP(&forEachRefMerged, "merged", "", "", "Only list references reachable from the given commit")
+	forEachRefCmd.Flags().StringVarP(&forEachRefNoMerged, "no-merged", "", "", "Only list references not reachable from the given commit")
+	forEachRefCmd.Flags().StringVarP(&forEachRefContains, "contains", "", "", "Only list references containing the given commit")
+	forEachRefCmd.Flags().StringVarP(&forEachRefNoContains, "no-contains", "", "", "Only list references not containing the given commit")
+
+	rootCmd.AddCommand(forEachRefCmd)
+}
+
+var forEachRefCmd = &cobra.Command{
+	Use:   "for-each-ref [--count=<count>] [--format=<format>] [--sort=<key>]... [--points-at=<object>] [--merged=<commit>] [--no-merged=<commit>] [--contains=<commit>] [--no-contains=<commit>] [<pattern>...]",
+	Short: "Output information on each reference",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		format, err := parseAtomFormat(forEachRefFormat)
+		if err != nil {
+			return err
+		}
+
+		filter, err := newRefFilter(r)
+		if err != nil {
+			return err
+		}
+
+		refs, err := sortedReferences(r)
+		if err != nil {
+			return err
+		}
+
+		var infos []*refInfo
+
+		for _, ref := range refs {
+			if len(args) > 0 && !matchesRefPrefix(ref.Name(), args) {
+				continue
+			}
+
+			info := &refInfo{r: r, ref: ref}
+			if !filter.match(info) {
+				continue
+			}
+
+			infos = append(infos, info)
+		}
+
+		err = sortRefInfos(infos, forEachRefSort)
+		if err != nil {
+			return err
+		}
+
+		if forEachRefCount > 0 && len(infos) > forEachRefCount {
+			infos = infos[:forEachRefCount]
+		}
+
+		for _, info := range infos {
+			line, err := format.expand(info.field)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintln(cmd.OutOrStdout(), line)
+		}
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// matchesRefPrefix reports whether name is matched by one of patterns,
+// either as a leading path or as a glob.
+func matchesRefPrefix(name plumbing.ReferenceName, patterns []string) bool {
+	for _, p := range patterns {
+		prefix := strings.TrimSuffix(p, "/")
+		if name.String() == prefix || strings.HasPrefix(name.String(), prefix+"/") {
+			return true
+		}
+
+		if ok, _ := path.Match(p, name.String()); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// refFilter holds the --points-at, --merged and --contains conditions.
+type refFilter struct {
+	r          *git.Repository
+	pointsAt   *plumbing.Hash
+	merged     *plumbing.Hash
+	noMerged   *plumbing.Hash
+	contains   *plumbing.Hash
+	noContains *plumbing.Hash
+}
+
+func newRefFilter(r *git.Repository) (*refFilter, error) {
+	f := &refFilter{r: r}
+
+	for _, opt := range []struct {
+		rev    string
+		commit bool
+		dst    **plumbing.Hash
+	}{
+		{forEachRefPointsAt, false, &f.pointsAt},
+		{forEachRefMerged, true, &f.merged},
+		{forEachRefNoMerged, true, &f.noMerged},
+		{forEachRefContains, true, &f.contains},
+		{forEachRefNoContains, true, &f.noContains},
+	} {
+		if opt.rev == "" {
+			continue
+		}
+
+		h, err := resolveObject(r, opt.rev)
+		if err == nil && opt.commit {
+			h, err = resolvePeeled(r, h.String(), plumbing.CommitObject.String())
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("malformed object name %s", opt.rev)
+		}
+
+		*opt.dst = &h
+	}
+
+	return f, nil
+}
+
+func (f *refFilter) match(info *refInfo) bool {
+	if f.pointsAt != nil && info.ref.Hash() != *f.pointsAt {
+		tag, ok := info.object().(*object.Tag)
+		if !ok || tag.Target != *f.pointsAt {
+			return false
+		}
+	}
+
+	if f.merged == nil && f.noMerged == nil && f.contains == nil && f.noContains == nil {
+		return true
+	}
+
+	c, ok := info.peeled().(*object.Commit)
+	if !ok {
+		return false
+	}
+
+	return (f.merged == nil || f.reaches(*f.merged, c.Hash)) &&
+		(f.noMerged == nil || !f.reaches(*f.noMerged, c.Hash)) &&
+		(f.contains == nil || f.reaches(c.Hash, *f.contains)) &&
+		(f.noContains == nil || !f.reaches(c.Hash, *f.noContains))
+}
+
+// reaches reports whether the commit to is reachable from from, a failure
+// to read either commit counting as not.
+func (f *refFilter) reaches(from, to plumbing.Hash) bool {
+	ok, err := isAncestor(f.r, to, from)
+
+	return err == nil && ok
+}
+
+// refInfo is a reference being listed, with its objects loaded on demand.
+type refInfo struct {
+	r   *git.Repository
+	ref *plumbing.Reference
+
+	obj    object.Object
+	loaded bool
+}
+
+func (i *refInfo) object() object.Object {
+	if !i.loaded {
+		i.obj, _ = i.r.Object(plumbing.AnyObject, i.ref.Hash())
+		i.loaded = true
+	}
+
+	return i.obj
+}
+
+// peeled returns the object the reference points at after following tags.
+func (i *refInfo) peeled() object.Object {
+	obj := i.object()
+
+	for {
+		tag, ok := obj.(*object.Tag)
+		if !ok {
+			return obj
+		}
+
+		next, err := tag.Object()
+		if err != nil {
+			return nil
+		}
+
+		obj = next
+	}
+}
+
+// field returns the value of the atom name, with any modifier after a
+// colon. Atoms prefixed with * describe the object a tag points at.
+func (i *refInfo) field(name string) (string, error) {
+	obj := i.object()
+
+	deref := strings.HasPrefix(name, "*")
+	if deref {
+		name = name[1:]
+
+		tag, ok := obj.(*object.Tag)
+		if !ok {
+			return "", nil
+		}
+
+		var err error
+
+		obj, err = tag.Object()
+		if err != nil {
+			return "", nil
+		}
+	}
+
+	atom, modifier, _ := strings.Cut(name, ":")
+
+	switch atom {
+	case "refname":
+		if deref {
+			return "", nil
+		}
+
+		return formatRefName(i.ref.Name(), modifier)
+	case "objectname":
+		if obj == nil {
+			return i.ref.Hash().String(), nil
+		}
+
+		return formatObjectName(obj.ID(), modifier)
+	case "objecttype":
+		if obj == nil {
+			return "", nil
+		}
+
+		return obj.Type().String(), nil
+	case "objectsize":
+		encoded, err := i.r.Storer.EncodedObject(plumbing.AnyObject, objectID(obj, i.ref.Hash()))
+		if err != nil {
+			return "", nil
+		}
+
+		return strconv.FormatInt(encoded.Size(), 10), nil
+	case "HEAD":
+		head, err := i.r.Storer.Reference(plumbing.HEAD)
+		if err == nil && head.Type() == plumbing.SymbolicReference && head.Target() == i.ref.Name() {
+			return "*", nil
+		}
+
+		return " ", nil
+	case "symref":
+		ref, err := i.r.Storer.Reference(i.ref.Name())
+		if err != nil || ref.Type() != plumbing.SymbolicReference {
+			return "", nil
+		}
+
+		return formatRefName(ref.Target(), modifier)
+	case "upstream":
+		upstream := i.upstream()
+		if upstream == "" {
+			return "", nil
+		}
+
+		return formatRefName(upstream, modifier)
+	}
+
+	return objectField(obj, atom, modifier)
+}
+
+// upstream returns the remote-tracking branch a local branch follows.
+func (i *refInfo) upstream() plumbing.ReferenceName {
+	return branchUpstream(i.r, i.ref.Name())
+}
+
+func objectID(obj object.Object, fallback plumbing.Hash) plumbing.Hash {
+	if obj == nil {
+		return fallback
+	}
+
+	return obj.ID()
+}
+
+// objectField returns the fields read from the content of commits and
+// tags.
+func objectField(obj object.Object, atom, modifier string) (string, error) {
+	var (
+		message             string
+		author, committer   *object.Signature
+		tagger              *object.Signature
+		tree, target, typ   string
+		tagName, parentList string
+	)
+
+	switch o := obj.(type) {
+	case *object.Commit:
+		message = o.Message
+		author, committer = &o.Author, &o.Committer
+		tree = o.TreeHash.String()
+
+		parents := make([]string, 0, len(o.ParentHashes))
+		for _, p := range o.ParentHashes {
+			parents = append(parents, p.String())
+		}
+
+		parentList = strings.Join(parents, " ")
+	case *object.Tag:
+		message = o.Message
+		tagger = &o.Tagger
+		target, typ, tagName = o.Target.String(), o.TargetType.String(), o.Name
+	}
+
+	creator := committer
+	if tagger != nil {
+		creator = tagger
+	}
+
+	switch atom {
+	case "tree":
+		return tree, nil
+	case "parent":
+		return parentList, nil
+	case "object":
+		return target, nil
+	case "type":
+		return typ, nil
+	case "tag":
+		return tagName, nil
+	case "author", "authorname", "authoremail", "authordate":
+		return signatureField(author, strings.TrimPrefix(atom, "author"), modifier)
+	case "committer", "committername", "committeremail", "committerdate":
+		return signatureField(committer, strings.TrimPrefix(atom, "committer"), modifier)
+	case "tagger", "taggername", "taggeremail", "taggerdate":
+		return signatureField(tagger, strings.TrimPrefix(atom, "tagger"), modifier)
+	case "creator", "creatordate":
+		return signatureField(creator, strings.TrimPrefix(atom, "creator"), modifier)
+	case "subject":
+		subject, _ := splitMessage(message)
+
+		return subject, nil
+	case "body":
+		_, body := splitMessage(message)
+
+		return body, nil
+	case "contents":
+		subject, body := splitMessage(message)
+
+		switch modifier {
+		case "":
+			return message, nil
+		case "subject":
+			return subject, nil
+		case "body":
+			return body, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown field name: %s", atom)
+}
+
+func signatureField(sig *object.Signature, field, modifier string) (string, error) {
+	if sig == nil {
+		return "", nil
+	}
+
+	switch field {
+	case "":
+		return fmt.Sprintf("%s <%s> %d %s", sig.Name, sig.Email, sig.When.Unix(), sig.When.Format("-0700")), nil
+	case "name":
+		return sig.Name, nil
+	case "email":
+		switch modifier {
+		case "trim":
+			return sig.Email, nil
+		case "localpart":
+			local, _, _ := strings.Cut(sig.Email, "@")
+
+			return local, nil
+		default:
+			return "<" + sig.Email + ">", nil
+		}
+	default:
+		return formatRefDate(sig.When, modifier)
+	}
+}
+
+func formatRefDate(when time.Time, modifier string) (string, error) {
+	switch modifier {
+	case "", "default":
+		return when.Format(logDateFormat), nil
+	case "iso", "iso8601":
+		return when.Format(isoDateFormat), nil
+	case "iso-strict", "iso8601-strict":
+		return when.Format(strictISOFormat), nil
+	case "rfc", "rfc2822":
+		return when.Format(rfc2822DateFormat), nil
+	case "short":
+		return when.Format(time.DateOnly), nil
+	case "unix":
+		return strconv.FormatInt(when.Unix(), 10), nil
+	case "raw":
+		return fmt.Sprintf("%d %s", when.Unix(), when.Format("-0700")), nil
+	default:
+		return "", fmt.Errorf("unknown date format: %s", modifier)
+	}
+}
+
+// formatRefName applies the :short, :lstrip=<n> and :rstrip=<n> modifiers.
+func formatRefName(name plumbing.ReferenceName, modifier string) (string, error) {
+	key, value, _ := strings.Cut(modifier, "=")
+
+	switch key {
+	case "":
+		return name.String(), nil
+	case "short":
+		return name.Short(), nil
+	case "lstrip", "strip", "rstrip":
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return "", fmt.Errorf("integer value expected refname:%s", modifier)
+		}
+
+		parts := strings.Split(name.String(), "/")
+
+		// A negative count keeps that many components instead.
+		if n < 0 {
+			n = max(len(parts)+n, 0)
+		}
+
+		n = min(n, len(parts))
+
+		if key == "rstrip" {
+			return strings.Join(parts[:len(parts)-n], "/"), nil
+		}
+
+		return strings.Join(parts[n:], "/"), nil
+	default:
+		return "", fmt.Errorf("unrecognized %%(refname) argument: %s", modifier)
+	}
+}
+
+func formatObjectName(h plumbing.Hash, modifier string) (string, error) {
+	switch {
+	case modifier == "":
+		return h.String(), nil
+	case modifier == "short":
+		return h.String()[:7], nil
+	case strings.HasPrefix(modifier, "short="):
+		n, err := strconv.Atoi(strings.TrimPrefix(modifier, "short="))
+		if err != nil {
+			return "", fmt.Errorf("positive value expected objectname:%s", modifier)
+		}
+
+		return h.String()[:min(max(n, 4), h.HexSize())], nil
+	default:
+		return "", fmt.Errorf("unrecognized %%(objectname) argument: %s", modifier)
+	}
+}
+
+// atomFormat is a parsed --format string of %(atom) placeholders: literal
+// text and atoms, in turn.
+type atomFormat struct {
+	literals []string
+	atoms    []string
+}
+
+func parseAtomFormat(format string) (*atomFormat, error) {
+	return parseFormat(format, hexEscape)
+}
+
+// formatEscape decodes the escape at the start of s, which follows a '%'
+// that does not start an atom, returning its text and length. A zero length
+// leaves the '%' as it is.
+type formatEscape func(s string) (string, int, error)
+
+// parseFormat parses a --format string of %(atom) placeholders, "%%" and
+// the escapes that escape decodes.
+func parseFormat(format string, escape formatEscape) (*atomFormat, error) {
+	f := &atomFormat{}
+
+	var literal strings.Builder
+
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' {
+			literal.WriteByte(c)
+
+			continue
+		}
+
+		rest := format[i+1:]
+
+		switch {
+		case strings.HasPrefix(rest, "%"):
+			literal.WriteByte('%')
+			i++
+		case strings.HasPrefix(rest, "("):
+			end := strings.IndexByte(rest, ')')
+			if end < 0 {
+				return nil, fmt.Errorf("malformed format string %s", format)
+			}
+
+			f.literals = append(f.literals, literal.String())
+			f.atoms = append(f.atoms, rest[1:end])
+			literal.Reset()
+
+			i += end + 1
+		default:
+			text, n, err := escape(rest)
+			if err != nil {
+				return nil, err
+			}
+
+			if n == 0 {
+				text = "%"
+			}
+
+			literal.WriteString(text)
+			i += n
+		}
+	}
+
+	f.literals = append(f.literals, literal.String())
+
+	return f, nil
+}
+
+// hexEscape decodes the %<hex> escapes of for-each-ref, a byte given by
+// two hexadecimal digits.
+func hexEscape(s string) (string, int, error) {
+	if len(s) < 2 || !isHexByte(s[:2]) {
+		return "", 0, nil
+	}
+
+	b, _ := hex.DecodeString(s[:2])
+
+	return string(b), 2, nil
+}
+
+func isHexByte(s string) bool {
+	_, err := hex.DecodeString(s)
+
+	return err == nil
+}
+
+// expand formats a line, using field to look up the value of each atom.
+func (f *atomFormat) expand(field func(atom string) (string, error)) (string, error) {
+	var sb strings.Builder
+
+	for i, atom := range f.atoms {
+		sb.WriteString(f.literals[i])
+
+		if strings.HasPrefix(atom, "color") {
+			continue
+		}
+
+		value, err := field(atom)
+		if err != nil {
+			return "", err
+		}
+
+		sb.WriteString(value)
+	}
+
+	sb.WriteString(f.literals[len(f.literals)-1])
+
+	return sb.String(), nil
+}
+
+// sortRefInfos sorts infos by keys, the last key being the primary one,
+// and then by reference name.
+func sortRefInfos(infos []*refInfo, keys []string) error {
+	type sortKey struct {
+		field   string
+		reverse bool
+		version bool
+	}
+
+	var parsed []sortKey
+
+	for i := len(keys) - 1; i >= 0; i-- {
+		k := sortKey{field: keys[i]}
+
+		if strings.HasPrefix(k.field, "-") {
+			k.field, k.reverse = k.field[1:], true
+		}
+
+		if v, ok := strings.CutPrefix(k.field, "version:"); ok {
+			k.field, k.version = v, true
+		} else if v, ok := strings.CutPrefix(k.field, "v:"); ok {
+			k.field, k.version = v, true
+		}
+
+		// Check the key once so that sorting cannot fail.
+		if len(infos) > 0 {
+			if _, err := infos[0].field(k.field); err != nil {
+				return err
+			}
+		}
+
+		parsed = append(parsed, k)
+	}
+
+	compare := func(a, b *refInfo, k sortKey) int {
+		field, _, _ := strings.Cut(k.field, ":")
+		numeric := strings.HasSuffix(field, "date") || strings.TrimPrefix(field, "*") == "objectsize"
+
+		// Dates are compared by their timestamps.
+		if strings.HasSuffix(field, "date") {
+			field += ":unix"
+		} else {
+			field = k.field
+		}
+
+		va, _ := a.field(field)
+		vb, _ := b.field(field)
+
+		switch {
+		case k.version:
+			return compareVersions(va, vb)
+		case numeric:
+			na, _ := strconv.ParseInt(va, 10, 64)
+			nb, _ := strconv.ParseInt(vb, 10, 64)
+
+			switch {
+			case na < nb:
+				return -1
+			case na > nb:
+				return 1
+			}
+
+			return 0
+		default:
+			return strings.Compare(va, vb)
+		}
+	}
+
+	sort.SliceStable(infos, func(i, j int) bool {
+		for _, k := range parsed {
+			c := compare(infos[i], infos[j], k)
+			if k.reverse {
+				c = -c
+			}
+
+			if c != 0 {
+				return c < 0
+			}
+		}
+
+		return infos[i].ref.Name() < infos[j].ref.Name()
+	})
+
+	return nil
+}
+
+// compareVersions compares a and b treating runs of digits as numbers.
+func compareVersions(a, b string) int {
+	for a != "" && b != "" {
+		ra, rb := leadingRun(a), leadingRun(b)
+		a, b = a[len(ra):], b[len(rb):]
+
+		na, errA := strconv.ParseUint(ra, 10, 64)
+		nb, errB := strconv.ParseUint(rb, 10, 64)
+
+		switch {
+		case errA == nil && errB == nil && na != nb:
+			if na < nb {
+				return -1
+			}
+
+			return 1
+		case (errA != nil || errB != nil) && ra != rb:
+			return strings.Compare(ra, rb)
+		}
+	}
+
+	return strings.Compare(a, b)
+}
+
+// leadingRun returns the leading run of digits or non-digits of s.
+func leadingRun(s string) string {
+	digit := func(c byte) bool { return c >= '0' && c <= '9' }
+
+	i := 1
+	for i < len(s) && digit(s[i]) == digit(s[0]) {
+		i++
+	}
+
+	return s[:i]
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// refsRepo returns a repository made by git with a merged and an unmerged
+// branch, and an annotated and a lightweight tag.
+func refsRepo(t *testing.T) string {
+	t.Helper()
+
+	dir := gitRepo(t, []string{"a", "1"})
+	gitCmd(t, dir, "tag", "-a", "-m", "v1", "v1")
+	gitCmd(t, dir, "branch", "merged")
+	gitCmd(t, dir, "checkout", "-q", "-b", "topic")
+	writeFile(t, dir, "a", "2")
+	gitCmd(t, dir, "commit", "-q", "-a", "-m", "topic")
+	gitCmd(t, dir, "tag", "light")
+	gitCmd(t, dir, "checkout", "-q", "main")
+	writeFile(t, dir, "b", "3")
+	gitCmd(t, dir, "add", "b")
+	gitCmd(t, dir, "commit", "-q", "-m", "main")
+
+	return dir
+}
+
+// splitArgs splits args on spaces, but for a trailing --format.
+func splitArgs(args string) []string {
+	args, format, ok := strings.Cut(args, "--format=")
+
+	fields := strings.Fields(args)
+	if ok {
+		fields = append(fields, "--format="+format)
+	}
+
+	return fields
+}
+
+func TestForEachRef(t *testing.T) {
+	dir := refsRepo(t)
+
+	for _, args := range []string{
+		"",
+		"refs/tags",
+		"refs/heads/m*",
+		"--contains main~1",
+		"--contains=main~1",
+		"--contains HEAD~1 refs/tags",
+		"--no-contains topic",
+		"--merged main",
+		"--no-merged main refs/heads",
+		"--points-at main~1",
+		"--count=2 --sort=objectname",
+		"--sort=-refname --format=%(refname:short)%09%(objecttype)%09%(*objectname)%(subject)",
+		"--sort=-creatordate --format=%(creatordate) %(refname:lstrip=1)",
+		"--format=%(refname:rstrip=-1) %(HEAD) %(authorname) %(committerdate:unix) %(objectsize)",
+		"--format=%(*objectname)%00%(refname)%09%%x",
+	} {
+		t.Run(args, func(t *testing.T) {
+			sameOutput(t, dir, append([]string{"for-each-ref"}, splitArgs(args)...)...)
+		})
+	}
+}
+
+func TestForEachRefBadCommit(t *testing.T) {
+	dir := refsRepo(t)
+
+	res := gogit(t, dir, "for-each-ref", "--contains", "nope")
+	if res.code == 0 {
+		t.Errorf("for-each-ref --contains nope succeeded:\n%s", res.stdout)
+	}
+}
@@ -0,0 +1,534 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/spf13/cobra"
+)
+
+var (
+	formatPatchOutputDir   string
+	formatPatchCoverLetter bool
+	formatPatchNumbered    bool
+	formatPatchStdout      bool
+)
+
+const (
+	// mailWrap is the width git wraps the text of patch mails at.
+	mailWrap = 72
+
+	// mailHeaderWrap is the width headers are folded at.
+	mailHeaderWrap = 78
+
+	// patchNameMax is the longest name of a patch file.
+	patchNameMax = 64
+
+	// mailSignature ends each patch mail.
+	mailSignature = "gogit"
+)
+
+func init() {
+	formatPatchCmd.Flags().StringVarP(&formatPatchOutputDir, "output-directory", "o", "", "Write the patch files to the directory")
+	formatPatchCmd.Flags().BoolVarP(&formatPatchCoverLetter, "cover-letter", "", false, "Also write a cover letter describing the series")
+	formatPatchCmd.Flags().BoolVarP(&formatPatchNumbered, "numbered", "n", false, "Number the patches even when there is only one")
+	formatPatchCmd.Flags().BoolVarP(&formatPatchStdout, "stdout", "", false, "Print the patches as an mbox instead of writing files")
+	rootCmd.AddCommand(formatPatchCmd)
+}
+
+var formatPatchCmd = &cobra.Command{
+	Use:   "format-patch [-o <dir>] [--cover-letter] [-n] [--stdout] (<since> | <revision-range>...)",
+	Short: "Prepare each commit of a range as a patch mail",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		w := &revWalk{r: r}
+
+		// A single revision names where the series starts from, up to
+		// HEAD.
+		if len(args) == 1 && !strings.Contains(args[0], "..") && !strings.HasPrefix(args[0], "^") {
+			args = []string{args[0] + ".."}
+		}
+
+		for _, arg := range args {
+			err = w.addArg(arg)
+			if err != nil {
+				return err
+			}
+		}
+
+		listed, boundary, err := w.walk()
+		if err != nil {
+			return err
+		}
+
+		var commits []*object.Commit
+
+		for i := len(listed) - 1; i >= 0; i-- {
+			if listed[i].NumParents() <= 1 {
+				commits = append(commits, listed[i])
+			}
+		}
+
+		if len(commits) == 0 {
+			return nil
+		}
+
+		f := &patchFormatter{
+			r:        r,
+			total:    len(commits),
+			numbered: formatPatchNumbered || len(commits) > 1 || formatPatchCoverLetter,
+		}
+
+		out := cmd.OutOrStdout()
+
+		write := func(nr int, subject string, format func(io.Writer) error) error {
+			if formatPatchStdout {
+				return format(out)
+			}
+
+			name := filepath.Join(formatPatchOutputDir, patchFileName(nr, subject))
+
+			var buf bytes.Buffer
+
+			err := format(&buf)
+			if err != nil {
+				return err
+			}
+
+			err = os.WriteFile(name, buf.Bytes(), 0o644)
+			if err != nil {
+				return fmt.Errorf("failed to write %s: %w", name, err)
+			}
+
+			fmt.Fprintln(out, name)
+
+			return nil
+		}
+
+		if !formatPatchStdout && formatPatchOutputDir != "" {
+			err = os.MkdirAll(formatPatchOutputDir, 0o755)
+			if err != nil {
+				return fmt.Errorf("could not create directory '%s': %w", formatPatchOutputDir, err)
+			}
+		}
+
+		if formatPatchCoverLetter {
+			// Like git, the cover letter only has a diffstat when the
+			// series starts from a single commit.
+			var origin *object.Commit
+			if len(boundary) == 1 {
+				origin = boundary[0]
+			}
+
+			err = write(0, "", func(w io.Writer) error {
+				return f.writeCoverLetter(w, commits, origin)
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		for i, c := range commits {
+			subject, _ := splitMessage(c.Message)
+
+			// Like git log, the patches of an mbox are separated by a
+			// blank line, which the cover letter goes without.
+			if formatPatchStdout && i > 0 {
+				fmt.Fprintln(out)
+			}
+
+			err = write(i+1, subject, func(w io.Writer) error {
+				return f.writePatchMail(w, c, i+1)
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// patchFormatter writes the commits of a series as patch mails.
+type patchFormatter struct {
+	r        *git.Repository
+	total    int
+	numbered bool
+}
+
+// writePatchMail writes c as the patch mail nr of the series.
+func (f *patchFormatter) writePatchMail(out io.Writer, c *object.Commit, nr int) error {
+	var from *object.Commit
+
+	if c.NumParents() > 0 {
+		p, err := c.Parent(0)
+		if err != nil {
+			return err
+		}
+
+		from = p
+	}
+
+	diffs, err := commitDiffs(f.r, from, c)
+	if err != nil {
+		return err
+	}
+
+	subject, body := splitMessage(c.Message)
+
+	fmt.Fprintf(out, "From %s Mon Sep 17 00:00:00 2001\n", c.Hash)
+	writeMailHeaders(out, c.Author, f.subjectPrefix(nr), subject, hasNonASCII(c.Message))
+	fmt.Fprintln(out)
+
+	if body != "" {
+		fmt.Fprint(out, strings.TrimRight(body, "\n")+"\n")
+	}
+
+	fmt.Fprintln(out, "---")
+	writeDiffstat(out, diffs, mailWrap, true)
+	fmt.Fprintln(out)
+
+	err = writePatch(out, f.r, diffs)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "-- \n%s\n\n", mailSignature)
+
+	return nil
+}
+
+// writeCoverLetter writes the mail introducing the series, with its
+// shortlog and, when it starts from origin, its diffstat.
+func (f *patchFormatter) writeCoverLetter(out io.Writer, commits []*object.Commit, origin *object.Commit) error {
+	last := commits[len(commits)-1]
+
+	nonASCII := false
+
+	for _, c := range commits {
+		if hasNonASCII(c.Author.Name) || hasNonASCII(c.Committer.Name) || hasNonASCII(c.Message) {
+			nonASCII = true
+		}
+	}
+
+	fmt.Fprintf(out, "From %s Mon Sep 17 00:00:00 2001\n", last.Hash)
+	writeMailHeaders(out, signature(f.r, committerRole), f.subjectPrefix(0), "*** SUBJECT HERE ***", nonASCII)
+	fmt.Fprint(out, "\n*** BLURB HERE ***\n\n")
+
+	writeShortlog(out, commits)
+
+	if origin != nil {
+		diffs, err := commitDiffs(f.r, origin, last)
+		if err != nil {
+			return err
+		}
+
+		writeDiffstat(out, diffs, mailWrap, true)
+		fmt.Fprintln(out)
+	}
+
+	fmt.Fprintf(out, "-- \n%s\n\n", mailSignature)
+
+	return nil
+}
+
+// subjectPrefix returns the [PATCH] prefix of the subject of patch nr.
+func (f *patchFormatter) subjectPrefix(nr int) string {
+	if !f.numbered {
+		return "[PATCH] "
+	}
+
+	width := len(fmt.Sprint(f.total))
+
+	return fmt.Sprintf("[PATCH %0*d/%d] ", width, nr, f.total)
+}
+
+// commitDiffs returns the changes c makes to the tree of from, which is the
+// empty tree when from is nil.
+func commitDiffs(r *git.Repository, from, c *object.Commit) ([]*fileDiff, error) {
+	var tree plumbing.Hash
+	if from != nil {
+		tree = from.TreeHash
+	}
+
+	changes, err := diffTrees(r, tree, c.TreeHash, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return fileDiffs(r, changes)
+}
+
+// writeShortlog writes the subjects of commits grouped by author, the way
+// git shortlog does in a cover letter.
+func writeShortlog(out io.Writer, commits []*object.Commit) {
+	subjects := make(map[string][]string)
+
+	var authors []string
+
+	for _, c := range commits {
+		if _, ok := subjects[c.Author.Name]; !ok {
+			authors = append(authors, c.Author.Name)
+		}
+
+		subject, _ := splitMessage(c.Message)
+		subjects[c.Author.Name] = append(subjects[c.Author.Name], subject)
+	}
+
+	sort.Strings(authors)
+
+	for _, a := range authors {
+		fmt.Fprintf(out, "%s (%d):\n", a, len(subjects[a]))
+
+		for _, s := range subjects[a] {
+			fmt.Fprintln(out, wrapText(s, 2, 4, mailWrap))
+		}
+
+		fmt.Fprintln(out)
+	}
+}
+
+// writeMailHeaders writes the From, Date and Subject headers of a mail
+// sent by sig, encoding and folding them the way git does.
+func writeMailHeaders(out io.Writer, sig object.Signature, prefix, subject string, nonASCII bool) {
+	var sb strings.Builder
+
+	sb.WriteString("From: ")
+
+	width := mailHeaderWrap
+
+	switch {
+	case needsRFC2047(sig.Name):
+		sb.WriteString(encodeRFC2047(sig.Name, len("From: "), true))
+
+		width = 76
+	case strings.ContainsAny(sig.Name, "()<>[]:;@,.\"\\"):
+		quoted := `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(sig.Name) + `"`
+		sb.WriteString(wrapText(quoted, -len("From: "), 1, width))
+	default:
+		sb.WriteString(wrapText(sig.Name, -len("From: "), 1, width))
+	}
+
+	if width < lastLineLength(sb.String())+len(" <")+len(sig.Email)+len(">") {
+		sb.WriteByte('\n')
+	}
+
+	fmt.Fprintf(&sb, " <%s>\n", sig.Email)
+	fmt.Fprint(out, sb.String())
+	fmt.Fprintf(out, "Date: %s\n", sig.When.Format(rfc2822DateFormat))
+
+	header := "Subject: " + prefix
+	if needsRFC2047(subject) {
+		header += encodeRFC2047(subject, len(header), false)
+	} else {
+		header += wrapText(subject, -len(header), 1, mailHeaderWrap)
+	}
+
+	fmt.Fprintln(out, header)
+
+	if nonASCII {
+		fmt.Fprint(out, "MIME-Version: 1.0\nContent-Type: text/plain; charset=UTF-8\nContent-Transfer-Encoding: 8bit\n")
+	}
+}
+
+func lastLineLength(s string) int {
+	return len(s) - strings.LastIndexByte(s, '\n') - 1
+}
+
+func hasNonASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// needsRFC2047 reports whether s has to be encoded to be used in a header.
+func needsRFC2047(s string) bool {
+	return hasNonASCII(s) || strings.Contains(s, "=?")
+}
+
+// encodeRFC2047 encodes s as UTF-8 quoted printable words, starting at
+// column col and splitting them to keep the lines of the header short.
+// Addresses escape more characters than other headers.
+func encodeRFC2047(s string, col int, address bool) string {
+	const maxEncoded = 76
+
+	var sb strings.Builder
+
+	sb.WriteString("=?UTF-8?q?")
+	col += len("=?UTF-8?q?")
+
+	for len(s) > 0 {
+		_, n := utf8.DecodeRuneInString(s)
+		ch := s[:n]
+		s = s[n:]
+
+		special := n > 1 || rfc2047Special(ch[0], address)
+
+		encoded := ch
+		if special {
+			encoded = ""
+			for i := 0; i < len(ch); i++ {
+				encoded += fmt.Sprintf("=%02X", ch[i])
+			}
+		}
+
+		if col+len(encoded)+2 > maxEncoded {
+			sb.WriteString("?=\n =?UTF-8?q?")
+			col = len("=?UTF-8?q?") + 1
+		}
+
+		sb.WriteString(encoded)
+		col += len(encoded)
+	}
+
+	sb.WriteString("?=")
+
+	return sb.String()
+}
+
+func rfc2047Special(c byte, address bool) bool {
+	if c >= 0x80 || c < 0x20 || c == 0x7f || c == ' ' || c == '=' || c == '?' || c == '_' {
+		return true
+	}
+
+	if !address {
+		return false
+	}
+
+	isAlnum := 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+
+	return !(isAlnum || strings.IndexByte("!*+-/", c) >= 0)
+}
+
+// wrapText wraps text at width the way git does, indenting the first line
+// by indent1 and the others by indent2. A negative indent1 is the length
+// of what the line already holds.
+func wrapText(text string, indent1, indent2, width int) string {
+	var sb strings.Builder
+
+	bol, pos, space := 0, 0, -1
+	w, indent := indent1, indent1
+
+	if indent < 0 {
+		w, space = -indent, 0
+	}
+
+	for {
+		var c byte
+		if pos < len(text) {
+			c = text[pos]
+		}
+
+		if c != 0 && c != ' ' && c != '\t' && c != '\n' {
+			_, n := utf8.DecodeRuneInString(text[pos:])
+			pos += n
+			w++
+
+			continue
+		}
+
+		if w <= width || space < 0 {
+			start := bol
+			if c == 0 && pos == start {
+				return sb.String()
+			}
+
+			if space >= 0 {
+				start = space
+			} else {
+				sb.WriteString(strings.Repeat(" ", max(indent, 0)))
+			}
+
+			sb.WriteString(text[start:pos])
+
+			if c == 0 {
+				return sb.String()
+			}
+
+			space = pos
+
+			if c == '\t' {
+				w |= 0x07
+			}
+
+			w++
+			pos++
+
+			continue
+		}
+
+		sb.WriteByte('\n')
+
+		pos = space
+		if text[pos] == ' ' || text[pos] == '\t' || text[pos] == '\n' {
+			pos++
+		}
+
+		bol = pos
+		space = -1
+		w, indent = indent2, indent2
+	}
+}
+
+// patchFileName returns the name of the file patch nr with the given
+// subject is written to.
+func patchFileName(nr int, subject string) string {
+	if nr == 0 {
+		return "0000-cover-letter.patch"
+	}
+
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "%04d-", nr)
+
+	prefix := sb.Len()
+	space := 2
+
+	for i := 0; i < len(subject); i++ {
+		c := subject[i]
+
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '.' || c == '_') {
+			space |= 1
+
+			continue
+		}
+
+		if space == 1 {
+			sb.WriteByte('-')
+		}
+
+		space = 0
+
+		sb.WriteByte(c)
+
+		for c == '.' && i+1 < len(subject) && subject[i+1] == '.' {
+			i++
+		}
+	}
+
+	name := sb.String()
+	for len(name) > prefix && (name[len(name)-1] == '.' || name[len(name)-1] == '-') {
+		name = name[:len(name)-1]
+	}
+
+	return name[:min(len(name), patchNameMax-len(".patch")-1)] + ".patch"
+}
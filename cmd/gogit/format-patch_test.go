@@ -0,0 +1,185 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// patchRepo returns a repository made by git whose topic branch changes,
+// adds, removes, renames and makes executable files, binary and text, with messages of
+// several paragraphs.
+func patchRepo(t *testing.T) string {
+	t.Helper()
+
+	dir := gitRepo(t, []string{
+		"a", "one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\n",
+		"b", "bee\n",
+		"old", strings.Repeat("a line to keep the rename\n", 10),
+		"run.sh", "#!/bin/sh\n",
+		"d/gone", "bye\n",
+		"bin", "\x00\x01\x02binary\n",
+	})
+
+	gitCmd(t, dir, "checkout", "-q", "-b", "topic")
+
+	writeFile(t, dir, "a", "one\ntwo\nTHREE\nfour\nfive\nsix\nseven\neight\nNINE\nten\n")
+	gitCmd(t, dir, "commit", "-q", "-a", "-m", "Change a\n\nThe third and ninth lines are louder.\n\nSigned-off-by: A U Thor <author@example.com>")
+
+	writeFile(t, dir, "new", "no newline")
+	writeFile(t, dir, "bin", "\x00\x01\x02changed binary\n")
+	gitCmd(t, dir, "rm", "-q", "d/gone")
+	gitCmd(t, dir, "add", "new", "bin")
+	gitCmd(t, dir, "commit", "-q", "-m", "Add a file and remove another")
+
+	gitCmd(t, dir, "mv", "old", "renamed")
+	writeFile(t, dir, "renamed", strings.Repeat("a line to keep the rename\n", 10)+"and one more\n")
+
+	err := os.Chmod(filepath.Join(dir, "run.sh"), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gitCmd(t, dir, "add", "-A")
+	gitCmd(t, dir, "commit", "-q", "-m", "Rénäme a file and make run.sh executable")
+
+	return dir
+}
+
+// binaryData matches the encoded data of the hunks of a binary patch.
+var binaryData = regexp.MustCompile(`(?m)^((?:literal|delta) \d+\n)(?:[A-Za-z]\S*\n)+`)
+
+// comparableMails returns patch mails with the signature of gogit in place
+// of the version of git, and without the data of binary hunks: zlib does
+// not deflate as Go does, which git am checks by applying them.
+func comparableMails(t *testing.T, mails string) string {
+	t.Helper()
+
+	version := strings.TrimPrefix(strings.TrimSpace(gitCmd(t, "", "version")), "git version ")
+	mails = strings.ReplaceAll(mails, "\n-- \n"+version+"\n", "\n-- \n"+mailSignature+"\n")
+
+	return binaryData.ReplaceAllString(mails, "$1")
+}
+
+func TestFormatPatch(t *testing.T) {
+	dir := patchRepo(t)
+
+	for _, args := range []string{
+		"--stdout main..topic",
+		"--stdout -n topic~1..topic",
+		"--stdout topic~1..topic",
+		"--stdout main",
+		"--stdout --cover-letter main..topic",
+	} {
+		t.Run(args, func(t *testing.T) {
+			a := append([]string{"format-patch"}, strings.Fields(args)...)
+
+			want := comparableMails(t, gitCmd(t, dir, a...))
+			if got := comparableMails(t, mustGogit(t, dir, a...)); got != want {
+				t.Errorf("gogit %v:\n%s\nwant, as git:\n%s", a, got, want)
+			}
+		})
+	}
+}
+
+// TestFormatPatchFiles checks that the patch files are named and written
+// as git names and writes them.
+func TestFormatPatchFiles(t *testing.T) {
+	dir := patchRepo(t)
+
+	var outputs []string
+
+	for _, tool := range []string{"git", "gogit"} {
+		out := filepath.Join(t.TempDir(), "patches")
+		args := []string{"format-patch", "--cover-letter", "-o", out, "main..topic"}
+
+		var listed string
+		if tool == "git" {
+			listed = gitCmd(t, dir, args...)
+		} else {
+			listed = mustGogit(t, dir, args...)
+		}
+
+		listed = strings.ReplaceAll(listed, out, "OUT")
+
+		entries, err := os.ReadDir(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, e := range entries {
+			listed += e.Name() + "\n" + comparableMails(t, readFile(t, filepath.Join(out, e.Name())))
+		}
+
+		outputs = append(outputs, listed)
+	}
+
+	if outputs[1] != outputs[0] {
+		t.Errorf("gogit format-patch wrote:\n%s\nwant, as git:\n%s", outputs[1], outputs[0])
+	}
+}
+
+// TestFormatPatchGitAm checks that git am makes the commits of the series
+// again from the patches of gogit.
+func TestFormatPatchGitAm(t *testing.T) {
+	dir := patchRepo(t)
+
+	mbox := mustGogit(t, dir, "format-patch", "--stdout", "main..topic")
+
+	gitCmd(t, dir, "checkout", "-q", "-b", "applied", "main")
+	gitCmdStdin(t, dir, mbox, "am", "-q")
+
+	if got, want := gitCmd(t, dir, "rev-parse", "applied"), gitCmd(t, dir, "rev-parse", "topic"); got != want {
+		t.Errorf("git am of the gogit patches made %s, want %s", got, want)
+	}
+}
+
+// TestFormatPatchRenames checks that renamed files are found and shown as
+// git shows them: exact and inexact renames, of empty files, links and
+// files moved between directories.
+func TestFormatPatchRenames(t *testing.T) {
+	var lines strings.Builder
+	for i := 100; i <= 130; i++ {
+		lines.WriteString(strings.Repeat("x", i%7) + "\n")
+	}
+
+	dir := gitRepo(t, []string{
+		"empty", "",
+		"big", lines.String(),
+		"src/x/f", "moved\n",
+		"src/x/g", "also moved but changed a lot\n",
+		"keep/same", "a\nb\nc\nd\n",
+	})
+
+	err := os.Symlink("big", filepath.Join(dir, "l"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gitCmd(t, dir, "add", "l")
+	gitCmd(t, dir, "commit", "-q", "-m", "link")
+
+	for _, mv := range [][]string{{"empty", "empty2"}, {"l", "l2"}, {"big", "big2"}, {"src/x", "src/y"}, {"keep", "kept"}} {
+		gitCmd(t, dir, "mv", mv[0], mv[1])
+	}
+
+	writeFile(t, dir, "big2", lines.String()+"extra\n")
+	writeFile(t, dir, "src/y/g", "changed\n")
+
+	err = os.Chmod(filepath.Join(dir, "big2"), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gitCmd(t, dir, "add", "-A")
+	gitCmd(t, dir, "commit", "-q", "-m", "move")
+
+	args := []string{"format-patch", "--stdout", "HEAD~1"}
+
+	want := comparableMails(t, gitCmd(t, dir, args...))
+	if got := comparableMails(t, mustGogit(t, dir, args...)); got != want {
+		t.Errorf("gogit %v:\n%s\nwant, as git:\n%s", args, got, want)
+	}
+}
@@ -0,0 +1,1040 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	formatcfg "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/format/idxfile"
+	"github.com/go-git/go-git/v6/plumbing/hash"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/spf13/cobra"
+)
+
+// The bits of fsck's exit status, as in git.
+const (
+	fsckErrorObject    = 1
+	fsckErrorReachable = 2
+	fsckErrorRefs      = 8
+)
+
+var (
+	fsckFull             bool
+	fsckConnectivityOnly bool
+	fsckUnreachable      bool
+	fsckDangling         bool
+	fsckNoDangling       bool
+	fsckLostFound        bool
+	fsckStrict           bool
+)
+
+func init() {
+	fsckCmd.Flags().BoolVarP(&fsckFull, "full", "", true, "Also check the objects in packs")
+	fsckCmd.Flags().BoolVarP(&fsckConnectivityOnly, "connectivity-only", "", false, "Only check that the objects reachable are present")
+	fsckCmd.Flags().BoolVarP(&fsckUnreachable, "unreachable", "", false, "Print the objects that exist but are not reachable")
+	fsckCmd.Flags().BoolVarP(&fsckDangling, "dangling", "", true, "Print the objects that exist but are not referenced")
+	fsckCmd.Flags().BoolVarP(&fsckNoDangling, "no-dangling", "", false, "Do not print the objects that are not referenced")
+	fsckCmd.Flags().BoolVarP(&fsckLostFound, "lost-found", "", false, "Write dangling objects into .git/lost-found")
+	fsckCmd.Flags().BoolVarP(&fsckStrict, "strict", "", false, "Treat warnings as errors and check file modes strictly")
+	rootCmd.AddCommand(fsckCmd)
+}
+
+var fsckCmd = &cobra.Command{
+	Use:   "fsck [--full] [--connectivity-only] [--unreachable] [--[no-]dangling] [--lost-found] [--strict]",
+	Short: "Verify the connectivity and validity of the objects in the repository",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		store, ok := r.Storer.(*filesystem.Storage)
+		if !ok {
+			return errors.New("storer does not implement filesystem.Storage")
+		}
+
+		of, err := packObjectFormat(r, "")
+		if err != nil {
+			return err
+		}
+
+		c := &fsckChecker{
+			r:       r,
+			store:   store,
+			of:      of,
+			out:     cmd.OutOrStdout(),
+			errOut:  cmd.ErrOrStderr(),
+			objects: make(map[plumbing.Hash]*fsckObject),
+		}
+
+		err = c.run()
+		if err != nil {
+			return err
+		}
+
+		if c.status != 0 {
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+
+			return exitStatus(c.status)
+		}
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// fsckLink is a reference from an object to another one of type typ.
+type fsckLink struct {
+	hash plumbing.Hash
+	typ  plumbing.ObjectType
+}
+
+type fsckObject struct {
+	typ       plumbing.ObjectType
+	pack      plumbing.Hash
+	present   bool
+	reachable bool
+	used      bool
+	links     []fsckLink
+}
+
+// fsckChecker checks the objects of a repository, and that the objects
+// reachable from its references, reflogs and index are all present.
+type fsckChecker struct {
+	r      *git.Repository
+	store  *filesystem.Storage
+	of     formatcfg.ObjectFormat
+	out    io.Writer
+	errOut io.Writer
+
+	objects map[plumbing.Hash]*fsckObject
+	status  int
+}
+
+func (c *fsckChecker) run() error {
+	loose, packed, err := c.listObjects()
+	if err != nil {
+		return err
+	}
+
+	for _, h := range append(loose, packed...) {
+		c.checkObject(h)
+	}
+
+	c.checkLinks()
+
+	roots, err := c.roots()
+	if err != nil {
+		return err
+	}
+
+	c.markReachable(roots)
+
+	return c.reportUnreachable()
+}
+
+// object returns the entry of h, creating it if needed.
+func (c *fsckChecker) object(h plumbing.Hash) *fsckObject {
+	o, ok := c.objects[h]
+	if !ok {
+		o = &fsckObject{}
+		c.objects[h] = o
+	}
+
+	return o
+}
+
+// listObjects returns the sorted loose objects and the packed objects,
+// the latter pack by pack.
+func (c *fsckChecker) listObjects() ([]plumbing.Hash, []plumbing.Hash, error) {
+	var loose, packed []plumbing.Hash
+
+	err := c.store.ForEachObjectHash(func(h plumbing.Hash) error {
+		c.object(h).present = true
+		loose = append(loose, h)
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list loose objects: %w", err)
+	}
+
+	plumbing.HashesSort(loose)
+
+	indexes, err := readPackIndexes(c.store, c.of)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, p := range sortedPacks(indexes) {
+		hashes, err := indexHashes(indexes[p])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, h := range hashes {
+			o := c.object(h)
+			if o.present {
+				continue
+			}
+
+			o.present = true
+			o.pack = p
+
+			if fsckFull {
+				packed = append(packed, h)
+			}
+		}
+	}
+
+	return loose, packed, nil
+}
+
+// checkObject reads the object h, checks that it hashes to h and is well
+// formed, and records the objects it links to.
+func (c *fsckChecker) checkObject(h plumbing.Hash) {
+	o := c.objects[h]
+
+	obj, err := c.r.Storer.EncodedObject(plumbing.AnyObject, h)
+	if err == nil {
+		o.typ = obj.Type()
+	}
+
+	var data []byte
+
+	if err == nil && (!fsckConnectivityOnly || o.typ != plumbing.BlobObject) {
+		data, err = readObjectData(obj)
+	}
+
+	if err != nil {
+		fmt.Fprintf(c.errOut, "error: %s: object corrupt or missing\n", h)
+		c.status |= fsckErrorObject
+
+		return
+	}
+
+	if !fsckConnectivityOnly {
+		hasher := plumbing.NewHasher(c.of, o.typ, int64(len(data)))
+		hasher.Write(data)
+
+		if actual := hasher.Sum(); !actual.Equal(h) {
+			if o.pack.IsZero() {
+				fmt.Fprintf(c.errOut, "error: hash mismatch for %s (got %s)\n", h, actual)
+			} else {
+				fmt.Fprintf(c.errOut, "error: packed %s from pack-%s.pack is corrupt\n", h, o.pack)
+			}
+
+			c.status |= fsckErrorObject
+
+			return
+		}
+
+		p := &fsckParser{strict: fsckStrict, hexSize: h.HexSize(), hashSize: h.Size()}
+		p.check(o.typ, data)
+
+		for _, problem := range p.problems {
+			c.report(o.typ, h, problem)
+		}
+	}
+
+	o.links = objectLinks(c.r, obj)
+}
+
+// readObjectData returns the contents of obj.
+func readObjectData(obj plumbing.EncodedObject) ([]byte, error) {
+	rd, err := obj.Reader()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(rd)
+	if cerr := rd.Close(); err == nil {
+		err = cerr
+	}
+
+	return data, err
+}
+
+func (c *fsckChecker) report(typ plumbing.ObjectType, h plumbing.Hash, p fsckProblem) {
+	level := "warning"
+	if p.severity == fsckError {
+		level = "error"
+		c.status |= fsckErrorObject
+	}
+
+	fmt.Fprintf(c.errOut, "%s in %s %s: %s: %s\n", level, typ, h, p.id, p.message)
+}
+
+// objectLinks returns the objects obj refers to, as decoded by go-git.
+func objectLinks(r *git.Repository, obj plumbing.EncodedObject) []fsckLink {
+	var links []fsckLink
+
+	switch obj.Type() {
+	case plumbing.CommitObject:
+		commit, err := object.DecodeCommit(r.Storer, obj)
+		if err != nil {
+			return nil
+		}
+
+		links = append(links, fsckLink{commit.TreeHash, plumbing.TreeObject})
+		for _, p := range commit.ParentHashes {
+			links = append(links, fsckLink{p, plumbing.CommitObject})
+		}
+	case plumbing.TreeObject:
+		tree, err := object.DecodeTree(r.Storer, obj)
+		if err != nil {
+			return nil
+		}
+
+		for _, e := range tree.Entries {
+			switch e.Mode {
+			case filemode.Submodule:
+			case filemode.Dir:
+				links = append(links, fsckLink{e.Hash, plumbing.TreeObject})
+			default:
+				links = append(links, fsckLink{e.Hash, plumbing.BlobObject})
+			}
+		}
+	case plumbing.TagObject:
+		tag, err := object.DecodeTag(r.Storer, obj)
+		if err != nil {
+			return nil
+		}
+
+		links = append(links, fsckLink{tag.Target, tag.TargetType})
+	}
+
+	return links
+}
+
+// checkLinks marks the objects linked to as used, and reports the links to
+// objects of another type than expected.
+func (c *fsckChecker) checkLinks() {
+	for _, h := range c.sortedObjects() {
+		o := c.objects[h]
+		broken := false
+
+		for _, l := range o.links {
+			target := c.object(l.hash)
+			target.used = true
+
+			if !target.present {
+				target.typ = l.typ
+
+				continue
+			}
+
+			if target.typ != l.typ && !fsckConnectivityOnly && !broken {
+				fmt.Fprintf(c.errOut, "error: object %s is a %s, not a %s\n", l.hash, target.typ, l.typ)
+				fmt.Fprintf(c.errOut, "error in %s %s: broken links\n", o.typ, h)
+				c.status |= fsckErrorObject
+				broken = true
+			}
+		}
+	}
+}
+
+// roots returns the objects named by the references, the reflogs, and the
+// HEADs and indexes of the main and linked worktrees, reporting the names
+// of missing objects. They are the roots reachableObjects walks from.
+func (c *fsckChecker) roots() ([]plumbing.Hash, error) {
+	var roots []plumbing.Hash
+
+	refs, err := sortedReferences(c.r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(refs) == 0 {
+		fmt.Fprintln(c.errOut, "notice: No default references")
+	}
+
+	for _, ref := range refs {
+		if h, ok := c.checkRef(ref.Name().String(), ref.Hash()); ok {
+			if o := c.objects[h]; o.typ != plumbing.CommitObject && ref.Name().IsBranch() {
+				fmt.Fprintf(c.errOut, "error: %s: not a commit\n", ref.Name())
+				c.status |= fsckErrorRefs
+			}
+
+			roots = append(roots, h)
+		}
+	}
+
+	wts, err := linkedWorktrees(c.r)
+	if err != nil {
+		return nil, err
+	}
+
+	heads, err := c.headRoot(plumbing.HEAD.String(), c.r)
+	if err != nil {
+		return nil, err
+	}
+
+	roots = append(roots, heads...)
+
+	for _, wt := range wts {
+		heads, err := c.headRoot(wt.refName(plumbing.HEAD), wt.r)
+		if err != nil {
+			return nil, err
+		}
+
+		roots = append(roots, heads...)
+	}
+
+	// Like git, reflogs do not keep objects from being written to
+	// lost-found.
+	if !fsckLostFound {
+		logs, err := c.reflogRoots(wts)
+		if err != nil {
+			return nil, err
+		}
+
+		roots = append(roots, logs...)
+	}
+
+	indexes, err := allIndexes(c.r, wts)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, idx := range indexes {
+		for _, e := range idx.Entries {
+			if e.Mode != filemode.Submodule {
+				c.object(e.Hash).typ = plumbing.BlobObject
+				roots = append(roots, e.Hash)
+			}
+		}
+	}
+
+	return roots, nil
+}
+
+// headRoot returns the object HEAD of r names, reported as name, unless
+// it points to an unborn branch.
+func (c *fsckChecker) headRoot(name string, r *git.Repository) ([]plumbing.Hash, error) {
+	head, err := r.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	if head.Type() == plumbing.SymbolicReference {
+		if _, err := r.Storer.Reference(head.Target()); err != nil {
+			fmt.Fprintf(c.errOut, "notice: %s points to an unborn branch (%s)\n", name, head.Target().Short())
+		}
+
+		return nil, nil
+	}
+
+	if h, ok := c.checkRef(name, head.Hash()); ok {
+		return []plumbing.Hash{h}, nil
+	}
+
+	return nil, nil
+}
+
+// checkRef reports whether the object h named by the reference name is
+// present.
+func (c *fsckChecker) checkRef(name string, h plumbing.Hash) (plumbing.Hash, bool) {
+	if o, ok := c.objects[h]; ok && o.present {
+		return h, true
+	}
+
+	fmt.Fprintf(c.errOut, "error: %s: invalid sha1 pointer %s\n", name, h)
+	c.status |= fsckErrorReachable
+
+	return h, false
+}
+
+func (c *fsckChecker) reflogRoots(wts []linkedWorktree) ([]plumbing.Hash, error) {
+	logs, err := allReflogs(c.r, wts)
+	if err != nil {
+		return nil, err
+	}
+
+	var roots []plumbing.Hash
+
+	for _, log := range logs {
+		for _, e := range log.entries {
+			for _, h := range []plumbing.Hash{e.OldHash, e.NewHash} {
+				if h.IsZero() {
+					continue
+				}
+
+				if o, ok := c.objects[h]; ok && o.present {
+					roots = append(roots, h)
+
+					continue
+				}
+
+				fmt.Fprintf(c.errOut, "error: %s: invalid reflog entry %s\n", log.name, h)
+				c.status |= fsckErrorReachable
+			}
+		}
+	}
+
+	return roots, nil
+}
+
+// markReachable marks the objects reachable from roots, reporting the links
+// to missing objects.
+func (c *fsckChecker) markReachable(roots []plumbing.Hash) {
+	pending := append([]plumbing.Hash(nil), roots...)
+
+	for len(pending) > 0 {
+		h := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		o := c.object(h)
+		if o.reachable {
+			continue
+		}
+
+		o.reachable = true
+
+		for _, l := range o.links {
+			target := c.object(l.hash)
+
+			if !target.present && !target.reachable {
+				fmt.Fprintf(c.out, "broken link from %7s %s\n", o.typ, h)
+				fmt.Fprintf(c.out, "              to %7s %s\n", l.typ, l.hash)
+				c.status |= fsckErrorReachable
+			}
+
+			pending = append(pending, l.hash)
+		}
+	}
+}
+
+// reportUnreachable prints the missing reachable objects, and the
+// unreachable or dangling ones.
+func (c *fsckChecker) reportUnreachable() error {
+	for _, h := range c.sortedObjects() {
+		o := c.objects[h]
+
+		switch {
+		case o.reachable && !o.present:
+			fmt.Fprintf(c.out, "missing %s %s\n", o.typ, h)
+			c.status |= fsckErrorReachable
+		case o.reachable || !o.present:
+		case fsckUnreachable:
+			fmt.Fprintf(c.out, "unreachable %s %s\n", o.typ, h)
+		case !o.used:
+			if fsckDangling && !fsckNoDangling {
+				fmt.Fprintf(c.out, "dangling %s %s\n", o.typ, h)
+			}
+
+			if fsckLostFound {
+				err := c.writeLostFound(h, o)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// writeLostFound writes a dangling commit's name to lost-found/commit, and
+// the contents of a blob or another object's name to lost-found/other.
+func (c *fsckChecker) writeLostFound(h plumbing.Hash, o *fsckObject) error {
+	dir := "other"
+	if o.typ == plumbing.CommitObject {
+		dir = "commit"
+	}
+
+	data := []byte(h.String() + "\n")
+
+	if o.typ == plumbing.BlobObject {
+		obj, err := c.r.Storer.EncodedObject(plumbing.BlobObject, h)
+		if err == nil {
+			data, err = readObjectData(obj)
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to read blob %s: %w", h, err)
+		}
+	}
+
+	fs := c.store.Filesystem()
+	p := path.Join("lost-found", dir, h.String())
+
+	err := fs.MkdirAll(path.Dir(p), 0o755)
+	if err == nil {
+		err = util.WriteFile(fs, p, data, 0o644)
+	}
+
+	if err != nil {
+		return fmt.Errorf("could not write '%s': %w", p, err)
+	}
+
+	return nil
+}
+
+func (c *fsckChecker) sortedObjects() []plumbing.Hash {
+	hashes := make([]plumbing.Hash, 0, len(c.objects))
+	for h := range c.objects {
+		hashes = append(hashes, h)
+	}
+
+	plumbing.HashesSort(hashes)
+
+	return hashes
+}
+
+// readPackIndexes reads the indexes of the packs of the repository.
+func readPackIndexes(store *filesystem.Storage, of formatcfg.ObjectFormat) (map[plumbing.Hash]*idxfile.MemoryIndex, error) {
+	packs, err := store.ObjectPacks()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list packs: %w", err)
+	}
+
+	ch := objectFormatHash(of)
+	indexes := make(map[plumbing.Hash]*idxfile.MemoryIndex, len(packs))
+
+	for _, p := range packs {
+		f, err := store.Filesystem().Open(packFilePath(p, "idx"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open index of pack %s: %w", p, err)
+		}
+
+		idx := idxfile.NewMemoryIndex(ch.Size())
+
+		err = idxfile.NewDecoder(f, hash.New(ch)).Decode(idx)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode index of pack %s: %w", p, err)
+		}
+
+		indexes[p] = idx
+	}
+
+	return indexes, nil
+}
+
+func sortedPacks(indexes map[plumbing.Hash]*idxfile.MemoryIndex) []plumbing.Hash {
+	packs := make([]plumbing.Hash, 0, len(indexes))
+	for p := range indexes {
+		packs = append(packs, p)
+	}
+
+	plumbing.HashesSort(packs)
+
+	return packs
+}
+
+// indexHashes returns the objects in idx, sorted.
+func indexHashes(idx *idxfile.MemoryIndex) ([]plumbing.Hash, error) {
+	entries, err := idx.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	defer entries.Close()
+
+	var hashes []plumbing.Hash
+
+	for {
+		e, err := entries.Next()
+		if errors.Is(err, io.EOF) {
+			return hashes, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		// The entry hash keeps the bytes following it in the index past
+		// its size, which would break comparisons with other hashes.
+		h, _ := plumbing.FromBytes(e.Hash.Bytes())
+		hashes = append(hashes, h)
+	}
+}
+
+type fsckSeverity int
+
+const (
+	// fsckInfo problems are reported as warnings even with --strict.
+	fsckInfo fsckSeverity = iota
+	fsckWarn
+	fsckError
+)
+
+// fsckProblem is a problem found in an object, with git's message ID.
+type fsckProblem struct {
+	id       string
+	severity fsckSeverity
+	message  string
+}
+
+// fsckParser checks the format of commits, tags and trees the way git's
+// fsck does. Like git, it stops checking an object at its first error.
+type fsckParser struct {
+	strict   bool
+	hexSize  int
+	hashSize int
+	problems []fsckProblem
+}
+
+func (p *fsckParser) check(typ plumbing.ObjectType, data []byte) {
+	//exhaustive:ignore only commits, trees and tags have a format to check.
+	switch typ {
+	case plumbing.CommitObject:
+		p.commit(data)
+	case plumbing.TagObject:
+		p.tag(data)
+	case plumbing.TreeObject:
+		p.tree(data)
+	}
+}
+
+// report records a problem and returns whether it is an error.
+func (p *fsckParser) report(id string, severity fsckSeverity, format string, args ...any) bool {
+	if p.strict && severity == fsckWarn {
+		severity = fsckError
+	}
+
+	p.problems = append(p.problems, fsckProblem{id: id, severity: severity, message: fmt.Sprintf(format, args...)})
+
+	return severity == fsckError
+}
+
+// headers checks that the headers of a commit or tag end with an empty
+// line, or the end of the object, and hold no NUL.
+func (p *fsckParser) headers(data []byte) bool {
+	for i, b := range data {
+		switch b {
+		case 0:
+			return !p.report("nulInHeader", fsckError, "unterminated header: NUL at offset %d", i)
+		case '\n':
+			if i+1 < len(data) && data[i+1] == '\n' {
+				return true
+			}
+		}
+	}
+
+	if len(data) > 0 && data[len(data)-1] == '\n' {
+		return true
+	}
+
+	return !p.report("unterminatedHeader", fsckError, "unterminated header")
+}
+
+// objectLine checks that data starts with "<name> <object-id>\n" and
+// returns the rest of it.
+func (p *fsckParser) objectLine(data []byte, name string) ([]byte, bool) {
+	rest, ok := bytes.CutPrefix(data, []byte(name+" "))
+	if !ok {
+		return nil, false
+	}
+
+	if len(rest) <= p.hexSize || rest[p.hexSize] != '\n' || !isHexByte(string(rest[:p.hexSize])) {
+		return nil, false
+	}
+
+	return rest[p.hexSize+1:], true
+}
+
+func (p *fsckParser) commit(data []byte) {
+	if !p.headers(data) {
+		return
+	}
+
+	if !bytes.HasPrefix(data, []byte("tree ")) {
+		p.report("missingTree", fsckError, "invalid format - expected 'tree' line")
+
+		return
+	}
+
+	rest, ok := p.objectLine(data, "tree")
+	if !ok {
+		p.report("badTreeSha1", fsckError, "invalid 'tree' line format - bad sha1")
+
+		return
+	}
+
+	for bytes.HasPrefix(rest, []byte("parent ")) {
+		rest, ok = p.objectLine(rest, "parent")
+		if !ok {
+			p.report("badParentSha1", fsckError, "invalid 'parent' line format - bad sha1")
+
+			return
+		}
+	}
+
+	authors := 0
+
+	for {
+		line, ok := bytes.CutPrefix(rest, []byte("author "))
+		if !ok {
+			break
+		}
+
+		authors++
+
+		rest, ok = p.ident(line)
+		if !ok {
+			return
+		}
+	}
+
+	switch {
+	case authors == 0 && p.report("missingAuthor", fsckError, "invalid format - expected 'author' line"):
+		return
+	case authors > 1 && p.report("multipleAuthors", fsckError, "invalid format - multiple 'author' lines"):
+		return
+	}
+
+	line, ok := bytes.CutPrefix(rest, []byte("committer "))
+	if !ok {
+		p.report("missingCommitter", fsckError, "invalid format - expected 'committer' line")
+
+		return
+	}
+
+	if _, ok := p.ident(line); !ok {
+		return
+	}
+
+	if bytes.IndexByte(data, 0) >= 0 {
+		p.report("nulInCommit", fsckWarn, "NUL byte in the commit object body")
+	}
+}
+
+// ident checks the "<name> <<email>> <date> <zone>" line data starts
+// with, and returns the lines after it.
+func (p *fsckParser) ident(data []byte) ([]byte, bool) {
+	line, rest, _ := bytes.Cut(data, []byte("\n"))
+	s := string(line) + "\n"
+
+	bad := func(id, what string) ([]byte, bool) {
+		return rest, !p.report(id, fsckError, "invalid author/committer line - %s", what)
+	}
+
+	if strings.HasPrefix(s, "<") {
+		return bad("missingNameBeforeEmail", "missing space before email")
+	}
+
+	i := strings.IndexAny(s, "<>\n")
+
+	switch {
+	case s[i] == '>':
+		return bad("badName", "bad name")
+	case s[i] != '<':
+		return bad("missingEmail", "missing email")
+	case s[i-1] != ' ':
+		return bad("missingSpaceBeforeEmail", "missing space before email")
+	}
+
+	s = s[i+1:]
+	i = strings.IndexAny(s, "<>\n")
+
+	if s[i] != '>' {
+		return bad("badEmail", "bad email")
+	}
+
+	s = s[i+1:]
+	if !strings.HasPrefix(s, " ") {
+		return bad("missingSpaceBeforeDate", "missing space before date")
+	}
+
+	s = s[1:]
+	if strings.HasPrefix(s, "0") && !strings.HasPrefix(s, "0 ") {
+		return bad("zeroPaddedDate", "zero-padded date")
+	}
+
+	date, zone, ok := strings.Cut(s, " ")
+	if !ok || date == "" || strings.Trim(date, "0123456789") != "" {
+		return bad("badDate", "bad date")
+	}
+
+	if _, err := strconv.ParseInt(date, 10, 64); err != nil {
+		return bad("badDateOverflow", "date causes integer overflow")
+	}
+
+	if len(zone) != 6 || (zone[0] != '+' && zone[0] != '-') || strings.Trim(zone[1:5], "0123456789") != "" || zone[5] != '\n' {
+		return bad("badTimezone", "bad time zone")
+	}
+
+	return rest, true
+}
+
+func (p *fsckParser) tag(data []byte) {
+	if !p.headers(data) {
+		return
+	}
+
+	if !bytes.HasPrefix(data, []byte("object ")) {
+		p.report("missingObject", fsckError, "invalid format - expected 'object' line")
+
+		return
+	}
+
+	rest, ok := p.objectLine(data, "object")
+	if !ok {
+		p.report("badObjectSha1", fsckError, "invalid 'object' line format - bad sha1")
+
+		return
+	}
+
+	rest, ok = bytes.CutPrefix(rest, []byte("type "))
+	if !ok {
+		p.report("missingTypeEntry", fsckError, "invalid format - expected 'type' line")
+
+		return
+	}
+
+	typ, rest, ok := bytes.Cut(rest, []byte("\n"))
+	if !ok {
+		p.report("missingType", fsckError, "invalid format - unexpected end after 'type' line")
+
+		return
+	}
+
+	if t, err := plumbing.ParseObjectType(string(typ)); err != nil || !t.Valid() {
+		p.report("badType", fsckError, "invalid 'type' value")
+
+		return
+	}
+
+	rest, ok = bytes.CutPrefix(rest, []byte("tag "))
+	if !ok {
+		p.report("missingTagEntry", fsckError, "invalid format - expected 'tag' line")
+
+		return
+	}
+
+	name, rest, ok := bytes.Cut(rest, []byte("\n"))
+	if !ok {
+		p.report("missingTag", fsckError, "invalid format - unexpected end after 'type' line")
+
+		return
+	}
+
+	if plumbing.NewTagReferenceName(string(name)).Validate() != nil {
+		p.report("badTagName", fsckInfo, "invalid 'tag' name: %s", name)
+	}
+
+	line, ok := bytes.CutPrefix(rest, []byte("tagger "))
+	if !ok {
+		p.report("missingTaggerEntry", fsckInfo, "invalid format - expected 'tagger' line")
+
+		return
+	}
+
+	p.ident(line)
+}
+
+func (p *fsckParser) tree(data []byte) {
+	var (
+		nullSha1, fullPathname, emptyName, hasDot, hasDotdot, hasDotgit bool
+		zeroPadded, badModes, duplicates, unsorted                      bool
+
+		prevName string
+		prevMode uint64
+		names    = make(map[string]bool)
+	)
+
+	for i := 0; len(data) > 0; i++ {
+		modeEnd := bytes.IndexByte(data, ' ')
+		nameEnd := bytes.IndexByte(data, 0)
+
+		if modeEnd <= 0 || nameEnd < modeEnd || len(data) < nameEnd+1+p.hashSize {
+			p.report("badTree", fsckError, "cannot be parsed as a tree")
+
+			return
+		}
+
+		mode, err := strconv.ParseUint(string(data[:modeEnd]), 8, 32)
+		if err != nil {
+			p.report("badTree", fsckError, "cannot be parsed as a tree")
+
+			return
+		}
+
+		name := string(data[modeEnd+1 : nameEnd])
+		id := data[nameEnd+1 : nameEnd+1+p.hashSize]
+		zeroPadded = zeroPadded || data[0] == '0'
+		data = data[nameEnd+1+p.hashSize:]
+
+		nullSha1 = nullSha1 || bytes.Count(id, []byte{0}) == len(id)
+		fullPathname = fullPathname || strings.Contains(name, "/")
+		emptyName = emptyName || name == ""
+		hasDot = hasDot || name == "."
+		hasDotdot = hasDotdot || name == ".."
+		hasDotgit = hasDotgit || strings.EqualFold(name, git.GitDirName)
+
+		switch filemode.FileMode(mode) {
+		case filemode.Executable, filemode.Regular, filemode.Symlink, filemode.Dir, filemode.Submodule:
+		case filemode.Deprecated:
+			badModes = badModes || p.strict
+		default:
+			badModes = true
+		}
+
+		// Like git, entries are sorted as if the names of trees ended in
+		// a slash.
+		if i > 0 {
+			switch a, b := treeSortName(prevName, prevMode), treeSortName(name, mode); {
+			case prevName == name:
+				duplicates = true
+			case a > b:
+				unsorted = true
+			}
+		}
+
+		if names[name] {
+			duplicates = true
+		}
+
+		names[name] = true
+		prevName, prevMode = name, mode
+	}
+
+	problems := []struct {
+		found    bool
+		id       string
+		severity fsckSeverity
+		message  string
+	}{
+		{nullSha1, "nullSha1", fsckWarn, "contains entries pointing to null sha1"},
+		{fullPathname, "fullPathname", fsckWarn, "contains full pathnames"},
+		{emptyName, "emptyName", fsckWarn, "contains empty pathname"},
+		{hasDot, "hasDot", fsckWarn, "contains '.'"},
+		{hasDotdot, "hasDotdot", fsckWarn, "contains '..'"},
+		{hasDotgit, "hasDotgit", fsckWarn, "contains '.git'"},
+		{zeroPadded, "zeroPaddedFilemode", fsckWarn, "contains zero-padded file modes"},
+		{badModes, "badFilemode", fsckInfo, "contains bad file modes"},
+		{duplicates, "duplicateEntries", fsckError, "contains duplicate file entries"},
+		{unsorted, "treeNotSorted", fsckError, "not properly sorted"},
+	}
+
+	for _, problem := range problems {
+		if problem.found {
+			p.report(problem.id, problem.severity, "%s", problem.message)
+		}
+	}
+}
+
+func treeSortName(name string, mode uint64) string {
+	if filemode.FileMode(mode) == filemode.Dir {
+		return name + "/"
+	}
+
+	return name
+}
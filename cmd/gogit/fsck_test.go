@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// sortedLines returns the lines of s, sorted.
+func sortedLines(s string) []string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	slices.Sort(lines)
+
+	return lines
+}
+
+// manyFiles returns name and content pairs for n files, enough for the
+// objects of a pack to share the first bytes of their hashes.
+func manyFiles(n int) []string {
+	var files []string
+	for i := range n {
+		files = append(files, "d"+strconv.Itoa(i%5)+"/f"+strconv.Itoa(i), strconv.Itoa(i))
+	}
+
+	return files
+}
+
+func TestFsckGitPack(t *testing.T) {
+	src := gitRepo(t, manyFiles(100), []string{"a", "3"})
+
+	dir := filepath.Join(t.TempDir(), "clone")
+	gitCmd(t, "", "clone", "-q", "--no-local", src, dir)
+
+	res := gogit(t, dir, "fsck")
+	if res.code != 0 || res.stdout != "" || res.stderr != "" {
+		t.Errorf("fsck of a git clone exited with %d:\n%s%s", res.code, res.stdout, res.stderr)
+	}
+}
+
+func TestFsckDangling(t *testing.T) {
+	dir := gitRepo(t, manyFiles(100), []string{"a", "3"})
+	gitCmdStdin(t, dir, "packed\n", "hash-object", "-w", "--stdin")
+	gitCmd(t, dir, "gc", "-q")
+	gitCmdStdin(t, dir, "loose\n", "hash-object", "-w", "--stdin")
+
+	want := gitCmd(t, dir, "fsck")
+
+	res := gogit(t, dir, "fsck")
+	if res.code != 0 {
+		t.Fatalf("fsck exited with %d: %s", res.code, res.stderr)
+	}
+
+	if got := sortedLines(res.stdout); !slices.Equal(got, sortedLines(want)) {
+		t.Errorf("fsck printed %q, want as git %q", got, sortedLines(want))
+	}
+}
+
+func TestFsckMissingBlob(t *testing.T) {
+	dir := gitRepo(t, []string{"a", "1", "d/b", "2"})
+
+	h := strings.TrimSpace(gitCmd(t, dir, "rev-parse", "HEAD:d/b"))
+
+	err := os.Remove(filepath.Join(dir, ".git", "objects", h[:2], h[2:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := run(t, dir, "", "git", "fsck")
+
+	got := gogit(t, dir, "fsck")
+	if got.code != want.code {
+		t.Errorf("fsck exited with %d, want as git %d", got.code, want.code)
+	}
+
+	if !strings.Contains(got.stdout, "missing blob "+h) {
+		t.Errorf("fsck printed %q, want the missing blob %s", got.stdout, h)
+	}
+}
+
+func TestFsckAfterGC(t *testing.T) {
+	dir := gitRepo(t, manyFiles(100), []string{"a", "3"})
+	mustGogit(t, dir, "gc")
+	gitCmd(t, dir, "fsck", "--strict")
+
+	res := gogit(t, dir, "fsck", "--strict")
+	if res.code != 0 || res.stdout != "" {
+		t.Errorf("fsck after gc exited with %d:\n%s%s", res.code, res.stdout, res.stderr)
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/config"
+	formatcfg "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/spf13/cobra"
+)
+
+var (
+	gcAggressive bool
+	gcAuto       bool
+	gcPrune      string
+)
+
+func init() {
+	gcCmd.Flags().BoolVarP(&gcAggressive, "aggressive", "", false, "Spend more time looking for deltas")
+	gcCmd.Flags().BoolVarP(&gcAuto, "auto", "", false, "Only run when there are too many loose objects or packs")
+	gcCmd.Flags().StringVarP(&gcPrune, "prune", "", "", "Remove the unreachable objects older than the specified time (default gc.pruneExpire or 2.weeks.ago)")
+	rootCmd.AddCommand(gcCmd)
+}
+
+var gcCmd = &cobra.Command{
+	Use:   "gc [--aggressive] [--auto] [--prune=<date>]",
+	Short: "Remove unneeded files and compact the repository",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		cfg, err := r.Config()
+		if err != nil {
+			return fmt.Errorf("failed to get repository config: %w", err)
+		}
+
+		p, err := newRepacker(r, io.Discard)
+		if err != nil {
+			return err
+		}
+
+		// Like git, an automatic collection only packs the loose objects
+		// unless there are too many packs.
+		p.all, p.delete, p.loosen = true, true, true
+
+		if gcAuto {
+			need, tooManyPacks, err := needsAutoGC(p.store, p.of, cfg)
+			if err != nil || !need {
+				return err
+			}
+
+			p.all = tooManyPacks
+
+			fmt.Fprintln(cmd.ErrOrStderr(), "Auto packing the repository for optimum performance.")
+		}
+
+		p.window, err = configInt(cfg, "pack", "window", 10)
+		if err != nil {
+			return err
+		}
+
+		p.depth, err = configInt(cfg, "pack", "depth", 50)
+		if err != nil {
+			return err
+		}
+
+		if gcAggressive {
+			// Like git, the deltas are computed afresh.
+			p.noReuse = true
+
+			p.window, err = configInt(cfg, "gc", "aggressivewindow", 250)
+			if err != nil {
+				return err
+			}
+
+			p.depth, err = configInt(cfg, "gc", "aggressivedepth", 50)
+			if err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+
+		prune := gcPrune
+		if prune == "" {
+			prune = configString(cfg, "gc", "pruneexpire", "2.weeks.ago")
+		}
+
+		p.expire, err = parseExpireTime(prune, now)
+		if err != nil {
+			return err
+		}
+
+		reflogCutoff, err := parseExpireTime(configString(cfg, "gc", "reflogexpire", "90.days.ago"), now)
+		if err != nil {
+			return err
+		}
+
+		err = packRefs(r, true, true)
+		if err != nil {
+			return err
+		}
+
+		// The reflogs are expired first, so that the objects only their
+		// old entries reached are no longer kept.
+		rs, err := reflogStorer(r)
+		if err != nil {
+			return err
+		}
+
+		names, err := reflogNames(r)
+		if err != nil {
+			return err
+		}
+
+		for _, name := range names {
+			err = expireReflog(rs, name, reflogCutoff, false, nil)
+			if err != nil {
+				return err
+			}
+		}
+
+		// The unreachable objects of the removed packs are kept loose, so
+		// that prune removes them along with the other loose objects past
+		// the grace period. The objects are not listed again, as the
+		// storage still refers to the removed packs.
+		err = p.run()
+		if err != nil {
+			return err
+		}
+
+		err = pruneObjects(p.store, p.of, p.reachable, p.expire, false, nil)
+		if err != nil {
+			return err
+		}
+
+		if !configBool(cfg, "gc", "writecommitgraph", true) || !configBool(cfg, "core", "commitgraph", true) {
+			return nil
+		}
+
+		// The repository is opened again to read the commits from the new
+		// pack.
+		r, err = git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		return writeCommitGraph(r, true, false, false)
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// needsAutoGC reports whether there are more loose objects than gc.auto or
+// more packs than gc.autoPackLimit, and which. Like git, the loose objects
+// are estimated from those in the objects/17 directory.
+func needsAutoGC(store *filesystem.Storage, of formatcfg.ObjectFormat, cfg *config.Config) (need, tooManyPacks bool, err error) {
+	auto, err := configInt(cfg, "gc", "auto", 6700)
+	if err != nil || auto <= 0 {
+		return false, false, err
+	}
+
+	packLimit, err := configInt(cfg, "gc", "autopacklimit", 50)
+	if err != nil {
+		return false, false, err
+	}
+
+	fs := store.Filesystem()
+
+	infos, err := fs.ReadDir(path.Join("objects", "17"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, false, err
+	}
+
+	loose := 0
+
+	for _, fi := range infos {
+		if !fi.IsDir() && len(fi.Name()) == 2*objectFormatHash(of).Size()-2 {
+			loose++
+		}
+	}
+
+	tooManyLoose := loose > (auto+255)/256
+
+	if packLimit <= 0 {
+		return tooManyLoose, false, nil
+	}
+
+	packs, err := store.ObjectPacks()
+	if err != nil {
+		return false, false, fmt.Errorf("failed to list packs: %w", err)
+	}
+
+	count := 0
+
+	for _, pack := range packs {
+		if _, err := fs.Stat(packFilePath(pack, "keep")); err != nil {
+			count++
+		}
+	}
+
+	tooManyPacks = count > packLimit
+
+	return tooManyLoose || tooManyPacks, tooManyPacks, nil
+}
+
+// configString returns an option of the repository configuration, or def
+// when it is not set.
+func configString(cfg *config.Config, section, key, def string) string {
+	if v := configOption(cfg, section, key); v != "" {
+		return v
+	}
+
+	return def
+}
+
+// configBool returns a boolean option of the repository configuration, or
+// def when it is not set or invalid.
+func configBool(cfg *config.Config, section, key string, def bool) bool {
+	switch strings.ToLower(configOption(cfg, section, key)) {
+	case "true", "yes", "on", "1":
+		return true
+	case "false", "no", "off", "0":
+		return false
+	default:
+		return def
+	}
+}
+
+// configInt returns an integer option of the repository configuration, with
+// git's k, m and g suffixes, or def when it is not set.
+func configInt(cfg *config.Config, section, key string, def int) (int, error) {
+	v := configOption(cfg, section, key)
+	if v == "" {
+		return def, nil
+	}
+
+	n, err := parseScaledInt(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s.%s value %q: %w", section, key, v, err)
+	}
+
+	return n, nil
+}
+
+// parseScaledInt parses an integer with git's k, m and g suffixes.
+func parseScaledInt(v string) (int, error) {
+	unit := 1
+
+	switch strings.ToLower(v[len(v)-1:]) {
+	case "k":
+		unit = 1 << 10
+	case "m":
+		unit = 1 << 20
+	case "g":
+		unit = 1 << 30
+	}
+
+	if unit != 1 {
+		v = v[:len(v)-1]
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, err
+	}
+
+	return n * unit, nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// gcRepo returns a repository made by git with a pack, loose objects, an
+// annotated tag, and unreachable objects written now and a month ago.
+func gcRepo(t *testing.T) string {
+	t.Helper()
+
+	dir := gitRepo(t, manyFiles(30))
+	gitCmd(t, dir, "repack", "-q", "-d")
+
+	writeFile(t, dir, "d0/f0", "changed")
+	gitCmd(t, dir, "commit", "-q", "-a", "-m", "loose")
+	gitCmd(t, dir, "tag", "-a", "-m", "v1", "v1")
+	gitCmd(t, dir, "branch", "topic")
+
+	gitCmdStdin(t, dir, "recent\n", "hash-object", "-w", "--stdin")
+
+	old := strings.TrimSpace(gitCmdStdin(t, dir, "old\n", "hash-object", "-w", "--stdin"))
+	path := filepath.Join(dir, ".git", "objects", old[:2], old[2:])
+
+	month := time.Now().AddDate(0, -1, 0)
+
+	err := os.Chtimes(path, month, month)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+// storeState describes the objects of dir, loose and packed, and its
+// references, as git reports them.
+func storeState(t *testing.T, dir string) string {
+	t.Helper()
+
+	var state strings.Builder
+
+	fmt.Fprintf(&state, "packs %d\n", len(globPacks(t, dir, "*.pack")))
+
+	for _, line := range strings.Split(gitCmd(t, dir, "count-objects", "-v"), "\n") {
+		if strings.HasPrefix(line, "count:") || strings.HasPrefix(line, "in-pack:") {
+			fmt.Fprintln(&state, line)
+		}
+	}
+
+	state.WriteString(gitCmd(t, dir, "cat-file", "--batch-all-objects", "--batch-check"))
+	state.WriteString(gitCmd(t, dir, "for-each-ref"))
+
+	packed, err := os.ReadFile(filepath.Join(dir, ".git", "packed-refs"))
+	if err == nil {
+		fmt.Fprintf(&state, "packed-refs:\n%s", packed)
+	}
+
+	gitCmd(t, dir, "fsck", "--no-dangling")
+
+	return state.String()
+}
+
+func TestGC(t *testing.T) {
+	for _, args := range []string{"", "--aggressive", "--prune=now", "--prune=all"} {
+		t.Run(args, func(t *testing.T) {
+			var states []string
+
+			for _, tool := range []string{"git", "gogit"} {
+				dir := gcRepo(t)
+
+				a := append([]string{"gc"}, strings.Fields(args)...)
+				if tool == "git" {
+					gitCmd(t, dir, append(a, "-q")...)
+				} else {
+					mustGogit(t, dir, a...)
+				}
+
+				states = append(states, storeState(t, dir))
+			}
+
+			if states[1] != states[0] {
+				t.Errorf("gogit gc %s left:\n%s\nwant, as git:\n%s", args, states[1], states[0])
+			}
+		})
+	}
+}
+
+// blobsIn17 returns the contents of n blobs whose object ids start with 17.
+func blobsIn17(n int) []string {
+	var blobs []string
+
+	for i := 0; len(blobs) < n; i++ {
+		blob := fmt.Sprintf("blob %d\n", i)
+
+		sum := sha1.Sum([]byte(fmt.Sprintf("blob %d\x00%s", len(blob), blob)))
+		if sum[0] == 0x17 {
+			blobs = append(blobs, blob)
+		}
+	}
+
+	return blobs
+}
+
+// TestGCAuto checks that gc --auto only compacts the repository when git
+// would.
+func TestGCAuto(t *testing.T) {
+	for _, config := range []string{"", "gc.auto=1", "gc.auto=0", "gc.autoPackLimit=1", "gc.autoPackLimit=2"} {
+		t.Run(config, func(t *testing.T) {
+			var states []string
+
+			for _, tool := range []string{"git", "gogit"} {
+				dir := gcRepo(t)
+
+				// A second pack, a loose commit, and loose objects in
+				// objects/17, where git looks to estimate their number,
+				// for gc.auto=1.
+				writeFile(t, dir, "d1/f1", "changed")
+				gitCmd(t, dir, "commit", "-q", "-a", "-m", "second pack")
+				gitCmd(t, dir, "repack", "-q")
+
+				writeFile(t, dir, "d2/f2", "changed")
+				gitCmd(t, dir, "commit", "-q", "-a", "-m", "loose again")
+
+				for _, blob := range blobsIn17(3) {
+					gitCmdStdin(t, dir, blob, "hash-object", "-w", "--stdin")
+				}
+
+				// git would otherwise compact the repository in the
+				// background.
+				gitCmd(t, dir, "config", "gc.autoDetach", "false")
+
+				if key, value, ok := strings.Cut(config, "="); ok {
+					gitCmd(t, dir, "config", key, value)
+				}
+
+				var res result
+				if tool == "git" {
+					res = run(t, dir, "", "git", "gc", "--auto")
+				} else {
+					res = gogit(t, dir, "gc", "--auto")
+				}
+
+				if res.code != 0 {
+					t.Fatalf("%s gc --auto failed: %s", tool, res.stderr)
+				}
+
+				ran := strings.Contains(res.stderr, "Auto packing the repository")
+				states = append(states, fmt.Sprintf("ran %v\n%s", ran, storeState(t, dir)))
+			}
+
+			if states[1] != states[0] {
+				t.Errorf("gogit gc --auto left:\n%s\nwant, as git:\n%s", states[1], states[0])
+			}
+		})
+	}
+}
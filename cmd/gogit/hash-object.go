@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/storage/memory"
+	"github.com/spf13/cobra"
+)
+
+var (
+	hashObjectWrite     bool
+	hashObjectType      string
+	hashObjectStdin     bool
+	hashObjectLiterally bool
+	hashObjectPath      string
+	hashObjectNoFilters bool
+)
+
+func init() {
+	hashObjectCmd.Flags().BoolVarP(&hashObjectWrite, "write", "w", false, "Write the object into the object database")
+	hashObjectCmd.Flags().StringVarP(&hashObjectType, "type", "t", "blob", "Type of the object to create")
+	hashObjectCmd.Flags().BoolVarP(&hashObjectStdin, "stdin", "", false, "Read the object from stdin")
+	hashObjectCmd.Flags().BoolVarP(&hashObjectLiterally, "literally", "", false, "Skip checking that the content is a valid object of its type")
+	hashObjectCmd.Flags().StringVarP(&hashObjectPath, "path", "", "", "Convert the contents as if they were those of the file at this path")
+	hashObjectCmd.Flags().BoolVarP(&hashObjectNoFilters, "no-filters", "", false, "Hash the contents as is, without applying the attributes of the files")
+	rootCmd.AddCommand(hashObjectCmd)
+}
+
+var hashObjectCmd = &cobra.Command{
+	Use:   "hash-object [-w] [-t <type>] [--literally] [--path=<file> | --no-filters] [--stdin] [--] <file>...",
+	Short: "Compute the object id of files and optionally write them as objects",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		t, err := plumbing.ParseObjectType(hashObjectType)
+		if err != nil {
+			return fmt.Errorf("invalid object type \"%s\"", hashObjectType)
+		}
+
+		if hashObjectPath != "" && hashObjectNoFilters {
+			return errors.New("cannot use --path with --no-filters")
+		}
+
+		// Outside of a repository, objects are hashed as they are.
+		r, err := git.PlainOpen(".")
+		if err != nil && hashObjectWrite {
+			return err
+		}
+
+		s := storer.EncodedObjectStorer(memory.NewStorage())
+		if hashObjectWrite {
+			s = r.Storer
+		}
+
+		var conv *converter
+		if r != nil && t == plumbing.BlobObject && !hashObjectNoFilters && !hashObjectLiterally {
+			conv, err = newConverter(r, attrCheckin, cmd.ErrOrStderr())
+			if err != nil {
+				return err
+			}
+			defer conv.Close()
+		}
+
+		// Files are converted as their own path says, unless --path is
+		// given, and the standard input only then.
+		type input struct {
+			path string
+			read func() ([]byte, error)
+		}
+
+		var inputs []input
+
+		if hashObjectStdin {
+			inputs = append(inputs, input{hashObjectPath, func() ([]byte, error) {
+				return io.ReadAll(cmd.InOrStdin())
+			}})
+		}
+
+		for _, arg := range args {
+			p := hashObjectPath
+			if p == "" {
+				p = filepath.ToSlash(filepath.Clean(arg))
+			}
+
+			inputs = append(inputs, input{p, func() ([]byte, error) {
+				return os.ReadFile(arg)
+			}})
+		}
+
+		for _, in := range inputs {
+			data, err := in.read()
+			if err != nil {
+				return fmt.Errorf("failed to read object: %w", err)
+			}
+
+			if conv != nil && in.path != "" {
+				data, err = conv.toGit(in.path, data)
+				if err != nil {
+					return err
+				}
+			}
+
+			obj, err := newObject(s, t, data)
+			if err != nil {
+				return err
+			}
+
+			if !hashObjectLiterally {
+				err = checkObject(obj)
+				if err != nil {
+					return err
+				}
+			}
+
+			if hashObjectWrite {
+				_, err = s.SetEncodedObject(obj)
+				if err != nil {
+					return fmt.Errorf("failed to write object: %w", err)
+				}
+			}
+
+			fmt.Fprintln(cmd.OutOrStdout(), obj.Hash())
+		}
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// newObject returns an object of type t holding data, ready to be stored
+// in s.
+func newObject(s storer.EncodedObjectStorer, t plumbing.ObjectType, data []byte) (plumbing.EncodedObject, error) {
+	obj := s.NewEncodedObject()
+	obj.SetType(t)
+	obj.SetSize(int64(len(data)))
+
+	w, err := obj.Writer()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = w.Write(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return obj, w.Close()
+}
+
+// checkObject fails if obj is not a well-formed object of its type.
+func checkObject(obj plumbing.EncodedObject) error {
+	err := objectProblem(obj)
+	if err != nil {
+		return fmt.Errorf("corrupt %s: %w", obj.Type(), err)
+	}
+
+	return nil
+}
+
+func objectProblem(obj plumbing.EncodedObject) error {
+	switch obj.Type() {
+	case plumbing.CommitObject:
+		c := &object.Commit{}
+
+		err := c.Decode(obj)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case c.TreeHash.IsZero():
+			return errors.New("missing tree")
+		case c.Author.Name == "" && c.Author.Email == "":
+			return errors.New("missing author")
+		case c.Committer.Name == "" && c.Committer.Email == "":
+			return errors.New("missing committer")
+		}
+	case plumbing.TreeObject:
+		return (&object.Tree{}).Decode(obj)
+	case plumbing.TagObject:
+		t := &object.Tag{}
+
+		err := t.Decode(obj)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case t.Target.IsZero():
+			return errors.New("missing object")
+		case t.TargetType == plumbing.InvalidObject:
+			return errors.New("missing type")
+		case t.Name == "":
+			return errors.New("missing tag")
+		}
+	}
+
+	return nil
+}
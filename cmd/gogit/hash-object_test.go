@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHashObject(t *testing.T) {
+	dir := gitRepo(t, []string{"a", "1\n", "crlf.txt", "x\r\ny\r\n", ".gitattributes", "*.txt text eol=crlf\n"})
+	writeFile(t, dir, "tree", gitCmd(t, dir, "cat-file", "tree", "HEAD^{tree}"))
+
+	for _, args := range []string{
+		"a",
+		"a crlf.txt",
+		"crlf.txt",
+		"--no-filters crlf.txt",
+		"--path=other.txt a",
+		"-t tree tree",
+		"-t blob -- a",
+	} {
+		t.Run(args, func(t *testing.T) {
+			sameOutput(t, dir, append([]string{"hash-object"}, strings.Fields(args)...)...)
+		})
+	}
+
+	input := "some content\n"
+	args := []string{"hash-object", "--stdin"}
+
+	if got, want := gogitStdin(t, dir, input, args...).stdout, gitCmdStdin(t, dir, input, args...); got != want {
+		t.Errorf("gogit hash-object --stdin gave %q, want as git %q", got, want)
+	}
+}
+
+// TestHashObjectWrite checks that the objects written are read by git, and
+// that only --literally writes malformed ones.
+func TestHashObjectWrite(t *testing.T) {
+	dir := gitRepo(t, []string{"a", "1\n"})
+
+	h := strings.TrimSpace(gogitStdin(t, dir, "written\n", "hash-object", "-w", "--stdin").stdout)
+	if got := gitCmd(t, dir, "cat-file", "-p", h); got != "written\n" {
+		t.Errorf("git read %q from the written blob", got)
+	}
+
+	if res := gogitStdin(t, dir, "not a commit\n", "hash-object", "-w", "-t", "commit", "--stdin"); res.code == 0 {
+		t.Error("gogit hash-object wrote a malformed commit")
+	}
+
+	args := []string{"hash-object", "-w", "-t", "commit", "--literally", "--stdin"}
+	want := gitCmdStdin(t, gitRepo(t), "not a commit\n", args...)
+
+	if got := gogitStdin(t, dir, "not a commit\n", args...).stdout; got != want {
+		t.Errorf("gogit hash-object --literally gave %q, want as git %q", got, want)
+	}
+
+	if got := gitCmd(t, dir, "cat-file", "-t", strings.TrimSpace(want)); got != "commit\n" {
+		t.Errorf("git read a %q object", got)
+	}
+}
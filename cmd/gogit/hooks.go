@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/spf13/cobra"
+)
+
+// hook is a client-side hook of a repository, run the way git runs it by
+// hooks.run.
+type hook struct {
+	name string
+	args []string
+	env  []string
+
+	// stdin is fed to the hook, which otherwise reads nothing.
+	stdin io.Reader
+}
+
+// hooks runs the hooks of a repository for a command, their output going
+// to errOut.
+type hooks struct {
+	r      *git.Repository
+	errOut io.Writer
+
+	// ignored records the hooks ignored for not being executable, which
+	// are only reported once.
+	ignored map[string]bool
+}
+
+func newHooks(r *git.Repository, errOut io.Writer) *hooks {
+	return &hooks{r: r, errOut: errOut, ignored: make(map[string]bool)}
+}
+
+// forRepo returns the hooks of another repository of the same command,
+// such as a new linked worktree, sharing the hooks already reported.
+func (hs *hooks) forRepo(r *git.Repository) *hooks {
+	return &hooks{r: r, errOut: hs.errOut, ignored: hs.ignored}
+}
+
+// run runs h if it is installed, from the top of the worktree, or from the
+// repository directory when it is bare. Like git, the output of the hook
+// goes to stderr, so that it cannot mix with the output of the command.
+// It returns an *exec.ExitError when the hook fails.
+func (hs *hooks) run(h hook) error {
+	path := hs.find(h.name)
+	if path == "" {
+		return nil
+	}
+
+	c := exec.Command(path, h.args...)
+	c.Dir = hookDir(hs.r)
+	c.Env = append(os.Environ(), h.env...)
+	c.Stdin = h.stdin
+	c.Stdout = hs.errOut
+	c.Stderr = hs.errOut
+
+	err := c.Run()
+
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return fmt.Errorf("cannot run %s: %w", path, err)
+	}
+
+	return err
+}
+
+// find returns the path of the hook called name, in core.hooksPath or else
+// in the hooks directory of the repository, or "" when it is not
+// installed. A hook that is not executable is ignored with a hint, unless
+// advice.ignoredHook is false.
+func (hs *hooks) find(name string) string {
+	r := hs.r
+
+	dir := scopedConfigOption(r, "core", "", "hooksPath")
+	if dir != "" {
+		dir = expandHome(dir)
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(hookDir(r), dir)
+		}
+	} else {
+		root := commonGitDir(r)
+		if root == "" {
+			return ""
+		}
+
+		dir = filepath.Join(root, "hooks")
+	}
+
+	path := filepath.Join(dir, name)
+
+	fi, err := os.Stat(path)
+	if err != nil || fi.IsDir() {
+		return ""
+	}
+
+	if runtime.GOOS != "windows" && fi.Mode()&0o111 == 0 {
+		if hs.ignored[path] {
+			return ""
+		}
+
+		hs.ignored[path] = true
+
+		if _, ok := lookupScopedConfigOption(r, "advice", "", "ignoredHook"); !ok || scopedConfigBool(r, "advice", "", "ignoredHook") {
+			shown := path
+			if rel, err := filepath.Rel(hookDir(r), path); err == nil && !strings.HasPrefix(rel, "..") {
+				shown = rel
+			}
+
+			fmt.Fprintf(hs.errOut, "hint: The '%s' hook was ignored because it's not set as executable.\n", shown)
+			fmt.Fprintln(hs.errOut, "hint: You can disable this warning with `git config advice.ignoredHook false`.")
+		}
+
+		return ""
+	}
+
+	return path
+}
+
+// hookDir returns the directory hooks run from: the top of the worktree,
+// or the repository directory when it is bare.
+func hookDir(r *git.Repository) string {
+	if w, err := r.Worktree(); err == nil {
+		return w.Filesystem.Root()
+	}
+
+	if store, ok := r.Storer.(*filesystem.Storage); ok {
+		return store.Filesystem().Root()
+	}
+
+	return "."
+}
+
+// commonGitDir returns the repository directory shared by all worktrees,
+// which linked worktrees name in their commondir file.
+func commonGitDir(r *git.Repository) string {
+	store, ok := r.Storer.(*filesystem.Storage)
+	if !ok {
+		return ""
+	}
+
+	root := store.Filesystem().Root()
+
+	data, err := os.ReadFile(filepath.Join(root, "commondir"))
+	if err != nil {
+		return root
+	}
+
+	common := strings.TrimSpace(string(data))
+	if !filepath.IsAbs(common) {
+		common = filepath.Join(root, common)
+	}
+
+	return common
+}
+
+// hookExitStatus makes a command exit quietly with the status of a failed
+// hook, as git does for the hooks whose status it reports.
+func hookExitStatus(cmd *cobra.Command, err error) error {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() <= 0 {
+		return hookFailed(cmd, err)
+	}
+
+	cmd.SilenceErrors = true
+	cmd.SilenceUsage = true
+
+	return exitStatus(exitErr.ExitCode())
+}
+
+// hookFailed makes a command exit quietly with status 1 when a hook
+// failed, as git does for the hooks that stop the command.
+func hookFailed(cmd *cobra.Command, err error) error {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+
+	cmd.SilenceErrors = true
+	cmd.SilenceUsage = true
+
+	return exitStatus(1)
+}
+
+// postCheckout runs the post-checkout hook after HEAD moved from one commit
+// to another, flag telling whether a branch was checked out rather than
+// files.
+func (hs *hooks) postCheckout(from, to plumbing.Hash, flag string) error {
+	return hs.run(hook{name: "post-checkout", args: []string{from.String(), to.String(), flag}})
+}
+
+// refTransactionLine is a line of the reference-transaction hook input.
+func refTransactionLine(name plumbing.ReferenceName, from, to plumbing.Hash) string {
+	return fmt.Sprintf("%s %s %s\n", from, to, name)
+}
+
+// referenceTransaction runs the reference-transaction hook in state
+// ("prepared", "committed" or "aborted") with the updates given as lines.
+func (hs *hooks) referenceTransaction(state string, lines []string) error {
+	if len(lines) == 0 {
+		return nil
+	}
+
+	return hs.run(hook{
+		name:  "reference-transaction",
+		args:  []string{state},
+		stdin: strings.NewReader(strings.Join(lines, "")),
+	})
+}
+
+// prepareRefUpdates runs the reference-transaction hook in the "prepared"
+// state, and in the "aborted" state when the hook refuses the updates.
+func (hs *hooks) prepareRefUpdates(lines []string) error {
+	err := hs.referenceTransaction("prepared", lines)
+	if err != nil {
+		_ = hs.referenceTransaction("aborted", lines)
+
+		return errors.New("ref updates aborted by hook")
+	}
+
+	return nil
+}
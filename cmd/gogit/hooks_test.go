@@ -0,0 +1,396 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// writeHook installs the shell script body as the hook name of the
+// repository dir.
+func writeHook(t *testing.T, dir, name, body string) {
+	t.Helper()
+
+	p := filepath.Join(dir, ".git", "hooks", name)
+
+	err := os.MkdirAll(filepath.Dir(p), 0o755)
+	if err == nil {
+		err = os.WriteFile(p, []byte("#!/bin/sh\n"+body), 0o755)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(data)
+}
+
+func TestPrePushHook(t *testing.T) {
+	dir := gitRepo(t, []string{"a", "1"})
+
+	remotes := t.TempDir()
+	origin := filepath.Join(remotes, "origin.git")
+	other := filepath.Join(remotes, "b.git")
+
+	for _, remote := range []string{origin, other} {
+		gitCmd(t, "", "init", "-q", "--bare", remote)
+	}
+
+	gitCmd(t, dir, "remote", "add", "origin", origin)
+	gitCmd(t, dir, "remote", "add", "b", other)
+
+	out := filepath.Join(t.TempDir(), "pre-push")
+	writeHook(t, dir, "pre-push", `echo "$1 $2" >>"`+out+`"; cat >>"`+out+`"`)
+
+	h := strings.TrimSpace(gitCmd(t, dir, "rev-parse", "HEAD"))
+	zero := strings.Repeat("0", 40)
+
+	mustGogit(t, dir, "push", "b", "main")
+	mustGogit(t, dir, "push")
+
+	want := "b " + other + "\n" +
+		"refs/heads/main " + h + " refs/heads/main " + zero + "\n" +
+		"origin " + origin + "\n"
+
+	if got := readFile(t, out); !strings.HasPrefix(got, want) {
+		t.Errorf("pre-push hook got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestPrePushHookRefuses(t *testing.T) {
+	dir := gitRepo(t, []string{"a", "1"})
+
+	remote := filepath.Join(t.TempDir(), "b.git")
+	gitCmd(t, "", "init", "-q", "--bare", remote)
+	gitCmd(t, dir, "remote", "add", "b", remote)
+
+	writeHook(t, dir, "pre-push", "exit 1\n")
+
+	res := gogit(t, dir, "push", "b", "main")
+	if res.code != 1 {
+		t.Errorf("push exited with %d, want 1", res.code)
+	}
+
+	if out := gitCmd(t, remote, "for-each-ref"); out != "" {
+		t.Errorf("the refused push updated %s", out)
+	}
+}
+
+// TestReferenceTransactionVeto checks that the commands updating references
+// let the reference-transaction hook refuse the updates.
+func TestReferenceTransactionVeto(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, dir string)
+		args  []string
+		stdin string
+	}{
+		{name: "notes", args: []string{"notes", "add", "-m", "note"}},
+		{name: "bisect", args: []string{"bisect", "start", "HEAD", "HEAD~1"}},
+		{
+			name: "am",
+			setup: func(t *testing.T, dir string) {
+				gitCmd(t, dir, "format-patch", "-q", "-1", "-o", "patches")
+				gitCmd(t, dir, "reset", "-q", "--hard", "HEAD~1")
+			},
+			args: []string{"am", "patches/0001-commit-2.patch"},
+		},
+		{
+			name:  "fast-import",
+			args:  []string{"fast-import"},
+			stdin: "reset refs/heads/imported\nfrom refs/heads/main~1\n\n",
+		},
+		{name: "filter-repo", args: []string{"filter-repo", "--path", "a", "--force"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := gitRepo(t, []string{"a", "1", "b", "1"}, []string{"a", "2"})
+			if tt.setup != nil {
+				tt.setup(t, dir)
+			}
+
+			want := gitCmd(t, dir, "for-each-ref")
+
+			log := filepath.Join(t.TempDir(), "log")
+			writeHook(t, dir, "reference-transaction", `echo "$1" >>"`+log+`"
+test "$1" != prepared
+`)
+
+			res := gogitStdin(t, dir, tt.stdin, tt.args...)
+			if res.code == 0 {
+				t.Errorf("%v succeeded though the hook refused its updates", tt.args)
+			}
+
+			if got := gitCmd(t, dir, "for-each-ref"); got != want {
+				t.Errorf("%v updated the references:\n%s\nwant:\n%s", tt.args, got, want)
+			}
+
+			if got := readFile(t, log); got != "prepared\naborted\n" {
+				t.Errorf("reference-transaction hook ran in states %q", got)
+			}
+		})
+	}
+}
+
+func TestReferenceTransactionStates(t *testing.T) {
+	for _, args := range [][]string{
+		{"notes", "add", "-m", "note"},
+		{"update-ref", "refs/heads/topic", "HEAD~1"},
+	} {
+		var logs []string
+
+		for _, tool := range []string{"git", os.Args[0]} {
+			dir := gitRepo(t, []string{"a", "1"}, []string{"a", "2"})
+
+			log := filepath.Join(t.TempDir(), "log")
+			writeHook(t, dir, "reference-transaction", `echo "$1" >>"`+log+`"; cat >>"`+log+`"`)
+
+			res := run(t, dir, "", tool, args...)
+			if res.code != 0 {
+				t.Fatalf("%s %v exited with %d: %s", tool, args, res.code, res.stderr)
+			}
+
+			// The new hashes may differ, as gogit names itself in the
+			// commits it makes, so only the states and names are compared.
+			var lines []string
+			for _, line := range strings.Split(readFile(t, log), "\n") {
+				fields := strings.Fields(line)
+				if len(fields) > 0 {
+					lines = append(lines, fields[len(fields)-1])
+				}
+			}
+
+			logs = append(logs, strings.Join(lines, "\n"))
+		}
+
+		if logs[1] != logs[0] {
+			t.Errorf("%v: reference-transaction hook got:\n%s\nwant, as with git:\n%s", args, logs[1], logs[0])
+		}
+	}
+}
+
+// logHooks installs hooks that log to log their name, arguments, directory,
+// the variables git sets for them, their standard input and the message
+// file they are given.
+func logHooks(t *testing.T, dir, log string, names ...string) {
+	t.Helper()
+
+	for _, name := range names {
+		writeHook(t, dir, name, `{
+echo "`+name+` $*"
+echo "cwd $(pwd)"
+echo "env GIT_INDEX_FILE=$GIT_INDEX_FILE GIT_EDITOR=$GIT_EDITOR GIT_PREFIX=$GIT_PREFIX GIT_REFLOG_ACTION=$GIT_REFLOG_ACTION"
+case "$1" in *COMMIT_EDITMSG) cat "$1" ;; esac
+} >>"`+log+`"
+`)
+	}
+}
+
+var hookHash = regexp.MustCompile(`\b[0-9a-f]{40}\b`)
+
+// hookLog returns the log of the hooks run in dir, with the paths under
+// dir and the hashes of its commits replaced by their names.
+func hookLog(t *testing.T, dir, log string) string {
+	t.Helper()
+
+	data := ""
+	if exists(t, filepath.Dir(log), filepath.Base(log)) {
+		data = readFile(t, log)
+	}
+
+	data = strings.ReplaceAll(data, dir, "$DIR")
+
+	return hookHash.ReplaceAllStringFunc(data, func(h string) string {
+		if res := run(t, dir, "", "git", "log", "-1", "--format=%s", h); res.code == 0 {
+			return "<" + strings.TrimSpace(res.stdout) + ">"
+		}
+
+		return h
+	})
+}
+
+// TestCommitHooks checks that commit runs the hooks git runs, with the
+// same arguments, directory, environment and message file, and follows
+// their outcome.
+func TestCommitHooks(t *testing.T) {
+	names := []string{"pre-commit", "prepare-commit-msg", "commit-msg", "post-commit"}
+
+	for _, tc := range []struct {
+		name  string
+		args  []string
+		hooks map[string]string
+	}{
+		{name: "message", args: []string{"commit", "-q", "-m", "subject", "-m", "body"}},
+		{name: "all", args: []string{"commit", "-q", "-a", "-m", "all"}},
+		{name: "file", args: []string{"commit", "-q", "-F", "msg.txt"}},
+		{name: "no verify", args: []string{"commit", "-q", "--no-verify", "-m", "unverified"}},
+		{name: "pre-commit refuses", args: []string{"commit", "-q", "-m", "refused"}, hooks: map[string]string{
+			"pre-commit": "exit 1\n",
+		}},
+		{name: "pre-commit refuses all", args: []string{"commit", "-q", "-a", "-m", "refused"}, hooks: map[string]string{
+			"pre-commit": "exit 1\n",
+		}},
+		{name: "commit-msg refuses", args: []string{"commit", "-q", "-m", "refused"}, hooks: map[string]string{
+			"commit-msg": "exit 1\n",
+		}},
+		{name: "commit-msg edits", args: []string{"commit", "-q", "-m", "edited"}, hooks: map[string]string{
+			"commit-msg": "echo 'Signed-off-by: hook' >>\"$1\"\n",
+		}},
+		{name: "prepare-commit-msg empties", args: []string{"commit", "-q", "-m", "emptied"}, hooks: map[string]string{
+			"prepare-commit-msg": ": >\"$1\"\n",
+		}},
+		{name: "pre-commit stages", args: []string{"commit", "-q", "-m", "staged by hook"}, hooks: map[string]string{
+			"pre-commit": "echo hook >b && git add b\n",
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var states []string
+
+			for _, tool := range []string{"git", "gogit"} {
+				dir := gitRepo(t, []string{"a", "1", "b", "1"})
+				log := filepath.Join(t.TempDir(), "log")
+
+				logHooks(t, dir, log, names...)
+
+				for name, body := range tc.hooks {
+					writeHook(t, dir, name, body)
+				}
+
+				writeFile(t, dir, "a", "2")
+				writeFile(t, dir, "msg.txt", "from a file\n")
+				gitCmd(t, dir, "add", "a")
+				writeFile(t, dir, "a", "3")
+
+				var res result
+				if tool == "git" {
+					res = run(t, dir, "", "git", tc.args...)
+				} else {
+					res = gogit(t, dir, tc.args...)
+				}
+
+				states = append(states, "exit "+strconv.Itoa(res.code)+"\n"+hookLog(t, dir, log)+
+					gitCmd(t, dir, "log", "--format=%s%n%b", "-1")+gitCmd(t, dir, "status", "--short"))
+			}
+
+			if states[1] != states[0] {
+				t.Errorf("gogit %v gave:\n%s\nwant, as git:\n%s", tc.args, states[1], states[0])
+			}
+		})
+	}
+}
+
+// TestCheckoutHooks checks that post-checkout and post-merge run as git
+// runs them after checkout, worktree add and pull.
+func TestCheckoutHooks(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		args  []string
+		setup func(t *testing.T, dir string)
+	}{
+		{name: "branch", args: []string{"checkout", "other"}},
+		{name: "new branch", args: []string{"checkout", "-b", "topic"}},
+		{name: "detach", args: []string{"checkout", "--detach", "HEAD~1"}},
+		{name: "worktree", args: []string{"worktree", "add", "../wt"}},
+		{name: "pull", args: []string{"pull"}, setup: func(t *testing.T, dir string) {
+			origin := filepath.Join(filepath.Dir(dir), "origin")
+			gitCmd(t, "", "clone", "-q", dir, origin)
+			writeFile(t, origin, "c", "1")
+			gitCmd(t, origin, "add", "c")
+			gitCmd(t, origin, "commit", "-q", "-m", "upstream")
+			gitCmd(t, dir, "remote", "add", "origin", origin)
+			gitCmd(t, dir, "config", "branch.main.remote", "origin")
+			gitCmd(t, dir, "config", "branch.main.merge", "refs/heads/main")
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var states []string
+
+			for _, tool := range []string{"git", "gogit"} {
+				dir := filepath.Join(t.TempDir(), "repo")
+				gitCmd(t, "", "init", "-q", "-b", "main", dir)
+				writeFile(t, dir, "a", "1")
+				gitCmd(t, dir, "add", "a")
+				gitCmd(t, dir, "commit", "-q", "-m", "first")
+				writeFile(t, dir, "a", "2")
+				gitCmd(t, dir, "commit", "-q", "-a", "-m", "second")
+				gitCmd(t, dir, "branch", "other", "HEAD~1")
+
+				if tc.setup != nil {
+					tc.setup(t, dir)
+				}
+
+				log := filepath.Join(t.TempDir(), "log")
+				logHooks(t, dir, log, "post-checkout", "post-merge")
+
+				var res result
+				if tool == "git" {
+					res = run(t, dir, "", "git", tc.args...)
+				} else {
+					res = gogit(t, dir, tc.args...)
+				}
+
+				states = append(states, "exit "+strconv.Itoa(res.code)+"\n"+
+					strings.ReplaceAll(hookLog(t, dir, log), filepath.Dir(dir), "$TMP"))
+			}
+
+			if states[1] != states[0] {
+				t.Errorf("gogit %v gave:\n%s\nwant, as git:\n%s", tc.args, states[1], states[0])
+			}
+		})
+	}
+}
+
+// TestPrePushHookAsGit checks that pre-push is given the remote and the
+// ref updates git gives it, for created, updated and deleted branches.
+func TestPrePushHookAsGit(t *testing.T) {
+	for _, args := range [][]string{
+		{"push", "origin", "main"},
+		{"push", "origin", "topic"},
+		{"push", "origin", "main:other"},
+		{"push", "origin", ":gone"},
+	} {
+		var logs []string
+
+		for _, tool := range []string{"git", "gogit"} {
+			dir := gitRepo(t, []string{"a", "1"}, []string{"a", "2"})
+			gitCmd(t, dir, "branch", "topic", "HEAD~1")
+
+			remote := filepath.Join(t.TempDir(), "origin.git")
+			gitCmd(t, "", "clone", "-q", "--bare", dir, remote)
+			base := strings.TrimSpace(gitCmd(t, dir, "rev-parse", "HEAD~1"))
+			gitCmd(t, remote, "update-ref", "refs/heads/main", base)
+			gitCmd(t, remote, "update-ref", "refs/heads/gone", base)
+			gitCmd(t, dir, "remote", "add", "origin", remote)
+
+			log := filepath.Join(t.TempDir(), "log")
+			writeHook(t, dir, "pre-push", `echo "$1 $2" >>"`+log+`"; cat >>"`+log+`"`)
+
+			var res result
+			if tool == "git" {
+				res = run(t, dir, "", "git", args...)
+			} else {
+				res = gogit(t, dir, args...)
+			}
+
+			logs = append(logs, "exit "+strconv.Itoa(res.code)+"\n"+
+				strings.ReplaceAll(hookLog(t, dir, log), remote, "$REMOTE")+gitCmd(t, remote, "for-each-ref", "--format=%(refname) %(subject)"))
+		}
+
+		if logs[1] != logs[0] {
+			t.Errorf("gogit %v gave:\n%s\nwant, as git:\n%s", args, logs[1], logs[0])
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing/format/gitignore"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+)
+
+const gitignoreFile = ".gitignore"
+
+// ignoreRule is a gitignore pattern, with where it comes from.
+type ignoreRule struct {
+	pattern gitignore.Pattern
+	text    string
+	src     string
+	line    int
+}
+
+// negative reports whether the rule re-includes the paths it matches.
+func (r *ignoreRule) negative() bool {
+	return strings.HasPrefix(r.text, "!")
+}
+
+// ignoreRules are the standard ignore rules of a worktree, by increasing
+// priority: core.excludesFile, $GIT_DIR/info/exclude and the .gitignore
+// files, the deeper ones last. It is a gitignore.Matcher: like go-git's,
+// the last pattern matching a path decides whether it is ignored.
+type ignoreRules []*ignoreRule
+
+// standardIgnoreRules reads the standard ignore rules of the worktree.
+// Like git, the .gitignore files of ignored directories are not read.
+func standardIgnoreRules(r *git.Repository, w *git.Worktree) (ignoreRules, error) {
+	var rules ignoreRules
+
+	if excludes := excludesFile(r); excludes != "" {
+		data, err := os.ReadFile(excludes)
+		if err == nil {
+			rules = append(rules, parseIgnoreRules(data, excludes, nil)...)
+		}
+	}
+
+	if store, ok := r.Storer.(*filesystem.Storage); ok {
+		data, err := util.ReadFile(store.Filesystem(), "info/exclude")
+		if err == nil {
+			src := filepath.Join(store.Filesystem().Root(), "info", "exclude")
+			if rel, err := filepath.Rel(w.Filesystem.Root(), src); err == nil && !strings.HasPrefix(rel, "..") {
+				src = rel
+			}
+
+			rules = append(rules, parseIgnoreRules(data, filepath.ToSlash(src), nil)...)
+		}
+	}
+
+	rules, err := rules.readGitignores(w.Filesystem, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ignore patterns: %w", err)
+	}
+
+	for _, p := range w.Excludes {
+		rules = append(rules, &ignoreRule{pattern: p})
+	}
+
+	return rules, nil
+}
+
+// readGitignores adds the rules of the .gitignore files of dir and of the
+// directories below it that are not ignored.
+func (rs ignoreRules) readGitignores(fs billy.Filesystem, dir []string) (ignoreRules, error) {
+	name := path.Join(append(append([]string(nil), dir...), gitignoreFile)...)
+
+	data, err := util.ReadFile(fs, name)
+	if err == nil {
+		rs = append(rs, parseIgnoreRules(data, name, dir)...)
+	}
+
+	entries, err := fs.ReadDir(path.Join(dir...))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return rs, nil
+		}
+
+		return rs, err
+	}
+
+	for _, e := range entries {
+		sub := append(append([]string(nil), dir...), e.Name())
+		if !e.IsDir() || e.Name() == git.GitDirName || rs.Match(sub, true) {
+			continue
+		}
+
+		rs, err = rs.readGitignores(fs, sub)
+		if err != nil {
+			return rs, err
+		}
+	}
+
+	return rs, nil
+}
+
+// Match reports whether the path, split in its elements, is ignored.
+func (rs ignoreRules) Match(parts []string, isDir bool) bool {
+	rule := rs.lookup(parts, isDir)
+
+	return rule != nil && !rule.negative()
+}
+
+// lookup returns the rule deciding whether the path is ignored, the last
+// one matching it, if any.
+func (rs ignoreRules) lookup(parts []string, isDir bool) *ignoreRule {
+	for i := len(rs) - 1; i >= 0; i-- {
+		if rs[i].pattern.Match(parts, isDir) != gitignore.NoMatch {
+			return rs[i]
+		}
+	}
+
+	return nil
+}
+
+// excludesFile returns the path of the user's ignore file.
+func excludesFile(r *git.Repository) string {
+	if p := scopedConfigOption(r, "core", "", "excludesFile"); p != "" {
+		return expandHome(p)
+	}
+
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, "git", "ignore")
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(home, ".config", "git", "ignore")
+}
+
+// parseIgnoreRules reads the patterns of an ignore file, which apply below
+// the directory domain.
+func parseIgnoreRules(data []byte, src string, domain []string) ignoreRules {
+	var rules ignoreRules
+
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	for i, line := range strings.Split(string(data), "\n") {
+		line = trimIgnoreLine(strings.TrimSuffix(line, "\r"))
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		rules = append(rules, &ignoreRule{
+			pattern: gitignore.ParsePattern(line, domain),
+			text:    line,
+			src:     src,
+			line:    i + 1,
+		})
+	}
+
+	return rules
+}
+
+// trimIgnoreLine removes the trailing spaces of a line, but those escaped
+// with a backslash.
+func trimIgnoreLine(line string) string {
+	end := -1
+
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case ' ':
+			if end < 0 {
+				end = i
+			}
+		case '\\':
+			i++
+			if i == len(line) {
+				return line
+			}
+
+			end = -1
+		default:
+			end = -1
+		}
+	}
+
+	if end >= 0 {
+		return line[:end]
+	}
+
+	return line
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-billy/v6/osfs"
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/cache"
+	formatcfg "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/format/idxfile"
+	"github.com/go-git/go-git/v6/plumbing/format/packfile"
+	"github.com/go-git/go-git/v6/plumbing/format/revfile"
+	"github.com/go-git/go-git/v6/plumbing/hash"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/spf13/cobra"
+)
+
+var (
+	indexPackOutput       string
+	indexPackStdin        bool
+	indexPackFixThin      bool
+	indexPackRevIndex     bool
+	indexPackObjectFormat string
+)
+
+func init() {
+	indexPackCmd.Flags().StringVarP(&indexPackOutput, "output", "o", "", "Write the index to <index-file>")
+	indexPackCmd.Flags().BoolVarP(&indexPackStdin, "stdin", "", false, "Read the pack from the standard input")
+	indexPackCmd.Flags().BoolVarP(&indexPackFixThin, "fix-thin", "", false, "Append the delta bases missing from a thin pack")
+	indexPackCmd.Flags().BoolVarP(&indexPackRevIndex, "rev-index", "", false, "Also write a reverse index")
+	indexPackCmd.Flags().StringVarP(&indexPackObjectFormat, "object-format", "", "", "Object format of the pack, sha1 or sha256")
+	rootCmd.AddCommand(indexPackCmd)
+}
+
+var indexPackCmd = &cobra.Command{
+	Use:   "index-pack [-o <index-file>] [--rev-index] [--object-format=<format>] (<pack-file> | --stdin [--fix-thin] [<pack-file>])",
+	Short: "Build the index file of a pack",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if indexPackFixThin && !indexPackStdin {
+			return errors.New("the option '--fix-thin' requires '--stdin'")
+		}
+
+		if !indexPackStdin && len(args) == 0 {
+			return cmd.Usage()
+		}
+
+		// A repository is needed to store packs read from the standard
+		// input and to complete thin packs, and is optional otherwise.
+		r, err := git.PlainOpen(".")
+		if err != nil && (indexPackFixThin || (indexPackStdin && len(args) == 0)) {
+			return err
+		}
+
+		of, err := packObjectFormat(r, indexPackObjectFormat)
+		if err != nil {
+			return err
+		}
+
+		path := ""
+		if len(args) > 0 {
+			path = args[0]
+		}
+
+		if indexPackStdin {
+			path, err = receivePack(r, cmd.InOrStdin(), path, of)
+			if err != nil {
+				return err
+			}
+		}
+
+		idx, err := indexPackFile(path, of)
+		if err != nil {
+			return err
+		}
+
+		idxPath := indexPackOutput
+		if idxPath == "" {
+			idxPath = strings.TrimSuffix(path, ".pack") + ".idx"
+		}
+
+		err = writePackIndex(idxPath, idx, of, indexPackRevIndex)
+		if err != nil {
+			return err
+		}
+
+		if indexPackStdin {
+			fmt.Fprintf(cmd.OutOrStdout(), "pack\t%s\n", idx.PackfileChecksum)
+		} else {
+			fmt.Fprintln(cmd.OutOrStdout(), idx.PackfileChecksum)
+		}
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// packObjectFormat returns the object format named by name, or else the
+// one of the repository r, which may be nil.
+func packObjectFormat(r *git.Repository, name string) (formatcfg.ObjectFormat, error) {
+	switch formatcfg.ObjectFormat(name) {
+	case formatcfg.SHA1, formatcfg.SHA256:
+		return formatcfg.ObjectFormat(name), nil
+	case formatcfg.UnsetObjectFormat:
+	default:
+		return "", fmt.Errorf("unknown hash algorithm '%s'", name)
+	}
+
+	if r != nil {
+		cfg, err := r.Config()
+		if err != nil {
+			return "", fmt.Errorf("failed to get repository config: %w", err)
+		}
+
+		if cfg.Extensions.ObjectFormat != formatcfg.UnsetObjectFormat {
+			return cfg.Extensions.ObjectFormat, nil
+		}
+	}
+
+	return formatcfg.DefaultObjectFormat, nil
+}
+
+// objectFormatHash returns the hash function of the object format of.
+func objectFormatHash(of formatcfg.ObjectFormat) crypto.Hash {
+	if of == formatcfg.SHA256 {
+		return crypto.SHA256
+	}
+
+	return crypto.SHA1
+}
+
+// receivePack copies the pack read from in to path, or into the pack
+// directory of r when path is empty, completing it first with --fix-thin.
+// It returns the path the pack was written to.
+func receivePack(r *git.Repository, in io.Reader, path string, of formatcfg.ObjectFormat) (string, error) {
+	dir := filepath.Dir(path)
+
+	if path == "" {
+		store, ok := r.Storer.(*filesystem.Storage)
+		if !ok {
+			return "", errors.New("storer does not implement filesystem.Storage")
+		}
+
+		dir = filepath.Join(store.Filesystem().Root(), "objects", "pack")
+	}
+
+	tmp, err := os.CreateTemp(dir, "tmp_pack_")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary pack: %w", err)
+	}
+
+	defer func() {
+		err := os.Remove(tmp.Name())
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Debug("failed to remove temporary pack", "error", err)
+		}
+	}()
+
+	_, err = io.Copy(tmp, in)
+	if err == nil && indexPackFixThin {
+		err = fixThinPack(r, tmp, of)
+	}
+
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("failed to write pack: %w", err)
+	}
+
+	if path == "" {
+		idx, err := indexPackFile(tmp.Name(), of)
+		if err != nil {
+			return "", err
+		}
+
+		path = filepath.Join(dir, fmt.Sprintf("pack-%s.pack", idx.PackfileChecksum))
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return "", fmt.Errorf("failed to write pack: %w", err)
+	}
+
+	return path, nil
+}
+
+// fixThinPack appends to the pack f the objects of r its deltas are based
+// on but that it does not contain, so that it can be used on its own.
+func fixThinPack(r *git.Repository, f *os.File, of formatcfg.ObjectFormat) error {
+	_, err := f.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	// The objects of the pack are kept on disk rather than in memory while
+	// it is parsed, the deltas being resolved against them.
+	tmp, err := os.MkdirTemp(filepath.Dir(f.Name()), "tmp_objects_")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err := os.RemoveAll(tmp)
+		if err != nil {
+			slog.Debug("failed to remove temporary objects", "error", err)
+		}
+	}()
+
+	objects := filesystem.NewStorageWithOptions(osfs.New(tmp), cache.NewObjectLRUDefault(), filesystem.Options{ObjectFormat: of})
+
+	w := new(idxfile.Writer)
+	s := &overlayStorage{EncodedObjectStorer: objects, base: r.Storer}
+
+	_, err = packfile.NewParser(f,
+		packfile.WithStorage(s),
+		packfile.WithScannerObservers(w),
+		packfile.WithObjectFormat(of),
+	).Parse()
+	if err != nil {
+		return fmt.Errorf("failed to parse pack: %w", err)
+	}
+
+	idx, err := w.Index()
+	if err != nil {
+		return err
+	}
+
+	var missing []*packEntry
+
+	for _, h := range s.borrowed {
+		if ok, _ := idx.Contains(h); ok {
+			continue
+		}
+
+		e, err := readPackEntry(r, h, "")
+		if err != nil {
+			return err
+		}
+
+		missing = append(missing, e)
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	count, err := idx.Count()
+	if err != nil {
+		return err
+	}
+
+	// The bases are appended in place, the header holding the number of
+	// objects being rewritten and the checksum of it all recomputed.
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	size := stat.Size() - int64(objectFormatHash(of).Size())
+
+	_, err = f.WriteAt(packHeader(uint32(count)+uint32(len(missing))), 0)
+	if err != nil {
+		return err
+	}
+
+	err = f.Truncate(size)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	pw := newPackWriter(f, objectFormatHash(of))
+
+	_, err = io.Copy(pw.hasher, f)
+	if err != nil {
+		return err
+	}
+
+	pw.offset = size
+
+	for _, e := range missing {
+		err = pw.entry(r, e)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = pw.footer()
+
+	return err
+}
+
+// overlayStorage keeps the objects written to it apart from base, which it
+// falls back on to read the objects it does not have. The objects read from
+// base are recorded as borrowed.
+type overlayStorage struct {
+	storer.EncodedObjectStorer
+	base     storer.EncodedObjectStorer
+	borrowed []plumbing.Hash
+}
+
+func (s *overlayStorage) EncodedObject(t plumbing.ObjectType, h plumbing.Hash) (plumbing.EncodedObject, error) {
+	obj, err := s.EncodedObjectStorer.EncodedObject(t, h)
+	if !errors.Is(err, plumbing.ErrObjectNotFound) {
+		return obj, err
+	}
+
+	obj, err = s.base.EncodedObject(t, h)
+	if err == nil {
+		s.borrowed = append(s.borrowed, h)
+	}
+
+	return obj, err
+}
+
+// indexPackFile parses the pack at path and returns its index.
+func indexPackFile(path string, of formatcfg.ObjectFormat) (*idxfile.MemoryIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pack file: %w", err)
+	}
+
+	defer func() {
+		err := f.Close()
+		if err != nil {
+			slog.Debug("failed to close pack file", "error", err)
+		}
+	}()
+
+	w := new(idxfile.Writer)
+
+	_, err = packfile.NewParser(f,
+		packfile.WithScannerObservers(w),
+		packfile.WithObjectFormat(of),
+	).Parse()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse pack: %w", err)
+	}
+
+	return w.Index()
+}
+
+// writePackIndex writes idx to idxPath and, with rev, the reverse index
+// next to it.
+func writePackIndex(idxPath string, idx *idxfile.MemoryIndex, of formatcfg.ObjectFormat, rev bool) error {
+	ch := objectFormatHash(of)
+
+	err := writeFileWith(idxPath, func(w io.Writer) error {
+		return idxfile.Encode(w, hash.New(ch), idx)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write index file: %w", err)
+	}
+
+	if !rev {
+		return nil
+	}
+
+	err = writeFileWith(strings.TrimSuffix(idxPath, ".idx")+".rev", func(w io.Writer) error {
+		return revfile.Encode(w, hash.New(ch), idx)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write reverse index file: %w", err)
+	}
+
+	return nil
+}
+
+// writeFileWith creates the read-only file path with the contents written
+// by write.
+func writeFileWith(path string, write func(w io.Writer) error) error {
+	err := os.Remove(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o444)
+	if err != nil {
+		return err
+	}
+
+	err = write(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
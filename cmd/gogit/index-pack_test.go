@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// packRepo returns a repository made by git whose files change a little
+// in each commit, so that its packs hold deltas.
+func packRepo(t *testing.T) string {
+	t.Helper()
+
+	var commits [][]string
+
+	for i := range 4 {
+		var files []string
+		for j := range 20 {
+			files = append(files, fmt.Sprintf("d%d/f%02d", j%3, j), strings.Repeat("some line\n", 50)+strings.Repeat("x", i+j)+"\n")
+		}
+
+		commits = append(commits, files)
+	}
+
+	return gitRepo(t, commits...)
+}
+
+// gitPack returns the pack git makes in dir of the objects of revs, which
+// it reads with pack-objects --revs.
+func gitPack(t *testing.T, dir, revs string, args ...string) []byte {
+	t.Helper()
+
+	args = append([]string{"pack-objects", "-q", "--revs", "--stdout"}, args...)
+
+	res := run(t, dir, revs, "git", args...)
+	if res.code != 0 {
+		t.Fatalf("git %v failed: %s", args, res.stderr)
+	}
+
+	return []byte(res.stdout)
+}
+
+// TestIndexPack checks that gogit writes the index and reverse index git
+// writes for a pack made by git.
+func TestIndexPack(t *testing.T) {
+	dir := packRepo(t)
+	pack := gitPack(t, dir, "main\n")
+
+	var outputs []string
+	var files []string
+
+	for _, tool := range []string{"git", "gogit"} {
+		path := filepath.Join(t.TempDir(), "test.pack")
+
+		err := os.WriteFile(path, pack, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		args := []string{"index-pack", "--rev-index", path}
+		if tool == "git" {
+			outputs = append(outputs, gitCmd(t, dir, args...))
+		} else {
+			outputs = append(outputs, mustGogit(t, dir, args...))
+		}
+
+		base := strings.TrimSuffix(path, ".pack")
+		files = append(files, readFile(t, base+".idx"), readFile(t, base+".rev"))
+	}
+
+	if outputs[1] != outputs[0] {
+		t.Errorf("gogit index-pack printed %q, want as git %q", outputs[1], outputs[0])
+	}
+
+	if files[2] != files[0] {
+		t.Error("gogit index-pack wrote an index that differs from git's")
+	}
+
+	if files[3] != files[1] {
+		t.Error("gogit index-pack wrote a reverse index that differs from git's")
+	}
+}
+
+// TestIndexPackStdin checks that a pack read from the standard input is
+// stored in the repository, and that a thin pack is completed.
+func TestIndexPackStdin(t *testing.T) {
+	src := packRepo(t)
+
+	dir := filepath.Join(t.TempDir(), "clone")
+	gitCmd(t, "", "clone", "-q", "--no-local", src, dir)
+
+	writeFile(t, src, "d1/f01", strings.Repeat("some line\n", 50)+"changed\n")
+	gitCmd(t, src, "commit", "-q", "-a", "-m", "thin")
+
+	thin := gitPack(t, src, "main\n^main~1\n", "--thin")
+
+	if res := gogitStdin(t, dir, string(thin), "index-pack", "--stdin"); res.code == 0 {
+		t.Error("gogit index-pack --stdin accepted a thin pack without --fix-thin")
+	}
+
+	res := gogitStdin(t, dir, string(thin), "index-pack", "--stdin", "--fix-thin")
+	if res.code != 0 {
+		t.Fatalf("gogit index-pack --stdin --fix-thin failed: %s", res.stderr)
+	}
+
+	if !strings.HasPrefix(res.stdout, "pack\t") {
+		t.Errorf("gogit index-pack --stdin printed %q", res.stdout)
+	}
+
+	gitCmd(t, dir, "update-ref", "refs/heads/main", gitCmd(t, src, "rev-parse", "main")[:40])
+	gitCmd(t, dir, "fsck", "--strict")
+
+	for _, idx := range globPacks(t, dir, "*.idx") {
+		gitCmd(t, dir, "verify-pack", idx)
+	}
+}
+
+// globPacks returns the files of the packs of dir that match pattern.
+func globPacks(t *testing.T, dir, pattern string) []string {
+	t.Helper()
+
+	files, err := filepath.Glob(filepath.Join(dir, ".git", "objects", "pack", pattern))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return files
+}
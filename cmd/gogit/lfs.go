@@ -0,0 +1,861 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/spf13/cobra"
+)
+
+var (
+	lfsPushDryRun      bool
+	lfsPushAll         bool
+	lfsLsFilesLong     bool
+	lfsLsFilesSize     bool
+	lfsLsFilesNameOnly bool
+	lfsPointerFile     string
+	lfsPointerPointer  string
+	lfsPointerStdin    bool
+	lfsPointerCheck    bool
+	lfsPruneDryRun     bool
+	lfsPruneVerbose    bool
+)
+
+func init() {
+	lfsPushCmd.Flags().BoolVarP(&lfsPushDryRun, "dry-run", "", false, "Only list the objects that would be pushed")
+	lfsPushCmd.Flags().BoolVarP(&lfsPushAll, "all", "", false, "Push the objects of all the local branches and tags")
+	lfsLsFilesCmd.Flags().BoolVarP(&lfsLsFilesLong, "long", "l", false, "Show the full object IDs")
+	lfsLsFilesCmd.Flags().BoolVarP(&lfsLsFilesSize, "size", "s", false, "Show the size of the objects")
+	lfsLsFilesCmd.Flags().BoolVarP(&lfsLsFilesNameOnly, "name-only", "n", false, "Show only the paths of the files")
+	lfsPointerCmd.Flags().StringVarP(&lfsPointerFile, "file", "f", "", "Build the pointer of a file")
+	lfsPointerCmd.Flags().StringVarP(&lfsPointerPointer, "pointer", "p", "", "Read a pointer from a file, to compare it with the built one")
+	lfsPointerCmd.Flags().BoolVarP(&lfsPointerStdin, "stdin", "", false, "Read a pointer from the standard input")
+	lfsPointerCmd.Flags().BoolVarP(&lfsPointerCheck, "check", "", false, "Only check whether the file or standard input is a pointer")
+	lfsPruneCmd.Flags().BoolVarP(&lfsPruneDryRun, "dry-run", "d", false, "Only report what would be pruned")
+	lfsPruneCmd.Flags().BoolVarP(&lfsPruneVerbose, "verbose", "v", false, "List the objects pruned")
+
+	lfsCmd.AddCommand(lfsTrackCmd)
+	lfsCmd.AddCommand(lfsUntrackCmd)
+	lfsCmd.AddCommand(lfsFetchCmd)
+	lfsCmd.AddCommand(lfsPullCmd)
+	lfsCmd.AddCommand(lfsPushCmd)
+	lfsCmd.AddCommand(lfsLsFilesCmd)
+	lfsCmd.AddCommand(lfsPointerCmd)
+	lfsCmd.AddCommand(lfsPruneCmd)
+	rootCmd.AddCommand(lfsCmd)
+}
+
+var lfsCmd = &cobra.Command{
+	Use:   "lfs <command>",
+	Short: "Work with Git LFS files",
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		return cmd.Usage()
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var lfsTrackCmd = &cobra.Command{
+	Use:   "track [<pattern>...]",
+	Short: "Store the files matching patterns with Git LFS, or list the patterns",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		w, err := r.Worktree()
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+
+		if len(args) == 0 {
+			return listLFSPatterns(r, out)
+		}
+
+		data, err := util.ReadFile(w.Filesystem, gitattributesFile)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to read %s: %w", gitattributesFile, err)
+		}
+
+		lines := string(data)
+		if lines != "" && !strings.HasSuffix(lines, "\n") {
+			lines += "\n"
+		}
+
+		for _, arg := range args {
+			pattern := escapeLFSPattern(arg)
+			if lfsTrackLine(lines, pattern) >= 0 {
+				fmt.Fprintf(out, "%q already supported\n", arg)
+
+				continue
+			}
+
+			lines += pattern + " filter=lfs diff=lfs merge=lfs -text\n"
+
+			fmt.Fprintf(out, "Tracking %q\n", arg)
+		}
+
+		return util.WriteFile(w.Filesystem, gitattributesFile, []byte(lines), 0o644)
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var lfsUntrackCmd = &cobra.Command{
+	Use:   "untrack <pattern>...",
+	Short: "Stop storing the files matching patterns with Git LFS",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		w, err := r.Worktree()
+		if err != nil {
+			return err
+		}
+
+		data, err := util.ReadFile(w.Filesystem, gitattributesFile)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", gitattributesFile, err)
+		}
+
+		lines := strings.SplitAfter(string(data), "\n")
+
+		for _, arg := range args {
+			pattern := escapeLFSPattern(arg)
+
+			for i := 0; i < len(lines); i++ {
+				if lfsTrackLine(lines[i], pattern) < 0 {
+					continue
+				}
+
+				lines = append(lines[:i], lines[i+1:]...)
+				i--
+
+				fmt.Fprintf(cmd.OutOrStdout(), "Untracking %q\n", arg)
+			}
+		}
+
+		return util.WriteFile(w.Filesystem, gitattributesFile, []byte(strings.Join(lines, "")), 0o644)
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var lfsFetchCmd = &cobra.Command{
+	Use:   "fetch [<remote> [<ref>...]]",
+	Short: "Download the Git LFS objects of refs",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		return lfsFetch(r, args, cmd.ErrOrStderr())
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var lfsPullCmd = &cobra.Command{
+	Use:   "pull [<remote> [<ref>...]]",
+	Short: "Download the Git LFS objects of refs and check out the files",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		err = lfsFetch(r, args, cmd.ErrOrStderr())
+		if err != nil {
+			return err
+		}
+
+		return smudgeWorktree(r, cmd.ErrOrStderr(), nil)
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var lfsPushCmd = &cobra.Command{
+	Use:   "push [--dry-run] [--all] <remote> [<ref>...]",
+	Short: "Upload the Git LFS objects of refs the remote does not have",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		remote, refs := args[0], args[1:]
+
+		files, err := unpushedLFSFiles(r, remote, refs)
+		if err != nil {
+			return err
+		}
+
+		if lfsPushDryRun {
+			for _, f := range files {
+				fmt.Fprintf(cmd.OutOrStdout(), "push %s => %s\n", f.pointer.oid, f.path)
+			}
+
+			return nil
+		}
+
+		ep, err := lfsRemoteEndpoint(r, remote)
+		if err != nil {
+			return err
+		}
+
+		store, err := openLFSStore(r)
+		if err != nil {
+			return err
+		}
+
+		var ref plumbing.ReferenceName
+		if len(refs) == 1 {
+			ref, _ = resolveRefName(r, refs[0])
+		} else if len(refs) == 0 {
+			ref, _ = currentBranch(r)
+		}
+
+		n, err := ep.upload(store, lfsPointers(files), ref)
+		if err != nil {
+			return err
+		}
+
+		if n > 0 {
+			fmt.Fprintf(cmd.ErrOrStderr(), "Uploading LFS objects: 100%% (%d/%d), done.\n", n, n)
+		}
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var lfsLsFilesCmd = &cobra.Command{
+	Use:   "ls-files [-l] [-s] [-n] [<ref>]",
+	Short: "Show the Git LFS files of a tree",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		rev := plumbing.HEAD.String()
+		if len(args) > 0 {
+			rev = args[0]
+		}
+
+		h, err := resolveObject(r, rev)
+		if err != nil {
+			return err
+		}
+
+		files, err := newLFSScanner(r).tree(h)
+		if err != nil {
+			return err
+		}
+
+		w, _ := r.Worktree()
+		out := cmd.OutOrStdout()
+
+		for _, f := range files {
+			if lfsLsFilesNameOnly {
+				fmt.Fprintln(out, f.path)
+
+				continue
+			}
+
+			oid := f.pointer.oid
+			if !lfsLsFilesLong {
+				oid = oid[:10]
+			}
+
+			// A minus tells the file is checked out as its pointer.
+			mark := "*"
+			if w == nil || isLFSPointerFile(w.Filesystem, f.path) {
+				mark = "-"
+			}
+
+			if lfsLsFilesSize {
+				fmt.Fprintf(out, "%s %s %s (%s)\n", oid, mark, f.path, humanSize(f.pointer.size))
+			} else {
+				fmt.Fprintf(out, "%s %s %s\n", oid, mark, f.path)
+			}
+		}
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var lfsPointerCmd = &cobra.Command{
+	Use:   "pointer [--file=<path>] [--pointer=<path> | --stdin] [--check]",
+	Short: "Build, compare or check Git LFS pointers",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		if lfsPointerPointer != "" && lfsPointerStdin {
+			return errors.New("cannot read a pointer from both a file and the standard input")
+		}
+
+		var pointer io.Reader
+
+		pointerName := lfsPointerPointer
+
+		switch {
+		case lfsPointerStdin:
+			pointer, pointerName = cmd.InOrStdin(), "STDIN"
+		case lfsPointerPointer != "":
+			f, err := os.Open(lfsPointerPointer)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			pointer = f
+		}
+
+		if lfsPointerCheck {
+			return checkLFSPointer(cmd, pointer)
+		}
+
+		if lfsPointerFile == "" && pointer == nil {
+			return errors.New("nothing to do: give a file, a pointer or both")
+		}
+
+		stdout, stderr := cmd.OutOrStdout(), cmd.ErrOrStderr()
+
+		var built string
+
+		if lfsPointerFile != "" {
+			f, err := os.Open(lfsPointerFile)
+			if err != nil {
+				return err
+			}
+
+			p, err := hashLFSObject(f)
+			_ = f.Close()
+
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", lfsPointerFile, err)
+			}
+
+			built = p.String()
+
+			fmt.Fprintf(stderr, "Git LFS pointer for %s\n\n", lfsPointerFile)
+			fmt.Fprint(stdout, built)
+		}
+
+		if pointer == nil {
+			return nil
+		}
+
+		data, err := io.ReadAll(pointer)
+		if err != nil {
+			return err
+		}
+
+		if lfsPointerFile != "" {
+			fmt.Fprintln(stderr)
+		}
+
+		fmt.Fprintf(stderr, "Pointer from %s\n\n", pointerName)
+		fmt.Fprint(stdout, string(data))
+
+		if _, ok := parseLFSPointer(data); !ok {
+			return fmt.Errorf("%s is not a valid pointer", pointerName)
+		}
+
+		if lfsPointerFile != "" && built != string(data) {
+			fmt.Fprintln(stderr, "\nPointers do not match")
+
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+
+			return exitStatus(1)
+		}
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var lfsPruneCmd = &cobra.Command{
+	Use:   "prune [--dry-run] [--verbose]",
+	Short: "Delete the local Git LFS objects no longer needed",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		store, err := openLFSStore(r)
+		if err != nil {
+			return err
+		}
+
+		objects, err := store.objects()
+		if err != nil {
+			return fmt.Errorf("failed to list LFS objects: %w", err)
+		}
+
+		retained, err := retainedLFSObjects(r)
+		if err != nil {
+			return err
+		}
+
+		var (
+			prune []lfsPointer
+			size  int64
+		)
+
+		for _, p := range objects {
+			if !retained[p.oid] {
+				prune = append(prune, p)
+				size += p.size
+			}
+		}
+
+		out := cmd.OutOrStdout()
+		fmt.Fprintf(out, "prune: %d local object(s), %d retained, done.\n", len(objects), len(objects)-len(prune))
+
+		if len(prune) == 0 {
+			return nil
+		}
+
+		if lfsPruneVerbose {
+			for _, p := range prune {
+				fmt.Fprintf(out, " * %s (%s)\n", p.oid, humanSize(p.size))
+			}
+		}
+
+		if lfsPruneDryRun {
+			fmt.Fprintf(out, "prune: %d file(s) would be pruned (%s)\n", len(prune), humanSize(size))
+
+			return nil
+		}
+
+		for _, p := range prune {
+			err := store.remove(p)
+			if err != nil {
+				return fmt.Errorf("failed to delete LFS object %s: %w", p.oid, err)
+			}
+		}
+
+		fmt.Fprintf(out, "prune: Deleting objects: 100%% (%d/%d), done.\n", len(prune), len(prune))
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// escapeLFSPattern escapes a pattern for a gitattributes file the way git
+// lfs track does.
+func escapeLFSPattern(pattern string) string {
+	pattern = strings.ReplaceAll(pattern, " ", "[[:space:]]")
+	if strings.HasPrefix(pattern, "#") {
+		pattern = `\` + pattern
+	}
+
+	return pattern
+}
+
+// lfsTrackLine returns the index of the line of a gitattributes file that
+// stores the files matching a pattern with Git LFS, or -1.
+func lfsTrackLine(lines, pattern string) int {
+	i := 0
+
+	for _, line := range strings.SplitAfter(lines, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 1 && fields[0] == pattern && lfsFiltered(fields[1:]) {
+			return i
+		}
+
+		i += len(line)
+	}
+
+	return -1
+}
+
+func lfsFiltered(states []string) bool {
+	for _, s := range states {
+		if s == "filter=lfs" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// listLFSPatterns lists the patterns of the gitattributes files of the
+// worktree that store files with Git LFS, and those excluded from it.
+func listLFSPatterns(r *git.Repository, out io.Writer) error {
+	w, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return fmt.Errorf("failed to read index: %w", err)
+	}
+
+	names := []string{gitattributesFile}
+
+	for _, e := range idx.Entries {
+		if e.Stage == 0 && e.Name != gitattributesFile && strings.HasSuffix(e.Name, "/"+gitattributesFile) {
+			names = append(names, e.Name)
+		}
+	}
+
+	var tracked, excluded []string
+
+	for _, name := range names {
+		data, err := util.ReadFile(w.Filesystem, name)
+		if err != nil {
+			continue
+		}
+
+		for i, line := range strings.Split(string(data), "\n") {
+			rule, _ := parseAttrLine(line, "", true, name, i+1)
+			if rule == nil || rule.pattern == nil {
+				continue
+			}
+
+			for _, s := range rule.states {
+				if s.name != "filter" {
+					continue
+				}
+
+				entry := fmt.Sprintf("    %s (%s)", rule.pattern, name)
+
+				switch s.value {
+				case "lfs":
+					tracked = append(tracked, entry)
+				case attrUnset, attrUnspecified:
+					excluded = append(excluded, entry)
+				}
+			}
+		}
+	}
+
+	fmt.Fprintln(out, "Listing tracked patterns")
+
+	for _, entry := range tracked {
+		fmt.Fprintln(out, entry)
+	}
+
+	fmt.Fprintln(out, "Listing excluded patterns")
+
+	for _, entry := range excluded {
+		fmt.Fprintln(out, entry)
+	}
+
+	return nil
+}
+
+// lfsFetch downloads the objects of the pointer files in the trees of
+// refs, HEAD by default, from a remote, the default one by default.
+func lfsFetch(r *git.Repository, args []string, out io.Writer) error {
+	remote := lfsDefaultRemote(r)
+	if len(args) > 0 {
+		remote, args = args[0], args[1:]
+	}
+
+	if len(args) == 0 {
+		args = []string{plumbing.HEAD.String()}
+	}
+
+	ep, err := lfsRemoteEndpoint(r, remote)
+	if err != nil {
+		return err
+	}
+
+	store, err := openLFSStore(r)
+	if err != nil {
+		return err
+	}
+
+	s := newLFSScanner(r)
+
+	var (
+		files []lfsFile
+		ref   plumbing.ReferenceName
+	)
+
+	for _, rev := range args {
+		h, err := resolveRevision(r, rev)
+		if err != nil {
+			return err
+		}
+
+		name, ok := resolveRefName(r, rev)
+		if !ok {
+			name = plumbing.ReferenceName(rev)
+		} else if ref == "" {
+			ref = name
+		}
+
+		fmt.Fprintf(out, "fetch: Fetching reference %s\n", name)
+
+		tree, err := s.tree(h)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, tree...)
+	}
+
+	n, err := ep.download(store, lfsPointers(files), ref)
+	if err != nil {
+		return err
+	}
+
+	if n > 0 {
+		fmt.Fprintf(out, "Downloading LFS objects: 100%% (%d/%d), done.\n", n, n)
+	}
+
+	return nil
+}
+
+// unpushedLFSFiles returns the pointer files of the commits reachable from
+// refs, the current branch by default, but not from the remote-tracking
+// branches of a remote, one per object. The objects of the trees of those
+// branches are taken as pushed already. With --all, those of all the local
+// branches and tags are returned.
+func unpushedLFSFiles(r *git.Repository, remote string, refs []string) ([]lfsFile, error) {
+	w := &revWalk{r: r}
+
+	if lfsPushAll {
+		all, err := sortedReferences(r)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ref := range all {
+			if ref.Name().IsBranch() || ref.Name().IsTag() {
+				w.tips = append(w.tips, revTip{hash: ref.Hash(), name: ref.Name().String()})
+			}
+		}
+	} else {
+		if len(refs) == 0 {
+			branch, err := currentBranch(r)
+			if err != nil {
+				return nil, err
+			}
+
+			refs = []string{branch.String()}
+		}
+
+		for _, ref := range refs {
+			err := w.addTip(ref)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		tracking, err := sortedReferences(r)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ref := range tracking {
+			if strings.HasPrefix(ref.Name().String(), "refs/remotes/"+remote+"/") && ref.Type() == plumbing.HashReference {
+				w.negatives = append(w.negatives, ref.Hash())
+			}
+		}
+	}
+
+	commits, _, err := w.walk()
+	if err != nil {
+		return nil, err
+	}
+
+	s := newLFSScanner(r)
+	seen := make(map[string]bool)
+
+	for _, h := range w.negatives {
+		tree, err := s.tree(h)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range tree {
+			seen[f.pointer.oid] = true
+		}
+	}
+
+	var files []lfsFile
+
+	for _, c := range commits {
+		tree, err := s.tree(c.Hash)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, f := range tree {
+			if !seen[f.pointer.oid] {
+				seen[f.pointer.oid] = true
+				files = append(files, f)
+			}
+		}
+	}
+
+	return files, nil
+}
+
+// retainedLFSObjects returns the OIDs of the objects git lfs prune keeps:
+// those of HEAD, of the tips of the local branches and tags, of the index
+// and of the commits not pushed to any remote.
+func retainedLFSObjects(r *git.Repository) (map[string]bool, error) {
+	s := newLFSScanner(r)
+	retained := make(map[string]bool)
+
+	retain := func(h plumbing.Hash) error {
+		files, err := s.tree(h)
+		for _, f := range files {
+			retained[f.pointer.oid] = true
+		}
+
+		return err
+	}
+
+	if head, err := r.Head(); err == nil {
+		err := retain(head.Hash())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	refs, err := sortedReferences(r)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &revWalk{r: r}
+
+	for _, ref := range refs {
+		switch {
+		case ref.Type() != plumbing.HashReference:
+		case ref.Name().IsRemote():
+			w.negatives = append(w.negatives, ref.Hash())
+		case ref.Name().IsBranch() || ref.Name().IsTag():
+			w.tips = append(w.tips, revTip{hash: ref.Hash(), name: ref.Name().String()})
+
+			err := retain(ref.Hash())
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	unpushed, _, err := w.walk()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range unpushed {
+		err := retain(c.Hash)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index: %w", err)
+	}
+
+	for _, e := range idx.Entries {
+		blob, err := r.BlobObject(e.Hash)
+		if err != nil {
+			continue
+		}
+
+		p, err := s.blob(e.Hash, blob.Size)
+		if err != nil {
+			return nil, err
+		}
+
+		if p != nil {
+			retained[p.oid] = true
+		}
+	}
+
+	return retained, nil
+}
+
+func lfsPointers(files []lfsFile) []lfsPointer {
+	pointers := make([]lfsPointer, 0, len(files))
+	for _, f := range files {
+		pointers = append(pointers, f.pointer)
+	}
+
+	sort.Slice(pointers, func(i, j int) bool { return pointers[i].oid < pointers[j].oid })
+
+	return pointers
+}
+
+// isLFSPointerFile reports whether a file of the worktree holds a pointer,
+// or is missing.
+func isLFSPointerFile(fs billy.Filesystem, name string) bool {
+	fi, err := fs.Lstat(name)
+	if err != nil {
+		return true
+	}
+
+	if fi.Size() >= lfsMaxPointerSize {
+		return false
+	}
+
+	data, err := util.ReadFile(fs, name)
+	if err != nil {
+		return false
+	}
+
+	_, ok := parseLFSPointer(data)
+
+	return ok
+}
+
+// checkLFSPointer exits with a status of 0 if the file or standard input
+// holds a pointer, 1 if it does not.
+func checkLFSPointer(cmd *cobra.Command, pointer io.Reader) error {
+	switch {
+	case lfsPointerFile != "" && pointer != nil, lfsPointerFile == "" && pointer == nil:
+		return errors.New("--check needs either --file or --stdin")
+	case lfsPointerFile != "":
+		f, err := os.Open(lfsPointerFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		pointer = f
+	}
+
+	data, err := io.ReadAll(io.LimitReader(pointer, lfsMaxPointerSize))
+	if err != nil {
+		return err
+	}
+
+	if _, ok := parseLFSPointer(data); !ok {
+		cmd.SilenceErrors = true
+		cmd.SilenceUsage = true
+
+		return exitStatus(1)
+	}
+
+	return nil
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// lfsPointerText returns the Git LFS pointer of contents, as the
+// specification has it.
+func lfsPointerText(contents string) string {
+	return fmt.Sprintf("version https://git-lfs.github.com/spec/v1\noid sha256:%x\nsize %d\n", sha256.Sum256([]byte(contents)), len(contents))
+}
+
+// lfsOid returns the Git LFS object ID of contents.
+func lfsOid(contents string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(contents)))
+}
+
+// lfsRepo returns a repository made by git with the pointer files of
+// a.bin and d/b.bin committed on main, and of c.bin on the branch other,
+// configured as git lfs install does. Their objects are on s, the server
+// of its origin remote. git-lfs need not be installed: git only commits
+// the pointers, before the filter is configured.
+func lfsRepo(t *testing.T, s *lfsTestServer) string {
+	t.Helper()
+
+	dir := gitRepo(t, []string{
+		".gitattributes", "*.bin filter=lfs diff=lfs merge=lfs -text\n",
+		"a.bin", lfsPointerText("a contents\x00"),
+		"d/b.bin", lfsPointerText("b contents\x00"),
+		"plain", "text\n",
+	})
+
+	gitCmd(t, dir, "checkout", "-q", "-b", "other")
+	writeFile(t, dir, "c.bin", lfsPointerText("c contents\x00"))
+	gitCmd(t, dir, "add", "c.bin")
+	gitCmd(t, dir, "commit", "-q", "-m", "add c.bin")
+	gitCmd(t, dir, "checkout", "-q", "main")
+
+	for _, kv := range [][]string{
+		{"filter.lfs.clean", "git-lfs clean -- %f"},
+		{"filter.lfs.smudge", "git-lfs smudge -- %f"},
+		{"filter.lfs.process", "git-lfs filter-process"},
+		{"filter.lfs.required", "true"},
+		{"remote.origin.url", s.URL + "/repo"},
+		{"remote.origin.fetch", "+refs/heads/*:refs/remotes/origin/*"},
+	} {
+		gitCmd(t, dir, "config", kv[0], kv[1])
+	}
+
+	for _, contents := range []string{"a contents\x00", "b contents\x00", "c contents\x00"} {
+		s.objects[lfsOid(contents)] = []byte(contents)
+	}
+
+	return dir
+}
+
+// hasLFSObject reports whether the Git LFS store of dir holds the object
+// of contents.
+func hasLFSObject(t *testing.T, dir, contents string) bool {
+	t.Helper()
+
+	oid := lfsOid(contents)
+
+	return exists(t, dir, filepath.Join(".git", "lfs", "objects", oid[:2], oid[2:4], oid))
+}
+
+// TestLFSPull checks that the pointer files git checked out are replaced
+// by their contents, and that the index keeps the pointers git committed.
+func TestLFSPull(t *testing.T) {
+	s := newLFSTestServer(t)
+	dir := lfsRepo(t, s)
+	staged := gitCmd(t, dir, "ls-files", "-s")
+
+	want := fmt.Sprintf("%s - a.bin\n%s - d/b.bin\n", lfsOid("a contents\x00")[:10], lfsOid("b contents\x00")[:10])
+	if got := mustGogit(t, dir, "lfs", "ls-files"); got != want {
+		t.Errorf("lfs ls-files listed before pull:\n%s\nwant:\n%s", got, want)
+	}
+
+	mustGogit(t, dir, "lfs", "pull")
+
+	for name, want := range map[string]string{"a.bin": "a contents\x00", "d/b.bin": "b contents\x00", "plain": "text\n"} {
+		if got := readFile(t, filepath.Join(dir, name)); got != want {
+			t.Errorf("lfs pull left %s with %q, want %q", name, got, want)
+		}
+	}
+
+	if got := gitCmd(t, dir, "ls-files", "-s"); got != staged {
+		t.Errorf("lfs pull changed the index git wrote:\n%s\nwant:\n%s", got, staged)
+	}
+
+	want = fmt.Sprintf("%s * a.bin (11 bytes)\n%s * d/b.bin (11 bytes)\n", lfsOid("a contents\x00"), lfsOid("b contents\x00"))
+	if got := mustGogit(t, dir, "lfs", "ls-files", "-l", "-s"); got != want {
+		t.Errorf("lfs ls-files -l -s listed after pull:\n%s\nwant:\n%s", got, want)
+	}
+
+	if got := mustGogit(t, dir, "status", "--short"); got != "" {
+		t.Errorf("status after lfs pull:\n%s\nwant a clean worktree", got)
+	}
+}
+
+// TestLFSFetch checks that the objects are stored without touching the
+// worktree.
+func TestLFSFetch(t *testing.T) {
+	s := newLFSTestServer(t)
+	dir := lfsRepo(t, s)
+
+	mustGogit(t, dir, "lfs", "fetch", "origin", "other")
+
+	for _, contents := range []string{"a contents\x00", "b contents\x00", "c contents\x00"} {
+		if !hasLFSObject(t, dir, contents) {
+			t.Errorf("lfs fetch origin other did not store %q", contents)
+		}
+	}
+
+	if got, want := readFile(t, filepath.Join(dir, "a.bin")), lfsPointerText("a contents\x00"); got != want {
+		t.Errorf("lfs fetch changed a.bin to %q, want the pointer %q", got, want)
+	}
+}
+
+// TestLFSCheckout checks that checkout downloads and smudges the pointer
+// files committed by git.
+func TestLFSCheckout(t *testing.T) {
+	s := newLFSTestServer(t)
+	dir := lfsRepo(t, s)
+
+	mustGogit(t, dir, "checkout", "other")
+
+	// As with git, only the files that change are checked out.
+	for name, want := range map[string]string{"a.bin": lfsPointerText("a contents\x00"), "c.bin": "c contents\x00"} {
+		if got := readFile(t, filepath.Join(dir, name)); got != want {
+			t.Errorf("checkout left %s with %q, want %q", name, got, want)
+		}
+	}
+
+	if got, want := gitCmd(t, dir, "cat-file", "blob", ":c.bin"), lfsPointerText("c contents\x00"); got != want {
+		t.Errorf("checkout staged c.bin as %q, want the pointer git committed %q", got, want)
+	}
+
+	// The objects are not downloaded again.
+	batches := len(s.batches)
+	mustGogit(t, dir, "checkout", "main")
+	mustGogit(t, dir, "checkout", "other")
+
+	if len(s.batches) != batches {
+		t.Errorf("checking out again made %d more batch requests", len(s.batches)-batches)
+	}
+}
+
+// TestLFSCommitPush checks that the files added are committed as the
+// pointers git-lfs writes, and that their objects are pushed.
+func TestLFSCommitPush(t *testing.T) {
+	s := newLFSTestServer(t)
+	dir := lfsRepo(t, s)
+
+	writeFile(t, dir, "new.bin", "new contents\x00")
+	mustGogit(t, dir, "add", "new.bin")
+	mustGogit(t, dir, "commit", "-m", "add new.bin")
+
+	if got, want := gitCmd(t, dir, "cat-file", "blob", "HEAD:new.bin"), lfsPointerText("new contents\x00"); got != want {
+		t.Errorf("new.bin committed as %q, want the pointer %q", got, want)
+	}
+
+	// Only the commits the remote-tracking branches do not have are pushed.
+	gitCmd(t, dir, "update-ref", "refs/remotes/origin/main", "HEAD~1")
+
+	want := fmt.Sprintf("push %s => new.bin\n", lfsOid("new contents\x00"))
+	if got := mustGogit(t, dir, "lfs", "push", "--dry-run", "origin", "main"); got != want {
+		t.Errorf("lfs push --dry-run listed:\n%s\nwant:\n%s", got, want)
+	}
+
+	mustGogit(t, dir, "lfs", "push", "origin", "main")
+
+	if got := string(s.objects[lfsOid("new contents\x00")]); got != "new contents\x00" {
+		t.Errorf("lfs push stored %q on the server", got)
+	}
+}
+
+// TestLFSTrack checks that the patterns tracked are those git takes for
+// Git LFS files.
+func TestLFSTrack(t *testing.T) {
+	s := newLFSTestServer(t)
+	dir := lfsRepo(t, s)
+
+	want := "Tracking \"*.psd\"\nTracking \"my file.dat\"\n\"*.bin\" already supported\n"
+	if got := mustGogit(t, dir, "lfs", "track", "*.psd", "my file.dat", "*.bin"); got != want {
+		t.Errorf("lfs track wrote:\n%s\nwant:\n%s", got, want)
+	}
+
+	want = "x.psd: filter: lfs\nx.psd: text: unset\nmy file.dat: filter: lfs\nmy file.dat: text: unset\n"
+	if got := gitCmd(t, dir, "check-attr", "filter", "text", "--", "x.psd", "my file.dat"); got != want {
+		t.Errorf("git check-attr gave after lfs track:\n%s\nwant:\n%s", got, want)
+	}
+
+	want = "Listing tracked patterns\n    *.bin (.gitattributes)\n    *.psd (.gitattributes)\n    my[[:space:]]file.dat (.gitattributes)\nListing excluded patterns\n"
+	if got := mustGogit(t, dir, "lfs", "track"); got != want {
+		t.Errorf("lfs track listed:\n%s\nwant:\n%s", got, want)
+	}
+
+	mustGogit(t, dir, "lfs", "untrack", "*.psd")
+
+	want = "x.psd: filter: unspecified\na.bin: filter: lfs\n"
+	if got := gitCmd(t, dir, "check-attr", "filter", "--", "x.psd", "a.bin"); got != want {
+		t.Errorf("git check-attr gave after lfs untrack:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// TestLFSPointer checks pointers built from files against those committed
+// by git.
+func TestLFSPointer(t *testing.T) {
+	s := newLFSTestServer(t)
+	dir := lfsRepo(t, s)
+
+	writeFile(t, dir, "a.dat", "a contents\x00")
+
+	if got, want := mustGogit(t, dir, "lfs", "pointer", "--file", "a.dat"), lfsPointerText("a contents\x00"); got != want {
+		t.Errorf("lfs pointer --file gave %q, want %q", got, want)
+	}
+
+	committed := gitCmd(t, dir, "cat-file", "blob", "HEAD:a.bin")
+	writeFile(t, dir, "a.ptr", committed)
+
+	if res := gogit(t, dir, "lfs", "pointer", "--file", "a.dat", "--pointer", "a.ptr"); res.code != 0 {
+		t.Errorf("lfs pointer found the pointer git committed different from that of a.dat: %s", res.stderr)
+	}
+
+	writeFile(t, dir, "a.dat", "changed")
+
+	if res := gogit(t, dir, "lfs", "pointer", "--file", "a.dat", "--pointer", "a.ptr"); res.code != 1 {
+		t.Errorf("lfs pointer of different contents exited with %d, want 1", res.code)
+	}
+
+	for contents, code := range map[string]int{committed: 0, "text\n": 1} {
+		if res := gogitStdin(t, dir, contents, "lfs", "pointer", "--check", "--stdin"); res.code != code {
+			t.Errorf("lfs pointer --check of %q exited with %d, want %d", contents, res.code, code)
+		}
+	}
+}
+
+// TestLFSPrune checks that only the objects of pushed commits no branch
+// holds are deleted.
+func TestLFSPrune(t *testing.T) {
+	s := newLFSTestServer(t)
+	dir := lfsRepo(t, s)
+
+	mustGogit(t, dir, "lfs", "fetch", "origin", "other")
+
+	// c.bin is only on other, which is deleted once pushed.
+	gitCmd(t, dir, "update-ref", "refs/remotes/origin/other", "other")
+	gitCmd(t, dir, "branch", "-q", "-D", "other")
+
+	want := "prune: 3 local object(s), 2 retained, done.\n" +
+		fmt.Sprintf(" * %s (11 bytes)\n", lfsOid("c contents\x00")) +
+		"prune: 1 file(s) would be pruned (11 bytes)\n"
+	if got := mustGogit(t, dir, "lfs", "prune", "--dry-run", "--verbose"); got != want {
+		t.Errorf("lfs prune --dry-run --verbose wrote:\n%s\nwant:\n%s", got, want)
+	}
+
+	mustGogit(t, dir, "lfs", "prune")
+
+	for contents, kept := range map[string]bool{"a contents\x00": true, "b contents\x00": true, "c contents\x00": false} {
+		if got := hasLFSObject(t, dir, contents); got != kept {
+			t.Errorf("after lfs prune, the object of %q is kept: %v, want %v", contents, got, kept)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, ".git", "lfs")); err != nil {
+		t.Error(err)
+	}
+
+	if got := gitCmd(t, dir, "for-each-ref", "--format=%(refname)"); !strings.Contains(got, "refs/remotes/origin/other") {
+		t.Errorf("lfs prune changed the refs:\n%s", got)
+	}
+}
@@ -0,0 +1,945 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/client"
+	formatcfg "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/transport"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+)
+
+const (
+	lfsPointerVersion = "https://git-lfs.github.com/spec/v1"
+	lfsLegacyVersion  = "https://hawser.github.com/spec/v1"
+	lfsMediaType      = "application/vnd.git-lfs+json"
+	lfsConfigFile     = ".lfsconfig"
+
+	// lfsMaxPointerSize is the size from which blobs are not taken for
+	// pointers, as in git-lfs.
+	lfsMaxPointerSize = 1024
+	// lfsBatchSize is the number of objects asked for in a batch request,
+	// git-lfs' default lfs.transfer.batchSize.
+	lfsBatchSize = 100
+)
+
+// lfsPointer is the contents of a pointer file: the SHA-256 and size of
+// the object it stands for.
+type lfsPointer struct {
+	oid  string
+	size int64
+}
+
+func newLFSPointer(data []byte) lfsPointer {
+	sum := sha256.Sum256(data)
+
+	return lfsPointer{oid: hex.EncodeToString(sum[:]), size: int64(len(data))}
+}
+
+func (p lfsPointer) String() string {
+	return fmt.Sprintf("version %s\noid sha256:%s\nsize %d\n", lfsPointerVersion, p.oid, p.size)
+}
+
+// parseLFSPointer parses a pointer file. Like git-lfs, it accepts keys it
+// does not know, as long as the version comes first and the others are
+// sorted.
+func parseLFSPointer(data []byte) (lfsPointer, bool) {
+	var p lfsPointer
+
+	if len(data) == 0 || len(data) >= lfsMaxPointerSize {
+		return p, false
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) < 3 || (lines[0] != "version "+lfsPointerVersion && lines[0] != "version "+lfsLegacyVersion) {
+		return p, false
+	}
+
+	var hasOid, hasSize bool
+
+	prev := ""
+
+	for _, line := range lines[1:] {
+		key, value, ok := strings.Cut(line, " ")
+		if !ok || key <= prev {
+			return p, false
+		}
+
+		prev = key
+
+		switch key {
+		case "oid":
+			oid, ok := strings.CutPrefix(value, "sha256:")
+			if !ok || !validLFSOid(oid) {
+				return p, false
+			}
+
+			p.oid, hasOid = oid, true
+		case "size":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < 0 {
+				return p, false
+			}
+
+			p.size, hasSize = n, true
+		}
+	}
+
+	return p, hasOid && hasSize
+}
+
+func validLFSOid(oid string) bool {
+	if len(oid) != sha256.Size*2 {
+		return false
+	}
+
+	for i := 0; i < len(oid); i++ {
+		if (oid[i] < '0' || oid[i] > '9') && (oid[i] < 'a' || oid[i] > 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// lfsStore is the local object store of Git LFS, in $GIT_DIR/lfs.
+type lfsStore struct {
+	fs billy.Filesystem
+}
+
+func openLFSStore(r *git.Repository) (*lfsStore, error) {
+	store, ok := r.Storer.(*filesystem.Storage)
+	if !ok {
+		return nil, errors.New("storer does not implement filesystem.Storage")
+	}
+
+	return &lfsStore{fs: store.Filesystem()}, nil
+}
+
+func (s *lfsStore) path(oid string) string {
+	return path.Join("lfs", "objects", oid[:2], oid[2:4], oid)
+}
+
+// has reports whether the object of a pointer is in the store.
+func (s *lfsStore) has(p lfsPointer) bool {
+	fi, err := s.fs.Stat(s.path(p.oid))
+
+	return err == nil && fi.Size() == p.size
+}
+
+func (s *lfsStore) read(p lfsPointer) ([]byte, error) {
+	data, err := util.ReadFile(s.fs, s.path(p.oid))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read LFS object %s: %w", p.oid, err)
+	}
+
+	return data, nil
+}
+
+func (s *lfsStore) open(p lfsPointer) (billy.File, error) {
+	f, err := s.fs.Open(s.path(p.oid))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read LFS object %s: %w", p.oid, err)
+	}
+
+	return f, nil
+}
+
+// write stores the object of a pointer read from rd, failing if it is not
+// the object the pointer stands for.
+func (s *lfsStore) write(p lfsPointer, rd io.Reader) error {
+	err := s.fs.MkdirAll(path.Join("lfs", "tmp"), 0o755)
+	if err != nil {
+		return err
+	}
+
+	f, err := util.TempFile(s.fs, path.Join("lfs", "tmp"), p.oid+"-")
+	if err != nil {
+		return err
+	}
+
+	h := sha256.New()
+
+	n, err := io.Copy(io.MultiWriter(f, h), rd)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil && (n != p.size || hex.EncodeToString(h.Sum(nil)) != p.oid) {
+		err = fmt.Errorf("LFS object %s is corrupt", p.oid)
+	}
+
+	if err != nil {
+		_ = s.fs.Remove(f.Name())
+
+		return err
+	}
+
+	err = s.fs.MkdirAll(path.Dir(s.path(p.oid)), 0o755)
+	if err != nil {
+		return err
+	}
+
+	return s.fs.Rename(f.Name(), s.path(p.oid))
+}
+
+// objects returns the pointers of all the objects in the store.
+func (s *lfsStore) objects() ([]lfsPointer, error) {
+	var pointers []lfsPointer
+
+	err := util.Walk(s.fs, path.Join("lfs", "objects"), func(name string, fi fs.FileInfo, err error) error {
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			return nil
+		case err != nil:
+			return err
+		case fi.IsDir() || !validLFSOid(fi.Name()):
+			return nil
+		}
+
+		pointers = append(pointers, lfsPointer{oid: fi.Name(), size: fi.Size()})
+
+		return nil
+	})
+
+	return pointers, err
+}
+
+func (s *lfsStore) remove(p lfsPointer) error {
+	return s.fs.Remove(s.path(p.oid))
+}
+
+// lfsConfigOption returns an option of the Git LFS configuration, which
+// can also be given by the .lfsconfig file at the top of the worktree.
+func lfsConfigOption(r *git.Repository, section, subsection, key string) string {
+	if v, ok := lookupScopedConfigOption(r, section, subsection, key); ok {
+		return v
+	}
+
+	w, err := r.Worktree()
+	if err != nil {
+		return ""
+	}
+
+	f, err := w.Filesystem.Open(lfsConfigFile)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	raw := formatcfg.New()
+	if formatcfg.NewDecoder(f).Decode(raw) != nil || !raw.HasSection(section) {
+		return ""
+	}
+
+	s := raw.Section(section)
+	if subsection != "" {
+		if !s.HasSubsection(subsection) {
+			return ""
+		}
+
+		return s.Subsection(subsection).Option(key)
+	}
+
+	return s.Option(key)
+}
+
+// lfsDefaultRemote returns the remote objects are downloaded from: the
+// remote of the current branch, or else origin.
+func lfsDefaultRemote(r *git.Repository) string {
+	if name := lfsConfigOption(r, "remote", "", "lfsdefault"); name != "" {
+		return name
+	}
+
+	if branch, err := currentBranch(r); err == nil {
+		if cfg, err := r.Config(); err == nil {
+			if b, ok := cfg.Branches[branch.Short()]; ok && b.Remote != "" && b.Remote != "." {
+				return b.Remote
+			}
+		}
+	}
+
+	return git.DefaultRemoteName
+}
+
+// lfsEndpoint is where the objects of a remote are transferred from and
+// to: a Git LFS server, or the store of a repository on the same machine.
+type lfsEndpoint struct {
+	url   *url.URL
+	local *lfsStore
+}
+
+// lfsRemoteEndpoint returns the endpoint of a remote, given by its name or
+// URL, the way git-lfs finds it: lfs.url, remote.<name>.lfsurl, or else
+// the info/lfs path of the repository the remote URL points at.
+func lfsRemoteEndpoint(r *git.Repository, remote string) (*lfsEndpoint, error) {
+	if u := lfsConfigOption(r, "lfs", "", "url"); u != "" {
+		return lfsEndpointFromURL(u, false)
+	}
+
+	cfg, err := r.Config()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get repository config: %w", err)
+	}
+
+	rc, ok := cfg.Remotes[remote]
+	if !ok {
+		return lfsEndpointFromURL(remote, true)
+	}
+
+	if u := lfsConfigOption(r, "remote", remote, "lfsurl"); u != "" {
+		return lfsEndpointFromURL(u, false)
+	}
+
+	if len(rc.URLs) == 0 {
+		return nil, fmt.Errorf("remote '%s' has no URL", remote)
+	}
+
+	return lfsEndpointFromURL(rc.URLs[0], true)
+}
+
+// lfsEndpointFromURL returns the endpoint at a URL, or that of the
+// repository at the URL when repo is true. Like git-lfs, the server of a
+// repository reached over SSH is taken to be on HTTPS at the same host.
+func lfsEndpointFromURL(raw string, repo bool) (*lfsEndpoint, error) {
+	u, err := transport.ParseURL(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LFS endpoint %s: %w", raw, err)
+	}
+
+	switch u.Scheme {
+	case "file":
+		p := u.Path
+		if filepath.VolumeName(raw) != "" {
+			p = raw
+		}
+
+		lr, err := git.PlainOpen(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open LFS endpoint %s: %w", raw, err)
+		}
+
+		store, err := openLFSStore(lr)
+		if err != nil {
+			return nil, err
+		}
+
+		return &lfsEndpoint{local: store}, nil
+	case "http", "https":
+	case "ssh", "git":
+		if !repo {
+			return nil, fmt.Errorf("unsupported LFS endpoint %s", raw)
+		}
+
+		u = &url.URL{Scheme: "https", Host: u.Hostname(), Path: u.Path}
+	default:
+		return nil, fmt.Errorf("unsupported LFS endpoint %s", raw)
+	}
+
+	if repo {
+		u.Path = strings.TrimSuffix(u.Path, "/")
+		if !strings.HasSuffix(u.Path, ".git") {
+			u.Path += ".git"
+		}
+
+		u.Path = "/" + strings.TrimPrefix(u.Path, "/") + "/info/lfs"
+		u.RawPath = ""
+	}
+
+	return &lfsEndpoint{url: u}, nil
+}
+
+// download stores the objects of the pointers missing from store. It
+// returns the number of objects downloaded.
+func (e *lfsEndpoint) download(store *lfsStore, pointers []lfsPointer, ref plumbing.ReferenceName) (int, error) {
+	var missing []lfsPointer
+
+	seen := make(map[string]bool)
+
+	for _, p := range pointers {
+		if !seen[p.oid] && !store.has(p) {
+			missing = append(missing, p)
+		}
+
+		seen[p.oid] = true
+	}
+
+	if e.local != nil {
+		for _, p := range missing {
+			err := copyLFSObject(e.local, store, p)
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		return len(missing), nil
+	}
+
+	c := newLFSClient(e.url)
+
+	return c.transfer("download", missing, ref, func(o *lfsBatchObject, p lfsPointer) error {
+		return c.download(o.Actions["download"], store, p)
+	})
+}
+
+// upload sends the objects of the pointers from store to the endpoint,
+// but those it already has. It returns the number of objects uploaded.
+func (e *lfsEndpoint) upload(store *lfsStore, pointers []lfsPointer, ref plumbing.ReferenceName) (int, error) {
+	var objects []lfsPointer
+
+	seen := make(map[string]bool)
+
+	for _, p := range pointers {
+		if seen[p.oid] {
+			continue
+		}
+
+		seen[p.oid] = true
+
+		if !store.has(p) {
+			return 0, fmt.Errorf("unable to find source for object %s", p.oid)
+		}
+
+		objects = append(objects, p)
+	}
+
+	if e.local != nil {
+		n := 0
+
+		for _, p := range objects {
+			if e.local.has(p) {
+				continue
+			}
+
+			err := copyLFSObject(store, e.local, p)
+			if err != nil {
+				return n, err
+			}
+
+			n++
+		}
+
+		return n, nil
+	}
+
+	c := newLFSClient(e.url)
+
+	return c.transfer("upload", objects, ref, func(o *lfsBatchObject, p lfsPointer) error {
+		err := c.upload(o.Actions["upload"], store, p)
+		if err != nil {
+			return err
+		}
+
+		return c.verify(o.Actions["verify"], p)
+	})
+}
+
+func copyLFSObject(from, to *lfsStore, p lfsPointer) error {
+	f, err := from.open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return to.write(p, f)
+}
+
+// lfsBatchObject is an object of a request to or response from the batch
+// API.
+type lfsBatchObject struct {
+	Oid     string                `json:"oid"`
+	Size    int64                 `json:"size"`
+	Actions map[string]*lfsAction `json:"actions,omitempty"`
+	Error   *lfsObjectError       `json:"error,omitempty"`
+}
+
+// lfsAction is a request to make to transfer an object.
+type lfsAction struct {
+	Href   string            `json:"href"`
+	Header map[string]string `json:"header,omitempty"`
+}
+
+type lfsObjectError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type lfsBatchRef struct {
+	Name string `json:"name"`
+}
+
+type lfsBatchRequest struct {
+	Operation string           `json:"operation"`
+	Transfers []string         `json:"transfers"`
+	Ref       *lfsBatchRef     `json:"ref,omitempty"`
+	Objects   []lfsBatchObject `json:"objects"`
+	HashAlgo  string           `json:"hash_algo"`
+}
+
+type lfsBatchResponse struct {
+	Transfer string           `json:"transfer"`
+	Objects  []lfsBatchObject `json:"objects"`
+}
+
+// lfsClient speaks the Git LFS batch API and basic transfer adapter of a
+// server, with the credentials the git transports use for its URL.
+type lfsClient struct {
+	url  *url.URL
+	auth client.HTTPAuth
+	http *http.Client
+}
+
+func newLFSClient(u *url.URL) *lfsClient {
+	c := &lfsClient{auth: defaultHTTPAuth(u), http: http.DefaultClient}
+
+	c.url = new(url.URL)
+	*c.url = *u
+	c.url.User = nil
+
+	return c
+}
+
+// transfer asks the server for the actions transferring objects for the
+// operation, in batches, and runs those it gets. Objects the server has no
+// action for need no transfer. It returns the number of objects
+// transferred.
+func (c *lfsClient) transfer(operation string, pointers []lfsPointer, ref plumbing.ReferenceName, run func(*lfsBatchObject, lfsPointer) error) (int, error) {
+	n := 0
+
+	for len(pointers) > 0 {
+		batch := pointers[:min(len(pointers), lfsBatchSize)]
+		pointers = pointers[len(batch):]
+
+		objects, err := c.batch(operation, batch, ref)
+		if err != nil {
+			return n, err
+		}
+
+		for _, p := range batch {
+			o := objects[p.oid]
+
+			switch {
+			case o == nil:
+				return n, fmt.Errorf("LFS server did not return object %s", p.oid)
+			case o.Error != nil:
+				return n, fmt.Errorf("LFS object %s: %s (%d)", p.oid, o.Error.Message, o.Error.Code)
+			case o.Actions[operation] == nil:
+				continue
+			}
+
+			err := run(o, p)
+			if err != nil {
+				return n, err
+			}
+
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// batch makes a request to the batch API, and returns the objects of the
+// response by OID.
+func (c *lfsClient) batch(operation string, pointers []lfsPointer, ref plumbing.ReferenceName) (map[string]*lfsBatchObject, error) {
+	req := lfsBatchRequest{
+		Operation: operation,
+		Transfers: []string{"basic"},
+		HashAlgo:  "sha256",
+	}
+
+	if ref != "" {
+		req.Ref = &lfsBatchRef{Name: ref.String()}
+	}
+
+	for _, p := range pointers {
+		req.Objects = append(req.Objects, lfsBatchObject{Oid: p.oid, Size: p.size})
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	hr, err := http.NewRequest(http.MethodPost, c.url.String()+"/objects/batch", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	hr.Header.Set("Accept", lfsMediaType)
+	hr.Header.Set("Content-Type", lfsMediaType)
+
+	if c.auth != nil {
+		err = c.auth.Authorizer(hr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := c.do(hr)
+	if err != nil {
+		return nil, fmt.Errorf("batch request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var br lfsBatchResponse
+
+	err = json.NewDecoder(resp.Body).Decode(&br)
+	if err != nil {
+		return nil, fmt.Errorf("invalid batch response: %w", err)
+	}
+
+	if br.Transfer != "" && br.Transfer != "basic" {
+		return nil, fmt.Errorf("unsupported LFS transfer adapter %s", br.Transfer)
+	}
+
+	objects := make(map[string]*lfsBatchObject, len(br.Objects))
+	for i := range br.Objects {
+		objects[br.Objects[i].Oid] = &br.Objects[i]
+	}
+
+	return objects, nil
+}
+
+func (c *lfsClient) download(a *lfsAction, store *lfsStore, p lfsPointer) error {
+	req, err := c.actionRequest(http.MethodGet, a, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download LFS object %s: %w", p.oid, err)
+	}
+	defer resp.Body.Close()
+
+	return store.write(p, resp.Body)
+}
+
+func (c *lfsClient) upload(a *lfsAction, store *lfsStore, p lfsPointer) error {
+	f, err := store.open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	req, err := c.actionRequest(http.MethodPut, a, f)
+	if err != nil {
+		return err
+	}
+
+	req.ContentLength = p.size
+	if req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload LFS object %s: %w", p.oid, err)
+	}
+
+	return resp.Body.Close()
+}
+
+// verify tells the server an uploaded object is complete, when it asks to.
+func (c *lfsClient) verify(a *lfsAction, p lfsPointer) error {
+	if a == nil {
+		return nil
+	}
+
+	body, err := json.Marshal(lfsBatchObject{Oid: p.oid, Size: p.size})
+	if err != nil {
+		return err
+	}
+
+	req, err := c.actionRequest(http.MethodPost, a, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", lfsMediaType)
+	req.Header.Set("Content-Type", lfsMediaType)
+
+	resp, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("failed to verify LFS object %s: %w", p.oid, err)
+	}
+
+	return resp.Body.Close()
+}
+
+// actionRequest returns the request of an action. The credentials of the
+// endpoint go along when the action is on the same host and brings none.
+func (c *lfsClient) actionRequest(method string, a *lfsAction, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, a.Href, body)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range a.Header {
+		req.Header.Set(k, v)
+	}
+
+	if c.auth != nil && req.Header.Get("Authorization") == "" && req.URL.Host == c.url.Host {
+		err = c.auth.Authorizer(req)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return req, nil
+}
+
+// do sends a request, failing with the message of the server when it does
+// not succeed.
+func (c *lfsClient) do(req *http.Request) (*http.Response, error) {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+
+	var msg struct {
+		Message string `json:"message"`
+	}
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	if json.Unmarshal(data, &msg) == nil && msg.Message != "" {
+		return nil, fmt.Errorf("%s: %s", resp.Status, msg.Message)
+	}
+
+	return nil, errors.New(resp.Status)
+}
+
+// lfsFile is a pointer file of a tree.
+type lfsFile struct {
+	path    string
+	pointer lfsPointer
+}
+
+// lfsScanner finds the pointer files of trees, remembering which blobs are
+// pointers across them.
+type lfsScanner struct {
+	r     *git.Repository
+	blobs map[plumbing.Hash]*lfsPointer
+}
+
+func newLFSScanner(r *git.Repository) *lfsScanner {
+	return &lfsScanner{r: r, blobs: make(map[plumbing.Hash]*lfsPointer)}
+}
+
+// tree returns the pointer files of the tree of a commit, tree or tag.
+func (s *lfsScanner) tree(h plumbing.Hash) ([]lfsFile, error) {
+	t, err := peelTree(s.r, h)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []lfsFile
+
+	err = t.Files().ForEach(func(f *object.File) error {
+		p, err := s.blob(f.Hash, f.Size)
+		if err != nil {
+			return err
+		}
+
+		if p != nil {
+			files = append(files, lfsFile{path: f.Name, pointer: *p})
+		}
+
+		return nil
+	})
+
+	return files, err
+}
+
+// blob returns the pointer a blob holds, if it is one.
+func (s *lfsScanner) blob(h plumbing.Hash, size int64) (*lfsPointer, error) {
+	if size == 0 || size >= lfsMaxPointerSize {
+		return nil, nil
+	}
+
+	p, ok := s.blobs[h]
+	if !ok {
+		data, err := readBlob(s.r, h)
+		if err != nil {
+			return nil, err
+		}
+
+		if pointer, ok := parseLFSPointer(data); ok {
+			p = &pointer
+		}
+
+		s.blobs[h] = p
+	}
+
+	return p, nil
+}
+
+func peelTree(r *git.Repository, h plumbing.Hash) (*object.Tree, error) {
+	obj, err := r.Object(plumbing.AnyObject, h)
+	if err != nil {
+		return nil, err
+	}
+
+	return peelToTree(obj)
+}
+
+// lfsSkipSmudge reports whether GIT_LFS_SKIP_SMUDGE asks to leave pointer
+// files as they are in the worktree.
+func lfsSkipSmudge() bool {
+	ok, _ := strconv.ParseBool(os.Getenv("GIT_LFS_SKIP_SMUDGE"))
+
+	return ok
+}
+
+// hashLFSObject returns the pointer of the contents read from rd.
+func hashLFSObject(rd io.Reader) (lfsPointer, error) {
+	h := sha256.New()
+
+	n, err := io.Copy(h, rd)
+	if err != nil {
+		return lfsPointer{}, err
+	}
+
+	return lfsPointer{oid: hex.EncodeToString(h.Sum(nil)), size: n}, nil
+}
+
+// isGitLFSCommand reports whether a filter command runs git-lfs, as those
+// git lfs install configures do.
+func isGitLFSCommand(command string) bool {
+	return command == "git-lfs" || strings.HasPrefix(command, "git-lfs ") || strings.HasPrefix(command, "git lfs ")
+}
+
+// lfsFilter runs the builtin Git LFS filter. Clean stores the contents of
+// a file and replaces them by their pointer, smudge replaces a pointer by
+// the contents of its object, which is downloaded if needed.
+func (c *converter) lfsFilter(command, name string, data []byte) ([]byte, bool) {
+	out, err := c.lfsConvert(command, data)
+	if err != nil {
+		fmt.Fprintf(c.errOut, "error: %s: %v\n", name, err)
+
+		return nil, false
+	}
+
+	return out, true
+}
+
+func (c *converter) lfsConvert(command string, data []byte) ([]byte, error) {
+	store, err := c.lfsObjects()
+	if err != nil {
+		return nil, err
+	}
+
+	if command == "clean" {
+		if _, ok := parseLFSPointer(data); ok || len(data) == 0 {
+			return data, nil
+		}
+
+		p := newLFSPointer(data)
+		if !store.has(p) {
+			err := store.write(p, bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return []byte(p.String()), nil
+	}
+
+	p, ok := parseLFSPointer(data)
+	if !ok || lfsSkipSmudge() {
+		return data, nil
+	}
+
+	if !store.has(p) {
+		err := c.lfsDownload([]lfsPointer{p})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return store.read(p)
+}
+
+// lfsMissing returns the pointer of a file the builtin Git LFS filter is
+// to smudge, if its object is not in the store.
+func (c *converter) lfsMissing(name string, data []byte) (lfsPointer, bool) {
+	a := c.convAttrs(name)
+	if a.driver == nil || !a.driver.lfs || lfsSkipSmudge() {
+		return lfsPointer{}, false
+	}
+
+	p, ok := parseLFSPointer(data)
+	if !ok {
+		return p, false
+	}
+
+	store, err := c.lfsObjects()
+	if err != nil {
+		return p, false
+	}
+
+	return p, !store.has(p)
+}
+
+// lfsDownload downloads objects into the store, from the default remote.
+func (c *converter) lfsDownload(pointers []lfsPointer) error {
+	store, err := c.lfsObjects()
+	if err != nil {
+		return err
+	}
+
+	if c.lfsEndpoint == nil {
+		c.lfsEndpoint, err = lfsRemoteEndpoint(c.r, lfsDefaultRemote(c.r))
+		if err != nil {
+			return err
+		}
+	}
+
+	ref, _ := currentBranch(c.r)
+
+	_, err = c.lfsEndpoint.download(store, pointers, ref)
+	if err != nil {
+		return fmt.Errorf("failed to download LFS objects: %w", err)
+	}
+
+	return nil
+}
+
+func (c *converter) lfsObjects() (*lfsStore, error) {
+	if c.lfsStore == nil {
+		store, err := openLFSStore(c.r)
+		if err != nil {
+			return nil, err
+		}
+
+		c.lfsStore = store
+	}
+
+	return c.lfsStore, nil
+}
@@ -0,0 +1,451 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-git/go-billy/v6/memfs"
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+// lfsTestServer is a Git LFS server holding its objects in memory, with
+// the basic transfer adapter.
+type lfsTestServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	objects  map[string][]byte
+	batches  []lfsBatchRequest
+	auth     []string
+	verified []string
+}
+
+func newLFSTestServer(t *testing.T) *lfsTestServer {
+	s := &lfsTestServer{objects: make(map[string][]byte)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /repo.git/info/lfs/objects/batch", s.batch)
+	mux.HandleFunc("GET /objects/{oid}", s.download)
+	mux.HandleFunc("PUT /objects/{oid}", s.upload)
+	mux.HandleFunc("POST /verify", s.verify)
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *lfsTestServer) batch(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Accept") != lfsMediaType {
+		http.Error(w, "bad accept header", http.StatusNotAcceptable)
+
+		return
+	}
+
+	var req lfsBatchRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.batches = append(s.batches, req)
+	s.auth = append(s.auth, r.Header.Get("Authorization"))
+
+	resp := lfsBatchResponse{Transfer: "basic"}
+
+	for _, o := range req.Objects {
+		_, ok := s.objects[o.Oid]
+		href := s.URL + "/objects/" + o.Oid
+
+		switch {
+		case req.Operation == "download" && !ok:
+			o.Error = &lfsObjectError{Code: http.StatusNotFound, Message: "Object does not exist"}
+		case req.Operation == "download":
+			o.Actions = map[string]*lfsAction{"download": {Href: href}}
+		case !ok:
+			o.Actions = map[string]*lfsAction{
+				"upload": {Href: href, Header: map[string]string{"X-Test": "upload"}},
+				"verify": {Href: s.URL + "/verify"},
+			}
+		}
+
+		resp.Objects = append(resp.Objects, o)
+	}
+
+	w.Header().Set("Content-Type", lfsMediaType)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func (s *lfsTestServer) download(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	data, ok := s.objects[r.PathValue("oid")]
+	s.mu.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	_, _ = w.Write(data)
+}
+
+func (s *lfsTestServer) upload(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Test") != "upload" {
+		http.Error(w, "missing action header", http.StatusBadRequest)
+
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	s.mu.Lock()
+	s.objects[r.PathValue("oid")] = data
+	s.mu.Unlock()
+}
+
+func (s *lfsTestServer) verify(w http.ResponseWriter, r *http.Request) {
+	var o lfsBatchObject
+
+	err := json.NewDecoder(r.Body).Decode(&o)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	s.mu.Lock()
+	s.verified = append(s.verified, o.Oid)
+	s.mu.Unlock()
+}
+
+func (s *lfsTestServer) endpoint(t *testing.T) *lfsEndpoint {
+	t.Helper()
+
+	e, err := lfsEndpointFromURL(s.URL+"/repo", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return e
+}
+
+func TestLFSClientBatch(t *testing.T) {
+	s := newLFSTestServer(t)
+
+	stored := newLFSPointer([]byte("stored"))
+	missing := newLFSPointer([]byte("missing"))
+	s.objects[stored.oid] = []byte("stored")
+
+	u, err := url.Parse(s.URL + "/repo.git/info/lfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	objects, err := newLFSClient(u).batch("download", []lfsPointer{stored, missing}, plumbing.NewBranchReferenceName("main"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(s.batches) != 1 {
+		t.Fatalf("got %d batch requests, want 1", len(s.batches))
+	}
+
+	req := s.batches[0]
+	if req.Operation != "download" || req.HashAlgo != "sha256" || req.Ref == nil || req.Ref.Name != "refs/heads/main" {
+		t.Errorf("unexpected batch request %+v", req)
+	}
+
+	if o := objects[stored.oid]; o == nil || o.Actions["download"] == nil {
+		t.Errorf("no download action for %s: %+v", stored.oid, o)
+	}
+
+	if o := objects[missing.oid]; o == nil || o.Error == nil || o.Error.Code != http.StatusNotFound {
+		t.Errorf("no error for %s: %+v", missing.oid, o)
+	}
+}
+
+func TestLFSClientCredentials(t *testing.T) {
+	s := newLFSTestServer(t)
+
+	u, err := url.Parse(s.URL + "/repo.git/info/lfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u.User = url.UserPassword("user", "secret")
+
+	if opts := defaultClientOptions(u); len(opts) != 1 {
+		t.Errorf("got %d client options for %s, want the HTTP authentication", len(opts), u.Redacted())
+	}
+
+	_, err = newLFSClient(u).batch("download", []lfsPointer{newLFSPointer([]byte("a"))}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:secret"))
+	if len(s.auth) != 1 || s.auth[0] != want {
+		t.Errorf("batch requests authorized with %q, want %q", s.auth, want)
+	}
+}
+
+func TestLFSEndpointDownload(t *testing.T) {
+	s := newLFSTestServer(t)
+
+	data := []byte("large file contents\n")
+	p := newLFSPointer(data)
+	s.objects[p.oid] = data
+
+	store := &lfsStore{fs: memfs.New()}
+
+	n, err := s.endpoint(t).download(store, []lfsPointer{p, p}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 1 {
+		t.Errorf("downloaded %d objects, want 1", n)
+	}
+
+	got, err := store.read(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, data) {
+		t.Errorf("got %q, want %q", got, data)
+	}
+
+	// Objects already in the store are not asked for again.
+	n, err = s.endpoint(t).download(store, []lfsPointer{p}, "")
+	if err != nil || n != 0 || len(s.batches) != 1 {
+		t.Errorf("second download: n=%d, err=%v, %d batches", n, err, len(s.batches))
+	}
+}
+
+func TestLFSEndpointDownloadMissing(t *testing.T) {
+	s := newLFSTestServer(t)
+
+	store := &lfsStore{fs: memfs.New()}
+	p := newLFSPointer([]byte("nowhere"))
+
+	_, err := s.endpoint(t).download(store, []lfsPointer{p}, "")
+	if err == nil || !strings.Contains(err.Error(), "Object does not exist") {
+		t.Errorf("got error %v, want the server's", err)
+	}
+
+	if store.has(p) {
+		t.Error("missing object stored")
+	}
+}
+
+func TestLFSEndpointUpload(t *testing.T) {
+	s := newLFSTestServer(t)
+
+	store := &lfsStore{fs: memfs.New()}
+
+	var pointers []lfsPointer
+
+	for _, data := range []string{"first object", "second object"} {
+		p := newLFSPointer([]byte(data))
+
+		err := store.write(p, strings.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pointers = append(pointers, p)
+	}
+
+	s.objects[pointers[1].oid] = []byte("second object")
+
+	n, err := s.endpoint(t).upload(store, pointers, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 1 {
+		t.Errorf("uploaded %d objects, want 1", n)
+	}
+
+	if got := string(s.objects[pointers[0].oid]); got != "first object" {
+		t.Errorf("server has %q, want %q", got, "first object")
+	}
+
+	if len(s.verified) != 1 || s.verified[0] != pointers[0].oid {
+		t.Errorf("verified %v, want %s", s.verified, pointers[0].oid)
+	}
+}
+
+func TestLFSEndpointUploadMissing(t *testing.T) {
+	s := newLFSTestServer(t)
+
+	store := &lfsStore{fs: memfs.New()}
+
+	_, err := s.endpoint(t).upload(store, []lfsPointer{newLFSPointer([]byte("absent"))}, "")
+	if err == nil {
+		t.Error("upload of an object missing from the store succeeded")
+	}
+}
+
+func TestIsGitLFSCommand(t *testing.T) {
+	for command, want := range map[string]bool{
+		"":                             false,
+		"git-lfs clean -- %f":          true,
+		"git-lfs filter-process":       true,
+		"git lfs smudge -- %f":         true,
+		"git-lfs":                      true,
+		"git-lfs-custom clean":         false,
+		"/usr/local/bin/my-filter %f":  false,
+		"sh -c 'git-lfs clean -- %f'":  false,
+		"git lfsx clean -- %f":         false,
+		"git-lfsx filter-process --ok": false,
+	} {
+		if got := isGitLFSCommand(command); got != want {
+			t.Errorf("isGitLFSCommand(%q) = %v, want %v", command, got, want)
+		}
+	}
+}
+
+func TestStageCleansLFSFiles(t *testing.T) {
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+
+	dir := t.TempDir()
+
+	r, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := r.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.Raw.Section("filter").Subsection("lfs").
+		SetOption("clean", "git-lfs clean -- %f").
+		SetOption("smudge", "git-lfs smudge -- %f").
+		SetOption("process", "git-lfs filter-process").
+		SetOption("required", "true")
+
+	err = r.SetConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("binary contents\x00\x01\x02")
+
+	for name, contents := range map[string][]byte{
+		".gitattributes": []byte("*.bin filter=lfs diff=lfs merge=lfs -text\n"),
+		"file.bin":       data,
+		"file.txt":       []byte("text\n"),
+	} {
+		err := os.WriteFile(filepath.Join(dir, name), contents, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w, err := r.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := r.Storer.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conv, err := newConverter(r, attrCheckin, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conv.Close()
+
+	s := &stager{r: r, fs: w.Filesystem, idx: idx, conv: conv}
+
+	for _, name := range []string{".gitattributes", "file.bin", "file.txt"} {
+		err := s.stage(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = s.write()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	staged := make(map[string][]byte)
+
+	idx, err = r.Storer.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range idx.Entries {
+		blob, err := r.BlobObject(e.Hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rd, err := blob.Reader()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		staged[e.Name], err = io.ReadAll(rd)
+		_ = rd.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := newLFSPointer(data)
+	if got := string(staged["file.bin"]); got != p.String() {
+		t.Errorf("file.bin staged as %q, want its pointer %q", got, p.String())
+	}
+
+	if got := string(staged["file.txt"]); got != "text\n" {
+		t.Errorf("file.txt staged as %q", got)
+	}
+
+	store, err := openLFSStore(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.read(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, data) {
+		t.Errorf("LFS store has %q, want %q", got, data)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/spf13/cobra"
+)
+
+// logDateFormat is the date format of git log's default output.
+const logDateFormat = "Mon Jan 2 15:04:05 2006 -0700"
+
+var (
+	logMaxCount int
+	logOneline  bool
+	logNotes    []string
+	logNoNotes  bool
+)
+
+func init() {
+	logCmd.Flags().IntVarP(&logMaxCount, "max-count", "n", 0, "Limit the number of commits to output")
+	logCmd.Flags().BoolVarP(&logOneline, "oneline", "", false, "Show each commit on a single line")
+	logCmd.Flags().StringArrayVarP(&logNotes, "notes", "", nil, "Show the notes from <ref>, or the default notes if none given")
+	logCmd.Flags().Lookup("notes").NoOptDefVal = defaultNotesRef.String()
+	logCmd.Flags().BoolVarP(&logNoNotes, "no-notes", "", false, "Do not show notes")
+	rootCmd.AddCommand(logCmd)
+}
+
+var logCmd = &cobra.Command{
+	Use:   "log [<options>] [<revision>]",
+	Short: "Show commit logs",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		rev := plumbing.HEAD.String()
+		if len(args) > 0 {
+			rev = args[0]
+		}
+
+		from, err := resolveRevision(r, rev)
+		if err != nil {
+			return fmt.Errorf("bad revision '%s': %w", rev, err)
+		}
+
+		trees, err := logNotesTrees(r)
+		if err != nil {
+			return err
+		}
+
+		// Like git, history is shown newest first by committer date, and
+		// read from the commit-graph when there is one.
+		q := newCommitQueue(r)
+		q.add(from)
+
+		out := cmd.OutOrStdout()
+
+		for count := 0; logMaxCount <= 0 || count < logMaxCount; count++ {
+			n := q.next()
+			if n == nil {
+				break
+			}
+
+			for _, p := range n.ParentHashes() {
+				q.add(p)
+			}
+
+			c, err := n.Commit()
+			if err != nil {
+				return err
+			}
+
+			if count > 0 && !logOneline {
+				fmt.Fprintln(out)
+			}
+
+			printCommit(out, c, logOneline)
+
+			// Like git, one-line output only shows notes when asked to.
+			if logOneline && len(logNotes) == 0 {
+				continue
+			}
+
+			err = printNotes(out, c.Hash, trees, logOneline)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// logNotesTrees loads the notes trees displayed by log. Like git, the
+// default notes are shown unless --no-notes is given or --notes names
+// other references, and a bare --notes adds them back.
+func logNotesTrees(r *git.Repository) ([]*notes, error) {
+	if logNoNotes {
+		return nil, nil
+	}
+
+	names := logNotes
+	if len(names) == 0 {
+		names = []string{""}
+	}
+
+	var refs []plumbing.ReferenceName
+
+	for _, name := range names {
+		if name == defaultNotesRef.String() {
+			name = ""
+		}
+
+		ref, err := notesRefName(r, name)
+		if err != nil {
+			return nil, err
+		}
+
+		duplicate := false
+
+		for _, seen := range refs {
+			duplicate = duplicate || seen == ref
+		}
+
+		if !duplicate {
+			refs = append(refs, ref)
+		}
+	}
+
+	trees := make([]*notes, 0, len(refs))
+
+	for _, ref := range refs {
+		n, err := loadNotes(r, ref)
+		if err != nil {
+			return nil, err
+		}
+
+		trees = append(trees, n)
+	}
+
+	return trees, nil
+}
+
+// printCommit writes c in git log's medium format, or as a single line.
+func printCommit(out io.Writer, c *object.Commit, oneline bool) {
+	if oneline {
+		fmt.Fprintf(out, "%s %s\n", c.Hash.String()[:7], commitSubject(c))
+
+		return
+	}
+
+	fmt.Fprintf(out, "commit %s\n", c.Hash)
+
+	if len(c.ParentHashes) > 1 {
+		parents := make([]string, 0, len(c.ParentHashes))
+		for _, p := range c.ParentHashes {
+			parents = append(parents, p.String()[:7])
+		}
+
+		fmt.Fprintf(out, "Merge: %s\n", strings.Join(parents, " "))
+	}
+
+	fmt.Fprintf(out, "Author: %s <%s>\n", c.Author.Name, c.Author.Email)
+	fmt.Fprintf(out, "Date:   %s\n\n", c.Author.When.Format(logDateFormat))
+
+	for line := range strings.Lines(strings.TrimRight(c.Message, "\n")) {
+		fmt.Fprintf(out, "    %s", line)
+	}
+
+	fmt.Fprintln(out)
+}
+
+// printNotes writes the notes attached to h in each of trees, laid out
+// to follow a commit printed by printCommit.
+func printNotes(out io.Writer, h plumbing.Hash, trees []*notes, oneline bool) error {
+	for _, n := range trees {
+		note, err := n.note(h)
+		if errors.Is(err, plumbing.ErrObjectNotFound) {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if !oneline {
+			fmt.Fprintln(out)
+		}
+
+		if n.ref == defaultNotesRef {
+			fmt.Fprintln(out, "Notes:")
+		} else {
+			fmt.Fprintf(out, "Notes (%s):\n", strings.TrimPrefix(n.ref.String(), "refs/notes/"))
+		}
+
+		for line := range strings.Lines(strings.TrimRight(note, "\n")) {
+			fmt.Fprintf(out, "    %s", line)
+		}
+
+		fmt.Fprintln(out)
+
+		if oneline {
+			fmt.Fprintln(out)
+		}
+	}
+
+	return nil
+}
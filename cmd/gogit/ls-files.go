@@ -0,0 +1,414 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/format/gitignore"
+	"github.com/go-git/go-git/v6/plumbing/format/index"
+	"github.com/go-git/go-git/v6/storage/memory"
+	"github.com/spf13/cobra"
+)
+
+var (
+	lsFilesCached          bool
+	lsFilesStage           bool
+	lsFilesModified        bool
+	lsFilesOthers          bool
+	lsFilesExcludeStandard bool
+	lsFilesDeleted         bool
+	lsFilesUnmerged        bool
+	lsFilesNul             bool
+)
+
+func init() {
+	lsFilesCmd.Flags().BoolVarP(&lsFilesCached, "cached", "c", false, "Show the files in the index")
+	lsFilesCmd.Flags().BoolVarP(&lsFilesStage, "stage", "s", false, "Show the mode, object name and stage of the files in the index")
+	lsFilesCmd.Flags().BoolVarP(&lsFilesModified, "modified", "m", false, "Show the files modified in the working tree")
+	lsFilesCmd.Flags().BoolVarP(&lsFilesOthers, "others", "o", false, "Show the untracked files")
+	lsFilesCmd.Flags().BoolVarP(&lsFilesExcludeStandard, "exclude-standard", "", false, "Leave out the files ignored by the standard ignore rules")
+	lsFilesCmd.Flags().BoolVarP(&lsFilesDeleted, "deleted", "d", false, "Show the files deleted from the working tree")
+	lsFilesCmd.Flags().BoolVarP(&lsFilesUnmerged, "unmerged", "u", false, "Show only the unmerged files, with their stages")
+	lsFilesCmd.Flags().BoolVarP(&lsFilesNul, "null", "z", false, "Terminate lines with NUL and do not quote paths")
+	rootCmd.AddCommand(lsFilesCmd)
+}
+
+var lsFilesCmd = &cobra.Command{
+	Use:   "ls-files [-c] [-s] [-m] [-d] [-u] [-o [--exclude-standard]] [-z] [--] [<pathspec>...]",
+	Short: "Show information about files in the index and the working tree",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		w, err := r.Worktree()
+		if err != nil {
+			return err
+		}
+
+		idx, err := r.Storer.Index()
+		if err != nil {
+			return fmt.Errorf("failed to read index: %w", err)
+		}
+
+		var conv *converter
+		if lsFilesDeleted || lsFilesModified {
+			conv, err = newConverter(r, attrCheckin, cmd.ErrOrStderr())
+			if err != nil {
+				return err
+			}
+			defer conv.Close()
+		}
+
+		out := cmd.OutOrStdout()
+		spec := newPathspec(args)
+
+		if lsFilesOthers {
+			var ignore gitignore.Matcher
+			if lsFilesExcludeStandard {
+				ignore, err = standardIgnoreRules(r, w)
+				if err != nil {
+					return err
+				}
+			}
+
+			others, err := untrackedFiles(w, idx, ignore)
+			if err != nil {
+				return err
+			}
+
+			for _, p := range others {
+				if spec.matches(strings.TrimSuffix(p, "/")) {
+					printPath(out, p, lsFilesNul)
+				}
+			}
+		}
+
+		showStage := lsFilesStage || lsFilesUnmerged
+		showCached := lsFilesCached || showStage || !(lsFilesModified || lsFilesOthers || lsFilesDeleted)
+
+		for _, e := range idx.Entries {
+			if !spec.matches(e.Name) {
+				continue
+			}
+
+			if showCached && (!lsFilesUnmerged || e.Stage != 0) {
+				printIndexEntry(out, e, showStage)
+			}
+
+			if (!lsFilesDeleted && !lsFilesModified) || e.SkipWorktree {
+				continue
+			}
+
+			deleted, modified, err := worktreeChanges(w.Filesystem, e, conv)
+			if err != nil {
+				return err
+			}
+
+			if lsFilesDeleted && deleted {
+				printIndexEntry(out, e, showStage)
+			}
+
+			if lsFilesModified && modified {
+				printIndexEntry(out, e, showStage)
+			}
+		}
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+func printIndexEntry(out io.Writer, e *index.Entry, stage bool) {
+	if stage {
+		fmt.Fprintf(out, "%06o %s %d\t", uint32(e.Mode), e.Hash, e.Stage)
+	}
+
+	printPath(out, e.Name, lsFilesNul)
+}
+
+// printPath prints a path on its own line, quoted as git does unless the
+// line is terminated by a NUL.
+func printPath(out io.Writer, p string, nul bool) {
+	if nul {
+		fmt.Fprintf(out, "%s\x00", p)
+
+		return
+	}
+
+	fmt.Fprintln(out, quotePath(p))
+}
+
+// quotePath quotes p in the C style git uses for paths with control
+// characters, quotes, backslashes or bytes outside of ASCII.
+func quotePath(p string) string {
+	needsQuoting := false
+
+	for i := 0; i < len(p); i++ {
+		if c := p[i]; c < 0x20 || c == '"' || c == '\\' || c >= 0x7f {
+			needsQuoting = true
+
+			break
+		}
+	}
+
+	if !needsQuoting {
+		return p
+	}
+
+	var sb strings.Builder
+
+	sb.WriteByte('"')
+
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+
+		switch c {
+		case '\a':
+			sb.WriteString(`\a`)
+		case '\b':
+			sb.WriteString(`\b`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\v':
+			sb.WriteString(`\v`)
+		case '\f':
+			sb.WriteString(`\f`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '"', '\\':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		default:
+			if c < 0x20 || c >= 0x7f {
+				fmt.Fprintf(&sb, "\\%03o", c)
+			} else {
+				sb.WriteByte(c)
+			}
+		}
+	}
+
+	sb.WriteByte('"')
+
+	return sb.String()
+}
+
+// worktreeChanges reports whether the working tree file of the index entry
+// e is missing, and whether it differs from e once converted by conv.
+func worktreeChanges(fs billy.Filesystem, e *index.Entry, conv *converter) (bool, bool, error) {
+	fi, err := fs.Lstat(e.Name)
+	if err != nil {
+		return true, true, nil
+	}
+
+	if e.Mode == filemode.Submodule {
+		return false, !fi.IsDir(), nil
+	}
+
+	mode, err := filemode.NewFromOSFileMode(fi.Mode())
+	if err != nil || mode != e.Mode {
+		return false, true, nil
+	}
+
+	if fi.Size() == int64(e.Size) && fi.ModTime().Equal(e.ModifiedAt) {
+		return false, false, nil
+	}
+
+	var data []byte
+
+	if mode == filemode.Symlink {
+		target, err := fs.Readlink(e.Name)
+		if err != nil {
+			return false, false, fmt.Errorf("failed to read %s: %w", e.Name, err)
+		}
+
+		data = []byte(target)
+	} else {
+		data, err = util.ReadFile(fs, e.Name)
+		if err != nil {
+			return false, false, fmt.Errorf("failed to read %s: %w", e.Name, err)
+		}
+
+		data, err = conv.toGit(e.Name, data)
+		if err != nil {
+			return false, false, err
+		}
+	}
+
+	obj, err := newObject(memory.NewStorage(), plumbing.BlobObject, data)
+	if err != nil {
+		return false, false, err
+	}
+
+	return false, obj.Hash() != e.Hash, nil
+}
+
+// untrackedFiles returns the sorted paths of the files in the working tree
+// that are not in the index, with nested repositories listed as "<dir>/".
+// The files ignore matches, if not nil, are left out.
+func untrackedFiles(w *git.Worktree, idx *index.Index, ignore gitignore.Matcher) ([]string, error) {
+	u := &untrackedWalk{
+		fs:          w.Filesystem,
+		tracked:     make(map[string]bool, len(idx.Entries)),
+		trackedDirs: make(map[string]bool),
+		ignore:      ignore,
+	}
+
+	for _, e := range idx.Entries {
+		u.tracked[e.Name] = true
+
+		for dir := path.Dir(e.Name); dir != "."; dir = path.Dir(dir) {
+			u.trackedDirs[dir] = true
+		}
+	}
+
+	err := u.walk("")
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(u.paths)
+
+	return u.paths, nil
+}
+
+type untrackedWalk struct {
+	fs          billy.Filesystem
+	tracked     map[string]bool
+	trackedDirs map[string]bool
+	ignore      gitignore.Matcher
+	paths       []string
+}
+
+func (u *untrackedWalk) walk(dir string) error {
+	entries, err := u.fs.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read directory %q: %w", dir, err)
+	}
+
+	for _, e := range entries {
+		p := path.Join(dir, e.Name())
+		if e.Name() == git.GitDirName || u.tracked[p] || u.ignored(p, e.IsDir()) {
+			continue
+		}
+
+		if !e.IsDir() {
+			u.paths = append(u.paths, p)
+
+			continue
+		}
+
+		if !u.trackedDirs[p] {
+			if _, err := u.fs.Lstat(path.Join(p, git.GitDirName)); err == nil {
+				u.paths = append(u.paths, p+"/")
+
+				continue
+			}
+		}
+
+		err = u.walk(p)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (u *untrackedWalk) ignored(p string, isDir bool) bool {
+	return u.ignore != nil && u.ignore.Match(strings.Split(p, "/"), isDir)
+}
+
+// pathspec matches paths against the pathspecs given on the command line:
+// a path matches a pathspec naming it or one of its directories, or a
+// wildcard pattern whose "*" also matches slashes.
+type pathspec struct {
+	prefixes []string
+	patterns []*regexp.Regexp
+}
+
+func newPathspec(specs []string) *pathspec {
+	s := &pathspec{}
+
+	for _, spec := range specs {
+		s.prefixes = append(s.prefixes, strings.TrimSuffix(path.Clean(spec), "/"))
+
+		if strings.ContainsAny(spec, "*?[") {
+			if re, err := regexp.Compile(wildcardPattern(spec)); err == nil {
+				s.patterns = append(s.patterns, re)
+			}
+		}
+	}
+
+	return s
+}
+
+func (s *pathspec) matches(p string) bool {
+	if len(s.prefixes) == 0 {
+		return true
+	}
+
+	for _, prefix := range s.prefixes {
+		if prefix == "." || p == prefix || strings.HasPrefix(p, prefix+"/") {
+			return true
+		}
+	}
+
+	for _, re := range s.patterns {
+		if re.MatchString(p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// wildcardPattern translates a pathspec with wildcards into an anchored
+// regular expression.
+func wildcardPattern(spec string) string {
+	var sb strings.Builder
+
+	sb.WriteByte('^')
+
+	for i := 0; i < len(spec); i++ {
+		switch c := spec[i]; c {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteByte('.')
+		case '[':
+			end := strings.IndexByte(spec[i+1:], ']')
+			if end < 0 {
+				sb.WriteString(`\[`)
+
+				continue
+			}
+
+			class := spec[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+
+			sb.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	sb.WriteByte('$')
+
+	return sb.String()
+}
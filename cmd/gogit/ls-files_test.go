@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLsFiles(t *testing.T) {
+	dir := lsRepo(t)
+
+	for _, args := range []string{
+		"",
+		"-s",
+		"-m",
+		"-d",
+		"-o",
+		"-o --exclude-standard",
+		"-z",
+		"d",
+		"-s d/e",
+	} {
+		t.Run(args, func(t *testing.T) {
+			sameOutput(t, dir, append([]string{"ls-files"}, strings.Fields(args)...)...)
+		})
+	}
+}
+
+func TestLsFilesConflicts(t *testing.T) {
+	dir := gitRepo(t, []string{"a", "1", "b", "1"})
+	gitCmd(t, dir, "checkout", "-q", "-b", "topic")
+	writeFile(t, dir, "a", "2")
+	gitCmd(t, dir, "commit", "-q", "-a", "-m", "topic")
+	gitCmd(t, dir, "checkout", "-q", "main")
+	writeFile(t, dir, "a", "3")
+	gitCmd(t, dir, "commit", "-q", "-a", "-m", "main")
+
+	if res := run(t, dir, "", "git", "merge", "topic"); res.code == 0 {
+		t.Fatal("the merge did not conflict")
+	}
+
+	for _, args := range []string{"", "-s", "--stage -z", "-u", "-m"} {
+		sameOutput(t, dir, append([]string{"ls-files"}, strings.Fields(args)...)...)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/storage/memory"
+	"github.com/spf13/cobra"
+)
+
+const peeledRefSuffix = "^{}"
+
+var (
+	lsRemoteHeads    bool
+	lsRemoteTags     bool
+	lsRemoteSymref   bool
+	lsRemoteExitCode bool
+)
+
+func init() {
+	lsRemoteCmd.Flags().BoolVarP(&lsRemoteHeads, "heads", "", false, "Limit to branches")
+	lsRemoteCmd.Flags().BoolVarP(&lsRemoteTags, "tags", "t", false, "Limit to tags")
+	lsRemoteCmd.Flags().BoolVarP(&lsRemoteSymref, "symref", "", false, "Show the targets of symbolic references")
+	lsRemoteCmd.Flags().BoolVarP(&lsRemoteExitCode, "exit-code", "", false, "Exit with status 2 when no matching references are found")
+	rootCmd.AddCommand(lsRemoteCmd)
+}
+
+var lsRemoteCmd = &cobra.Command{
+	Use:   "ls-remote [--heads] [--tags] [--symref] [--exit-code] [<repository> [<pattern>...]]",
+	Short: "List references in a remote repository",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		remote, err := lsRemoteTarget(args)
+		if err != nil {
+			return err
+		}
+
+		ep, err := url.Parse(remote.Config().URLs[0])
+		if err != nil {
+			return err
+		}
+
+		refs, err := remote.List(&git.ListOptions{
+			ClientOptions: defaultClientOptions(ep),
+			PeelingOption: git.AppendPeeled,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list remote references: %w", err)
+		}
+
+		sortRemoteRefs(refs)
+
+		var patterns []string
+		if len(args) > 1 {
+			patterns = args[1:]
+		}
+
+		hashes := make(map[plumbing.ReferenceName]plumbing.Hash, len(refs))
+		for _, ref := range refs {
+			hashes[ref.Name()] = ref.Hash()
+		}
+
+		out := cmd.OutOrStdout()
+		found := false
+
+		for _, ref := range refs {
+			name := ref.Name()
+
+			if (lsRemoteHeads || lsRemoteTags) && !(lsRemoteHeads && name.IsBranch()) && !(lsRemoteTags && name.IsTag()) {
+				continue
+			}
+
+			if len(patterns) > 0 && !matchesRefTail(name, patterns) {
+				continue
+			}
+
+			h := ref.Hash()
+
+			if ref.Type() == plumbing.SymbolicReference {
+				if lsRemoteSymref {
+					fmt.Fprintf(out, "ref: %s\t%s\n", ref.Target(), ref.Name())
+				}
+
+				h = hashes[ref.Target()]
+			}
+
+			fmt.Fprintf(out, "%s\t%s\n", h, ref.Name())
+
+			found = true
+		}
+
+		if !found && lsRemoteExitCode {
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+
+			return exitStatus(2)
+		}
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// lsRemoteTarget returns the remote named by the first argument, which may
+// also be a URL, or else the remote of the current branch or origin.
+func lsRemoteTarget(args []string) (*git.Remote, error) {
+	r, err := git.PlainOpen(".")
+	if err != nil && len(args) == 0 {
+		return nil, errors.New("no remote configured to list refs from")
+	}
+
+	if err == nil {
+		name := git.DefaultRemoteName
+		if len(args) > 0 {
+			name = args[0]
+		} else if branch, err := currentBranch(r); err == nil {
+			cfg, err := r.Config()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get repository config: %w", err)
+			}
+
+			if b, ok := cfg.Branches[branch.Short()]; ok && b.Remote != "" {
+				name = b.Remote
+			}
+		}
+
+		remote, err := r.Remote(name)
+		if err == nil || len(args) == 0 {
+			return remote, err
+		}
+	}
+
+	return git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: "anonymous",
+		URLs: []string{args[0]},
+	}), nil
+}
+
+// sortRemoteRefs orders refs as git servers advertise them: HEAD first,
+// then by name, with peeled tags after the tags themselves.
+func sortRemoteRefs(refs []*plumbing.Reference) {
+	sort.SliceStable(refs, func(i, j int) bool {
+		a, b := refs[i].Name().String(), refs[j].Name().String()
+
+		if a == plumbing.HEAD.String() || b == plumbing.HEAD.String() {
+			return a == plumbing.HEAD.String() && b != a
+		}
+
+		ba, bb := strings.TrimSuffix(a, peeledRefSuffix), strings.TrimSuffix(b, peeledRefSuffix)
+		if ba != bb {
+			return ba < bb
+		}
+
+		return len(a) < len(b)
+	})
+}
+
+// matchesRefTail reports whether one of patterns matches the end of name
+// after a slash, or the whole of it, as git's "*/<pattern>" does.
+func matchesRefTail(name plumbing.ReferenceName, patterns []string) bool {
+	for _, p := range patterns {
+		if wildmatch("*/"+p, "/"+name.String(), false) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLsRemote(t *testing.T) {
+	remote := refsRepo(t)
+	dir := gitRepo(t)
+
+	for _, tt := range []struct{ opts, patterns string }{
+		{},
+		{opts: "--heads"},
+		{opts: "--tags"},
+		{opts: "--symref"},
+		{patterns: "HEAD"},
+		{patterns: "main"},
+		{patterns: "v*"},
+		{patterns: "heads/*"},
+		{patterns: "refs/*"},
+		{opts: "--tags", patterns: "[lv]*"},
+		{opts: "--symref", patterns: "tags/v1 HEAD"},
+	} {
+		t.Run(tt.opts+" "+tt.patterns, func(t *testing.T) {
+			args := append([]string{"ls-remote"}, strings.Fields(tt.opts)...)
+			args = append(args, remote)
+			args = append(args, strings.Fields(tt.patterns)...)
+
+			sameOutput(t, dir, args...)
+		})
+	}
+}
+
+func TestLsRemoteExitCode(t *testing.T) {
+	remote := refsRepo(t)
+
+	res := gogit(t, remote, "ls-remote", "--exit-code", ".", "nope")
+	if res.code != 2 || res.stdout != "" {
+		t.Errorf("ls-remote --exit-code without matches exited with %d:\n%s", res.code, res.stdout)
+	}
+}
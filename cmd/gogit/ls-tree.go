@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/spf13/cobra"
+)
+
+const defaultLsTreeFormat = "%(objectmode) %(objecttype) %(objectname)\t%(path)"
+
+var (
+	lsTreeRecursive bool
+	lsTreeShowTrees bool
+	lsTreeLong      bool
+	lsTreeTreesOnly bool
+	lsTreeNameOnly  bool
+	lsTreeNul       bool
+	lsTreeFormat    string
+)
+
+func init() {
+	lsTreeCmd.Flags().BoolVarP(&lsTreeRecursive, "recursive", "r", false, "Recurse into subtrees")
+	lsTreeCmd.Flags().BoolVarP(&lsTreeShowTrees, "show-trees", "t", false, "Show the trees recursed into")
+	lsTreeCmd.Flags().BoolVarP(&lsTreeLong, "long", "l", false, "Show the size of blobs")
+	lsTreeCmd.Flags().BoolVarP(&lsTreeTreesOnly, "trees-only", "d", false, "Show only trees")
+	lsTreeCmd.Flags().BoolVarP(&lsTreeNameOnly, "name-only", "", false, "Show only the paths")
+	lsTreeCmd.Flags().BoolVarP(&lsTreeNul, "null", "z", false, "Terminate lines with NUL and do not quote paths")
+	lsTreeCmd.Flags().StringVarP(&lsTreeFormat, "format", "", "", "Format entries with %(objectmode), %(objecttype), %(objectname), %(objectsize[:padded]) and %(path)")
+	rootCmd.AddCommand(lsTreeCmd)
+}
+
+var lsTreeCmd = &cobra.Command{
+	Use:   "ls-tree [-r] [-t] [-d] [-l] [-z] [--name-only] [--format=<format>] <tree-ish> [<path>...]",
+	Short: "List the contents of a tree object",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		h, err := resolveObject(r, args[0])
+		if err != nil {
+			return fmt.Errorf("not a valid object name %s", args[0])
+		}
+
+		obj, err := r.Object(plumbing.AnyObject, h)
+		if err != nil {
+			return fmt.Errorf("not a tree object: %w", err)
+		}
+
+		tree, err := peelToTree(obj)
+		if err != nil {
+			return fmt.Errorf("not a tree object: %w", err)
+		}
+
+		format := lsTreeFormat
+		switch {
+		case format != "":
+		case lsTreeNameOnly:
+			format = "%(path)"
+		case lsTreeLong:
+			format = "%(objectmode) %(objecttype) %(objectname) %(objectsize:padded)\t%(path)"
+		default:
+			format = defaultLsTreeFormat
+		}
+
+		f, err := parseFormat(format, lsTreeEscape)
+		if err != nil {
+			return err
+		}
+
+		l := &treeLister{r: r, out: cmd.OutOrStdout(), format: f, paths: args[1:]}
+
+		return l.list(tree, "")
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// lsTreeEscape decodes the %n and %x<hex> escapes of ls-tree --format, any
+// other '%' not starting an atom being an error.
+func lsTreeEscape(s string) (string, int, error) {
+	if strings.HasPrefix(s, "n") {
+		return "\n", 1, nil
+	}
+
+	if strings.HasPrefix(s, "x") {
+		if text, n, _ := hexEscape(s[1:]); n > 0 {
+			return text, n + 1, nil
+		}
+	}
+
+	return "", 0, fmt.Errorf("bad ls-tree format: element '%s' does not start with '('", s)
+}
+
+// treeLister prints the entries of a tree selected by ls-tree's options and
+// paths.
+type treeLister struct {
+	r      *git.Repository
+	out    io.Writer
+	format *atomFormat
+	paths  []string
+}
+
+func (l *treeLister) list(tree *object.Tree, base string) error {
+	for _, e := range tree.Entries {
+		p := base + e.Name
+		inScope, above := l.match(p)
+
+		if !inScope && !above {
+			continue
+		}
+
+		if e.Mode != filemode.Dir {
+			if inScope && !lsTreeTreesOnly {
+				err := l.print(e, p)
+				if err != nil {
+					return err
+				}
+			}
+
+			continue
+		}
+
+		// Trees are listed in place of their contents unless they are
+		// recursed into, which happens with -r or to reach a given path.
+		// Like git, -d with -r implies -t.
+		descend := above || lsTreeRecursive
+
+		if !descend || lsTreeShowTrees || (lsTreeTreesOnly && lsTreeRecursive) {
+			err := l.print(e, p)
+			if err != nil {
+				return err
+			}
+		}
+
+		if !descend {
+			continue
+		}
+
+		sub, err := l.r.TreeObject(e.Hash)
+		if err != nil {
+			return fmt.Errorf("failed to read tree %s: %w", e.Hash, err)
+		}
+
+		err = l.list(sub, p+"/")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// match reports whether p is selected by the paths, either itself or
+// through one of its directories, and whether a path lies below p.
+func (l *treeLister) match(p string) (bool, bool) {
+	if len(l.paths) == 0 {
+		return true, false
+	}
+
+	var inScope, above bool
+
+	for _, spec := range l.paths {
+		trimmed := strings.TrimSuffix(spec, "/")
+
+		switch {
+		case strings.HasPrefix(spec, p+"/"):
+			above = true
+		case p == trimmed || strings.HasPrefix(p, trimmed+"/"):
+			inScope = true
+		}
+	}
+
+	return inScope, above
+}
+
+func (l *treeLister) print(e object.TreeEntry, p string) error {
+	line, err := l.format.expand(func(atom string) (string, error) {
+		return l.field(e, p, atom)
+	})
+	if err != nil {
+		return err
+	}
+
+	if lsTreeNul {
+		fmt.Fprintf(l.out, "%s\x00", line)
+	} else {
+		fmt.Fprintln(l.out, line)
+	}
+
+	return nil
+}
+
+func (l *treeLister) field(e object.TreeEntry, p, atom string) (string, error) {
+	switch atom {
+	case "objectmode":
+		return fmt.Sprintf("%06o", uint32(e.Mode)), nil
+	case "objecttype":
+		return treeEntryType(e.Mode).String(), nil
+	case "objectname":
+		return e.Hash.String(), nil
+	case "objectsize", "objectsize:padded":
+		size := "-"
+
+		if treeEntryType(e.Mode) == plumbing.BlobObject {
+			obj, err := l.r.Storer.EncodedObject(plumbing.BlobObject, e.Hash)
+			if err != nil {
+				return "", fmt.Errorf("could not get object info about '%s'", e.Hash)
+			}
+
+			size = strconv.FormatInt(obj.Size(), 10)
+		}
+
+		if atom == "objectsize:padded" {
+			size = fmt.Sprintf("%7s", size)
+		}
+
+		return size, nil
+	case "path":
+		if lsTreeNul {
+			return p, nil
+		}
+
+		return quotePath(p), nil
+	default:
+		return "", fmt.Errorf("bad ls-tree format: %%(%s)", atom)
+	}
+}
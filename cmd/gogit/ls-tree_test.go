@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// lsRepo returns a repository made by git with nested directories, a tag
+// and changed, deleted, untracked and ignored files in its worktree.
+func lsRepo(t *testing.T) string {
+	t.Helper()
+
+	dir := gitRepo(t, []string{"a", "1", "d/b", "2", "d/e/c", "3", ".gitignore", "*.log\n"})
+	gitCmd(t, dir, "tag", "-a", "-m", "v1", "v1")
+
+	writeFile(t, dir, "d/b", "changed")
+	writeFile(t, dir, "u", "untracked")
+	writeFile(t, dir, "x.log", "ignored")
+
+	err := os.Remove(filepath.Join(dir, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func TestLsTree(t *testing.T) {
+	dir := lsRepo(t)
+
+	for _, args := range []string{
+		"HEAD",
+		"-r HEAD",
+		"-r -t HEAD",
+		"-d HEAD",
+		"-l -r HEAD",
+		"--name-only -r HEAD d",
+		"-z HEAD",
+		"HEAD d/",
+		"-r HEAD:d",
+		"v1 d/e",
+	} {
+		t.Run(args, func(t *testing.T) {
+			sameOutput(t, dir, append([]string{"ls-tree"}, strings.Fields(args)...)...)
+		})
+	}
+}
+
+func TestLsTreeFormat(t *testing.T) {
+	dir := lsRepo(t)
+
+	for _, format := range []string{
+		"%(path)%x09%(objectname)%n%%x|%x41",
+		"%(objectmode) %(objecttype) %(objectsize) %(objectsize:padded)%x00%(path)",
+	} {
+		sameOutput(t, dir, "ls-tree", "-r", "--format="+format, "HEAD")
+	}
+
+	for _, format := range []string{"%z", "%(path)%x0", "%(path)%"} {
+		if res := gogit(t, dir, "ls-tree", "--format="+format, "HEAD"); res.code == 0 {
+			t.Errorf("ls-tree --format=%s succeeded:\n%s", format, res.stdout)
+		}
+	}
+}
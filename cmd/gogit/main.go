@@ -5,10 +5,16 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/config"
 	"github.com/go-git/go-git/v6/plumbing/client"
+	formatcfg "github.com/go-git/go-git/v6/plumbing/format/config"
 	"github.com/go-git/go-git/v6/plumbing/transport"
+	xhttp "github.com/go-git/go-git/v6/plumbing/transport/http"
 	"github.com/go-git/go-git/v6/plumbing/transport/ssh"
 	"github.com/go-git/go-git/v6/utils/trace"
 	"github.com/spf13/cobra"
@@ -49,7 +55,15 @@ func init() {
 func main() {
 	err := rootCmd.Execute()
 	if err != nil {
-		var rerr *transport.RemoteError
+		var (
+			rerr   *transport.RemoteError
+			status exitStatus
+		)
+
+		if errors.As(err, &status) {
+			os.Exit(int(status))
+		}
+
 		if errors.As(err, &rerr) {
 			fmt.Fprintln(os.Stderr, rerr)
 		} else {
@@ -86,7 +100,136 @@ func defaultClientOptions(u *url.URL) []client.Option {
 
 		return []client.Option{client.WithSSHAuth(a)}
 	case "http", "https":
+		if a := defaultHTTPAuth(u); a != nil {
+			return []client.Option{client.WithHTTPAuth(a)}
+		}
 	}
 
 	return nil
 }
+
+// defaultHTTPAuth returns the authentication defaultClientOptions gives the
+// HTTP transports for u, the basic authentication of its user information,
+// if any.
+func defaultHTTPAuth(u *url.URL) client.HTTPAuth {
+	if u.User == nil {
+		return nil
+	}
+
+	password, _ := u.User.Password()
+
+	return &xhttp.BasicAuth{Username: u.User.Username(), Password: password}
+}
+
+// configOption returns an option of the repository configuration. The raw
+// configuration is missing when go-git merges config.worktree into it.
+func configOption(cfg *config.Config, section, key string) string {
+	if cfg.Raw == nil {
+		return ""
+	}
+
+	return cfg.Raw.Section(section).Option(key)
+}
+
+// scopedConfigOption returns an option the way git looks it up: in the
+// repository configuration, or else in the global or system one. go-git
+// keeps only the sections it knows when it merges those, so they are read
+// raw.
+func scopedConfigOption(r *git.Repository, section, subsection, key string) string {
+	v, _ := lookupScopedConfigOption(r, section, subsection, key)
+
+	return v
+}
+
+// scopedConfigBool is scopedConfigOption for boolean options, a key
+// without a value being true.
+func scopedConfigBool(r *git.Repository, section, subsection, key string) bool {
+	v, ok := lookupScopedConfigOption(r, section, subsection, key)
+	if ok && v == "" {
+		return true
+	}
+
+	b, _ := strconv.ParseBool(v)
+
+	return b
+}
+
+func lookupScopedConfigOption(r *git.Repository, section, subsection, key string) (string, bool) {
+	for _, raw := range scopedConfigs(r) {
+		if !raw.HasSection(section) {
+			continue
+		}
+
+		s := raw.Section(section)
+
+		switch {
+		case subsection == "" && s.HasOption(key):
+			return s.Option(key), true
+		case subsection != "" && s.HasSubsection(subsection) && s.Subsection(subsection).HasOption(key):
+			return s.Subsection(subsection).Option(key), true
+		}
+	}
+
+	return "", false
+}
+
+// scopedConfigs returns the raw repository, global and system
+// configurations, by decreasing priority. Missing files are left out.
+func scopedConfigs(r *git.Repository) []*formatcfg.Config {
+	var configs []*formatcfg.Config
+
+	if cfg, err := r.Config(); err == nil && cfg.Raw != nil {
+		configs = append(configs, cfg.Raw)
+	}
+
+	var files []string
+
+	if global, ok := os.LookupEnv("GIT_CONFIG_GLOBAL"); ok {
+		files = append(files, global)
+	} else if home, err := os.UserHomeDir(); err == nil {
+		xdg := os.Getenv("XDG_CONFIG_HOME")
+		if xdg == "" {
+			xdg = filepath.Join(home, ".config")
+		}
+
+		files = append(files, filepath.Join(home, ".gitconfig"), filepath.Join(xdg, "git", "config"))
+	}
+
+	if ok, _ := strconv.ParseBool(os.Getenv("GIT_CONFIG_NOSYSTEM")); !ok {
+		system, ok := os.LookupEnv("GIT_CONFIG_SYSTEM")
+		if !ok {
+			system = "/etc/gitconfig"
+		}
+
+		files = append(files, system)
+	}
+
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			continue
+		}
+
+		raw := formatcfg.New()
+		err = formatcfg.NewDecoder(f).Decode(raw)
+		_ = f.Close()
+
+		if err == nil {
+			configs = append(configs, raw)
+		}
+	}
+
+	return configs
+}
+
+// expandHome expands a leading "~/" of a path read from the configuration
+// into the home directory, as git does.
+func expandHome(p string) string {
+	if rest, ok := strings.CutPrefix(p, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+
+	return p
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// testMainEnv makes the test binary run gogit instead of the tests, so
+// that each command runs in its own process, with fresh flags.
+const testMainEnv = "GOGIT_TEST_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(testFilterEnv) == "1" {
+		err := filterProcessMain()
+		if err != nil {
+			os.Exit(1)
+		}
+
+		os.Exit(0)
+	}
+
+	if os.Getenv(testMainEnv) == "1" {
+		main()
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+// testEnv is the environment gogit and git run in, isolated from the user
+// configuration and with a fixed identity and dates.
+func testEnv() []string {
+	return append(os.Environ(),
+		testMainEnv+"=1",
+		"GIT_CONFIG_GLOBAL="+os.DevNull,
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_AUTHOR_NAME=A U Thor",
+		"GIT_AUTHOR_EMAIL=author@example.com",
+		"GIT_AUTHOR_DATE=1700000000 +0000",
+		"GIT_COMMITTER_NAME=C O Mitter",
+		"GIT_COMMITTER_EMAIL=committer@example.com",
+		"GIT_COMMITTER_DATE=1700000000 +0000",
+	)
+}
+
+// result is the outcome of a command run by gogit or git.
+type result struct {
+	stdout, stderr string
+	code           int
+}
+
+func run(t *testing.T, dir, stdin, name string, args ...string) result {
+	t.Helper()
+
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	cmd.Env = testEnv()
+	cmd.Stdin = strings.NewReader(stdin)
+
+	var stdout, stderr bytes.Buffer
+
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+	err := cmd.Run()
+
+	var exitErr *exec.ExitError
+
+	switch {
+	case errors.As(err, &exitErr):
+		return result{stdout.String(), stderr.String(), exitErr.ExitCode()}
+	case err != nil:
+		t.Fatalf("failed to run %s %v: %v", name, args, err)
+	}
+
+	return result{stdout.String(), stderr.String(), 0}
+}
+
+// gogit runs gogit in dir and returns its result.
+func gogit(t *testing.T, dir string, args ...string) result {
+	t.Helper()
+
+	return run(t, dir, "", os.Args[0], args...)
+}
+
+// gogitStdin runs gogit in dir with stdin as its standard input.
+func gogitStdin(t *testing.T, dir, stdin string, args ...string) result {
+	t.Helper()
+
+	return run(t, dir, stdin, os.Args[0], args...)
+}
+
+// mustGogit runs gogit in dir, failing the test unless it succeeds, and
+// returns its standard output.
+func mustGogit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	res := gogit(t, dir, args...)
+	if res.code != 0 {
+		t.Fatalf("gogit %v exited with %d: %s", args, res.code, res.stderr)
+	}
+
+	return res.stdout
+}
+
+// requireGit skips the test when git is not installed.
+func requireGit(t *testing.T) {
+	t.Helper()
+
+	_, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git is not installed")
+	}
+}
+
+// gitCmd runs git in dir, failing the test unless it succeeds, and returns
+// its standard output.
+func gitCmd(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	return gitCmdStdin(t, dir, "", args...)
+}
+
+// gitCmdStdin runs git in dir with stdin as its standard input, failing
+// the test unless it succeeds, and returns its standard output.
+func gitCmdStdin(t *testing.T, dir, stdin string, args ...string) string {
+	t.Helper()
+
+	res := run(t, dir, stdin, "git", args...)
+	if res.code != 0 {
+		t.Fatalf("git %v exited with %d: %s", args, res.code, res.stderr)
+	}
+
+	return res.stdout
+}
+
+// gitRepo creates a repository with git, with a history of commits each
+// writing the files given as name and content pairs.
+func gitRepo(t *testing.T, commits ...[]string) string {
+	t.Helper()
+	requireGit(t)
+
+	dir := t.TempDir()
+	gitCmd(t, dir, "init", "-q", "-b", "main")
+
+	for i, files := range commits {
+		for j := 0; j+1 < len(files); j += 2 {
+			writeFile(t, dir, files[j], files[j+1])
+		}
+
+		gitCmd(t, dir, "add", "-A")
+		gitCmd(t, dir, "commit", "-q", "--allow-empty", "-m", "commit "+strconv.Itoa(i+1))
+	}
+
+	return dir
+}
+
+// writeFile writes contents to the file name of dir, creating its parent
+// directories.
+func writeFile(t *testing.T, dir, name, contents string) {
+	t.Helper()
+
+	p := filepath.Join(dir, filepath.FromSlash(name))
+
+	err := os.MkdirAll(filepath.Dir(p), 0o755)
+	if err == nil {
+		err = os.WriteFile(p, []byte(contents), 0o644)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// exists reports whether the file name of dir exists.
+func exists(t *testing.T, dir, name string) bool {
+	t.Helper()
+
+	_, err := os.Lstat(filepath.Join(dir, filepath.FromSlash(name)))
+
+	return err == nil
+}
+
+// sameOutput runs the same command with git and gogit in dir, and fails
+// the test unless their standard outputs are equal.
+func sameOutput(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	want := gitCmd(t, dir, args...)
+
+	got := mustGogit(t, dir, args...)
+	if got != want {
+		t.Errorf("gogit %v:\n%s\nwant, as git:\n%s", args, got, want)
+	}
+
+	return got
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/object/commitgraph"
+	"github.com/spf13/cobra"
+)
+
+var (
+	mergeBaseAll        bool
+	mergeBaseOctopus    bool
+	mergeBaseIsAncestor bool
+	mergeBaseForkPoint  bool
+)
+
+func init() {
+	mergeBaseCmd.Flags().BoolVarP(&mergeBaseAll, "all", "a", false, "Output all merge bases instead of one")
+	mergeBaseCmd.Flags().BoolVarP(&mergeBaseOctopus, "octopus", "", false, "Compute the best common ancestors of all the commits, for an n-way merge")
+	mergeBaseCmd.Flags().BoolVarP(&mergeBaseIsAncestor, "is-ancestor", "", false, "Exit with status 0 if the first commit is an ancestor of the second, and 1 if not")
+	mergeBaseCmd.Flags().BoolVarP(&mergeBaseForkPoint, "fork-point", "", false, "Find where a commit forked from the history recorded in the reflog of a reference")
+	rootCmd.AddCommand(mergeBaseCmd)
+}
+
+var mergeBaseCmd = &cobra.Command{
+	Use:   "merge-base [--all] [--octopus | --is-ancestor | --fork-point] <commit>...",
+	Short: "Find the best common ancestors of commits",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		modes := 0
+		for _, set := range []bool{mergeBaseOctopus, mergeBaseIsAncestor, mergeBaseForkPoint} {
+			if set {
+				modes++
+			}
+		}
+
+		switch {
+		case modes > 1:
+			return errors.New("--octopus, --is-ancestor and --fork-point cannot be used together")
+		case mergeBaseIsAncestor && len(args) != 2:
+			return errors.New("--is-ancestor takes exactly two commits")
+		case mergeBaseForkPoint && (len(args) < 1 || len(args) > 2):
+			return errors.New("--fork-point takes a reference and an optional commit")
+		case mergeBaseOctopus && len(args) < 1:
+			return errors.New("--octopus takes at least one commit")
+		case modes == 0 && len(args) < 2:
+			return errors.New("at least two commits are needed")
+		}
+
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		var bases []plumbing.Hash
+
+		if mergeBaseForkPoint {
+			bases, err = forkPoint(r, args)
+		} else {
+			commits := make([]plumbing.Hash, len(args))
+
+			for i, arg := range args {
+				// Like git, an unknown commit is fatal, which --is-ancestor
+				// tells apart from a commit that is not an ancestor.
+				c, err := resolveCommit(r, arg)
+				if err != nil {
+					fmt.Fprintf(cmd.ErrOrStderr(), "fatal: Not a valid object name %s\n", arg)
+					cmd.SilenceErrors = true
+					cmd.SilenceUsage = true
+
+					return exitStatus(128)
+				}
+
+				commits[i] = c.Hash
+			}
+
+			switch {
+			case mergeBaseIsAncestor:
+				var ok bool
+
+				ok, err = isAncestor(r, commits[0], commits[1])
+				if ok {
+					return nil
+				}
+			case mergeBaseOctopus:
+				bases, err = octopusMergeBases(r, commits)
+			default:
+				bases, err = mergeBases(r, commits[0], commits[1:])
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if len(bases) == 0 {
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+
+			return exitStatus(1)
+		}
+
+		if !mergeBaseAll {
+			bases = bases[:1]
+		}
+
+		for _, h := range bases {
+			fmt.Fprintln(cmd.OutOrStdout(), h)
+		}
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// Flags painted on commits while looking for merge bases.
+const (
+	paintOne = 1 << iota
+	paintTwo
+	paintStale
+	paintResult
+)
+
+// paintDownToCommon walks down from one and twos, newest first, painting
+// the commits reachable from each side, the way git does. The commits
+// reached from both sides that are not below another such commit are
+// returned newest first, along with the paint of every commit walked.
+func paintDownToCommon(r *git.Repository, one plumbing.Hash, twos []plumbing.Hash) ([]commitgraph.CommitNode, map[plumbing.Hash]int, error) {
+	nodes := commitNodeIndex(r)
+	paint := make(map[plumbing.Hash]int)
+
+	var (
+		queue  commitHeap
+		queued int
+	)
+
+	push := func(h plumbing.Hash, p int) error {
+		n, err := nodes.Get(h)
+		if err != nil {
+			return fmt.Errorf("failed to read commit %s: %w", h, err)
+		}
+
+		paint[h] |= p
+		queued++
+		heap.Push(&queue, queuedCommit{n, queued})
+
+		return nil
+	}
+
+	err := push(one, paintOne)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, h := range twos {
+		err := push(h, paintTwo)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var found []commitgraph.CommitNode
+
+	for hasUnstale(queue, paint) {
+		c := heap.Pop(&queue).(queuedCommit).commit
+		p := paint[c.ID()] & (paintOne | paintTwo | paintStale)
+
+		if p == paintOne|paintTwo {
+			if paint[c.ID()]&paintResult == 0 {
+				paint[c.ID()] |= paintResult
+				found = append(found, c)
+			}
+
+			p |= paintStale
+		}
+
+		for _, parent := range c.ParentHashes() {
+			if paint[parent]&p == p {
+				continue
+			}
+
+			err := push(parent, p)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	var result []commitgraph.CommitNode
+
+	for _, c := range found {
+		if paint[c.ID()]&paintStale == 0 {
+			result = append(result, c)
+		}
+	}
+
+	sortNewestFirst(result)
+
+	return result, paint, nil
+}
+
+func hasUnstale(queue commitHeap, paint map[plumbing.Hash]int) bool {
+	for _, q := range queue {
+		if paint[q.commit.ID()]&paintStale == 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sortNewestFirst(commits []commitgraph.CommitNode) {
+	sort.SliceStable(commits, func(i, j int) bool {
+		return commits[i].CommitTime().After(commits[j].CommitTime())
+	})
+}
+
+// mergeBases returns the best common ancestors of one and a hypothetical
+// merge of twos, newest first.
+func mergeBases(r *git.Repository, one plumbing.Hash, twos []plumbing.Hash) ([]plumbing.Hash, error) {
+	if containsHash(twos, one) {
+		return []plumbing.Hash{one}, nil
+	}
+
+	found, _, err := paintDownToCommon(r, one, twos)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]plumbing.Hash, len(found))
+	dates := make(map[plumbing.Hash]time.Time, len(found))
+
+	for i, c := range found {
+		hashes[i] = c.ID()
+		dates[c.ID()] = c.CommitTime()
+	}
+
+	hashes, err = removeRedundant(r, hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(hashes, func(i, j int) bool {
+		return dates[hashes[i]].After(dates[hashes[j]])
+	})
+
+	return hashes, nil
+}
+
+// removeRedundant drops the duplicates of commits and the commits that are
+// ancestors of others, keeping the order of the rest.
+func removeRedundant(r *git.Repository, commits []plumbing.Hash) ([]plumbing.Hash, error) {
+	var unique []plumbing.Hash
+
+	for _, h := range commits {
+		if !containsHash(unique, h) {
+			unique = append(unique, h)
+		}
+	}
+
+	redundant := make([]bool, len(unique))
+
+	for i, h := range unique {
+		if redundant[i] || len(unique) < 2 {
+			continue
+		}
+
+		var others []plumbing.Hash
+
+		for j, o := range unique {
+			if j != i && !redundant[j] {
+				others = append(others, o)
+			}
+		}
+
+		_, paint, err := paintDownToCommon(r, h, others)
+		if err != nil {
+			return nil, err
+		}
+
+		if paint[h]&paintTwo != 0 {
+			redundant[i] = true
+		}
+
+		for j, o := range unique {
+			if j != i && paint[o]&paintOne != 0 {
+				redundant[j] = true
+			}
+		}
+	}
+
+	var kept []plumbing.Hash
+
+	for i, h := range unique {
+		if !redundant[i] {
+			kept = append(kept, h)
+		}
+	}
+
+	return kept, nil
+}
+
+// octopusMergeBases returns the best common ancestors of all commits, by
+// merging their histories one at a time, for an n-way merge.
+func octopusMergeBases(r *git.Repository, commits []plumbing.Hash) ([]plumbing.Hash, error) {
+	bases := commits[:1]
+
+	for _, c := range commits[1:] {
+		var next []plumbing.Hash
+
+		for _, b := range bases {
+			found, err := mergeBases(r, c, []plumbing.Hash{b})
+			if err != nil {
+				return nil, err
+			}
+
+			next = append(next, found...)
+		}
+
+		bases = next
+	}
+
+	return removeRedundant(r, bases)
+}
+
+// isAncestor reports whether the commit a is reachable from b, walking the
+// commit-graph when there is one.
+func isAncestor(r *git.Repository, a, b plumbing.Hash) (bool, error) {
+	if a == b {
+		return true, nil
+	}
+
+	_, paint, err := paintDownToCommon(r, a, []plumbing.Hash{b})
+	if err != nil {
+		return false, err
+	}
+
+	return paint[a]&paintTwo != 0, nil
+}
+
+// forkPoint returns the commit where the commit of args, or HEAD, forked
+// from the reference of args: the merge base of the commit with the
+// commits the reflog of the reference records, provided it is one of them.
+func forkPoint(r *git.Repository, args []string) ([]plumbing.Hash, error) {
+	rev := plumbing.HEAD.String()
+	if len(args) == 2 {
+		rev = args[1]
+	}
+
+	derived, err := resolveCommit(r, rev)
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := expandRefName(r, args[0])
+	if err != nil {
+		return nil, fmt.Errorf("not a valid reference: %s", args[0])
+	}
+
+	rs, err := reflogStorer(r)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := rs.Reflog(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reflog: %w", err)
+	}
+
+	var logged []plumbing.Hash
+
+	add := func(h plumbing.Hash) {
+		if _, err := r.CommitObject(h); err == nil && !containsHash(logged, h) {
+			logged = append(logged, h)
+		}
+	}
+
+	for i, e := range entries {
+		if i == 0 {
+			add(e.OldHash)
+		}
+
+		add(e.NewHash)
+	}
+
+	if len(logged) == 0 {
+		ref, err := r.Reference(name, true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", name, err)
+		}
+
+		add(ref.Hash())
+	}
+
+	if len(logged) == 0 {
+		return nil, nil
+	}
+
+	bases, err := mergeBases(r, derived.Hash, logged)
+	if err != nil || len(bases) != 1 || !containsHash(logged, bases[0]) {
+		return nil, err
+	}
+
+	return bases, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// mergeBaseRepo returns a repository made by git with a criss-cross merge,
+// which has two merge bases, and three branches forked from main.
+func mergeBaseRepo(t *testing.T) string {
+	t.Helper()
+
+	dir := gitRepo(t, []string{"a", "1"}, []string{"a", "2"})
+
+	for _, b := range []string{"x", "y", "z"} {
+		gitCmd(t, dir, "branch", b)
+	}
+
+	commit := func(branch, file string) {
+		gitCmd(t, dir, "checkout", "-q", branch)
+		writeFile(t, dir, file, branch+file)
+		gitCmd(t, dir, "add", file)
+		gitCmd(t, dir, "commit", "-q", "-m", branch+" "+file)
+	}
+
+	commit("x", "x1")
+	commit("y", "y1")
+	commit("z", "z1")
+	commit("main", "m1")
+
+	// x and y merge each other, crossing.
+	gitCmd(t, dir, "checkout", "-q", "x")
+	gitCmd(t, dir, "branch", "x-before")
+	gitCmd(t, dir, "merge", "-q", "--no-edit", "y")
+	gitCmd(t, dir, "checkout", "-q", "y")
+	gitCmd(t, dir, "merge", "-q", "--no-edit", "x-before")
+
+	commit("x", "x2")
+	commit("y", "y2")
+
+	return dir
+}
+
+func TestMergeBase(t *testing.T) {
+	dir := mergeBaseRepo(t)
+
+	for _, args := range []string{
+		"x y",
+		"--all x y",
+		"main x",
+		"main x y",
+		"--all main x y",
+		"--octopus main x z",
+		"--octopus --all x y",
+		"--octopus x",
+		"x x~1",
+		"z main~1",
+	} {
+		t.Run(args, func(t *testing.T) {
+			sameOutput(t, dir, append([]string{"merge-base"}, strings.Fields(args)...)...)
+		})
+	}
+}
+
+func TestMergeBaseIsAncestor(t *testing.T) {
+	dir := mergeBaseRepo(t)
+
+	for _, args := range []string{
+		"main~1 x",
+		"x main",
+		"x x",
+		"x-before y",
+		"y x",
+		"nope x",
+	} {
+		a := append([]string{"merge-base", "--is-ancestor"}, strings.Fields(args)...)
+
+		want := run(t, dir, "", "git", a...)
+		if got := gogit(t, dir, a...); got.code != want.code || got.stdout != "" || got.stderr != want.stderr {
+			t.Errorf("gogit %v exited with %d and wrote %q %q, want as git %d %q", a, got.code, got.stdout, got.stderr, want.code, want.stderr)
+		}
+	}
+}
+
+// TestMergeBaseForkPoint checks that the fork point is found in the
+// reflog of the upstream, after the upstream was rewound.
+func TestMergeBaseForkPoint(t *testing.T) {
+	dir := gitRepo(t, []string{"a", "1"}, []string{"a", "2"}, []string{"a", "3"})
+	gitCmd(t, dir, "branch", "topic")
+
+	// topic forked from main at commit 3, which main then dropped.
+	gitCmd(t, dir, "reset", "-q", "--hard", "HEAD~1")
+	writeFile(t, dir, "b", "1")
+	gitCmd(t, dir, "add", "b")
+	gitCmd(t, dir, "commit", "-q", "-m", "rewritten")
+
+	gitCmd(t, dir, "checkout", "-q", "topic")
+	writeFile(t, dir, "c", "1")
+	gitCmd(t, dir, "add", "c")
+	gitCmd(t, dir, "commit", "-q", "-m", "topic")
+
+	sameOutput(t, dir, "merge-base", "--fork-point", "main", "topic")
+	sameOutput(t, dir, "merge-base", "--fork-point", "main")
+	sameOutput(t, dir, "merge-base", "main", "topic")
+}
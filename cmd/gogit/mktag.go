@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(mktagCmd)
+}
+
+var mktagCmd = &cobra.Command{
+	Use:   "mktag",
+	Short: "Create a tag object from the text read on stdin",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		data, err := io.ReadAll(cmd.InOrStdin())
+		if err != nil {
+			return fmt.Errorf("failed to read tag: %w", err)
+		}
+
+		obj, err := newObject(r.Storer, plumbing.TagObject, data)
+		if err != nil {
+			return err
+		}
+
+		err = objectProblem(obj)
+		if err != nil {
+			return fmt.Errorf("tag on stdin did not pass our strict fsck check: %w", err)
+		}
+
+		tag := &object.Tag{}
+
+		err = tag.Decode(obj)
+		if err != nil {
+			return err
+		}
+
+		if tag.Tagger.Name == "" && tag.Tagger.Email == "" {
+			return errors.New("tag on stdin did not pass our strict fsck check: missing tagger entry")
+		}
+
+		target, err := r.Storer.EncodedObject(plumbing.AnyObject, tag.Target)
+		if err != nil {
+			return fmt.Errorf("could not read tagged object '%s'", tag.Target)
+		}
+
+		if target.Type() != tag.TargetType {
+			return fmt.Errorf("object '%s' tagged as '%s', but is a '%s' type", tag.Target, tag.TargetType, target.Type())
+		}
+
+		h, err := r.Storer.SetEncodedObject(obj)
+		if err != nil {
+			return fmt.Errorf("failed to write tag: %w", err)
+		}
+
+		fmt.Fprintln(cmd.OutOrStdout(), h)
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
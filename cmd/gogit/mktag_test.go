@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMktag(t *testing.T) {
+	dir := gitRepo(t, []string{"a", "1"})
+
+	tag := fmt.Sprintf("object %stype commit\ntag v1\ntagger T <t@x> 1700000000 +0000\n\nmessage\n", gitCmd(t, dir, "rev-parse", "HEAD"))
+
+	want := gitCmdStdin(t, dir, tag, "mktag")
+	if got := gogitStdin(t, dir, tag, "mktag").stdout; got != want {
+		t.Errorf("gogit mktag gave %q, want as git %q", got, want)
+	}
+
+	for _, bad := range []string{
+		fmt.Sprintf("object %stype blob\ntag v1\ntagger T <t@x> 1700000000 +0000\n\nmessage\n", gitCmd(t, dir, "rev-parse", "HEAD")),
+		"object 0123456789012345678901234567890123456789\ntype commit\ntag v1\ntagger T <t@x> 1700000000 +0000\n\nmessage\n",
+		fmt.Sprintf("object %stype commit\ntagger T <t@x> 1700000000 +0000\n\nmessage\n", gitCmd(t, dir, "rev-parse", "HEAD")),
+	} {
+		want := run(t, dir, bad, "git", "mktag")
+		if got := gogitStdin(t, dir, bad, "mktag"); (got.code == 0) != (want.code == 0) {
+			t.Errorf("gogit mktag exited with %d for:\n%s\nwant, as git, %d", got.code, bad, want.code)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/spf13/cobra"
+)
+
+var (
+	mktreeBatch   bool
+	mktreeMissing bool
+	mktreeNul     bool
+)
+
+func init() {
+	mktreeCmd.Flags().BoolVarP(&mktreeBatch, "batch", "", false, "Build more than one tree, separated by blank lines")
+	mktreeCmd.Flags().BoolVarP(&mktreeMissing, "missing", "", false, "Allow entries for missing objects")
+	mktreeCmd.Flags().BoolVarP(&mktreeNul, "null", "z", false, "Read NUL-terminated entries")
+	rootCmd.AddCommand(mktreeCmd)
+}
+
+var mktreeCmd = &cobra.Command{
+	Use:   "mktree [-z] [--missing] [--batch]",
+	Short: "Build a tree object from ls-tree formatted text",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		sep := byte('\n')
+		if mktreeNul {
+			sep = 0
+		}
+
+		in := bufio.NewReader(cmd.InOrStdin())
+
+		for eof := false; !eof; {
+			var entries []object.TreeEntry
+
+			for {
+				line, err := in.ReadString(sep)
+				if err == io.EOF {
+					eof = true
+
+					if line == "" {
+						break
+					}
+				} else if err != nil {
+					return err
+				}
+
+				line = strings.TrimSuffix(line, string(sep))
+				if line == "" {
+					if !mktreeBatch {
+						return errors.New("input format error: (blank line only valid in batch mode)")
+					}
+
+					break
+				}
+
+				e, err := parseTreeEntry(r, line)
+				if err != nil {
+					return err
+				}
+
+				entries = append(entries, e)
+			}
+
+			// A final newline does not start a new, empty tree.
+			if mktreeBatch && eof && len(entries) == 0 {
+				break
+			}
+
+			h, err := writeTree(r, entries)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintln(cmd.OutOrStdout(), h)
+		}
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// parseTreeEntry parses a line of ls-tree output.
+func parseTreeEntry(r *git.Repository, line string) (object.TreeEntry, error) {
+	info, name, ok := strings.Cut(line, "\t")
+	fields := strings.Fields(info)
+
+	if !ok || len(fields) != 3 {
+		return object.TreeEntry{}, fmt.Errorf("input format error: %s", line)
+	}
+
+	mode, err := filemode.New(fields[0])
+	if err != nil {
+		return object.TreeEntry{}, fmt.Errorf("input format error: %s", line)
+	}
+
+	h, ok := plumbing.FromHex(fields[2])
+	if !ok || len(fields[2]) != h.HexSize() {
+		return object.TreeEntry{}, fmt.Errorf("input format error: %s", line)
+	}
+
+	if strings.Contains(name, "/") {
+		return object.TreeEntry{}, fmt.Errorf("path %s contains slash", name)
+	}
+
+	typ := treeEntryType(mode)
+	if fields[1] != typ.String() {
+		return object.TreeEntry{}, fmt.Errorf("entry '%s' object type (%s) doesn't match mode type (%s)", name, fields[1], typ)
+	}
+
+	// Like git, submodule commits are never looked up.
+	if !mktreeMissing && mode != filemode.Submodule {
+		obj, err := r.Storer.EncodedObject(plumbing.AnyObject, h)
+		if err != nil {
+			return object.TreeEntry{}, fmt.Errorf("entry '%s' object %s is unavailable", name, h)
+		}
+
+		if obj.Type() != typ {
+			return object.TreeEntry{}, fmt.Errorf("entry '%s' object %s is a %s but specified type was (%s)", name, h, obj.Type(), typ)
+		}
+	}
+
+	return object.TreeEntry{Name: name, Mode: mode, Hash: h}, nil
+}
+
+// writeTree stores a tree of entries, in any order, as a loose object.
+func writeTree(r *git.Repository, entries []object.TreeEntry) (plumbing.Hash, error) {
+	tree := &object.Tree{Entries: entries}
+	sort.Sort(object.TreeEntrySorter(tree.Entries))
+
+	obj := r.Storer.NewEncodedObject()
+
+	err := tree.Encode(obj)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to encode tree: %w", err)
+	}
+
+	h, err := r.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to write tree: %w", err)
+	}
+
+	return h, nil
+}
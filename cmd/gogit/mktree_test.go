@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMktree(t *testing.T) {
+	dir := gitRepo(t, []string{"a", "1", "d/b", "2"})
+
+	// The listing of ls-tree, unsorted, makes the same tree.
+	lines := strings.Split(strings.TrimSpace(gitCmd(t, dir, "ls-tree", "HEAD")), "\n")
+	input := strings.Join([]string{lines[1], lines[0]}, "\n") + "\n"
+
+	want := gitCmd(t, dir, "rev-parse", "HEAD^{tree}")
+	if got := gogitStdin(t, dir, input, "mktree").stdout; got != want {
+		t.Errorf("gogit mktree gave %q, want %q", got, want)
+	}
+
+	z := strings.ReplaceAll(input, "\n", "\x00")
+	if got := gogitStdin(t, dir, z, "mktree", "-z").stdout; got != want {
+		t.Errorf("gogit mktree -z gave %q, want %q", got, want)
+	}
+
+	missing := "100644 blob 0123456789012345678901234567890123456789\tm\n"
+
+	if res := gogitStdin(t, dir, missing, "mktree"); res.code == 0 {
+		t.Error("gogit mktree accepted a missing object")
+	}
+
+	for _, args := range [][]string{
+		{"mktree", "--missing"},
+		{"mktree", "--batch"},
+	} {
+		stdin := missing
+		if args[1] == "--batch" {
+			stdin = input + "\n" + lines[0] + "\n"
+		}
+
+		if got, want := gogitStdin(t, dir, stdin, args...).stdout, run(t, dir, stdin, "git", args...).stdout; got != want {
+			t.Errorf("gogit %v gave:\n%s\nwant, as git:\n%s", args, got, want)
+		}
+	}
+
+	gitCmd(t, dir, "fsck")
+}
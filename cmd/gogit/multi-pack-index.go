@@ -0,0 +1,702 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	formatcfg "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/format/idxfile"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/spf13/cobra"
+)
+
+const (
+	multiPackIndexFile = "objects/pack/multi-pack-index"
+
+	// midxLargeOffset flags the object offsets stored in the LOFF chunk.
+	midxLargeOffset = 0x80000000
+)
+
+var multiPackIndexBatchSize string
+
+func init() {
+	multiPackIndexRepackCmd.Flags().StringVarP(&multiPackIndexBatchSize, "batch-size", "", "0", "Repack the small packs until their objects reach this size, or all the packs with 0")
+
+	multiPackIndexCmd.AddCommand(multiPackIndexWriteCmd)
+	multiPackIndexCmd.AddCommand(multiPackIndexVerifyCmd)
+	multiPackIndexCmd.AddCommand(multiPackIndexExpireCmd)
+	multiPackIndexCmd.AddCommand(multiPackIndexRepackCmd)
+	rootCmd.AddCommand(multiPackIndexCmd)
+}
+
+var multiPackIndexCmd = &cobra.Command{
+	Use:                   "multi-pack-index <command>",
+	Short:                 "Write and verify the multi-pack-index",
+	DisableFlagsInUseLine: true,
+}
+
+var multiPackIndexWriteCmd = &cobra.Command{
+	Use:   "write",
+	Short: "Write a multi-pack-index of the packs",
+	Args:  cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		store, of, err := openMultiPackIndexStore()
+		if err != nil {
+			return err
+		}
+
+		return writeMultiPackIndex(store, of)
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var multiPackIndexVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify the multi-pack-index against the packs",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		store, of, err := openMultiPackIndexStore()
+		if err != nil {
+			return err
+		}
+
+		failed, err := verifyMultiPackIndex(store, of, cmd.ErrOrStderr())
+		if err != nil {
+			return err
+		}
+
+		if failed {
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+
+			return exitStatus(1)
+		}
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var multiPackIndexExpireCmd = &cobra.Command{
+	Use:   "expire",
+	Short: "Remove the packs the multi-pack-index no longer refers to",
+	Args:  cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		store, of, err := openMultiPackIndexStore()
+		if err != nil {
+			return err
+		}
+
+		m, err := readMultiPackIndex(store, of)
+		if err != nil || m == nil {
+			return err
+		}
+
+		used := make([]bool, len(m.packs))
+		for _, obj := range m.objects {
+			used[obj.pack] = true
+		}
+
+		for id, pack := range m.packs {
+			if used[id] {
+				continue
+			}
+
+			if _, err := store.Filesystem().Stat(packFilePath(pack, "keep")); err == nil {
+				continue
+			}
+
+			err = removePackFiles(store, pack)
+			if err != nil {
+				return err
+			}
+		}
+
+		return writeMultiPackIndex(store, of)
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var multiPackIndexRepackCmd = &cobra.Command{
+	Use:   "repack [--batch-size=<size>]",
+	Short: "Repack the objects of the packs listed in the multi-pack-index",
+	Args:  cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		batchSize, err := parseScaledInt(multiPackIndexBatchSize)
+		if err != nil {
+			return fmt.Errorf("invalid batch size %q: %w", multiPackIndexBatchSize, err)
+		}
+
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		store, ok := r.Storer.(*filesystem.Storage)
+		if !ok {
+			return errors.New("storer does not implement filesystem.Storage")
+		}
+
+		of, err := packObjectFormat(r, "")
+		if err != nil {
+			return err
+		}
+
+		return repackMultiPackIndex(r, store, of, batchSize)
+	},
+	DisableFlagsInUseLine: true,
+}
+
+func openMultiPackIndexStore() (*filesystem.Storage, formatcfg.ObjectFormat, error) {
+	r, err := git.PlainOpen(".")
+	if err != nil {
+		return nil, "", err
+	}
+
+	store, ok := r.Storer.(*filesystem.Storage)
+	if !ok {
+		return nil, "", errors.New("storer does not implement filesystem.Storage")
+	}
+
+	of, err := packObjectFormat(r, "")
+	if err != nil {
+		return nil, "", err
+	}
+
+	return store, of, nil
+}
+
+// midxObject is an object of the multi-pack-index: the position of its
+// pack among the packs the index lists and its offset in that pack.
+type midxObject struct {
+	hash   plumbing.Hash
+	pack   uint32
+	offset uint64
+}
+
+type midxChunk struct {
+	id   string
+	data []byte
+}
+
+// multiPackIndex is a decoded multi-pack-index file.
+type multiPackIndex struct {
+	packs   []plumbing.Hash
+	fanout  []uint32
+	objects []midxObject
+
+	// content is the whole file, checksum included.
+	content []byte
+}
+
+// writeMultiPackIndex writes the multi-pack-index of all the packs. When
+// several packs hold an object, the most recently modified one is used,
+// to the second like git, and then the first one.
+func writeMultiPackIndex(store *filesystem.Storage, of formatcfg.ObjectFormat) error {
+	indexes, err := readPackIndexes(store, of)
+	if err != nil {
+		return err
+	}
+
+	if len(indexes) == 0 {
+		return errors.New("no pack files to index")
+	}
+
+	packs := sortedPacks(indexes)
+	mtimes := make([]time.Time, len(packs))
+	objects := make(map[plumbing.Hash]midxObject)
+
+	for id, pack := range packs {
+		fi, err := store.Filesystem().Stat(packFilePath(pack, "pack"))
+		if err != nil {
+			return fmt.Errorf("failed to stat pack %s: %w", pack, err)
+		}
+
+		mtimes[id] = fi.ModTime().Truncate(time.Second)
+
+		err = forEachIndexEntry(indexes[pack], func(e *idxfile.Entry) {
+			if prev, ok := objects[e.Hash]; ok && !mtimes[id].After(mtimes[prev.pack]) {
+				return
+			}
+
+			objects[e.Hash] = midxObject{hash: e.Hash, pack: uint32(id), offset: e.Offset}
+		})
+		if err != nil {
+			return fmt.Errorf("failed to read index of pack %s: %w", pack, err)
+		}
+	}
+
+	sorted := make([]midxObject, 0, len(objects))
+	for _, obj := range objects {
+		sorted = append(sorted, obj)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].hash.Compare(sorted[j].hash.Bytes()) < 0
+	})
+
+	err = writeLockedFile(store.Filesystem(), multiPackIndexFile, string(encodeMultiPackIndex(of, packs, sorted)))
+	if err != nil {
+		return fmt.Errorf("failed to write multi-pack-index: %w", err)
+	}
+
+	return nil
+}
+
+// encodeMultiPackIndex returns the multi-pack-index file of the objects, in
+// the format git writes: a header, the chunk table and the PNAM, OIDF,
+// OIDL, OOFF and, when some offsets need 64 bits, LOFF chunks.
+func encodeMultiPackIndex(of formatcfg.ObjectFormat, packs []plumbing.Hash, objects []midxObject) []byte {
+	var names []byte
+	for _, pack := range packs {
+		names = append(names, fmt.Sprintf("pack-%s.idx", pack)...)
+		names = append(names, 0)
+	}
+
+	for len(names)%4 != 0 {
+		names = append(names, 0)
+	}
+
+	fanout := make([]byte, 256*4)
+	lookup := make([]byte, 0, len(objects)*objectFormatHash(of).Size())
+	offsets := make([]byte, 0, len(objects)*8)
+
+	var count [256]uint32
+
+	for _, obj := range objects {
+		count[obj.hash.Bytes()[0]]++
+		lookup = append(lookup, obj.hash.Bytes()...)
+	}
+
+	var total uint32
+
+	for i, n := range count {
+		total += n
+		binary.BigEndian.PutUint32(fanout[i*4:], total)
+	}
+
+	// Like git, 64-bit offsets are only written when some offset does not
+	// fit in 32 bits, and then for all the offsets above 31 bits.
+	large := false
+
+	for _, obj := range objects {
+		large = large || obj.offset > 0xffffffff
+	}
+
+	var largeOffsets []byte
+
+	for _, obj := range objects {
+		offset := uint32(obj.offset)
+		if large && obj.offset>>31 != 0 {
+			offset = midxLargeOffset | uint32(len(largeOffsets)/8)
+			largeOffsets = binary.BigEndian.AppendUint64(largeOffsets, obj.offset)
+		}
+
+		offsets = binary.BigEndian.AppendUint32(offsets, obj.pack)
+		offsets = binary.BigEndian.AppendUint32(offsets, offset)
+	}
+
+	chunks := []midxChunk{
+		{"PNAM", names},
+		{"OIDF", fanout},
+		{"OIDL", lookup},
+		{"OOFF", offsets},
+	}
+
+	if len(largeOffsets) > 0 {
+		chunks = append(chunks, midxChunk{"LOFF", largeOffsets})
+	}
+
+	version := byte(1)
+	if of == formatcfg.SHA256 {
+		version = 2
+	}
+
+	b := []byte("MIDX")
+	b = append(b, 1, version, byte(len(chunks)), 0)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(packs)))
+
+	offset := uint64(len(b) + (len(chunks)+1)*12)
+
+	for _, c := range chunks {
+		b = append(b, c.id...)
+		b = binary.BigEndian.AppendUint64(b, offset)
+		offset += uint64(len(c.data))
+	}
+
+	b = append(b, 0, 0, 0, 0)
+	b = binary.BigEndian.AppendUint64(b, offset)
+
+	for _, c := range chunks {
+		b = append(b, c.data...)
+	}
+
+	sum := objectFormatHash(of).New()
+	sum.Write(b)
+
+	return sum.Sum(b)
+}
+
+// readMultiPackIndex reads the multi-pack-index of the repository, or
+// returns nil when there is none.
+func readMultiPackIndex(store *filesystem.Storage, of formatcfg.ObjectFormat) (*multiPackIndex, error) {
+	content, err := util.ReadFile(store.Filesystem(), multiPackIndexFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read multi-pack-index: %w", err)
+	}
+
+	m, err := decodeMultiPackIndex(of, content)
+	if err != nil {
+		return nil, fmt.Errorf("multi-pack-index is corrupt: %w", err)
+	}
+
+	return m, nil
+}
+
+func decodeMultiPackIndex(of formatcfg.ObjectFormat, content []byte) (*multiPackIndex, error) {
+	size := objectFormatHash(of).Size()
+
+	if len(content) < 12+size || !bytes.HasPrefix(content, []byte("MIDX")) {
+		return nil, errors.New("bad signature")
+	}
+
+	if content[4] != 1 {
+		return nil, fmt.Errorf("unsupported version %d", content[4])
+	}
+
+	if version := content[5]; (version == 2) != (of == formatcfg.SHA256) {
+		return nil, fmt.Errorf("unsupported object format %d", version)
+	}
+
+	count := int(content[6])
+	packCount := int(binary.BigEndian.Uint32(content[8:]))
+	end := uint64(len(content) - size)
+
+	if len(content) < 12+(count+1)*12 {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	chunks := make(map[string][]byte, count)
+
+	for i := range count {
+		entry := content[12+i*12:]
+		start := binary.BigEndian.Uint64(entry[4:])
+		stop := binary.BigEndian.Uint64(entry[16:])
+
+		if start > stop || stop > end {
+			return nil, fmt.Errorf("chunk %s out of bounds", entry[:4])
+		}
+
+		chunks[string(entry[:4])] = content[start:stop]
+	}
+
+	m := &multiPackIndex{content: content}
+
+	for _, name := range strings.Split(string(chunks["PNAM"]), "\x00") {
+		if name == "" {
+			continue
+		}
+
+		hex := strings.TrimSuffix(strings.TrimPrefix(name, "pack-"), ".idx")
+		if !plumbing.IsHash(hex) {
+			return nil, fmt.Errorf("bad pack name %q", name)
+		}
+
+		m.packs = append(m.packs, plumbing.NewHash(hex))
+	}
+
+	if len(m.packs) != packCount {
+		return nil, fmt.Errorf("expected %d packs, found %d", packCount, len(m.packs))
+	}
+
+	fanout := chunks["OIDF"]
+	if len(fanout) != 256*4 {
+		return nil, errors.New("bad fanout chunk")
+	}
+
+	for i := range 256 {
+		m.fanout = append(m.fanout, binary.BigEndian.Uint32(fanout[i*4:]))
+	}
+
+	n := int(m.fanout[255])
+	lookup, offsets, large := chunks["OIDL"], chunks["OOFF"], chunks["LOFF"]
+
+	if len(lookup) != n*size || len(offsets) != n*8 {
+		return nil, errors.New("bad object chunks")
+	}
+
+	for i := range n {
+		var h plumbing.Hash
+
+		_, err := h.ReadFrom(bytes.NewReader(lookup[i*size : (i+1)*size]))
+		if err != nil {
+			return nil, err
+		}
+
+		obj := midxObject{
+			hash:   h,
+			pack:   binary.BigEndian.Uint32(offsets[i*8:]),
+			offset: uint64(binary.BigEndian.Uint32(offsets[i*8+4:])),
+		}
+
+		if large != nil && obj.offset&midxLargeOffset != 0 {
+			j := int(obj.offset &^ midxLargeOffset)
+			if (j+1)*8 > len(large) {
+				return nil, fmt.Errorf("bad large offset for %s", h)
+			}
+
+			obj.offset = binary.BigEndian.Uint64(large[j*8:])
+		}
+
+		if int(obj.pack) >= len(m.packs) {
+			return nil, fmt.Errorf("bad pack for %s", h)
+		}
+
+		m.objects = append(m.objects, obj)
+	}
+
+	return m, nil
+}
+
+// verifyMultiPackIndex checks the multi-pack-index against the packs,
+// reporting the problems to out the way git does.
+func verifyMultiPackIndex(store *filesystem.Storage, of formatcfg.ObjectFormat, out io.Writer) (bool, error) {
+	m, err := readMultiPackIndex(store, of)
+	if err != nil || m == nil {
+		return false, err
+	}
+
+	failed := false
+	report := func(format string, args ...any) {
+		failed = true
+
+		fmt.Fprintf(out, format+"\n", args...)
+	}
+
+	size := objectFormatHash(of).Size()
+	sum := objectFormatHash(of).New()
+	sum.Write(m.content[:len(m.content)-size])
+
+	if !bytes.Equal(sum.Sum(nil), m.content[len(m.content)-size:]) {
+		report("incorrect checksum")
+	}
+
+	indexes, err := readPackIndexes(store, of)
+	if err != nil {
+		return false, err
+	}
+
+	for id, pack := range m.packs {
+		if _, ok := indexes[pack]; !ok {
+			report("failed to load pack in position %d", id)
+		}
+	}
+
+	for i := range len(m.fanout) - 1 {
+		if m.fanout[i] > m.fanout[i+1] {
+			report("oid fanout out of order: fanout[%d] = %x > %x = fanout[%d]", i, m.fanout[i], m.fanout[i+1], i+1)
+		}
+	}
+
+	for i := 1; i < len(m.objects); i++ {
+		if prev, h := m.objects[i-1].hash, m.objects[i].hash; prev.Compare(h.Bytes()) >= 0 {
+			report("oid lookup out of order: oid[%d] = %s >= %s = oid[%d]", i-1, prev, h, i)
+		}
+	}
+
+	for i, obj := range m.objects {
+		idx, ok := indexes[m.packs[obj.pack]]
+		if !ok {
+			continue
+		}
+
+		offset, err := idx.FindOffset(obj.hash)
+		if err != nil {
+			report("failed to load pack entry for oid[%d] = %s", i, obj.hash)
+
+			continue
+		}
+
+		if uint64(offset) != obj.offset {
+			report("incorrect object offset for oid[%d] = %s: %x != %x", i, obj.hash, obj.offset, offset)
+		}
+	}
+
+	return failed, nil
+}
+
+// repackMultiPackIndex packs the objects the multi-pack-index takes from the
+// selected packs into a new pack, then rewrites the multi-pack-index, which
+// prefers the new pack. The old packs are left for expire to remove.
+func repackMultiPackIndex(r *git.Repository, store *filesystem.Storage, of formatcfg.ObjectFormat, batchSize int) error {
+	m, err := readMultiPackIndex(store, of)
+	if err != nil || m == nil {
+		return err
+	}
+
+	indexes, err := readPackIndexes(store, of)
+	if err != nil {
+		return err
+	}
+
+	selected, err := selectMultiPackIndexPacks(store, m, indexes, batchSize)
+	if err != nil || len(selected) < 2 {
+		return err
+	}
+
+	cfg, err := r.Config()
+	if err != nil {
+		return fmt.Errorf("failed to get repository config: %w", err)
+	}
+
+	window, err := configInt(cfg, "pack", "window", 10)
+	if err != nil {
+		return err
+	}
+
+	depth, err := configInt(cfg, "pack", "depth", 50)
+	if err != nil {
+		return err
+	}
+
+	b := newPackBuilder(r, window, depth)
+
+	for _, obj := range m.objects {
+		if !selected[obj.pack] {
+			continue
+		}
+
+		err = b.add(obj.hash, "")
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(b.entries) == 0 {
+		return nil
+	}
+
+	_, err = writePackFile(filepath.Join(store.Filesystem().Root(), "objects", "pack", "pack"), of, b.write)
+	if err != nil {
+		return err
+	}
+
+	return writeMultiPackIndex(store, of)
+}
+
+// selectMultiPackIndexPacks selects the packs to repack, as git does: all
+// the packs but the kept ones when batchSize is 0, else the oldest packs
+// whose objects in use are estimated below batchSize, until they reach it.
+func selectMultiPackIndexPacks(store *filesystem.Storage, m *multiPackIndex, indexes map[plumbing.Hash]*idxfile.MemoryIndex, batchSize int) (map[uint32]bool, error) {
+	used := make([]int64, len(m.packs))
+	for _, obj := range m.objects {
+		used[obj.pack]++
+	}
+
+	type candidate struct {
+		id    uint32
+		mtime time.Time
+		size  int64
+	}
+
+	var candidates []candidate
+
+	for id, pack := range m.packs {
+		if _, err := store.Filesystem().Stat(packFilePath(pack, "keep")); err == nil {
+			continue
+		}
+
+		idx, ok := indexes[pack]
+		if !ok {
+			continue
+		}
+
+		fi, err := store.Filesystem().Stat(packFilePath(pack, "pack"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat pack %s: %w", pack, err)
+		}
+
+		count, err := idx.Count()
+		if err != nil || count == 0 {
+			continue
+		}
+
+		candidates = append(candidates, candidate{uint32(id), fi.ModTime(), fi.Size() * used[id] / count})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].mtime.Before(candidates[j].mtime)
+	})
+
+	selected := make(map[uint32]bool)
+
+	if batchSize == 0 {
+		for _, c := range candidates {
+			selected[c.id] = true
+		}
+
+		return selected, nil
+	}
+
+	var total int64
+
+	for _, c := range candidates {
+		if total >= int64(batchSize) {
+			break
+		}
+
+		if c.size >= int64(batchSize) {
+			continue
+		}
+
+		total += c.size
+		selected[c.id] = true
+	}
+
+	if total < int64(batchSize) {
+		return nil, nil
+	}
+
+	return selected, nil
+}
+
+// forEachIndexEntry calls fn with each entry of the pack index.
+func forEachIndexEntry(idx *idxfile.MemoryIndex, fn func(e *idxfile.Entry)) error {
+	entries, err := idx.Entries()
+	if err != nil {
+		return err
+	}
+
+	defer entries.Close()
+
+	for {
+		e, err := entries.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		// Like in indexHashes, the entry hash is rebuilt from its bytes.
+		e.Hash, _ = plumbing.FromBytes(e.Hash.Bytes())
+
+		fn(e)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v6/plumbing"
+	formatcfg "github.com/go-git/go-git/v6/plumbing/format/config"
+)
+
+// overlappingPacks returns a repository made by git whose objects are in
+// several packs, some objects being in more than one of them.
+func overlappingPacks(t *testing.T) string {
+	t.Helper()
+
+	dir := gitRepo(t, manyFiles(150))
+	gitCmd(t, dir, "repack", "-q", "-a", "-d")
+
+	objects := strings.Fields(gitCmd(t, dir, "rev-list", "--objects", "--all"))
+
+	for _, step := range []int{2, 3} {
+		var list strings.Builder
+
+		for i, obj := range objects {
+			if len(obj) == 40 && i%step == 0 {
+				list.WriteString(obj + "\n")
+			}
+		}
+
+		gitCmdStdin(t, dir, list.String(), "pack-objects", "-q", ".git/objects/pack/pack")
+	}
+
+	return dir
+}
+
+// multiPackIndexObjects returns the objects the multi-pack-index of dir
+// lists.
+func multiPackIndexObjects(t *testing.T, dir string) []plumbing.Hash {
+	t.Helper()
+
+	content, err := os.ReadFile(filepath.Join(dir, ".git", multiPackIndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := decodeMultiPackIndex(formatcfg.SHA1, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var hashes []plumbing.Hash
+	for _, obj := range m.objects {
+		hashes = append(hashes, obj.hash)
+	}
+
+	return hashes
+}
+
+func TestMultiPackIndexWrite(t *testing.T) {
+	dir := overlappingPacks(t)
+
+	gitCmd(t, dir, "multi-pack-index", "write")
+	want := multiPackIndexObjects(t, dir)
+
+	mustGogit(t, dir, "multi-pack-index", "write")
+
+	// The pack an object is taken from may differ, as git picks among the
+	// packs modified in the same second in the order it reads them.
+	if got := multiPackIndexObjects(t, dir); !slices.Equal(got, want) {
+		t.Errorf("gogit listed %d objects, want as git %d", len(got), len(want))
+	}
+
+	gitCmd(t, dir, "multi-pack-index", "verify")
+	mustGogit(t, dir, "multi-pack-index", "verify")
+}
+
+func TestMultiPackIndexRepack(t *testing.T) {
+	dir := overlappingPacks(t)
+
+	mustGogit(t, dir, "multi-pack-index", "write")
+	mustGogit(t, dir, "multi-pack-index", "repack", "--batch-size=0")
+	mustGogit(t, dir, "multi-pack-index", "expire")
+	gitCmd(t, dir, "multi-pack-index", "verify")
+
+	mustGogit(t, dir, "gc")
+	gitCmd(t, dir, "fsck", "--strict")
+}
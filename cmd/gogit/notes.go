@@ -0,0 +1,669 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/spf13/cobra"
+)
+
+const defaultNotesRef = plumbing.ReferenceName("refs/notes/commits")
+
+var (
+	notesRef           string
+	notesMessages      []string
+	notesFile          string
+	notesForce         bool
+	notesIgnoreMissing bool
+)
+
+func init() {
+	notesCmd.PersistentFlags().StringVarP(&notesRef, "ref", "", "", "Manipulate the notes tree in <ref>")
+
+	for _, c := range []*cobra.Command{notesAddCmd, notesAppendCmd} {
+		c.Flags().StringArrayVarP(&notesMessages, "message", "m", nil, "Use the given note message")
+		c.Flags().StringVarP(&notesFile, "file", "F", "", "Take the note message from the given file, or - for stdin")
+	}
+
+	notesAddCmd.Flags().BoolVarP(&notesForce, "force", "f", false, "Overwrite existing notes")
+	notesCopyCmd.Flags().BoolVarP(&notesForce, "force", "f", false, "Overwrite existing notes")
+	notesRemoveCmd.Flags().BoolVarP(&notesIgnoreMissing, "ignore-missing", "", false, "Do not fail when an object has no note")
+
+	notesCmd.AddCommand(notesAddCmd)
+	notesCmd.AddCommand(notesAppendCmd)
+	notesCmd.AddCommand(notesShowCmd)
+	notesCmd.AddCommand(notesListCmd)
+	notesCmd.AddCommand(notesRemoveCmd)
+	notesCmd.AddCommand(notesCopyCmd)
+	rootCmd.AddCommand(notesCmd)
+}
+
+var notesCmd = &cobra.Command{
+	Use:   "notes [--ref <notes-ref>] <command>",
+	Short: "Add or inspect object notes",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return notesListCmd.RunE(cmd, args)
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var notesAddCmd = &cobra.Command{
+	Use:   "add [-f] [-m <msg> | -F <file>] [<object>]",
+	Short: "Add notes for a given object",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		n, obj, err := openNotes(cmd.ErrOrStderr(), args)
+		if err != nil {
+			return err
+		}
+
+		msg, err := notesMessage(cmd.InOrStdin())
+		if err != nil {
+			return err
+		}
+
+		if _, ok := n.entries[obj]; ok {
+			if !notesForce {
+				return fmt.Errorf("cannot add notes. Found existing notes for object %s. Use '-f' to overwrite existing notes", obj)
+			}
+
+			fmt.Fprintf(cmd.ErrOrStderr(), "Overwriting existing notes for object %s\n", obj)
+		}
+
+		err = n.set(obj, msg)
+		if err != nil {
+			return err
+		}
+
+		return n.commit("Notes added by 'gogit notes add'")
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var notesAppendCmd = &cobra.Command{
+	Use:   "append [-m <msg> | -F <file>] [<object>]",
+	Short: "Append to the notes of an existing object",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		n, obj, err := openNotes(cmd.ErrOrStderr(), args)
+		if err != nil {
+			return err
+		}
+
+		msg, err := notesMessage(cmd.InOrStdin())
+		if err != nil {
+			return err
+		}
+
+		existing, err := n.note(obj)
+		if err != nil && !errors.Is(err, plumbing.ErrObjectNotFound) {
+			return err
+		}
+
+		if existing != "" && msg != "" {
+			msg = existing + "\n" + msg
+		} else if existing != "" {
+			msg = existing
+		}
+
+		err = n.set(obj, msg)
+		if err != nil {
+			return err
+		}
+
+		return n.commit("Notes added by 'gogit notes append'")
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var notesShowCmd = &cobra.Command{
+	Use:   "show [<object>]",
+	Short: "Show the notes for a given object",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		n, obj, err := openNotes(cmd.ErrOrStderr(), args)
+		if err != nil {
+			return err
+		}
+
+		note, err := n.note(obj)
+		if errors.Is(err, plumbing.ErrObjectNotFound) {
+			return fmt.Errorf("no note found for object %s", obj)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		_, err = io.WriteString(cmd.OutOrStdout(), note)
+
+		return err
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var notesListCmd = &cobra.Command{
+	Use:   "list [<object>]",
+	Short: "List the notes objects",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		n, obj, err := openNotes(cmd.ErrOrStderr(), args)
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+
+		if len(args) > 0 {
+			blob, ok := n.entries[obj]
+			if !ok {
+				return fmt.Errorf("no note found for object %s", obj)
+			}
+
+			fmt.Fprintln(out, blob)
+
+			return nil
+		}
+
+		for _, h := range n.objects() {
+			fmt.Fprintf(out, "%s %s\n", n.entries[h], h)
+		}
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var notesRemoveCmd = &cobra.Command{
+	Use:   "remove [--ignore-missing] [<object>...]",
+	Short: "Remove the notes for given objects",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			args = []string{plumbing.HEAD.String()}
+		}
+
+		n, _, err := openNotes(cmd.ErrOrStderr(), nil)
+		if err != nil {
+			return err
+		}
+
+		for _, arg := range args {
+			obj, err := resolveNoteObject(n.r, arg)
+			if err != nil {
+				return err
+			}
+
+			if _, ok := n.entries[obj]; !ok {
+				if notesIgnoreMissing {
+					continue
+				}
+
+				return fmt.Errorf("object %s has no note", obj)
+			}
+
+			fmt.Fprintf(cmd.ErrOrStderr(), "Removing note for object %s\n", obj)
+			delete(n.entries, obj)
+		}
+
+		return n.commit("Notes removed by 'gogit notes remove'")
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var notesCopyCmd = &cobra.Command{
+	Use:   "copy [-f] <from-object> <to-object>",
+	Short: "Copy the notes from one object onto another",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		n, from, err := openNotes(cmd.ErrOrStderr(), args[:1])
+		if err != nil {
+			return err
+		}
+
+		to, err := resolveNoteObject(n.r, args[1])
+		if err != nil {
+			return err
+		}
+
+		blob, ok := n.entries[from]
+		if !ok {
+			return fmt.Errorf("missing notes on source object %s. Cannot copy", from)
+		}
+
+		if _, ok := n.entries[to]; ok && !notesForce {
+			return fmt.Errorf("cannot copy notes. Found existing notes for object %s. Use '-f' to overwrite existing notes", to)
+		}
+
+		n.entries[to] = blob
+
+		return n.commit("Notes added by 'gogit notes copy'")
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// notes is an in-memory view of a notes tree, which maps annotated objects
+// to the blobs holding their notes.
+type notes struct {
+	r   *git.Repository
+	ref plumbing.ReferenceName
+	tip plumbing.Hash
+
+	// hooks is set for the notes opened to be updated.
+	hooks *hooks
+
+	entries map[plumbing.Hash]plumbing.Hash
+	// others holds the entries of the notes tree root that are not notes,
+	// which git preserves across updates.
+	others []object.TreeEntry
+}
+
+// openNotes opens the repository and the notes tree selected by --ref,
+// resolving the object named in args, or HEAD.
+func openNotes(errOut io.Writer, args []string) (*notes, plumbing.Hash, error) {
+	r, err := git.PlainOpen(".")
+	if err != nil {
+		return nil, plumbing.ZeroHash, err
+	}
+
+	ref, err := notesRefName(r, notesRef)
+	if err != nil {
+		return nil, plumbing.ZeroHash, err
+	}
+
+	n, err := loadNotes(r, ref)
+	if err != nil {
+		return nil, plumbing.ZeroHash, err
+	}
+
+	n.hooks = newHooks(r, errOut)
+
+	rev := plumbing.HEAD.String()
+	if len(args) > 0 {
+		rev = args[0]
+	}
+
+	obj, err := resolveNoteObject(r, rev)
+	if err != nil {
+		return nil, plumbing.ZeroHash, err
+	}
+
+	return n, obj, nil
+}
+
+func resolveNoteObject(r *git.Repository, rev string) (plumbing.Hash, error) {
+	h, err := resolveRevision(r, rev)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to resolve '%s' as a valid ref: %w", rev, err)
+	}
+
+	return h, nil
+}
+
+// notesRefName expands name into a notes reference the way git does. An
+// empty name selects GIT_NOTES_REF, core.notesRef or refs/notes/commits.
+func notesRefName(r *git.Repository, name string) (plumbing.ReferenceName, error) {
+	if name == "" {
+		name = os.Getenv("GIT_NOTES_REF")
+	}
+
+	if name == "" {
+		cfg, err := r.Config()
+		if err != nil {
+			return "", fmt.Errorf("failed to get repository config: %w", err)
+		}
+
+		name = configOption(cfg, "core", "notesref")
+	}
+
+	switch {
+	case name == "":
+		return defaultNotesRef, nil
+	case strings.HasPrefix(name, "refs/notes/"):
+		return plumbing.ReferenceName(name), nil
+	case strings.HasPrefix(name, "notes/"):
+		return plumbing.ReferenceName("refs/" + name), nil
+	default:
+		return plumbing.ReferenceName("refs/notes/" + name), nil
+	}
+}
+
+// loadNotes reads the notes tree pointed at by ref. A missing reference
+// yields an empty notes tree.
+func loadNotes(r *git.Repository, ref plumbing.ReferenceName) (*notes, error) {
+	n := &notes{
+		r:       r,
+		ref:     ref,
+		entries: make(map[plumbing.Hash]plumbing.Hash),
+	}
+
+	tip, err := r.Reference(ref, true)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return n, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", ref, err)
+	}
+
+	n.tip = tip.Hash()
+
+	c, err := r.CommitObject(n.tip)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notes commit: %w", err)
+	}
+
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notes tree: %w", err)
+	}
+
+	err = n.readTree(tree, "")
+
+	return n, err
+}
+
+// readTree collects the notes below tree, whose path so far spells prefix.
+// Notes may be spread over fan-out directories named after the leading
+// bytes of the annotated object name.
+func (n *notes) readTree(tree *object.Tree, prefix string) error {
+	for _, e := range tree.Entries {
+		name := prefix + e.Name
+
+		if e.Mode == filemode.Dir && isHexPrefix(e.Name, 2) {
+			sub, err := n.r.TreeObject(e.Hash)
+			if err != nil {
+				return fmt.Errorf("failed to read notes tree %s: %w", name, err)
+			}
+
+			err = n.readTree(sub, name)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if h, ok := plumbing.FromHex(name); ok && e.Mode.IsFile() {
+			n.entries[h] = e.Hash
+
+			continue
+		}
+
+		if prefix == "" {
+			n.others = append(n.others, e)
+		}
+	}
+
+	return nil
+}
+
+func isHexPrefix(s string, size int) bool {
+	if len(s) != size {
+		return false
+	}
+
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// note returns the content of the note attached to obj.
+func (n *notes) note(obj plumbing.Hash) (string, error) {
+	h, ok := n.entries[obj]
+	if !ok {
+		return "", plumbing.ErrObjectNotFound
+	}
+
+	blob, err := n.r.BlobObject(h)
+	if err != nil {
+		return "", fmt.Errorf("failed to read note %s: %w", h, err)
+	}
+
+	rd, err := blob.Reader()
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = rd.Close() }()
+
+	data, err := io.ReadAll(rd)
+
+	return string(data), err
+}
+
+// set attaches msg to obj, removing the note when msg is empty.
+func (n *notes) set(obj plumbing.Hash, msg string) error {
+	if msg == "" {
+		delete(n.entries, obj)
+
+		return nil
+	}
+
+	blob := n.r.Storer.NewEncodedObject()
+	blob.SetType(plumbing.BlobObject)
+
+	w, err := blob.Writer()
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, msg)
+	if err != nil {
+		_ = w.Close()
+
+		return err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+
+	h, err := n.r.Storer.SetEncodedObject(blob)
+	if err != nil {
+		return fmt.Errorf("failed to write note: %w", err)
+	}
+
+	n.entries[obj] = h
+
+	return nil
+}
+
+// objects returns the annotated objects in hash order.
+func (n *notes) objects() []plumbing.Hash {
+	objs := make([]plumbing.Hash, 0, len(n.entries))
+	for h := range n.entries {
+		objs = append(objs, h)
+	}
+
+	sort.Slice(objs, func(i, j int) bool { return objs[i].String() < objs[j].String() })
+
+	return objs
+}
+
+// commit writes the notes tree and records it in a new commit on top of
+// the notes reference.
+func (n *notes) commit(msg string) error {
+	objs := n.objects()
+
+	// Like git, fan out into two-character directories once a single
+	// tree would hold more than 255 notes.
+	fanout := 0
+	for count := len(objs); count > 0xff; count >>= 8 {
+		fanout++
+	}
+
+	tree, err := n.writeTree(objs, 0, fanout, n.others)
+	if err != nil {
+		return err
+	}
+
+	c := &object.Commit{
+		Author:    signature(n.r, authorRole),
+		Committer: signature(n.r, committerRole),
+		Message:   msg + "\n",
+		TreeHash:  tree,
+	}
+
+	if !n.tip.IsZero() {
+		c.ParentHashes = []plumbing.Hash{n.tip}
+	}
+
+	h, err := storeObject(n.r.Storer, c)
+	if err != nil {
+		return fmt.Errorf("failed to write notes commit: %w", err)
+	}
+
+	return inRefTransaction(n.hooks, staticReflogMessage("notes: "+msg), func() error {
+		err := n.r.Storer.SetReference(plumbing.NewHashReference(n.ref, h))
+		if err != nil {
+			return fmt.Errorf("failed to update %s: %w", n.ref, err)
+		}
+
+		return nil
+	})
+}
+
+// writeTree writes the tree holding objs, whose names all share their
+// first depth*2 hex digits, spreading them over fanout more levels.
+func (n *notes) writeTree(objs []plumbing.Hash, depth, fanout int, extra []object.TreeEntry) (plumbing.Hash, error) {
+	tree := &object.Tree{Entries: append([]object.TreeEntry(nil), extra...)}
+
+	for i := 0; i < len(objs); {
+		name := objs[i].String()[depth*2:]
+
+		if fanout == 0 {
+			tree.Entries = append(tree.Entries, object.TreeEntry{
+				Name: name,
+				Mode: filemode.Regular,
+				Hash: n.entries[objs[i]],
+			})
+			i++
+
+			continue
+		}
+
+		dir := name[:2]
+
+		j := i
+		for j < len(objs) && objs[j].String()[depth*2:depth*2+2] == dir {
+			j++
+		}
+
+		sub, err := n.writeTree(objs[i:j], depth+1, fanout-1, nil)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		tree.Entries = append(tree.Entries, object.TreeEntry{Name: dir, Mode: filemode.Dir, Hash: sub})
+		i = j
+	}
+
+	sort.Sort(object.TreeEntrySorter(tree.Entries))
+
+	return storeObject(n.r.Storer, tree)
+}
+
+// notesMessage builds the note from the -m and -F flags, joining
+// paragraphs with blank lines and cleaning up whitespace like git.
+func notesMessage(stdin io.Reader) (string, error) {
+	paragraphs := append([]string(nil), notesMessages...)
+
+	if notesFile != "" {
+		var (
+			data []byte
+			err  error
+		)
+
+		if notesFile == "-" {
+			data, err = io.ReadAll(stdin)
+		} else {
+			data, err = os.ReadFile(notesFile)
+		}
+
+		if err != nil {
+			return "", fmt.Errorf("failed to read note message: %w", err)
+		}
+
+		paragraphs = append(paragraphs, string(data))
+	}
+
+	if len(paragraphs) == 0 {
+		return "", errors.New("no note message given, use -m or -F")
+	}
+
+	var sb strings.Builder
+
+	for _, p := range paragraphs {
+		p = stripSpace(p)
+		if p == "" {
+			continue
+		}
+
+		if sb.Len() > 0 {
+			sb.WriteString("\n")
+		}
+
+		sb.WriteString(p)
+	}
+
+	return sb.String(), nil
+}
+
+// stripSpace removes trailing whitespace from every line, collapses runs
+// of blank lines and ensures text ends with a single newline.
+func stripSpace(text string) string {
+	var (
+		lines []string
+		blank bool
+	)
+
+	for line := range strings.Lines(text) {
+		line = strings.TrimRight(line, " \t\r\n")
+		if line == "" {
+			blank = len(lines) > 0
+
+			continue
+		}
+
+		if blank {
+			lines = append(lines, "")
+			blank = false
+		}
+
+		lines = append(lines, line)
+	}
+
+	if len(lines) == 0 {
+		return ""
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// storeObject encodes o into a new object of s and writes it.
+func storeObject(s storer.EncodedObjectStorer, o interface {
+	Encode(plumbing.EncodedObject) error
+},
+) (plumbing.Hash, error) {
+	obj := s.NewEncodedObject()
+
+	err := o.Encode(obj)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return s.SetEncodedObject(obj)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// notesTree returns the notes of ref in dir as git lists their tree, with
+// the messages of the notes history, which name the command that wrote
+// them.
+func notesTree(t *testing.T, dir, ref string) string {
+	t.Helper()
+
+	if run(t, dir, "", "git", "rev-parse", "-q", "--verify", ref).code != 0 {
+		return ""
+	}
+
+	messages := strings.ReplaceAll(gitCmd(t, dir, "log", "--format=%s", ref), "'gogit ", "'git ")
+
+	return gitCmd(t, dir, "ls-tree", "-r", ref) + messages
+}
+
+// TestNotes runs the same notes commands with git and gogit and checks
+// their output and the notes trees they write.
+func TestNotes(t *testing.T) {
+	steps := [][]string{
+		{"notes", "add", "-m", "first", "HEAD~1"},
+		{"notes", "add", "-m", "again", "HEAD~1"},
+		{"notes", "add", "-f", "-m", "replaced", "-m", "second paragraph", "HEAD~1"},
+		{"notes", "append", "-m", "more"},
+		{"notes", "append", "-m", "appended", "HEAD~1"},
+		{"notes", "list"},
+		{"notes", "list", "HEAD"},
+		{"notes", "show", "HEAD~1"},
+		{"notes", "show", "HEAD~2"},
+		{"notes", "copy", "HEAD", "HEAD~2"},
+		{"notes", "copy", "HEAD", "HEAD~2"},
+		{"notes", "copy", "-f", "HEAD~1", "HEAD~2"},
+		{"notes"},
+		{"notes", "--ref", "ci", "add", "-m", "passed", "HEAD"},
+		{"notes", "--ref", "refs/notes/ci", "show"},
+		{"log", "-n", "2"},
+		{"log", "-n", "2", "--notes=ci"},
+		{"log", "--oneline", "--notes"},
+		{"notes", "remove", "HEAD~2"},
+		{"notes", "remove", "HEAD~2"},
+		{"notes", "remove", "--ignore-missing", "HEAD~2", "HEAD"},
+		{"notes", "list"},
+	}
+
+	var states []string
+
+	for _, tool := range []string{"git", "gogit"} {
+		dir := gitRepo(t, []string{"a", "1"}, []string{"a", "2"}, []string{"a", "3"})
+
+		var state strings.Builder
+
+		for _, args := range steps {
+			var res result
+			if tool == "git" {
+				res = run(t, dir, "", "git", args...)
+			} else {
+				res = gogit(t, dir, args...)
+			}
+
+			fmt.Fprintf(&state, "%v exit %v\n%s", args, res.code == 0, res.stdout)
+		}
+
+		state.WriteString(notesTree(t, dir, "refs/notes/commits"))
+		state.WriteString(notesTree(t, dir, "refs/notes/ci"))
+
+		states = append(states, state.String())
+	}
+
+	if states[1] != states[0] {
+		t.Errorf("gogit notes gave:\n%s\nwant, as git:\n%s", states[1], states[0])
+	}
+}
+
+// fanoutRepo returns a repository made by git with enough notes for git
+// to spread them in fan-out directories.
+func fanoutRepo(t *testing.T) string {
+	t.Helper()
+
+	dir := gitRepo(t)
+
+	var stream strings.Builder
+
+	for i := 1; i <= 300; i++ {
+		fmt.Fprintf(&stream, "commit refs/heads/main\nmark :%d\ncommitter C <c@x> %d +0000\ndata 4\nc%03d\n", i, 1700000000+i, i)
+
+		if i > 1 {
+			fmt.Fprintf(&stream, "from :%d\n", i-1)
+		}
+
+		fmt.Fprintf(&stream, "M 644 inline f\ndata 4\n%03d\n\n", i)
+	}
+
+	stream.WriteString("commit refs/notes/commits\ncommitter C <c@x> 1700000000 +0000\ndata 5\nnotes\n")
+
+	for i := 1; i < 300; i++ {
+		fmt.Fprintf(&stream, "N inline :%d\ndata 4\nn%03d\n", i, i)
+	}
+
+	stream.WriteString("\n")
+
+	gitCmdStdin(t, dir, stream.String(), "fast-import", "--quiet")
+	gitCmd(t, dir, "reset", "-q", "--hard", "main")
+
+	// git only spreads notes in fan-out directories when it writes them.
+	gitCmd(t, dir, "notes", "add", "-m", "n300")
+
+	if !strings.Contains(gitCmd(t, dir, "ls-tree", "-d", "refs/notes/commits"), " tree ") {
+		t.Fatal("git wrote no fan-out directory")
+	}
+
+	return dir
+}
+
+func TestNotesFanout(t *testing.T) {
+	dir := fanoutRepo(t)
+
+	sameOutput(t, dir, "notes", "list")
+	sameOutput(t, dir, "notes", "show", "HEAD~1")
+	sameOutput(t, dir, "log", "-n", "5")
+
+	var trees []string
+
+	for _, tool := range []string{"git", "gogit"} {
+		clone := filepath.Join(t.TempDir(), tool)
+		gitCmd(t, "", "clone", "-q", "--mirror", dir, clone)
+
+		for _, args := range [][]string{
+			{"notes", "add", "-f", "-m", "replaced", "HEAD~2"},
+			{"notes", "remove", "HEAD~3"},
+		} {
+			if tool == "git" {
+				gitCmd(t, clone, args...)
+			} else {
+				mustGogit(t, clone, args...)
+			}
+		}
+
+		trees = append(trees, gitCmd(t, clone, "ls-tree", "-r", "-t", "refs/notes/commits"))
+	}
+
+	if trees[1] != trees[0] {
+		t.Errorf("gogit notes wrote the notes tree:\n%s\nwant, as git:\n%s", trees[1], trees[0])
+	}
+}
+
+// TestNotesFetchPush checks that notes references go through fetch and
+// push like any other.
+func TestNotesFetchPush(t *testing.T) {
+	src := gitRepo(t, []string{"a", "1"}, []string{"a", "2"})
+	gitCmd(t, src, "notes", "add", "-m", "from git", "HEAD")
+
+	dir := filepath.Join(t.TempDir(), "clone")
+	gitCmd(t, "", "clone", "-q", src, dir)
+
+	mustGogit(t, dir, "fetch", "origin", "refs/notes/*:refs/notes/*")
+
+	if got := gitCmd(t, dir, "notes", "show", "HEAD"); got != "from git\n" {
+		t.Errorf("fetched notes %q, want %q", got, "from git\n")
+	}
+
+	bare := filepath.Join(t.TempDir(), "bare.git")
+	gitCmd(t, "", "init", "-q", "--bare", bare)
+	gitCmd(t, dir, "remote", "add", "bare", bare)
+
+	mustGogit(t, dir, "notes", "append", "-m", "from gogit", "HEAD")
+	mustGogit(t, dir, "push", "bare", "main", "refs/notes/commits")
+
+	if got, want := gitCmd(t, bare, "notes", "show", "main"), "from git\n\nfrom gogit\n"; got != want {
+		t.Errorf("pushed notes %q, want %q", got, want)
+	}
+}
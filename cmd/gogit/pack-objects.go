@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bufio"
+	"crypto"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	formatcfg "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/format/packfile"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/storage"
+	"github.com/spf13/cobra"
+)
+
+// encoderMaxDepth is the length of the longest delta chains the pack
+// encoder of go-git makes.
+const encoderMaxDepth = 50
+
+var (
+	packObjectsStdout bool
+	packObjectsRevs   bool
+	packObjectsWindow int
+	packObjectsDepth  int
+	packObjectsThin   bool
+)
+
+func init() {
+	packObjectsCmd.Flags().BoolVarP(&packObjectsStdout, "stdout", "", false, "Write the pack to the standard output")
+	packObjectsCmd.Flags().BoolVarP(&packObjectsRevs, "revs", "", false, "Read revisions instead of objects from the standard input")
+	packObjectsCmd.Flags().IntVarP(&packObjectsWindow, "window", "", 10, "Number of objects considered as delta bases for each object")
+	packObjectsCmd.Flags().IntVarP(&packObjectsDepth, "depth", "", 50, "Maximum length of delta chains")
+	packObjectsCmd.Flags().BoolVarP(&packObjectsThin, "thin", "", false, "Create a thin pack, with deltas against objects left out of it")
+	rootCmd.AddCommand(packObjectsCmd)
+}
+
+var packObjectsCmd = &cobra.Command{
+	Use:   "pack-objects [--revs] [--thin] [--window=<n>] [--depth=<n>] (--stdout | <base-name>)",
+	Short: "Create a pack of objects",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if packObjectsStdout == (len(args) == 1) {
+			return cmd.Usage()
+		}
+
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		of, err := packObjectFormat(r, "")
+		if err != nil {
+			return err
+		}
+
+		b := newPackBuilder(r, packObjectsWindow, packObjectsDepth)
+		b.thin = packObjectsThin
+
+		if packObjectsRevs {
+			err = b.readRevs(cmd.InOrStdin())
+		} else {
+			err = b.readObjects(cmd.InOrStdin())
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if packObjectsStdout {
+			bw := bufio.NewWriter(cmd.OutOrStdout())
+
+			_, err = b.write(bw, objectFormatHash(of))
+			if err != nil {
+				return err
+			}
+
+			return bw.Flush()
+		}
+
+		h, err := writePackFile(args[0], of, b.write)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(cmd.OutOrStdout(), h)
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// writePackFile writes the pack produced by write to
+// <base-name>-<checksum>.pack, indexes it and returns its checksum.
+func writePackFile(base string, of formatcfg.ObjectFormat, write func(w io.Writer, ch crypto.Hash) (plumbing.Hash, error)) (plumbing.Hash, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(base), "tmp_pack_")
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to create temporary pack: %w", err)
+	}
+
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	bw := bufio.NewWriter(tmp)
+
+	h, err := write(bw, objectFormatHash(of))
+	if err == nil {
+		err = bw.Flush()
+	}
+
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0o444)
+	}
+
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to write pack: %w", err)
+	}
+
+	packPath := fmt.Sprintf("%s-%s.pack", base, h)
+
+	err = os.Rename(tmp.Name(), packPath)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to write pack: %w", err)
+	}
+
+	idx, err := indexPackFile(packPath, of)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	err = writePackIndex(strings.TrimSuffix(packPath, ".pack")+".idx", idx, of, false)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return h, nil
+}
+
+// packBuilder collects the objects of a pack and writes it.
+type packBuilder struct {
+	r         *git.Repository
+	entries   []*packEntry
+	preferred []*packEntry
+	seen      map[plumbing.Hash]bool
+
+	// window and depth bound the search for deltas and their chains,
+	// noReuse has the deltas computed afresh rather than taken from the
+	// existing packs, and thin lets the deltas be made against the objects
+	// of the edge commits, left out of the pack.
+	window  int
+	depth   int
+	noReuse bool
+	thin    bool
+}
+
+func newPackBuilder(r *git.Repository, window, depth int) *packBuilder {
+	return &packBuilder{r: r, seen: make(map[plumbing.Hash]bool), window: window, depth: depth}
+}
+
+// readObjects reads the objects to pack, one "<object-id> [<name>]" per
+// line, with "-<object-id>" lines naming the commits whose objects a thin
+// pack may make deltas against.
+func (b *packBuilder) readObjects(in io.Reader) error {
+	var edges []plumbing.Hash
+
+	s := bufio.NewScanner(in)
+
+	for s.Scan() {
+		line := s.Text()
+		if line == "" {
+			continue
+		}
+
+		if edge, ok := strings.CutPrefix(line, "-"); ok {
+			h, ok := plumbing.FromHex(edge)
+			if !ok {
+				return fmt.Errorf("expected edge object ID, got garbage:\n %s", line)
+			}
+
+			edges = append(edges, h)
+
+			continue
+		}
+
+		hex, name, _ := strings.Cut(line, " ")
+
+		h, ok := plumbing.FromHex(hex)
+		if !ok || len(hex) != h.HexSize() {
+			return fmt.Errorf("expected object ID, got garbage:\n %s", line)
+		}
+
+		err := b.add(h, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return err
+	}
+
+	return b.addPreferredCommits(edges)
+}
+
+// readRevs reads the revisions whose objects to pack, as given to
+// rev-list, one per line, with --not negating the revisions after it.
+func (b *packBuilder) readRevs(in io.Reader) error {
+	w := &revWalk{r: b.r}
+	not := false
+
+	s := bufio.NewScanner(in)
+
+	for s.Scan() {
+		line := s.Text()
+
+		switch {
+		case line == "":
+			continue
+		case line == "--not":
+			not = !not
+
+			continue
+		case not && strings.HasPrefix(line, "^"):
+			line = line[1:]
+		case not:
+			line = "^" + line
+		}
+
+		err := w.addArg(line)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return err
+	}
+
+	commits, boundary, err := w.walk()
+	if err != nil {
+		return err
+	}
+
+	objects, err := w.objects(commits, boundary)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range commits {
+		err = b.add(c.Hash, "")
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, line := range objects {
+		hex, name, _ := strings.Cut(line, " ")
+
+		err = b.add(plumbing.NewHash(hex), name)
+		if err != nil {
+			return err
+		}
+	}
+
+	edges := append([]plumbing.Hash(nil), w.negatives...)
+	for _, c := range boundary {
+		if w.uninteresting[c.Hash] {
+			edges = append(edges, c.Hash)
+		}
+	}
+
+	return b.addPreferredCommits(edges)
+}
+
+func (b *packBuilder) add(h plumbing.Hash, name string) error {
+	if b.seen[h] {
+		return nil
+	}
+
+	b.seen[h] = true
+
+	err := b.r.Storer.HasEncodedObject(h)
+	if err != nil {
+		return fmt.Errorf("failed to read object %s: %w", h, err)
+	}
+
+	b.entries = append(b.entries, &packEntry{hash: h, name: name})
+
+	return nil
+}
+
+// addPreferredCommits adds the trees and blobs of the commits hashes as
+// delta bases for a thin pack.
+func (b *packBuilder) addPreferredCommits(hashes []plumbing.Hash) error {
+	if !b.thin {
+		return nil
+	}
+
+	for _, h := range hashes {
+		c, err := b.r.CommitObject(h)
+		if err != nil {
+			return fmt.Errorf("bad edge commit %s: %w", h, err)
+		}
+
+		ow := &objectWalk{r: b.r, seen: make(map[plumbing.Hash]bool)}
+
+		err = ow.addTree(c.TreeHash, "")
+		if err != nil {
+			return err
+		}
+
+		for _, line := range ow.lines {
+			hex, name, _ := strings.Cut(line, " ")
+
+			h := plumbing.NewHash(hex)
+			if b.seen[h] {
+				continue
+			}
+
+			b.seen[h] = true
+			b.preferred = append(b.preferred, &packEntry{hash: h, name: name, preferred: true})
+		}
+	}
+
+	return nil
+}
+
+// write writes the pack to w. The pack encoder of go-git is used, reusing
+// the deltas of the existing packs unless noReuse is set, but for thin
+// packs and delta chains shorter than it makes, which writeDeltas handles.
+func (b *packBuilder) write(w io.Writer, ch crypto.Hash) (plumbing.Hash, error) {
+	if len(b.preferred) > 0 || b.depth < encoderMaxDepth {
+		return b.writeDeltas(w, ch)
+	}
+
+	hashes := make([]plumbing.Hash, len(b.entries))
+	for i, e := range b.entries {
+		hashes[i] = e.hash
+	}
+
+	var s storer.EncodedObjectStorer = b.r.Storer
+	if b.noReuse {
+		s = freshDeltas{b.r.Storer}
+	}
+
+	h, err := packfile.NewEncoder(w, s, false).Encode(hashes, uint(max(b.window, 0)))
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to write pack: %w", err)
+	}
+
+	return h, nil
+}
+
+// freshDeltas hides the stored deltas of a storage from the pack encoder,
+// which then computes them afresh.
+type freshDeltas struct {
+	storage.Storer
+}
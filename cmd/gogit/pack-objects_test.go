@@ -0,0 +1,88 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// packObjects returns the objects of pack as git verify-pack lists them,
+// without their sizes, offsets or delta bases.
+func packObjects(t *testing.T, dir, pack string) []string {
+	t.Helper()
+
+	var objects []string
+
+	for _, line := range strings.Split(gitCmd(t, dir, "verify-pack", "-v", pack), "\n") {
+		if f := strings.Fields(line); len(f) >= 5 && len(f[0]) == 40 {
+			objects = append(objects, f[0]+" "+f[1])
+		}
+	}
+
+	return sortedLines(strings.Join(objects, "\n"))
+}
+
+// TestPackObjects checks that gogit packs the objects git packs, in packs
+// git reads.
+func TestPackObjects(t *testing.T) {
+	dir := packRepo(t)
+	gitCmd(t, dir, "tag", "-a", "-m", "v1", "v1", "main~1")
+
+	for _, revs := range []string{"main\n", "main\nv1\n", "main\n^main~2\n", "v1\n"} {
+		t.Run(strings.TrimSpace(revs), func(t *testing.T) {
+			want := filepath.Join(t.TempDir(), "git")
+			h := strings.TrimSpace(gitCmdStdin(t, dir, revs, "pack-objects", "-q", "--revs", want))
+			want += "-" + h + ".idx"
+
+			got := filepath.Join(t.TempDir(), "gogit")
+
+			res := gogitStdin(t, dir, revs, "pack-objects", "--revs", got)
+			if res.code != 0 {
+				t.Fatalf("gogit pack-objects failed: %s", res.stderr)
+			}
+
+			got += "-" + strings.TrimSpace(res.stdout) + ".idx"
+
+			if g, w := strings.Join(packObjects(t, dir, got), "\n"), strings.Join(packObjects(t, dir, want), "\n"); g != w {
+				t.Errorf("gogit packed:\n%s\nwant, as git:\n%s", g, w)
+			}
+		})
+	}
+
+	// The objects may also be named one per line.
+	objects := gitCmdStdin(t, dir, "main\n", "rev-list", "--objects", "--stdin")
+
+	res := gogitStdin(t, dir, objects, "pack-objects", "--stdout", "--window=0")
+	if res.code != 0 {
+		t.Fatalf("gogit pack-objects --stdout failed: %s", res.stderr)
+	}
+
+	clone := gitRepo(t)
+	gitCmdStdin(t, clone, res.stdout, "index-pack", "--stdin")
+	gitCmd(t, clone, "update-ref", "refs/heads/main", gitCmd(t, dir, "rev-parse", "main")[:40])
+	gitCmd(t, clone, "fsck", "--strict")
+}
+
+// TestPackObjectsThin checks that git completes the thin packs of gogit.
+func TestPackObjectsThin(t *testing.T) {
+	src := packRepo(t)
+
+	dir := filepath.Join(t.TempDir(), "clone")
+	gitCmd(t, "", "clone", "-q", "--no-local", src, dir)
+
+	writeFile(t, src, "d1/f01", strings.Repeat("some line\n", 50)+"changed\n")
+	gitCmd(t, src, "commit", "-q", "-a", "-m", "thin")
+
+	res := gogitStdin(t, src, "main\n^main~1\n", "pack-objects", "--revs", "--thin", "--stdout")
+	if res.code != 0 {
+		t.Fatalf("gogit pack-objects --thin failed: %s", res.stderr)
+	}
+
+	if r := run(t, gitRepo(t), res.stdout, "git", "index-pack", "--stdin"); r.code == 0 {
+		t.Error("the pack of gogit pack-objects --thin is not thin")
+	}
+
+	gitCmdStdin(t, dir, res.stdout, "index-pack", "--stdin", "--fix-thin")
+	gitCmd(t, dir, "update-ref", "refs/heads/main", gitCmd(t, src, "rev-parse", "main")[:40])
+	gitCmd(t, dir, "fsck", "--strict")
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/spf13/cobra"
+)
+
+// packedRefsHeader is the first line of the packed-refs files git writes,
+// announcing that they are sorted and that annotated tags are followed by
+// the object they peel to.
+const packedRefsHeader = "# pack-refs with: peeled fully-peeled sorted \n"
+
+var (
+	packRefsAll     bool
+	packRefsNoPrune bool
+)
+
+func init() {
+	packRefsCmd.Flags().BoolVarP(&packRefsAll, "all", "", false, "Pack all the references, not only the tags")
+	packRefsCmd.Flags().BoolVarP(&packRefsNoPrune, "no-prune", "", false, "Keep the loose references after packing them")
+	rootCmd.AddCommand(packRefsCmd)
+}
+
+var packRefsCmd = &cobra.Command{
+	Use:   "pack-refs [--all] [--no-prune]",
+	Short: "Pack the references into the packed-refs file",
+	Args:  cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		return packRefs(r, packRefsAll, !packRefsNoPrune)
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// packRefs rewrites the packed-refs file with the references already in it
+// and the loose tags or, with all, every loose reference, removing the
+// loose references packed with prune. Symbolic references stay loose.
+func packRefs(r *git.Repository, all, prune bool) error {
+	store, ok := r.Storer.(*filesystem.Storage)
+	if !ok {
+		return errors.New("storer does not implement filesystem.Storage")
+	}
+
+	fs := store.Filesystem()
+	loose := make(map[plumbing.ReferenceName]bool)
+
+	err := util.Walk(fs, "refs", func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		if !info.IsDir() {
+			loose[plumbing.ReferenceName(filepath.ToSlash(p))] = true
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list loose references: %w", err)
+	}
+
+	refs, err := sortedReferences(r)
+	if err != nil {
+		return err
+	}
+
+	var (
+		b      strings.Builder
+		packed []plumbing.ReferenceName
+	)
+
+	b.WriteString(packedRefsHeader)
+
+	for _, ref := range refs {
+		name := ref.Name()
+		if loose[name] && !all && !name.IsTag() {
+			continue
+		}
+
+		// sortedReferences resolves symbolic references, which are not
+		// packed.
+		if loose[name] {
+			if raw, err := r.Storer.Reference(name); err != nil || raw.Type() != plumbing.HashReference {
+				continue
+			}
+
+			packed = append(packed, name)
+		}
+
+		fmt.Fprintf(&b, "%s %s\n", ref.Hash(), name)
+
+		if peeled, ok := peelTag(r, ref.Hash()); ok {
+			fmt.Fprintf(&b, "^%s\n", peeled)
+		}
+	}
+
+	err = writeLockedFile(fs, "packed-refs", b.String())
+	if err != nil {
+		return fmt.Errorf("failed to write packed-refs: %w", err)
+	}
+
+	if !prune {
+		return nil
+	}
+
+	for _, name := range packed {
+		err = fs.Remove(name.String())
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove loose reference %s: %w", name, err)
+		}
+
+		// Like git, the directories left empty are removed, but for the
+		// top-level ones such as refs/heads.
+		for dir := path.Dir(name.String()); strings.Count(dir, "/") > 1; dir = path.Dir(dir) {
+			if fs.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// peelTag returns the object the annotated tag h ultimately points to, and
+// whether h is an annotated tag at all.
+func peelTag(r *git.Repository, h plumbing.Hash) (plumbing.Hash, bool) {
+	peeled := false
+
+	for {
+		tag, err := r.TagObject(h)
+		if err != nil {
+			return h, peeled
+		}
+
+		h, peeled = tag.Target, true
+	}
+}
+
+// writeLockedFile replaces the file name with content, the way git does:
+// through a <name>.lock file that also keeps others from writing it.
+func writeLockedFile(fs billy.Filesystem, name, content string) error {
+	lock := name + ".lock"
+
+	f, err := fs.OpenFile(lock, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return fmt.Errorf("unable to create %s: %w", lock, err)
+	}
+
+	_, err = f.Write([]byte(content))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		err = fs.Rename(lock, name)
+	}
+
+	if err != nil {
+		if rerr := fs.Remove(lock); rerr != nil {
+			slog.Debug("failed to remove lock file", "error", rerr)
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPackRefs(t *testing.T) {
+	for _, args := range []string{"", "--all", "--all --no-prune"} {
+		t.Run(args, func(t *testing.T) {
+			var states []string
+
+			for _, tool := range []string{"git", "gogit"} {
+				dir := gcRepo(t)
+				gitCmd(t, dir, "update-ref", "refs/custom/x", "HEAD~1")
+				gitCmd(t, dir, "tag", "light", "HEAD~1")
+
+				a := append([]string{"pack-refs"}, strings.Fields(args)...)
+				if tool == "git" {
+					gitCmd(t, dir, a...)
+				} else {
+					mustGogit(t, dir, a...)
+				}
+
+				state := storeState(t, dir)
+
+				for _, ref := range []string{"heads/main", "heads/topic", "tags/v1", "tags/light", "custom/x"} {
+					if exists(t, dir, ".git/refs/"+ref) {
+						state += "loose " + ref + "\n"
+					}
+				}
+
+				states = append(states, state)
+			}
+
+			if states[1] != states[0] {
+				t.Errorf("gogit pack-refs %s left:\n%s\nwant, as git:\n%s", args, states[1], states[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"compress/zlib"
+	"crypto"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/packfile"
+	"github.com/go-git/go-git/v6/plumbing/hash"
+	gitbinary "github.com/go-git/go-git/v6/utils/binary"
+)
+
+// packHeaderSize is the size of the signature, version and object count
+// a pack starts with.
+const packHeaderSize = 12
+
+// packEntry is an object to be written to a pack, either whole or as a
+// delta against base. Its data is only held while it is a candidate delta
+// base, the whole objects being streamed from the repository when written.
+type packEntry struct {
+	hash plumbing.Hash
+	typ  plumbing.ObjectType
+	size int64
+	name string
+	data []byte
+
+	base  *packEntry
+	delta []byte
+	depth int
+
+	// preferred is set for the objects of a thin pack that may be used as
+	// delta bases but are left out of it.
+	preferred bool
+	written   bool
+	offset    int64
+}
+
+// readPackEntry reads the type and size of the object h of r into a pack
+// entry named name.
+func readPackEntry(r *git.Repository, h plumbing.Hash, name string) (*packEntry, error) {
+	e := &packEntry{hash: h, name: name}
+
+	err := e.readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func (e *packEntry) readHeader(r *git.Repository) error {
+	obj, err := r.Storer.EncodedObject(plumbing.AnyObject, e.hash)
+	if err != nil {
+		return fmt.Errorf("failed to read object %s: %w", e.hash, err)
+	}
+
+	e.typ, e.size = obj.Type(), obj.Size()
+
+	return nil
+}
+
+// object returns the object of e.
+func (e *packEntry) object(r *git.Repository) (plumbing.EncodedObject, error) {
+	obj, err := r.Storer.EncodedObject(e.typ, e.hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object %s: %w", e.hash, err)
+	}
+
+	return obj, nil
+}
+
+// load reads the contents of the object of e into its data.
+func (e *packEntry) load(r *git.Repository) error {
+	obj, err := e.object(r)
+	if err != nil {
+		return err
+	}
+
+	rd, err := obj.Reader()
+	if err != nil {
+		return fmt.Errorf("failed to read object %s: %w", e.hash, err)
+	}
+
+	e.data, err = io.ReadAll(rd)
+	if cerr := rd.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to read object %s: %w", e.hash, err)
+	}
+
+	return nil
+}
+
+// writeDeltas writes the packs the pack encoder of go-git cannot: thin
+// packs, with deltas against the preferred objects left out of them, and
+// packs with delta chains at most depth long. The objects are written in
+// the order they were added in, but for delta bases written before their
+// deltas.
+func (b *packBuilder) writeDeltas(w io.Writer, ch crypto.Hash) (plumbing.Hash, error) {
+	for _, e := range append(b.preferred, b.entries...) {
+		err := e.readHeader(b.r)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	err := b.deltify()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	pw := newPackWriter(w, ch)
+
+	err = pw.header(uint32(len(b.entries)))
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	for _, e := range b.entries {
+		err = b.writeEntry(pw, e)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	return pw.footer()
+}
+
+// deltify chooses the delta base of each object among the window objects
+// before it when sorted, like git, by type, name, thin pack bases first and
+// decreasing size, so that delta chains are at most depth long. Only the
+// data of the objects in the window is held at a time.
+func (b *packBuilder) deltify() error {
+	if b.window <= 0 || b.depth <= 0 {
+		return nil
+	}
+
+	sorted := make([]*packEntry, 0, len(b.entries)+len(b.preferred))
+	sorted = append(sorted, b.preferred...)
+	sorted = append(sorted, b.entries...)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+
+		if a.typ != b.typ {
+			return a.typ < b.typ
+		}
+
+		if na, nb := path.Base(a.name), path.Base(b.name); na != nb {
+			return na < nb
+		}
+
+		if a.preferred != b.preferred {
+			return a.preferred
+		}
+
+		return a.size > b.size
+	})
+
+	for i, e := range sorted {
+		if i > b.window {
+			sorted[i-b.window-1].data = nil
+		}
+
+		err := e.load(b.r)
+		if err != nil {
+			return err
+		}
+
+		if e.preferred {
+			continue
+		}
+
+		// Like git, objects are only stored as deltas smaller than about
+		// half of their size.
+		best := len(e.data)/2 - e.hash.Size()
+
+		for j := max(0, i-b.window); j < i; j++ {
+			base := sorted[j]
+			if base.typ != e.typ || base.depth >= b.depth {
+				continue
+			}
+
+			delta := packfile.DiffDelta(base.data, e.data)
+			if len(delta) < best {
+				best = len(delta)
+				e.base, e.delta, e.depth = base, delta, base.depth+1
+			}
+		}
+	}
+
+	for _, e := range sorted {
+		e.data = nil
+	}
+
+	return nil
+}
+
+func (b *packBuilder) writeEntry(pw *packWriter, e *packEntry) error {
+	if e.written {
+		return nil
+	}
+
+	if e.base != nil && !e.base.preferred {
+		err := b.writeEntry(pw, e.base)
+		if err != nil {
+			return err
+		}
+	}
+
+	e.written = true
+
+	return pw.entry(b.r, e)
+}
+
+// packWriter writes a pack, keeping track of the offset and the checksum
+// of what it has written.
+type packWriter struct {
+	w      io.Writer
+	hasher hash.Hash
+	offset int64
+}
+
+func newPackWriter(w io.Writer, ch crypto.Hash) *packWriter {
+	return &packWriter{w: w, hasher: hash.New(ch)}
+}
+
+func (pw *packWriter) Write(p []byte) (int, error) {
+	n, err := pw.w.Write(p)
+	pw.hasher.Write(p[:n])
+	pw.offset += int64(n)
+
+	return n, err
+}
+
+// header writes the signature, version and object count of the pack.
+func (pw *packWriter) header(count uint32) error {
+	_, err := pw.Write(packHeader(count))
+
+	return err
+}
+
+// packHeader returns the signature, version and object count of a pack of
+// count objects.
+func packHeader(count uint32) []byte {
+	buf := make([]byte, packHeaderSize)
+	copy(buf, "PACK")
+	binary.BigEndian.PutUint32(buf[4:], packfile.VersionSupported)
+	binary.BigEndian.PutUint32(buf[8:], count)
+
+	return buf
+}
+
+// entry writes e, as an offset delta against a base in the pack, as a
+// reference delta against one left out of it, or whole, streaming the
+// object from r.
+func (pw *packWriter) entry(r *git.Repository, e *packEntry) error {
+	e.offset = pw.offset
+
+	typ, size := e.typ, e.size
+
+	if e.base != nil {
+		typ, size = plumbing.OFSDeltaObject, int64(len(e.delta))
+		if e.base.preferred {
+			typ = plumbing.REFDeltaObject
+		}
+	}
+
+	// The type and size are packed into the first byte, with the rest of
+	// the size in the 7 low bits of the bytes that follow.
+	c := byte(typ)<<4 | byte(size&0x0f)
+	header := make([]byte, 0, 10)
+
+	for size >>= 4; size != 0; size >>= 7 {
+		header = append(header, c|0x80)
+		c = byte(size & 0x7f)
+	}
+
+	_, err := pw.Write(append(header, c))
+	if err != nil {
+		return err
+	}
+
+	switch typ {
+	case plumbing.OFSDeltaObject:
+		err = gitbinary.WriteVariableWidthInt(pw, e.offset-e.base.offset)
+	case plumbing.REFDeltaObject:
+		_, err = e.base.hash.WriteTo(pw)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	var obj plumbing.EncodedObject
+
+	if e.base == nil {
+		obj, err = e.object(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	zw := zlib.NewWriter(pw)
+
+	if obj != nil {
+		err = copyObject(zw, obj)
+	} else {
+		_, err = zw.Write(e.delta)
+	}
+
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// footer writes the checksum of the pack and returns it.
+func (pw *packWriter) footer() (plumbing.Hash, error) {
+	h, ok := plumbing.FromBytes(pw.hasher.Sum(nil))
+	if !ok {
+		return plumbing.ZeroHash, errors.New("invalid pack checksum")
+	}
+
+	_, err := pw.w.Write(h.Bytes())
+
+	return h, err
+}
@@ -0,0 +1,1417 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/object"
+)
+
+const (
+	// patchContext is the number of unchanged lines shown around changes.
+	patchContext = 3
+
+	// binaryPrefix is how much of a file git looks at for a NUL byte to
+	// tell whether it is binary.
+	binaryPrefix = 8000
+
+	// funcNameWidth is the most of a function line git shows after the
+	// range of a hunk.
+	funcNameWidth = 80
+
+	// base85Alphabet is the alphabet of the base85 encoding of binary
+	// patches.
+	base85Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz!#$%&()*+-;<=>?@^_`{|}~"
+)
+
+// diffLine is a line of a line diff: ' ' for a line both sides have, '-'
+// for one only the old side has and '+' for one only the new side has.
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// splitLines splits s after each newline, so that the last line lacks one
+// when s does not end with a newline.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// diffLines returns a minimal line diff turning a into b, computed the way
+// git's xdiff does. Like git, the lines removed by a change come before
+// the ones added, and changes that could be made at several places are
+// moved to where they line up with changes of the other side, or else to
+// where the indentation of the lines around them suggests.
+func diffLines(a, b []string) []diffLine {
+	return lineDiff(a, b, true)
+}
+
+// lineDiff is diffLines, with the indent heuristic optional. Without it,
+// changes that could be made at several places are made at the last.
+func lineDiff(a, b []string, indentHeuristic bool) []diffLine {
+	da, db := newDiffSide(a), newDiffSide(b)
+	xdiff(da, db)
+	da.compact(db, indentHeuristic)
+	db.compact(da, indentHeuristic)
+
+	ops := make([]diffLine, 0, len(a)+len(b))
+
+	for x, y := 0, 0; x < len(a) || y < len(b); {
+		for ; x < len(a) && da.changed(x); x++ {
+			ops = append(ops, diffLine{'-', a[x]})
+		}
+
+		for ; y < len(b) && db.changed(y); y++ {
+			ops = append(ops, diffLine{'+', b[y]})
+		}
+
+		if x < len(a) && y < len(b) {
+			ops = append(ops, diffLine{' ', a[x]})
+			x++
+			y++
+		}
+	}
+
+	return ops
+}
+
+const (
+	// The limits xdiff gives up finding the shortest diff at.
+	xdiffMaxEqLimit   = 1024
+	xdiffSimScanWin   = 100
+	xdiffKeepDisRun   = 4
+	xdiffMaxCostMin   = 256
+	xdiffHeurMinCost  = 256
+	xdiffSnakeCount   = 20
+	xdiffHeurFactor   = 4
+	xdiffLineMaxValue = int(^uint(0) >> 2)
+)
+
+// xdiff marks the lines of a and b that differ. Lines outside of their
+// common start and end that only one side has, or that have many copies
+// amid such lines, are marked up front; the others are diffed with Myers'
+// algorithm, split around the middle snake of each part.
+func xdiff(a, b *diffSide) {
+	classes := make(map[string]int)
+	count := make(map[int][2]int)
+
+	ha := func(s *diffSide, side int) []int {
+		ids := make([]int, len(s.lines))
+
+		for i, l := range s.lines {
+			id, ok := classes[l]
+			if !ok {
+				id = len(classes)
+				classes[l] = id
+			}
+
+			ids[i] = id
+
+			c := count[id]
+			c[side]++
+			count[id] = c
+		}
+
+		return ids
+	}
+
+	ha1, ha2 := ha(a, 0), ha(b, 1)
+
+	start := 0
+	for start < len(ha1) && start < len(ha2) && ha1[start] == ha2[start] {
+		start++
+	}
+
+	end := 0
+	for end < len(ha1)-start && end < len(ha2)-start && ha1[len(ha1)-1-end] == ha2[len(ha2)-1-end] {
+		end++
+	}
+
+	x := &xdiffer{}
+	x.ha1, x.index1 = a.cleanup(ha1, start, len(ha1)-end, func(id int) int { return count[id][1] })
+	x.ha2, x.index2 = b.cleanup(ha2, start, len(ha2)-end, func(id int) int { return count[id][0] })
+	x.a, x.b = a, b
+
+	ndiags := len(x.ha1) + len(x.ha2) + 3
+	x.off = len(x.ha2) + 1
+	x.kvdf = make([]int, ndiags+1)
+	x.kvdb = make([]int, ndiags+1)
+	x.maxCost = max(bogoSqrt(ndiags), xdiffMaxCostMin)
+
+	x.compare(0, len(x.ha1), 0, len(x.ha2), false)
+}
+
+func bogoSqrt(n int) int {
+	i := 1
+	for ; n > 0; n >>= 2 {
+		i <<= 1
+	}
+
+	return i
+}
+
+// cleanup marks the lines of s in [start, end) that have no copy on the
+// other side, as told by matches, and the lines with many copies that sit
+// among them. It returns the classes of the other lines and their indexes.
+func (s *diffSide) cleanup(ha []int, start, end int, matches func(int) int) ([]int, []int) {
+	limit := min(bogoSqrt(len(ha)), xdiffMaxEqLimit)
+
+	// dis is 0 for lines without a copy, 2 for lines with many and 1 for
+	// the others.
+	dis := make([]byte, len(ha))
+
+	for i := start; i < end; i++ {
+		switch nm := matches(ha[i]); {
+		case nm == 0:
+		case nm >= limit:
+			dis[i] = 2
+		default:
+			dis[i] = 1
+		}
+	}
+
+	var kept, index []int
+
+	for i := start; i < end; i++ {
+		if dis[i] == 1 || dis[i] == 2 && !cleanMultipleMatch(dis, i, start, end-1) {
+			kept = append(kept, ha[i])
+			index = append(index, i)
+		} else {
+			s.set(i, true)
+		}
+	}
+
+	return kept, index
+}
+
+// cleanMultipleMatch reports whether the line i, which has many copies,
+// sits among enough lines without one to be dropped from the diff.
+func cleanMultipleMatch(dis []byte, i, s, e int) bool {
+	s = max(s, i-xdiffSimScanWin)
+	e = min(e, i+xdiffSimScanWin)
+
+	rdis0, rpdis0 := 0, 1
+
+	for r := 1; i-r >= s; r++ {
+		if dis[i-r] == 0 {
+			rdis0++
+		} else if dis[i-r] == 2 {
+			rpdis0++
+		} else {
+			break
+		}
+	}
+
+	if rdis0 == 0 {
+		return false
+	}
+
+	rdis1, rpdis1 := 0, 1
+
+	for r := 1; i+r <= e; r++ {
+		if dis[i+r] == 0 {
+			rdis1++
+		} else if dis[i+r] == 2 {
+			rpdis1++
+		} else {
+			break
+		}
+	}
+
+	if rdis1 == 0 {
+		return false
+	}
+
+	rdis1 += rdis0
+	rpdis1 += rpdis0
+
+	return rpdis1*xdiffKeepDisRun < rpdis1+rdis1
+}
+
+// xdiffer holds the state of the divide and conquer Myers diff of xdiff.
+type xdiffer struct {
+	a, b           *diffSide
+	ha1, ha2       []int
+	index1, index2 []int
+
+	// kvdf and kvdb hold the furthest reaching paths forward and
+	// backward of the diagonals, offset by off.
+	kvdf, kvdb []int
+	off        int
+	maxCost    int
+}
+
+func (x *xdiffer) compare(off1, lim1, off2, lim2 int, needMin bool) {
+	for off1 < lim1 && off2 < lim2 && x.ha1[off1] == x.ha2[off2] {
+		off1++
+		off2++
+	}
+
+	for off1 < lim1 && off2 < lim2 && x.ha1[lim1-1] == x.ha2[lim2-1] {
+		lim1--
+		lim2--
+	}
+
+	switch {
+	case off1 == lim1:
+		for ; off2 < lim2; off2++ {
+			x.b.set(x.index2[off2], true)
+		}
+	case off2 == lim2:
+		for ; off1 < lim1; off1++ {
+			x.a.set(x.index1[off1], true)
+		}
+	default:
+		i1, i2, minLo, minHi := x.split(off1, lim1, off2, lim2, needMin)
+		x.compare(off1, i1, off2, i2, minLo)
+		x.compare(i1, lim1, i2, lim2, minHi)
+	}
+}
+
+// split finds where the shortest diff of the box crosses its middle, or,
+// when that costs too much, a good enough place to split it at.
+func (x *xdiffer) split(off1, lim1, off2, lim2 int, needMin bool) (int, int, bool, bool) {
+	ha1, ha2 := x.ha1, x.ha2
+	kf := func(d int) *int { return &x.kvdf[d+x.off] }
+	kb := func(d int) *int { return &x.kvdb[d+x.off] }
+
+	dmin, dmax := off1-lim2, lim1-off2
+	fmid, bmid := off1-off2, lim1-lim2
+	odd := (fmid-bmid)&1 != 0
+	fmin, fmax := fmid, fmid
+	bmin, bmax := bmid, bmid
+
+	*kf(fmid) = off1
+	*kb(bmid) = lim1
+
+	for ec := 1; ; ec++ {
+		gotSnake := false
+
+		if fmin > dmin {
+			fmin--
+			*kf(fmin - 1) = -1
+		} else {
+			fmin++
+		}
+
+		if fmax < dmax {
+			fmax++
+			*kf(fmax + 1) = -1
+		} else {
+			fmax--
+		}
+
+		for d := fmax; d >= fmin; d -= 2 {
+			var i1 int
+			if *kf(d - 1) >= *kf(d + 1) {
+				i1 = *kf(d - 1) + 1
+			} else {
+				i1 = *kf(d + 1)
+			}
+
+			prev := i1
+			i2 := i1 - d
+
+			for i1 < lim1 && i2 < lim2 && ha1[i1] == ha2[i2] {
+				i1++
+				i2++
+			}
+
+			if i1-prev > xdiffSnakeCount {
+				gotSnake = true
+			}
+
+			*kf(d) = i1
+
+			if odd && bmin <= d && d <= bmax && *kb(d) <= i1 {
+				return i1, i2, true, true
+			}
+		}
+
+		if bmin > dmin {
+			bmin--
+			*kb(bmin - 1) = xdiffLineMaxValue
+		} else {
+			bmin++
+		}
+
+		if bmax < dmax {
+			bmax++
+			*kb(bmax + 1) = xdiffLineMaxValue
+		} else {
+			bmax--
+		}
+
+		for d := bmax; d >= bmin; d -= 2 {
+			var i1 int
+			if *kb(d - 1) < *kb(d + 1) {
+				i1 = *kb(d - 1)
+			} else {
+				i1 = *kb(d + 1) - 1
+			}
+
+			prev := i1
+			i2 := i1 - d
+
+			for i1 > off1 && i2 > off2 && ha1[i1-1] == ha2[i2-1] {
+				i1--
+				i2--
+			}
+
+			if prev-i1 > xdiffSnakeCount {
+				gotSnake = true
+			}
+
+			*kb(d) = i1
+
+			if !odd && fmin <= d && d <= fmax && i1 <= *kf(d) {
+				return i1, i2, true, true
+			}
+		}
+
+		if needMin {
+			continue
+		}
+
+		if gotSnake && ec > xdiffHeurMinCost {
+			best, s1, s2 := 0, 0, 0
+
+			for d := fmax; d >= fmin; d -= 2 {
+				dd := abs(d - fmid)
+				i1 := *kf(d)
+				i2 := i1 - d
+				v := (i1 - off1) + (i2 - off2) - dd
+
+				if v > xdiffHeurFactor*ec && v > best && off1+xdiffSnakeCount <= i1 && i1 < lim1 && off2+xdiffSnakeCount <= i2 && i2 < lim2 {
+					for k := 1; ha1[i1-k] == ha2[i2-k]; k++ {
+						if k == xdiffSnakeCount {
+							best, s1, s2 = v, i1, i2
+
+							break
+						}
+					}
+				}
+			}
+
+			if best > 0 {
+				return s1, s2, true, false
+			}
+
+			for d := bmax; d >= bmin; d -= 2 {
+				dd := abs(d - bmid)
+				i1 := *kb(d)
+				i2 := i1 - d
+				v := (lim1 - i1) + (lim2 - i2) - dd
+
+				if v > xdiffHeurFactor*ec && v > best && off1 < i1 && i1 <= lim1-xdiffSnakeCount && off2 < i2 && i2 <= lim2-xdiffSnakeCount {
+					for k := 0; ha1[i1+k] == ha2[i2+k]; k++ {
+						if k == xdiffSnakeCount-1 {
+							best, s1, s2 = v, i1, i2
+
+							break
+						}
+					}
+				}
+			}
+
+			if best > 0 {
+				return s1, s2, false, true
+			}
+		}
+
+		if ec >= x.maxCost {
+			fbest, fbest1 := -1, -1
+
+			for d := fmax; d >= fmin; d -= 2 {
+				i1 := min(*kf(d), lim1)
+				i2 := i1 - d
+
+				if lim2 < i2 {
+					i1, i2 = lim2+d, lim2
+				}
+
+				if fbest < i1+i2 {
+					fbest, fbest1 = i1+i2, i1
+				}
+			}
+
+			bbest, bbest1 := xdiffLineMaxValue, xdiffLineMaxValue
+
+			for d := bmax; d >= bmin; d -= 2 {
+				i1 := max(off1, *kb(d))
+				i2 := i1 - d
+
+				if i2 < off2 {
+					i1, i2 = off2+d, off2
+				}
+
+				if i1+i2 < bbest {
+					bbest, bbest1 = i1+i2, i1
+				}
+			}
+
+			if (lim1+lim2)-bbest < fbest-(off1+off2) {
+				return fbest1, fbest - fbest1, true, false
+			}
+
+			return bbest1, bbest - bbest1, false, true
+		}
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+
+	return n
+}
+
+const (
+	// The weights git's indent heuristic scores the places a change can
+	// be moved to with.
+	maxIndent                       = 200
+	maxBlanks                       = 20
+	startOfFilePenalty              = 1
+	endOfFilePenalty                = 21
+	totalBlankWeight                = -30
+	postBlankWeight                 = 6
+	relativeIndentPenalty           = -4
+	relativeIndentWithBlankPenalty  = 10
+	relativeOutdentPenalty          = 24
+	relativeOutdentWithBlankPenalty = 17
+	relativeDedentPenalty           = 23
+	relativeDedentWithBlankPenalty  = 17
+	indentWeight                    = 60
+	indentHeuristicMaxSliding       = 100
+)
+
+// diffSide is one side of a line diff, with the lines it changes marked.
+// Groups of changed lines are handled as git's xdiff does, a group being
+// empty where the other side changes lines and this one does not.
+type diffSide struct {
+	lines []string
+
+	// marks has a sentinel at both ends, so that marks[i+1] is line i.
+	marks []bool
+}
+
+func newDiffSide(lines []string) *diffSide {
+	return &diffSide{lines: lines, marks: make([]bool, len(lines)+2)}
+}
+
+func (s *diffSide) changed(i int) bool { return s.marks[i+1] }
+
+func (s *diffSide) set(i int, v bool) { s.marks[i+1] = v }
+
+// diffGroup is the lines [start, end) of a group of changed lines.
+type diffGroup struct {
+	start, end int
+}
+
+func (s *diffSide) firstGroup() diffGroup {
+	g := diffGroup{}
+	for s.changed(g.end) {
+		g.end++
+	}
+
+	return g
+}
+
+func (s *diffSide) nextGroup(g *diffGroup) bool {
+	if g.end == len(s.lines) {
+		return false
+	}
+
+	g.start = g.end + 1
+	for g.end = g.start; s.changed(g.end); g.end++ {
+	}
+
+	return true
+}
+
+func (s *diffSide) previousGroup(g *diffGroup) bool {
+	if g.start == 0 {
+		return false
+	}
+
+	g.end = g.start - 1
+	for g.start = g.end; s.changed(g.start - 1); g.start-- {
+	}
+
+	return true
+}
+
+func (s *diffSide) slideDown(g *diffGroup) bool {
+	if g.end >= len(s.lines) || s.lines[g.start] != s.lines[g.end] {
+		return false
+	}
+
+	s.set(g.start, false)
+	s.set(g.end, true)
+	g.start++
+	g.end++
+
+	for s.changed(g.end) {
+		g.end++
+	}
+
+	return true
+}
+
+func (s *diffSide) slideUp(g *diffGroup) bool {
+	if g.start == 0 || s.lines[g.start-1] != s.lines[g.end-1] {
+		return false
+	}
+
+	g.start--
+	g.end--
+	s.set(g.start, true)
+	s.set(g.end, false)
+
+	for s.changed(g.start - 1) {
+		g.start--
+	}
+
+	return true
+}
+
+// compact moves each group of changed lines of s that could be placed
+// elsewhere, merging the groups it meets, to line up with the changes of
+// other when it can, or else to the best place the indent heuristic finds
+// if it is enabled.
+func (s *diffSide) compact(other *diffSide, indentHeuristic bool) {
+	g, og := s.firstGroup(), other.firstGroup()
+
+	for {
+		if g.end != g.start {
+			var earliestEnd, groupSize, endMatchingOther int
+
+			for {
+				groupSize = g.end - g.start
+				endMatchingOther = -1
+
+				for s.slideUp(&g) {
+					other.previousGroup(&og)
+				}
+
+				earliestEnd = g.end
+				if og.end > og.start {
+					endMatchingOther = g.end
+				}
+
+				for s.slideDown(&g) {
+					other.nextGroup(&og)
+
+					if og.end > og.start {
+						endMatchingOther = g.end
+					}
+				}
+
+				if groupSize == g.end-g.start {
+					break
+				}
+			}
+
+			switch {
+			case g.end == earliestEnd:
+			case endMatchingOther != -1:
+				for og.end == og.start {
+					s.slideUp(&g)
+					other.previousGroup(&og)
+				}
+			case indentHeuristic:
+				best := s.bestShift(g, earliestEnd, groupSize)
+				for g.end > best {
+					s.slideUp(&g)
+					other.previousGroup(&og)
+				}
+			}
+		}
+
+		if !s.nextGroup(&g) {
+			break
+		}
+
+		other.nextGroup(&og)
+	}
+}
+
+// bestShift returns where the indent heuristic would end the group g,
+// which can be slid up to end at earliestEnd.
+func (s *diffSide) bestShift(g diffGroup, earliestEnd, groupSize int) int {
+	shift := max(earliestEnd, g.end-groupSize-1, g.end-indentHeuristicMaxSliding)
+	best := -1
+
+	var bestIndent, bestPenalty int
+
+	for ; shift <= g.end; shift++ {
+		indent, penalty := s.splitScore(shift)
+		i2, p2 := s.splitScore(shift - groupSize)
+		indent += i2
+		penalty += p2
+
+		cmp := 0
+		if indent > bestIndent {
+			cmp = 1
+		} else if indent < bestIndent {
+			cmp = -1
+		}
+
+		if best == -1 || indentWeight*cmp+penalty-bestPenalty <= 0 {
+			best, bestIndent, bestPenalty = shift, indent, penalty
+		}
+	}
+
+	return best
+}
+
+// splitScore returns the effective indent and the penalty of splitting the
+// lines of s before line split.
+func (s *diffSide) splitScore(split int) (int, int) {
+	endOfFile, indent := split >= len(s.lines), -1
+	if !endOfFile {
+		indent = lineIndent(s.lines[split])
+	}
+
+	preBlank, preIndent := 0, -1
+
+	for i := split - 1; i >= 0; i-- {
+		preIndent = lineIndent(s.lines[i])
+		if preIndent != -1 {
+			break
+		}
+
+		preBlank++
+		if preBlank == maxBlanks {
+			preIndent = 0
+
+			break
+		}
+	}
+
+	postBlank, postIndent := 0, -1
+
+	for i := split + 1; i < len(s.lines); i++ {
+		postIndent = lineIndent(s.lines[i])
+		if postIndent != -1 {
+			break
+		}
+
+		postBlank++
+		if postBlank == maxBlanks {
+			postIndent = 0
+
+			break
+		}
+	}
+
+	penalty := 0
+
+	if preIndent == -1 && preBlank == 0 {
+		penalty += startOfFilePenalty
+	}
+
+	if endOfFile {
+		penalty += endOfFilePenalty
+	}
+
+	blankAfter := 0
+	if indent == -1 {
+		blankAfter = 1 + postBlank
+	}
+
+	totalBlank := preBlank + blankAfter
+	penalty += totalBlankWeight*totalBlank + postBlankWeight*blankAfter
+
+	if indent == -1 {
+		indent = postIndent
+	}
+
+	anyBlanks := totalBlank != 0
+
+	switch {
+	case indent == -1 || preIndent == -1 || indent == preIndent:
+	case indent > preIndent:
+		penalty += pick(anyBlanks, relativeIndentWithBlankPenalty, relativeIndentPenalty)
+	case postIndent != -1 && postIndent > indent:
+		penalty += pick(anyBlanks, relativeOutdentWithBlankPenalty, relativeOutdentPenalty)
+	default:
+		penalty += pick(anyBlanks, relativeDedentWithBlankPenalty, relativeDedentPenalty)
+	}
+
+	return indent, penalty
+}
+
+func pick(cond bool, a, b int) int {
+	if cond {
+		return a
+	}
+
+	return b
+}
+
+// lineIndent returns the width of the leading whitespace of l, with tabs
+// stopping every eight columns, or -1 when l is blank.
+func lineIndent(l string) int {
+	n := 0
+
+	for i := 0; i < len(l); i++ {
+		switch l[i] {
+		case ' ':
+			n++
+		case '\t':
+			n += 8 - n%8
+		case '\n', '\r', '\v', '\f':
+		default:
+			return n
+		}
+
+		if n >= maxIndent {
+			return maxIndent
+		}
+	}
+
+	return -1
+}
+
+// diffHunk is a group of changes with the unchanged lines around them.
+type diffHunk struct {
+	oldStart, oldLines int
+	newStart, newLines int
+	funcName           string
+	lines              []diffLine
+}
+
+// makeHunks groups ops into hunks with patchContext lines of context,
+// merging the changes whose contexts would touch.
+func makeHunks(ops []diffLine, oldLines []string) []diffHunk {
+	var hunks []diffHunk
+
+	oldNo, newNo := 0, 0
+
+	for i := 0; i < len(ops); {
+		if ops[i].op == ' ' {
+			oldNo++
+			newNo++
+			i++
+
+			continue
+		}
+
+		start := max(i-patchContext, 0)
+		for k := start; k < i; k++ {
+			oldNo--
+			newNo--
+		}
+
+		end := i
+
+		for {
+			for end < len(ops) && ops[end].op != ' ' {
+				end++
+			}
+
+			next := end
+			for next < len(ops) && ops[next].op == ' ' {
+				next++
+			}
+
+			if next == len(ops) || next-end > 2*patchContext {
+				break
+			}
+
+			end = next
+		}
+
+		end = min(end+patchContext, len(ops))
+
+		h := diffHunk{
+			oldStart: oldNo + 1,
+			newStart: newNo + 1,
+			funcName: funcName(oldLines, oldNo-1),
+			lines:    ops[start:end],
+		}
+
+		for _, l := range h.lines {
+			if l.op != '+' {
+				h.oldLines++
+			}
+
+			if l.op != '-' {
+				h.newLines++
+			}
+		}
+
+		oldNo += h.oldLines
+		newNo += h.newLines
+		hunks = append(hunks, h)
+		i = end
+	}
+
+	return hunks
+}
+
+// funcName returns the closest line at or before the index i that starts
+// with a letter, an underscore or a dollar sign, which git shows in the
+// header of a hunk when a file has no diff driver.
+func funcName(lines []string, i int) string {
+	for ; i >= 0; i-- {
+		l := lines[i]
+		if l == "" {
+			continue
+		}
+
+		c := l[0]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_' || c == '$') {
+			continue
+		}
+
+		return strings.TrimRight(l[:min(len(l), funcNameWidth)], " \t\n\r\v\f")
+	}
+
+	return ""
+}
+
+// writeHunk writes h in the unified format.
+func writeHunk(out io.Writer, h diffHunk) {
+	fmt.Fprintf(out, "@@ -%s +%s @@", hunkRange(h.oldStart, h.oldLines), hunkRange(h.newStart, h.newLines))
+
+	if h.funcName != "" {
+		fmt.Fprint(out, " "+h.funcName)
+	}
+
+	fmt.Fprintln(out)
+
+	for _, l := range h.lines {
+		fmt.Fprintf(out, "%c%s", l.op, l.text)
+
+		if !strings.HasSuffix(l.text, "\n") {
+			fmt.Fprint(out, "\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+func hunkRange(start, lines int) string {
+	if lines == 0 {
+		start--
+	}
+
+	if lines == 1 {
+		return fmt.Sprint(start)
+	}
+
+	return fmt.Sprintf("%d,%d", start, lines)
+}
+
+// fileDiff is the change of a file between two trees, with the contents
+// the patch of it is made from.
+type fileDiff struct {
+	path     string
+	from, to object.TreeEntry
+
+	// oldPath is the path a renamed file had, with the similarity of its
+	// contents in percent.
+	oldPath    string
+	similarity int
+
+	old, new []byte
+	binary   bool
+
+	// added and deleted count lines, or bytes for binary files.
+	added, deleted int
+	hunks          []diffHunk
+}
+
+// fileDiffs reads the contents of changes and diffs them. Like git, a file
+// that changes type shows as being deleted and created again, and deleted
+// and created files are paired as renames.
+func fileDiffs(r *git.Repository, changes []treeChange) ([]*fileDiff, error) {
+	var diffs []*fileDiff
+
+	for _, ch := range changes {
+		if !ch.from.Hash.IsZero() && !ch.to.Hash.IsZero() && fileType(ch.from.Mode) != fileType(ch.to.Mode) {
+			d, err := newFileDiff(r, ch.path, ch.from, object.TreeEntry{})
+			if err != nil {
+				return nil, err
+			}
+
+			diffs = append(diffs, d)
+			ch.from = object.TreeEntry{}
+		}
+
+		d, err := newFileDiff(r, ch.path, ch.from, ch.to)
+		if err != nil {
+			return nil, err
+		}
+
+		diffs = append(diffs, d)
+	}
+
+	return detectRenames(diffs), nil
+}
+
+func fileType(m filemode.FileMode) filemode.FileMode {
+	if m == filemode.Executable {
+		return filemode.Regular
+	}
+
+	return m
+}
+
+func newFileDiff(r *git.Repository, p string, from, to object.TreeEntry) (*fileDiff, error) {
+	d := &fileDiff{path: p, from: from, to: to}
+
+	var err error
+
+	d.old, err = entryContents(r, from)
+	if err != nil {
+		return nil, err
+	}
+
+	d.new, err = entryContents(r, to)
+	if err != nil {
+		return nil, err
+	}
+
+	d.diffContents()
+
+	return d, nil
+}
+
+// diffContents counts the changes from the old to the new contents of d
+// and makes its hunks.
+func (d *fileDiff) diffContents() {
+	d.binary = isBinary(d.old) || isBinary(d.new)
+	if d.binary {
+		d.added, d.deleted = len(d.new), len(d.old)
+
+		return
+	}
+
+	oldLines := splitLines(string(d.old))
+	ops := diffLines(oldLines, splitLines(string(d.new)))
+
+	for _, l := range ops {
+		switch l.op {
+		case '+':
+			d.added++
+		case '-':
+			d.deleted++
+		}
+	}
+
+	d.hunks = makeHunks(ops, oldLines)
+}
+
+// entryContents returns what git diffs for the tree entry e: the contents
+// of its blob, or a line naming the commit of a submodule.
+func entryContents(r *git.Repository, e object.TreeEntry) ([]byte, error) {
+	switch {
+	case e.Hash.IsZero():
+		return nil, nil
+	case e.Mode == filemode.Submodule:
+		return []byte("Subproject commit " + e.Hash.String() + "\n"), nil
+	default:
+		return readBlob(r, e.Hash)
+	}
+}
+
+// readBlob returns the contents of the blob h.
+func readBlob(r *git.Repository, h plumbing.Hash) ([]byte, error) {
+	blob, err := r.BlobObject(h)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob %s: %w", h, err)
+	}
+
+	rd, err := blob.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer rd.Close()
+
+	return io.ReadAll(rd)
+}
+
+// isBinary reports whether git would take data for binary contents.
+func isBinary(data []byte) bool {
+	return bytes.IndexByte(data[:min(len(data), binaryPrefix)], 0) >= 0
+}
+
+// writePatch writes diffs as a git patch, with binary files encoded so
+// that the patch can be applied.
+func writePatch(out io.Writer, r *git.Repository, diffs []*fileDiff) error {
+	for _, d := range diffs {
+		err := writeFilePatch(out, r, d)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeFilePatch(out io.Writer, r *git.Repository, d *fileDiff) error {
+	a, b := quotePath("a/"+d.path), quotePath("b/"+d.path)
+	if d.oldPath != "" {
+		a = quotePath("a/" + d.oldPath)
+	}
+
+	fmt.Fprintf(out, "diff --git %s %s\n", a, b)
+
+	switch {
+	case d.from.Hash.IsZero():
+		fmt.Fprintf(out, "new file mode %o\n", uint32(d.to.Mode))
+	case d.to.Hash.IsZero():
+		fmt.Fprintf(out, "deleted file mode %o\n", uint32(d.from.Mode))
+	case d.from.Mode != d.to.Mode:
+		fmt.Fprintf(out, "old mode %o\nnew mode %o\n", uint32(d.from.Mode), uint32(d.to.Mode))
+	}
+
+	if d.oldPath != "" {
+		fmt.Fprintf(out, "similarity index %d%%\nrename from %s\nrename to %s\n", d.similarity, quotePath(d.oldPath), quotePath(d.path))
+	}
+
+	if d.from.Hash == d.to.Hash {
+		return nil
+	}
+
+	from, to := d.from.Hash.String(), d.to.Hash.String()
+	if !d.binary {
+		from, to = abbreviateHash(r, d.from.Hash, 7), abbreviateHash(r, d.to.Hash, 7)
+	}
+
+	fmt.Fprintf(out, "index %s..%s", from, to)
+
+	if !d.from.Hash.IsZero() && !d.to.Hash.IsZero() && d.from.Mode == d.to.Mode {
+		fmt.Fprintf(out, " %o", uint32(d.to.Mode))
+	}
+
+	fmt.Fprintln(out)
+
+	if d.binary {
+		fmt.Fprintln(out, "GIT binary patch")
+
+		err := writeBinaryLiteral(out, d.new)
+		if err != nil {
+			return err
+		}
+
+		return writeBinaryLiteral(out, d.old)
+	}
+
+	if len(d.hunks) == 0 {
+		return nil
+	}
+
+	if d.from.Hash.IsZero() {
+		a = "/dev/null"
+	}
+
+	if d.to.Hash.IsZero() {
+		b = "/dev/null"
+	}
+
+	fmt.Fprintf(out, "--- %s%s\n+++ %s%s\n", a, pathTab(a), b, pathTab(b))
+
+	for _, h := range d.hunks {
+		writeHunk(out, h)
+	}
+
+	return nil
+}
+
+// pathTab returns the tab git ends the file lines of a patch with when the
+// path has a space, so that trailing spaces survive.
+func pathTab(p string) string {
+	if strings.Contains(p, " ") {
+		return "\t"
+	}
+
+	return ""
+}
+
+// writeBinaryLiteral writes data as a literal hunk of a binary patch: its
+// zlib deflated bytes in base85, in lines of up to 52 bytes prefixed by
+// their length.
+func writeBinaryLiteral(out io.Writer, data []byte) error {
+	var buf bytes.Buffer
+
+	zw := zlib.NewWriter(&buf)
+
+	_, err := zw.Write(data)
+	if err != nil {
+		return err
+	}
+
+	err = zw.Close()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "literal %d\n", len(data))
+
+	z := buf.Bytes()
+	for len(z) > 0 {
+		n := min(len(z), 52)
+
+		if n <= 26 {
+			fmt.Fprintf(out, "%c", 'A'+n-1)
+		} else {
+			fmt.Fprintf(out, "%c", 'a'+n-27)
+		}
+
+		fmt.Fprintln(out, encodeBase85(z[:n]))
+		z = z[n:]
+	}
+
+	fmt.Fprintln(out)
+
+	return nil
+}
+
+func encodeBase85(data []byte) string {
+	var sb strings.Builder
+
+	for len(data) > 0 {
+		var acc uint32
+
+		for i := range 4 {
+			acc <<= 8
+			if i < len(data) {
+				acc |= uint32(data[i])
+			}
+		}
+
+		var group [5]byte
+		for i := 4; i >= 0; i-- {
+			group[i] = base85Alphabet[acc%85]
+			acc /= 85
+		}
+
+		sb.Write(group[:])
+		data = data[min(len(data), 4):]
+	}
+
+	return sb.String()
+}
+
+// writeDiffstat writes the --stat summary of diffs the way git does for
+// the given total width, followed by the creations, deletions and mode
+// changes of --summary when summary is set.
+func writeDiffstat(out io.Writer, diffs []*fileDiff, width int, summary bool) {
+	maxLen, maxChange, numberWidth, binWidth := 0, 0, 0, 0
+
+	names := make([]string, len(diffs))
+	for i, d := range diffs {
+		names[i] = quotePath(d.path)
+		if d.oldPath != "" {
+			names[i] = renameName(d.oldPath, d.path)
+		}
+		maxLen = max(maxLen, utf8.RuneCountInString(names[i]))
+
+		if d.binary {
+			binWidth = max(binWidth, 14+len(fmt.Sprint(d.added))+len(fmt.Sprint(d.deleted)))
+			numberWidth = 3
+
+			continue
+		}
+
+		maxChange = max(maxChange, d.added+d.deleted)
+	}
+
+	numberWidth = max(numberWidth, len(fmt.Sprint(maxChange)))
+	width = max(width, 16+6+numberWidth)
+
+	graphWidth := maxChange
+	if maxChange+4 <= binWidth {
+		graphWidth = binWidth - 4
+	}
+
+	nameWidth := maxLen
+
+	if nameWidth+numberWidth+6+graphWidth > width {
+		if graphWidth > width*3/8-numberWidth-6 {
+			graphWidth = max(width*3/8-numberWidth-6, 6)
+		}
+
+		if nameWidth > width-numberWidth-6-graphWidth {
+			nameWidth = width - numberWidth - 6 - graphWidth
+		} else {
+			graphWidth = width - numberWidth - 6 - nameWidth
+		}
+	}
+
+	added, deleted := 0, 0
+
+	for i, d := range diffs {
+		prefix, name, w := "", names[i], nameWidth
+		if utf8.RuneCountInString(name) > nameWidth {
+			prefix, w = "...", max(nameWidth-3, 0)
+
+			runes := []rune(name)
+			name = string(runes[len(runes)-w:])
+
+			if j := strings.IndexByte(name, '/'); j >= 0 {
+				name = name[j:]
+			}
+		}
+
+		fmt.Fprintf(out, " %s%s%s |", prefix, name, strings.Repeat(" ", max(w-utf8.RuneCountInString(name), 0)))
+
+		if d.binary {
+			fmt.Fprintf(out, " %*s", numberWidth, "Bin")
+
+			if d.added != 0 || d.deleted != 0 {
+				fmt.Fprintf(out, " %d -> %d bytes", d.deleted, d.added)
+			}
+
+			fmt.Fprintln(out)
+
+			continue
+		}
+
+		added += d.added
+		deleted += d.deleted
+
+		fmt.Fprintf(out, " %*d", numberWidth, d.added+d.deleted)
+
+		if d.added+d.deleted > 0 {
+			fmt.Fprint(out, " ")
+		}
+
+		add, del := d.added, d.deleted
+
+		if graphWidth <= maxChange {
+			total := scaleLinear(add+del, graphWidth, maxChange)
+			if total < 2 && add > 0 && del > 0 {
+				total = 2
+			}
+
+			if add < del {
+				add = scaleLinear(add, graphWidth, maxChange)
+				del = total - add
+			} else {
+				del = scaleLinear(del, graphWidth, maxChange)
+				add = total - del
+			}
+		}
+
+		fmt.Fprintln(out, strings.Repeat("+", add)+strings.Repeat("-", del))
+	}
+
+	fmt.Fprintln(out, statSummary(len(diffs), added, deleted))
+
+	if summary {
+		writeModeSummary(out, diffs)
+	}
+}
+
+// writeModeSummary writes the creations, deletions and mode changes of
+// diffs, as --summary shows them.
+func writeModeSummary(out io.Writer, diffs []*fileDiff) {
+	for _, d := range diffs {
+		switch {
+		case d.from.Hash.IsZero():
+			fmt.Fprintf(out, " create mode %o %s\n", uint32(d.to.Mode), quotePath(d.path))
+		case d.to.Hash.IsZero():
+			fmt.Fprintf(out, " delete mode %o %s\n", uint32(d.from.Mode), quotePath(d.path))
+		case d.oldPath != "":
+			fmt.Fprintf(out, " rename %s (%d%%)\n", renameName(d.oldPath, d.path), d.similarity)
+
+			if d.from.Mode != d.to.Mode {
+				fmt.Fprintf(out, " mode change %o => %o\n", uint32(d.from.Mode), uint32(d.to.Mode))
+			}
+		case d.from.Mode != d.to.Mode:
+			fmt.Fprintf(out, " mode change %o => %o %s\n", uint32(d.from.Mode), uint32(d.to.Mode), quotePath(d.path))
+		}
+	}
+}
+
+// renameName returns how git names the rename of a file from a to b, with
+// the directories they share around braces: a/{b => c}/d.
+func renameName(a, b string) string {
+	if quotePath(a) != a || quotePath(b) != b {
+		return quotePath(a) + " => " + quotePath(b)
+	}
+
+	// The common prefix ends with a slash, the common suffix starts with
+	// one.
+	pfx := 0
+
+	for i := 0; i < len(a) && i < len(b) && a[i] == b[i]; i++ {
+		if a[i] == '/' {
+			pfx = i + 1
+		}
+	}
+
+	sfx, adjust := 0, 0
+	if pfx > 0 {
+		adjust = 1
+	}
+
+	for i, j := len(a)-1, len(b)-1; i >= pfx-adjust && j >= pfx-adjust && a[i] == b[j]; i, j = i-1, j-1 {
+		if a[i] == '/' {
+			sfx = len(a) - i
+		}
+	}
+
+	aMid, bMid := max(len(a)-pfx-sfx, 0), max(len(b)-pfx-sfx, 0)
+
+	if pfx+sfx == 0 {
+		return a + " => " + b
+	}
+
+	return a[:pfx] + "{" + a[pfx:pfx+aMid] + " => " + b[pfx:pfx+bMid] + "}" + a[len(a)-sfx:]
+}
+
+func scaleLinear(n, width, maxChange int) int {
+	if n == 0 {
+		return 0
+	}
+
+	return 1 + n*(width-1)/maxChange
+}
+
+// statSummary returns the last line of a diffstat.
+func statSummary(files, added, deleted int) string {
+	if files == 0 {
+		return " 0 files changed"
+	}
+
+	s := fmt.Sprintf(" %d %s changed", files, plural(files, "file", "files"))
+
+	if added > 0 || deleted == 0 {
+		s += fmt.Sprintf(", %d %s(+)", added, plural(added, "insertion", "insertions"))
+	}
+
+	if deleted > 0 || added == 0 {
+		s += fmt.Sprintf(", %d %s(-)", deleted, plural(deleted, "deletion", "deletions"))
+	}
+
+	return s
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+
+	return many
+}
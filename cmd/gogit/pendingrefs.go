@@ -0,0 +1,230 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/storage"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+)
+
+// pendingRefs holds back the reference updates go-git makes through a
+// repository, so that the reference-transaction hook sees them in the
+// "prepared" state, and can refuse them, before they are written. The
+// repository reads its references with the pending updates applied.
+type pendingRefs struct {
+	*filesystem.Storage
+
+	r *git.Repository
+
+	// refs are the pending references, nil for the removed ones, and orig
+	// their values when they were first updated, in the order of order.
+	refs  map[plumbing.ReferenceName]*plumbing.Reference
+	orig  map[plumbing.ReferenceName]*plumbing.Reference
+	order []plumbing.ReferenceName
+}
+
+func newPendingRefs(s *filesystem.Storage) *pendingRefs {
+	return &pendingRefs{
+		Storage: s,
+		refs:    make(map[plumbing.ReferenceName]*plumbing.Reference),
+		orig:    make(map[plumbing.ReferenceName]*plumbing.Reference),
+	}
+}
+
+// holdRefUpdates makes the reference updates made through r pending until
+// they are committed or discarded.
+func holdRefUpdates(r *git.Repository) (*pendingRefs, error) {
+	s, ok := r.Storer.(*filesystem.Storage)
+	if !ok {
+		return nil, errors.New("cannot hold the reference updates of this repository")
+	}
+
+	p := newPendingRefs(s)
+	p.r = r
+	r.Storer = p
+
+	return p, nil
+}
+
+// SetReference implements storer.ReferenceStorer.
+func (p *pendingRefs) SetReference(ref *plumbing.Reference) error {
+	return p.set(ref.Name(), ref)
+}
+
+// CheckAndSetReference implements storer.ReferenceStorer.
+func (p *pendingRefs) CheckAndSetReference(ref, old *plumbing.Reference) error {
+	if old != nil {
+		current, err := p.Reference(old.Name())
+		if err != nil {
+			return err
+		}
+
+		if current.Hash() != old.Hash() {
+			return storage.ErrReferenceHasChanged
+		}
+	}
+
+	return p.set(ref.Name(), ref)
+}
+
+// Reference implements storer.ReferenceStorer.
+func (p *pendingRefs) Reference(name plumbing.ReferenceName) (*plumbing.Reference, error) {
+	ref, ok := p.refs[name]
+	if !ok {
+		return p.Storage.Reference(name)
+	}
+
+	if ref == nil {
+		return nil, plumbing.ErrReferenceNotFound
+	}
+
+	return ref, nil
+}
+
+// IterReferences implements storer.ReferenceStorer.
+func (p *pendingRefs) IterReferences() (storer.ReferenceIter, error) {
+	iter, err := p.Storage.IterReferences()
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []*plumbing.Reference
+
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if _, ok := p.refs[ref.Name()]; !ok {
+			refs = append(refs, ref)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range p.order {
+		if ref := p.refs[name]; ref != nil {
+			refs = append(refs, ref)
+		}
+	}
+
+	return storer.NewReferenceSliceIter(refs), nil
+}
+
+// RemoveReference implements storer.ReferenceStorer.
+func (p *pendingRefs) RemoveReference(name plumbing.ReferenceName) error {
+	return p.set(name, nil)
+}
+
+func (p *pendingRefs) set(name plumbing.ReferenceName, ref *plumbing.Reference) error {
+	if _, ok := p.refs[name]; !ok {
+		old, err := p.Storage.Reference(name)
+		if err != nil && !errors.Is(err, plumbing.ErrReferenceNotFound) {
+			return err
+		}
+
+		p.orig[name] = old
+		p.order = append(p.order, name)
+	}
+
+	p.refs[name] = ref
+
+	return nil
+}
+
+// commit runs the reference-transaction hook in the "prepared" state on
+// the pending updates, compared with the references in before, and writes
+// them unless the hook refuses them. A reference changed since it was
+// first updated is not overwritten. Either way the repository no longer
+// holds back its updates.
+func (p *pendingRefs) commit(hs *hooks, before refSnapshot) error {
+	after, err := snapshotRefs(p.r)
+	if err != nil {
+		p.discard()
+
+		return err
+	}
+
+	lines := refTransactionUpdates(p.r, before, after)
+
+	p.discard()
+
+	err = hs.prepareRefUpdates(lines)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range p.order {
+		err := p.apply(name)
+		if err != nil {
+			_ = hs.referenceTransaction("aborted", lines)
+
+			return fmt.Errorf("cannot update ref '%s': %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func (p *pendingRefs) apply(name plumbing.ReferenceName) error {
+	ref, old := p.refs[name], p.orig[name]
+	if ref != nil {
+		return p.Storage.CheckAndSetReference(ref, old)
+	}
+
+	if old == nil {
+		return nil
+	}
+
+	current, err := p.Storage.Reference(name)
+	if err != nil {
+		return err
+	}
+
+	if current.Hash() != old.Hash() {
+		return storage.ErrReferenceHasChanged
+	}
+
+	return p.Storage.RemoveReference(name)
+}
+
+// discard drops the pending updates, the repository writing its
+// references directly again.
+func (p *pendingRefs) discard() {
+	if p.r != nil {
+		p.r.Storer = p.Storage
+	}
+}
+
+// inRefTransaction makes the reference updates of update, made through the
+// repository of hs, a transaction: the reference-transaction hook sees them
+// in the "prepared" state and may refuse them before they are written, and
+// they are logged with msg once they are.
+func inRefTransaction(hs *hooks, msg reflogMessageFunc, update func() error) error {
+	before, err := snapshotRefs(hs.r)
+	if err != nil {
+		return err
+	}
+
+	pending, err := holdRefUpdates(hs.r)
+	if err != nil {
+		return err
+	}
+
+	err = update()
+	if err != nil {
+		pending.discard()
+
+		return err
+	}
+
+	err = pending.commit(hs, before)
+	if err != nil {
+		return err
+	}
+
+	return logRefUpdates(hs, before, msg)
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/object"
+)
+
+const (
+	rfc2822DateFormat = "Mon, 2 Jan 2006 15:04:05 -0700"
+	isoDateFormat     = "2006-01-02 15:04:05 -0700"
+	strictISOFormat   = "2006-01-02T15:04:05-07:00"
+)
+
+// formatCommit expands the placeholders of git's pretty formats in format
+// with the details of c. Unknown placeholders are kept as they are.
+func formatCommit(r *git.Repository, c *object.Commit, format string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			b.WriteByte(format[i])
+
+			continue
+		}
+
+		n, ok := expandPlaceholder(&b, r, c, format[i+1:])
+		if !ok {
+			b.WriteByte('%')
+
+			continue
+		}
+
+		i += n
+	}
+
+	return b.String()
+}
+
+// expandPlaceholder writes the expansion of the placeholder at the start of
+// p, returning its length.
+func expandPlaceholder(b *strings.Builder, r *git.Repository, c *object.Commit, p string) (int, bool) {
+	switch p[0] {
+	case '%':
+		b.WriteByte('%')
+	case 'n':
+		b.WriteByte('\n')
+	case 'H':
+		b.WriteString(c.Hash.String())
+	case 'h':
+		b.WriteString(c.Hash.String()[:7])
+	case 'T':
+		b.WriteString(c.TreeHash.String())
+	case 't':
+		b.WriteString(c.TreeHash.String()[:7])
+	case 'P', 'p':
+		parents := make([]string, 0, len(c.ParentHashes))
+		for _, h := range c.ParentHashes {
+			if p[0] == 'p' {
+				parents = append(parents, h.String()[:7])
+			} else {
+				parents = append(parents, h.String())
+			}
+		}
+
+		b.WriteString(strings.Join(parents, " "))
+	case 's':
+		subject, _ := splitMessage(c.Message)
+		b.WriteString(subject)
+	case 'b':
+		_, body := splitMessage(c.Message)
+		b.WriteString(body)
+	case 'B':
+		b.WriteString(c.Message)
+	case 'd', 'D':
+		refs := strings.Join(decorations(r, c.Hash), ", ")
+		if p[0] == 'd' && refs != "" {
+			refs = " (" + refs + ")"
+		}
+
+		b.WriteString(refs)
+	case 'a', 'c':
+		if len(p) < 2 {
+			return 0, false
+		}
+
+		sig := c.Author
+		if p[0] == 'c' {
+			sig = c.Committer
+		}
+
+		if !expandSignature(b, sig, p[1]) {
+			return 0, false
+		}
+
+		return 2, true
+	default:
+		return 0, false
+	}
+
+	return 1, true
+}
+
+func expandSignature(b *strings.Builder, sig object.Signature, field byte) bool {
+	switch field {
+	case 'n', 'N':
+		b.WriteString(sig.Name)
+	case 'e', 'E':
+		b.WriteString(sig.Email)
+	case 'd':
+		b.WriteString(sig.When.Format(logDateFormat))
+	case 'D':
+		b.WriteString(sig.When.Format(rfc2822DateFormat))
+	case 'i':
+		b.WriteString(sig.When.Format(isoDateFormat))
+	case 'I':
+		b.WriteString(sig.When.Format(strictISOFormat))
+	case 't':
+		b.WriteString(strconv.FormatInt(sig.When.Unix(), 10))
+	case 's':
+		b.WriteString(sig.When.Format(time.DateOnly))
+	default:
+		return false
+	}
+
+	return true
+}
+
+// splitMessage returns the subject of a commit message, its first
+// paragraph joined into a single line, and the body that follows it.
+func splitMessage(msg string) (string, string) {
+	msg = strings.TrimLeft(msg, "\n")
+
+	subject, body, _ := strings.Cut(msg, "\n\n")
+
+	return strings.Join(strings.Fields(strings.ReplaceAll(subject, "\n", " ")), " "), strings.TrimLeft(body, "\n")
+}
+
+// decorations returns the names of the references pointing at h, in the
+// order git log shows them.
+func decorations(r *git.Repository, h plumbing.Hash) []string {
+	refs, err := r.References()
+	if err != nil {
+		return nil
+	}
+
+	var names []plumbing.ReferenceName
+
+	_ = refs.ForEach(func(ref *plumbing.Reference) error {
+		name := ref.Name()
+		if ref.Type() != plumbing.HashReference || !(name.IsBranch() || name.IsRemote() || name.IsTag()) {
+			return nil
+		}
+
+		target := ref.Hash()
+		if name.IsTag() {
+			if tag, err := r.TagObject(target); err == nil {
+				target = tag.Target
+			}
+		}
+
+		if target == h {
+			names = append(names, name)
+		}
+
+		return nil
+	})
+
+	sort.Slice(names, func(i, j int) bool { return names[i] > names[j] })
+
+	var result []string
+
+	head, err := r.Reference(plumbing.HEAD, false)
+	if err == nil {
+		switch {
+		case head.Type() == plumbing.SymbolicReference && containsRef(names, head.Target()):
+			result = append(result, "HEAD -> "+head.Target().Short())
+		case head.Type() == plumbing.HashReference && head.Hash() == h:
+			result = append(result, "HEAD")
+		}
+	}
+
+	for _, name := range names {
+		switch {
+		case head != nil && head.Type() == plumbing.SymbolicReference && name == head.Target():
+			continue
+		case name.IsTag():
+			result = append(result, "tag: "+name.Short())
+		default:
+			result = append(result, name.Short())
+		}
+	}
+
+	return result
+}
+
+func containsRef(names []plumbing.ReferenceName, name plumbing.ReferenceName) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
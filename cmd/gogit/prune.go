@@ -0,0 +1,373 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	formatcfg "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/format/index"
+	"github.com/go-git/go-git/v6/plumbing/format/reflog"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pruneDryRun  bool
+	pruneVerbose bool
+	pruneExpire  string
+)
+
+func init() {
+	pruneCmd.Flags().BoolVarP(&pruneDryRun, "dry-run", "n", false, "Only report the objects that would be removed")
+	pruneCmd.Flags().BoolVarP(&pruneVerbose, "verbose", "v", false, "Report the removed objects")
+	pruneCmd.Flags().StringVarP(&pruneExpire, "expire", "", "now", "Only remove the loose objects older than the specified time")
+	rootCmd.AddCommand(pruneCmd)
+}
+
+var pruneCmd = &cobra.Command{
+	Use:   "prune [-n] [-v] [--expire=<time>]",
+	Short: "Remove the unreachable loose objects",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		store, ok := r.Storer.(*filesystem.Storage)
+		if !ok {
+			return errors.New("storer does not implement filesystem.Storage")
+		}
+
+		of, err := packObjectFormat(r, "")
+		if err != nil {
+			return err
+		}
+
+		expire, err := parseExpireTime(pruneExpire, time.Now())
+		if err != nil {
+			return err
+		}
+
+		reachable, err := reachableSet(r)
+		if err != nil {
+			return err
+		}
+
+		var out io.Writer
+		if pruneDryRun || pruneVerbose {
+			out = cmd.OutOrStdout()
+		}
+
+		return pruneObjects(store, of, reachable, expire, pruneDryRun, out)
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// reachableObjects returns the "<object-id> <name>" lines of the objects
+// reachable from the references, the reflogs, and the HEADs and indexes of
+// the main and linked worktrees, commits first, like rev-list --objects
+// --all --reflog --indexed-objects.
+func reachableObjects(r *git.Repository) ([]string, error) {
+	w := &revWalk{r: r}
+
+	err := w.addAll()
+	if err != nil {
+		return nil, err
+	}
+
+	wts, err := linkedWorktrees(r)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, wt := range wts {
+		if head, err := wt.r.Head(); err == nil {
+			w.tips = append(w.tips, revTip{hash: head.Hash(), name: wt.refName(plumbing.HEAD)})
+		}
+	}
+
+	logs, err := allReflogs(r, wts)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, log := range logs {
+		// Like git, the entries naming objects that are gone are
+		// skipped rather than reported.
+		for _, e := range log.entries {
+			for _, h := range []plumbing.Hash{e.OldHash, e.NewHash} {
+				if !h.IsZero() && r.Storer.HasEncodedObject(h) == nil {
+					w.tips = append(w.tips, revTip{hash: h})
+				}
+			}
+		}
+	}
+
+	commits, _, err := w.walk()
+	if err != nil {
+		return nil, err
+	}
+
+	objects, err := w.objects(commits, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]string, 0, len(commits)+len(objects))
+	seen := make(map[plumbing.Hash]bool, cap(lines))
+
+	for _, c := range commits {
+		lines = append(lines, c.Hash.String()+" ")
+		seen[c.Hash] = true
+	}
+
+	for _, line := range objects {
+		lines = append(lines, line)
+		seen[plumbing.NewHash(line[:strings.IndexByte(line, ' ')])] = true
+	}
+
+	indexes, err := allIndexes(r, wts)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, idx := range indexes {
+		for _, e := range idx.Entries {
+			if e.Mode == filemode.Submodule || seen[e.Hash] || r.Storer.HasEncodedObject(e.Hash) != nil {
+				continue
+			}
+
+			lines = append(lines, fmt.Sprintf("%s %s", e.Hash, e.Name))
+			seen[e.Hash] = true
+		}
+	}
+
+	return lines, nil
+}
+
+// namedReflog is the reflog of a reference, with the name git reports it
+// under.
+type namedReflog struct {
+	name    string
+	entries []*reflog.Entry
+}
+
+// allReflogs reads the reflogs of r and those of the HEADs of its linked
+// worktrees wts, which git keeps apart.
+func allReflogs(r *git.Repository, wts []linkedWorktree) ([]namedReflog, error) {
+	rs, err := reflogStorer(r)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := reflogNames(r)
+	if err != nil {
+		return nil, err
+	}
+
+	logs := make([]namedReflog, 0, len(names)+len(wts))
+
+	for _, name := range names {
+		entries, err := rs.Reflog(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read reflog for %s: %w", name, err)
+		}
+
+		logs = append(logs, namedReflog{name: name.String(), entries: entries})
+	}
+
+	for _, wt := range wts {
+		rs, err := reflogStorer(wt.r)
+		if err != nil {
+			return nil, err
+		}
+
+		name := wt.refName(plumbing.HEAD)
+
+		entries, err := rs.Reflog(plumbing.HEAD)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read reflog for %s: %w", name, err)
+		}
+
+		logs = append(logs, namedReflog{name: name, entries: entries})
+	}
+
+	return logs, nil
+}
+
+// allIndexes reads the index of r and those of its linked worktrees wts.
+func allIndexes(r *git.Repository, wts []linkedWorktree) ([]*index.Index, error) {
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index: %w", err)
+	}
+
+	indexes := []*index.Index{idx}
+
+	for _, wt := range wts {
+		idx, err := wt.r.Storer.Index()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read index of worktree %s: %w", wt.name, err)
+		}
+
+		indexes = append(indexes, idx)
+	}
+
+	return indexes, nil
+}
+
+// reachableSet returns the set of the objects listed by reachableObjects.
+func reachableSet(r *git.Repository) (map[plumbing.Hash]bool, error) {
+	lines, err := reachableObjects(r)
+	if err != nil {
+		return nil, err
+	}
+
+	reachable := make(map[plumbing.Hash]bool, len(lines))
+	for _, line := range lines {
+		reachable[plumbing.NewHash(line[:strings.IndexByte(line, ' ')])] = true
+	}
+
+	return reachable, nil
+}
+
+// pruneObjects removes the loose objects that are not in reachable and were
+// last modified before expire, those that are also packed, and the stale
+// temporary files left by interrupted writes. A zero expire keeps them all.
+// The objects removed, or only listed with dryRun, are reported to out when
+// it is not nil.
+func pruneObjects(store *filesystem.Storage, of formatcfg.ObjectFormat, reachable map[plumbing.Hash]bool, expire time.Time, dryRun bool, out io.Writer) error {
+	var unreachable []plumbing.Hash
+
+	err := store.ForEachObjectHash(func(h plumbing.Hash) error {
+		if !reachable[h] {
+			unreachable = append(unreachable, h)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list loose objects: %w", err)
+	}
+
+	plumbing.HashesSort(unreachable)
+
+	for _, h := range unreachable {
+		t, err := store.LooseObjectTime(h)
+		if err != nil || expire.IsZero() || !t.Before(expire) {
+			continue
+		}
+
+		if out != nil {
+			typ := "unknown"
+			if obj, err := store.EncodedObject(plumbing.AnyObject, h); err == nil {
+				typ = obj.Type().String()
+			}
+
+			fmt.Fprintf(out, "%s %s\n", h, typ)
+		}
+
+		if dryRun {
+			continue
+		}
+
+		err = store.DeleteLooseObject(h)
+		if err != nil {
+			return fmt.Errorf("failed to remove object %s: %w", h, err)
+		}
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	err = prunePacked(store, of)
+	if err != nil {
+		return err
+	}
+
+	return pruneTemporaryFiles(store, expire, out)
+}
+
+// prunePacked removes the loose objects that are also in a pack.
+func prunePacked(store *filesystem.Storage, of formatcfg.ObjectFormat) error {
+	indexes, err := readPackIndexes(store, of)
+	if err != nil {
+		return err
+	}
+
+	var packed []plumbing.Hash
+
+	err = store.ForEachObjectHash(func(h plumbing.Hash) error {
+		for _, idx := range indexes {
+			if ok, _ := idx.Contains(h); ok {
+				packed = append(packed, h)
+
+				break
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list loose objects: %w", err)
+	}
+
+	for _, h := range packed {
+		err = store.DeleteLooseObject(h)
+		if err != nil {
+			return fmt.Errorf("failed to remove object %s: %w", h, err)
+		}
+	}
+
+	return nil
+}
+
+// pruneTemporaryFiles removes the temporary objects and packs last modified
+// before expire.
+func pruneTemporaryFiles(store *filesystem.Storage, expire time.Time, out io.Writer) error {
+	if expire.IsZero() {
+		return nil
+	}
+
+	fs := store.Filesystem()
+
+	for _, dir := range []string{"objects", path.Join("objects", "pack")} {
+		entries, err := fs.ReadDir(dir)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		for _, e := range entries {
+			if e.IsDir() || !strings.HasPrefix(e.Name(), "tmp_") {
+				continue
+			}
+
+			fi, err := e.Info()
+			if err != nil || !fi.ModTime().Before(expire) {
+				continue
+			}
+
+			name := path.Join(dir, e.Name())
+			if out != nil {
+				fmt.Fprintf(out, "Removing stale temporary file %s\n", name)
+			}
+
+			err = fs.Remove(name)
+			if err != nil {
+				return fmt.Errorf("failed to remove %s: %w", name, err)
+			}
+		}
+	}
+
+	return nil
+}
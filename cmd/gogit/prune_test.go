@@ -0,0 +1,26 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPrune(t *testing.T) {
+	for _, args := range []string{"-n", "-n -v", "-v", "--expire=1.week.ago -v", "--expire=now -n"} {
+		t.Run(args, func(t *testing.T) {
+			a := append([]string{"prune"}, strings.Fields(args)...)
+
+			want := gcRepo(t)
+			out := gitCmd(t, want, a...)
+
+			got := gcRepo(t)
+			if g, w := strings.Join(sortedLines(mustGogit(t, got, a...)), "\n"), strings.Join(sortedLines(out), "\n"); g != w {
+				t.Errorf("gogit prune %s printed:\n%s\nwant, as git:\n%s", args, g, w)
+			}
+
+			if g, w := storeState(t, got), storeState(t, want); g != w {
+				t.Errorf("gogit prune %s left:\n%s\nwant, as git:\n%s", args, g, w)
+			}
+		})
+	}
+}
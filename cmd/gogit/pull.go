@@ -3,12 +3,18 @@ package main
 import (
 	"errors"
 	"net/url"
+	"os"
+	"strings"
 
 	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
 	"github.com/spf13/cobra"
 )
 
-var pullProgress bool
+var (
+	pullProgress bool
+	pullRecurse  bool
+)
 
 var pullCmd = &cobra.Command{
 	Use:   "pull [<options>] [<repo> [<refspec>...]]",
@@ -46,20 +52,87 @@ var pullCmd = &cobra.Command{
 			opts.Progress = cmd.OutOrStdout()
 		}
 
+		if pullRecurse {
+			opts.RecurseSubmodules = git.DefaultSubmoduleRecursionDepth
+		}
+
+		before, err := snapshotRefs(repo)
+		if err != nil {
+			return err
+		}
+
+		hs := newHooks(repo, cmd.ErrOrStderr())
+
+		pending, err := holdRefUpdates(repo)
+		if err != nil {
+			return err
+		}
+
 		err = w.Pull(&opts)
-		switch {
-		case errors.Is(err, git.NoErrAlreadyUpToDate):
+		if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+			pending.discard()
+
+			return err
+		}
+
+		// An up-to-date branch may still come with updated
+		// remote-tracking branches.
+		upToDate := err != nil
+
+		err = pending.commit(hs, before)
+		if err != nil {
+			return err
+		}
+
+		if upToDate {
 			cmd.Println("Already up-to-date.")
 
-			return nil
-		default:
+			return logRefUpdates(hs, before, updateReflogMessage(repo, "pull"))
+		}
+
+		head, err := repo.Head()
+		if err != nil {
+			return err
+		}
+
+		changed, err := checkedOutPaths(repo, before[plumbing.HEAD], head.Hash())
+		if err != nil {
+			return err
+		}
+
+		err = smudgeWorktree(repo, cmd.ErrOrStderr(), changed)
+		if err != nil {
+			return err
+		}
+
+		fetchMsg := updateReflogMessage(repo, "pull")
+
+		err = logRefUpdates(hs, before, func(name plumbing.ReferenceName, from, to plumbing.Hash) string {
+			if name.IsRemote() {
+				return fetchMsg(name, from, to)
+			}
+
+			return "pull: Fast-forward"
+		})
+		if err != nil {
 			return err
 		}
+
+		// The argument tells whether the merge was a squash. Like git, the
+		// status of the hook is ignored, and the hook is told the action
+		// of the reflog and that no editor is run.
+		_ = hs.run(hook{name: "post-merge", args: []string{"0"}, env: []string{
+			"GIT_REFLOG_ACTION=" + strings.Join(os.Args[1:], " "),
+			"GIT_EDITOR=true",
+		}})
+
+		return nil
 	},
 	DisableFlagsInUseLine: true,
 }
 
 func init() {
 	pullCmd.Flags().BoolVarP(&pullProgress, "progress", "", true, "Show pull progress")
+	pullCmd.Flags().BoolVarP(&pullRecurse, "recurse-submodules", "", false, "Update submodules to the commits recorded by the pulled branch")
 	rootCmd.AddCommand(pullCmd)
 }
@@ -4,10 +4,12 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"strings"
 
 	"github.com/go-git/go-git/v6"
 	"github.com/go-git/go-git/v6/config"
 	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/transport"
 	"github.com/spf13/cobra"
 	"golang.org/x/term"
 )
@@ -17,6 +19,7 @@ var (
 	pushPrune    bool
 	pushQuiet    bool
 	pushForce    bool
+	pushNoVerify bool
 )
 
 func init() {
@@ -24,6 +27,7 @@ func init() {
 	pushCmd.Flags().BoolVarP(&pushProgress, "progress", "", true, "Force show push progress")
 	pushCmd.Flags().BoolVarP(&pushPrune, "prune", "", false, "Prune remote branches")
 	pushCmd.Flags().BoolVarP(&pushForce, "force", "f", false, "Force push")
+	pushCmd.Flags().BoolVarP(&pushNoVerify, "no-verify", "", false, "Bypass the pre-push hook")
 
 	rootCmd.AddCommand(pushCmd)
 	rootCmd.CompletionOptions.HiddenDefaultCmd = true
@@ -69,13 +73,18 @@ var pushCmd = &cobra.Command{
 			}
 		}
 
+		// The pre-push hook is given the remote pushed to, or the URL
+		// when pushing to one, and its URL.
+		hookName, hookURL := remoteName, ""
+		if ep != nil {
+			hookName, hookURL = args[0], args[0]
+		}
+
 		var refspecs []config.RefSpec
 
 		if len(args) > 1 {
 			for _, arg := range args[1:] {
-				ref := plumbing.NewBranchReferenceName(arg)
-				str := fmt.Sprintf("+%s:refs/heads/%s", ref.String(), ref.Short())
-				refspecs = append(refspecs, config.RefSpec(str))
+				refspecs = append(refspecs, pushRefSpec(arg))
 			}
 		}
 
@@ -91,7 +100,9 @@ var pushCmd = &cobra.Command{
 				return errors.New("no remote URLs")
 			}
 
-			ep, err = url.Parse(remote.Config().URLs[urln])
+			hookURL = remote.Config().URLs[urln]
+
+			ep, err = url.Parse(hookURL)
 			if err != nil {
 				return err
 			}
@@ -118,13 +129,166 @@ var pushCmd = &cobra.Command{
 			opts.Progress = cmd.ErrOrStderr()
 		}
 
-		err = remote.Push(&opts)
+		hs := newHooks(r, cmd.ErrOrStderr())
+
+		if !pushNoVerify && hs.find("pre-push") != "" {
+			input, err := prePushInput(r, remote, &opts)
+			if err != nil {
+				return err
+			}
+
+			err = hs.run(hook{
+				name:  "pre-push",
+				args:  []string{hookName, hookURL},
+				stdin: strings.NewReader(input),
+			})
+			if err != nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "error: failed to push some refs to '%s'\n", hookURL)
+
+				cmd.SilenceErrors = true
+				cmd.SilenceUsage = true
+
+				return exitStatus(1)
+			}
+		}
+
+		before, err := snapshotRefs(r)
+		if err != nil {
+			return err
+		}
+
+		pending, err := holdRefUpdates(r)
+		if err != nil {
+			return err
+		}
+
+		// The remote is looked up again to update the held
+		// remote-tracking branches.
+		err = r.Push(&opts)
 		if errors.Is(err, git.NoErrAlreadyUpToDate) {
+			pending.discard()
 			cmd.PrintErr("Everything up-to-date")
 
 			return nil
 		}
 
-		return err
+		if err != nil {
+			pending.discard()
+
+			return err
+		}
+
+		err = pending.commit(hs, before)
+		if err != nil {
+			return err
+		}
+
+		return logRefUpdates(hs, before, staticReflogMessage("update by push"))
 	},
 }
+
+// pushRefSpec turns a command line refspec into a config.RefSpec. Branch
+// names on either side of a full refspec are qualified, as git does, while
+// branch and full reference names given alone are force pushed to the same
+// name on the remote.
+func pushRefSpec(arg string) config.RefSpec {
+	force := strings.HasPrefix(arg, "+")
+	arg = strings.TrimPrefix(arg, "+")
+
+	src, dst, ok := strings.Cut(arg, ":")
+	if !ok {
+		force, dst = true, src
+	}
+
+	spec := qualifyRefName(src) + ":" + qualifyRefName(dst)
+	if force {
+		spec = "+" + spec
+	}
+
+	return config.RefSpec(spec)
+}
+
+// qualifyRefName returns the full reference name of a branch name, leaving
+// full reference names and the empty source of a deleting refspec as they
+// are.
+func qualifyRefName(name string) string {
+	if name == "" || strings.HasPrefix(name, "refs/") {
+		return name
+	}
+
+	return plumbing.NewBranchReferenceName(name).String()
+}
+
+// prePushInput returns the lines the pre-push hook reads, one for each
+// reference the push is to update or delete on the remote:
+//
+//	<local ref> <local hash> <remote ref> <remote hash>
+func prePushInput(r *git.Repository, remote *git.Remote, opts *git.PushOptions) (string, error) {
+	listed, err := remote.List(&git.ListOptions{ClientOptions: opts.ClientOptions})
+	if err != nil && !errors.Is(err, transport.ErrEmptyRemoteRepository) {
+		return "", fmt.Errorf("failed to list remote references: %w", err)
+	}
+
+	remoteRefs := make(map[plumbing.ReferenceName]plumbing.Hash)
+	for _, ref := range listed {
+		if ref.Type() == plumbing.HashReference {
+			remoteRefs[ref.Name()] = ref.Hash()
+		}
+	}
+
+	refs, err := sortedReferences(r)
+	if err != nil {
+		return "", err
+	}
+
+	localRefs := make(map[plumbing.ReferenceName]bool)
+	for _, ref := range refs {
+		localRefs[ref.Name()] = true
+	}
+
+	refspecs := opts.RefSpecs
+	if len(refspecs) == 0 {
+		refspecs = []config.RefSpec{config.DefaultPushRefSpec}
+	}
+
+	var sb strings.Builder
+
+	deleted := func(name plumbing.ReferenceName) {
+		if h, ok := remoteRefs[name]; ok {
+			fmt.Fprintf(&sb, "(delete) %s %s %s\n", plumbing.ZeroHash, name, h)
+		}
+	}
+
+	for _, rs := range refspecs {
+		if rs.IsDelete() {
+			deleted(rs.Dst(""))
+
+			continue
+		}
+
+		for _, ref := range refs {
+			if (rs.IsWildcard() && !rs.Match(ref.Name())) || (!rs.IsWildcard() && rs.Src() != ref.Name().String()) {
+				continue
+			}
+
+			dst := rs.Dst(ref.Name())
+			if remoteRefs[dst] != ref.Hash() {
+				fmt.Fprintf(&sb, "%s %s %s %s\n", ref.Name(), ref.Hash(), dst, remoteRefs[dst])
+			}
+		}
+
+		if !opts.Prune {
+			continue
+		}
+
+		reverse := rs.Reverse()
+
+		for _, ref := range listed {
+			if reverse.Match(ref.Name()) && !localRefs[reverse.Dst(ref.Name())] {
+				deleted(ref.Name())
+			}
+		}
+	}
+
+	return sb.String(), nil
+}
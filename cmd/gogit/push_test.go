@@ -0,0 +1,51 @@
+package main
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestPushRefSpecs checks that the refspecs given to push update the
+// references git updates on the remote.
+func TestPushRefSpecs(t *testing.T) {
+	for _, args := range [][]string{
+		{"push", "origin", "main"},
+		{"push", "origin", "refs/heads/topic"},
+		{"push", "origin", "main:other"},
+		{"push", "origin", "topic:refs/heads/other"},
+		{"push", "origin", "+topic:main"},
+		{"push", "origin", ":gone"},
+		{"push", "origin", "refs/heads/*:refs/heads/copy/*"},
+	} {
+		var states []string
+
+		for _, tool := range []string{"git", "gogit"} {
+			dir := gitRepo(t, []string{"a", "1"}, []string{"a", "2"})
+			gitCmd(t, dir, "branch", "topic", "HEAD~1")
+
+			remote := filepath.Join(t.TempDir(), "origin.git")
+			gitCmd(t, "", "clone", "-q", "--bare", dir, remote)
+
+			base := strings.TrimSpace(gitCmd(t, dir, "rev-parse", "HEAD~1"))
+			gitCmd(t, remote, "update-ref", "refs/heads/main", base)
+			gitCmd(t, remote, "update-ref", "refs/heads/gone", base)
+			gitCmd(t, dir, "remote", "add", "origin", remote)
+
+			var res result
+			if tool == "git" {
+				res = run(t, dir, "", "git", args...)
+			} else {
+				res = gogit(t, dir, args...)
+			}
+
+			states = append(states, "exit "+strconv.Itoa(res.code)+"\n"+
+				gitCmd(t, remote, "for-each-ref", "--format=%(refname) %(subject)"))
+		}
+
+		if states[1] != states[0] {
+			t.Errorf("gogit %v left:\n%s\nwant, as git:\n%s", args, states[1], states[0])
+		}
+	}
+}
@@ -0,0 +1,758 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// rangeDiffCostMax is the cost of pairing patches that cannot be paired.
+	rangeDiffCostMax = 1 << 16
+
+	// rangeDiffPrefix is the indentation of the diffs between patches.
+	rangeDiffPrefix = "    "
+)
+
+// rangeDiffSections find the lines range-diff names hunks of the diffs
+// between patches after: the section headers and the hunk headers of the
+// patches, tried in order.
+var rangeDiffSections = []*regexp.Regexp{
+	regexp.MustCompile(`^ ## (.*) ##$`),
+	regexp.MustCompile(`^.?@@ (.*)$`),
+}
+
+var (
+	rangeDiffCreationFactor int
+	rangeDiffNoPatch        bool
+)
+
+func init() {
+	rangeDiffCmd.Flags().IntVarP(&rangeDiffCreationFactor, "creation-factor", "", 60, "Percentage by which creation is weighted")
+	rangeDiffCmd.Flags().BoolVarP(&rangeDiffNoPatch, "no-patch", "s", false, "Only show the pairs of commits, without the diffs between them")
+	rootCmd.AddCommand(rangeDiffCmd)
+}
+
+var rangeDiffCmd = &cobra.Command{
+	Use:   "range-diff [--creation-factor=<factor>] [-s] (<base> <rev1> <rev2> | <rev1>...<rev2> | <range1> <range2>)",
+	Short: "Compare two commit ranges (e.g. two versions of a branch)",
+	Args:  cobra.RangeArgs(1, 3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ranges, err := rangeDiffRanges(args)
+		if err != nil {
+			return err
+		}
+
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		ref, err := notesRefName(r, "")
+		if err != nil {
+			return err
+		}
+
+		n, err := loadNotes(r, ref)
+		if err != nil {
+			return err
+		}
+
+		a, err := readRangePatches(r, ranges[0], n)
+		if err != nil {
+			return err
+		}
+
+		b, err := readRangePatches(r, ranges[1], n)
+		if err != nil {
+			return err
+		}
+
+		findExactMatches(a, b)
+		matchPatches(a, b)
+
+		w := &rangeDiffWriter{
+			r:     r,
+			out:   cmd.OutOrStdout(),
+			width: len(strconv.Itoa(1 + max(len(a), len(b)))),
+		}
+		w.write(a, b)
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// rangeDiffRanges returns the two commit ranges args name.
+func rangeDiffRanges(args []string) ([2]string, error) {
+	switch len(args) {
+	case 3:
+		return [2]string{args[0] + ".." + args[1], args[0] + ".." + args[2]}, nil
+	case 2:
+		if !strings.Contains(args[0], "..") {
+			return [2]string{}, fmt.Errorf("not a commit range: '%s'", args[0])
+		}
+
+		if !strings.Contains(args[1], "..") {
+			return [2]string{}, fmt.Errorf("not a commit range: '%s'", args[1])
+		}
+
+		return [2]string{args[0], args[1]}, nil
+	}
+
+	a, b, ok := strings.Cut(args[0], "...")
+	if !ok {
+		return [2]string{}, errors.New("single arg format must be symmetric range")
+	}
+
+	if a == "" {
+		a = "HEAD"
+	}
+
+	if b == "" {
+		b = "HEAD"
+	}
+
+	return [2]string{b + ".." + a, a + ".." + b}, nil
+}
+
+// rangePatch is a commit of a range, as the text range-diff compares: its
+// author, message and notes, followed by its changes.
+type rangePatch struct {
+	commit *object.Commit
+	nr     int
+	text   string
+
+	// diff is the part of text with the changes, and diffSize the number of
+	// lines in it.
+	diff     string
+	diffSize int
+
+	// matching is the index of the patch of the other range paired with
+	// this one, or -1.
+	matching int
+	shown    bool
+}
+
+// readRangePatches returns the patches of the commits in rng that are not
+// merges, oldest first.
+func readRangePatches(r *git.Repository, rng string, n *notes) ([]*rangePatch, error) {
+	w := &revWalk{r: r}
+
+	err := w.addArg(rng)
+	if err != nil {
+		return nil, err
+	}
+
+	listed, _, err := w.walk()
+	if err != nil {
+		return nil, err
+	}
+
+	var patches []*rangePatch
+
+	for i := len(listed) - 1; i >= 0; i-- {
+		c := listed[i]
+		if c.NumParents() > 1 {
+			continue
+		}
+
+		p, err := newRangePatch(r, c, n)
+		if err != nil {
+			return nil, err
+		}
+
+		p.nr = len(patches)
+		patches = append(patches, p)
+	}
+
+	return patches, nil
+}
+
+// newRangePatch turns the commit c into the text git range-diff compares,
+// which git makes from the output of git log -p: the metadata, message and
+// notes of the commit under section headers, and a section for each file
+// it changes.
+func newRangePatch(r *git.Repository, c *object.Commit, n *notes) (*rangePatch, error) {
+	p := &rangePatch{commit: c, matching: -1}
+
+	var log, text strings.Builder
+
+	printCommit(&log, c, false)
+
+	err := printNotes(&log, c.Hash, []*notes{n}, false)
+	if err != nil {
+		return nil, err
+	}
+
+	for line := range strings.Lines(log.String()) {
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case strings.HasPrefix(line, "Author: "):
+			fmt.Fprintf(&text, " ## Metadata ##\n%s\n\n ## Commit message ##\n", line)
+		case strings.HasPrefix(line, "Notes") && strings.HasSuffix(line, ":"):
+			fmt.Fprintf(&text, "\n\n ## %s ##\n", strings.TrimSuffix(line, ":"))
+		case strings.HasPrefix(line, "    "):
+			text.WriteString(strings.TrimRight(line, " \t\n\v\f\r") + "\n")
+		}
+	}
+
+	var parent *object.Commit
+
+	if c.NumParents() == 1 {
+		parent, err = c.Parent(0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read parent of %s: %w", c.Hash, err)
+		}
+	}
+
+	diffs, err := commitDiffs(r, parent, c)
+	if err != nil {
+		return nil, err
+	}
+
+	offset := 0
+
+	for _, d := range diffs {
+		text.WriteString("\n")
+
+		if offset == 0 {
+			offset = text.Len()
+		}
+
+		name := d.path
+
+		switch {
+		case d.from.Hash.IsZero():
+			name += " (new)"
+		case d.to.Hash.IsZero():
+			name += " (deleted)"
+		case d.from.Mode != d.to.Mode:
+			name += fmt.Sprintf(" (mode change %06o => %06o)", uint32(d.from.Mode), uint32(d.to.Mode))
+		}
+
+		fmt.Fprintf(&text, " ## %s ##\n", name)
+		p.diffSize++
+
+		if d.binary && d.from.Hash != d.to.Hash {
+			from, to := quotePath(d.path), quotePath(d.path)
+			if d.from.Hash.IsZero() {
+				from = "/dev/null"
+			}
+
+			if d.to.Hash.IsZero() {
+				to = "/dev/null"
+			}
+
+			fmt.Fprintf(&text, " Binary files %s and %s differ\n", from, to)
+			p.diffSize++
+		}
+
+		for _, h := range d.hunks {
+			text.WriteString("@@")
+
+			if h.funcName != "" {
+				fmt.Fprintf(&text, " %s: %s", d.path, h.funcName)
+			}
+
+			text.WriteString("\n")
+			p.diffSize++
+
+			for _, l := range h.lines {
+				fmt.Fprintf(&text, "%c%s\n", l.op, strings.TrimSuffix(l.text, "\n"))
+				p.diffSize++
+
+				if !strings.HasSuffix(l.text, "\n") {
+					text.WriteString(" \\ No newline at end of file\n")
+					p.diffSize++
+				}
+			}
+		}
+	}
+
+	p.text = text.String()
+	p.diff = p.text[offset:]
+
+	return p, nil
+}
+
+// findExactMatches pairs the patches of a and b whose changes are the
+// same, the latest of a first when several are.
+func findExactMatches(a, b []*rangePatch) {
+	byDiff := make(map[string][]int)
+
+	for i, p := range a {
+		byDiff[p.diff] = append(byDiff[p.diff], i)
+	}
+
+	for j, p := range b {
+		same := byDiff[p.diff]
+		if len(same) == 0 {
+			continue
+		}
+
+		i := same[len(same)-1]
+		byDiff[p.diff] = same[:len(same)-1]
+
+		a[i].matching = j
+		p.matching = a[i].nr
+	}
+}
+
+// matchPatches pairs the patches of a and b left unpaired so that the
+// changes between pairs, and the patches left out, are the smallest. A
+// patch left out weighs its size scaled by --creation-factor.
+func matchPatches(a, b []*rangePatch) {
+	n := len(a) + len(b)
+	cost := make([]int, n*n)
+
+	for i, pa := range a {
+		for j, pb := range b {
+			c := rangeDiffCostMax
+
+			switch {
+			case pa.matching == j:
+				c = 0
+			case pa.matching < 0 && pb.matching < 0:
+				c = diffSize(pa.diff, pb.diff)
+			}
+
+			cost[i+n*j] = c
+		}
+
+		c := rangeDiffCostMax
+		if pa.matching < 0 {
+			c = pa.diffSize * rangeDiffCreationFactor / 100
+		}
+
+		for j := len(b); j < n; j++ {
+			cost[i+n*j] = c
+		}
+	}
+
+	for j, pb := range b {
+		c := rangeDiffCostMax
+		if pb.matching < 0 {
+			c = pb.diffSize * rangeDiffCreationFactor / 100
+		}
+
+		for i := len(a); i < n; i++ {
+			cost[i+n*j] = c
+		}
+	}
+
+	a2b := assignColumns(n, cost)
+
+	for i, pa := range a {
+		if j := a2b[i]; j >= 0 && j < len(b) {
+			pa.matching = j
+			b[j].matching = i
+		}
+	}
+}
+
+// diffSize returns the number of lines of the diff between a and b,
+// hunk headers included. Like git, the diff is made without the indent
+// heuristic.
+func diffSize(a, b string) int {
+	old := splitLines(a)
+	size := 0
+
+	for _, h := range makeHunks(lineDiff(old, splitLines(b), false), old) {
+		size += 1 + len(h.lines)
+	}
+
+	return size
+}
+
+// assignColumns solves the assignment problem of the square matrix cost of
+// size n, where cost[column+n*row] is the cost of assigning column to row,
+// and returns the row of each column. It follows the algorithm of Jonker
+// and Volgenant, as git does, so that ties are broken the same way.
+func assignColumns(n int, cost []int) []int {
+	column2row := make([]int, n)
+	row2column := make([]int, n)
+
+	if n < 2 {
+		return column2row
+	}
+
+	at := func(column, row int) int { return cost[column+n*row] }
+
+	for i := range n {
+		column2row[i] = -1
+		row2column[i] = -1
+	}
+
+	v := make([]int, n)
+
+	// Column reduction.
+	for j := n - 1; j >= 0; j-- {
+		i1 := 0
+
+		for i := 1; i < n; i++ {
+			if at(j, i1) > at(j, i) {
+				i1 = i
+			}
+		}
+
+		v[j] = at(j, i1)
+
+		if row2column[i1] == -1 {
+			row2column[i1] = j
+			column2row[j] = i1
+		} else {
+			if row2column[i1] >= 0 {
+				row2column[i1] = -2 - row2column[i1]
+			}
+
+			column2row[j] = -1
+		}
+	}
+
+	// Reduction transfer.
+	var free []int
+
+	for i := range n {
+		j1 := row2column[i]
+
+		switch {
+		case j1 == -1:
+			free = append(free, i)
+		case j1 < -1:
+			row2column[i] = -2 - j1
+		default:
+			other := 0
+			if j1 == 0 {
+				other = 1
+			}
+
+			least := at(other, i) - v[other]
+
+			for j := 1; j < n; j++ {
+				if j != j1 && least > at(j, i)-v[j] {
+					least = at(j, i) - v[j]
+				}
+			}
+
+			v[j1] -= least
+		}
+	}
+
+	if len(free) == 0 {
+		return column2row
+	}
+
+	// Augmenting row reduction.
+	for range 2 {
+		saved := free
+		free = nil
+
+		for k := 0; k < len(saved); {
+			i := saved[k]
+			k++
+
+			j1, j2 := 0, -1
+			u1, u2 := at(0, i)-v[0], math.MaxInt
+
+			for j := 1; j < n; j++ {
+				c := at(j, i) - v[j]
+				if u2 <= c {
+					continue
+				}
+
+				if u1 < c {
+					u2, j2 = c, j
+				} else {
+					u2, u1 = u1, c
+					j2, j1 = j1, j
+				}
+			}
+
+			if j2 < 0 {
+				j2, u2 = j1, u1
+			}
+
+			i0 := column2row[j1]
+
+			if u1 < u2 {
+				v[j1] -= u2 - u1
+			} else if i0 >= 0 {
+				j1 = j2
+				i0 = column2row[j1]
+			}
+
+			if i0 >= 0 {
+				if u1 < u2 {
+					k--
+					saved[k] = i0
+				} else {
+					free = append(free, i0)
+				}
+			}
+
+			row2column[i] = j1
+			column2row[j1] = i
+		}
+	}
+
+	// Augmentation.
+	d := make([]int, n)
+	pred := make([]int, n)
+	col := make([]int, n)
+
+	for _, i1 := range free {
+		for j := range n {
+			d[j] = at(j, i1) - v[j]
+			pred[j] = i1
+			col[j] = j
+		}
+
+		var (
+			low, up, last int
+			least         int
+			j             = -1
+		)
+
+	search:
+		for low == up {
+			last = low
+			least = d[col[up]]
+			up++
+
+			for k := up; k < n; k++ {
+				j = col[k]
+
+				c := d[j]
+				if c > least {
+					continue
+				}
+
+				if c < least {
+					up = low
+					least = c
+				}
+
+				col[k] = col[up]
+				col[up] = j
+				up++
+			}
+
+			// Like git, the path is augmented from the last column the
+			// minimum was searched in, rather than from the free column
+			// found, which breaks ties the same way.
+			for k := low; k < up; k++ {
+				if column2row[col[k]] == -1 {
+					if j < 0 {
+						j = col[k]
+					}
+
+					break search
+				}
+			}
+
+			// Scan a row.
+			for low != up {
+				j1 := col[low]
+				low++
+
+				i := column2row[j1]
+				u1 := at(j1, i) - v[j1] - least
+
+				for k := up; k < n; k++ {
+					j = col[k]
+
+					c := at(j, i) - v[j] - u1
+					if c >= d[j] {
+						continue
+					}
+
+					d[j] = c
+					pred[j] = i
+
+					if c == least {
+						if column2row[j] == -1 {
+							break search
+						}
+
+						col[k] = col[up]
+						col[up] = j
+						up++
+					}
+				}
+			}
+		}
+
+		// Update the column prices.
+		for k := range last {
+			j1 := col[k]
+			v[j1] += d[j1] - least
+		}
+
+		for {
+			i := pred[j]
+			column2row[j] = i
+			j, row2column[i] = row2column[i], j
+
+			if i == i1 {
+				break
+			}
+		}
+	}
+
+	return column2row
+}
+
+// rangeDiffWriter writes the pairs of patches of two ranges, and the
+// diffs between the patches paired that differ.
+type rangeDiffWriter struct {
+	r      *git.Repository
+	out    io.Writer
+	width  int
+	dashes string
+}
+
+// write shows the patches in the order of b, each patch of a left out of
+// b placed once the patches before it in a have been shown.
+func (w *rangeDiffWriter) write(a, b []*rangePatch) {
+	i, j := 0, 0
+
+	for i < len(a) || j < len(b) {
+		for i < len(a) && a[i].shown {
+			i++
+		}
+
+		if i < len(a) && a[i].matching < 0 {
+			w.header(a[i], nil)
+			i++
+
+			continue
+		}
+
+		for j < len(b) && b[j].matching < 0 {
+			w.header(nil, b[j])
+			j++
+		}
+
+		if j < len(b) {
+			pa := a[b[j].matching]
+			w.header(pa, b[j])
+
+			if !rangeDiffNoPatch {
+				w.patchDiff(pa, b[j])
+			}
+
+			pa.shown = true
+			j++
+		}
+	}
+}
+
+// header writes the line naming the pair a and b, either of which may be
+// missing, with '=' between them when they are the same and '!' when not.
+func (w *rangeDiffWriter) header(a, b *rangePatch) {
+	var c *object.Commit
+
+	if a != nil {
+		c = a.commit
+	} else {
+		c = b.commit
+	}
+
+	if w.dashes == "" {
+		w.dashes = strings.Repeat("-", len(abbreviateHash(w.r, c.Hash, 7)))
+	}
+
+	status := '='
+
+	switch {
+	case b == nil:
+		status = '<'
+	case a == nil:
+		status = '>'
+	case a.text != b.text:
+		status = '!'
+	}
+
+	side := func(p *rangePatch) string {
+		if p == nil {
+			return fmt.Sprintf("%*s:  %s", w.width, "-", w.dashes)
+		}
+
+		return fmt.Sprintf("%*d:  %s", w.width, p.nr+1, abbreviateHash(w.r, p.commit.Hash, 7))
+	}
+
+	fmt.Fprintf(w.out, "%s %c %s %s\n", side(a), status, side(b), onelineSubject(c.Message))
+}
+
+// onelineSubject returns the first paragraph of msg on one line, the way
+// git's oneline format shows it: its lines trimmed at the end and joined
+// with spaces.
+func onelineSubject(msg string) string {
+	var lines []string
+
+	for line := range strings.Lines(strings.TrimLeft(msg, "\n")) {
+		line = strings.TrimRight(line, " \t\n\v\f\r")
+		if line == "" {
+			break
+		}
+
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, " ")
+}
+
+// patchDiff writes the diff between the texts of a and b, indented, with
+// each hunk named after the section it is in.
+func (w *rangeDiffWriter) patchDiff(a, b *rangePatch) {
+	if a.text == b.text {
+		return
+	}
+
+	old := splitLines(a.text)
+
+	for _, h := range makeHunks(diffLines(old, splitLines(b.text)), old) {
+		fmt.Fprint(w.out, rangeDiffPrefix+"@@")
+
+		if name := rangeDiffSection(old, h.oldStart-2); name != "" {
+			fmt.Fprint(w.out, " "+name)
+		}
+
+		fmt.Fprintln(w.out)
+
+		for _, l := range h.lines {
+			fmt.Fprintf(w.out, "%s%c%s", rangeDiffPrefix, l.op, l.text)
+		}
+	}
+}
+
+// rangeDiffSection returns the name of the closest section header at or
+// before the index i of lines.
+func rangeDiffSection(lines []string, i int) string {
+	for ; i >= 0; i-- {
+		l := strings.TrimSuffix(lines[i], "\n")
+
+		for _, re := range rangeDiffSections {
+			m := re.FindStringSubmatch(l)
+			if m == nil {
+				continue
+			}
+
+			name := m[1]
+
+			return strings.TrimRight(name[:min(len(name), funcNameWidth)], " \t\n\r\v\f")
+		}
+	}
+
+	return ""
+}
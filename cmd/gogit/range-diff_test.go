@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// rangeDiffRepo returns a repository made by git with two versions of a
+// series: v1, and v2 rebased on main, in which the first patch is kept,
+// the second reworked, the third dropped and new ones added, one of which
+// renames a file.
+func rangeDiffRepo(t *testing.T) string {
+	t.Helper()
+
+	lines := "one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\n"
+
+	dir := gitRepo(t, []string{"a", lines, "b", "bee\n"})
+	gitCmd(t, dir, "checkout", "-q", "-b", "v1")
+
+	commit := func(msg string, files ...string) {
+		for i := 0; i < len(files); i += 2 {
+			writeFile(t, dir, files[i], files[i+1])
+		}
+
+		gitCmd(t, dir, "add", "-A")
+		gitCmd(t, dir, "commit", "-q", "-m", msg)
+	}
+
+	commit("Louder three", "a", strings.Replace(lines, "three", "THREE", 1))
+	commit("Add c", "c", "see\n")
+	commit("Change b", "b", "bee!\n")
+
+	gitCmd(t, dir, "checkout", "-q", "main")
+	commit("Unrelated", "d", "dee\n")
+
+	gitCmd(t, dir, "checkout", "-q", "-b", "v2")
+	gitCmd(t, dir, "cherry-pick", "v1~2")
+	commit("Add c", "c", "sea\nand more\n")
+	commit("Add e\n\nWith a body.", "e", "eee\n")
+
+	gitCmd(t, dir, "mv", "a", "a2")
+	commit("Rename a", "a2", strings.Replace(lines, "three", "THREE", 1)+"eleven\n")
+
+	return dir
+}
+
+func TestRangeDiff(t *testing.T) {
+	dir := rangeDiffRepo(t)
+
+	for _, args := range []string{
+		"main~1..v1 main..v2",
+		"main v1 v2",
+		"v1...v2",
+		"-s v1...v2",
+		"--no-patch main~1..v1 main..v2",
+		"main~1..v1 main~1..v1",
+		"--creation-factor=100 v1...v2",
+		"--creation-factor=0 v1...v2",
+	} {
+		t.Run(args, func(t *testing.T) {
+			sameOutput(t, dir, append([]string{"range-diff"}, strings.Fields(args)...)...)
+		})
+	}
+}
@@ -0,0 +1,680 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/reflog"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/spf13/cobra"
+)
+
+var (
+	reflogShowMaxCount int
+	reflogExpire       string
+	reflogExpireAll    bool
+	reflogDryRun       bool
+	reflogVerbose      bool
+)
+
+func init() {
+	reflogShowCmd.Flags().IntVarP(&reflogShowMaxCount, "max-count", "n", 0, "Limit the number of entries to show")
+	reflogExpireCmd.Flags().StringVarP(&reflogExpire, "expire", "", "90.days.ago", "Prune entries older than the specified time")
+	reflogExpireCmd.Flags().BoolVarP(&reflogExpireAll, "all", "", false, "Process the reflogs of all references")
+	reflogExpireCmd.Flags().BoolVarP(&reflogDryRun, "dry-run", "n", false, "Do not actually prune any entries")
+	reflogDeleteCmd.Flags().BoolVarP(&reflogDryRun, "dry-run", "n", false, "Do not actually delete any entries")
+
+	for _, c := range []*cobra.Command{reflogExpireCmd, reflogDeleteCmd} {
+		c.Flags().BoolVarP(&reflogVerbose, "verbose", "", false, "Print whether each entry is kept or pruned")
+	}
+
+	reflogCmd.AddCommand(reflogShowCmd)
+	reflogCmd.AddCommand(reflogExpireCmd)
+	reflogCmd.AddCommand(reflogDeleteCmd)
+	reflogCmd.AddCommand(reflogExistsCmd)
+	rootCmd.AddCommand(reflogCmd)
+}
+
+var reflogCmd = &cobra.Command{
+	Use:   "reflog [show|expire|delete|exists] [<args>]",
+	Short: "Manage reflog information",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return reflogShowCmd.RunE(cmd, args)
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var reflogShowCmd = &cobra.Command{
+	Use:   "show [-n <number>] [<ref>]",
+	Short: "Show the log of a reference",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		rs, err := reflogStorer(r)
+		if err != nil {
+			return err
+		}
+
+		display := plumbing.HEAD.String()
+		if len(args) > 0 {
+			display = args[0]
+		}
+
+		name, err := expandRefName(r, display)
+		if err != nil {
+			return err
+		}
+
+		entries, err := rs.Reflog(name)
+		if err != nil {
+			return fmt.Errorf("failed to read reflog: %w", err)
+		}
+
+		out := cmd.OutOrStdout()
+		for i := len(entries) - 1; i >= 0; i-- {
+			n := len(entries) - 1 - i
+			if reflogShowMaxCount > 0 && n >= reflogShowMaxCount {
+				break
+			}
+
+			fmt.Fprintf(out, "%s %s@{%d}: %s\n",
+				entries[i].NewHash.String()[:7], display, n, entries[i].Message)
+		}
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var reflogExpireCmd = &cobra.Command{
+	Use:   "expire [--expire=<time>] [--all] [-n] [--verbose] [<ref>...]",
+	Short: "Prune older reflog entries",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		rs, err := reflogStorer(r)
+		if err != nil {
+			return err
+		}
+
+		cutoff, err := parseExpireTime(reflogExpire, time.Now())
+		if err != nil {
+			return err
+		}
+
+		var names []plumbing.ReferenceName
+
+		if reflogExpireAll {
+			names, err = reflogNames(r)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, arg := range args {
+			name, err := expandRefName(r, arg)
+			if err != nil {
+				return err
+			}
+
+			names = append(names, name)
+		}
+
+		if len(names) == 0 {
+			return errors.New("no reflog specified, use --all or name a reference")
+		}
+
+		var out io.Writer
+		if reflogVerbose {
+			out = cmd.OutOrStdout()
+		}
+
+		for _, name := range names {
+			err = expireReflog(rs, name, cutoff, reflogDryRun, out)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// expireReflog removes the entries of the reflog of name older than cutoff,
+// unless dryRun is set. With out, it reports what happens to each entry.
+func expireReflog(rs storer.ReflogStorer, name plumbing.ReferenceName, cutoff time.Time, dryRun bool, out io.Writer) error {
+	entries, err := rs.Reflog(name)
+	if err != nil {
+		return fmt.Errorf("failed to read reflog for %s: %w", name, err)
+	}
+
+	kept := make([]*reflog.Entry, 0, len(entries))
+	for _, e := range entries {
+		prune := e.Committer.When.Before(cutoff)
+		reportReflogEntry(out, e, prune, dryRun)
+
+		if !prune {
+			kept = append(kept, e)
+		}
+	}
+
+	if dryRun || len(kept) == len(entries) {
+		return nil
+	}
+
+	return rewriteReflog(rs, name, kept)
+}
+
+// reportReflogEntry prints to out, if any, whether the reflog entry e is
+// kept or pruned, as git does with --verbose.
+func reportReflogEntry(out io.Writer, e *reflog.Entry, prune, dryRun bool) {
+	switch {
+	case out == nil:
+	case !prune:
+		fmt.Fprintf(out, "keep %s\n", e.Message)
+	case dryRun:
+		fmt.Fprintf(out, "would prune %s\n", e.Message)
+	default:
+		fmt.Fprintf(out, "prune %s\n", e.Message)
+	}
+}
+
+var reflogDeleteCmd = &cobra.Command{
+	Use:   "delete [-n] [--verbose] <ref>@{<specifier>}...",
+	Short: "Delete single entries from the reflog",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		rs, err := reflogStorer(r)
+		if err != nil {
+			return err
+		}
+
+		// Entries are grouped per reference so that several entries of
+		// the same reflog can be removed with a single rewrite.
+		drop := make(map[plumbing.ReferenceName]map[int]bool)
+
+		for _, arg := range args {
+			ref, n, err := parseReflogSelector(arg)
+			if err != nil {
+				return err
+			}
+
+			name, err := expandRefName(r, ref)
+			if err != nil {
+				return err
+			}
+
+			if drop[name] == nil {
+				drop[name] = make(map[int]bool)
+			}
+
+			drop[name][n] = true
+		}
+
+		var out io.Writer
+		if reflogVerbose {
+			out = cmd.OutOrStdout()
+		}
+
+		for name, selectors := range drop {
+			entries, err := rs.Reflog(name)
+			if err != nil {
+				return fmt.Errorf("failed to read reflog for %s: %w", name, err)
+			}
+
+			for n := range selectors {
+				if n >= len(entries) {
+					return fmt.Errorf("reflog entry %s@{%d} does not exist", name.Short(), n)
+				}
+			}
+
+			kept := make([]*reflog.Entry, 0, len(entries))
+
+			for i, e := range entries {
+				prune := selectors[len(entries)-1-i]
+				reportReflogEntry(out, e, prune, reflogDryRun)
+
+				if !prune {
+					kept = append(kept, e)
+				}
+			}
+
+			if reflogDryRun {
+				continue
+			}
+
+			err = rewriteReflog(rs, name, kept)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var reflogExistsCmd = &cobra.Command{
+	Use:   "exists <ref>",
+	Short: "Check whether a reference has a reflog",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		names, err := reflogNames(r)
+		if err != nil {
+			return err
+		}
+
+		for _, name := range names {
+			if name.String() == args[0] {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("reflog for '%s' does not exist", args[0])
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// reflogMessageFunc returns the reflog message recorded for a reference
+// moving from one hash to another.
+type reflogMessageFunc func(name plumbing.ReferenceName, from, to plumbing.Hash) string
+
+// staticReflogMessage returns a reflogMessageFunc that always uses msg.
+func staticReflogMessage(msg string) reflogMessageFunc {
+	return func(plumbing.ReferenceName, plumbing.Hash, plumbing.Hash) string {
+		return msg
+	}
+}
+
+// updateReflogMessage returns a reflogMessageFunc following the notes git
+// uses when fetching: new references are stored, and updated references
+// are either fast-forwarded or forcibly updated.
+func updateReflogMessage(r *git.Repository, prefix string) reflogMessageFunc {
+	return func(name plumbing.ReferenceName, from, to plumbing.Hash) string {
+		if from.IsZero() {
+			if name.IsTag() {
+				return prefix + ": storing tag"
+			}
+
+			return prefix + ": storing head"
+		}
+
+		// A failure to read either commit shows as a forced update.
+		if ok, _ := isAncestor(r, from, to); ok {
+			return prefix + ": fast-forward"
+		}
+
+		return prefix + ": forced-update"
+	}
+}
+
+// refSnapshot records the hashes references point to, so that the changes
+// made by an operation can be written to the reflog once it completes.
+type refSnapshot map[plumbing.ReferenceName]plumbing.Hash
+
+// snapshotRefs captures all hash references of r, plus HEAD resolved to the
+// commit it currently points at. Symbolic references other than HEAD are
+// skipped, as their updates are recorded in the log of their target.
+func snapshotRefs(r *git.Repository) (refSnapshot, error) {
+	snap := make(refSnapshot)
+
+	refs, err := r.References()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list references: %w", err)
+	}
+
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() == plumbing.HashReference {
+			snap[ref.Name()] = ref.Hash()
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := r.Head()
+	if err == nil {
+		snap[plumbing.HEAD] = head.Hash()
+	}
+
+	return snap, nil
+}
+
+// logRefUpdates compares the current references of the repository of hs
+// against before and appends a reflog entry for each one that changed,
+// honouring core.logAllRefUpdates. The logs of deleted references are
+// removed, and the reference-transaction hook is told about all the
+// changes.
+func logRefUpdates(hs *hooks, before refSnapshot, msg reflogMessageFunc) error {
+	r := hs.r
+
+	rs, ok := r.Storer.(storer.ReflogStorer)
+	if !ok {
+		return nil
+	}
+
+	cfg, err := r.Config()
+	if err != nil {
+		return fmt.Errorf("failed to get repository config: %w", err)
+	}
+
+	after, err := snapshotRefs(r)
+	if err != nil {
+		return err
+	}
+
+	updates := refTransactionUpdates(r, before, after)
+	sig := reflogSignature(r)
+
+	for _, name := range changedRefs(before, after) {
+		from, to := before[name], after[name]
+		if _, ok := after[name]; !ok || from == to || !shouldLogRef(cfg, name) {
+			continue
+		}
+
+		err := rs.AppendReflog(name, &reflog.Entry{
+			OldHash:   from,
+			NewHash:   to,
+			Committer: sig,
+			Message:   msg(name, from, to),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to write reflog for %s: %w", name, err)
+		}
+	}
+
+	for name := range before {
+		if _, ok := after[name]; ok || name == plumbing.HEAD {
+			continue
+		}
+
+		err := rs.DeleteReflog(name)
+		if err != nil {
+			return fmt.Errorf("failed to delete reflog for %s: %w", name, err)
+		}
+	}
+
+	// Like git, the status of the hook is ignored once the references
+	// are updated.
+	_ = hs.referenceTransaction("committed", updates)
+
+	return nil
+}
+
+// changedRefs returns the sorted names of the references that differ
+// between two snapshots.
+func changedRefs(before, after refSnapshot) []plumbing.ReferenceName {
+	var names []plumbing.ReferenceName
+
+	for name, to := range after {
+		if before[name] != to {
+			names = append(names, name)
+		}
+	}
+
+	for name := range before {
+		if _, ok := after[name]; !ok && name != plumbing.HEAD {
+			names = append(names, name)
+		}
+	}
+
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+
+	return names
+}
+
+// refTransactionUpdates returns the reference-transaction hook lines for
+// the changes from before to after, r having its references as in after.
+func refTransactionUpdates(r *git.Repository, before, after refSnapshot) []string {
+	// The hook sees a symbolic HEAD only when its branch was updated
+	// through it, and not when HEAD was switched to another branch.
+	throughHead := true
+
+	if head, err := r.Storer.Reference(plumbing.HEAD); err == nil && head.Type() == plumbing.SymbolicReference {
+		target := head.Target()
+		throughHead = before[plumbing.HEAD] == before[target] && after[plumbing.HEAD] == after[target]
+	}
+
+	var updates []string
+
+	for _, name := range changedRefs(before, after) {
+		if name != plumbing.HEAD || throughHead {
+			updates = append(updates, refTransactionLine(name, before[name], after[name]))
+		}
+	}
+
+	return updates
+}
+
+// shouldLogRef mirrors git's core.logAllRefUpdates semantics: by default
+// only non-bare repositories keep logs, and then only for HEAD, branches,
+// remote-tracking branches and notes.
+func shouldLogRef(cfg *config.Config, name plumbing.ReferenceName) bool {
+	value := strings.ToLower(configOption(cfg, "core", "logallrefupdates"))
+
+	switch value {
+	case "always":
+		return true
+	case "":
+		if cfg.Core.IsBare {
+			return false
+		}
+	default:
+		if ok, err := strconv.ParseBool(value); err == nil && !ok {
+			return false
+		}
+	}
+
+	return name == plumbing.HEAD ||
+		name.IsBranch() ||
+		name.IsRemote() ||
+		name.IsNote()
+}
+
+// reflogSignature returns the committer identity recorded in reflog entries.
+func reflogSignature(r *git.Repository) reflog.Signature {
+	sig := signature(r, committerRole)
+
+	return reflog.Signature{Name: sig.Name, Email: sig.Email, When: sig.When}
+}
+
+// reflogStorer returns the reflog storage of r.
+func reflogStorer(r *git.Repository) (storer.ReflogStorer, error) {
+	rs, ok := r.Storer.(storer.ReflogStorer)
+	if !ok {
+		return nil, errors.New("storer does not implement ReflogStorer")
+	}
+
+	return rs, nil
+}
+
+// rewriteReflog replaces the reflog of name with entries. Like git, it
+// leaves an empty reflog rather than none.
+func rewriteReflog(rs storer.ReflogStorer, name plumbing.ReferenceName, entries []*reflog.Entry) error {
+	if s, ok := rs.(*filesystem.Storage); ok && len(entries) == 0 {
+		return util.WriteFile(s.Filesystem(), s.Filesystem().Join("logs", name.String()), nil, 0o666)
+	}
+
+	err := rs.DeleteReflog(name)
+	if err != nil {
+		return fmt.Errorf("failed to delete reflog for %s: %w", name, err)
+	}
+
+	for _, e := range entries {
+		err := rs.AppendReflog(name, e)
+		if err != nil {
+			return fmt.Errorf("failed to write reflog for %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// reflogNames lists all references that have a reflog on disk.
+func reflogNames(r *git.Repository) ([]plumbing.ReferenceName, error) {
+	store, ok := r.Storer.(*filesystem.Storage)
+	if !ok {
+		return nil, errors.New("storer does not implement filesystem.Storage")
+	}
+
+	fs := store.Filesystem()
+
+	var names []plumbing.ReferenceName
+
+	err := util.Walk(fs, "logs", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel("logs", path)
+		if err != nil {
+			return err
+		}
+
+		names = append(names, plumbing.ReferenceName(filepath.ToSlash(rel)))
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reflogs: %w", err)
+	}
+
+	return names, nil
+}
+
+// expandRefName resolves a short reference name, such as "main" or
+// "origin/main", into its full name using git's revision parsing rules.
+func expandRefName(r *git.Repository, name string) (plumbing.ReferenceName, error) {
+	if name == plumbing.HEAD.String() {
+		return plumbing.HEAD, nil
+	}
+
+	for _, rule := range plumbing.RefRevParseRules {
+		full := plumbing.ReferenceName(fmt.Sprintf(rule, name))
+
+		_, err := r.Reference(full, false)
+		if err == nil {
+			return full, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %s", plumbing.ErrReferenceNotFound, name)
+}
+
+var reflogSelectorRE = regexp.MustCompile(`^(.*)@\{(\d+)\}$`)
+
+// parseReflogSelector splits a "<ref>@{<n>}" selector into its parts. An
+// empty reference name refers to HEAD.
+func parseReflogSelector(s string) (string, int, error) {
+	m := reflogSelectorRE.FindStringSubmatch(s)
+	if m == nil {
+		return "", 0, fmt.Errorf("invalid reflog selector %q, expected <ref>@{<n>}", s)
+	}
+
+	n, err := strconv.Atoi(m[2])
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid reflog selector %q: %w", s, err)
+	}
+
+	ref := m[1]
+	if ref == "" {
+		ref = plumbing.HEAD.String()
+	}
+
+	return ref, n, nil
+}
+
+var relativeTimeRE = regexp.MustCompile(`^(\d+)[. ](second|minute|hour|day|week|month|year)s?[. ]ago$`)
+
+// parseExpireTime parses the subset of git's approxidate format accepted by
+// --expire: "now", "all", "never", "<n>.<unit>.ago" and absolute dates.
+func parseExpireTime(s string, now time.Time) (time.Time, error) {
+	switch s {
+	case "now", "all":
+		return now, nil
+	case "never", "false":
+		return time.Time{}, nil
+	}
+
+	if m := relativeTimeRE.FindStringSubmatch(s); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid expiry %q: %w", s, err)
+		}
+
+		switch m[2] {
+		case "second":
+			return now.Add(-time.Duration(n) * time.Second), nil
+		case "minute":
+			return now.Add(-time.Duration(n) * time.Minute), nil
+		case "hour":
+			return now.Add(-time.Duration(n) * time.Hour), nil
+		case "day":
+			return now.AddDate(0, 0, -n), nil
+		case "week":
+			return now.AddDate(0, 0, -7*n), nil
+		case "month":
+			return now.AddDate(0, -n, 0), nil
+		case "year":
+			return now.AddDate(-n, 0, 0), nil
+		}
+	}
+
+	if secs, ok := strings.CutPrefix(s, "@"); ok {
+		n, err := strconv.ParseInt(secs, 10, 64)
+		if err == nil {
+			return time.Unix(n, 0), nil
+		}
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+		t, err := time.ParseInLocation(layout, s, time.Local)
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid expiry %q", s)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// reflogs returns the reflogs of HEAD and of the branches of dir, as git
+// shows them.
+func reflogs(t *testing.T, dir string) string {
+	t.Helper()
+
+	var logs strings.Builder
+
+	for _, ref := range append([]string{"HEAD"}, strings.Fields(gitCmd(t, dir, "for-each-ref", "--format=%(refname)", "refs/heads"))...) {
+		logs.WriteString(gitCmd(t, dir, "reflog", "show", "--format=%H %gd %gs", ref))
+	}
+
+	return logs.String()
+}
+
+// TestReflogWriters checks that the commands updating references record
+// the same reflog entries as git.
+func TestReflogWriters(t *testing.T) {
+	steps := [][]string{
+		{"checkout", "-b", "topic"},
+		{"commit", "-m", "three"},
+		{"checkout", "main"},
+		{"update-ref", "-m", "by hand", "refs/heads/x", "HEAD~1"},
+		{"update-ref", "-d", "refs/heads/x"},
+		{"symbolic-ref", "-m", "switch", "HEAD", "refs/heads/topic"},
+	}
+
+	var logs []string
+
+	for _, tool := range []string{"git", "gogit"} {
+		dir := gitRepo(t, []string{"a", "1"}, []string{"a", "2"})
+		writeFile(t, dir, "a", "3")
+		gitCmd(t, dir, "add", "a")
+
+		for _, args := range steps {
+			if tool == "git" {
+				gitCmd(t, dir, args...)
+			} else {
+				mustGogit(t, dir, args...)
+			}
+		}
+
+		logs = append(logs, reflogs(t, dir))
+	}
+
+	if logs[1] != logs[0] {
+		t.Errorf("gogit wrote the reflogs:\n%s\nwant, as git:\n%s", logs[1], logs[0])
+	}
+}
+
+func TestReflogClone(t *testing.T) {
+	src := gitRepo(t, []string{"a", "1"}, []string{"a", "2"})
+
+	want := filepath.Join(t.TempDir(), "git")
+	gitCmd(t, "", "clone", "-q", src, want)
+
+	got := filepath.Join(t.TempDir(), "gogit")
+	mustGogit(t, "", "clone", src, got)
+
+	if g, w := reflogs(t, got), reflogs(t, want); g != w {
+		t.Errorf("gogit clone wrote the reflogs:\n%s\nwant, as git:\n%s", g, w)
+	}
+}
+
+func TestReflog(t *testing.T) {
+	steps := [][]string{
+		{"reflog"},
+		{"reflog", "show", "-n", "2"},
+		{"reflog", "show", "main"},
+		{"reflog", "delete", "main@{1}"},
+		{"reflog", "show", "main"},
+		{"reflog", "delete", "--dry-run", "HEAD@{0}"},
+		{"reflog", "delete", "--dry-run", "--verbose", "HEAD@{0}"},
+		{"reflog", "expire", "--dry-run", "--verbose", "--expire=now", "--all"},
+		{"reflog", "delete", "--verbose", "HEAD@{1}"},
+		{"reflog", "expire", "--expire=now", "--all"},
+		{"reflog", "show"},
+		{"reflog", "exists", "refs/heads/main"},
+	}
+
+	want := gitRepo(t, []string{"a", "1"}, []string{"a", "2"}, []string{"a", "3"})
+	got := gitRepo(t, []string{"a", "1"}, []string{"a", "2"}, []string{"a", "3"})
+
+	for _, args := range steps {
+		w := run(t, want, "", "git", args...)
+
+		g := gogit(t, got, args...)
+
+		// git walks the reflogs of --all in directory order.
+		if slices.Contains(args, "--all") {
+			g.stdout, w.stdout = strings.Join(sortedLines(g.stdout), "\n"), strings.Join(sortedLines(w.stdout), "\n")
+		}
+
+		if g.code != w.code || g.stdout != w.stdout {
+			t.Errorf("gogit %v exited with %d:\n%s\nwant, as git, %d:\n%s", args, g.code, g.stdout, w.code, w.stdout)
+		}
+	}
+
+	for _, ref := range []string{"HEAD", "refs/heads/main"} {
+		if !exists(t, got, filepath.Join(".git", "logs", ref)) {
+			t.Errorf("reflog expire removed the reflog of %s", ref)
+		}
+	}
+}
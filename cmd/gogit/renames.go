@@ -0,0 +1,240 @@
+package main
+
+import (
+	"path"
+	"sort"
+
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+)
+
+const (
+	// renameMaxScore is the score of identical contents, in the units git
+	// estimates similarity with.
+	renameMaxScore = 60000
+
+	// renameMinScore is the least score a pair of files needs to be taken
+	// for a rename, 50% like the default of git.
+	renameMinScore = renameMaxScore / 2
+
+	// spanHashBase is the modulus of the hashes of the spans of contents
+	// similarity is estimated from.
+	spanHashBase = 107927
+
+	// renameCandidates is the number of best sources git keeps for each
+	// destination.
+	renameCandidates = 4
+)
+
+// detectRenames pairs the deleted and created files of diffs that git
+// would show as renames: first those with the same contents, then those
+// that are similar enough. The rename takes the place of the created file
+// and the deleted file is dropped.
+func detectRenames(diffs []*fileDiff) []*fileDiff {
+	var srcs, dsts []int
+
+	for i, d := range diffs {
+		switch {
+		case d.from.Hash.IsZero() && d.to.Mode != filemode.Submodule:
+			dsts = append(dsts, i)
+		case d.to.Hash.IsZero() && d.from.Mode != filemode.Submodule:
+			srcs = append(srcs, i)
+		}
+	}
+
+	if len(srcs) == 0 || len(dsts) == 0 {
+		return diffs
+	}
+
+	pairs := make(map[int]*fileDiff)
+	used := make(map[int]bool)
+
+	// Exact renames come first, preferring the sources not used yet and
+	// then those with the same base name.
+	for _, di := range dsts {
+		dst, best, bestScore := diffs[di], -1, -1
+
+		for _, si := range srcs {
+			src := diffs[si]
+			if src.from.Hash != dst.to.Hash || fileType(src.from.Mode) != fileType(dst.to.Mode) || used[si] {
+				continue
+			}
+
+			score := 1
+			if path.Base(src.path) == path.Base(dst.path) {
+				score++
+			}
+
+			if score > bestScore {
+				best, bestScore = si, score
+			}
+		}
+
+		if best >= 0 {
+			used[best] = true
+			pairs[di] = renamedDiff(diffs[best], dst, renameMaxScore)
+		}
+	}
+
+	type candidate struct {
+		src, dst, score, nameScore int
+	}
+
+	var candidates []candidate
+
+	spans := make(map[int]map[uint32]int)
+	spansOf := func(i int, data []byte) map[uint32]int {
+		if s, ok := spans[i]; ok {
+			return s
+		}
+
+		spans[i] = hashSpans(data, !diffs[i].binary)
+
+		return spans[i]
+	}
+
+	for _, di := range dsts {
+		dst := diffs[di]
+		if pairs[di] != nil || dst.to.Mode != filemode.Regular && dst.to.Mode != filemode.Executable {
+			continue
+		}
+
+		var best []candidate
+
+		for _, si := range srcs {
+			src := diffs[si]
+			if used[si] || src.from.Mode != filemode.Regular && src.from.Mode != filemode.Executable {
+				continue
+			}
+
+			score := estimateSimilarity(src.old, dst.new, func() (map[uint32]int, map[uint32]int) {
+				return spansOf(si, src.old), spansOf(di, dst.new)
+			})
+			if score < renameMinScore {
+				continue
+			}
+
+			c := candidate{src: si, dst: di, score: score}
+			if path.Base(src.path) == path.Base(dst.path) {
+				c.nameScore = 1
+			}
+
+			best = append(best, c)
+		}
+
+		sort.SliceStable(best, func(i, j int) bool {
+			if best[i].score != best[j].score {
+				return best[i].score > best[j].score
+			}
+
+			return best[i].nameScore > best[j].nameScore
+		})
+
+		candidates = append(candidates, best[:min(len(best), renameCandidates)]...)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+
+		return candidates[i].nameScore > candidates[j].nameScore
+	})
+
+	for _, c := range candidates {
+		if pairs[c.dst] != nil || used[c.src] {
+			continue
+		}
+
+		used[c.src] = true
+		pairs[c.dst] = renamedDiff(diffs[c.src], diffs[c.dst], c.score)
+	}
+
+	var out []*fileDiff
+
+	for i, d := range diffs {
+		switch {
+		case pairs[i] != nil:
+			out = append(out, pairs[i])
+		case !used[i]:
+			out = append(out, d)
+		}
+	}
+
+	return out
+}
+
+// renamedDiff returns the diff of src, a deleted file, renamed to dst, a
+// created one.
+func renamedDiff(src, dst *fileDiff, score int) *fileDiff {
+	d := &fileDiff{
+		path:       dst.path,
+		oldPath:    src.path,
+		similarity: score * 100 / renameMaxScore,
+		from:       src.from,
+		to:         dst.to,
+		old:        src.old,
+		new:        dst.new,
+	}
+
+	d.diffContents()
+
+	return d
+}
+
+// estimateSimilarity returns how much of src is found in dst, the way git
+// estimates it: by the bytes of the spans of src that dst has too, over
+// the size of the larger. spans is only called when the sizes are close
+// enough for the files to be similar.
+func estimateSimilarity(src, dst []byte, spans func() (map[uint32]int, map[uint32]int)) int {
+	maxSize, baseSize := max(len(src), len(dst)), min(len(src), len(dst))
+
+	if maxSize*(renameMaxScore-renameMinScore) < (maxSize-baseSize)*renameMaxScore || len(dst) == 0 {
+		return 0
+	}
+
+	srcSpans, dstSpans := spans()
+
+	copied := 0
+
+	for h, n := range srcSpans {
+		copied += min(n, dstSpans[h])
+	}
+
+	return copied * renameMaxScore / maxSize
+}
+
+// hashSpans returns the bytes of data in spans of each hash, the spans
+// ending at each new line or after 64 bytes. The carriage returns of text
+// line endings are left out.
+func hashSpans(data []byte, text bool) map[uint32]int {
+	spans := make(map[uint32]int)
+
+	var accum1, accum2 uint32
+
+	n := 0
+
+	for i, c := range data {
+		if text && c == '\r' && i+1 < len(data) && data[i+1] == '\n' {
+			continue
+		}
+
+		old1 := accum1
+		accum1 = accum1<<7 ^ accum2>>25
+		accum2 = accum2<<7 ^ old1>>25
+		accum1 += uint32(c)
+
+		n++
+		if n < 64 && c != '\n' {
+			continue
+		}
+
+		spans[(accum1+accum2*0x61)%spanHashBase] += n
+		n, accum1, accum2 = 0, 0, 0
+	}
+
+	if n > 0 {
+		spans[(accum1+accum2*0x61)%spanHashBase] += n
+	}
+
+	return spans
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	formatcfg "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/format/idxfile"
+	"github.com/go-git/go-git/v6/plumbing/transport"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/spf13/cobra"
+)
+
+var (
+	repackAll     bool
+	repackDelete  bool
+	repackNoReuse bool
+	repackWindow  int
+	repackDepth   int
+	repackBitmap  bool
+)
+
+func init() {
+	repackCmd.Flags().BoolVarP(&repackAll, "all", "a", false, "Pack all the reachable objects into a single pack")
+	repackCmd.Flags().BoolVarP(&repackDelete, "delete", "d", false, "Remove the packs and loose objects made redundant")
+	repackCmd.Flags().BoolVarP(&repackNoReuse, "no-reuse-delta", "f", false, "Compute the deltas afresh")
+	repackCmd.Flags().IntVarP(&repackWindow, "window", "", 10, "Number of objects considered as delta bases for each object")
+	repackCmd.Flags().IntVarP(&repackDepth, "depth", "", 50, "Maximum length of delta chains")
+	repackCmd.Flags().BoolVarP(&repackBitmap, "write-bitmap-index", "b", false, "Write a bitmap index")
+	rootCmd.AddCommand(repackCmd)
+}
+
+var repackCmd = &cobra.Command{
+	Use:   "repack [-a] [-d] [-f] [--window=<n>] [--depth=<n>] [-b]",
+	Short: "Pack the unpacked objects of a repository",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		p, err := newRepacker(r, cmd.OutOrStdout())
+		if err != nil {
+			return err
+		}
+
+		if repackBitmap {
+			return errors.New("bitmap indexes are not supported")
+		}
+
+		p.all, p.delete, p.noReuse = repackAll, repackDelete, repackNoReuse
+		p.window, p.depth = repackWindow, repackDepth
+
+		return p.run()
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// repacker packs the reachable objects of a repository, the way repack
+// and gc do.
+type repacker struct {
+	r     *git.Repository
+	store *filesystem.Storage
+	of    formatcfg.ObjectFormat
+	out   io.Writer
+
+	all     bool
+	delete  bool
+	noReuse bool
+	window  int
+	depth   int
+
+	// loosen keeps the unreachable objects of the packs removed with
+	// delete as loose objects, unless their pack was last modified before
+	// expire, as repack -A --unpack-unreachable=<expire> does.
+	loosen bool
+	expire time.Time
+
+	// reachable holds the reachable objects once run has listed them.
+	reachable map[plumbing.Hash]bool
+}
+
+func newRepacker(r *git.Repository, out io.Writer) (*repacker, error) {
+	store, ok := r.Storer.(*filesystem.Storage)
+	if !ok {
+		return nil, errors.New("storer does not implement filesystem.Storage")
+	}
+
+	of, err := packObjectFormat(r, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return &repacker{r: r, store: store, of: of, out: out}, nil
+}
+
+// run packs the reachable objects that are loose or, with all, those not
+// in a kept pack, then removes what the new pack makes redundant with
+// delete.
+func (p *repacker) run() error {
+	indexes, err := readPackIndexes(p.store, p.of)
+	if err != nil {
+		return err
+	}
+
+	kept := p.keptPacks(indexes)
+
+	lines, err := reachableObjects(p.r)
+	if err != nil {
+		return err
+	}
+
+	b := newPackBuilder(p.r, p.window, p.depth)
+	b.noReuse = p.noReuse
+	p.reachable = make(map[plumbing.Hash]bool, len(lines))
+
+	for _, line := range lines {
+		hex, name, _ := strings.Cut(line, " ")
+		h := plumbing.NewHash(hex)
+		p.reachable[h] = true
+
+		if packed(h, indexes, func(pack plumbing.Hash) bool { return !p.all || kept[pack] }) {
+			continue
+		}
+
+		err = b.add(h, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	var pack plumbing.Hash
+
+	if len(b.entries) == 0 {
+		fmt.Fprintln(p.out, "Nothing new to pack.")
+	} else {
+		base := filepath.Join(p.store.Filesystem().Root(), "objects", "pack", "pack")
+
+		pack, err = writePackFile(base, p.of, b.write)
+		if err != nil {
+			return err
+		}
+	}
+
+	if p.delete {
+		if p.all {
+			err = p.removePacks(indexes, kept, pack)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = prunePacked(p.store, p.of)
+		if err != nil {
+			return err
+		}
+	}
+
+	return transport.UpdateServerInfo(p.r.Storer, p.store.Filesystem())
+}
+
+// keptPacks returns the packs marked with a .keep file, which are left
+// alone.
+func (p *repacker) keptPacks(indexes map[plumbing.Hash]*idxfile.MemoryIndex) map[plumbing.Hash]bool {
+	kept := make(map[plumbing.Hash]bool)
+
+	for pack := range indexes {
+		_, err := p.store.Filesystem().Stat(packFilePath(pack, "keep"))
+		if err == nil {
+			kept[pack] = true
+		}
+	}
+
+	return kept
+}
+
+// removePacks removes the packs other than the kept ones and the new pack,
+// first loosening their unreachable objects with loosen.
+func (p *repacker) removePacks(indexes map[plumbing.Hash]*idxfile.MemoryIndex, kept map[plumbing.Hash]bool, pack plumbing.Hash) error {
+	for _, old := range sortedPacks(indexes) {
+		if kept[old] || old == pack {
+			continue
+		}
+
+		if p.loosen {
+			err := p.loosenUnreachable(old, indexes[old])
+			if err != nil {
+				return err
+			}
+		}
+
+		err := removePackFiles(p.store, old)
+		if err != nil {
+			return err
+		}
+
+		// Like git, the multi-pack-index is removed along with the packs
+		// it covers rather than left pointing at them.
+		err = p.store.Filesystem().Remove(multiPackIndexFile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove multi-pack-index: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// removePackFiles removes the pack and its index, reverse index and bitmap.
+func removePackFiles(store *filesystem.Storage, pack plumbing.Hash) error {
+	err := store.DeleteOldObjectPackAndIndex(pack, time.Time{})
+	if err != nil {
+		return fmt.Errorf("failed to remove pack %s: %w", pack, err)
+	}
+
+	for _, ext := range []string{"rev", "bitmap"} {
+		err = store.Filesystem().Remove(packFilePath(pack, ext))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove pack %s: %w", pack, err)
+		}
+	}
+
+	return nil
+}
+
+// loosenUnreachable writes the unreachable objects of the pack as loose
+// objects, dated like the pack so that prune expires them in turn.
+func (p *repacker) loosenUnreachable(pack plumbing.Hash, idx *idxfile.MemoryIndex) error {
+	fs := p.store.Filesystem()
+
+	fi, err := fs.Stat(packFilePath(pack, "pack"))
+	if err != nil {
+		return fmt.Errorf("failed to stat pack %s: %w", pack, err)
+	}
+
+	if !p.expire.IsZero() && fi.ModTime().Before(p.expire) {
+		return nil
+	}
+
+	hashes, err := indexHashes(idx)
+	if err != nil {
+		return err
+	}
+
+	for _, h := range hashes {
+		if p.reachable[h] {
+			continue
+		}
+
+		if _, err := p.store.LooseObjectTime(h); err == nil {
+			continue
+		}
+
+		obj, err := p.store.EncodedObject(plumbing.AnyObject, h)
+		if err != nil {
+			return fmt.Errorf("failed to read object %s: %w", h, err)
+		}
+
+		_, err = p.store.SetEncodedObject(obj)
+		if err != nil {
+			return fmt.Errorf("failed to write object %s: %w", h, err)
+		}
+
+		if ch, ok := fs.(billy.Change); ok {
+			hex := h.String()
+
+			err = ch.Chtimes(path.Join("objects", hex[:2], hex[2:]), fi.ModTime(), fi.ModTime())
+			if err != nil {
+				return fmt.Errorf("failed to date object %s: %w", h, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// packed reports whether h is in one of the packs accepted by include.
+func packed(h plumbing.Hash, indexes map[plumbing.Hash]*idxfile.MemoryIndex, include func(pack plumbing.Hash) bool) bool {
+	for pack, idx := range indexes {
+		if !include(pack) {
+			continue
+		}
+
+		if ok, _ := idx.Contains(h); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// packFilePath returns the path of the file of the pack with extension ext,
+// relative to the git directory.
+func packFilePath(pack plumbing.Hash, ext string) string {
+	return path.Join("objects", "pack", fmt.Sprintf("pack-%s.%s", pack, ext))
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRepack(t *testing.T) {
+	for _, args := range []string{"", "-d", "-a -d", "-a -d -f --window=5 --depth=3"} {
+		t.Run(args, func(t *testing.T) {
+			var states []string
+
+			for _, tool := range []string{"git", "gogit"} {
+				dir := gcRepo(t)
+
+				a := append([]string{"repack"}, strings.Fields(args)...)
+				if tool == "git" {
+					gitCmd(t, dir, append(a, "-q")...)
+				} else {
+					mustGogit(t, dir, a...)
+				}
+
+				for _, idx := range globPacks(t, dir, "*.idx") {
+					gitCmd(t, dir, "verify-pack", idx)
+				}
+
+				states = append(states, storeState(t, dir))
+			}
+
+			if states[1] != states[0] {
+				t.Errorf("gogit repack %s left:\n%s\nwant, as git:\n%s", args, states[1], states[0])
+			}
+		})
+	}
+}
+
+func TestRepackNothingNew(t *testing.T) {
+	dir := gitRepo(t, []string{"a", "1"})
+	gitCmd(t, dir, "repack", "-q", "-a", "-d")
+
+	if got := mustGogit(t, dir, "repack"); got != "Nothing new to pack.\n" {
+		t.Errorf("gogit repack printed %q", got)
+	}
+}
+
+// TestRepackBitmap checks that, as go-git cannot write bitmap indexes,
+// repack -b fails before it changes anything.
+func TestRepackBitmap(t *testing.T) {
+	dir := gcRepo(t)
+	before := storeState(t, dir)
+
+	res := gogit(t, dir, "repack", "-a", "-d", "-b")
+	if res.code == 0 || !strings.Contains(res.stderr, "bitmap indexes are not supported") {
+		t.Errorf("gogit repack -b exited with %d: %s", res.code, res.stderr)
+	}
+
+	if after := storeState(t, dir); after != before {
+		t.Errorf("gogit repack -b left:\n%s\nwant:\n%s", after, before)
+	}
+}
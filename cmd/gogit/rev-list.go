@@ -0,0 +1,576 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/spf13/cobra"
+)
+
+var (
+	revListCount     bool
+	revListObjects   bool
+	revListAll       bool
+	revListMaxCount  int
+	revListLeftRight bool
+	revListBoundary  bool
+	revListNoMerges  bool
+)
+
+func init() {
+	revListCmd.Flags().BoolVarP(&revListCount, "count", "", false, "Print the number of commits instead of listing them")
+	revListCmd.Flags().BoolVarP(&revListObjects, "objects", "", false, "Also list the trees and blobs the commits reference")
+	revListCmd.Flags().BoolVarP(&revListAll, "all", "", false, "Start from all references and HEAD")
+	revListCmd.Flags().IntVarP(&revListMaxCount, "max-count", "n", -1, "Limit the number of commits listed")
+	revListCmd.Flags().BoolVarP(&revListLeftRight, "left-right", "", false, "Mark which side of a symmetric range commits are on")
+	revListCmd.Flags().BoolVarP(&revListBoundary, "boundary", "", false, "Also list the excluded parents of the listed commits")
+	revListCmd.Flags().BoolVarP(&revListNoMerges, "no-merges", "", false, "Do not list merge commits")
+	rootCmd.AddCommand(revListCmd)
+}
+
+var revListCmd = &cobra.Command{
+	Use:   "rev-list [--count] [--objects] [--all] [-n <n>] [--left-right] [--boundary] [--no-merges] <commit>...",
+	Short: "List commits in reverse chronological order",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		w := &revWalk{r: r}
+
+		if revListAll {
+			err = w.addAll()
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, arg := range args {
+			err = w.addArg(arg)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(w.tips) == 0 && !revListAll {
+			return cmd.Usage()
+		}
+
+		commits, boundary, err := w.walk()
+		if err != nil {
+			return err
+		}
+
+		var objects []string
+
+		if revListObjects {
+			objects, err = w.objects(commits, boundary)
+			if err != nil {
+				return err
+			}
+		}
+
+		out := cmd.OutOrStdout()
+
+		if revListCount {
+			printRevListCount(out, w, commits, len(objects))
+
+			return nil
+		}
+
+		for _, c := range commits {
+			fmt.Fprintf(out, "%s%s\n", w.mark(c.Hash), c.Hash)
+		}
+
+		if revListBoundary {
+			for _, c := range boundary {
+				fmt.Fprintf(out, "-%s\n", c.Hash)
+			}
+		}
+
+		for _, line := range objects {
+			fmt.Fprintln(out, line)
+		}
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+func printRevListCount(out io.Writer, w *revWalk, commits []*object.Commit, objects int) {
+	if !revListLeftRight {
+		fmt.Fprintln(out, len(commits)+objects)
+
+		return
+	}
+
+	left := 0
+
+	for _, c := range commits {
+		if w.left[c.Hash] {
+			left++
+		}
+	}
+
+	fmt.Fprintf(out, "%d\t%d\n", left, len(commits)-left)
+}
+
+// revTip is an object a walk starts from, with the name objects reached
+// through it are listed under.
+type revTip struct {
+	hash plumbing.Hash
+	name string
+	left bool
+}
+
+// revWalk lists the commits reachable from its tips but not from its
+// negative commits, newest first, the way git rev-list does.
+type revWalk struct {
+	r         *git.Repository
+	tips      []revTip
+	negatives []plumbing.Hash
+
+	// uninteresting holds the commits reachable from the negatives, and
+	// left those reachable from the left side of a symmetric range.
+	uninteresting map[plumbing.Hash]bool
+	left          map[plumbing.Hash]bool
+}
+
+// addAll starts the walk from every reference and HEAD.
+func (w *revWalk) addAll() error {
+	refs, err := sortedReferences(w.r)
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		w.tips = append(w.tips, revTip{hash: ref.Hash(), name: ref.Name().String()})
+	}
+
+	if head, err := w.r.Head(); err == nil {
+		w.tips = append(w.tips, revTip{hash: head.Hash(), name: plumbing.HEAD.String()})
+	}
+
+	return nil
+}
+
+// addArg adds a revision argument: a commit, ^<commit>, a <from>..<to> or
+// <left>...<right> range, <commit>^@ for its parents or <commit>^! for the
+// commit without its parents.
+func (w *revWalk) addArg(arg string) error {
+	if from, to, ok := strings.Cut(arg, "..."); ok {
+		return w.addSymmetricRange(from, to)
+	}
+
+	if from, to, ok := strings.Cut(arg, ".."); ok {
+		h, err := w.resolveCommit(from)
+		if err != nil {
+			return err
+		}
+
+		w.negatives = append(w.negatives, h)
+
+		return w.addTip(to)
+	}
+
+	if rev, ok := strings.CutPrefix(arg, "^"); ok {
+		h, err := w.resolveCommit(rev)
+		if err != nil {
+			return err
+		}
+
+		w.negatives = append(w.negatives, h)
+
+		return nil
+	}
+
+	if rev, ok := strings.CutSuffix(arg, "^@"); ok {
+		parents, err := w.parents(rev)
+		if err != nil {
+			return err
+		}
+
+		for _, p := range parents {
+			w.tips = append(w.tips, revTip{hash: p, name: arg})
+		}
+
+		return nil
+	}
+
+	if rev, ok := strings.CutSuffix(arg, "^!"); ok {
+		parents, err := w.parents(rev)
+		if err != nil {
+			return err
+		}
+
+		w.negatives = append(w.negatives, parents...)
+
+		return w.addTip(rev)
+	}
+
+	return w.addTip(arg)
+}
+
+func (w *revWalk) addSymmetricRange(from, to string) error {
+	left, err := w.resolveCommit(from)
+	if err != nil {
+		return err
+	}
+
+	right, err := w.resolveCommit(to)
+	if err != nil {
+		return err
+	}
+
+	lc, err := w.r.CommitObject(left)
+	if err != nil {
+		return err
+	}
+
+	rc, err := w.r.CommitObject(right)
+	if err != nil {
+		return err
+	}
+
+	bases, err := lc.MergeBase(rc)
+	if err != nil {
+		return fmt.Errorf("failed to find merge base: %w", err)
+	}
+
+	for _, b := range bases {
+		w.negatives = append(w.negatives, b.Hash)
+	}
+
+	w.tips = append(w.tips, revTip{hash: left, name: from, left: true}, revTip{hash: right, name: to})
+
+	return nil
+}
+
+// addTip starts the walk from rev, or HEAD when rev is empty.
+func (w *revWalk) addTip(rev string) error {
+	if rev == "" {
+		rev = plumbing.HEAD.String()
+	}
+
+	h, err := resolveObject(w.r, rev)
+	if err != nil {
+		return fmt.Errorf("bad revision '%s': %w", rev, err)
+	}
+
+	w.tips = append(w.tips, revTip{hash: h, name: rev})
+
+	return nil
+}
+
+func (w *revWalk) resolveCommit(rev string) (plumbing.Hash, error) {
+	if rev == "" {
+		rev = plumbing.HEAD.String()
+	}
+
+	h, err := resolveRevision(w.r, rev)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("bad revision '%s': %w", rev, err)
+	}
+
+	return h, nil
+}
+
+func (w *revWalk) parents(rev string) ([]plumbing.Hash, error) {
+	h, err := w.resolveCommit(rev)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := w.r.CommitObject(h)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.ParentHashes, nil
+}
+
+// reachable returns the commits reachable from hashes, stopping at the
+// commits in stop.
+func (w *revWalk) reachable(hashes []plumbing.Hash, stop map[plumbing.Hash]bool) map[plumbing.Hash]bool {
+	nodes := commitNodeIndex(w.r)
+	seen := make(map[plumbing.Hash]bool)
+	pending := append([]plumbing.Hash(nil), hashes...)
+
+	for len(pending) > 0 {
+		h := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		if seen[h] || stop[h] {
+			continue
+		}
+
+		n, err := nodes.Get(h)
+		if err != nil {
+			continue
+		}
+
+		seen[h] = true
+		pending = append(pending, n.ParentHashes()...)
+	}
+
+	return seen
+}
+
+// walk returns the commits to list, and the boundary commits: the parents
+// of listed commits that are not listed themselves.
+func (w *revWalk) walk() ([]*object.Commit, []*object.Commit, error) {
+	w.uninteresting = w.reachable(w.negatives, nil)
+
+	var left []plumbing.Hash
+
+	q := newCommitQueue(w.r)
+
+	for _, tip := range w.tips {
+		h, err := peelObject(w.r, tip.hash, tip.name, plumbing.CommitObject.String())
+		if err != nil {
+			// Trees and blobs are only listed with --objects.
+			continue
+		}
+
+		if tip.left {
+			left = append(left, h)
+		}
+
+		if !w.uninteresting[h] {
+			q.add(h)
+		}
+	}
+
+	w.left = w.reachable(left, w.uninteresting)
+
+	var (
+		commits []*object.Commit
+		parents []plumbing.Hash
+		shown   = make(map[plumbing.Hash]bool)
+	)
+
+	for revListMaxCount < 0 || len(commits) < revListMaxCount {
+		n := q.next()
+		if n == nil {
+			break
+		}
+
+		for _, p := range n.ParentHashes() {
+			if !w.uninteresting[p] {
+				q.add(p)
+			}
+		}
+
+		if revListNoMerges && n.NumParents() > 1 {
+			continue
+		}
+
+		c, err := n.Commit()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		commits = append(commits, c)
+		shown[c.Hash] = true
+		parents = append(parents, c.ParentHashes...)
+	}
+
+	// Like git, the boundary is listed in the reverse of the order it was
+	// found in.
+	var boundary []*object.Commit
+
+	seen := make(map[plumbing.Hash]bool)
+
+	for _, p := range parents {
+		if shown[p] || seen[p] {
+			continue
+		}
+
+		seen[p] = true
+
+		c, err := w.r.CommitObject(p)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		boundary = append([]*object.Commit{c}, boundary...)
+	}
+
+	return commits, boundary, nil
+}
+
+// mark returns the --left-right marker of the commit h.
+func (w *revWalk) mark(h plumbing.Hash) string {
+	switch {
+	case !revListLeftRight:
+		return ""
+	case w.left[h]:
+		return "<"
+	default:
+		return ">"
+	}
+}
+
+// objects returns the "<id> <path>" lines of the tags, trees and blobs
+// reachable from the tips and the listed commits, leaving out those
+// reachable from the negative and boundary commits.
+func (w *revWalk) objects(commits, boundary []*object.Commit) ([]string, error) {
+	ow := &objectWalk{r: w.r, seen: make(map[plumbing.Hash]bool)}
+
+	excluded := append([]plumbing.Hash(nil), w.negatives...)
+	for _, c := range boundary {
+		if w.uninteresting[c.Hash] {
+			excluded = append(excluded, c.Hash)
+		}
+	}
+
+	for _, h := range excluded {
+		c, err := w.r.CommitObject(h)
+		if err != nil {
+			continue
+		}
+
+		err = ow.markTree(c.TreeHash)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, tip := range w.tips {
+		err := ow.addTip(tip)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, c := range commits {
+		err := ow.addTree(c.TreeHash, "")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ow.lines, nil
+}
+
+// objectWalk collects the objects of rev-list --objects, each once.
+type objectWalk struct {
+	r     *git.Repository
+	seen  map[plumbing.Hash]bool
+	lines []string
+}
+
+// addTip lists the tag, tree or blob a tip names, following tags.
+func (ow *objectWalk) addTip(tip revTip) error {
+	h, name := tip.hash, ""
+
+	// Trees and blobs named by <rev>:<path> are listed under their path.
+	if i := revisionIndex(tip.name, ":"); i >= 0 {
+		name = strings.Trim(tip.name[i+1:], "/")
+	}
+
+	for {
+		obj, err := ow.r.Storer.EncodedObject(plumbing.AnyObject, h)
+		if err != nil {
+			return fmt.Errorf("bad object %s: %w", h, err)
+		}
+
+		switch obj.Type() {
+		case plumbing.TagObject:
+			tag, err := object.DecodeTag(ow.r.Storer, obj)
+			if err != nil {
+				return err
+			}
+
+			ow.add(h, strings.TrimPrefix(tip.name, "refs/tags/"))
+			h = tag.Target
+		case plumbing.TreeObject:
+			return ow.addTree(h, name)
+		case plumbing.BlobObject:
+			ow.add(h, name)
+
+			return nil
+		default:
+			return nil
+		}
+	}
+}
+
+func (ow *objectWalk) add(h plumbing.Hash, name string) {
+	if ow.seen[h] {
+		return
+	}
+
+	ow.seen[h] = true
+	ow.lines = append(ow.lines, fmt.Sprintf("%s %s", h, name))
+}
+
+// addTree lists the tree h at path and, depth first, the objects in it.
+func (ow *objectWalk) addTree(h plumbing.Hash, path string) error {
+	if ow.seen[h] {
+		return nil
+	}
+
+	ow.add(h, path)
+
+	tree, err := ow.r.TreeObject(h)
+	if err != nil {
+		return fmt.Errorf("bad tree %s: %w", h, err)
+	}
+
+	for _, e := range tree.Entries {
+		p := e.Name
+		if path != "" {
+			p = path + "/" + e.Name
+		}
+
+		switch e.Mode {
+		case filemode.Submodule:
+		case filemode.Dir:
+			err = ow.addTree(e.Hash, p)
+			if err != nil {
+				return err
+			}
+		default:
+			ow.add(e.Hash, p)
+		}
+	}
+
+	return nil
+}
+
+// markTree marks the tree h and the objects in it as seen, so that they
+// are not listed.
+func (ow *objectWalk) markTree(h plumbing.Hash) error {
+	if ow.seen[h] {
+		return nil
+	}
+
+	ow.seen[h] = true
+
+	tree, err := ow.r.TreeObject(h)
+	if err != nil {
+		return fmt.Errorf("bad tree %s: %w", h, err)
+	}
+
+	for _, e := range tree.Entries {
+		switch e.Mode {
+		case filemode.Submodule:
+		case filemode.Dir:
+			err = ow.markTree(e.Hash)
+			if err != nil {
+				return err
+			}
+		default:
+			ow.seen[e.Hash] = true
+		}
+	}
+
+	return nil
+}
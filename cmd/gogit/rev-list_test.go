@@ -0,0 +1,35 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRevList(t *testing.T) {
+	dir := revRepo(t)
+
+	for _, args := range []string{
+		"HEAD",
+		"--all",
+		"main ^topic",
+		"topic..main",
+		"main...topic",
+		"--left-right main...topic",
+		"--left-right topic...main~1",
+		"--boundary main~1..main",
+		"--boundary --left-right main~2...topic",
+		"--no-merges HEAD",
+		"--count HEAD",
+		"--count main..topic",
+		"--count --all",
+		"-n 2 HEAD",
+		"--max-count=3 --no-merges --all",
+		"--objects HEAD~1..HEAD",
+		"--objects v1",
+		"--objects --all",
+	} {
+		t.Run(args, func(t *testing.T) {
+			sameOutput(t, dir, append([]string{"rev-list"}, strings.Fields(args)...)...)
+		})
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/spf13/cobra"
+)
+
+var (
+	revParseVerify           bool
+	revParseQuiet            bool
+	revParseShort            int
+	revParseAbbrevRef        bool
+	revParseSymbolicFullName bool
+	revParseShowToplevel     bool
+	revParseGitDir           bool
+	revParseIsInsideWorkTree bool
+)
+
+func init() {
+	revParseCmd.Flags().BoolVarP(&revParseVerify, "verify", "", false, "Require exactly one valid revision")
+	revParseCmd.Flags().BoolVarP(&revParseQuiet, "quiet", "q", false, "With --verify, exit with non-zero status instead of printing an error")
+	revParseCmd.Flags().IntVarP(&revParseShort, "short", "", 0, "Abbreviate object names to at least <n> digits")
+	revParseCmd.Flags().BoolVarP(&revParseAbbrevRef, "abbrev-ref", "", false, "Print the short name of the references named")
+	revParseCmd.Flags().BoolVarP(&revParseSymbolicFullName, "symbolic-full-name", "", false, "Print the full name of the references named")
+	revParseCmd.Flags().BoolVarP(&revParseShowToplevel, "show-toplevel", "", false, "Print the top-level directory of the working tree")
+	revParseCmd.Flags().BoolVarP(&revParseGitDir, "git-dir", "", false, "Print the path of the repository directory")
+	revParseCmd.Flags().BoolVarP(&revParseIsInsideWorkTree, "is-inside-work-tree", "", false, "Print whether the current directory is inside a working tree")
+	revParseCmd.Flags().Lookup("short").NoOptDefVal = "7"
+	rootCmd.AddCommand(revParseCmd)
+}
+
+var revParseCmd = &cobra.Command{
+	Use:   "rev-parse [--verify [-q]] [--short[=<n>]] [--abbrev-ref | --symbolic-full-name] [--show-toplevel] [--git-dir] [--is-inside-work-tree] [<rev>...]",
+	Short: "Resolve revisions to object names",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := git.PlainOpenWithOptions(".", &git.PlainOpenOptions{DetectDotGit: true})
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+
+		err = printRepositoryPaths(out, r)
+		if err != nil {
+			return err
+		}
+
+		p := &revParser{r: r, out: out}
+
+		if revParseVerify {
+			h, err := resolveObject(r, strings.Join(args, " "))
+			if err != nil || len(args) != 1 {
+				if revParseQuiet {
+					cmd.SilenceErrors = true
+					cmd.SilenceUsage = true
+
+					return exitStatus(1)
+				}
+
+				return errors.New("needed a single revision")
+			}
+
+			p.print("", args[0], h)
+
+			return nil
+		}
+
+		for _, arg := range args {
+			err = p.parse(arg)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// printRepositoryPaths prints the answers to --git-dir, --show-toplevel and
+// --is-inside-work-tree.
+func printRepositoryPaths(out io.Writer, r *git.Repository) error {
+	if !revParseGitDir && !revParseShowToplevel && !revParseIsInsideWorkTree {
+		return nil
+	}
+
+	store, ok := r.Storer.(*filesystem.Storage)
+	if !ok {
+		return errors.New("storer does not implement filesystem.Storage")
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	wt, err := r.Worktree()
+	if err != nil && !errors.Is(err, git.ErrIsBareRepository) {
+		return err
+	}
+
+	dir, err := filepath.Abs(store.Filesystem().Root())
+	if err != nil {
+		return err
+	}
+
+	if revParseGitDir {
+		// Like git, the repository directory is given relative to the
+		// current directory only when it is the current directory or its
+		// .git subdirectory.
+		gitDir := dir
+		if rel, err := filepath.Rel(cwd, dir); err == nil && (rel == "." || rel == git.GitDirName) {
+			gitDir = rel
+		}
+
+		fmt.Fprintln(out, gitDir)
+	}
+
+	if revParseShowToplevel {
+		if wt == nil {
+			return errors.New("this operation must be run in a work tree")
+		}
+
+		fmt.Fprintln(out, wt.Filesystem.Root())
+	}
+
+	if revParseIsInsideWorkTree {
+		fmt.Fprintln(out, wt != nil && !isWithin(cwd, dir))
+	}
+
+	return nil
+}
+
+// isWithin returns whether path is dir or one of its subdirectories.
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// revParser prints the object names, or reference names, of the revisions
+// given to rev-parse.
+type revParser struct {
+	r   *git.Repository
+	out io.Writer
+}
+
+// parse prints the revisions arg stands for: a revision, ^<rev>, a
+// <from>..<to> or <left>...<right> range, <rev>^@ or <rev>^!.
+func (p *revParser) parse(arg string) error {
+	if left, right, ok := strings.Cut(arg, "..."); ok {
+		return p.parseSymmetricRange(left, right)
+	}
+
+	if from, to, ok := strings.Cut(arg, ".."); ok {
+		err := p.parseRev("", defaultRev(to))
+		if err == nil {
+			err = p.parseRev("^", defaultRev(from))
+		}
+
+		return err
+	}
+
+	if rev, ok := strings.CutPrefix(arg, "^"); ok {
+		return p.parseRev("^", rev)
+	}
+
+	if rev, ok := strings.CutSuffix(arg, "^@"); ok {
+		return p.parseParents("", rev)
+	}
+
+	if rev, ok := strings.CutSuffix(arg, "^!"); ok {
+		err := p.parseRev("", rev)
+		if err == nil {
+			err = p.parseParents("^", rev)
+		}
+
+		return err
+	}
+
+	return p.parseRev("", arg)
+}
+
+func (p *revParser) parseSymmetricRange(left, right string) error {
+	left, right = defaultRev(left), defaultRev(right)
+
+	lh, err := p.resolve(left)
+	if err != nil {
+		return err
+	}
+
+	rh, err := p.resolve(right)
+	if err != nil {
+		return err
+	}
+
+	lc, err := resolveCommitObject(p.r, left, lh)
+	if err != nil {
+		return err
+	}
+
+	rc, err := resolveCommitObject(p.r, right, rh)
+	if err != nil {
+		return err
+	}
+
+	bases, err := lc.MergeBase(rc)
+	if err != nil {
+		return fmt.Errorf("failed to find merge base: %w", err)
+	}
+
+	p.print("", right, rh)
+	p.print("", left, lh)
+
+	for _, b := range bases {
+		p.print("^", b.Hash.String(), b.Hash)
+	}
+
+	return nil
+}
+
+func (p *revParser) parseParents(prefix, rev string) error {
+	h, err := p.resolve(rev)
+	if err != nil {
+		return err
+	}
+
+	c, err := resolveCommitObject(p.r, rev, h)
+	if err != nil {
+		return err
+	}
+
+	for _, parent := range c.ParentHashes {
+		p.print(prefix, parent.String(), parent)
+	}
+
+	return nil
+}
+
+func (p *revParser) parseRev(prefix, rev string) error {
+	h, err := p.resolve(rev)
+	if err != nil {
+		return err
+	}
+
+	p.print(prefix, rev, h)
+
+	return nil
+}
+
+func (p *revParser) resolve(rev string) (plumbing.Hash, error) {
+	h, err := resolveObject(p.r, rev)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("ambiguous argument '%s': unknown revision or path not in the working tree", rev)
+	}
+
+	return h, nil
+}
+
+// print prints the object name h of rev, or with --abbrev-ref and
+// --symbolic-full-name the name of the reference rev names, if any.
+func (p *revParser) print(prefix, rev string, h plumbing.Hash) {
+	if revParseAbbrevRef || revParseSymbolicFullName {
+		name, ok := resolveRefName(p.r, rev)
+		if !ok {
+			return
+		}
+
+		s := name.String()
+		if revParseAbbrevRef {
+			s = name.Short()
+		}
+
+		fmt.Fprintf(p.out, "%s%s\n", prefix, s)
+
+		return
+	}
+
+	s := h.String()
+	if revParseShort > 0 {
+		s = abbreviateHash(p.r, h, revParseShort)
+	}
+
+	fmt.Fprintf(p.out, "%s%s\n", prefix, s)
+}
+
+// resolveCommitObject returns the commit rev, resolved to h, peels to.
+func resolveCommitObject(r *git.Repository, rev string, h plumbing.Hash) (*object.Commit, error) {
+	h, err := peelObject(r, h, rev, plumbing.CommitObject.String())
+	if err != nil {
+		return nil, err
+	}
+
+	return r.CommitObject(h)
+}
+
+// defaultRev returns rev, or HEAD for the empty side of a range.
+func defaultRev(rev string) string {
+	if rev == "" {
+		return plumbing.HEAD.String()
+	}
+
+	return rev
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// commitAt commits the changes to the index of dir at the given second,
+// so that the history has distinct dates.
+func commitAt(t *testing.T, dir string, second int, args ...string) {
+	t.Helper()
+
+	date := fmt.Sprintf("GIT_COMMITTER_DATE=%d +0000", 1700000000+second)
+
+	res := run(t, dir, "", "env", append([]string{date, "git", "commit", "-q", "--allow-empty"}, args...)...)
+	if res.code != 0 {
+		t.Fatalf("git commit %v failed: %s", args, res.stderr)
+	}
+}
+
+// revRepo returns a repository made by git with a merged branch, tags, an
+// upstream branch and a reflog.
+func revRepo(t *testing.T) string {
+	t.Helper()
+
+	dir := gitRepo(t)
+
+	for i, msg := range []string{"root", "second", "third"} {
+		writeFile(t, dir, "a", msg)
+		gitCmd(t, dir, "add", "a")
+		commitAt(t, dir, i, "-m", msg)
+	}
+
+	gitCmd(t, dir, "tag", "-a", "-m", "v1", "v1", "HEAD~1")
+	gitCmd(t, dir, "checkout", "-q", "-b", "topic", "HEAD~2")
+
+	for i, msg := range []string{"topic one", "topic two"} {
+		writeFile(t, dir, "d/t", msg)
+		gitCmd(t, dir, "add", "d/t")
+		commitAt(t, dir, 10+i, "-m", msg)
+	}
+
+	gitCmd(t, dir, "checkout", "-q", "main")
+	gitCmd(t, dir, "merge", "-q", "--no-commit", "topic")
+	commitAt(t, dir, 20, "-m", "merge topic")
+
+	writeFile(t, dir, "a", "after")
+	gitCmd(t, dir, "add", "a")
+	commitAt(t, dir, 30, "-m", "after merge")
+
+	gitCmd(t, dir, "branch", "--set-upstream-to=topic")
+
+	return dir
+}
+
+func TestRevParse(t *testing.T) {
+	dir := revRepo(t)
+
+	for _, args := range []string{
+		"HEAD",
+		"HEAD~2 HEAD~1^2 HEAD~1^2~1 HEAD^^2^",
+		"HEAD^{tree} HEAD:a HEAD:d/t",
+		"v1 v1^{} v1^{commit} v1^{tree}",
+		":/topic :/^root",
+		"@{upstream} main@{u} @{1} main@{2}",
+		"--verify HEAD^0",
+		"--short HEAD",
+		"--short=10 HEAD~1",
+		"--abbrev-ref HEAD @{u}",
+		"--symbolic-full-name HEAD @{u} topic",
+		"--git-dir",
+		"--show-toplevel",
+		"--is-inside-work-tree",
+		"main..topic",
+		"topic...main",
+		"^HEAD~1 HEAD",
+	} {
+		t.Run(args, func(t *testing.T) {
+			sameOutput(t, dir, append([]string{"rev-parse"}, strings.Fields(args)...)...)
+		})
+	}
+
+	sub := filepath.Join(dir, "d")
+	for _, args := range []string{"--git-dir", "--show-toplevel", "--is-inside-work-tree", "HEAD:./t"} {
+		sameOutput(t, sub, "rev-parse", args)
+	}
+
+	sameOutput(t, filepath.Join(dir, ".git"), "rev-parse", "--is-inside-work-tree")
+}
+
+func TestRevParseInvalid(t *testing.T) {
+	dir := revRepo(t)
+
+	for _, args := range [][]string{
+		{"rev-parse", "--verify", "nope"},
+		{"rev-parse", "--verify", "-q", "nope"},
+		{"rev-parse", "--verify", "HEAD", "HEAD~1"},
+		{"rev-parse", "HEAD~10"},
+		{"rev-parse", "HEAD^3"},
+		{"rev-parse", "HEAD:nope"},
+		{"rev-parse", ":/no such message"},
+		{"rev-parse", "main@{9}"},
+	} {
+		if res := run(t, dir, "", "git", args...); res.code == 0 {
+			t.Fatalf("git %v succeeded", args)
+		}
+
+		res := gogit(t, dir, args...)
+		if res.code == 0 {
+			t.Errorf("gogit %v succeeded and printed %q", args, res.stdout)
+		}
+
+		if slices.Contains(args, "-q") && res.stderr != "" {
+			t.Errorf("gogit %v wrote %q", args, res.stderr)
+		}
+	}
+}
@@ -0,0 +1,863 @@
+package main
+
+import (
+	"container/heap"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"weak"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	formatgraph "github.com/go-git/go-git/v6/plumbing/format/commitgraph"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/plumbing/object/commitgraph"
+)
+
+// errAmbiguousObject is returned when a short object id matches more than
+// one object.
+var errAmbiguousObject = errors.New("ambiguous object name")
+
+// resolveObject resolves rev, in git's revision syntax, to an object id.
+// Unlike Repository.ResolveRevision, object ids and their prefixes are
+// accepted for any type, tags are only peeled when asked to, and the
+// reflog, upstream, message search, tree and index path forms are
+// understood. Like git, a full object id is returned whether or not the
+// object exists.
+func resolveObject(r *git.Repository, rev string) (plumbing.Hash, error) {
+	switch {
+	case strings.HasPrefix(rev, ":/"):
+		return searchCommitMessage(r, nil, rev[2:])
+	case strings.HasPrefix(rev, ":"):
+		return resolveIndexPath(r, rev[1:])
+	}
+
+	if i := revisionIndex(rev, ":"); i > 0 {
+		return resolveTreePath(r, rev[:i], relativeRevisionPath(r, rev[i+1:]))
+	}
+
+	base, suffix := rev, ""
+	if i := revisionIndex(rev, "^~"); i >= 0 {
+		base, suffix = rev[:i], rev[i:]
+	}
+
+	h, err := resolveRevisionBase(r, base)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	for suffix != "" {
+		h, suffix, err = applyRevisionSuffix(r, h, rev, suffix)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+
+	return h, nil
+}
+
+// resolveRevision resolves rev to a commit, peeling tags, like
+// Repository.ResolveRevision does but with the full revision syntax.
+func resolveRevision(r *git.Repository, rev string) (plumbing.Hash, error) {
+	return resolvePeeled(r, rev, plumbing.CommitObject.String())
+}
+
+// revisionIndex returns the index of the first of chars in rev that is not
+// within the braces of a @{...} or ^{...} part, or -1.
+func revisionIndex(rev, chars string) int {
+	depth := 0
+
+	for i, c := range rev {
+		switch {
+		case c == '{':
+			depth++
+		case c == '}' && depth > 0:
+			depth--
+		case depth == 0 && strings.ContainsRune(chars, c):
+			return i
+		}
+	}
+
+	return -1
+}
+
+// resolveRevisionBase resolves the part of a revision before any ^ or ~
+// suffix: an object id or its prefix, a reference name, or a @{...}
+// selector on a reference.
+func resolveRevisionBase(r *git.Repository, base string) (plumbing.Hash, error) {
+	if i := strings.Index(base, "@{"); i >= 0 && strings.HasSuffix(base, "}") {
+		return resolveAtSelector(r, base[:i], base[i+2:len(base)-1])
+	}
+
+	if base == "@" {
+		base = plumbing.HEAD.String()
+	}
+
+	if h, ok := plumbing.FromHex(base); ok && len(base) == h.HexSize() {
+		return h, nil
+	}
+
+	if name, err := expandRefName(r, base); err == nil {
+		if ref, err := r.Reference(name, true); err == nil {
+			return ref.Hash(), nil
+		}
+	}
+
+	hashes := objectsWithPrefix(r, base)
+
+	switch len(hashes) {
+	case 0:
+		return plumbing.ZeroHash, fmt.Errorf("%w: %s", plumbing.ErrReferenceNotFound, base)
+	case 1:
+		return hashes[0], nil
+	default:
+		return plumbing.ZeroHash, fmt.Errorf("%w: %s", errAmbiguousObject, base)
+	}
+}
+
+// resolveAtSelector resolves <ref>@{<sel>}, where sel is a reflog entry
+// number or date, "upstream" or "u", or -<n> for the nth branch checked
+// out before the current one.
+func resolveAtSelector(r *git.Repository, ref, sel string) (plumbing.Hash, error) {
+	if n, ok := strings.CutPrefix(sel, "-"); ok && ref == "" {
+		branch, err := previousBranch(r, n)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		return resolveRevisionBase(r, branch)
+	}
+
+	if isUpstreamSelector(sel) {
+		name, err := refUpstream(r, ref)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		target, err := r.Reference(name, true)
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("upstream branch '%s' not stored as a remote-tracking branch", name)
+		}
+
+		return target.Hash(), nil
+	}
+
+	name, err := reflogRefName(r, ref)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return reflogValue(r, name, sel)
+}
+
+func isUpstreamSelector(sel string) bool {
+	return strings.EqualFold(sel, "u") || strings.EqualFold(sel, "upstream")
+}
+
+// previousBranch returns the branch, or commit, checked out n checkouts
+// before the current one according to the reflog of HEAD.
+func previousBranch(r *git.Repository, n string) (string, error) {
+	nth, err := strconv.Atoi(n)
+	if err != nil || nth <= 0 {
+		return "", fmt.Errorf("invalid previous branch selector @{-%s}", n)
+	}
+
+	rs, err := reflogStorer(r)
+	if err != nil {
+		return "", err
+	}
+
+	entries, err := rs.Reflog(plumbing.HEAD)
+	if err != nil {
+		return "", fmt.Errorf("failed to read reflog of HEAD: %w", err)
+	}
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		moving, ok := strings.CutPrefix(entries[i].Message, "checkout: moving from ")
+		if !ok {
+			continue
+		}
+
+		from, _, ok := strings.Cut(moving, " to ")
+		if !ok {
+			continue
+		}
+
+		nth--
+		if nth == 0 {
+			return from, nil
+		}
+	}
+
+	return "", fmt.Errorf("only %s checkouts back is not possible, not enough checkouts in the reflog", n)
+}
+
+// currentBranch returns the branch HEAD points at, failing when it is
+// detached.
+func currentBranch(r *git.Repository) (plumbing.ReferenceName, error) {
+	head, err := r.Storer.Reference(plumbing.HEAD)
+	if err != nil || head.Type() != plumbing.SymbolicReference {
+		return "", errors.New("HEAD does not point to a branch")
+	}
+
+	return head.Target(), nil
+}
+
+// refUpstream returns the upstream of the branch named by ref, or of the
+// current branch when ref is empty.
+func refUpstream(r *git.Repository, ref string) (plumbing.ReferenceName, error) {
+	var (
+		branch plumbing.ReferenceName
+		err    error
+	)
+
+	switch ref {
+	case "", "@", plumbing.HEAD.String():
+		branch, err = currentBranch(r)
+		if err != nil {
+			return "", err
+		}
+	default:
+		branch = plumbing.NewBranchReferenceName(ref)
+		if _, err := r.Storer.Reference(branch); err != nil {
+			return "", fmt.Errorf("no such branch: '%s'", ref)
+		}
+	}
+
+	upstream := branchUpstream(r, branch)
+	if upstream == "" {
+		return "", fmt.Errorf("no upstream configured for branch '%s'", branch.Short())
+	}
+
+	return upstream, nil
+}
+
+// branchUpstream returns the remote-tracking branch a local branch follows,
+// or an empty name.
+func branchUpstream(r *git.Repository, branch plumbing.ReferenceName) plumbing.ReferenceName {
+	if !branch.IsBranch() {
+		return ""
+	}
+
+	cfg, err := r.Config()
+	if err != nil {
+		return ""
+	}
+
+	b, ok := cfg.Branches[branch.Short()]
+	if !ok || b.Merge == "" {
+		return ""
+	}
+
+	if b.Remote == "." {
+		return b.Merge
+	}
+
+	remote, ok := cfg.Remotes[b.Remote]
+	if !ok {
+		return ""
+	}
+
+	for _, rs := range remote.Fetch {
+		if rs.Match(b.Merge) {
+			return rs.Dst(b.Merge)
+		}
+	}
+
+	return ""
+}
+
+// reflogRefName returns the reference whose reflog <ref>@{<n>} reads. An
+// empty name stands for the current branch, or HEAD when it is detached.
+func reflogRefName(r *git.Repository, ref string) (plumbing.ReferenceName, error) {
+	if ref == "" {
+		if branch, err := currentBranch(r); err == nil {
+			return branch, nil
+		}
+
+		return plumbing.HEAD, nil
+	}
+
+	if ref == "@" {
+		return plumbing.HEAD, nil
+	}
+
+	return expandRefName(r, ref)
+}
+
+// reflogValue returns the value name had according to the reflog selector
+// sel, which is either an entry number counted from the newest or a date.
+func reflogValue(r *git.Repository, name plumbing.ReferenceName, sel string) (plumbing.Hash, error) {
+	rs, err := reflogStorer(r)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	entries, err := rs.Reflog(name)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to read reflog of %s: %w", name, err)
+	}
+
+	if len(entries) == 0 {
+		return plumbing.ZeroHash, fmt.Errorf("log for '%s' is empty", name.Short())
+	}
+
+	n, err := strconv.Atoi(sel)
+	if err != nil {
+		at, err := parseExpireTime(sel, time.Now())
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("invalid reflog selector '%s'", sel)
+		}
+
+		// The newest entry made at or before the date, and past the
+		// oldest entry the value it replaced.
+		n = len(entries)
+		for i := len(entries) - 1; i >= 0; i-- {
+			if !entries[i].Committer.When.After(at) {
+				n = len(entries) - 1 - i
+
+				break
+			}
+		}
+	}
+
+	switch {
+	case n < len(entries):
+		return entries[len(entries)-1-n].NewHash, nil
+	case n == len(entries) && !entries[0].OldHash.IsZero():
+		return entries[0].OldHash, nil
+	default:
+		return plumbing.ZeroHash, fmt.Errorf("log for '%s' only has %d entries", name.Short(), len(entries))
+	}
+}
+
+// applyRevisionSuffix applies the first of the ^<n>, ~<n>, ^{<type>} and
+// ^{/<regex>} suffixes of a revision to h, returning the remaining ones.
+func applyRevisionSuffix(r *git.Repository, h plumbing.Hash, rev, suffix string) (plumbing.Hash, string, error) {
+	if arg, ok := strings.CutPrefix(suffix, "^{"); ok {
+		end := strings.Index(arg, "}")
+		if end < 0 {
+			return plumbing.ZeroHash, "", fmt.Errorf("invalid revision '%s'", rev)
+		}
+
+		var err error
+
+		if pattern, ok := strings.CutPrefix(arg[:end], "/"); ok {
+			h, err = peelObject(r, h, rev, plumbing.CommitObject.String())
+			if err == nil {
+				h, err = searchCommitMessage(r, []plumbing.Hash{h}, pattern)
+			}
+		} else {
+			h, err = peelObject(r, h, rev, arg[:end])
+		}
+
+		return h, arg[end+1:], err
+	}
+
+	op := suffix[0]
+	digits := strings.IndexFunc(suffix[1:], func(c rune) bool { return c < '0' || c > '9' })
+	if digits < 0 {
+		digits = len(suffix) - 1
+	}
+
+	n := 1
+	if digits > 0 {
+		var err error
+
+		n, err = strconv.Atoi(suffix[1 : 1+digits])
+		if err != nil {
+			return plumbing.ZeroHash, "", fmt.Errorf("invalid revision '%s'", rev)
+		}
+	}
+
+	rest := suffix[1+digits:]
+
+	h, err := peelObject(r, h, rev, plumbing.CommitObject.String())
+	if err != nil {
+		return plumbing.ZeroHash, "", err
+	}
+
+	c, err := r.CommitObject(h)
+	if err != nil {
+		return plumbing.ZeroHash, "", err
+	}
+
+	if op == '^' {
+		if n == 0 {
+			return c.Hash, rest, nil
+		}
+
+		if n > len(c.ParentHashes) {
+			return plumbing.ZeroHash, "", fmt.Errorf("%w: %s", plumbing.ErrReferenceNotFound, rev)
+		}
+
+		return c.ParentHashes[n-1], rest, nil
+	}
+
+	for ; n > 0; n-- {
+		if len(c.ParentHashes) == 0 {
+			return plumbing.ZeroHash, "", fmt.Errorf("%w: %s", plumbing.ErrReferenceNotFound, rev)
+		}
+
+		c, err = r.CommitObject(c.ParentHashes[0])
+		if err != nil {
+			return plumbing.ZeroHash, "", err
+		}
+	}
+
+	return c.Hash, rest, nil
+}
+
+// searchCommitMessage returns the youngest commit reachable from from, or
+// from any reference when from is empty, whose message matches pattern.
+// A pattern starting with "!-" matches the messages that do not match the
+// rest of it, and "!!" stands for a literal "!".
+func searchCommitMessage(r *git.Repository, from []plumbing.Hash, pattern string) (plumbing.Hash, error) {
+	negate := false
+
+	switch {
+	case strings.HasPrefix(pattern, "!-"):
+		negate, pattern = true, pattern[2:]
+	case strings.HasPrefix(pattern, "!!"):
+		pattern = pattern[1:]
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("invalid regular expression '%s': %w", pattern, err)
+	}
+
+	if len(from) == 0 {
+		refs, err := sortedReferences(r)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		for _, ref := range refs {
+			from = append(from, ref.Hash())
+		}
+
+		if head, err := r.Head(); err == nil {
+			from = append(from, head.Hash())
+		}
+	}
+
+	q := newCommitQueue(r)
+	for _, h := range from {
+		if h, err := peelObject(r, h, h.String(), plumbing.CommitObject.String()); err == nil {
+			q.add(h)
+		}
+	}
+
+	for {
+		n := q.next()
+		if n == nil {
+			return plumbing.ZeroHash, fmt.Errorf("%w: no commit message matches '%s'", plumbing.ErrReferenceNotFound, pattern)
+		}
+
+		c, err := n.Commit()
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		if re.MatchString(c.Message) != negate {
+			return c.Hash, nil
+		}
+
+		for _, p := range c.ParentHashes {
+			q.add(p)
+		}
+	}
+}
+
+// resolveIndexPath resolves [<stage>:]<path> to the blob staged for path.
+func resolveIndexPath(r *git.Repository, p string) (plumbing.Hash, error) {
+	stage := 0
+
+	if len(p) > 1 && p[0] >= '0' && p[0] <= '3' && p[1] == ':' {
+		stage, p = int(p[0]-'0'), p[2:]
+	}
+
+	p = relativeRevisionPath(r, p)
+
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to read index: %w", err)
+	}
+
+	for _, e := range idx.Entries {
+		if e.Name == p && int(e.Stage) == stage {
+			return e.Hash, nil
+		}
+	}
+
+	return plumbing.ZeroHash, fmt.Errorf("path '%s' does not exist in the index at stage %d", p, stage)
+}
+
+// resolveRefName returns the full name of the reference rev names, with
+// symbolic references followed, or false if rev does not name one.
+func resolveRefName(r *git.Repository, rev string) (plumbing.ReferenceName, bool) {
+	var name plumbing.ReferenceName
+
+	i := strings.Index(rev, "@{")
+
+	switch {
+	case i >= 0 && strings.HasSuffix(rev, "}") && isUpstreamSelector(rev[i+2:len(rev)-1]):
+		upstream, err := refUpstream(r, rev[:i])
+		if err != nil {
+			return "", false
+		}
+
+		name = upstream
+	case strings.HasPrefix(rev, "@{-") && strings.HasSuffix(rev, "}"):
+		branch, err := previousBranch(r, rev[3:len(rev)-1])
+		if err != nil {
+			return "", false
+		}
+
+		return resolveRefName(r, branch)
+	case rev == "@":
+		name = plumbing.HEAD
+	default:
+		if revisionIndex(rev, ":^~@") >= 0 {
+			return "", false
+		}
+
+		full, err := expandRefName(r, rev)
+		if err != nil {
+			return "", false
+		}
+
+		name = full
+	}
+
+	for {
+		ref, err := r.Storer.Reference(name)
+		if err != nil || ref.Type() != plumbing.SymbolicReference {
+			return name, true
+		}
+
+		name = ref.Target()
+	}
+}
+
+// abbreviateHash returns the shortest prefix of h of at least n digits that
+// names no other object.
+func abbreviateHash(r *git.Repository, h plumbing.Hash, n int) string {
+	s := h.String()
+
+	for n = max(n, 4); n < len(s); n++ {
+		if len(objectsWithPrefix(r, s[:n])) <= 1 {
+			break
+		}
+	}
+
+	return s[:min(n, len(s))]
+}
+
+// commitNodeIndexes caches the commit-graph node index of each repository,
+// so that the commit-graph is only opened once. The repositories are held
+// weakly, their commit-graph being closed once they are collected.
+var (
+	commitNodeIndexes   = make(map[weak.Pointer[git.Repository]]commitgraph.CommitNodeIndex)
+	commitNodeIndexesMu sync.Mutex
+)
+
+// commitNodeIndex returns the index history walks read commits from: the
+// commit-graph of the repository when there is one and core.commitGraph does
+// not disable it, or the object database.
+func commitNodeIndex(r *git.Repository) commitgraph.CommitNodeIndex {
+	key := weak.Make(r)
+
+	commitNodeIndexesMu.Lock()
+	defer commitNodeIndexesMu.Unlock()
+
+	if idx, ok := commitNodeIndexes[key]; ok {
+		return repositoryCommitNodeIndex{idx, r}
+	}
+
+	graph, err := openCommitGraph(r)
+	if err != nil || graph == nil {
+		return commitgraph.NewObjectCommitNodeIndex(r.Storer)
+	}
+
+	idx := commitgraph.NewGraphCommitNodeIndex(graph, r.Storer)
+	commitNodeIndexes[key] = idx
+
+	runtime.AddCleanup(r, func(graph formatgraph.Index) {
+		commitNodeIndexesMu.Lock()
+		delete(commitNodeIndexes, key)
+		commitNodeIndexesMu.Unlock()
+
+		_ = graph.Close()
+	}, graph)
+
+	return repositoryCommitNodeIndex{idx, r}
+}
+
+// repositoryCommitNodeIndex keeps the repository of a commit node index,
+// and so its commit-graph, alive while the index is in use.
+type repositoryCommitNodeIndex struct {
+	commitgraph.CommitNodeIndex
+
+	r *git.Repository
+}
+
+// commitQueue hands out commits newest first by committer date, each one
+// once, in the order git walks history.
+type commitQueue struct {
+	nodes   commitgraph.CommitNodeIndex
+	seen    map[plumbing.Hash]bool
+	commits commitHeap
+}
+
+func newCommitQueue(r *git.Repository) *commitQueue {
+	return &commitQueue{nodes: commitNodeIndex(r), seen: map[plumbing.Hash]bool{}}
+}
+
+// add queues the commit h unless it has been queued before.
+func (q *commitQueue) add(h plumbing.Hash) {
+	if q.seen[h] {
+		return
+	}
+
+	q.seen[h] = true
+
+	c, err := q.nodes.Get(h)
+	if err != nil {
+		return
+	}
+
+	heap.Push(&q.commits, queuedCommit{c, len(q.seen)})
+}
+
+// next returns the newest queued commit, or nil when the queue is empty.
+func (q *commitQueue) next() commitgraph.CommitNode {
+	if q.commits.Len() == 0 {
+		return nil
+	}
+
+	return heap.Pop(&q.commits).(queuedCommit).commit
+}
+
+type queuedCommit struct {
+	commit commitgraph.CommitNode
+	order  int
+}
+
+type commitHeap []queuedCommit
+
+func (h commitHeap) Len() int { return len(h) }
+
+func (h commitHeap) Less(i, j int) bool {
+	ti, tj := h[i].commit.CommitTime(), h[j].commit.CommitTime()
+	if !ti.Equal(tj) {
+		return ti.After(tj)
+	}
+
+	return h[i].order < h[j].order
+}
+
+func (h commitHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *commitHeap) Push(x any) { *h = append(*h, x.(queuedCommit)) }
+
+func (h *commitHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+
+	return x
+}
+
+// resolveTreePath returns the id of the entry at p in the tree of rev.
+func resolveTreePath(r *git.Repository, rev, p string) (plumbing.Hash, error) {
+	h, err := resolveObject(r, rev)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	obj, err := r.Object(plumbing.AnyObject, h)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	tree, err := peelToTree(obj)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return tree.Hash, nil
+	}
+
+	entry, err := tree.FindEntry(p)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("path '%s' does not exist in '%s'", p, rev)
+	}
+
+	return entry.Hash, nil
+}
+
+// relativeRevisionPath returns p, the path of a <rev>:<path> or :<path>
+// revision, from the top of the working tree. Like git, a path starting
+// with ./ or ../ is taken relative to the current directory.
+func relativeRevisionPath(r *git.Repository, p string) string {
+	if p != "." && p != ".." && !strings.HasPrefix(p, "./") && !strings.HasPrefix(p, "../") {
+		return p
+	}
+
+	return worktreePath(r, p)
+}
+
+// worktreePath returns p, a path relative to the current directory, from
+// the top of the working tree. A path out of the working tree is returned
+// as given.
+func worktreePath(r *git.Repository, p string) string {
+	wt, err := r.Worktree()
+	if err != nil {
+		return p
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return p
+	}
+
+	rel, err := filepath.Rel(wt.Filesystem.Root(), filepath.Join(cwd, p))
+	if err != nil {
+		return p
+	}
+
+	rel = filepath.ToSlash(rel)
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return p
+	}
+
+	if rel == "." {
+		return ""
+	}
+
+	if strings.HasSuffix(p, "/") {
+		rel += "/"
+	}
+
+	return rel
+}
+
+// resolvePeeled resolves rev and follows tags, and commits for trees, until
+// an object of type typ is found. An empty typ peels tags only.
+func resolvePeeled(r *git.Repository, rev, typ string) (plumbing.Hash, error) {
+	h, err := resolveObject(r, rev)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return peelObject(r, h, rev, typ)
+}
+
+// peelObject follows tags, and commits for trees, from h until an object of
+// type typ is found. An empty typ peels tags only.
+func peelObject(r *git.Repository, h plumbing.Hash, rev, typ string) (plumbing.Hash, error) {
+	obj, err := r.Object(plumbing.AnyObject, h)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	var t plumbing.ObjectType
+
+	if typ != "" {
+		t, err = plumbing.ParseObjectType(typ)
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("invalid object type '%s'", typ)
+		}
+	}
+
+	for {
+		if obj.Type() == t || (t == plumbing.InvalidObject && obj.Type() != plumbing.TagObject) {
+			return obj.ID(), nil
+		}
+
+		switch o := obj.(type) {
+		case *object.Tag:
+			obj, err = o.Object()
+		case *object.Commit:
+			if t != plumbing.TreeObject {
+				return plumbing.ZeroHash, fmt.Errorf("%s^{%s}: expected %s type", rev, typ, typ)
+			}
+
+			obj, err = o.Tree()
+		default:
+			return plumbing.ZeroHash, fmt.Errorf("%s^{%s}: expected %s type", rev, typ, typ)
+		}
+
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+	}
+}
+
+// peelToTree follows tags and commits down to a tree.
+func peelToTree(obj object.Object) (*object.Tree, error) {
+	for {
+		switch o := obj.(type) {
+		case *object.Tag:
+			next, err := o.Object()
+			if err != nil {
+				return nil, err
+			}
+
+			obj = next
+		case *object.Commit:
+			return o.Tree()
+		case *object.Tree:
+			return o, nil
+		default:
+			return nil, fmt.Errorf("object %s is not a tree", obj.ID())
+		}
+	}
+}
+
+// objectsWithPrefix returns the objects whose ids start with the
+// hexadecimal prefix, which must be at least four digits long.
+func objectsWithPrefix(r *git.Repository, prefix string) []plumbing.Hash {
+	if len(prefix) < 4 || len(prefix) >= plumbing.ZeroHash.HexSize() {
+		return nil
+	}
+
+	b, err := hex.DecodeString(prefix[:len(prefix)&^1])
+	if err != nil {
+		return nil
+	}
+
+	s, ok := r.Storer.(interface {
+		HashesWithPrefix(prefix []byte) ([]plumbing.Hash, error)
+	})
+	if !ok {
+		return nil
+	}
+
+	candidates, err := s.HashesWithPrefix(b)
+	if err != nil {
+		return nil
+	}
+
+	var hashes []plumbing.Hash
+
+	for _, h := range candidates {
+		if strings.HasPrefix(h.String(), prefix) {
+			hashes = append(hashes, h)
+		}
+	}
+
+	return hashes
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+// describeCandidates is the number of references describeCommit weighs
+// before settling on the nearest, as git describe does by default.
+const describeCandidates = 10
+
+// describeName is a name git describe can give to a commit, taken from a
+// reference pointing at it.
+type describeName struct {
+	name string
+	// prio is 2 for annotated tags, 1 for lightweight tags and 0 for other
+	// references.
+	prio int
+	date time.Time
+}
+
+// describeCandidate is a name found while walking the history of the
+// commit to describe, with the number of commits it does not reach.
+type describeCandidate struct {
+	name  *describeName
+	depth int
+	flag  uint32
+}
+
+// describeSeen flags the commits queued by describeCommit, the names found
+// taking the next bits.
+const describeSeen = 1
+
+// describeCommit names the commit h after the nearest reference it
+// reaches, as git describe does: from annotated tags only, from every tag
+// with tags, or from every reference with all. It reports false when no
+// reference describes h.
+func describeCommit(r *git.Repository, h plumbing.Hash, tags, all bool) (string, bool, error) {
+	names, err := describeNames(r, all)
+	if err != nil {
+		return "", false, err
+	}
+
+	if len(names) == 0 {
+		return "", false, nil
+	}
+
+	if n := names[h]; n != nil && (tags || all || n.prio == 2) {
+		return n.name, true, nil
+	}
+
+	nodes := commitNodeIndex(r)
+	flags := make(map[plumbing.Hash]uint32)
+
+	var (
+		queue      commitHeap
+		queued     int
+		candidates []*describeCandidate
+		annotated  int
+		seen       int
+		gaveUp     *queuedCommit
+	)
+
+	push := func(h plumbing.Hash, f uint32) error {
+		if flags[h]&describeSeen == 0 {
+			n, err := nodes.Get(h)
+			if errors.Is(err, plumbing.ErrObjectNotFound) {
+				// The parents of the commits of a shallow clone are missing.
+				return nil
+			}
+
+			if err != nil {
+				return fmt.Errorf("failed to read commit %s: %w", h, err)
+			}
+
+			queued++
+			heap.Push(&queue, queuedCommit{n, queued})
+		}
+
+		flags[h] |= f
+
+		return nil
+	}
+
+	err = push(h, describeSeen)
+	if err != nil {
+		return "", false, err
+	}
+
+	for queue.Len() > 0 {
+		c := heap.Pop(&queue).(queuedCommit)
+		id := c.commit.ID()
+
+		seen++
+
+		if n := names[id]; n != nil {
+			switch {
+			case !tags && !all && n.prio < 2:
+			case len(candidates) < describeCandidates:
+				t := &describeCandidate{name: n, depth: seen - 1, flag: 1 << (len(candidates) + 1)}
+				candidates = append(candidates, t)
+				flags[id] |= t.flag
+
+				if n.prio == 2 {
+					annotated++
+				}
+			default:
+				gaveUp = &c
+			}
+		}
+
+		if gaveUp != nil {
+			break
+		}
+
+		for _, t := range candidates {
+			if flags[id]&t.flag == 0 {
+				t.depth++
+			}
+		}
+
+		if annotated > 0 && queue.Len() == 0 {
+			break
+		}
+
+		for _, p := range c.commit.ParentHashes() {
+			err := push(p, flags[id])
+			if err != nil {
+				return "", false, err
+			}
+		}
+	}
+
+	if len(candidates) == 0 {
+		return "", false, nil
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].depth < candidates[j].depth })
+
+	best := candidates[0]
+
+	if gaveUp != nil {
+		heap.Push(&queue, *gaveUp)
+	}
+
+	err = finishDescribeDepth(&queue, flags, best, push)
+	if err != nil {
+		return "", false, err
+	}
+
+	return fmt.Sprintf("%s-%d-g%s", best.name.name, best.depth, abbreviateHash(r, h, 7)), true, nil
+}
+
+// finishDescribeDepth counts the commits of the remaining history that
+// best does not reach, until only commits it reaches are left.
+func finishDescribeDepth(queue *commitHeap, flags map[plumbing.Hash]uint32, best *describeCandidate, push func(plumbing.Hash, uint32) error) error {
+	for queue.Len() > 0 {
+		c := heap.Pop(queue).(queuedCommit)
+		id := c.commit.ID()
+
+		if flags[id]&best.flag != 0 {
+			covered := true
+
+			for _, q := range *queue {
+				if flags[q.commit.ID()]&best.flag == 0 {
+					covered = false
+
+					break
+				}
+			}
+
+			if covered {
+				return nil
+			}
+		} else {
+			best.depth++
+		}
+
+		for _, p := range c.commit.ParentHashes() {
+			err := push(p, flags[id])
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// describeNames returns the names describe gives to commits: the tags
+// pointing at them, or with all every reference. A commit with several
+// names takes that of the highest priority, the newest of its annotated
+// tags, or else the first reference by name.
+func describeNames(r *git.Repository, all bool) (map[plumbing.Hash]*describeName, error) {
+	refs, err := sortedReferences(r)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[plumbing.Hash]*describeName)
+
+	for _, ref := range refs {
+		name, isTag := strings.CutPrefix(ref.Name().String(), "refs/tags/")
+		if all {
+			name = strings.TrimPrefix(ref.Name().String(), "refs/")
+		} else if !isTag {
+			continue
+		}
+
+		n := &describeName{name: name}
+
+		peeled, annotated := peelTag(r, ref.Hash())
+
+		switch {
+		case annotated:
+			n.prio = 2
+
+			tag, err := r.TagObject(ref.Hash())
+			if err == nil {
+				n.date = tag.Tagger.When
+			}
+		case isTag:
+			n.prio = 1
+		}
+
+		e := names[peeled]
+		if e == nil || e.prio < n.prio || (e.prio == 2 && n.prio == 2 && e.date.Before(n.date)) {
+			names[peeled] = n
+		}
+	}
+
+	return names, nil
+}
+
+// mergeTraversalWeight is the distance name-rev adds for following a
+// merge to a parent other than the first.
+const mergeTraversalWeight = 65535
+
+// revName is the name of a commit relative to a tag that reaches it.
+type revName struct {
+	tip        string
+	date       time.Time
+	generation int
+	distance   int
+}
+
+func (n *revName) String() string {
+	if n.generation == 0 {
+		return n.tip
+	}
+
+	return fmt.Sprintf("%s~%d", strings.TrimSuffix(n.tip, "^0"), n.generation)
+}
+
+func (n *revName) effectiveDistance() int {
+	if n.generation > 0 {
+		return n.distance + mergeTraversalWeight
+	}
+
+	return n.distance
+}
+
+// betterThan reports whether n is to replace the name old: names from older
+// tags are preferred, even if they are farther away.
+func (n *revName) betterThan(old *revName) bool {
+	if !old.date.Equal(n.date) {
+		return old.date.After(n.date)
+	}
+
+	return old.effectiveDistance() > n.effectiveDistance()
+}
+
+// containingTagName names the commit h after a tag that reaches it, as git
+// describe --contains does. It reports false when no tag reaches h.
+func containingTagName(r *git.Repository, h plumbing.Hash) (string, bool, error) {
+	refs, err := sortedReferences(r)
+	if err != nil {
+		return "", false, err
+	}
+
+	type tip struct {
+		name   string
+		commit plumbing.Hash
+		date   time.Time
+	}
+
+	var tips []tip
+
+	for _, ref := range refs {
+		name, ok := strings.CutPrefix(ref.Name().String(), "refs/tags/")
+		if !ok {
+			continue
+		}
+
+		peeled, annotated := peelTag(r, ref.Hash())
+
+		c, err := r.CommitObject(peeled)
+		if err != nil {
+			continue
+		}
+
+		t := tip{name: name, commit: peeled, date: c.Committer.When}
+
+		if annotated {
+			t.name += "^0"
+
+			tag, err := r.TagObject(ref.Hash())
+			if err == nil {
+				t.date = tag.Tagger.When
+			}
+		}
+
+		tips = append(tips, t)
+	}
+
+	sort.SliceStable(tips, func(i, j int) bool { return tips[i].date.Before(tips[j].date) })
+
+	nodes := commitNodeIndex(r)
+	names := make(map[plumbing.Hash]*revName)
+
+	update := func(h plumbing.Hash, n *revName) bool {
+		if old := names[h]; old != nil && !n.betterThan(old) {
+			return false
+		}
+
+		names[h] = n
+
+		return true
+	}
+
+	for _, t := range tips {
+		if !update(t.commit, &revName{tip: t.name, date: t.date}) {
+			continue
+		}
+
+		stack := []plumbing.Hash{t.commit}
+
+		for len(stack) > 0 {
+			id := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+
+			c, err := nodes.Get(id)
+			if errors.Is(err, plumbing.ErrObjectNotFound) {
+				continue
+			}
+
+			if err != nil {
+				return "", false, fmt.Errorf("failed to read commit %s: %w", id, err)
+			}
+
+			name := names[id]
+
+			var next []plumbing.Hash
+
+			for i, p := range c.ParentHashes() {
+				n := &revName{tip: name.tip, date: t.date, generation: name.generation + 1, distance: name.distance + 1}
+
+				if i > 0 {
+					n.tip = fmt.Sprintf("%s^%d", strings.TrimSuffix(name.tip, "^0"), i+1)
+					if name.generation > 0 {
+						n.tip = fmt.Sprintf("%s~%d^%d", strings.TrimSuffix(name.tip, "^0"), name.generation, i+1)
+					}
+
+					n.generation = 0
+					n.distance = name.distance + mergeTraversalWeight
+				}
+
+				if update(p, n) {
+					next = append(next, p)
+				}
+			}
+
+			// The first parent is walked first.
+			for i := len(next) - 1; i >= 0; i-- {
+				stack = append(stack, next[i])
+			}
+		}
+	}
+
+	if n := names[h]; n != nil {
+		return n.String(), true, nil
+	}
+
+	return "", false, nil
+}
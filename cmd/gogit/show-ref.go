@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/spf13/cobra"
+)
+
+var (
+	showRefHead        bool
+	showRefHeads       bool
+	showRefTags        bool
+	showRefDereference bool
+	showRefHash        int
+	showRefVerify      bool
+	showRefQuiet       bool
+)
+
+func init() {
+	showRefCmd.Flags().BoolVarP(&showRefHead, "head", "", false, "Show the HEAD reference, even if it would be filtered out")
+	showRefCmd.Flags().BoolVarP(&showRefHeads, "heads", "", false, "Limit to branches")
+	showRefCmd.Flags().BoolVarP(&showRefTags, "tags", "", false, "Limit to tags")
+	showRefCmd.Flags().BoolVarP(&showRefDereference, "dereference", "d", false, "Also show the objects annotated tags point at")
+	showRefCmd.Flags().IntVarP(&showRefHash, "hash", "s", 0, "Only show the object ids, abbreviated to <n> digits if given")
+	showRefCmd.Flags().BoolVarP(&showRefVerify, "verify", "", false, "Require exact reference names")
+	showRefCmd.Flags().BoolVarP(&showRefQuiet, "quiet", "q", false, "Do not print anything, only set the exit status")
+	showRefCmd.Flags().Lookup("hash").NoOptDefVal = "40"
+	rootCmd.AddCommand(showRefCmd)
+}
+
+var showRefCmd = &cobra.Command{
+	Use:   "show-ref [--head] [-d] [-s[=<n>]] [-q] [--heads] [--tags] [<pattern>...] | --verify [-d] [-s[=<n>]] [-q] <ref>...",
+	Short: "List references in the repository",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		if showRefQuiet {
+			out = io.Discard
+		}
+
+		if showRefVerify {
+			for _, arg := range args {
+				ref, err := r.Reference(plumbing.ReferenceName(arg), true)
+				if err != nil || (arg != plumbing.HEAD.String() && !strings.HasPrefix(arg, "refs/")) {
+					if showRefQuiet {
+						cmd.SilenceErrors = true
+						cmd.SilenceUsage = true
+
+						return exitStatus(1)
+					}
+
+					return fmt.Errorf("'%s' - not a valid ref", arg)
+				}
+
+				printShowRef(out, r, plumbing.ReferenceName(arg), ref.Hash())
+			}
+
+			return nil
+		}
+
+		refs, err := sortedReferences(r)
+		if err != nil {
+			return err
+		}
+
+		found := false
+
+		if showRefHead {
+			if head, err := r.Head(); err == nil {
+				printShowRef(out, r, plumbing.HEAD, head.Hash())
+
+				found = true
+			}
+		}
+
+		for _, ref := range refs {
+			name := ref.Name()
+
+			if (showRefHeads || showRefTags) && !(showRefHeads && name.IsBranch()) && !(showRefTags && name.IsTag()) {
+				continue
+			}
+
+			if len(args) > 0 && !matchesRefName(name, args) {
+				continue
+			}
+
+			printShowRef(out, r, name, ref.Hash())
+
+			found = true
+		}
+
+		if !found {
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+
+			return exitStatus(1)
+		}
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+func printShowRef(out io.Writer, r *git.Repository, name plumbing.ReferenceName, h plumbing.Hash) {
+	printShowRefLine(out, name.String(), h)
+
+	if !showRefDereference {
+		return
+	}
+
+	if peeled, err := resolvePeeled(r, h.String(), ""); err == nil && peeled != h {
+		printShowRefLine(out, name.String()+"^{}", peeled)
+	}
+}
+
+func printShowRefLine(out io.Writer, name string, h plumbing.Hash) {
+	if showRefHash > 0 {
+		fmt.Fprintln(out, h.String()[:min(max(showRefHash, 4), h.HexSize())])
+
+		return
+	}
+
+	fmt.Fprintf(out, "%s %s\n", h, name)
+}
+
+// sortedReferences returns the references under refs/, sorted by name,
+// with symbolic references resolved to the hash of their target.
+func sortedReferences(r *git.Repository) ([]*plumbing.Reference, error) {
+	iter, err := r.Storer.IterReferences()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list references: %w", err)
+	}
+
+	var refs []*plumbing.Reference
+
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if !strings.HasPrefix(ref.Name().String(), "refs/") {
+			return nil
+		}
+
+		if ref.Type() == plumbing.SymbolicReference {
+			resolved, err := r.Reference(ref.Name(), true)
+			if err != nil {
+				return nil
+			}
+
+			ref = plumbing.NewHashReference(ref.Name(), resolved.Hash())
+		}
+
+		refs = append(refs, ref)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Name() < refs[j].Name() })
+
+	return refs, nil
+}
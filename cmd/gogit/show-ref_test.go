@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestShowRef(t *testing.T) {
+	dir := refsRepo(t)
+
+	for _, args := range []string{
+		"",
+		"--heads",
+		"--tags -d",
+		"--head main",
+		"--hash=8 main",
+		"-s v1",
+		"--verify refs/heads/topic refs/tags/v1",
+	} {
+		t.Run(args, func(t *testing.T) {
+			sameOutput(t, dir, append([]string{"show-ref"}, strings.Fields(args)...)...)
+		})
+	}
+}
+
+func TestShowRefMissing(t *testing.T) {
+	dir := refsRepo(t)
+
+	for _, args := range [][]string{
+		{"show-ref", "nope"},
+		{"show-ref", "--verify", "topic"},
+		{"show-ref", "-q", "--verify", "refs/heads/nope"},
+	} {
+		want := run(t, dir, "", "git", args...)
+
+		got := gogit(t, dir, args...)
+		if (got.code == 0) != (want.code == 0) || got.stdout != want.stdout {
+			t.Errorf("gogit %v exited with %d:\n%s\nwant, as git, %d:\n%s", args, got.code, got.stdout, want.code, want.stdout)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing/object"
+)
+
+// Roles an identity can take, as used in the GIT_<ROLE>_* environment
+// variables.
+const (
+	authorRole    = "AUTHOR"
+	committerRole = "COMMITTER"
+)
+
+// signature returns the identity of the given role, following git's
+// precedence of environment variables over configuration, and falling back
+// to the current user and host.
+func signature(r *git.Repository, role string) object.Signature {
+	sig := object.Signature{
+		Name:  os.Getenv("GIT_" + role + "_NAME"),
+		Email: os.Getenv("GIT_" + role + "_EMAIL"),
+		When:  time.Now(),
+	}
+
+	if date := os.Getenv("GIT_" + role + "_DATE"); date != "" {
+		if when, err := parseSignatureDate(date); err == nil {
+			sig.When = when
+		}
+	}
+
+	cfg, err := r.ConfigScoped(config.GlobalScope)
+	if err != nil {
+		cfg, _ = r.Config()
+	}
+
+	if cfg != nil {
+		name, email := cfg.Committer.Name, cfg.Committer.Email
+		if role == authorRole {
+			name, email = cfg.Author.Name, cfg.Author.Email
+		}
+
+		if sig.Name == "" {
+			sig.Name = firstNonEmpty(name, cfg.User.Name)
+		}
+
+		if sig.Email == "" {
+			sig.Email = firstNonEmpty(email, cfg.User.Email)
+		}
+	}
+
+	if sig.Name == "" || sig.Email == "" {
+		username := "unknown"
+		if u, err := user.Current(); err == nil {
+			username = u.Username
+		}
+
+		host, _ := os.Hostname()
+
+		if sig.Name == "" {
+			sig.Name = username
+		}
+
+		if sig.Email == "" {
+			sig.Email = username + "@" + host
+		}
+	}
+
+	return sig
+}
+
+// parseSignatureDate parses the date formats git accepts in the
+// GIT_AUTHOR_DATE and GIT_COMMITTER_DATE variables: the internal
+// "<unix-timestamp> <timezone>" format, RFC 2822 and ISO 8601.
+func parseSignatureDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+
+	secs, tz, _ := strings.Cut(strings.TrimPrefix(s, "@"), " ")
+	if n, err := strconv.ParseInt(secs, 10, 64); err == nil {
+		t := time.Unix(n, 0)
+		if tz == "" {
+			return t, nil
+		}
+
+		zone, err := time.Parse("-0700", tz)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid timezone %q: %w", tz, err)
+		}
+
+		return t.In(zone.Location()), nil
+	}
+
+	for _, layout := range []string{time.RFC1123Z, time.RFC3339, "2006-01-02 15:04:05 -0700", "2006-01-02T15:04:05"} {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	formatcfg "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/format/idxfile"
+	"github.com/go-git/go-git/v6/plumbing/format/packfile"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/spf13/cobra"
+)
+
+var (
+	sizerJSON bool
+	sizerTop  int
+)
+
+func init() {
+	sizerCmd.Flags().BoolVarP(&sizerJSON, "json", "", false, "Output the report as JSON")
+	sizerCmd.Flags().IntVarP(&sizerTop, "top", "n", 10, "Number of objects listed in each ranking")
+	rootCmd.AddCommand(sizerCmd)
+}
+
+var sizerCmd = &cobra.Command{
+	Use:   "sizer [--json] [-n <count>]",
+	Short: "Report the size of the repository and its largest objects",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		report, err := sizeRepository(r, sizerTop)
+		if err != nil {
+			return err
+		}
+
+		if sizerJSON {
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent("", "  ")
+
+			return enc.Encode(report)
+		}
+
+		report.print(cmd.OutOrStdout())
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// sizerReport describes the size of the history reachable from the
+// references of a repository.
+type sizerReport struct {
+	Objects            map[string]*sizerTypeStats `json:"objects"`
+	LargestBlobs       []sizerObject              `json:"largest_blobs"`
+	LargestTrees       []sizerObject              `json:"largest_trees"`
+	DeepestTrees       []sizerObject              `json:"deepest_trees"`
+	LongestDeltaChains []sizerObject              `json:"longest_delta_chains"`
+	References         map[string]int             `json:"references"`
+	History            sizerHistory               `json:"history"`
+}
+
+// sizerTypeStats counts the objects of a type and their uncompressed size.
+type sizerTypeStats struct {
+	Count   int   `json:"count"`
+	Size    int64 `json:"size"`
+	MaxSize int64 `json:"max_size"`
+}
+
+// sizerObject is an object in one of the rankings of the report, with the
+// measure it is ranked by.
+type sizerObject struct {
+	Hash    string `json:"hash"`
+	Path    string `json:"path,omitempty"`
+	Size    int64  `json:"size,omitempty"`
+	Entries int    `json:"entries,omitempty"`
+	Depth   int    `json:"depth,omitempty"`
+}
+
+type sizerHistory struct {
+	Commits    int `json:"commits"`
+	MaxDepth   int `json:"max_depth"`
+	MaxParents int `json:"max_parents"`
+}
+
+// sizeRepository builds the report of the objects reachable from the
+// references, listing top objects in each ranking.
+func sizeRepository(r *git.Repository, top int) (*sizerReport, error) {
+	store, ok := r.Storer.(*filesystem.Storage)
+	if !ok {
+		return nil, errors.New("storer does not implement filesystem.Storage")
+	}
+
+	of, err := packObjectFormat(r, "")
+	if err != nil {
+		return nil, err
+	}
+
+	w := &revWalk{r: r}
+
+	err = w.addAll()
+	if err != nil {
+		return nil, err
+	}
+
+	commits, _, err := w.walk()
+	if err != nil {
+		return nil, err
+	}
+
+	lines, err := w.objects(commits, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &sizerReport{
+		Objects:    make(map[string]*sizerTypeStats),
+		References: make(map[string]int),
+	}
+
+	for _, typ := range []plumbing.ObjectType{plumbing.CommitObject, plumbing.TreeObject, plumbing.BlobObject, plumbing.TagObject} {
+		report.Objects[typ.String()] = &sizerTypeStats{}
+	}
+
+	paths := make(map[plumbing.Hash]string, len(lines))
+
+	for _, c := range commits {
+		obj, err := r.Storer.EncodedObject(plumbing.CommitObject, c.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read commit %s: %w", c.Hash, err)
+		}
+
+		report.count(plumbing.CommitObject, obj.Size())
+	}
+
+	var blobs, trees, deep []sizerObject
+
+	for _, line := range lines {
+		hex, name, _ := strings.Cut(line, " ")
+		h := plumbing.NewHash(hex)
+		paths[h] = name
+
+		obj, err := r.Storer.EncodedObject(plumbing.AnyObject, h)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read object %s: %w", h, err)
+		}
+
+		report.count(obj.Type(), obj.Size())
+
+		//exhaustive:ignore commits and tags are only counted.
+		switch obj.Type() {
+		case plumbing.BlobObject:
+			blobs = append(blobs, sizerObject{Hash: hex, Path: name, Size: obj.Size()})
+		case plumbing.TreeObject:
+			tree, err := object.DecodeTree(r.Storer, obj)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read tree %s: %w", h, err)
+			}
+
+			depth := 1
+			if name != "" {
+				depth += strings.Count(name, "/") + 1
+			}
+
+			trees = append(trees, sizerObject{Hash: hex, Path: name, Size: obj.Size(), Entries: len(tree.Entries)})
+			deep = append(deep, sizerObject{Hash: hex, Path: name, Depth: depth})
+		}
+	}
+
+	report.LargestBlobs = topObjects(blobs, top, func(o sizerObject) int64 { return o.Size })
+	report.LargestTrees = topObjects(trees, top, func(o sizerObject) int64 { return int64(o.Entries) })
+	report.DeepestTrees = topObjects(deep, top, func(o sizerObject) int64 { return int64(o.Depth) })
+
+	chains, err := deltaChains(store, of, paths)
+	if err != nil {
+		return nil, err
+	}
+
+	report.LongestDeltaChains = topObjects(chains, top, func(o sizerObject) int64 { return int64(o.Depth) })
+
+	refs, err := r.References()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list references: %w", err)
+	}
+
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		report.References[referenceNamespace(ref.Name())]++
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report.History = historyDepth(commits)
+
+	return report, nil
+}
+
+func (s *sizerReport) count(typ plumbing.ObjectType, size int64) {
+	stats, ok := s.Objects[typ.String()]
+	if !ok {
+		return
+	}
+
+	stats.Count++
+	stats.Size += size
+	stats.MaxSize = max(stats.MaxSize, size)
+}
+
+// topObjects returns the n objects with the largest measure, the smallest
+// ids first among equals.
+func topObjects(objects []sizerObject, n int, measure func(sizerObject) int64) []sizerObject {
+	sort.SliceStable(objects, func(i, j int) bool {
+		if mi, mj := measure(objects[i]), measure(objects[j]); mi != mj {
+			return mi > mj
+		}
+
+		return objects[i].Hash < objects[j].Hash
+	})
+
+	return objects[:min(n, len(objects))]
+}
+
+// deltaChains returns the delta objects of the packs with the length of
+// their delta chain, under the paths they were found at.
+func deltaChains(store *filesystem.Storage, of formatcfg.ObjectFormat, paths map[plumbing.Hash]string) ([]sizerObject, error) {
+	indexes, err := readPackIndexes(store, of)
+	if err != nil {
+		return nil, err
+	}
+
+	depths := make(map[plumbing.Hash]int)
+
+	for _, pack := range sortedPacks(indexes) {
+		chains, err := packDeltaChains(store, of, pack, indexes[pack])
+		if err != nil {
+			return nil, err
+		}
+
+		// An object stored in several packs is ranked by its shortest
+		// chain.
+		for h, depth := range chains {
+			if d, ok := depths[h]; !ok || depth < d {
+				depths[h] = depth
+			}
+		}
+	}
+
+	chains := make([]sizerObject, 0, len(depths))
+	for h, depth := range depths {
+		chains = append(chains, sizerObject{Hash: h.String(), Path: paths[h], Depth: depth})
+	}
+
+	return chains, nil
+}
+
+// packDeltaChains returns the depth of the delta chain of each delta object
+// in the pack, the way verify-pack -v computes it.
+func packDeltaChains(store *filesystem.Storage, of formatcfg.ObjectFormat, pack plumbing.Hash, idx *idxfile.MemoryIndex) (map[plumbing.Hash]int, error) {
+	f, err := store.Filesystem().Open(packFilePath(pack, "pack"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pack %s: %w", pack, err)
+	}
+
+	defer func() {
+		err := f.Close()
+		if err != nil {
+			slog.Debug("failed to close pack file", "error", err)
+		}
+	}()
+
+	pf := packfile.NewPackfile(
+		f,
+		packfile.WithIdx(idx),
+		packfile.WithObjectIDSize(objectFormatHash(of).Size()),
+	)
+
+	defer func() {
+		err := pf.Close()
+		if err != nil {
+			slog.Debug("failed to close Packfile object", "error", err)
+		}
+	}()
+
+	scanner, err := pf.Scanner() //nolint:staticcheck
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scanner: %w", err)
+	}
+
+	entries, err := idx.EntriesByOffset()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get entries: %w", err)
+	}
+
+	objects, err := collectObjectInfo(entries, scanner)
+	if err != nil {
+		return nil, err
+	}
+
+	return calculateDeltaChains(objects, scanner)
+}
+
+// referenceNamespace returns the namespace a reference is counted under,
+// such as refs/heads, or the reference itself outside refs/.
+func referenceNamespace(name plumbing.ReferenceName) string {
+	parts := strings.SplitN(name.String(), "/", 3)
+	if len(parts) < 3 || parts[0] != "refs" {
+		return name.String()
+	}
+
+	return parts[0] + "/" + parts[1]
+}
+
+// historyDepth measures the history of the commits: the longest chain of
+// commits and the largest number of parents. Parents missing from commits,
+// as in shallow repositories, end the chains.
+func historyDepth(commits []*object.Commit) sizerHistory {
+	byHash := make(map[plumbing.Hash]*object.Commit, len(commits))
+	for _, c := range commits {
+		byHash[c.Hash] = c
+	}
+
+	history := sizerHistory{Commits: len(commits)}
+	depths := make(map[plumbing.Hash]int, len(commits))
+
+	for _, c := range commits {
+		history.MaxParents = max(history.MaxParents, c.NumParents())
+
+		pending := []*object.Commit{c}
+
+		for len(pending) > 0 {
+			c := pending[len(pending)-1]
+			if _, ok := depths[c.Hash]; ok {
+				pending = pending[:len(pending)-1]
+
+				continue
+			}
+
+			depth, waiting := 0, false
+
+			for _, p := range c.ParentHashes {
+				parent, ok := byHash[p]
+				if !ok {
+					continue
+				}
+
+				if d, ok := depths[p]; ok {
+					depth = max(depth, d)
+				} else {
+					pending = append(pending, parent)
+					waiting = true
+				}
+			}
+
+			if waiting {
+				continue
+			}
+
+			pending = pending[:len(pending)-1]
+			depths[c.Hash] = depth + 1
+			history.MaxDepth = max(history.MaxDepth, depth+1)
+		}
+	}
+
+	return history
+}
+
+// print writes the report as text.
+func (s *sizerReport) print(out io.Writer) {
+	fmt.Fprintln(out, "Objects:")
+
+	for _, typ := range []string{"commit", "tree", "blob", "tag"} {
+		stats := s.Objects[typ]
+		fmt.Fprintf(out, "  %-8s %8d  %12s  (largest %s)\n", typ+"s", stats.Count, humanSize(stats.Size), humanSize(stats.MaxSize))
+	}
+
+	printSizerObjects(out, "Largest blobs", s.LargestBlobs, func(o sizerObject) string { return humanSize(o.Size) })
+	printSizerObjects(out, "Largest trees", s.LargestTrees, func(o sizerObject) string { return fmt.Sprintf("%d entries", o.Entries) })
+	printSizerObjects(out, "Deepest trees", s.DeepestTrees, func(o sizerObject) string { return fmt.Sprintf("depth %d", o.Depth) })
+	printSizerObjects(out, "Longest delta chains", s.LongestDeltaChains, func(o sizerObject) string { return fmt.Sprintf("depth %d", o.Depth) })
+
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "References:")
+
+	namespaces := make([]string, 0, len(s.References))
+	for ns := range s.References {
+		namespaces = append(namespaces, ns)
+	}
+
+	sort.Strings(namespaces)
+
+	for _, ns := range namespaces {
+		fmt.Fprintf(out, "  %-20s %8d\n", ns, s.References[ns])
+	}
+
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "History:")
+	fmt.Fprintf(out, "  %-20s %8d\n", "commits", s.History.Commits)
+	fmt.Fprintf(out, "  %-20s %8d\n", "max depth", s.History.MaxDepth)
+	fmt.Fprintf(out, "  %-20s %8d\n", "max parents", s.History.MaxParents)
+}
+
+func printSizerObjects(out io.Writer, title string, objects []sizerObject, measure func(sizerObject) string) {
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "%s:\n", title)
+
+	for _, o := range objects {
+		fmt.Fprintf(out, "  %12s  %s", measure(o), o.Hash)
+
+		if o.Path != "" {
+			fmt.Fprintf(out, "  %s", o.Path)
+		}
+
+		fmt.Fprintln(out)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v6/plumbing"
+)
+
+// TestSizer checks the sizer report of a repository made by git against
+// what git reports of its objects, references and history.
+func TestSizer(t *testing.T) {
+	dir := packRepo(t)
+	gitCmd(t, dir, "checkout", "-q", "-b", "topic", "main~2")
+	writeFile(t, dir, "big/deep/er/file", strings.Repeat("big\n", 1000))
+	gitCmd(t, dir, "add", "big")
+	gitCmd(t, dir, "commit", "-q", "-m", "big")
+	gitCmd(t, dir, "checkout", "-q", "main")
+	gitCmd(t, dir, "merge", "-q", "--no-ff", "-m", "merge", "topic")
+	gitCmd(t, dir, "tag", "-a", "-m", "v1", "v1")
+	gitCmd(t, dir, "tag", "light")
+	gitCmd(t, dir, "notes", "add", "-m", "note")
+	gitCmd(t, dir, "gc", "-q")
+
+	var report sizerReport
+
+	err := json.Unmarshal([]byte(mustGogit(t, dir, "sizer", "--json", "-n", "3")), &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The objects reachable from the references, by type.
+	want := map[string]*sizerTypeStats{}
+	for _, typ := range []string{"commit", "tree", "blob", "tag"} {
+		want[typ] = &sizerTypeStats{}
+	}
+
+	objects := gitCmd(t, dir, "rev-list", "--objects", "--all")
+
+	var largest []string
+
+	for _, line := range strings.Split(strings.TrimSpace(gitCmdStdin(t, dir, objects, "cat-file", "--batch-check=%(objecttype) %(objectsize) %(objectname) %(rest)")), "\n") {
+		f := strings.Fields(line)
+		size, _ := strconv.ParseInt(f[1], 10, 64)
+
+		stats := want[f[0]]
+		stats.Count++
+		stats.Size += size
+		stats.MaxSize = max(stats.MaxSize, size)
+
+		if f[0] == "blob" && size == 4000 {
+			largest = f[2:]
+		}
+	}
+
+	for typ, stats := range want {
+		if got := report.Objects[typ]; got == nil || *got != *stats {
+			t.Errorf("sizer counted the %ss %+v, want %+v", typ, got, stats)
+		}
+	}
+
+	if len(report.LargestBlobs) != 3 || report.LargestBlobs[0].Hash != largest[0] || report.LargestBlobs[0].Path != largest[1] {
+		t.Errorf("sizer ranked the largest blobs %+v, want first %v", report.LargestBlobs, largest)
+	}
+
+	if len(report.DeepestTrees) == 0 || report.DeepestTrees[0].Path != "big/deep/er" || report.DeepestTrees[0].Depth != 4 {
+		t.Errorf("sizer ranked the deepest trees %+v", report.DeepestTrees)
+	}
+
+	// The longest delta chain is the one git verify-pack reports.
+	longest := 0
+
+	for _, idx := range globPacks(t, dir, "*.idx") {
+		for _, line := range strings.Split(gitCmd(t, dir, "verify-pack", "-v", idx), "\n") {
+			if n, ok := strings.CutPrefix(line, "chain length = "); ok {
+				depth, _ := strconv.Atoi(n[:strings.Index(n, ":")])
+				longest = max(longest, depth)
+			}
+		}
+	}
+
+	if longest == 0 {
+		t.Fatal("git stored no deltas")
+	}
+
+	if len(report.LongestDeltaChains) == 0 || report.LongestDeltaChains[0].Depth != longest {
+		t.Errorf("sizer ranked the longest delta chains %+v, want a chain of %d", report.LongestDeltaChains, longest)
+	}
+
+	refs := map[string]int{}
+	for _, name := range strings.Fields(gitCmd(t, dir, "for-each-ref", "--format=%(refname)")) {
+		refs[referenceNamespace(plumbing.ReferenceName(name))]++
+	}
+
+	refs["HEAD"]++
+
+	for ns, n := range refs {
+		if report.References[ns] != n {
+			t.Errorf("sizer counted %d references in %s, want %d", report.References[ns], ns, n)
+		}
+	}
+
+	commits, _ := strconv.Atoi(strings.TrimSpace(gitCmd(t, dir, "rev-list", "--count", "--all")))
+	depth, _ := strconv.Atoi(strings.TrimSpace(gitCmd(t, dir, "rev-list", "--count", "--first-parent", "main")))
+
+	if h := report.History; h.Commits != commits || h.MaxDepth != depth || h.MaxParents != 2 {
+		t.Errorf("sizer measured the history %+v, want %d commits %d deep with merges", h, commits, depth)
+	}
+
+	text := mustGogit(t, dir, "sizer")
+	for _, section := range []string{"Objects:", "References:", "History:", largest[1]} {
+		if !strings.Contains(text, section) {
+			t.Errorf("sizer printed no %s:\n%s", section, text)
+		}
+	}
+}
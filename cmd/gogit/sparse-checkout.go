@@ -0,0 +1,1041 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	format "github.com/go-git/go-git/v6/plumbing/format/config"
+	"github.com/go-git/go-git/v6/plumbing/format/gitignore"
+	"github.com/go-git/go-git/v6/plumbing/format/index"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/spf13/cobra"
+)
+
+const sparseCheckoutFile = "info/sparse-checkout"
+
+var (
+	sparseCheckoutCone   bool
+	sparseCheckoutNoCone bool
+	sparseCheckoutStdin  bool
+)
+
+func init() {
+	for _, c := range []*cobra.Command{sparseCheckoutInitCmd, sparseCheckoutSetCmd} {
+		c.Flags().BoolVarP(&sparseCheckoutCone, "cone", "", false, "Use cone mode patterns")
+		c.Flags().BoolVarP(&sparseCheckoutNoCone, "no-cone", "", false, "Use full gitignore-style patterns")
+	}
+
+	for _, c := range []*cobra.Command{sparseCheckoutSetCmd, sparseCheckoutAddCmd} {
+		c.Flags().BoolVarP(&sparseCheckoutStdin, "stdin", "", false, "Read patterns from standard input")
+	}
+
+	sparseCheckoutCmd.AddCommand(sparseCheckoutInitCmd)
+	sparseCheckoutCmd.AddCommand(sparseCheckoutSetCmd)
+	sparseCheckoutCmd.AddCommand(sparseCheckoutAddCmd)
+	sparseCheckoutCmd.AddCommand(sparseCheckoutListCmd)
+	sparseCheckoutCmd.AddCommand(sparseCheckoutDisableCmd)
+	sparseCheckoutCmd.AddCommand(sparseCheckoutReapplyCmd)
+	rootCmd.AddCommand(sparseCheckoutCmd)
+}
+
+var sparseCheckoutCmd = &cobra.Command{
+	Use:   "sparse-checkout <command>",
+	Short: "Reduce the working tree to a subset of tracked files",
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		return cmd.Usage()
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var sparseCheckoutInitCmd = &cobra.Command{
+	Use:   "init [--cone | --no-cone]",
+	Short: "Enable sparse checkout, keeping only the top-level files",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		s, err := openSparseCheckout()
+		if err != nil {
+			return err
+		}
+
+		exists := len(s.patterns) > 0 || len(s.dirs) > 0
+		s.cone = sparseCheckoutMode(s)
+
+		switch {
+		case !exists:
+			s.patterns = []string{"/*", "!/*/"}
+			s.dirs = nil
+		case s.cone:
+			s.dirs = coneDirs(s.patterns)
+		}
+
+		err = s.enable()
+		if err != nil {
+			return err
+		}
+
+		return s.apply(cmd.ErrOrStderr())
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var sparseCheckoutSetCmd = &cobra.Command{
+	Use:   "set [--cone | --no-cone] [--stdin] [<pattern>...]",
+	Short: "Replace the sparse checkout patterns",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s, err := openSparseCheckout()
+		if err != nil {
+			return err
+		}
+
+		args, err = sparseCheckoutArgs(cmd.InOrStdin(), args)
+		if err != nil {
+			return err
+		}
+
+		s.cone = sparseCheckoutMode(s)
+		s.dirs = nil
+		s.patterns = nil
+
+		err = s.add(args)
+		if err != nil {
+			return err
+		}
+
+		err = s.enable()
+		if err != nil {
+			return err
+		}
+
+		return s.apply(cmd.ErrOrStderr())
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var sparseCheckoutAddCmd = &cobra.Command{
+	Use:   "add [--stdin] <pattern>...",
+	Short: "Add patterns to the sparse checkout",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s, err := openSparseCheckout()
+		if err != nil {
+			return err
+		}
+
+		if !s.enabled {
+			return errors.New("no sparse-checkout to add to")
+		}
+
+		args, err = sparseCheckoutArgs(cmd.InOrStdin(), args)
+		if err != nil {
+			return err
+		}
+
+		err = s.add(args)
+		if err != nil {
+			return err
+		}
+
+		err = s.write()
+		if err != nil {
+			return err
+		}
+
+		return s.apply(cmd.ErrOrStderr())
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var sparseCheckoutListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the directories or patterns of the sparse checkout",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		s, err := openSparseCheckout()
+		if err != nil {
+			return err
+		}
+
+		if !s.enabled {
+			return errors.New("this worktree is not sparse")
+		}
+
+		lines := s.patterns
+		if s.cone {
+			lines = s.dirs
+		}
+
+		for _, l := range lines {
+			fmt.Fprintln(cmd.OutOrStdout(), l)
+		}
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var sparseCheckoutDisableCmd = &cobra.Command{
+	Use:   "disable",
+	Short: "Disable sparse checkout and restore the full working tree",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		s, err := openSparseCheckout()
+		if err != nil {
+			return err
+		}
+
+		s.enabled = false
+
+		err = s.apply(cmd.ErrOrStderr())
+		if err != nil {
+			return err
+		}
+
+		return setSparseCheckoutConfig(s.r, false, false)
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var sparseCheckoutReapplyCmd = &cobra.Command{
+	Use:   "reapply",
+	Short: "Reapply the sparse checkout patterns to the working tree",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		s, err := openSparseCheckout()
+		if err != nil {
+			return err
+		}
+
+		if !s.enabled {
+			return errors.New("must be in a sparse-checkout to reapply sparsity patterns")
+		}
+
+		return s.apply(cmd.ErrOrStderr())
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// sparseCheckout holds the sparse checkout definition of a repository.
+// In cone mode it is kept as the list of directories included
+// recursively, otherwise as gitignore-style patterns.
+type sparseCheckout struct {
+	r        *git.Repository
+	fs       billy.Filesystem
+	enabled  bool
+	cone     bool
+	dirs     []string
+	patterns []string
+}
+
+func openSparseCheckout() (*sparseCheckout, error) {
+	r, err := git.PlainOpen(".")
+	if err != nil {
+		return nil, err
+	}
+
+	return loadSparseCheckout(r)
+}
+
+// loadSparseCheckout reads the sparse checkout configuration and
+// patterns of r.
+func loadSparseCheckout(r *git.Repository) (*sparseCheckout, error) {
+	store, ok := r.Storer.(*filesystem.Storage)
+	if !ok {
+		return nil, errors.New("storer does not implement filesystem.Storage")
+	}
+
+	cfg, err := r.Config()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get repository config: %w", err)
+	}
+
+	s := &sparseCheckout{r: r, fs: store.Filesystem()}
+
+	core, err := coreOptions(s.fs, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	s.enabled = optionBool(core, "sparseCheckout")
+	s.cone = optionBool(core, "sparseCheckoutCone")
+
+	data, err := util.ReadFile(s.fs, sparseCheckoutFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read sparse-checkout file: %w", err)
+	}
+
+	var lines []string
+
+	for line := range strings.Lines(string(data)) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+
+	s.patterns = lines
+
+	if s.cone {
+		s.dirs = coneDirs(lines)
+	}
+
+	return s, nil
+}
+
+// coreOptions returns the core section of the repository configuration.
+// Git keeps the sparse checkout settings in config.worktree when the
+// worktreeConfig extension is enabled, and go-git drops the options it
+// does not know about when merging that file, so it is read here.
+func coreOptions(fs billy.Filesystem, cfg *config.Config) (format.Options, error) {
+	var opts format.Options
+	if cfg.Raw != nil {
+		opts = append(opts, cfg.Raw.Section("core").Options...)
+	}
+
+	if !cfg.Extensions.WorktreeConfig {
+		return opts, nil
+	}
+
+	f, err := fs.Open("config.worktree")
+	if os.IsNotExist(err) {
+		return opts, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read worktree config: %w", err)
+	}
+	defer f.Close()
+
+	raw := format.New()
+
+	err = format.NewDecoder(f).Decode(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read worktree config: %w", err)
+	}
+
+	return append(opts, raw.Section("core").Options...), nil
+}
+
+// optionBool returns the boolean value of the last key option, false if
+// unset or invalid.
+func optionBool(opts format.Options, key string) bool {
+	var value string
+
+	for _, o := range opts {
+		if o.IsKey(key) {
+			value = o.Value
+		}
+	}
+
+	v, err := strconv.ParseBool(value)
+
+	return err == nil && v
+}
+
+// setSparseCheckoutConfig sets core.sparseCheckout and
+// core.sparseCheckoutCone.
+func setSparseCheckoutConfig(r *git.Repository, enabled, cone bool) error {
+	cfg, err := r.Config()
+	if err != nil {
+		return fmt.Errorf("failed to get repository config: %w", err)
+	}
+
+	if cfg.Raw == nil {
+		cfg.Raw = format.New()
+	}
+
+	cfg.Raw.Section("core").SetOption("sparseCheckout", strconv.FormatBool(enabled))
+	cfg.Raw.Section("core").SetOption("sparseCheckoutCone", strconv.FormatBool(cone))
+
+	return r.SetConfig(cfg)
+}
+
+// sparseCheckoutMode returns whether cone mode is to be used, given the
+// --cone and --no-cone flags. Cone mode is the default, unless the
+// repository is already using full patterns.
+func sparseCheckoutMode(s *sparseCheckout) bool {
+	switch {
+	case sparseCheckoutNoCone:
+		return false
+	case sparseCheckoutCone:
+		return true
+	case s.enabled:
+		return s.cone
+	default:
+		return true
+	}
+}
+
+// sparseCheckoutArgs returns the patterns given on the command line, or
+// read from in with --stdin.
+func sparseCheckoutArgs(in io.Reader, args []string) ([]string, error) {
+	if !sparseCheckoutStdin {
+		return args, nil
+	}
+
+	var patterns []string
+
+	lines := bufio.NewScanner(in)
+	for lines.Scan() {
+		if l := strings.TrimSpace(lines.Text()); l != "" {
+			patterns = append(patterns, l)
+		}
+	}
+
+	return patterns, lines.Err()
+}
+
+// coneDirs returns the directories included recursively by cone mode
+// patterns: those added without excluding their subdirectories.
+func coneDirs(patterns []string) []string {
+	parents := make(map[string]bool)
+
+	for _, p := range patterns {
+		if strings.HasPrefix(p, "!/") && strings.HasSuffix(p, "/*/") {
+			parents[strings.TrimSuffix(strings.TrimPrefix(p, "!/"), "/*/")] = true
+		}
+	}
+
+	var dirs []string
+
+	for _, p := range patterns {
+		if p == "/*" || strings.HasPrefix(p, "!") || !strings.HasPrefix(p, "/") {
+			continue
+		}
+
+		dir := strings.Trim(p, "/")
+		if dir != "" && !parents[dir] {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	return dirs
+}
+
+// add extends the sparse checkout with args, directories in cone mode
+// and patterns otherwise.
+func (s *sparseCheckout) add(args []string) error {
+	if !s.cone {
+		s.patterns = append(s.patterns, args...)
+
+		return nil
+	}
+
+	for _, arg := range args {
+		dir := path.Clean(strings.Trim(arg, "/"))
+		if dir == "." {
+			continue
+		}
+
+		if strings.ContainsAny(dir, "*?[]!\\") {
+			return fmt.Errorf("specify directories rather than patterns: '%s'", arg)
+		}
+
+		s.dirs = append(s.dirs, dir)
+	}
+
+	// Drop duplicates and directories already included by a parent.
+	sort.Strings(s.dirs)
+
+	dirs := s.dirs[:0]
+
+	for _, dir := range s.dirs {
+		if len(dirs) > 0 && (dir == dirs[len(dirs)-1] || strings.HasPrefix(dir, dirs[len(dirs)-1]+"/")) {
+			continue
+		}
+
+		dirs = append(dirs, dir)
+	}
+
+	s.dirs = dirs
+
+	return nil
+}
+
+// lines returns the content of the sparse-checkout file. In cone mode, the
+// top-level files and the files directly inside the parents of every
+// directory are included, as git does.
+func (s *sparseCheckout) lines() []string {
+	if !s.cone {
+		return s.patterns
+	}
+
+	lines := []string{"/*", "!/*/"}
+
+	parents := make(map[string]bool)
+
+	for _, dir := range s.dirs {
+		for p := path.Dir(dir); p != "."; p = path.Dir(p) {
+			parents[p] = true
+		}
+	}
+
+	sorted := make([]string, 0, len(parents))
+	for p := range parents {
+		sorted = append(sorted, p)
+	}
+
+	sort.Strings(sorted)
+
+	for _, p := range sorted {
+		lines = append(lines, "/"+p+"/", "!/"+p+"/*/")
+	}
+
+	for _, dir := range s.dirs {
+		lines = append(lines, "/"+dir+"/")
+	}
+
+	return lines
+}
+
+func (s *sparseCheckout) write() error {
+	err := s.fs.MkdirAll("info", 0o755)
+	if err != nil {
+		return err
+	}
+
+	content := strings.Join(s.lines(), "\n") + "\n"
+
+	err = util.WriteFile(s.fs, sparseCheckoutFile, []byte(content), 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to write sparse-checkout file: %w", err)
+	}
+
+	return nil
+}
+
+// enable writes the patterns and turns on core.sparseCheckout.
+func (s *sparseCheckout) enable() error {
+	err := s.write()
+	if err != nil {
+		return err
+	}
+
+	s.enabled = true
+
+	return setSparseCheckoutConfig(s.r, true, s.cone)
+}
+
+// includes reports whether the tracked file name is part of the sparse
+// checkout.
+func (s *sparseCheckout) includes() func(name string) bool {
+	if !s.enabled {
+		return func(string) bool { return true }
+	}
+
+	if !s.cone {
+		patterns := make([]gitignore.Pattern, 0, len(s.patterns))
+		for _, p := range s.patterns {
+			patterns = append(patterns, gitignore.ParsePattern(p, nil))
+		}
+
+		m := gitignore.NewMatcher(patterns)
+
+		return func(name string) bool {
+			return m.Match(strings.Split(name, "/"), false)
+		}
+	}
+
+	parents := make(map[string]bool)
+
+	for _, dir := range s.dirs {
+		for p := path.Dir(dir); p != "."; p = path.Dir(p) {
+			parents[p] = true
+		}
+	}
+
+	return func(name string) bool {
+		dir := path.Dir(name)
+		if dir == "." || parents[dir] {
+			return true
+		}
+
+		for _, d := range s.dirs {
+			if strings.HasPrefix(name, d+"/") {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// apply updates the skip-worktree bits of the index to match the sparse
+// checkout, writing the files that enter it and removing those that leave
+// it. Modified files are left in place, as git does.
+func (s *sparseCheckout) apply(out io.Writer) error {
+	w, err := s.r.Worktree()
+	if err != nil {
+		return err
+	}
+
+	idx, err := s.r.Storer.Index()
+	if err != nil {
+		return fmt.Errorf("failed to read index: %w", err)
+	}
+
+	conv, err := newConverter(s.r, attrCheckout, out)
+	if err != nil {
+		return err
+	}
+	defer conv.Close()
+
+	include := s.includes()
+
+	var kept []string
+
+	for _, e := range idx.Entries {
+		skip := !include(e.Name)
+
+		switch {
+		case skip && !e.SkipWorktree:
+			modified, err := s.modified(w.Filesystem, e, conv)
+			if err != nil {
+				return err
+			}
+
+			if modified {
+				kept = append(kept, e.Name)
+
+				continue
+			}
+
+			err = removeTrackedFile(w.Filesystem, e.Name)
+			if err != nil {
+				return err
+			}
+		case !skip && e.SkipWorktree:
+			err := checkoutIndexEntry(s.r, w.Filesystem, e, conv)
+			if err != nil {
+				return err
+			}
+		}
+
+		e.SkipWorktree = skip
+	}
+
+	if len(kept) > 0 {
+		fmt.Fprintln(out, "warning: The following paths are not up to date and were left despite sparse patterns:")
+
+		for _, name := range kept {
+			fmt.Fprintf(out, "\t%s\n", name)
+		}
+	}
+
+	return s.r.Storer.SetIndex(idx)
+}
+
+// modified reports whether the file of e differs from the index once
+// converted by conv.
+func (s *sparseCheckout) modified(fs billy.Filesystem, e *index.Entry, conv *converter) (bool, error) {
+	fi, err := fs.Lstat(e.Name)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if e.Mode == filemode.Submodule || fi.IsDir() {
+		return false, nil
+	}
+
+	var data []byte
+	if fi.Mode()&os.ModeSymlink != 0 {
+		target, err := fs.Readlink(e.Name)
+		if err != nil {
+			return false, err
+		}
+
+		data = []byte(target)
+	} else {
+		data, err = util.ReadFile(fs, e.Name)
+		if err != nil {
+			return false, err
+		}
+
+		data, err = conv.toGit(e.Name, data)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	o := s.r.Storer.NewEncodedObject()
+	o.SetType(plumbing.BlobObject)
+	o.SetSize(int64(len(data)))
+
+	wr, err := o.Writer()
+	if err != nil {
+		return false, err
+	}
+
+	_, err = wr.Write(data)
+	if err != nil {
+		return false, err
+	}
+
+	err = wr.Close()
+	if err != nil {
+		return false, err
+	}
+
+	return o.Hash() != e.Hash, nil
+}
+
+// removeTrackedFile removes name from the worktree, along with the parent
+// directories it leaves empty.
+func removeTrackedFile(fs billy.Filesystem, name string) error {
+	err := fs.Remove(name)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %w", name, err)
+	}
+
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		entries, err := fs.ReadDir(dir)
+		if err != nil || len(entries) > 0 {
+			break
+		}
+
+		err = fs.Remove(dir)
+		if err != nil {
+			break
+		}
+	}
+
+	return nil
+}
+
+// checkoutIndexEntry writes the blob of e to the worktree, converted by
+// conv.
+func checkoutIndexEntry(r *git.Repository, fs billy.Filesystem, e *index.Entry, conv *converter) error {
+	if e.Mode == filemode.Submodule {
+		return fs.MkdirAll(e.Name, 0o755)
+	}
+
+	data, err := readBlob(r, e.Hash)
+	if err != nil {
+		return fmt.Errorf("failed to read blob of %s: %w", e.Name, err)
+	}
+
+	err = fs.MkdirAll(path.Dir(e.Name), 0o755)
+	if err != nil {
+		return err
+	}
+
+	if e.Mode == filemode.Symlink {
+		return fs.Symlink(string(data), e.Name)
+	}
+
+	data, err = conv.toWorktree(e.Name, data, e.Hash)
+	if err != nil {
+		return err
+	}
+
+	mode, err := e.Mode.ToOSFileMode()
+	if err != nil {
+		return err
+	}
+
+	f, err := fs.OpenFile(e.Name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode.Perm())
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", e.Name, err)
+	}
+
+	_, err = f.Write(data)
+	if err != nil {
+		_ = f.Close()
+
+		return fmt.Errorf("failed to write %s: %w", e.Name, err)
+	}
+
+	return f.Close()
+}
+
+// checkout checks out opts in w, only writing the files of the sparse
+// checkout in cone mode. go-git takes the sparse directories as path
+// prefixes, and requires them to be directories of the target tree, which
+// the top-level files cone mode includes are not. So HEAD is moved first,
+// and the index and worktree reset with the prefixes of the files
+// included, unchecked.
+func (s *sparseCheckout) checkout(w *git.Worktree, opts *git.CheckoutOptions) error {
+	if !s.enabled {
+		return w.Checkout(opts)
+	}
+
+	move := *opts
+	if s.cone {
+		move.Force, move.Keep = false, true
+	}
+
+	err := w.Checkout(&move)
+	if err != nil {
+		return err
+	}
+
+	head, err := s.r.Head()
+	if err != nil {
+		return err
+	}
+
+	commit, err := s.r.CommitObject(head.Hash())
+	if err != nil {
+		return err
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return err
+	}
+
+	if s.cone {
+		prefixes, err := s.prefixes(tree)
+		if err != nil {
+			return err
+		}
+
+		mode := git.MergeReset
+		if opts.Force {
+			mode = git.HardReset
+		}
+
+		err = w.Reset(&git.ResetOptions{
+			Commit:                  head.Hash(),
+			Mode:                    mode,
+			SparseDirs:              prefixes,
+			SkipSparseDirValidation: true,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.syncSkipped(tree)
+}
+
+// syncSkipped updates the index entries go-git left out of its diffs when
+// checking out tree: the skip-worktree ones, including those the prefixes
+// of cone mode matched beyond the sparse checkout. The files tree adds
+// under skipped directories are added skipped, for apply to write those
+// the sparse checkout includes.
+func (s *sparseCheckout) syncSkipped(tree *object.Tree) error {
+	idx, err := s.r.Storer.Index()
+	if err != nil {
+		return fmt.Errorf("failed to read index: %w", err)
+	}
+
+	entries := make(map[string]*index.Entry, len(idx.Entries))
+	for _, e := range idx.Entries {
+		entries[e.Name] = e
+	}
+
+	files := make(map[string]bool, len(idx.Entries))
+
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+
+	for {
+		name, te, err := walker.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if te.Mode == filemode.Dir {
+			continue
+		}
+
+		files[name] = true
+
+		e, ok := entries[name]
+
+		switch {
+		case !ok:
+			idx.Entries = append(idx.Entries, &index.Entry{
+				Name:         name,
+				Hash:         te.Hash,
+				Mode:         te.Mode,
+				SkipWorktree: true,
+			})
+		case e.Hash != te.Hash || e.Mode != te.Mode:
+			e.Hash, e.Mode = te.Hash, te.Mode
+		}
+	}
+
+	kept := idx.Entries[:0]
+
+	for _, e := range idx.Entries {
+		if files[e.Name] || !e.SkipWorktree {
+			kept = append(kept, e)
+		}
+	}
+
+	idx.Entries = kept
+
+	return s.r.Storer.SetIndex(idx)
+}
+
+// prefixes returns the path prefixes of the files of tree in the cone mode
+// sparse checkout: the included directories, and the files at the top
+// level and directly inside their parents. A file prefix may also match
+// other paths, which reapplying the sparse checkout then removes.
+func (s *sparseCheckout) prefixes(tree *object.Tree) ([]string, error) {
+	prefixes := make([]string, 0, len(s.dirs))
+	parents := map[string]bool{".": true}
+
+	for _, dir := range s.dirs {
+		prefixes = append(prefixes, dir+"/")
+
+		for p := path.Dir(dir); p != "."; p = path.Dir(p) {
+			parents[p] = true
+		}
+	}
+
+	for p := range parents {
+		t := tree
+		if p != "." {
+			var err error
+
+			t, err = tree.Tree(p)
+			if errors.Is(err, object.ErrDirectoryNotFound) {
+				continue
+			}
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for _, e := range t.Entries {
+			if e.Mode != filemode.Dir {
+				prefixes = append(prefixes, path.Join(p, e.Name))
+			}
+		}
+	}
+
+	return prefixes, nil
+}
+
+// unskipPresent clears the skip-worktree bit of the files present in fs
+// despite the sparse checkout, for them to be compared with the index like
+// git does.
+func (s *sparseCheckout) unskipPresent(fs billy.Filesystem) error {
+	idx, err := s.r.Storer.Index()
+	if err != nil {
+		return fmt.Errorf("failed to read index: %w", err)
+	}
+
+	changed := false
+
+	for _, e := range idx.Entries {
+		if !e.SkipWorktree {
+			continue
+		}
+
+		_, err := fs.Lstat(e.Name)
+		if err != nil {
+			continue
+		}
+
+		e.SkipWorktree = false
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+
+	return s.r.Storer.SetIndex(idx)
+}
+
+// percentage returns the share of the tracked files present in the
+// worktree, and whether the worktree is sparse.
+func (s *sparseCheckout) percentage() (int, bool, error) {
+	if !s.enabled {
+		return 0, false, nil
+	}
+
+	idx, err := s.r.Storer.Index()
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read index: %w", err)
+	}
+
+	if len(idx.Entries) == 0 {
+		return 0, false, nil
+	}
+
+	skipped := 0
+
+	for _, e := range idx.Entries {
+		if e.SkipWorktree {
+			skipped++
+		}
+	}
+
+	return 100 - 100*skipped/len(idx.Entries), true, nil
+}
+
+// sparseClone checks out a freshly cloned repository with cone mode
+// sparse checkout enabled, materializing only the top-level files.
+func sparseClone(r *git.Repository, out io.Writer) error {
+	if _, err := r.Head(); errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return nil
+	}
+
+	s, err := loadSparseCheckout(r)
+	if err != nil {
+		return err
+	}
+
+	s.cone = true
+
+	err = s.enable()
+	if err != nil {
+		return err
+	}
+
+	w, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+
+	err = w.Reset(&git.ResetOptions{Mode: git.MixedReset})
+	if err != nil {
+		return fmt.Errorf("failed to populate index: %w", err)
+	}
+
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return fmt.Errorf("failed to read index: %w", err)
+	}
+
+	// Nothing is on disk yet, so start from an empty checkout and let
+	// apply write the files that are part of it.
+	for _, e := range idx.Entries {
+		e.SkipWorktree = true
+	}
+
+	err = r.Storer.SetIndex(idx)
+	if err != nil {
+		return err
+	}
+
+	return s.apply(out)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// sparseRepo returns a repository made by git with files at the top, in
+// directories and in nested directories, and a branch changing some.
+func sparseRepo(t *testing.T) string {
+	t.Helper()
+
+	dir := gitRepo(t, []string{
+		"top", "1",
+		"a/x", "1",
+		"a/deep/y", "1",
+		"b/x", "1",
+		"b/c/y", "1",
+		"b/c/d/z", "1",
+		"d/x", "1",
+	})
+
+	gitCmd(t, dir, "checkout", "-q", "-b", "other")
+	writeFile(t, dir, "b/c/y", "2")
+	writeFile(t, dir, "e/x", "2")
+	gitCmd(t, dir, "add", "-A")
+	gitCmd(t, dir, "commit", "-q", "-m", "other")
+	gitCmd(t, dir, "checkout", "-q", "main")
+
+	return dir
+}
+
+// sparseState returns what git reports of the sparse checkout of dir: its
+// patterns, configuration, skip-worktree entries, status and files.
+func sparseState(t *testing.T, dir string) string {
+	t.Helper()
+
+	var state strings.Builder
+
+	patterns, err := os.ReadFile(filepath.Join(dir, ".git", "info", "sparse-checkout"))
+	if err == nil {
+		fmt.Fprintf(&state, "patterns:\n%s", patterns)
+	}
+
+	for _, key := range []string{"core.sparseCheckout", "core.sparseCheckoutCone"} {
+		fmt.Fprintf(&state, "%s=%s", key, run(t, dir, "", "git", "config", key).stdout)
+	}
+
+	state.WriteString(gitCmd(t, dir, "ls-files", "-t"))
+	state.WriteString(gitCmd(t, dir, "status", "--short"))
+
+	err = filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+
+		if !d.IsDir() {
+			rel, _ := filepath.Rel(dir, path)
+			fmt.Fprintln(&state, filepath.ToSlash(rel))
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return state.String()
+}
+
+func TestSparseCheckout(t *testing.T) {
+	steps := [][]string{
+		{"sparse-checkout", "init", "--cone"},
+		{"sparse-checkout", "list"},
+		{"sparse-checkout", "set", "a", "b/c"},
+		{"sparse-checkout", "list"},
+		{"sparse-checkout", "add", "d"},
+		{"sparse-checkout", "list"},
+		{"checkout", "other"},
+		{"sparse-checkout", "set", "e"},
+		{"checkout", "main"},
+		{"sparse-checkout", "reapply"},
+		{"sparse-checkout", "set", "--no-cone", "/top", "*/x"},
+		{"sparse-checkout", "list"},
+		{"sparse-checkout", "disable"},
+	}
+
+	var states []string
+
+	for _, tool := range []string{"git", "gogit"} {
+		dir := sparseRepo(t)
+
+		var state strings.Builder
+
+		for _, args := range steps {
+			var res result
+			if tool == "git" {
+				res = run(t, dir, "", "git", args...)
+			} else {
+				res = gogit(t, dir, args...)
+			}
+
+			fmt.Fprintf(&state, "%v exit %v\n%s%s", args, res.code == 0, res.stdout, sparseState(t, dir))
+		}
+
+		states = append(states, state.String())
+	}
+
+	if states[1] != states[0] {
+		t.Errorf("gogit sparse-checkout gave:\n%s\nwant, as git:\n%s", states[1], states[0])
+	}
+}
+
+// TestSparseCheckoutStdin checks that patterns read from standard input
+// are set as git sets them.
+func TestSparseCheckoutStdin(t *testing.T) {
+	var states []string
+
+	for _, tool := range []string{"git", "gogit"} {
+		dir := sparseRepo(t)
+
+		args := []string{"sparse-checkout", "set", "--stdin"}
+		if tool == "git" {
+			gitCmdStdin(t, dir, "b/c\na/deep\n", args...)
+		} else {
+			res := gogitStdin(t, dir, "b/c\na/deep\n", args...)
+			if res.code != 0 {
+				t.Fatalf("gogit %v failed: %s", args, res.stderr)
+			}
+		}
+
+		states = append(states, sparseState(t, dir))
+	}
+
+	if states[1] != states[0] {
+		t.Errorf("gogit sparse-checkout set --stdin gave:\n%s\nwant, as git:\n%s", states[1], states[0])
+	}
+}
+
+func TestCloneSparse(t *testing.T) {
+	src := sparseRepo(t)
+
+	want := filepath.Join(t.TempDir(), "git")
+	gitCmd(t, "", "clone", "-q", "--sparse", src, want)
+
+	got := filepath.Join(t.TempDir(), "gogit")
+	mustGogit(t, "", "clone", "--sparse", src, got)
+
+	if g, w := sparseState(t, got), sparseState(t, want); g != w {
+		t.Errorf("gogit clone --sparse gave:\n%s\nwant, as git:\n%s", g, w)
+	}
+}
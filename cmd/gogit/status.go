@@ -0,0 +1,302 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/index"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/spf13/cobra"
+)
+
+var statusShort bool
+
+func init() {
+	statusCmd.Flags().BoolVarP(&statusShort, "short", "s", false, "Give the output in the short format")
+	rootCmd.AddCommand(statusCmd)
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status [-s | --short]",
+	Short: "Show the working tree status",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		w, err := r.Worktree()
+		if err != nil {
+			return err
+		}
+
+		sparse, err := loadSparseCheckout(r)
+		if err != nil {
+			return err
+		}
+
+		if sparse.enabled {
+			err = sparse.unskipPresent(w.Filesystem)
+			if err != nil {
+				return err
+			}
+		}
+
+		status, err := worktreeStatus(r, cmd.ErrOrStderr())
+		if err != nil {
+			return fmt.Errorf("failed to get status: %w", err)
+		}
+
+		err = stageSkipped(r, status)
+		if err != nil {
+			return err
+		}
+
+		untracked, err := untrackedPaths(r, status)
+		if err != nil {
+			return err
+		}
+
+		if statusShort {
+			printShortStatus(cmd.OutOrStdout(), status, untracked)
+
+			return nil
+		}
+
+		return printLongStatus(cmd.OutOrStdout(), sparse, status, untracked)
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// statusLabels are the names git gives to the changes of a file in the
+// long format.
+var statusLabels = map[git.StatusCode]string{
+	git.Added:              "new file:",
+	git.Modified:           "modified:",
+	git.Deleted:            "deleted:",
+	git.Renamed:            "renamed:",
+	git.Copied:             "copied:",
+	git.UpdatedButUnmerged: "unmerged:",
+}
+
+func printShortStatus(out io.Writer, status git.Status, untracked []string) {
+	for _, name := range sortedStatusPaths(status) {
+		s := status[name]
+		if s.Worktree == git.Untracked {
+			continue
+		}
+
+		fmt.Fprintf(out, "%c%c %s\n", s.Staging, s.Worktree, name)
+	}
+
+	for _, name := range untracked {
+		fmt.Fprintf(out, "?? %s\n", name)
+	}
+}
+
+func printLongStatus(out io.Writer, sparse *sparseCheckout, status git.Status, untracked []string) error {
+	r := sparse.r
+
+	head, err := r.Reference(plumbing.HEAD, false)
+	if err != nil {
+		return fmt.Errorf("failed to get HEAD: %w", err)
+	}
+
+	_, err = r.Head()
+	unborn := err != nil
+
+	if head.Type() == plumbing.SymbolicReference {
+		fmt.Fprintf(out, "On branch %s\n", head.Target().Short())
+	} else {
+		fmt.Fprintf(out, "HEAD detached at %s\n", abbreviateHash(r, head.Hash(), 7))
+	}
+
+	percentage, ok, err := sparse.percentage()
+	if err != nil {
+		return err
+	}
+
+	if ok {
+		fmt.Fprintf(out, "You are in a sparse checkout with %d%% of tracked files present.\n\n", percentage)
+	}
+
+	if unborn {
+		if !ok {
+			fmt.Fprintln(out)
+		}
+
+		fmt.Fprint(out, "No commits yet\n\n")
+	}
+
+	var staged, unstaged []string
+
+	for _, name := range sortedStatusPaths(status) {
+		s := status[name]
+
+		if s.Staging != git.Unmodified && s.Staging != git.Untracked {
+			staged = append(staged, fmt.Sprintf("%-12s%s", statusLabels[s.Staging], name))
+		}
+
+		if s.Worktree != git.Unmodified && s.Worktree != git.Untracked {
+			unstaged = append(unstaged, fmt.Sprintf("%-12s%s", statusLabels[s.Worktree], name))
+		}
+	}
+
+	printStatusSection(out, "Changes to be committed:", staged)
+	printStatusSection(out, "Changes not staged for commit:", unstaged)
+	printStatusSection(out, "Untracked files:", untracked)
+
+	switch {
+	case len(staged) > 0:
+	case len(unstaged) > 0:
+		fmt.Fprintln(out, "no changes added to commit")
+	case len(untracked) > 0:
+		fmt.Fprintln(out, "nothing added to commit but untracked files present")
+	case unborn:
+		fmt.Fprintln(out, "nothing to commit")
+	default:
+		fmt.Fprintln(out, "nothing to commit, working tree clean")
+	}
+
+	return nil
+}
+
+func printStatusSection(out io.Writer, title string, lines []string) {
+	if len(lines) == 0 {
+		return
+	}
+
+	fmt.Fprintln(out, title)
+
+	for _, l := range lines {
+		fmt.Fprintf(out, "\t%s\n", l)
+	}
+
+	fmt.Fprintln(out)
+}
+
+func sortedStatusPaths(status git.Status) []string {
+	names := make([]string, 0, len(status))
+	for name := range status {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// stageSkipped adds to status the staged changes of the skip-worktree
+// entries of the index, which go-git leaves out of it. The files of HEAD
+// missing from the index under skipped directories are added as deleted.
+func stageSkipped(r *git.Repository, status git.Status) error {
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return fmt.Errorf("failed to read index: %w", err)
+	}
+
+	if !slices.ContainsFunc(idx.Entries, func(e *index.Entry) bool { return e.SkipWorktree }) {
+		return nil
+	}
+
+	files := make(map[string]*object.File)
+
+	head, err := r.Head()
+	if err == nil {
+		commit, err := r.CommitObject(head.Hash())
+		if err != nil {
+			return err
+		}
+
+		iter, err := commit.Files()
+		if err != nil {
+			return err
+		}
+
+		err = iter.ForEach(func(f *object.File) error {
+			files[f.Name] = f
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, e := range idx.Entries {
+		f, ok := files[e.Name]
+		delete(files, e.Name)
+
+		if !e.SkipWorktree {
+			continue
+		}
+
+		switch {
+		case !ok:
+			*status.File(e.Name) = git.FileStatus{Staging: git.Added, Worktree: git.Unmodified}
+		case f.Hash != e.Hash || f.Mode != e.Mode:
+			*status.File(e.Name) = git.FileStatus{Staging: git.Modified, Worktree: git.Unmodified}
+		}
+	}
+
+	for name := range files {
+		if _, ok := status[name]; !ok {
+			*status.File(name) = git.FileStatus{Staging: git.Deleted, Worktree: git.Unmodified}
+		}
+	}
+
+	return nil
+}
+
+// untrackedPaths returns the untracked files of status, a directory
+// holding no tracked file being shown once as such, like git does.
+func untrackedPaths(r *git.Repository, status git.Status) ([]string, error) {
+	idx, err := r.Storer.Index()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index: %w", err)
+	}
+
+	tracked := make(map[string]bool)
+
+	for _, e := range idx.Entries {
+		for dir := path.Dir(e.Name); dir != "."; dir = path.Dir(dir) {
+			tracked[dir] = true
+		}
+	}
+
+	seen := make(map[string]bool)
+
+	var paths []string
+
+	for _, name := range sortedStatusPaths(status) {
+		if status[name].Worktree != git.Untracked {
+			continue
+		}
+
+		p := name
+
+		parts := strings.Split(name, "/")
+		for i := 1; i < len(parts); i++ {
+			dir := strings.Join(parts[:i], "/")
+			if !tracked[dir] {
+				p = dir + "/"
+
+				break
+			}
+		}
+
+		if !seen[p] {
+			seen[p] = true
+			paths = append(paths, p)
+		}
+	}
+
+	return paths, nil
+}
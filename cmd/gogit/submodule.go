@@ -0,0 +1,930 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-billy/v6/util"
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/config"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/client"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/spf13/cobra"
+)
+
+const gitmodulesFile = ".gitmodules"
+
+var (
+	submoduleInit      bool
+	submoduleRecursive bool
+	submoduleRemote    bool
+	submoduleDepth     int
+	submoduleForce     bool
+	submoduleAll       bool
+	submoduleBranch    string
+	submoduleName      string
+)
+
+func init() {
+	submoduleUpdateCmd.Flags().BoolVarP(&submoduleInit, "init", "", false, "Initialize uninitialized submodules before updating")
+	submoduleUpdateCmd.Flags().BoolVarP(&submoduleRemote, "remote", "", false, "Update to the remote-tracking branch instead of the recorded commit")
+	submoduleUpdateCmd.Flags().IntVarP(&submoduleDepth, "depth", "", 0, "Create shallow clones of that depth")
+	submoduleAddCmd.Flags().IntVarP(&submoduleDepth, "depth", "", 0, "Create a shallow clone of that depth")
+	submoduleAddCmd.Flags().StringVarP(&submoduleBranch, "branch", "b", "", "Branch of the repository to add as submodule")
+	submoduleAddCmd.Flags().StringVarP(&submoduleName, "name", "", "", "Logical name of the submodule")
+	submoduleDeinitCmd.Flags().BoolVarP(&submoduleForce, "force", "f", false, "Remove submodule working trees even with local changes")
+	submoduleDeinitCmd.Flags().BoolVarP(&submoduleAll, "all", "", false, "Unregister all submodules")
+
+	for _, c := range []*cobra.Command{submoduleUpdateCmd, submoduleStatusCmd, submoduleSyncCmd, submoduleForeachCmd} {
+		c.Flags().BoolVarP(&submoduleRecursive, "recursive", "", false, "Recurse into nested submodules")
+	}
+
+	// The command run by "submodule foreach" keeps its own flags.
+	submoduleForeachCmd.Flags().SetInterspersed(false)
+
+	submoduleCmd.AddCommand(submoduleInitCmd)
+	submoduleCmd.AddCommand(submoduleUpdateCmd)
+	submoduleCmd.AddCommand(submoduleStatusCmd)
+	submoduleCmd.AddCommand(submoduleSyncCmd)
+	submoduleCmd.AddCommand(submoduleForeachCmd)
+	submoduleCmd.AddCommand(submoduleAddCmd)
+	submoduleCmd.AddCommand(submoduleDeinitCmd)
+	rootCmd.AddCommand(submoduleCmd)
+}
+
+var submoduleCmd = &cobra.Command{
+	Use:   "submodule <command>",
+	Short: "Initialize, update or inspect submodules",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return submoduleStatusCmd.RunE(cmd, args)
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var submoduleInitCmd = &cobra.Command{
+	Use:   "init [<path>...]",
+	Short: "Register submodules in the repository configuration",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, subs, err := openSubmodules(".", args)
+		if err != nil {
+			return err
+		}
+
+		for _, sub := range subs {
+			err := sub.Init()
+			if errors.Is(err, git.ErrSubmoduleAlreadyInitialized) {
+				continue
+			}
+
+			if err != nil {
+				return fmt.Errorf("failed to initialize submodule '%s': %w", sub.Config().Path, err)
+			}
+
+			c := sub.Config()
+			fmt.Fprintf(cmd.OutOrStdout(), "Submodule '%s' (%s) registered for path '%s'\n", c.Name, c.URL, c.Path)
+		}
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var submoduleUpdateCmd = &cobra.Command{
+	Use:   "update [--init] [--recursive] [--remote] [--depth <depth>] [<path>...]",
+	Short: "Update the registered submodules to match the superproject",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, subs, err := openSubmodules(".", args)
+		if err != nil {
+			return err
+		}
+
+		recursion := git.NoRecurseSubmodules
+		if submoduleRecursive {
+			recursion = git.DefaultSubmoduleRecursionDepth
+		}
+
+		for _, sub := range subs {
+			opts := git.SubmoduleUpdateOptions{
+				Init:              submoduleInit,
+				RecurseSubmodules: recursion,
+				ClientOptions:     submoduleClientOptions(sub),
+				Depth:             submoduleDepth,
+			}
+
+			if submoduleRemote {
+				err = updateSubmoduleRemote(cmd.OutOrStdout(), sub, &opts)
+			} else {
+				err = updateSubmodule(cmd.OutOrStdout(), sub, &opts)
+			}
+
+			if errors.Is(err, git.ErrSubmoduleNotInitialized) {
+				continue
+			}
+
+			if err != nil {
+				return fmt.Errorf("failed to update submodule '%s': %w", sub.Config().Path, err)
+			}
+		}
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var submoduleStatusCmd = &cobra.Command{
+	Use:   "status [--recursive] [<path>...]",
+	Short: "Show the status of the submodules",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, subs, err := openSubmodules(".", args)
+		if err != nil {
+			return err
+		}
+
+		return printSubmoduleStatus(cmd.OutOrStdout(), subs, "")
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var submoduleSyncCmd = &cobra.Command{
+	Use:   "sync [--recursive] [<path>...]",
+	Short: "Synchronize submodule remote URLs with .gitmodules",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, subs, err := openSubmodules(".", args)
+		if err != nil {
+			return err
+		}
+
+		return syncSubmodules(cmd.OutOrStdout(), r, subs, "")
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var submoduleForeachCmd = &cobra.Command{
+	Use:   "foreach [--recursive] <command>",
+	Short: "Run a shell command in each checked out submodule",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, subs, err := openSubmodules(".", nil)
+		if err != nil {
+			return err
+		}
+
+		w, err := r.Worktree()
+		if err != nil {
+			return err
+		}
+
+		toplevel, err := filepath.Abs(w.Filesystem.Root())
+		if err != nil {
+			return err
+		}
+
+		return foreachSubmodule(cmd, toplevel, subs, "", strings.Join(args, " "))
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var submoduleAddCmd = &cobra.Command{
+	Use:   "add [-b <branch>] [--name <name>] [--depth <depth>] <repository> [<path>]",
+	Short: "Add a repository as a submodule",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		repoURL := args[0]
+
+		p := strings.TrimSuffix(path.Base(repoURL), ".git")
+		if len(args) > 1 {
+			p = path.Clean(filepath.ToSlash(args[1]))
+		}
+
+		name := p
+		if submoduleName != "" {
+			name = submoduleName
+		}
+
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		w, err := r.Worktree()
+		if err != nil {
+			return err
+		}
+
+		idx, err := r.Storer.Index()
+		if err != nil {
+			return fmt.Errorf("failed to read index: %w", err)
+		}
+
+		if _, err := idx.Entry(p); err == nil {
+			return fmt.Errorf("'%s' already exists in the index", p)
+		}
+
+		if _, err := w.Submodule(name); err == nil {
+			return fmt.Errorf("a submodule named '%s' already exists", name)
+		}
+
+		err = appendGitmodules(w.Filesystem, name, p, repoURL, submoduleBranch)
+		if err != nil {
+			return err
+		}
+
+		err = w.Filesystem.MkdirAll(p, 0o755)
+		if err != nil {
+			return fmt.Errorf("failed to create submodule directory: %w", err)
+		}
+
+		sub, err := w.Submodule(name)
+		if err != nil {
+			return err
+		}
+
+		err = sub.Init()
+		if err != nil && !errors.Is(err, git.ErrSubmoduleAlreadyInitialized) {
+			return fmt.Errorf("failed to initialize submodule: %w", err)
+		}
+
+		fmt.Fprintf(cmd.ErrOrStderr(), "Cloning into '%s'...\n", filepath.Join(w.Filesystem.Root(), p))
+
+		sr, err := sub.Repository()
+		if err != nil {
+			return fmt.Errorf("failed to create submodule repository: %w", err)
+		}
+
+		clientOpts := submoduleClientOptions(sub)
+
+		var h plumbing.Hash
+
+		err = inRefTransaction(newHooks(sr, cmd.ErrOrStderr()), staticReflogMessage("clone: from "+sub.Config().URL), func() error {
+			err := sr.Fetch(&git.FetchOptions{ClientOptions: clientOpts, Depth: submoduleDepth})
+			if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+				return fmt.Errorf("failed to fetch submodule: %w", err)
+			}
+
+			var branch string
+
+			branch, h, err = submoduleRemoteTip(sr, submoduleBranch, clientOpts)
+			if err != nil {
+				return err
+			}
+
+			sw, err := sr.Worktree()
+			if err != nil {
+				return err
+			}
+
+			err = sw.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName(branch), Hash: h, Create: true})
+			if err != nil {
+				return fmt.Errorf("failed to checkout submodule: %w", err)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		err = smudgeWorktree(sr, cmd.ErrOrStderr(), nil)
+		if err != nil {
+			return err
+		}
+
+		// Record the submodule as a gitlink next to the updated .gitmodules.
+		_, err = w.Add(gitmodulesFile)
+		if err != nil {
+			return fmt.Errorf("failed to stage %s: %w", gitmodulesFile, err)
+		}
+
+		idx, err = r.Storer.Index()
+		if err != nil {
+			return fmt.Errorf("failed to read index: %w", err)
+		}
+
+		e := idx.Add(p)
+		e.Mode = filemode.Submodule
+		e.Hash = h
+
+		return r.Storer.SetIndex(idx)
+	},
+	DisableFlagsInUseLine: true,
+}
+
+var submoduleDeinitCmd = &cobra.Command{
+	Use:   "deinit [-f] [--all] [<path>...]",
+	Short: "Unregister submodules and clear their working trees",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 && !submoduleAll {
+			return errors.New("use '--all' if you really want to deinitialize all submodules")
+		}
+
+		r, subs, err := openSubmodules(".", args)
+		if err != nil {
+			return err
+		}
+
+		w, err := r.Worktree()
+		if err != nil {
+			return err
+		}
+
+		cfg, err := r.Config()
+		if err != nil {
+			return fmt.Errorf("failed to get repository config: %w", err)
+		}
+
+		out := cmd.OutOrStdout()
+
+		for _, sub := range subs {
+			c := sub.Config()
+
+			if sr, err := sub.Repository(); err == nil && !submoduleForce {
+				sw, err := sr.Worktree()
+				if err != nil {
+					return err
+				}
+
+				status, err := sw.Status()
+				if err != nil {
+					return err
+				}
+
+				if !status.IsClean() {
+					return fmt.Errorf("submodule work tree '%s' contains local modifications; use '-f' to discard them", c.Path)
+				}
+			}
+
+			entries, err := w.Filesystem.ReadDir(c.Path)
+			if err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to read '%s': %w", c.Path, err)
+			}
+
+			for _, e := range entries {
+				err := util.RemoveAll(w.Filesystem, w.Filesystem.Join(c.Path, e.Name()))
+				if err != nil {
+					return fmt.Errorf("failed to clear '%s': %w", c.Path, err)
+				}
+			}
+
+			fmt.Fprintf(out, "Cleared directory '%s'\n", c.Path)
+
+			if _, ok := cfg.Submodules[c.Name]; ok {
+				delete(cfg.Submodules, c.Name)
+				fmt.Fprintf(out, "Submodule '%s' (%s) unregistered for path '%s'\n", c.Name, c.URL, c.Path)
+			}
+		}
+
+		return r.SetConfig(cfg)
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// openSubmodules opens the repository at dir and returns its submodules,
+// limited to those whose path is listed in paths, if any.
+func openSubmodules(dir string, paths []string) (*git.Repository, git.Submodules, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	subs, err := repositorySubmodules(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(paths) == 0 {
+		return r, subs, nil
+	}
+
+	var selected git.Submodules
+
+	for _, p := range paths {
+		p = path.Clean(filepath.ToSlash(p))
+
+		found := false
+
+		for _, sub := range subs {
+			if sub.Config().Path == p {
+				selected = append(selected, sub)
+				found = true
+			}
+		}
+
+		if !found {
+			return nil, nil, fmt.Errorf("pathspec '%s' did not match any submodule", p)
+		}
+	}
+
+	return r, selected, nil
+}
+
+func repositorySubmodules(r *git.Repository) (git.Submodules, error) {
+	w, err := r.Worktree()
+	if err != nil {
+		return nil, err
+	}
+
+	subs, err := w.Submodules()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read submodules: %w", err)
+	}
+
+	return subs, nil
+}
+
+// submoduleClientOptions returns the transport options for the URL of sub.
+func submoduleClientOptions(sub *git.Submodule) []client.Option {
+	ep, err := url.Parse(sub.Config().URL)
+	if err != nil {
+		return nil
+	}
+
+	return defaultClientOptions(ep)
+}
+
+// updateSubmodule checks out the commit recorded in the superproject.
+func updateSubmodule(out io.Writer, sub *git.Submodule, opts *git.SubmoduleUpdateOptions) error {
+	status, err := sub.Status()
+	if err != nil {
+		return err
+	}
+
+	err = sub.Update(opts)
+	if err != nil {
+		return err
+	}
+
+	if status.Current != status.Expected {
+		fmt.Fprintf(out, "Submodule path '%s': checked out '%s'\n", status.Path, status.Expected)
+	}
+
+	return nil
+}
+
+// updateSubmoduleRemote checks out the tip of the branch tracked by sub
+// instead of the commit recorded in the superproject.
+func updateSubmoduleRemote(out io.Writer, sub *git.Submodule, opts *git.SubmoduleUpdateOptions) error {
+	if opts.Init {
+		err := sub.Init()
+		if err != nil && !errors.Is(err, git.ErrSubmoduleAlreadyInitialized) {
+			return err
+		}
+	}
+
+	sr, err := sub.Repository()
+	if err != nil {
+		return err
+	}
+
+	err = sr.Fetch(&git.FetchOptions{ClientOptions: opts.ClientOptions, Depth: opts.Depth})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return err
+	}
+
+	_, h, err := submoduleRemoteTip(sr, sub.Config().Branch, opts.ClientOptions)
+	if err != nil {
+		return err
+	}
+
+	sw, err := sr.Worktree()
+	if err != nil {
+		return err
+	}
+
+	var from plumbing.Hash
+	if head, err := sr.Head(); err == nil {
+		from = head.Hash()
+	}
+
+	err = sw.Checkout(&git.CheckoutOptions{Hash: h})
+	if err != nil {
+		return err
+	}
+
+	changed, err := checkedOutPaths(sr, from, h)
+	if err != nil {
+		return err
+	}
+
+	err = smudgeWorktree(sr, os.Stderr, changed)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Submodule path '%s': checked out '%s'\n", sub.Config().Path, h)
+
+	if opts.RecurseSubmodules == git.NoRecurseSubmodules {
+		return nil
+	}
+
+	nested, err := repositorySubmodules(sr)
+	if err != nil {
+		return err
+	}
+
+	nestedOpts := *opts
+	nestedOpts.RecurseSubmodules--
+
+	for _, n := range nested {
+		err := updateSubmoduleRemote(out, n, &nestedOpts)
+		if err != nil && !errors.Is(err, git.ErrSubmoduleNotInitialized) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// submoduleRemoteTip returns the branch of origin a submodule follows and
+// the commit it points at. Without an explicit branch, the branch the
+// remote HEAD points at is used.
+func submoduleRemoteTip(r *git.Repository, branch string, clientOpts []client.Option) (string, plumbing.Hash, error) {
+	if branch == "" {
+		remote, err := r.Remote(git.DefaultRemoteName)
+		if err != nil {
+			return "", plumbing.ZeroHash, err
+		}
+
+		refs, err := remote.List(&git.ListOptions{ClientOptions: clientOpts})
+		if err != nil {
+			return "", plumbing.ZeroHash, fmt.Errorf("failed to list remote references: %w", err)
+		}
+
+		for _, ref := range refs {
+			if ref.Name() == plumbing.HEAD && ref.Type() == plumbing.SymbolicReference {
+				branch = ref.Target().Short()
+			}
+		}
+
+		if branch == "" {
+			return "", plumbing.ZeroHash, errors.New("unable to find the remote HEAD branch")
+		}
+	}
+
+	ref, err := r.Reference(plumbing.NewRemoteReferenceName(git.DefaultRemoteName, branch), true)
+	if err != nil {
+		return "", plumbing.ZeroHash, fmt.Errorf("unable to find remote branch '%s': %w", branch, err)
+	}
+
+	return branch, ref.Hash(), nil
+}
+
+// printSubmoduleStatus writes the status line of every submodule, with
+// paths relative to the top-level superproject.
+func printSubmoduleStatus(out io.Writer, subs git.Submodules, prefix string) error {
+	for _, sub := range subs {
+		status, err := sub.Status()
+		if err != nil {
+			return fmt.Errorf("failed to get status of submodule '%s': %w", sub.Config().Path, err)
+		}
+
+		status.Path = path.Join(prefix, status.Path)
+
+		line, err := submoduleStatusLine(sub, status)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(out, line)
+
+		if !submoduleRecursive {
+			continue
+		}
+
+		sr, err := sub.Repository()
+		if errors.Is(err, git.ErrSubmoduleNotInitialized) {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		nested, err := repositorySubmodules(sr)
+		if err != nil {
+			return err
+		}
+
+		err = printSubmoduleStatus(out, nested, status.Path)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// submoduleStatusLine formats the status of a submodule as git does: the
+// commit recorded for an uninitialized submodule, or else the commit checked
+// out, prefixed with '+' when it is not the recorded one, and named after
+// the references of the submodule.
+func submoduleStatusLine(sub *git.Submodule, status *git.SubmoduleStatus) (string, error) {
+	if status.Current.IsZero() {
+		return fmt.Sprintf("-%s %s", status.Expected, status.Path), nil
+	}
+
+	state, h := ' ', status.Expected
+	if !status.IsClean() {
+		state, h = '+', status.Current
+	}
+
+	sr, err := sub.Repository()
+	if err != nil {
+		return "", err
+	}
+
+	name, err := submoduleRevName(sr, h)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%c%s %s (%s)", state, h, status.Path, name), nil
+}
+
+// submoduleRevName names a commit of a submodule the way git submodule
+// status does, with the first of git describe, describe --tags, describe
+// --contains and describe --all --always that succeeds.
+func submoduleRevName(r *git.Repository, h plumbing.Hash) (string, error) {
+	for _, describe := range []func() (string, bool, error){
+		func() (string, bool, error) { return describeCommit(r, h, false, false) },
+		func() (string, bool, error) { return describeCommit(r, h, true, false) },
+		func() (string, bool, error) { return containingTagName(r, h) },
+		func() (string, bool, error) { return describeCommit(r, h, false, true) },
+	} {
+		name, ok, err := describe()
+		if err != nil {
+			return "", err
+		}
+
+		if ok {
+			return name, nil
+		}
+	}
+
+	return abbreviateHash(r, h, 7), nil
+}
+
+// syncSubmodules copies the URLs recorded in .gitmodules into the
+// configuration of r and into the origin remote of every submodule.
+func syncSubmodules(out io.Writer, r *git.Repository, subs git.Submodules, prefix string) error {
+	cfg, err := r.Config()
+	if err != nil {
+		return fmt.Errorf("failed to get repository config: %w", err)
+	}
+
+	urls, err := gitmodulesURLs(r)
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range subs {
+		c := sub.Config()
+
+		registered, ok := cfg.Submodules[c.Name]
+		if !ok || urls[c.Name] == "" {
+			continue
+		}
+
+		fmt.Fprintf(out, "Synchronizing submodule url for '%s'\n", path.Join(prefix, c.Path))
+
+		registered.URL = urls[c.Name]
+
+		sr, err := sub.Repository()
+		if err != nil {
+			return err
+		}
+
+		subCfg, err := sr.Config()
+		if err != nil {
+			return err
+		}
+
+		if remote, ok := subCfg.Remotes[git.DefaultRemoteName]; ok {
+			remote.URLs = []string{urls[c.Name]}
+
+			err = sr.SetConfig(subCfg)
+			if err != nil {
+				return err
+			}
+		}
+
+		if !submoduleRecursive {
+			continue
+		}
+
+		nested, err := repositorySubmodules(sr)
+		if err != nil {
+			return err
+		}
+
+		err = syncSubmodules(out, sr, nested, path.Join(prefix, c.Path))
+		if err != nil {
+			return err
+		}
+	}
+
+	return r.SetConfig(cfg)
+}
+
+// gitmodulesURLs returns the URL of every submodule as recorded in
+// .gitmodules. Unlike Submodule.Config, it ignores the URLs registered in
+// the repository configuration. Relative URLs are resolved against origin.
+func gitmodulesURLs(r *git.Repository) (map[string]string, error) {
+	w, err := r.Worktree()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := util.ReadFile(w.Filesystem, gitmodulesFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", gitmodulesFile, err)
+	}
+
+	modules := config.NewModules()
+
+	err = modules.Unmarshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", gitmodulesFile, err)
+	}
+
+	var origin string
+	if remote, err := r.Remote(git.DefaultRemoteName); err == nil && len(remote.Config().URLs) > 0 {
+		origin = remote.Config().URLs[0]
+	}
+
+	urls := make(map[string]string, len(modules.Submodules))
+
+	for name, m := range modules.Submodules {
+		u := m.URL
+		if origin != "" && (strings.HasPrefix(u, "./") || strings.HasPrefix(u, "../")) {
+			base, err := url.Parse(origin)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve submodule URL %q: %w", u, err)
+			}
+
+			base.Path = path.Join(base.Path, u)
+			u = base.String()
+		}
+
+		urls[name] = u
+	}
+
+	return urls, nil
+}
+
+// foreachSubmodule runs script in every checked out submodule, exposing
+// the same variables git does.
+func foreachSubmodule(cmd *cobra.Command, toplevel string, subs git.Submodules, prefix, script string) error {
+	for _, sub := range subs {
+		c := sub.Config()
+
+		sr, err := sub.Repository()
+		if errors.Is(err, git.ErrSubmoduleNotInitialized) {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		head, err := sr.Head()
+		if err != nil {
+			continue
+		}
+
+		displayPath := path.Join(prefix, c.Path)
+		fmt.Fprintf(cmd.OutOrStdout(), "Entering '%s'\n", displayPath)
+
+		sh := exec.Command("sh", "-c", script)
+		sh.Dir = filepath.Join(toplevel, filepath.FromSlash(displayPath))
+		sh.Stdin = os.Stdin
+		sh.Stdout = cmd.OutOrStdout()
+		sh.Stderr = cmd.ErrOrStderr()
+		sh.Env = append(os.Environ(),
+			"name="+c.Name,
+			"sm_path="+c.Path,
+			"displaypath="+displayPath,
+			"sha1="+head.Hash().String(),
+			"toplevel="+filepath.Join(toplevel, filepath.FromSlash(prefix)),
+		)
+
+		err = sh.Run()
+		if err != nil {
+			return fmt.Errorf("stopping at '%s'; script returned non-zero status: %w", displayPath, err)
+		}
+
+		if !submoduleRecursive {
+			continue
+		}
+
+		nested, err := repositorySubmodules(sr)
+		if err != nil {
+			return err
+		}
+
+		err = foreachSubmodule(cmd, toplevel, nested, displayPath, script)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fetchSubmodules fetches the origin of every checked out submodule of r,
+// recursing into nested submodules.
+func fetchSubmodules(out io.Writer, r *git.Repository, prefix string, depth int) error {
+	subs, err := repositorySubmodules(r)
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range subs {
+		sr, err := sub.Repository()
+		if errors.Is(err, git.ErrSubmoduleNotInitialized) {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		p := path.Join(prefix, sub.Config().Path)
+		fmt.Fprintf(out, "Fetching submodule %s\n", p)
+
+		err = sr.Fetch(&git.FetchOptions{ClientOptions: submoduleClientOptions(sub), Depth: depth})
+		if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+			return fmt.Errorf("failed to fetch submodule '%s': %w", p, err)
+		}
+
+		err = fetchSubmodules(out, sr, p, depth)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkoutSubmodules moves every initialized submodule to the commit
+// recorded in the superproject, without fetching.
+func checkoutSubmodules(r *git.Repository) error {
+	subs, err := repositorySubmodules(r)
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range subs {
+		err := sub.Update(&git.SubmoduleUpdateOptions{
+			NoFetch:           true,
+			RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
+		})
+		if errors.Is(err, git.ErrSubmoduleNotInitialized) {
+			continue
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to update submodule '%s': %w", sub.Config().Path, err)
+		}
+	}
+
+	return nil
+}
+
+// appendGitmodules registers a submodule in the .gitmodules file. The
+// section is appended so that existing entries keep their order.
+func appendGitmodules(fs billy.Filesystem, name, p, repoURL, branch string) error {
+	data, err := util.ReadFile(fs, gitmodulesFile)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", gitmodulesFile, err)
+	}
+
+	var b strings.Builder
+
+	b.Write(data)
+
+	if len(data) > 0 && !strings.HasSuffix(string(data), "\n") {
+		b.WriteString("\n")
+	}
+
+	fmt.Fprintf(&b, "[submodule %q]\n\tpath = %s\n\turl = %s\n", name, p, repoURL)
+
+	if branch != "" {
+		fmt.Fprintf(&b, "\tbranch = %s\n", branch)
+	}
+
+	err = util.WriteFile(fs, gitmodulesFile, []byte(b.String()), 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", gitmodulesFile, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// allowFile lets git clone submodules from local paths.
+var allowFile = []string{"-c", "protocol.file.allow=always"}
+
+// superproject returns a repository made by git with a submodule whose
+// history has annotated and lightweight tags and a merged branch.
+func superproject(t *testing.T) string {
+	t.Helper()
+
+	sub := gitRepo(t, []string{"a", "1"}, []string{"a", "2"})
+	gitCmd(t, sub, "tag", "-a", "-m", "v1", "v1")
+	gitCmd(t, sub, "checkout", "-q", "-b", "topic")
+	writeFile(t, sub, "b", "1")
+	gitCmd(t, sub, "add", "b")
+	gitCmd(t, sub, "commit", "-q", "-m", "topic")
+	gitCmd(t, sub, "tag", "light")
+	gitCmd(t, sub, "checkout", "-q", "main")
+	gitCmd(t, sub, "merge", "-q", "--no-ff", "-m", "merge", "topic")
+	writeFile(t, sub, "a", "3")
+	gitCmd(t, sub, "commit", "-q", "-a", "-m", "commit 3")
+
+	super := gitRepo(t, []string{"c", "1"})
+	gitCmd(t, super, append(allowFile, "submodule", "add", "-q", sub, "s")...)
+	gitCmd(t, super, "commit", "-q", "-m", "add s")
+
+	return super
+}
+
+func TestSubmoduleStatus(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "clone")
+	gitCmd(t, "", append(allowFile, "clone", "-q", "--recurse-submodules", superproject(t), dir)...)
+
+	sub := filepath.Join(dir, "s")
+
+	sameOutput(t, dir, "submodule", "status")
+
+	// Every commit of the submodule is named the way git names it, from
+	// its tags, the tags containing it, or its branches.
+	for _, rev := range strings.Fields(gitCmd(t, sub, "rev-list", "--all")) {
+		gitCmd(t, sub, "checkout", "-q", rev)
+		sameOutput(t, dir, "submodule", "status")
+	}
+
+	gitCmd(t, sub, "tag", "-d", "v1", "light")
+
+	for _, rev := range strings.Fields(gitCmd(t, sub, "rev-list", "--all")) {
+		gitCmd(t, sub, "checkout", "-q", rev)
+		sameOutput(t, dir, "submodule", "status")
+	}
+}
+
+func TestSubmoduleStatusUninitialized(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "clone")
+	gitCmd(t, "", "clone", "-q", superproject(t), dir)
+
+	if out := sameOutput(t, dir, "submodule", "status"); !strings.HasPrefix(out, "-") {
+		t.Errorf("submodule status of an uninitialized submodule: %q", out)
+	}
+}
+
+// submoduleStates returns the state and commit of every submodule of dir,
+// as git submodule status gives them.
+func submoduleStates(t *testing.T, dir string) []string {
+	t.Helper()
+
+	var states []string
+	for _, line := range strings.Split(strings.TrimSpace(gitCmd(t, dir, "submodule", "status")), "\n") {
+		states = append(states, strings.Join(strings.Fields(line)[:2], " "))
+	}
+
+	return states
+}
+
+func TestSubmoduleUpdate(t *testing.T) {
+	super := superproject(t)
+
+	want := filepath.Join(t.TempDir(), "git")
+	gitCmd(t, "", append(allowFile, "clone", "-q", "--recurse-submodules", super, want)...)
+
+	got := filepath.Join(t.TempDir(), "gogit")
+	mustGogit(t, "", "clone", super, got)
+	mustGogit(t, got, "submodule", "init")
+	mustGogit(t, got, "submodule", "update")
+
+	if g, w := submoduleStates(t, got), submoduleStates(t, want); strings.Join(g, "\n") != strings.Join(w, "\n") {
+		t.Errorf("submodule update gave %q, want as git %q", g, w)
+	}
+
+	if g, w := gitCmd(t, got, "config", "submodule.s.url"), gitCmd(t, want, "config", "submodule.s.url"); g != w {
+		t.Errorf("submodule init registered %q, want as git %q", g, w)
+	}
+
+	gitCmd(t, got, "fsck")
+}
+
+func TestCloneRecurseSubmodules(t *testing.T) {
+	super := superproject(t)
+
+	want := filepath.Join(t.TempDir(), "git")
+	gitCmd(t, "", append(allowFile, "clone", "-q", "--recurse-submodules", super, want)...)
+
+	got := filepath.Join(t.TempDir(), "gogit")
+	mustGogit(t, "", "clone", "--recurse-submodules", super, got)
+
+	if g, w := submoduleStates(t, got), submoduleStates(t, want); strings.Join(g, "\n") != strings.Join(w, "\n") {
+		t.Errorf("clone --recurse-submodules gave %q, want as git %q", g, w)
+	}
+
+	if !exists(t, got, "s/b") {
+		t.Error("clone --recurse-submodules did not check out the submodule")
+	}
+}
+
+func TestSubmoduleForeach(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "clone")
+	gitCmd(t, "", append(allowFile, "clone", "-q", "--recurse-submodules", superproject(t), dir)...)
+
+	sameOutput(t, dir, "submodule", "foreach", `echo "$name $sm_path $displaypath $sha1"; git rev-parse HEAD`)
+}
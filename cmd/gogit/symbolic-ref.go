@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/format/reflog"
+	"github.com/spf13/cobra"
+)
+
+var (
+	symbolicRefMessage string
+	symbolicRefDelete  bool
+	symbolicRefQuiet   bool
+	symbolicRefShort   bool
+)
+
+func init() {
+	symbolicRefCmd.Flags().StringVarP(&symbolicRefMessage, "message", "m", "", "Reason recorded in the reflog of HEAD")
+	symbolicRefCmd.Flags().BoolVarP(&symbolicRefDelete, "delete", "d", false, "Delete the symbolic reference")
+	symbolicRefCmd.Flags().BoolVarP(&symbolicRefQuiet, "quiet", "q", false, "Do not report references that are not symbolic")
+	symbolicRefCmd.Flags().BoolVarP(&symbolicRefShort, "short", "", false, "Shorten the reference name when reading")
+	rootCmd.AddCommand(symbolicRefCmd)
+}
+
+var symbolicRefCmd = &cobra.Command{
+	Use:   "symbolic-ref [-m <reason>] <name> <ref> | [-q] [--short] <name> | -d [-q] <name>",
+	Short: "Read, modify and delete symbolic references",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		name := plumbing.ReferenceName(args[0])
+
+		if len(args) == 2 {
+			return setSymbolicRef(r, name, plumbing.ReferenceName(args[1]))
+		}
+
+		ref, err := r.Storer.Reference(name)
+		if err != nil || ref.Type() != plumbing.SymbolicReference {
+			if symbolicRefQuiet {
+				cmd.SilenceErrors = true
+				cmd.SilenceUsage = true
+
+				return exitStatus(1)
+			}
+
+			return fmt.Errorf("ref %s is not a symbolic ref", name)
+		}
+
+		if symbolicRefDelete {
+			if name == plumbing.HEAD {
+				return errors.New("deleting 'HEAD' is not allowed")
+			}
+
+			return r.Storer.RemoveReference(name)
+		}
+
+		target := ref.Target().String()
+		if symbolicRefShort {
+			target = ref.Target().Short()
+		}
+
+		fmt.Fprintln(cmd.OutOrStdout(), target)
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// setSymbolicRef points name at target, logging the change of HEAD when a
+// reason is given.
+func setSymbolicRef(r *git.Repository, name, target plumbing.ReferenceName) error {
+	if name == plumbing.HEAD && !strings.HasPrefix(target.String(), "refs/") {
+		return errors.New("refusing to point HEAD outside of refs/")
+	}
+
+	var from plumbing.Hash
+
+	if head, err := r.Head(); err == nil && name == plumbing.HEAD {
+		from = head.Hash()
+	}
+
+	err := r.Storer.SetReference(plumbing.NewSymbolicReference(name, target))
+	if err != nil {
+		return fmt.Errorf("failed to set %s: %w", name, err)
+	}
+
+	if symbolicRefMessage == "" || name != plumbing.HEAD {
+		return nil
+	}
+
+	to := from
+	if head, err := r.Head(); err == nil {
+		to = head.Hash()
+	}
+
+	rs, err := reflogStorer(r)
+	if err != nil {
+		return err
+	}
+
+	return rs.AppendReflog(plumbing.HEAD, &reflog.Entry{
+		OldHash:   from,
+		NewHash:   to,
+		Committer: reflogSignature(r),
+		Message:   symbolicRefMessage,
+	})
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing/format/packfile"
+	"github.com/go-git/go-git/v6/plumbing/storer"
+	"github.com/go-git/go-git/v6/storage/memory"
+	"github.com/spf13/cobra"
+)
+
+var unpackObjectsDryRun bool
+
+func init() {
+	unpackObjectsCmd.Flags().BoolVarP(&unpackObjectsDryRun, "dry-run", "n", false, "Check the pack without writing the objects")
+	rootCmd.AddCommand(unpackObjectsCmd)
+}
+
+var unpackObjectsCmd = &cobra.Command{
+	Use:   "unpack-objects [-n] < <pack-file>",
+	Short: "Unpack the objects of a pack read from the standard input",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		of, err := packObjectFormat(r, "")
+		if err != nil {
+			return err
+		}
+
+		// The objects are written as loose objects, rather than handed to
+		// the storage as a pack. Thin packs are resolved against the
+		// objects already in the repository. The standard input is read
+		// as a stream: when it is a pipe it cannot seek, though it is a
+		// file.
+		var s storer.EncodedObjectStorer = r.Storer
+		if unpackObjectsDryRun {
+			s = &overlayStorage{EncodedObjectStorer: memory.NewStorage(), base: r.Storer}
+		}
+
+		_, err = packfile.NewParser(struct{ io.Reader }{cmd.InOrStdin()},
+			packfile.WithStorage(s),
+			packfile.WithObjectFormat(of),
+		).Parse()
+		if err != nil && !errors.Is(err, packfile.ErrEmptyPackfile) {
+			return fmt.Errorf("failed to unpack objects: %w", err)
+		}
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+)
+
+// TestUnpackObjects checks that the objects of a pack made by git are
+// written as loose objects.
+func TestUnpackObjects(t *testing.T) {
+	src := packRepo(t)
+	pack := string(gitPack(t, src, "main\n"))
+
+	dir := gitRepo(t)
+
+	res := gogitStdin(t, dir, pack, "unpack-objects", "-n")
+	if res.code != 0 {
+		t.Fatalf("gogit unpack-objects -n failed: %s", res.stderr)
+	}
+
+	if got := gitCmd(t, dir, "count-objects"); got != "0 objects, 0 kilobytes\n" {
+		t.Errorf("gogit unpack-objects -n wrote objects: %s", got)
+	}
+
+	res = gogitStdin(t, dir, pack, "unpack-objects")
+	if res.code != 0 {
+		t.Fatalf("gogit unpack-objects failed: %s", res.stderr)
+	}
+
+	if globPacks(t, dir, "*.pack") != nil {
+		t.Error("gogit unpack-objects stored a pack")
+	}
+
+	list := []string{"cat-file", "--batch-all-objects", "--batch-check"}
+	if got, want := gitCmd(t, dir, list...), gitCmd(t, src, list...); got != want {
+		t.Errorf("gogit unpack-objects wrote the objects:\n%s\nwant:\n%s", got, want)
+	}
+
+	gitCmd(t, dir, "update-ref", "refs/heads/main", gitCmd(t, src, "rev-parse", "main")[:40])
+	gitCmd(t, dir, "fsck", "--strict")
+}
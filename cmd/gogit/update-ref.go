@@ -0,0 +1,683 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/go-git/go-billy/v6"
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/storage"
+	"github.com/go-git/go-git/v6/storage/filesystem"
+	"github.com/spf13/cobra"
+)
+
+var (
+	updateRefMessage string
+	updateRefDelete  bool
+	updateRefNoDeref bool
+	updateRefStdin   bool
+	updateRefNul     bool
+)
+
+func init() {
+	updateRefCmd.Flags().StringVarP(&updateRefMessage, "message", "m", "", "Reason recorded in the reflog")
+	updateRefCmd.Flags().BoolVarP(&updateRefDelete, "delete", "d", false, "Delete the reference")
+	updateRefCmd.Flags().BoolVarP(&updateRefNoDeref, "no-deref", "", false, "Update a symbolic reference itself rather than its target")
+	updateRefCmd.Flags().BoolVarP(&updateRefStdin, "stdin", "", false, "Read a transaction of updates from stdin")
+	updateRefCmd.Flags().BoolVarP(&updateRefNul, "null", "z", false, "Read NUL-terminated commands with --stdin")
+	rootCmd.AddCommand(updateRefCmd)
+}
+
+var updateRefCmd = &cobra.Command{
+	Use:   "update-ref [-m <reason>] [--no-deref] (-d <ref> [<old-value>] | <ref> <new-value> [<old-value>] | --stdin [-z])",
+	Short: "Update the object name stored in a reference safely",
+	Args:  cobra.MaximumNArgs(3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		if updateRefStdin {
+			if len(args) > 0 {
+				return errors.New("--stdin takes no arguments")
+			}
+
+			return updateRefsFromStdin(newHooks(r, cmd.ErrOrStderr()), cmd.InOrStdin(), cmd.OutOrStdout())
+		}
+
+		u := &refUpdate{noDeref: updateRefNoDeref}
+
+		switch {
+		case updateRefDelete && len(args) >= 1 && len(args) <= 2:
+			u.name = plumbing.ReferenceName(args[0])
+			u.delete = true
+
+			if len(args) == 2 {
+				u.hasOld = true
+
+				u.old, err = parseRefValue(r, args[1])
+				if err != nil {
+					return err
+				}
+			}
+		case !updateRefDelete && len(args) >= 2:
+			u.name = plumbing.ReferenceName(args[0])
+
+			u.new, err = parseRefValue(r, args[1])
+			if err != nil {
+				return err
+			}
+
+			if len(args) == 3 {
+				u.hasOld = true
+
+				u.old, err = parseRefValue(r, args[2])
+				if err != nil {
+					return err
+				}
+			}
+		default:
+			return cmd.Usage()
+		}
+
+		t := &refTransaction{r: r, hooks: newHooks(r, cmd.ErrOrStderr())}
+
+		err = t.add(u)
+		if err == nil {
+			err = t.commit(updateRefMessage)
+		}
+
+		if err != nil {
+			return fmt.Errorf("update_ref failed for ref '%s': %w", u.name, err)
+		}
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// refUpdate is a single change to a reference within a transaction.
+type refUpdate struct {
+	name    plumbing.ReferenceName
+	new     plumbing.Hash
+	old     plumbing.Hash
+	hasOld  bool
+	delete  bool
+	verify  bool
+	noDeref bool
+
+	// via is the symbolic reference the update was given through, and
+	// current the reference as it was when the update was prepared.
+	via     plumbing.ReferenceName
+	current *plumbing.Reference
+}
+
+// refTransaction applies a set of reference updates all together: the
+// references are locked and their old values checked when it is prepared,
+// and they stay locked until it is committed or aborted. The updates
+// already applied are rolled back if a later one fails.
+type refTransaction struct {
+	r        *git.Repository
+	hooks    *hooks
+	updates  []*refUpdate
+	prepared bool
+
+	// locks are the lock files held on the references, and before the
+	// references as they were when they were locked.
+	fs     billy.Filesystem
+	locks  []string
+	before refSnapshot
+}
+
+func (t *refTransaction) add(u *refUpdate) error {
+	for _, other := range t.updates {
+		if other.name == u.name {
+			return fmt.Errorf("multiple updates for ref '%s' not allowed", u.name)
+		}
+	}
+
+	t.updates = append(t.updates, u)
+
+	return nil
+}
+
+// prepare resolves and locks the references to update, checks their old
+// values and that the new values exist, and runs the
+// reference-transaction hook in the "prepared" state. The locks are
+// released when it fails.
+func (t *refTransaction) prepare() error {
+	if t.prepared {
+		return nil
+	}
+
+	err := t.lockRefs()
+	if err == nil {
+		err = t.hooks.prepareRefUpdates(t.hookInput())
+	}
+
+	if err != nil {
+		t.unlock()
+
+		return err
+	}
+
+	t.prepared = true
+
+	return nil
+}
+
+func (t *refTransaction) lockRefs() error {
+	store, ok := t.r.Storer.(*filesystem.Storage)
+	if !ok {
+		return errors.New("storer does not implement filesystem.Storage")
+	}
+
+	t.fs = store.Filesystem()
+
+	for _, u := range t.updates {
+		ref, err := t.r.Storer.Reference(u.name)
+		for !u.noDeref && err == nil && ref.Type() == plumbing.SymbolicReference {
+			if u.via == "" {
+				u.via = u.name
+			}
+
+			u.name = ref.Target()
+			ref, err = t.r.Storer.Reference(u.name)
+		}
+
+		if err != nil && !errors.Is(err, plumbing.ErrReferenceNotFound) {
+			return fmt.Errorf("cannot lock ref '%s': %w", u.name, err)
+		}
+
+		if err == nil {
+			u.current = ref
+		}
+	}
+
+	// Updates given through symbolic references may only be told apart
+	// once these are resolved.
+	seen := make(map[plumbing.ReferenceName]*refUpdate)
+
+	for _, u := range t.updates {
+		if other, ok := seen[u.name]; ok {
+			via := u.via
+			if via == "" {
+				via = other.via
+			}
+
+			return fmt.Errorf("multiple updates for '%s' (including one via symref '%s') are not allowed", u.name, via)
+		}
+
+		seen[u.name] = u
+	}
+
+	// go-git would take lock files for references, so the references
+	// are listed before any is created, and those already locked are
+	// refused first.
+	for _, u := range t.updates {
+		if _, err := t.fs.Lstat(lockFile(u.name)); err == nil {
+			return errRefLocked(t.fs, u.name)
+		}
+	}
+
+	before, err := snapshotRefs(t.r)
+	if err != nil {
+		return err
+	}
+
+	t.before = before
+
+	for _, u := range t.updates {
+		err := t.lock(u.name)
+		if err != nil {
+			return err
+		}
+
+		if u.hasOld {
+			switch {
+			case u.old.IsZero() && u.current != nil:
+				return fmt.Errorf("cannot lock ref '%s': reference already exists", u.name)
+			case !u.old.IsZero() && u.current == nil:
+				return fmt.Errorf("cannot lock ref '%s': unable to resolve reference '%s'", u.name, u.name)
+			case !u.old.IsZero() && u.current.Hash() != u.old:
+				return fmt.Errorf("cannot lock ref '%s': is at %s but expected %s", u.name, u.current.Hash(), u.old)
+			}
+		}
+
+		if u.delete || u.verify {
+			continue
+		}
+
+		if u.new.IsZero() {
+			u.delete = true
+
+			continue
+		}
+
+		if _, err := t.r.Storer.EncodedObject(plumbing.AnyObject, u.new); err != nil {
+			return fmt.Errorf("cannot update ref '%s': trying to write ref '%s' with nonexistent object %s", u.name, u.name, u.new)
+		}
+	}
+
+	return nil
+}
+
+// lock creates the lock file of the reference the way git does, so that
+// no other process updates it meanwhile.
+func (t *refTransaction) lock(name plumbing.ReferenceName) error {
+	path := lockFile(name)
+
+	err := t.fs.MkdirAll(t.fs.Join(path, ".."), 0o777)
+	if err != nil {
+		return fmt.Errorf("cannot lock ref '%s': %w", name, err)
+	}
+
+	f, err := t.fs.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o666)
+	if errors.Is(err, os.ErrExist) {
+		return errRefLocked(t.fs, name)
+	}
+
+	if err != nil {
+		return fmt.Errorf("cannot lock ref '%s': %w", name, err)
+	}
+
+	t.locks = append(t.locks, path)
+
+	return f.Close()
+}
+
+func lockFile(name plumbing.ReferenceName) string {
+	return name.String() + ".lock"
+}
+
+func errRefLocked(fs billy.Filesystem, name plumbing.ReferenceName) error {
+	return fmt.Errorf("cannot lock ref '%s': Unable to create '%s': File exists", name, fs.Join(fs.Root(), lockFile(name)))
+}
+
+// unlock releases the locks held on the references.
+func (t *refTransaction) unlock() {
+	for _, path := range t.locks {
+		_ = t.fs.Remove(path)
+	}
+
+	t.locks = nil
+}
+
+// commit applies the updates, recording them in the reflog with msg. Each
+// reference is only written if it still has the value it was prepared
+// with.
+func (t *refTransaction) commit(msg string) error {
+	err := t.prepare()
+	if err != nil {
+		return err
+	}
+
+	defer t.unlock()
+
+	var applied []*refUpdate
+
+	for _, u := range t.updates {
+		if u.verify {
+			continue
+		}
+
+		err = t.apply(u)
+		if err != nil {
+			err = fmt.Errorf("cannot update ref '%s': %w", u.name, err)
+
+			rollbackErr := t.rollback(applied)
+			if rollbackErr != nil {
+				err = errors.Join(err, rollbackErr)
+			}
+
+			_ = t.hooks.referenceTransaction("aborted", t.hookInput())
+
+			return err
+		}
+
+		applied = append(applied, u)
+	}
+
+	t.unlock()
+
+	return logRefUpdates(t.hooks, t.before, staticReflogMessage(msg))
+}
+
+// apply writes the update, provided the reference did not change since it
+// was prepared.
+func (t *refTransaction) apply(u *refUpdate) error {
+	if !u.delete {
+		if u.current == nil {
+			_, err := t.r.Storer.Reference(u.name)
+			if err == nil {
+				return storage.ErrReferenceHasChanged
+			}
+		}
+
+		return t.r.Storer.CheckAndSetReference(plumbing.NewHashReference(u.name, u.new), u.current)
+	}
+
+	ref, err := t.r.Storer.Reference(u.name)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) && u.current == nil {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if u.current == nil || ref.Hash() != u.current.Hash() {
+		return storage.ErrReferenceHasChanged
+	}
+
+	return t.r.Storer.RemoveReference(u.name)
+}
+
+// abort drops the updates, running the reference-transaction hook in the
+// "aborted" state.
+func (t *refTransaction) abort() {
+	t.unlock()
+
+	_ = t.hooks.referenceTransaction("aborted", t.hookInput())
+}
+
+// hookInput returns the updates as lines for the reference-transaction
+// hook, verifications left out.
+func (t *refTransaction) hookInput() []string {
+	var lines []string
+
+	for _, u := range t.updates {
+		if u.verify {
+			continue
+		}
+
+		from := u.old
+		if u.current != nil {
+			from = u.current.Hash()
+		}
+
+		var to plumbing.Hash
+		if !u.delete {
+			to = u.new
+		}
+
+		lines = append(lines, refTransactionLine(u.name, from, to))
+	}
+
+	return lines
+}
+
+// rollback restores the references changed by applied updates, and
+// returns the errors of those it could not restore.
+func (t *refTransaction) rollback(applied []*refUpdate) error {
+	var errs []error
+
+	for _, u := range applied {
+		var err error
+		if u.current == nil {
+			err = t.r.Storer.RemoveReference(u.name)
+		} else {
+			err = t.r.Storer.SetReference(u.current)
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cannot restore ref '%s': %w", u.name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// parseRefValue resolves a new or old reference value, where an empty value
+// stands for the zero id.
+func parseRefValue(r *git.Repository, value string) (plumbing.Hash, error) {
+	if value == "" {
+		return plumbing.ZeroHash, nil
+	}
+
+	h, err := resolveObject(r, value)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("%s: not a valid SHA1", value)
+	}
+
+	return h, nil
+}
+
+// Transaction states of update-ref --stdin.
+const (
+	transactionClosed = iota
+	transactionOpen
+	transactionStarted
+	transactionPrepared
+)
+
+// updateRefsFromStdin runs the update-ref --stdin protocol. Updates given
+// outside of an explicit start are committed together at the end of the
+// input, while a started transaction that is not committed is aborted.
+func updateRefsFromStdin(hs *hooks, in io.Reader, out io.Writer) error {
+	r := hs.r
+
+	var (
+		t       *refTransaction
+		state   = transactionClosed
+		noDeref = updateRefNoDeref
+	)
+
+	// Like git, the references locked by a transaction that fails are
+	// released on the way out.
+	defer func() {
+		if t != nil {
+			t.unlock()
+		}
+	}()
+
+	rd := bufio.NewReader(in)
+
+	for {
+		command, args, err := readRefCommand(rd)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if state == transactionClosed {
+			t = &refTransaction{r: r, hooks: hs}
+			state = transactionOpen
+		}
+
+		switch command {
+		case "start":
+			if state != transactionOpen {
+				return fmt.Errorf("start: not allowed in state %s", transactionStateName(state))
+			}
+
+			state = transactionStarted
+
+			fmt.Fprintln(out, "start: ok")
+		case "prepare":
+			err = t.prepare()
+			if err != nil {
+				return err
+			}
+
+			state = transactionPrepared
+
+			fmt.Fprintln(out, "prepare: ok")
+		case "commit":
+			err = t.commit(updateRefMessage)
+			if err != nil {
+				return err
+			}
+
+			state = transactionClosed
+
+			fmt.Fprintln(out, "commit: ok")
+		case "abort":
+			t.abort()
+
+			state = transactionClosed
+
+			fmt.Fprintln(out, "abort: ok")
+		case "option":
+			if len(args) != 1 || args[0] != "no-deref" {
+				return fmt.Errorf("option unknown: %s", strings.Join(args, " "))
+			}
+
+			// The option only applies to the next update.
+			noDeref = true
+		default:
+			if state == transactionPrepared {
+				return fmt.Errorf("%s: not allowed in state prepared", command)
+			}
+
+			u, err := parseRefCommand(r, command, args)
+			if err != nil {
+				return err
+			}
+
+			u.noDeref = noDeref
+			noDeref = updateRefNoDeref
+
+			err = t.add(u)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	switch state {
+	case transactionOpen:
+		return t.commit(updateRefMessage)
+	case transactionStarted, transactionPrepared:
+		t.abort()
+	}
+
+	return nil
+}
+
+func transactionStateName(state int) string {
+	switch state {
+	case transactionOpen:
+		return "open"
+	case transactionStarted:
+		return "started"
+	case transactionPrepared:
+		return "prepared"
+	default:
+		return "closed"
+	}
+}
+
+// readRefCommand reads an update-ref --stdin command and its arguments. In
+// NUL-terminated mode the first argument follows the command after a
+// space, and the values after it are each terminated by a NUL.
+func readRefCommand(rd *bufio.Reader) (string, []string, error) {
+	if !updateRefNul {
+		line, err := rd.ReadString('\n')
+		if line == "" && err != nil {
+			return "", nil, err
+		}
+
+		fields := strings.Split(strings.TrimSuffix(line, "\n"), " ")
+
+		return fields[0], fields[1:], nil
+	}
+
+	field, err := rd.ReadString(0)
+	if field == "" && err != nil {
+		return "", nil, err
+	}
+
+	command, name, hasName := strings.Cut(strings.TrimSuffix(field, "\x00"), " ")
+	if !hasName {
+		return command, nil, nil
+	}
+
+	values := map[string]int{"update": 2, "create": 1, "delete": 1, "verify": 1}[command]
+	args := []string{name}
+
+	for i := 0; i < values; i++ {
+		value, err := rd.ReadString(0)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s %s: unexpected end of input", command, name)
+		}
+
+		args = append(args, strings.TrimSuffix(value, "\x00"))
+	}
+
+	// An empty old value means no check in NUL-terminated mode.
+	if command != "create" && len(args) > 1 && args[len(args)-1] == "" {
+		args = args[:len(args)-1]
+	}
+
+	return command, args, nil
+}
+
+// parseRefCommand builds the update described by an update, create, delete
+// or verify command.
+func parseRefCommand(r *git.Repository, command string, args []string) (*refUpdate, error) {
+	required := map[string]int{"update": 2, "create": 2, "delete": 1, "verify": 1}
+
+	n, ok := required[command]
+	if !ok {
+		return nil, fmt.Errorf("unknown command: %s", command)
+	}
+
+	switch {
+	case len(args) == 0:
+		return nil, fmt.Errorf("%s: missing <ref>", command)
+	case len(args) < n:
+		return nil, fmt.Errorf("%s %s: missing <newvalue>", command, args[0])
+	case len(args) > n+1 || (command == "create" && len(args) > n):
+		return nil, fmt.Errorf("%s %s: extra input: %s", command, args[0], strings.Join(args[n:], " "))
+	}
+
+	u := &refUpdate{
+		name:   plumbing.ReferenceName(args[0]),
+		delete: command == "delete",
+		verify: command == "verify",
+	}
+
+	var err error
+
+	if n == 2 {
+		u.new, err = parseRefValue(r, args[1])
+		if err != nil {
+			return nil, err
+		}
+
+		if command == "create" && u.new.IsZero() {
+			return nil, fmt.Errorf("create %s: zero <newvalue>", args[0])
+		}
+	}
+
+	if command == "create" {
+		u.hasOld = true
+	}
+
+	if len(args) > n {
+		u.hasOld = true
+
+		u.old, err = parseRefValue(r, args[n])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Like git, verifying without an old value checks that the reference
+	// does not exist.
+	if command == "verify" && len(args) == 1 {
+		u.hasOld = true
+	}
+
+	return u, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdateRef(t *testing.T) {
+	steps := []struct {
+		args  []string
+		stdin string
+	}{
+		{args: []string{"update-ref", "refs/heads/x", "main~1"}},
+		{args: []string{"update-ref", "-m", "move x", "refs/heads/x", "main", "main~1"}},
+		{args: []string{"update-ref", "-d", "refs/heads/topic"}},
+		{args: []string{"symbolic-ref", "refs/heads/sym", "refs/heads/merged"}},
+		{args: []string{"update-ref", "refs/heads/sym", "main"}},
+		{args: []string{"update-ref", "--no-deref", "refs/heads/sym2", "main~1"}},
+		{
+			args:  []string{"update-ref", "--stdin"},
+			stdin: "create refs/heads/y main\nupdate refs/heads/x main~1 main\ndelete refs/tags/light\nverify refs/heads/main main\n",
+		},
+		{
+			args:  []string{"update-ref", "--stdin"},
+			stdin: "start\nupdate refs/heads/y main~1\nprepare\ncommit\nstart\ndelete refs/heads/x\nabort\n",
+		},
+		{
+			args:  []string{"update-ref", "--stdin", "-z"},
+			stdin: "create refs/heads/z\x00main\x00update refs/heads/y\x00main\x00\x00",
+		},
+	}
+
+	want, got := refsRepo(t), refsRepo(t)
+
+	for _, step := range steps {
+		wantOut := gitCmdStdin(t, want, step.stdin, step.args...)
+
+		res := gogitStdin(t, got, step.stdin, step.args...)
+		if res.code != 0 || res.stdout != wantOut {
+			t.Fatalf("gogit %v exited with %d:\n%s%s\nwant, as git:\n%s", step.args, res.code, res.stdout, res.stderr, wantOut)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"for-each-ref"},
+		{"symbolic-ref", "refs/heads/sym"},
+		{"reflog", "show", "--format=%gd %gs", "refs/heads/x"},
+	} {
+		if g, w := gitCmd(t, got, args...), gitCmd(t, want, args...); g != w {
+			t.Errorf("git %v after gogit:\n%s\nwant, after git:\n%s", args, g, w)
+		}
+	}
+}
+
+// TestUpdateRefStdinFailure checks that a transaction fails as a whole,
+// and leaves the references untouched.
+func TestUpdateRefStdinFailure(t *testing.T) {
+	dir := refsRepo(t)
+	before := gitCmd(t, dir, "for-each-ref")
+
+	res := gogitStdin(t, dir, "create refs/heads/new main\nverify refs/heads/main main~1\n", "update-ref", "--stdin")
+	if res.code == 0 {
+		t.Error("update-ref --stdin with a failing verify succeeded")
+	}
+
+	if after := gitCmd(t, dir, "for-each-ref"); after != before {
+		t.Errorf("the failed transaction updated the references:\n%s\nwant:\n%s", after, before)
+	}
+
+	res = gogit(t, dir, "update-ref", "refs/heads/topic", "main", "main")
+	if res.code == 0 {
+		t.Error("update-ref with a wrong old value succeeded")
+	}
+
+	_, err := os.Stat(filepath.Join(dir, ".git", "refs", "heads", "topic.lock"))
+	if !os.IsNotExist(err) {
+		t.Errorf("update-ref left a lock file: %v", err)
+	}
+}
@@ -394,10 +394,14 @@ func collectObjectInfo(entries idxfile.EntryIter, scanner *packfile.Scanner) ([]
 			return nil, errors.New("failed to scan pack header")
 		}
 
+		// The entry hash keeps the bytes following it in the index past
+		// its size, which would not match the hashes of the delta bases.
+		hash, _ := plumbing.FromBytes(entry.Hash.Bytes())
+
 		// For delta objects, Size is the delta size.
 		// For regular objects, Size is the inflated size.
 		info := objectInfo{
-			hash:     entry.Hash,
+			hash:     hash,
 			diskType: header.Type,
 			size:     header.Size,
 			offset:   int64(entry.Offset),
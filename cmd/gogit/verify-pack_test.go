@@ -0,0 +1,38 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyPackRefDeltas(t *testing.T) {
+	var files []string
+	for i, name := range manyFiles(80) {
+		if i%2 == 1 {
+			name = strings.Repeat("line\n", 200) + name
+		}
+
+		files = append(files, name)
+	}
+
+	dir := gitRepo(t, files)
+	gitCmd(t, dir, "-c", "repack.useDeltaBaseOffset=false", "repack", "-q", "-a", "-d")
+
+	idx, err := filepath.Glob(filepath.Join(dir, ".git", "objects", "pack", "*.idx"))
+	if err != nil || len(idx) != 1 {
+		t.Fatalf("found packs %v: %v", idx, err)
+	}
+
+	// git names the pack on the last line where gogit names the index.
+	lines := func(out string) string {
+		return out[:strings.LastIndex(strings.TrimSuffix(out, "\n"), "\n")]
+	}
+
+	want := gitCmd(t, dir, "verify-pack", "-v", idx[0])
+
+	got := mustGogit(t, dir, "verify-pack", "-v", idx[0])
+	if lines(got) != lines(want) {
+		t.Errorf("verify-pack -v:\n%s\nwant, as git:\n%s", got, want)
+	}
+}
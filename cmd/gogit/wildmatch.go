@@ -0,0 +1,356 @@
+package main
+
+import "strings"
+
+// wildmatch results, as in git: a failure to match can tell the callers
+// trying later positions of the text that they cannot succeed either.
+const (
+	wildMatch = iota
+	wildNoMatch
+	wildAbortAll
+	wildAbortToDoubleStar
+)
+
+// wildmatch reports whether text matches the shell glob pattern the way
+// git's wildmatch does. With pathname, wildcards do not match '/' and "**"
+// between slashes matches any number of directories.
+func wildmatch(pattern, text string, pathname bool) bool {
+	return doWild(pattern, text, pathname) == wildMatch
+}
+
+func doWild(p, text string, pathname bool) int {
+	at := func(s string, i int) byte {
+		if i < len(s) {
+			return s[i]
+		}
+
+		return 0
+	}
+
+	pi, ti := 0, 0
+
+	for ; pi < len(p); pi, ti = pi+1, ti+1 {
+		pc := p[pi]
+		tc := at(text, ti)
+
+		if tc == 0 && pc != '*' {
+			return wildAbortAll
+		}
+
+		switch pc {
+		case '\\':
+			pi++
+			pc = at(p, pi)
+
+			if tc != pc {
+				return wildNoMatch
+			}
+		case '?':
+			if pathname && tc == '/' {
+				return wildNoMatch
+			}
+		case '*':
+			matchSlash := !pathname
+
+			pi++
+			if at(p, pi) == '*' {
+				prev := pi - 1
+				for at(p, pi) == '*' {
+					pi++
+				}
+
+				if pathname && (prev == 0 || p[prev-1] == '/') &&
+					(pi == len(p) || p[pi] == '/' || (p[pi] == '\\' && at(p, pi+1) == '/')) {
+					if at(p, pi) == '/' && doWild(p[pi+1:], text[ti:], pathname) == wildMatch {
+						return wildMatch
+					}
+
+					matchSlash = true
+				}
+			}
+
+			if pi == len(p) {
+				if !matchSlash && strings.Contains(text[ti:], "/") {
+					return wildAbortToDoubleStar
+				}
+
+				return wildMatch
+			}
+
+			if !matchSlash && p[pi] == '/' {
+				slash := strings.IndexByte(text[ti:], '/')
+				if slash < 0 {
+					return wildAbortAll
+				}
+
+				// The slash itself is matched by the loop.
+				ti += slash - 1
+				pi--
+
+				break
+			}
+
+			for ; ti < len(text); ti++ {
+				matched := doWild(p[pi:], text[ti:], pathname)
+				if matched != wildNoMatch {
+					if !matchSlash || matched != wildAbortToDoubleStar {
+						return matched
+					}
+				} else if !matchSlash && text[ti] == '/' {
+					return wildAbortToDoubleStar
+				}
+			}
+
+			return wildAbortAll
+		case '[':
+			var ok bool
+
+			pi, ok = matchBracket(p, pi, tc)
+			if pi < 0 {
+				return wildAbortAll
+			}
+
+			if !ok || (pathname && tc == '/') {
+				return wildNoMatch
+			}
+		default:
+			if tc != pc {
+				return wildNoMatch
+			}
+		}
+	}
+
+	if ti < len(text) {
+		return wildNoMatch
+	}
+
+	return wildMatch
+}
+
+// matchBracket matches c against the bracket expression starting at
+// p[open]. It returns the index of the closing bracket, or -1 if the
+// expression is malformed, and whether c matched.
+func matchBracket(p string, open int, c byte) (int, bool) {
+	at := func(i int) byte {
+		if i < len(p) {
+			return p[i]
+		}
+
+		return 0
+	}
+
+	i := open + 1
+
+	pc := at(i)
+	if pc == '^' {
+		pc = '!'
+	}
+
+	negated := pc == '!'
+	if negated {
+		i++
+		pc = at(i)
+	}
+
+	var prev byte
+
+	matched := false
+
+	for {
+		switch {
+		case pc == 0:
+			return -1, false
+		case pc == '\\':
+			i++
+
+			pc = at(i)
+			if pc == 0 {
+				return -1, false
+			}
+
+			if c == pc {
+				matched = true
+			}
+		case pc == '-' && prev != 0 && at(i+1) != 0 && at(i+1) != ']':
+			i++
+
+			pc = at(i)
+			if pc == '\\' {
+				i++
+
+				pc = at(i)
+				if pc == 0 {
+					return -1, false
+				}
+			}
+
+			if c <= pc && c >= prev {
+				matched = true
+			}
+
+			pc = 0
+		case pc == '[' && at(i+1) == ':':
+			start := i + 2
+
+			end := strings.IndexByte(p[start:], ']')
+			if end < 0 {
+				return -1, false
+			}
+
+			end += start
+			if end == start || p[end-1] != ':' {
+				// Not a character class: a literal '['.
+				i = start - 2
+				if c == '[' {
+					matched = true
+				}
+
+				break
+			}
+
+			class, ok := classMatch(p[start:end-1], c)
+			if !ok {
+				return -1, false
+			}
+
+			if class {
+				matched = true
+			}
+
+			i = end
+			pc = 0
+		default:
+			if c == pc {
+				matched = true
+			}
+		}
+
+		prev = pc
+		i++
+
+		pc = at(i)
+		if pc == ']' {
+			break
+		}
+	}
+
+	return i, matched != negated
+}
+
+// classMatch reports whether c belongs to the named POSIX character class,
+// and whether the class is known.
+func classMatch(class string, c byte) (bool, bool) {
+	isAlpha := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+	isDigit := c >= '0' && c <= '9'
+
+	switch class {
+	case "alnum":
+		return isAlpha || isDigit, true
+	case "alpha":
+		return isAlpha, true
+	case "blank":
+		return c == ' ' || c == '\t', true
+	case "cntrl":
+		return c < 0x20 || c == 0x7f, true
+	case "digit":
+		return isDigit, true
+	case "graph":
+		return c > 0x20 && c < 0x7f, true
+	case "lower":
+		return c >= 'a' && c <= 'z', true
+	case "print":
+		return c >= 0x20 && c < 0x7f, true
+	case "punct":
+		return c > 0x20 && c < 0x7f && !isAlpha && !isDigit, true
+	case "space":
+		return c == ' ' || c == '\t' || c == '\n' || c == '\r', true
+	case "upper":
+		return c >= 'A' && c <= 'Z', true
+	case "xdigit":
+		return isDigit || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F', true
+	default:
+		return false, false
+	}
+}
+
+// pathPattern is a pattern of a gitattributes file.
+type pathPattern struct {
+	// text is the pattern without its leading "!" and trailing "/".
+	text string
+	// base is the directory holding the file the pattern comes from,
+	// empty at the top of the worktree.
+	base     string
+	negative bool
+	dirOnly  bool
+	noDir    bool
+}
+
+func parsePathPattern(p, base string) *pathPattern {
+	pat := &pathPattern{base: base}
+
+	if rest, ok := strings.CutPrefix(p, "!"); ok {
+		pat.negative = true
+		p = rest
+	}
+
+	if rest, ok := strings.CutSuffix(p, "/"); ok {
+		pat.dirOnly = true
+		p = rest
+	}
+
+	pat.text = p
+	pat.noDir = !strings.Contains(p, "/")
+
+	return pat
+}
+
+// String returns the pattern as it is written in its file.
+func (p *pathPattern) String() string {
+	s := p.text
+	if p.negative {
+		s = "!" + s
+	}
+
+	if p.dirOnly {
+		s += "/"
+	}
+
+	return s
+}
+
+// match reports whether the slash-separated path, relative to the top of
+// the worktree, matches the pattern. Patterns without a slash match the
+// last element of the path, the others the path relative to their base.
+func (p *pathPattern) match(name string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+
+	if p.noDir {
+		return wildmatch(p.text, name[strings.LastIndexByte(name, '/')+1:], false)
+	}
+
+	if p.base != "" {
+		rest, ok := strings.CutPrefix(name, p.base+"/")
+		if !ok {
+			return false
+		}
+
+		name = rest
+	}
+
+	// Like git, the literal prefix of the pattern is compared on its own,
+	// which makes a "**" following it match leading directories.
+	pattern := strings.TrimPrefix(p.text, "/")
+
+	prefix := strings.IndexAny(pattern, `*?[\`)
+	if prefix < 0 {
+		return pattern == name
+	}
+
+	if !strings.HasPrefix(name, pattern[:prefix]) {
+		return false
+	}
+
+	return wildmatch(pattern[prefix:], name[prefix:], true)
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 
 	"github.com/go-git/go-billy/v6/memfs"
@@ -63,20 +64,88 @@ var worktreeAddCmd = &cobra.Command{
 			opts = append(opts, worktree.WithDetachedHead())
 		}
 
+		target := plumbing.ZeroHash
 		if worktreeAddCommit != "" {
-			hash := plumbing.NewHash(worktreeAddCommit)
-			if !hash.IsZero() {
-				opts = append(opts, worktree.WithCommit(hash))
+			target = plumbing.NewHash(worktreeAddCommit)
+		}
+
+		if target.IsZero() {
+			head, err := r.Head()
+			if err != nil {
+				return fmt.Errorf("invalid reference: %w", err)
 			}
+
+			target = head.Hash()
+		}
+
+		opts = append(opts, worktree.WithCommit(target))
+
+		before, err := snapshotRefs(r)
+		if err != nil {
+			return err
+		}
+
+		// go-git writes the references of the new worktree through its
+		// own storage, so the reference-transaction hook is told about
+		// the updates it is going to make.
+		updates := []string{refTransactionLine(plumbing.HEAD, plumbing.ZeroHash, target)}
+		if !worktreeAddDetach {
+			updates = append(updates, refTransactionLine(plumbing.NewBranchReferenceName(name), plumbing.ZeroHash, target))
+		}
+
+		hs := newHooks(r, cmd.ErrOrStderr())
+
+		err = hs.prepareRefUpdates(updates)
+		if err != nil {
+			return err
 		}
 
 		err = w.Add(wt, name, opts...)
 		if err != nil {
+			_ = hs.referenceTransaction("aborted", updates)
+
 			return fmt.Errorf("failed to add worktree: %w", err)
 		}
 
+		wtRepo, err := w.Open(wt)
+		if err != nil {
+			return fmt.Errorf("failed to open worktree: %w", err)
+		}
+
+		err = smudgeWorktree(wtRepo, cmd.ErrOrStderr(), nil)
+		if err != nil {
+			return err
+		}
+
+		// The new worktree has its own HEAD, so it is always logged as
+		// created rather than compared with the HEAD of the main worktree.
+		delete(before, plumbing.HEAD)
+
+		hs = hs.forRepo(wtRepo)
+
+		err = logRefUpdates(hs, before, func(name plumbing.ReferenceName, _, to plumbing.Hash) string {
+			if name == plumbing.HEAD {
+				return "worktree add: " + path
+			}
+
+			return "branch: Created from " + to.String()
+		})
+		if err != nil {
+			return err
+		}
+
 		fmt.Fprintf(cmd.OutOrStdout(), "Worktree '%s' created at '%s'\n", name, path)
 
+		head, err := wtRepo.Head()
+		if err != nil {
+			return err
+		}
+
+		err = hs.postCheckout(plumbing.ZeroHash, head.Hash(), "1")
+		if err != nil {
+			return hookExitStatus(cmd, err)
+		}
+
 		return nil
 	},
 	DisableFlagsInUseLine: true,
@@ -163,6 +232,53 @@ func refName(ref *plumbing.Reference) string {
 	return fmt.Sprintf("(detached %s)", string(ref.Name()))
 }
 
+// linkedWorktree is a linked worktree, opened as a repository sharing the
+// objects and references of the main one but with its own HEAD, reflog of
+// HEAD and index.
+type linkedWorktree struct {
+	name string
+	r    *git.Repository
+}
+
+// refName returns the name under which git reports the per-worktree
+// reference name of the linked worktree, such as worktrees/<name>/HEAD.
+func (wt linkedWorktree) refName(name plumbing.ReferenceName) string {
+	return path.Join("worktrees", wt.name, name.String())
+}
+
+// linkedWorktrees opens the linked worktrees of r, sorted by name.
+func linkedWorktrees(r *git.Repository) ([]linkedWorktree, error) {
+	w, err := worktree.New(r.Storer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create worktree manager: %w", err)
+	}
+
+	names, err := w.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list worktrees: %w", err)
+	}
+
+	wts := make([]linkedWorktree, 0, len(names))
+
+	for _, name := range names {
+		wt := memfs.New()
+
+		err = w.Init(wt, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open worktree %s: %w", name, err)
+		}
+
+		wtRepo, err := w.Open(wt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open worktree %s: %w", name, err)
+		}
+
+		wts = append(wts, linkedWorktree{name: name, r: wtRepo})
+	}
+
+	return wts, nil
+}
+
 var worktreeRemoveCmd = &cobra.Command{
 	Use:   "remove <name>",
 	Short: "Remove a linked worktree",
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v6"
+	"github.com/go-git/go-git/v6/plumbing"
+	"github.com/go-git/go-git/v6/plumbing/filemode"
+	"github.com/go-git/go-git/v6/plumbing/format/index"
+	"github.com/go-git/go-git/v6/plumbing/object"
+	"github.com/spf13/cobra"
+)
+
+var (
+	writeTreeMissingOK bool
+	writeTreePrefix    string
+)
+
+func init() {
+	writeTreeCmd.Flags().BoolVarP(&writeTreeMissingOK, "missing-ok", "", false, "Allow index entries for missing objects")
+	writeTreeCmd.Flags().StringVarP(&writeTreePrefix, "prefix", "", "", "Write the tree of the <prefix>/ subdirectory")
+	rootCmd.AddCommand(writeTreeCmd)
+}
+
+var writeTreeCmd = &cobra.Command{
+	Use:   "write-tree [--missing-ok] [--prefix=<prefix>/]",
+	Short: "Create a tree object from the current index",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		r, err := git.PlainOpen(".")
+		if err != nil {
+			return err
+		}
+
+		idx, err := r.Storer.Index()
+		if err != nil {
+			return fmt.Errorf("failed to read index: %w", err)
+		}
+
+		prefix := strings.Trim(writeTreePrefix, "/")
+		if prefix != "" {
+			prefix += "/"
+		}
+
+		var entries []*index.Entry
+
+		for _, e := range idx.Entries {
+			// Merged entries are stored at stage 0, which go-git's
+			// index.Merged does not match.
+			if e.Stage != 0 {
+				return errors.New("write-tree: error building trees")
+			}
+
+			if strings.HasPrefix(e.Name, prefix) {
+				entries = append(entries, e)
+			}
+		}
+
+		if prefix != "" && len(entries) == 0 {
+			return fmt.Errorf("write-tree: prefix %s not found", writeTreePrefix)
+		}
+
+		h, err := writeIndexTree(r, entries, prefix, writeTreeMissingOK)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(cmd.OutOrStdout(), h)
+
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
+
+// writeIndexTree stores the trees of the index entries below base, which
+// must be sorted by name, and returns the id of the tree of base.
+func writeIndexTree(r *git.Repository, entries []*index.Entry, base string, missingOK bool) (plumbing.Hash, error) {
+	var tree []object.TreeEntry
+
+	for i := 0; i < len(entries); {
+		name := strings.TrimPrefix(entries[i].Name, base)
+
+		if dir, _, ok := strings.Cut(name, "/"); ok {
+			j := i
+			for j < len(entries) && strings.HasPrefix(entries[j].Name, base+dir+"/") {
+				j++
+			}
+
+			h, err := writeIndexTree(r, entries[i:j], base+dir+"/", missingOK)
+			if err != nil {
+				return plumbing.ZeroHash, err
+			}
+
+			tree = append(tree, object.TreeEntry{Name: dir, Mode: filemode.Dir, Hash: h})
+			i = j
+
+			continue
+		}
+
+		e := entries[i]
+		if !missingOK && e.Mode != filemode.Submodule {
+			if err := r.Storer.HasEncodedObject(e.Hash); err != nil {
+				return plumbing.ZeroHash, fmt.Errorf("invalid object %o %s for '%s'", uint32(e.Mode), e.Hash, e.Name)
+			}
+		}
+
+		tree = append(tree, object.TreeEntry{Name: name, Mode: e.Mode, Hash: e.Hash})
+		i++
+	}
+
+	return writeTree(r, tree)
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestWriteTree(t *testing.T) {
+	dir := gitRepo(t, []string{"a", "1", "d/b", "2", "d/e/c", "3"})
+
+	writeFile(t, dir, "d/new", "4")
+	gitCmd(t, dir, "add", "d/new")
+	gitCmd(t, dir, "update-index", "--chmod=+x", "a")
+
+	sameOutput(t, dir, "write-tree")
+	sameOutput(t, dir, "write-tree", "--prefix=d/")
+	sameOutput(t, dir, "write-tree", "--prefix=d/e/")
+
+	gitCmd(t, dir, "update-index", "--add", "--cacheinfo", "100644,0123456789012345678901234567890123456789,missing")
+
+	if res := gogit(t, dir, "write-tree"); res.code == 0 {
+		t.Error("gogit write-tree accepted a missing object")
+	}
+
+	sameOutput(t, dir, "write-tree", "--missing-ok")
+}